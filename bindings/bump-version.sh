@@ -55,10 +55,10 @@ echo "  -> python/pyproject.toml"
 cd "$SCRIPT_DIR/python"
 sed -i "s/^version = \".*\"/version = \"$NEW_VERSION\"/" pyproject.toml
 
-# Update clib httpcloak.go version string
-echo "  -> clib/httpcloak.go"
-cd "$SCRIPT_DIR/clib"
-sed -i "s/return C.CString(\"[0-9]*\.[0-9]*\.[0-9]*\")/return C.CString(\"$NEW_VERSION\")/" httpcloak.go
+# Update Go library version string (clib reports it via httpcloak_version)
+echo "  -> version/version.go"
+cd "$SCRIPT_DIR/../version"
+sed -i "s/^var Version = \".*\"/var Version = \"$NEW_VERSION\"/" version.go
 
 # Update Python __init__.py version string
 echo "  -> python/httpcloak/__init__.py"
@@ -80,7 +80,7 @@ echo "  - bindings/nodejs/package.json (version + optionalDependencies)"
 echo "  - bindings/nodejs/npm/*/package.json (6 platform packages)"
 echo "  - bindings/python/pyproject.toml"
 echo "  - bindings/python/httpcloak/__init__.py"
-echo "  - bindings/clib/httpcloak.go"
+echo "  - version/version.go"
 echo "  - bindings/dotnet/HttpCloak/HttpCloak.csproj (if exists)"
 echo ""
 echo "Next steps:"
@@ -124,6 +124,7 @@ import (
 	"github.com/sardanioss/httpcloak/dns"
 	"github.com/sardanioss/httpcloak/fingerprint"
 	"github.com/sardanioss/httpcloak/transport"
+	"github.com/sardanioss/httpcloak/version"
 )
 
 func init() {
@@ -289,7 +290,8 @@ type ErrorResponse struct {
 }
 
 func makeErrorJSON(err error) *C.char {
-	resp := ErrorResponse{Error: err.Error()}
+	setLastError(0, err)
+	resp := ErrorResponse{Error: err.Error(), Code: errorCodeName(errorCode(err))}
 	data, _ := json.Marshal(resp)
 	return C.CString(string(data))
 }
@@ -715,6 +717,7 @@ func httpcloak_response_finalize(handle C.int64_t, dest unsafe.Pointer, destLen
 func httpcloak_get_raw(handle C.int64_t, url *C.char, optionsJSON *C.char) C.int64_t {
 	session := getSession(handle)
 	if session == nil {
+		setLastError(handle, ErrInvalidSession)
 		return -1
 	}
 
@@ -745,6 +748,7 @@ func httpcloak_get_raw(handle C.int64_t, url *C.char, optionsJSON *C.char) C.int
 
 	resp, err := session.Do(ctx, req)
 	if err != nil {
+		setLastError(handle, err)
 		return -1
 	}
 
@@ -755,6 +759,7 @@ func httpcloak_get_raw(handle C.int64_t, url *C.char, optionsJSON *C.char) C.int
 func httpcloak_post_raw(handle C.int64_t, url *C.char, body *C.char, bodyLen C.int, optionsJSON *C.char) C.int64_t {
 	session := getSession(handle)
 	if session == nil {
+		setLastError(handle, ErrInvalidSession)
 		return -1
 	}
 
@@ -795,6 +800,7 @@ func httpcloak_post_raw(handle C.int64_t, url *C.char, body *C.char, bodyLen C.i
 
 	resp, err := session.Do(ctx, req)
 	if err != nil {
+		setLastError(handle, err)
 		return -1
 	}
 
@@ -805,6 +811,7 @@ func httpcloak_post_raw(handle C.int64_t, url *C.char, body *C.char, bodyLen C.i
 func httpcloak_request_raw(handle C.int64_t, requestJSON *C.char, body *C.char, bodyLen C.int) C.int64_t {
 	session := getSession(handle)
 	if session == nil {
+		setLastError(handle, ErrInvalidSession)
 		return -1
 	}
 
@@ -821,6 +828,7 @@ func httpcloak_request_raw(handle C.int64_t, requestJSON *C.char, body *C.char,
 		var err error
 		bodyBytes, err = decodeRequestBody(config.Body, config.BodyEncoding)
 		if err != nil {
+			setLastError(handle, invalidArgument(err))
 			return -1 // Invalid base64
 		}
 	}
@@ -853,6 +861,7 @@ func httpcloak_request_raw(handle C.int64_t, requestJSON *C.char, body *C.char,
 
 	resp, err := session.Do(ctx, req)
 	if err != nil {
+		setLastError(handle, err)
 		return -1
 	}
 
@@ -1081,11 +1090,13 @@ func getSession(handle C.int64_t) *httpcloak.Session {
 func httpcloak_session_fork(handle C.int64_t) C.int64_t {
 	session := getSession(handle)
 	if session == nil {
+		setLastError(handle, ErrInvalidSession)
 		return -1
 	}
 
 	forks := session.Fork(1)
 	if len(forks) == 0 {
+		setLastError(handle, errors.New("fork failed"))
 		return -1
 	}
 
@@ -1359,7 +1370,7 @@ func httpcloak_get_async(handle C.int64_t, url *C.char, optionsJSON *C.char, cal
 
 		resp, err := session.Do(ctx, req)
 		if err != nil {
-			errResp := ErrorResponse{Error: err.Error()}
+			errResp := ErrorResponse{Error: err.Error(), Code: errorCodeName(errorCode(err))}
 			errJSON, _ := json.Marshal(errResp)
 			invokeCallback(int64(callbackID), "", string(errJSON))
 			return
@@ -1447,7 +1458,7 @@ func httpcloak_post_async(handle C.int64_t, url *C.char, body *C.char, optionsJS
 
 		resp, err := session.Do(ctx, req)
 		if err != nil {
-			errResp := ErrorResponse{Error: err.Error()}
+			errResp := ErrorResponse{Error: err.Error(), Code: errorCodeName(errorCode(err))}
 			errJSON, _ := json.Marshal(errResp)
 			invokeCallback(int64(callbackID), "", string(errJSON))
 			return
@@ -1528,7 +1539,7 @@ func httpcloak_request_async(handle C.int64_t, requestJSON *C.char, callbackID C
 		if config.Body != "" {
 			bodyBytes, err := decodeRequestBody(config.Body, config.BodyEncoding)
 			if err != nil {
-				errResp := ErrorResponse{Error: err.Error()}
+				errResp := ErrorResponse{Error: err.Error(), Code: errorCodeName(errorCode(err))}
 				errJSON, _ := json.Marshal(errResp)
 				invokeCallback(int64(callbackID), "", string(errJSON))
 				return
@@ -1545,7 +1556,7 @@ func httpcloak_request_async(handle C.int64_t, requestJSON *C.char, callbackID C
 
 		resp, err := session.Do(ctx, req)
 		if err != nil {
-			errResp := ErrorResponse{Error: err.Error()}
+			errResp := ErrorResponse{Error: err.Error(), Code: errorCodeName(errorCode(err))}
 			errJSON, _ := json.Marshal(errResp)
 			invokeCallback(int64(callbackID), "", string(errJSON))
 			return
@@ -1638,6 +1649,7 @@ func httpcloak_session_load(path *C.char) C.int64_t {
 	pathStr := C.GoString(path)
 	session, err := httpcloak.LoadSession(pathStr)
 	if err != nil {
+		setLastError(0, err)
 		return -1
 	}
 
@@ -1670,6 +1682,7 @@ func httpcloak_session_unmarshal(data *C.char) C.int64_t {
 	dataStr := C.GoString(data)
 	session, err := httpcloak.UnmarshalSession([]byte(dataStr))
 	if err != nil {
+		setLastError(0, invalidArgument(err))
 		return -1
 	}
 
@@ -1826,7 +1839,14 @@ func httpcloak_free_string(str *C.char) {
 
 //export httpcloak_version
 func httpcloak_version() *C.char {
-	return C.CString("1.6.0-beta.13")
+	return C.CString(version.Version)
+}
+
+//export httpcloak_build_info
+func httpcloak_build_info() *C.char {
+	// Full provenance as JSON: version, preset database, utls/quic-go, build hash
+	data, _ := json.Marshal(version.Get())
+	return C.CString(string(data))
 }
 
 //export httpcloak_available_presets
@@ -1876,6 +1896,8 @@ var (
 	ErrInvalidSession    = errors.New("invalid session handle")
 	ErrInvalidStream     = errors.New("invalid stream handle")
 	ErrInvalidLocalProxy = errors.New("invalid local proxy handle")
+	ErrInvalidUpload     = errors.New("invalid upload handle")
+	ErrUploadFinished    = errors.New("upload already finished")
 )
 
 // ============================================================================
@@ -2537,6 +2559,7 @@ func httpcloak_local_proxy_start(configJSON *C.char) C.int64_t {
 
 	proxy, err := httpcloak.StartLocalProxy(config.Port, opts...)
 	if err != nil {
+		setLastError(0, err)
 		return -1
 	}
 
@@ -2570,6 +2593,7 @@ func httpcloak_local_proxy_get_port(handle C.int64_t) C.int {
 	localProxyMu.RUnlock()
 
 	if !exists || proxy == nil {
+		setLastError(handle, ErrInvalidLocalProxy)
 		return -1
 	}
 
@@ -2672,6 +2696,7 @@ func getStream(handle int64) *httpcloak.StreamResponse {
 func httpcloak_stream_get(sessionHandle C.int64_t, url *C.char, optionsJSON *C.char) C.int64_t {
 	session := getSession(sessionHandle)
 	if session == nil {
+		setLastError(sessionHandle, ErrInvalidSession)
 		return -1
 	}
 
@@ -2706,6 +2731,7 @@ func httpcloak_stream_get(sessionHandle C.int64_t, url *C.char, optionsJSON *C.c
 	resp, err := session.DoStream(ctx, req)
 	if err != nil {
 		cancel()
+		setLastError(sessionHandle, err)
 		return -1
 	}
 
@@ -2723,6 +2749,7 @@ func httpcloak_stream_get(sessionHandle C.int64_t, url *C.char, optionsJSON *C.c
 func httpcloak_stream_post(sessionHandle C.int64_t, url *C.char, body *C.char, optionsJSON *C.char) C.int64_t {
 	session := getSession(sessionHandle)
 	if session == nil {
+		setLastError(sessionHandle, ErrInvalidSession)
 		return -1
 	}
 
@@ -2765,6 +2792,7 @@ func httpcloak_stream_post(sessionHandle C.int64_t, url *C.char, body *C.char, o
 	resp, err := session.DoStream(ctx, req)
 	if err != nil {
 		cancel()
+		setLastError(sessionHandle, err)
 		return -1
 	}
 
@@ -2782,6 +2810,7 @@ func httpcloak_stream_post(sessionHandle C.int64_t, url *C.char, body *C.char, o
 func httpcloak_stream_request(sessionHandle C.int64_t, requestJSON *C.char) C.int64_t {
 	session := getSession(sessionHandle)
 	if session == nil {
+		setLastError(sessionHandle, ErrInvalidSession)
 		return -1
 	}
 
@@ -2789,6 +2818,7 @@ func httpcloak_stream_request(sessionHandle C.int64_t, requestJSON *C.char) C.in
 	if requestJSON != nil {
 		jsonStr := C.GoString(requestJSON)
 		if err := json.Unmarshal([]byte(jsonStr), &config); err != nil {
+			setLastError(sessionHandle, invalidArgument(err))
 			return -1
 		}
 	}
@@ -2811,6 +2841,7 @@ func httpcloak_stream_request(sessionHandle C.int64_t, requestJSON *C.char) C.in
 		bodyBytes, err := decodeRequestBody(config.Body, config.BodyEncoding)
 		if err != nil {
 			cancel()
+			setLastError(sessionHandle, invalidArgument(err))
 			return -1
 		}
 		bodyReader = bytes.NewReader(bodyBytes)
@@ -2826,6 +2857,7 @@ func httpcloak_stream_request(sessionHandle C.int64_t, requestJSON *C.char) C.in
 	resp, err := session.DoStream(ctx, req)
 	if err != nil {
 		cancel()
+		setLastError(sessionHandle, err)
 		return -1
 	}
 
@@ -2897,6 +2929,7 @@ func httpcloak_stream_read(streamHandle C.int64_t, bufferSize C.int) *C.char {
 func httpcloak_stream_read_raw(streamHandle C.int64_t, buffer unsafe.Pointer, bufferSize C.int) C.int {
 	stream := getStream(int64(streamHandle))
 	if stream == nil {
+		setLastError(streamHandle, ErrInvalidStream)
 		return -1
 	}
 
@@ -2913,6 +2946,7 @@ func httpcloak_stream_read_raw(streamHandle C.int64_t, buffer unsafe.Pointer, bu
 		if err.Error() == "EOF" {
 			return 0 // EOF
 		}
+		setLastError(streamHandle, err)
 		return -1 // Error
 	}
 
@@ -2949,6 +2983,7 @@ type UploadOptions struct {
 func httpcloak_upload_start(sessionHandle C.int64_t, url *C.char, optionsJSON *C.char) C.int64_t {
 	session := getSession(sessionHandle)
 	if session == nil {
+		setLastError(sessionHandle, ErrInvalidSession)
 		return -1
 	}
 
@@ -3034,6 +3069,7 @@ func httpcloak_upload_write(uploadHandle C.int64_t, dataBase64 *C.char) C.int {
 	uploadMu.RUnlock()
 
 	if !exists || upload == nil {
+		setLastError(uploadHandle, ErrInvalidUpload)
 		return -1
 	}
 
@@ -3041,6 +3077,7 @@ func httpcloak_upload_write(uploadHandle C.int64_t, dataBase64 *C.char) C.int {
 	defer upload.mu.Unlock()
 
 	if upload.finished {
+		setLastError(uploadHandle, ErrUploadFinished)
 		return -1
 	}
 
@@ -3048,12 +3085,14 @@ func httpcloak_upload_write(uploadHandle C.int64_t, dataBase64 *C.char) C.int {
 	dataStr := C.GoString(dataBase64)
 	data, err := decodeBase64(dataStr)
 	if err != nil {
+		setLastError(uploadHandle, invalidArgument(err))
 		return -1
 	}
 
 	// Write to pipe
 	n, err := upload.pipeWriter.Write(data)
 	if err != nil {
+		setLastError(uploadHandle, err)
 		return -1
 	}
 
@@ -3067,6 +3106,7 @@ func httpcloak_upload_write_raw(uploadHandle C.int64_t, data unsafe.Pointer, dat
 	uploadMu.RUnlock()
 
 	if !exists || upload == nil {
+		setLastError(uploadHandle, ErrInvalidUpload)
 		return -1
 	}
 
@@ -3074,6 +3114,7 @@ func httpcloak_upload_write_raw(uploadHandle C.int64_t, data unsafe.Pointer, dat
 	defer upload.mu.Unlock()
 
 	if upload.finished {
+		setLastError(uploadHandle, ErrUploadFinished)
 		return -1
 	}
 
@@ -3083,6 +3124,7 @@ func httpcloak_upload_write_raw(uploadHandle C.int64_t, data unsafe.Pointer, dat
 	// Write to pipe
 	n, err := upload.pipeWriter.Write(buf)
 	if err != nil {
+		setLastError(uploadHandle, err)
 		return -1
 	}
 
@@ -3099,13 +3141,13 @@ func httpcloak_upload_finish(uploadHandle C.int64_t) *C.char {
 	uploadMu.Unlock()
 
 	if !exists || upload == nil {
-		return makeErrorJSON(errors.New("invalid upload handle"))
+		return makeErrorJSON(ErrInvalidUpload)
 	}
 
 	upload.mu.Lock()
 	if upload.finished {
 		upload.mu.Unlock()
-		return makeErrorJSON(errors.New("upload already finished"))
+		return makeErrorJSON(ErrUploadFinished)
 	}
 	upload.finished = true
 	upload.mu.Unlock()
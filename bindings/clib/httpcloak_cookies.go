@@ -0,0 +1,112 @@
+package main
+
+/*
+#include <stdint.h>
+*/
+import "C"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sardanioss/httpcloak/session"
+)
+
+// ============================================================================
+// Cookie Access
+// ============================================================================
+
+// httpcloak_session_get_cookies returns the cookies the session would send to
+// domain as a JSON array of cookie objects (same shape as response cookies).
+// Domain cookies are reported with a leading dot, host-only cookies without.
+// Pass NULL or "" to get every cookie in the jar.
+//
+//export httpcloak_session_get_cookies
+func httpcloak_session_get_cookies(handle C.int64_t, domain *C.char) *C.char {
+	sess := getSession(handle)
+	if sess == nil {
+		return makeErrorJSON(ErrInvalidSession)
+	}
+
+	var host string
+	if domain != nil {
+		host = C.GoString(domain)
+	}
+
+	states := sess.CookiesFor(host)
+	cookies := make([]Cookie, 0, len(states))
+	for _, c := range states {
+		cookie := Cookie{
+			Name:     c.Name,
+			Value:    c.Value,
+			Domain:   c.Domain,
+			Path:     c.Path,
+			MaxAge:   c.MaxAge,
+			Secure:   c.Secure,
+			HttpOnly: c.HttpOnly,
+			SameSite: c.SameSite,
+		}
+		if c.Expires != nil {
+			cookie.Expires = c.Expires.UTC().Format(time.RFC1123)
+		}
+		cookies = append(cookies, cookie)
+	}
+
+	data, _ := json.Marshal(cookies)
+	return C.CString(string(data))
+}
+
+// httpcloak_session_set_cookie stores one cookie given as a JSON cookie object
+// (the format returned by httpcloak_session_get_cookies). A domain with a
+// leading dot makes a domain cookie, one without a host-only cookie, and an
+// empty domain a cookie sent to every host.
+// Returns 0 on success, -1 on error (see httpcloak_last_error).
+//
+//export httpcloak_session_set_cookie
+func httpcloak_session_set_cookie(handle C.int64_t, cookieJSON *C.char) C.int {
+	sess := getSession(handle)
+	if sess == nil {
+		setLastError(handle, ErrInvalidSession)
+		return -1
+	}
+
+	var cookie Cookie
+	if cookieJSON == nil {
+		setLastError(handle, invalidArgument(errors.New("cookie is NULL")))
+		return -1
+	}
+	if err := json.Unmarshal([]byte(C.GoString(cookieJSON)), &cookie); err != nil {
+		setLastError(handle, invalidArgument(err))
+		return -1
+	}
+	if cookie.Name == "" {
+		setLastError(handle, invalidArgument(errors.New("cookie name is required")))
+		return -1
+	}
+
+	state := session.CookieState{
+		Name:     cookie.Name,
+		Value:    cookie.Value,
+		Domain:   cookie.Domain,
+		Path:     cookie.Path,
+		MaxAge:   cookie.MaxAge,
+		Secure:   cookie.Secure,
+		HttpOnly: cookie.HttpOnly,
+		SameSite: cookie.SameSite,
+	}
+	if cookie.Expires != "" {
+		expires, err := time.Parse(time.RFC1123, cookie.Expires)
+		if err != nil {
+			setLastError(handle, invalidArgument(fmt.Errorf("expires: %w", err)))
+			return -1
+		}
+		state.Expires = &expires
+	} else if cookie.MaxAge > 0 {
+		expires := time.Now().Add(time.Duration(cookie.MaxAge) * time.Second)
+		state.Expires = &expires
+	}
+
+	sess.PutCookie(state)
+	return 0
+}
@@ -0,0 +1,192 @@
+package main
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+
+// Last error is thread-local: a Go function exported to C runs on the calling
+// thread for its whole duration, and C calls made from it stay on that thread.
+// Each host thread therefore sees the error of its own most recent failed call.
+static __thread int last_error_code;
+static __thread int64_t last_error_handle;
+static __thread char* last_error_message;
+
+static void set_last_error(int code, int64_t handle, char* message) {
+    free(last_error_message);
+    last_error_code = code;
+    last_error_handle = handle;
+    last_error_message = message;
+}
+
+static int get_last_error_code(void) { return last_error_code; }
+static int64_t get_last_error_handle(void) { return last_error_handle; }
+static const char* get_last_error_message(void) { return last_error_message; }
+*/
+import "C"
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+
+	"github.com/sardanioss/httpcloak/session"
+	"github.com/sardanioss/httpcloak/transport"
+)
+
+// Error codes reported by httpcloak_last_error_code. They mirror the error
+// categories of the transport package so bindings can branch on the kind of
+// failure instead of parsing messages. Values are part of the ABI - append only.
+const (
+	errCodeNone          = 0
+	errCodeUnknown       = 1
+	errCodeInvalidHandle = 2
+	errCodeInvalidArg    = 3
+	errCodeConnection    = 4
+	errCodeTLS           = 5
+	errCodeDNS           = 6
+	errCodeTimeout       = 7
+	errCodeProxy         = 8
+	errCodeProtocol      = 9
+	errCodeRequest       = 10
+	errCodeResponse      = 11
+	errCodeClosed        = 12
+	errCodeCancelled     = 13
+)
+
+var errCodeNames = map[int]string{
+	errCodeNone:          "none",
+	errCodeUnknown:       "unknown",
+	errCodeInvalidHandle: "invalid_handle",
+	errCodeInvalidArg:    "invalid_argument",
+	errCodeConnection:    "connection",
+	errCodeTLS:           "tls",
+	errCodeDNS:           "dns",
+	errCodeTimeout:       "timeout",
+	errCodeProxy:         "proxy",
+	errCodeProtocol:      "protocol",
+	errCodeRequest:       "request",
+	errCodeResponse:      "response",
+	errCodeClosed:        "closed",
+	errCodeCancelled:     "cancelled",
+}
+
+// errInvalidArgument marks malformed input from the caller (bad JSON, bad base64)
+var errInvalidArgument = errors.New("invalid argument")
+
+// invalidArgument wraps err so it is classified as errCodeInvalidArg
+func invalidArgument(err error) error {
+	return errors.Join(errInvalidArgument, err)
+}
+
+// errorCode maps an error to its ABI error code. Order matters: a timeout
+// during a TLS handshake is reported as a timeout.
+func errorCode(err error) int {
+	if err == nil {
+		return errCodeNone
+	}
+
+	var netErr net.Error
+	switch {
+	case errors.Is(err, ErrInvalidSession), errors.Is(err, ErrInvalidStream), errors.Is(err, ErrInvalidLocalProxy), errors.Is(err, ErrInvalidUpload):
+		return errCodeInvalidHandle
+	case errors.Is(err, errInvalidArgument), errors.Is(err, ErrUploadFinished):
+		return errCodeInvalidArg
+	case errors.Is(err, context.Canceled):
+		return errCodeCancelled
+	case errors.Is(err, transport.ErrTimeout), errors.Is(err, context.DeadlineExceeded):
+		return errCodeTimeout
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return errCodeTimeout
+	case errors.Is(err, transport.ErrDNS):
+		return errCodeDNS
+	case errors.Is(err, transport.ErrProxy):
+		return errCodeProxy
+	case errors.Is(err, transport.ErrTLS):
+		return errCodeTLS
+	case errors.Is(err, transport.ErrProtocol), errors.Is(err, transport.ErrALPNMismatch):
+		return errCodeProtocol
+	case errors.Is(err, transport.ErrConnection):
+		return errCodeConnection
+	case errors.Is(err, transport.ErrClosed), errors.Is(err, session.ErrSessionClosed):
+		return errCodeClosed
+	case errors.Is(err, transport.ErrResponse):
+		return errCodeResponse
+	case errors.Is(err, transport.ErrRequest):
+		return errCodeRequest
+	default:
+		return errCodeUnknown
+	}
+}
+
+// errorCodeName returns the symbolic name of an error code
+func errorCodeName(code int) string {
+	if name, ok := errCodeNames[code]; ok {
+		return name
+	}
+	return errCodeNames[errCodeUnknown]
+}
+
+// setLastError records err as the calling thread's last error.
+// handle is the session/stream/upload handle the call operated on (0 if none).
+// Must only be called synchronously from an exported function - goroutines
+// run on arbitrary threads.
+func setLastError(handle C.int64_t, err error) {
+	if err == nil {
+		return
+	}
+	C.set_last_error(C.int(errorCode(err)), handle, C.CString(err.Error()))
+}
+
+// lastErrorMatches reports whether the thread's last error belongs to handle.
+// Handle 0 on either side matches anything.
+func lastErrorMatches(handle C.int64_t) bool {
+	recorded := C.get_last_error_handle()
+	return handle == 0 || recorded == 0 || recorded == handle
+}
+
+// LastError is the JSON form returned by httpcloak_last_error
+type LastError struct {
+	Code    int    `json:"code"`
+	Name    string `json:"name"`
+	Message string `json:"message"`
+	Handle  int64  `json:"handle,omitempty"`
+}
+
+// httpcloak_last_error returns the most recent error on the calling thread as
+// JSON ({"code", "name", "message", "handle"}), or NULL if there is none or it
+// belongs to a different handle. Like errno it is only meaningful right after
+// a call reported failure; successful calls do not reset it.
+// Free the result with httpcloak_free_string.
+//
+//export httpcloak_last_error
+func httpcloak_last_error(handle C.int64_t) *C.char {
+	code := int(C.get_last_error_code())
+	if code == errCodeNone || !lastErrorMatches(handle) {
+		return nil
+	}
+	data, _ := json.Marshal(LastError{
+		Code:    code,
+		Name:    errorCodeName(code),
+		Message: C.GoString(C.get_last_error_message()),
+		Handle:  int64(C.get_last_error_handle()),
+	})
+	return C.CString(string(data))
+}
+
+// httpcloak_last_error_code returns the code of the most recent error on the
+// calling thread (0 if none, or if it belongs to a different handle).
+//
+//export httpcloak_last_error_code
+func httpcloak_last_error_code(handle C.int64_t) C.int {
+	if !lastErrorMatches(handle) {
+		return errCodeNone
+	}
+	return C.get_last_error_code()
+}
+
+// httpcloak_clear_error resets the calling thread's last error.
+//
+//export httpcloak_clear_error
+func httpcloak_clear_error() {
+	C.set_last_error(errCodeNone, 0, nil)
+}
@@ -18,9 +18,7 @@ typedef struct {
 import "C"
 import (
 	"context"
-	"crypto/x509"
 	"io"
-	"runtime"
 	"sync"
 	"time"
 	"unsafe"
@@ -28,29 +26,11 @@ import (
 	"github.com/sardanioss/httpcloak"
 )
 
-// init runs automatically when the shared library is loaded.
-// Pre-loads x509 system roots to avoid ~20ms delay on first request.
-func init() {
-	// Force the httpcloak package init to run by creating a dummy session config
-	// This ensures x509 roots are loaded before any user request
-	_ = &httpcloak.Request{}
-
-	// Also explicitly load roots here in case httpcloak's init changes
-	_, _ = x509.SystemCertPool()
-}
-
 //export httpcloak_init
 func httpcloak_init() {
-	// Force Go runtime initialization and warm up the scheduler
-	runtime.GC()
-
-	// Pre-load system root CA certificates (normally lazy-loaded on first TLS connection)
-	// This takes ~40ms on first call, so we do it at init time
-	_, _ = x509.SystemCertPool()
-
-	// Warm up crypto/tls internals by triggering lazy init
-	_ = make([]byte, 4096)
-	runtime.GC()
+	// Root CAs are loaded when the library is; this does the rest of a first
+	// request's one-time work (see httpcloak.Preload)
+	httpcloak.Preload()
 }
 
 //export httpcloak_warmup
@@ -122,6 +102,7 @@ func httpcloak_get_fast_timed(handle C.int64_t, url *C.char, urlLen C.int, timin
 
 	session := getSession(handle)
 	if session == nil {
+		setLastError(handle, ErrInvalidSession)
 		return -1
 	}
 
@@ -146,6 +127,7 @@ func httpcloak_get_fast_timed(handle C.int64_t, url *C.char, urlLen C.int, timin
 	t4 := time.Now()
 
 	if err != nil {
+		setLastError(handle, err)
 		return -1
 	}
 
@@ -227,6 +209,7 @@ func httpcloak_get_fast_finish(resp *httpcloak.Response, bodyBytes []byte) C.int
 func httpcloak_get_fast(handle C.int64_t, url *C.char, urlLen C.int) C.int64_t {
 	session := getSession(handle)
 	if session == nil {
+		setLastError(handle, ErrInvalidSession)
 		return -1
 	}
 
@@ -243,6 +226,7 @@ func httpcloak_get_fast(handle C.int64_t, url *C.char, urlLen C.int) C.int64_t {
 
 	resp, err := session.Do(ctx, req)
 	if err != nil {
+		setLastError(handle, err)
 		return -1
 	}
 
@@ -0,0 +1,170 @@
+package main
+
+/*
+#include <stdint.h>
+*/
+import "C"
+import (
+	"encoding/json"
+	"runtime"
+	"runtime/debug"
+	"sync"
+)
+
+// LibInitOptions configures the Go runtime hosting the library.
+// Zero values leave the corresponding Go default untouched.
+type LibInitOptions struct {
+	MaxProcs    int   `json:"max_procs,omitempty"`    // GOMAXPROCS
+	MemoryLimit int64 `json:"memory_limit,omitempty"` // Soft memory limit in bytes (debug.SetMemoryLimit)
+	GCPercent   int   `json:"gc_percent,omitempty"`   // GOGC; -1 disables GC until MemoryLimit is reached
+}
+
+// Runtime settings in effect before httpcloak_lib_init, restored on shutdown
+var (
+	libMu             sync.Mutex
+	libInitialized    bool
+	savedMaxProcs     int
+	savedMemoryLimit  int64
+	savedGCPercent    int
+	savedGCPercentSet bool
+)
+
+// httpcloak_lib_init applies runtime limits for embedders that need to bound
+// the Go runtime sharing their process. Calling it is optional - without it
+// the library runs with Go's defaults.
+// Returns 0 on success, -1 if the options JSON is invalid.
+//
+//export httpcloak_lib_init
+func httpcloak_lib_init(optionsJSON *C.char) C.int {
+	var opts LibInitOptions
+	if optionsJSON != nil {
+		if s := C.GoString(optionsJSON); s != "" {
+			if err := json.Unmarshal([]byte(s), &opts); err != nil {
+				return -1
+			}
+		}
+	}
+
+	libMu.Lock()
+	defer libMu.Unlock()
+
+	if !libInitialized {
+		savedMaxProcs = runtime.GOMAXPROCS(0)
+		savedMemoryLimit = debug.SetMemoryLimit(-1) // -1 only queries
+		savedGCPercentSet = false
+	}
+
+	if opts.MaxProcs > 0 {
+		runtime.GOMAXPROCS(opts.MaxProcs)
+	}
+	if opts.MemoryLimit > 0 {
+		debug.SetMemoryLimit(opts.MemoryLimit)
+	}
+	if opts.GCPercent != 0 {
+		prev := debug.SetGCPercent(opts.GCPercent)
+		if !savedGCPercentSet {
+			savedGCPercent = prev
+			savedGCPercentSet = true
+		}
+	}
+
+	libInitialized = true
+	return 0
+}
+
+// httpcloak_lib_shutdown releases everything the library holds: cancels
+// in-flight async requests, aborts uploads, closes streams and sessions, stops
+// local proxies, frees unclaimed responses and drops cache callbacks. Runtime
+// settings changed by httpcloak_lib_init are restored.
+//
+// Afterwards no library goroutine is doing work and no connection is open, so
+// the host can stop calling into the library safely. The Go runtime itself
+// cannot be unloaded from a process; the library stays usable and can be
+// initialized again.
+//
+//export httpcloak_lib_shutdown
+func httpcloak_lib_shutdown() {
+	// Async requests first - their callbacks must not fire into a host that
+	// is tearing down
+	callbackMu.Lock()
+	for id, cancel := range cancelFuncs {
+		cancel()
+		delete(cancelFuncs, id)
+	}
+	for id := range asyncCallbacks {
+		delete(asyncCallbacks, id)
+	}
+	callbackMu.Unlock()
+
+	uploadMu.RLock()
+	uploadHandles := make([]int64, 0, len(uploads))
+	for h := range uploads {
+		uploadHandles = append(uploadHandles, h)
+	}
+	uploadMu.RUnlock()
+	for _, h := range uploadHandles {
+		httpcloak_upload_cancel(C.int64_t(h))
+	}
+
+	streamMu.RLock()
+	streamHandles := make([]int64, 0, len(streams))
+	for h := range streams {
+		streamHandles = append(streamHandles, h)
+	}
+	streamMu.RUnlock()
+	for _, h := range streamHandles {
+		httpcloak_stream_close(C.int64_t(h))
+	}
+
+	sessionMu.RLock()
+	sessionHandles := make([]int64, 0, len(sessions))
+	for h := range sessions {
+		sessionHandles = append(sessionHandles, h)
+	}
+	sessionMu.RUnlock()
+	for _, h := range sessionHandles {
+		httpcloak_session_free(C.int64_t(h))
+	}
+
+	localProxyMu.RLock()
+	proxyHandles := make([]int64, 0, len(localProxies))
+	for h := range localProxies {
+		proxyHandles = append(proxyHandles, h)
+	}
+	localProxyMu.RUnlock()
+	for _, h := range proxyHandles {
+		httpcloak_local_proxy_stop(C.int64_t(h))
+	}
+
+	fastResponsesMu.RLock()
+	fastHandles := make([]int64, 0, len(fastResponses))
+	for h := range fastResponses {
+		fastHandles = append(fastHandles, h)
+	}
+	fastResponsesMu.RUnlock()
+	for _, h := range fastHandles {
+		httpcloak_fast_free(C.int64_t(h))
+	}
+
+	rawResponsesMu.Lock()
+	for id := range rawResponses {
+		delete(rawResponses, id)
+	}
+	rawResponsesMu.Unlock()
+
+	httpcloak_clear_session_cache_callbacks()
+
+	libMu.Lock()
+	if libInitialized {
+		runtime.GOMAXPROCS(savedMaxProcs)
+		debug.SetMemoryLimit(savedMemoryLimit)
+		if savedGCPercentSet {
+			debug.SetGCPercent(savedGCPercent)
+		}
+		libInitialized = false
+	}
+	libMu.Unlock()
+
+	// Return freed memory to the OS now rather than at the next GC cycle
+	debug.FreeOSMemory()
+}
@@ -0,0 +1,180 @@
+package client
+
+import (
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/sardanioss/httpcloak/fingerprint"
+)
+
+// WeightedPreset is a preset and its share of a PresetPolicy
+type WeightedPreset struct {
+	Preset string
+	Weight float64
+}
+
+// WeightedCountry is a locale, by ISO 3166-1 country code, and its share
+// of a PresetPolicy
+type WeightedCountry struct {
+	Country string
+	Weight  float64
+}
+
+// Stickiness controls how often a PresetPolicy samples
+type Stickiness int
+
+const (
+	// StickyNone samples for every client
+	StickyNone Stickiness = iota
+
+	// StickyProcess samples once per process: every client built from the
+	// same policy gets the same preset and locale
+	StickyProcess
+
+	// StickyKey derives the sample from PresetPolicy.Key, so the same key
+	// (a worker or account name) always gets the same preset and locale
+	StickyKey
+)
+
+// DefaultPresetWeights approximates browser and device market share. The
+// OS-specific presets keep User-Agent, client hints and TLS consistent with
+// one device.
+var DefaultPresetWeights = []WeightedPreset{
+	{"chrome-latest-windows", 30},
+	{"android-chrome-latest", 25},
+	{"ios-safari-latest", 15},
+	{"chrome-latest-macos", 8},
+	{"safari-latest", 5},
+	{"firefox-latest-windows", 4},
+	{"ios-chrome-latest", 3},
+	{"chrome-latest-linux", 2},
+	{"firefox-latest-macos", 1},
+	{"firefox-latest-linux", 1},
+}
+
+// PresetPolicy is a distribution of presets and locales for NewClientAuto
+type PresetPolicy struct {
+	// Presets to sample from. Default: DefaultPresetWeights. Unknown names
+	// and non-positive weights are skipped.
+	Presets []WeightedPreset
+
+	// Countries whose main locale sets Accept-Language (see
+	// fingerprint.AcceptLanguageFor). Default: none, keeping the preset's.
+	Countries []WeightedCountry
+
+	// Sticky controls how often the policy samples (default StickyNone)
+	Sticky Stickiness
+
+	// Key seeds the sample with StickyKey
+	Key string
+}
+
+// PresetChoice is a sample of a PresetPolicy
+type PresetChoice struct {
+	Preset         string
+	Country        string // "" if the policy has no Countries
+	AcceptLanguage string // "" to keep the preset's
+}
+
+// processChoices holds StickyProcess samples by policy
+var processChoices sync.Map // string -> PresetChoice
+
+// Choose samples a preset and locale from the policy
+func (p PresetPolicy) Choose() PresetChoice {
+	switch p.Sticky {
+	case StickyProcess:
+		key := p.distributionKey()
+		if choice, ok := processChoices.Load(key); ok {
+			return choice.(PresetChoice)
+		}
+		choice, _ := processChoices.LoadOrStore(key, p.sample(nil))
+		return choice.(PresetChoice)
+	case StickyKey:
+		return p.sample(fingerprint.IdentityRand(p.Key, "preset-policy"))
+	}
+	return p.sample(nil)
+}
+
+// sample draws from the policy with r, or the global source if r is nil
+func (p PresetPolicy) sample(r *rand.Rand) PresetChoice {
+	float := rand.Float64
+	if r != nil {
+		float = r.Float64
+	}
+
+	presets := p.Presets
+	if len(presets) == 0 {
+		presets = DefaultPresetWeights
+	}
+	available := fingerprint.Available()
+	var options []WeightedPreset
+	for _, wp := range presets {
+		if wp.Weight > 0 && slices.Contains(available, wp.Preset) {
+			options = append(options, wp)
+		}
+	}
+	choice := PresetChoice{Preset: "chrome-latest"}
+	if i := pickWeighted(len(options), func(i int) float64 { return options[i].Weight }, float()); i >= 0 {
+		choice.Preset = options[i].Preset
+	}
+
+	var countries []WeightedCountry
+	for _, wc := range p.Countries {
+		if wc.Weight > 0 && fingerprint.AcceptLanguageFor(wc.Country, false) != "" {
+			countries = append(countries, wc)
+		}
+	}
+	if i := pickWeighted(len(countries), func(i int) float64 { return countries[i].Weight }, float()); i >= 0 {
+		choice.Country = strings.ToUpper(countries[i].Country)
+		choice.AcceptLanguage = fingerprint.AcceptLanguageFor(choice.Country, strings.Contains(choice.Preset, "firefox"))
+	}
+	return choice
+}
+
+// pickWeighted returns the index u (in [0, 1)) falls on when n weights are
+// laid end to end, or -1 if n is 0
+func pickWeighted(n int, weight func(int) float64, u float64) int {
+	if n == 0 {
+		return -1
+	}
+	var total float64
+	for i := 0; i < n; i++ {
+		total += weight(i)
+	}
+	target := u * total
+	for i := 0; i < n; i++ {
+		if target -= weight(i); target < 0 {
+			return i
+		}
+	}
+	return n - 1
+}
+
+// distributionKey identifies the policy's distribution for StickyProcess
+func (p PresetPolicy) distributionKey() string {
+	var b strings.Builder
+	for _, wp := range p.Presets {
+		b.WriteString(wp.Preset + "=" + strconv.FormatFloat(wp.Weight, 'g', -1, 64) + ";")
+	}
+	b.WriteByte('|')
+	for _, wc := range p.Countries {
+		b.WriteString(wc.Country + "=" + strconv.FormatFloat(wc.Weight, 'g', -1, 64) + ";")
+	}
+	return b.String()
+}
+
+// NewClientAuto creates a client with a preset, and optionally a locale,
+// sampled from policy, so a fleet doesn't present a single browser. opts
+// apply on top; a WithPreset or WithAcceptLanguage among them wins. The
+// choice is available from Client.Preset.
+func NewClientAuto(policy PresetPolicy, opts ...Option) *Client {
+	choice := policy.Choose()
+	all := make([]Option, 0, len(opts)+1)
+	if choice.AcceptLanguage != "" {
+		all = append(all, WithAcceptLanguage(choice.AcceptLanguage))
+	}
+	return NewClient(choice.Preset, append(all, opts...)...)
+}
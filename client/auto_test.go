@@ -0,0 +1,38 @@
+package client
+
+import "testing"
+
+func TestPresetPolicy(t *testing.T) {
+	if i := pickWeighted(3, func(i int) float64 { return []float64{1, 2, 1}[i] }, 0.5); i != 1 {
+		t.Errorf("pickWeighted(0.5) = %d, want 1", i)
+	}
+	if i := pickWeighted(0, nil, 0.5); i != -1 {
+		t.Errorf("pickWeighted with no options = %d", i)
+	}
+
+	policy := PresetPolicy{
+		Presets:   []WeightedPreset{{"firefox-latest-linux", 1}, {"no-such-preset", 100}, {"safari-latest", 0}},
+		Countries: []WeightedCountry{{"de", 1}},
+	}
+	choice := policy.Choose()
+	if choice.Preset != "firefox-latest-linux" || choice.Country != "DE" || choice.AcceptLanguage != "de,en-US;q=0.7,en;q=0.3" {
+		t.Errorf("Choose = %+v", choice)
+	}
+
+	// The same key always gets the same sample
+	keyed := PresetPolicy{Sticky: StickyKey, Key: "worker-7"}
+	first := keyed.Choose()
+	for i := 0; i < 10; i++ {
+		if got := keyed.Choose(); got != first {
+			t.Fatalf("StickyKey sample changed: %+v then %+v", first, got)
+		}
+	}
+
+	sticky := PresetPolicy{Sticky: StickyProcess, Presets: []WeightedPreset{{"chrome-latest-windows", 1}, {"ios-safari-latest", 1}}}
+	first = sticky.Choose()
+	for i := 0; i < 10; i++ {
+		if got := sticky.Choose(); got != first {
+			t.Fatalf("StickyProcess sample changed: %+v then %+v", first, got)
+		}
+	}
+}
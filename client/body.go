@@ -0,0 +1,125 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+)
+
+// BodyTooLargeError is returned when a response body exceeds MaxBodySize,
+// by Do for a buffered body and by reads of a streamed one
+type BodyTooLargeError struct {
+	Limit int64
+}
+
+func (e *BodyTooLargeError) Error() string {
+	return fmt.Sprintf("response body exceeds %d bytes", e.Limit)
+}
+
+// maxBodySize returns the body limit for req, 0 for none
+func (c *Client) maxBodySize(req *Request) int64 {
+	limit := c.config.MaxBodySize
+	if req.MaxBodySize != 0 {
+		limit = req.MaxBodySize
+	}
+	if limit < 0 {
+		return 0
+	}
+	return limit
+}
+
+// readBody reads r to EOF, failing once more than limit bytes arrive
+// (limit 0 for none)
+func readBody(r io.Reader, limit int64) ([]byte, error) {
+	if limit <= 0 {
+		return io.ReadAll(r)
+	}
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, &BodyTooLargeError{Limit: limit}
+	}
+	return data, nil
+}
+
+// streamBody is the Body of a streamed response. Reads fail with
+// BodyTooLargeError past the limit; Close releases the connection and the
+// request's context.
+type streamBody struct {
+	reader       io.Reader
+	decompressor io.Closer
+	raw          io.ReadCloser
+	cancel       context.CancelFunc
+	limit        int64 // 0 for none
+	read         int64
+}
+
+func (b *streamBody) Read(p []byte) (int, error) {
+	if b.limit > 0 && b.read >= b.limit {
+		// Probe for one more byte: a body of exactly limit bytes is fine
+		var one [1]byte
+		n, err := b.reader.Read(one[:])
+		if n > 0 {
+			return 0, &BodyTooLargeError{Limit: b.limit}
+		}
+		return 0, err
+	}
+	if b.limit > 0 && int64(len(p)) > b.limit-b.read {
+		p = p[:b.limit-b.read]
+	}
+	n, err := b.reader.Read(p)
+	b.read += int64(n)
+	return n, err
+}
+
+func (b *streamBody) Close() error {
+	if b.decompressor != nil {
+		b.decompressor.Close()
+	}
+	err := b.raw.Close()
+	if b.cancel != nil {
+		b.cancel()
+	}
+	return err
+}
+
+// BodyReader returns the body as a reader: the connection itself for a
+// streamed response (see Request.Stream), the buffered copy otherwise.
+// Close the response when done.
+func (r *Response) BodyReader() io.ReadCloser {
+	if r.bodyRead || r.Body == nil {
+		return io.NopCloser(bytes.NewReader(r.bodyBytes))
+	}
+	return r.Body
+}
+
+// SaveTo copies the body to w and closes it, returning the bytes written.
+// A streamed body goes straight from the connection to w, so downloads of
+// any size use a fixed amount of memory.
+func (r *Response) SaveTo(w io.Writer) (int64, error) {
+	if r.bodyRead {
+		n, err := w.Write(r.bodyBytes)
+		return int64(n), err
+	}
+	if r.bodyConsumed {
+		return 0, ErrBodyConsumed
+	}
+	if r.Body == nil {
+		return 0, nil
+	}
+	defer r.Body.Close()
+	r.bodyConsumed = true
+	return io.Copy(w, r.Body)
+}
+
+// stream returns the body of a streamed response
+func (r *Response) stream() (*streamBody, bool) {
+	if r == nil {
+		return nil, false
+	}
+	body, ok := r.Body.(*streamBody)
+	return body, ok
+}
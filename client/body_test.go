@@ -0,0 +1,36 @@
+package client
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestBodyLimit(t *testing.T) {
+	var tooLarge *BodyTooLargeError
+
+	if data, err := readBody(strings.NewReader("12345"), 5); err != nil || string(data) != "12345" {
+		t.Errorf("readBody at limit: %q, %v", data, err)
+	}
+	if _, err := readBody(strings.NewReader("123456"), 5); !errors.As(err, &tooLarge) {
+		t.Errorf("readBody over limit: %v", err)
+	}
+
+	for body, wantErr := range map[string]bool{"12345": false, "123456": true} {
+		stream := &streamBody{reader: strings.NewReader(body), raw: io.NopCloser(nil), limit: 5}
+		resp := &Response{Body: stream}
+		var buf bytes.Buffer
+		n, err := resp.SaveTo(&buf)
+		if wantErr {
+			if !errors.As(err, &tooLarge) || n != 5 {
+				t.Errorf("SaveTo(%q): %d, %v, want BodyTooLargeError after 5 bytes", body, n, err)
+			}
+			continue
+		}
+		if err != nil || buf.String() != body {
+			t.Errorf("SaveTo(%q): %q, %v", body, buf.String(), err)
+		}
+	}
+}
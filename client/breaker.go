@@ -0,0 +1,288 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without sending anything when the circuit
+// breaker for the request's origin and proxy is open
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// CircuitState is the state of one origin+proxy circuit
+type CircuitState int
+
+const (
+	// CircuitClosed passes requests and counts consecutive failures
+	CircuitClosed CircuitState = iota
+	// CircuitOpen fails requests immediately until the cool-down ends
+	CircuitOpen
+	// CircuitHalfOpen lets a limited number of probe requests through; one
+	// success closes the circuit, one failure opens it again
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return "closed"
+}
+
+// CircuitBreakerConfig configures the per-origin circuit breaker
+type CircuitBreakerConfig struct {
+	// FailureThreshold consecutive failures open a circuit. Default: 5.
+	FailureThreshold int
+
+	// OpenFor is how long an open circuit fails fast before probing.
+	// Default: 30s.
+	OpenFor time.Duration
+
+	// HalfOpenProbes is how many requests may probe a half-open circuit at
+	// once. Default: 1.
+	HalfOpenProbes int
+
+	// FailureStatuses are response codes counted as failures, e.g. 403 and
+	// 429 for a target that blocks. Transport errors (connect, TLS, reset,
+	// timeout) always count. Default: none.
+	FailureStatuses []int
+
+	// OnEvent is called on every state change, outside the breaker's lock
+	OnEvent func(CircuitEvent)
+}
+
+// CircuitEvent reports a circuit changing state
+type CircuitEvent struct {
+	Origin string // scheme://host:port
+	Proxy  string // Proxy URL with the password redacted, "" for direct
+	From   CircuitState
+	To     CircuitState
+	Err    error // Failure that opened the circuit, if any
+	At     time.Time
+}
+
+// CircuitStatus is a snapshot of one circuit
+type CircuitStatus struct {
+	Origin              string
+	Proxy               string
+	State               CircuitState
+	ConsecutiveFailures int
+	OpenUntil           time.Time // When an open circuit starts probing
+}
+
+type circuitKey struct {
+	origin string
+	proxy  string
+}
+
+type circuit struct {
+	state     CircuitState
+	failures  int
+	openUntil time.Time
+	probes    int // In-flight half-open probes
+}
+
+// circuitBreaker tracks one circuit per origin+proxy
+type circuitBreaker struct {
+	config   CircuitBreakerConfig
+	mu       sync.Mutex
+	circuits map[circuitKey]*circuit
+}
+
+func newCircuitBreaker(config CircuitBreakerConfig) *circuitBreaker {
+	if config.FailureThreshold <= 0 {
+		config.FailureThreshold = 5
+	}
+	if config.OpenFor <= 0 {
+		config.OpenFor = 30 * time.Second
+	}
+	if config.HalfOpenProbes <= 0 {
+		config.HalfOpenProbes = 1
+	}
+	return &circuitBreaker{config: config, circuits: make(map[circuitKey]*circuit)}
+}
+
+// circuitCall is one request admitted by the breaker. done records its
+// outcome; only the first call counts.
+type circuitCall struct {
+	b     *circuitBreaker
+	key   circuitKey
+	probe bool
+	once  sync.Once
+}
+
+// allow admits a request to origin through proxy, or returns an error
+// wrapping ErrCircuitOpen. A nil breaker admits everything.
+func (b *circuitBreaker) allow(origin, proxy string) (*circuitCall, error) {
+	if b == nil {
+		return nil, nil
+	}
+	key := circuitKey{origin, proxy}
+	now := time.Now()
+
+	b.mu.Lock()
+	c := b.circuits[key]
+	if c == nil {
+		c = &circuit{}
+		b.circuits[key] = c
+	}
+	var event *CircuitEvent
+	if c.state == CircuitOpen && !now.Before(c.openUntil) {
+		c.state = CircuitHalfOpen
+		c.probes = 0
+		event = &CircuitEvent{Origin: origin, Proxy: proxy, From: CircuitOpen, To: CircuitHalfOpen, At: now}
+	}
+	var err error
+	probe := false
+	switch c.state {
+	case CircuitOpen:
+		err = fmt.Errorf("%w for %s (retry after %s)", ErrCircuitOpen, origin, c.openUntil.Format(time.RFC3339))
+	case CircuitHalfOpen:
+		if c.probes >= b.config.HalfOpenProbes {
+			err = fmt.Errorf("%w for %s (probe in flight)", ErrCircuitOpen, origin)
+		} else {
+			c.probes++
+			probe = true
+		}
+	}
+	b.mu.Unlock()
+
+	b.emit(event)
+	if err != nil {
+		return nil, err
+	}
+	return &circuitCall{b: b, key: key, probe: probe}, nil
+}
+
+// done records the outcome of the call: err is a transport-level error and
+// statusCode the response status if there was one
+func (call *circuitCall) done(statusCode int, err error) {
+	if call == nil {
+		return
+	}
+	call.once.Do(func() {
+		// The caller gave up; that says nothing about the origin
+		if errors.Is(err, context.Canceled) {
+			call.b.release(call)
+			return
+		}
+		failed := err != nil
+		if !failed {
+			for _, code := range call.b.config.FailureStatuses {
+				if statusCode == code {
+					failed = true
+					err = fmt.Errorf("status %d", statusCode)
+					break
+				}
+			}
+		}
+		call.b.record(call, failed, err)
+	})
+}
+
+// release returns a probe slot without recording an outcome
+func (b *circuitBreaker) release(call *circuitCall) {
+	if !call.probe {
+		return
+	}
+	b.mu.Lock()
+	if c := b.circuits[call.key]; c != nil && c.probes > 0 {
+		c.probes--
+	}
+	b.mu.Unlock()
+}
+
+func (b *circuitBreaker) record(call *circuitCall, failed bool, err error) {
+	now := time.Now()
+	b.mu.Lock()
+	c := b.circuits[call.key]
+	if c == nil { // Reset while the call was in flight
+		b.mu.Unlock()
+		return
+	}
+	if call.probe && c.probes > 0 {
+		c.probes--
+	}
+	from := c.state
+	if failed {
+		c.failures++
+		if c.state == CircuitHalfOpen || (c.state == CircuitClosed && c.failures >= b.config.FailureThreshold) {
+			c.state = CircuitOpen
+			c.openUntil = now.Add(b.config.OpenFor)
+		}
+	} else {
+		c.failures = 0
+		if c.state == CircuitHalfOpen {
+			c.state = CircuitClosed
+		}
+	}
+	to := c.state
+	b.mu.Unlock()
+
+	if from != to {
+		event := &CircuitEvent{Origin: call.key.origin, Proxy: call.key.proxy, From: from, To: to, At: now}
+		if to == CircuitOpen {
+			event.Err = err
+		}
+		b.emit(event)
+	}
+}
+
+func (b *circuitBreaker) emit(event *CircuitEvent) {
+	if event != nil && b.config.OnEvent != nil {
+		b.config.OnEvent(*event)
+	}
+}
+
+func (b *circuitBreaker) status() []CircuitStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	out := make([]CircuitStatus, 0, len(b.circuits))
+	for key, c := range b.circuits {
+		out = append(out, CircuitStatus{
+			Origin:              key.origin,
+			Proxy:               key.proxy,
+			State:               c.state,
+			ConsecutiveFailures: c.failures,
+			OpenUntil:           c.openUntil,
+		})
+	}
+	return out
+}
+
+// circuitProxy returns the proxy a request in ctx goes through, for keying
+// circuits: the proxy picked from the pool, or the client's TCP proxy
+func (c *Client) circuitProxy(ctx context.Context) string {
+	if _, _, route := c.tcpRoute(ctx); route != nil {
+		return redactProxyURL(route.url)
+	}
+	if proxy := c.GetTCPProxy(); proxy != "" {
+		return redactProxyURL(proxy)
+	}
+	return ""
+}
+
+// Circuits returns a snapshot of every circuit seen so far, or nil
+// without WithCircuitBreaker
+func (c *Client) Circuits() []CircuitStatus {
+	if c.breaker == nil {
+		return nil
+	}
+	return c.breaker.status()
+}
+
+// ResetCircuits closes all circuits and clears their failure counts
+func (c *Client) ResetCircuits() {
+	if c.breaker == nil {
+		return
+	}
+	c.breaker.mu.Lock()
+	c.breaker.circuits = make(map[circuitKey]*circuit)
+	c.breaker.mu.Unlock()
+}
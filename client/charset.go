@@ -0,0 +1,84 @@
+package client
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+
+	"golang.org/x/net/html/charset"
+)
+
+// Byte order marks, stripped before transcoding
+var boms = [][]byte{
+	{0xef, 0xbb, 0xbf}, // UTF-8
+	{0xfe, 0xff},       // UTF-16BE
+	{0xff, 0xfe},       // UTF-16LE
+}
+
+func trimBOM(body []byte) []byte {
+	for _, bom := range boms {
+		if bytes.HasPrefix(body, bom) {
+			return body[len(bom):]
+		}
+	}
+	return body
+}
+
+// DecodeCharset converts a response body to UTF-8. The encoding is taken from
+// a byte order mark, then the charset parameter of contentType, then an HTML
+// <meta> charset in the first 1024 bytes. Bodies with none of these are kept
+// as-is if they are valid UTF-8 and read as windows-1252 otherwise, the same
+// fallback browsers use.
+func DecodeCharset(body []byte, contentType string) ([]byte, error) {
+	enc, name, _ := charset.DetermineEncoding(body, contentType)
+	body = trimBOM(body)
+	if name == "utf-8" {
+		return body, nil
+	}
+	return enc.NewDecoder().Bytes(body)
+}
+
+// DecodeXML decodes an XML document into v, converting it to UTF-8 first.
+// Following RFC 7303, a byte order mark or a Content-Type charset overrides
+// the encoding in the XML declaration; otherwise the declaration is used.
+func DecodeXML(body []byte, contentType string, v interface{}) error {
+	if _, _, certain := charset.DetermineEncoding(body, contentType); certain {
+		utf8Body, err := DecodeCharset(body, contentType)
+		if err != nil {
+			return err
+		}
+		dec := xml.NewDecoder(bytes.NewReader(utf8Body))
+		// Already UTF-8 - ignore whatever the declaration claims
+		dec.CharsetReader = func(_ string, in io.Reader) (io.Reader, error) { return in, nil }
+		return dec.Decode(v)
+	}
+
+	dec := xml.NewDecoder(bytes.NewReader(body))
+	dec.CharsetReader = charset.NewReaderLabel
+	return dec.Decode(v)
+}
+
+// XML decodes the response body as XML into v, honouring the document's
+// character encoding (BOM, Content-Type charset or XML declaration).
+func (r *Response) XML(v interface{}) error {
+	data, err := r.Bytes()
+	if err != nil {
+		return err
+	}
+	return DecodeXML(data, r.GetHeader("Content-Type"), v)
+}
+
+// DecodedText returns the response body converted to UTF-8 (see
+// DecodeCharset). Use it for HTML or text served in legacy encodings;
+// Text returns the raw bytes.
+func (r *Response) DecodedText() (string, error) {
+	data, err := r.Bytes()
+	if err != nil {
+		return "", err
+	}
+	utf8Body, err := DecodeCharset(data, r.GetHeader("Content-Type"))
+	if err != nil {
+		return "", err
+	}
+	return string(utf8Body), nil
+}
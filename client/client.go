@@ -41,10 +41,8 @@ package client
 
 import (
 	"bytes"
-	"compress/flate"
-	"compress/gzip"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"math"
@@ -52,12 +50,11 @@ import (
 	"net"
 	http "github.com/sardanioss/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
-	"github.com/andybalholm/brotli"
-	"github.com/klauspost/compress/zstd"
 	"github.com/sardanioss/httpcloak/fingerprint"
 	"github.com/sardanioss/httpcloak/pool"
 	"github.com/sardanioss/httpcloak/protocol"
@@ -98,9 +95,27 @@ type Client struct {
 	h2Failures   map[string]time.Time
 	h2FailuresMu sync.RWMutex
 
+	// Protocol that won each origin's connection race (RaceH3)
+	raceWinners raceWinners
+
 	// Store H3 initialization error for better error messages
 	h3InitError error
 
+	// Validators for conditional requests (Request.Conditional)
+	validators validatorStore
+
+	// Clock and per-origin skew for server-checked timestamps (Client.Now)
+	clock clockTracker
+
+	// Rotating proxies for HTTP/1.1 and HTTP/2 (nil = single proxy or direct)
+	proxyPool *proxyPool
+
+	// Per-origin circuit breaker (nil = disabled)
+	breaker *circuitBreaker
+
+	// Slow request log (nil = disabled)
+	slowLog *slowRequestLog
+
 	// Custom header order (nil = use preset's order)
 	customHeaderOrder   []string
 	customHeaderOrderMu sync.RWMutex
@@ -115,7 +130,7 @@ func NewClient(presetName string, opts ...Option) *Client {
 		opt(config)
 	}
 
-	preset := fingerprint.Get(config.Preset)
+	preset := config.resolvePreset(config.Preset)
 
 	// Determine effective proxy URLs for TCP and UDP transports
 	// TCPProxy/UDPProxy take precedence over Proxy for split proxy configuration
@@ -139,6 +154,9 @@ func NewClient(presetName string, opts ...Option) *Client {
 	if config.PreferIPv4 {
 		h2Manager.GetDNSCache().SetPreferIPv4(true)
 	}
+	if config.CustomTLSSpec != nil {
+		h2Manager.SetCustomTLSSpec(config.CustomTLSSpec)
+	}
 
 	// Create transport config for TLSOnly and other settings (used by all transports)
 	var transportConfig *transport.TransportConfig
@@ -157,7 +175,8 @@ func NewClient(presetName string, opts ...Option) *Client {
 	var masqueTransport *transport.HTTP3Transport
 	var socks5H3Transport *transport.HTTP3Transport
 	var h3InitError error
-	if !config.DisableH3 {
+	// A proxy pool only routes TCP; direct QUIC would bypass it
+	if !config.DisableH3 && len(config.ProxyPool) == 0 {
 		if udpProxyURL != "" && transport.IsMASQUEProxy(udpProxyURL) {
 			// Use dedicated MASQUE transport for MASQUE proxies
 			proxyConfig := &transport.ProxyConfig{URL: udpProxyURL}
@@ -191,6 +210,7 @@ func NewClient(presetName string, opts ...Option) *Client {
 	}
 	h1Transport := transport.NewHTTP1TransportWithConfig(preset, h2Manager.GetDNSCache(), tcpProxyConfig, transportConfig)
 	h1Transport.SetInsecureSkipVerify(config.InsecureSkipVerify)
+	h1Transport.SetDrainLimit(config.drainLimit())
 
 	// Propagate InsecureSkipVerify to QUIC manager and proxy transports
 	if quicManager != nil {
@@ -231,6 +251,11 @@ func NewClient(presetName string, opts ...Option) *Client {
 		}
 	}
 
+	var proxies *proxyPool
+	if len(config.ProxyPool) > 0 {
+		proxies = newProxyPool(config.ProxyPool, config.ProxyRotation, preset, config, transportConfig)
+	}
+
 	client := &Client{
 		poolManager:       h2Manager,
 		quicManager:       quicManager,
@@ -242,6 +267,14 @@ func NewClient(presetName string, opts ...Option) *Client {
 		h3Failures:        make(map[string]time.Time),
 		h2Failures:        make(map[string]time.Time),
 		h3InitError:       h3InitError,
+		proxyPool:         proxies,
+		clock:             clockTracker{source: config.Clock},
+	}
+	if config.CircuitBreaker != nil {
+		client.breaker = newCircuitBreaker(*config.CircuitBreaker)
+	}
+	if config.SlowRequestThreshold > 0 {
+		client.slowLog = &slowRequestLog{threshold: config.SlowRequestThreshold, fn: config.OnSlowRequest}
 	}
 
 	// Auto-enable cookies when retry is enabled
@@ -269,8 +302,17 @@ func NewSession(presetName string, opts ...Option) *Client {
 
 // SetPreset changes the fingerprint preset
 func (c *Client) SetPreset(presetName string) {
-	c.preset = fingerprint.Get(presetName)
+	c.preset = c.config.resolvePreset(presetName)
 	c.poolManager.SetPreset(c.preset)
+	if c.proxyPool != nil {
+		c.proxyPool.setPreset(c.preset)
+	}
+}
+
+// Preset returns the name of the preset in use, with -latest aliases
+// resolved (e.g. "chrome-144-windows")
+func (c *Client) Preset() string {
+	return c.preset.Name
 }
 
 // SetTimeout sets the request timeout
@@ -399,6 +441,10 @@ type Request struct {
 	URL     string
 	Headers map[string][]string // Multi-value headers (matches http.Header)
 	Body    io.Reader           // Streaming body for uploads
+
+	// GetBody returns a fresh copy of Body for retries. Without it the body
+	// is buffered in memory before the first attempt.
+	GetBody func() (io.ReadCloser, error)
 	Timeout time.Duration
 
 	// Customization options
@@ -417,9 +463,37 @@ type Request struct {
 	// Per-request redirect override (nil = use client config)
 	FollowRedirects *bool
 	MaxRedirects    int
+	RedirectMethods RedirectMethods // 0 = use client config
+	OnRedirect      RedirectFunc    // Runs after the client's OnRedirect
 
 	// Per-request retry override (nil = use client config)
 	DisableRetry bool
+
+	// Conditional sends If-None-Match/If-Modified-Since with the validators
+	// of the last 2xx response for this URL (GET and HEAD only). A 304 reply
+	// sets Response.NotModified.
+	Conditional bool
+
+	// Expect, if set, is checked against the response; see Expect
+	Expect *Expect
+
+	// Stream leaves the body on the connection: Response.Body reads it as
+	// it arrives, decompressed, instead of from a buffered copy. The
+	// timeout still covers reading it. Close the response when done.
+	Stream bool
+
+	// MaxBodySize overrides ClientConfig.MaxBodySize (0 = client config,
+	// -1 = no limit)
+	MaxBodySize int64
+
+	// Meta is caller metadata, never sent on the wire. It reaches redirect
+	// hooks (RedirectHop.Meta) and anything given the request's context
+	// (transport.ContextRequestMeta).
+	Meta map[string]any
+
+	// redirect is the browser state of the redirect chain this request
+	// continues (nil for the first request)
+	redirect *redirectChain
 }
 
 // SetHeader sets a header value, replacing any existing values.
@@ -481,9 +555,18 @@ type Response struct {
 	// Redirect history
 	RedirectHistory []*RedirectInfo
 
+	// NotModified is set when a conditional request got 304 Not Modified:
+	// the resource is unchanged since the validators were recorded
+	NotModified bool
+
+	// Attempts records each try when the request was retried, the last
+	// being this response (nil if it succeeded first time)
+	Attempts []*RetryAttempt
+
 	// bodyBytes caches the body after reading
-	bodyBytes []byte
-	bodyRead  bool
+	bodyBytes    []byte
+	bodyRead     bool
+	bodyConsumed bool // Body was handed to a JSONStream decoder
 }
 
 // Close closes the response body.
@@ -500,6 +583,9 @@ func (r *Response) Bytes() ([]byte, error) {
 	if r.bodyRead {
 		return r.bodyBytes, nil
 	}
+	if r.bodyConsumed {
+		return nil, ErrBodyConsumed
+	}
 	if r.Body == nil {
 		return nil, nil
 	}
@@ -515,20 +601,7 @@ func (r *Response) Bytes() ([]byte, error) {
 }
 
 // RedirectInfo stores information about a redirect
-type RedirectInfo struct {
-	StatusCode int
-	URL        string
-	Headers    map[string][]string // Multi-value headers
-}
-
-// JSON decodes the response body as JSON into the given interface
-func (r *Response) JSON(v interface{}) error {
-	data, err := r.Bytes()
-	if err != nil {
-		return err
-	}
-	return json.Unmarshal(data, v)
-}
+type RedirectInfo = transport.RedirectInfo
 
 // Text returns the response body as a string
 func (r *Response) Text() (string, error) {
@@ -575,24 +648,39 @@ func (r *Response) IsServerError() bool {
 // Do executes an HTTP request
 // Tries HTTP/3 first, falls back to HTTP/2 if HTTP/3 fails
 func (c *Client) Do(ctx context.Context, req *Request) (*Response, error) {
+	ctx = transport.WithRequestMeta(ctx, req.Meta)
+	start := time.Now()
+	var resp *Response
+	var err error
 	// Handle retries
 	if c.config.RetryEnabled && !req.DisableRetry {
-		return c.doWithRetry(ctx, req)
+		resp, err = c.doWithRetry(ctx, req)
+	} else {
+		resp, err = c.doOnce(ctx, req, nil)
+	}
+	if err == nil && req.Expect != nil {
+		err = c.checkExpect(req, resp, start)
 	}
-	return c.doOnce(ctx, req, nil)
+	return resp, err
 }
 
 // doWithRetry executes request with retry logic
 // Handles standard retries and cookie challenge retries (bot protection)
 // For Akamai: First request uses H2 (gets cookies), retry uses H3 (succeeds with cookies)
+// Only transient network errors are retried, and requests that aren't
+// idempotent only when the server says it didn't process them.
 func (c *Client) doWithRetry(ctx context.Context, req *Request) (*Response, error) {
 	var lastErr error
 	var lastResp *Response
 	var cookieChallengeRetried bool
+	var attempts []*RetryAttempt
+	var wait time.Duration
+	retryAny := isIdempotent(req) || c.config.RetryNonIdempotent
 
-	// Cache body before retry loop — io.Reader can only be read once
+	// Cache body before retry loop — io.Reader can only be read once.
+	// GetBody makes the copy unnecessary.
 	var cachedBody []byte
-	if req.Body != nil {
+	if req.Body != nil && req.GetBody == nil {
 		var err error
 		cachedBody, err = io.ReadAll(req.Body)
 		if err != nil {
@@ -602,8 +690,6 @@ func (c *Client) doWithRetry(ctx context.Context, req *Request) (*Response, erro
 
 	for attempt := 0; attempt <= c.config.MaxRetries; attempt++ {
 		if attempt > 0 {
-			// Calculate wait time with exponential backoff and jitter
-			wait := c.calculateRetryWait(attempt)
 			select {
 			case <-ctx.Done():
 				return nil, ctx.Err()
@@ -614,8 +700,15 @@ func (c *Client) doWithRetry(ctx context.Context, req *Request) (*Response, erro
 		// Clone request for this attempt
 		reqCopy := *req
 		// Provide fresh body reader for each attempt
+		var body io.ReadCloser
 		if cachedBody != nil {
 			reqCopy.Body = bytes.NewReader(cachedBody)
+		} else if attempt > 0 && req.GetBody != nil && req.Body != nil {
+			var err error
+			if body, err = req.GetBody(); err != nil {
+				return nil, fmt.Errorf("failed to rewind request body: %w", err)
+			}
+			reqCopy.Body = body
 		}
 
 		// After cookie challenge, switch to H3 for retry (Akamai pattern)
@@ -624,10 +717,22 @@ func (c *Client) doWithRetry(ctx context.Context, req *Request) (*Response, erro
 		}
 
 		resp, err := c.doOnce(ctx, &reqCopy, nil)
+		if body != nil {
+			body.Close()
+		}
+		try := &RetryAttempt{Err: err, Wait: wait}
+		attempts = append(attempts, try)
 		if err != nil {
+			// Retrying an open circuit, a cancelled request or a request
+			// the server may have acted on would only fail again or repeat it
+			if !retryableError(ctx, err) || !retryAny {
+				return nil, err
+			}
 			lastErr = err
+			wait = c.calculateRetryWait(ctx, attempt+1)
 			continue
 		}
+		try.StatusCode, try.Timing = resp.StatusCode, resp.Timing
 
 		// Check for cookie challenge (403/429 + Set-Cookie from bot protection)
 		// This handles Akamai, Cloudflare, PerimeterX, etc.
@@ -638,33 +743,55 @@ func (c *Client) doWithRetry(ctx context.Context, req *Request) (*Response, erro
 				cookieChallengeRetried = true
 				// Cookies are now stored in jar from first response
 				// Next retry will use H3 with these cookies
+				resp.Close()
+				wait = c.calculateRetryWait(ctx, attempt+1)
 				continue
 			}
 		}
 
 		// Check if we should retry based on status code
-		if c.shouldRetryStatus(resp.StatusCode) && attempt < c.config.MaxRetries {
-			lastResp = resp
-			lastErr = fmt.Errorf("server returned status %d", resp.StatusCode)
-			continue
+		if c.shouldRetryStatus(resp.StatusCode) && attempt < c.config.MaxRetries && (retryAny || notProcessed(resp)) {
+			after, ok := c.retryAfter(resp)
+			if ok {
+				wait = c.calculateRetryWait(ctx, attempt+1)
+				if after > 0 {
+					wait = after
+				}
+				// Keep the body readable in case no later attempt gets a response
+				resp.Bytes()
+				lastResp = resp
+				lastErr = fmt.Errorf("server returned status %d", resp.StatusCode)
+				continue
+			}
 		}
 
+		if len(attempts) > 1 {
+			resp.Attempts = attempts
+		}
 		return resp, nil
 	}
 
 	if lastResp != nil {
+		lastResp.Attempts = attempts
 		return lastResp, nil
 	}
 	return nil, fmt.Errorf("request failed after %d retries: %w", c.config.MaxRetries, lastErr)
 }
 
-// calculateRetryWait calculates wait time for retry with exponential backoff
-func (c *Client) calculateRetryWait(attempt int) time.Duration {
+// calculateRetryWait calculates wait time for retry with exponential backoff.
+// The jitter is derived from the identity in ctx, if any (see
+// fingerprint.WithIdentity), so an identity's retries are spaced the same
+// way in every process.
+func (c *Client) calculateRetryWait(ctx context.Context, attempt int) time.Duration {
 	// Exponential backoff: min * 2^attempt
 	wait := float64(c.config.RetryWaitMin) * math.Pow(2, float64(attempt-1))
 
 	// Add jitter (±20%)
-	jitter := wait * 0.2 * (rand.Float64()*2 - 1)
+	f := rand.Float64()
+	if r := fingerprint.IdentityRand(fingerprint.IdentityFrom(ctx), "retry-jitter:"+strconv.Itoa(attempt)); r != nil {
+		f = r.Float64()
+	}
+	jitter := wait * 0.2 * (f*2 - 1)
 	wait += jitter
 
 	// Cap at max
@@ -686,7 +813,7 @@ func (c *Client) shouldRetryStatus(statusCode int) bool {
 }
 
 // doOnce executes a single request (with redirect following)
-func (c *Client) doOnce(ctx context.Context, req *Request, redirectHistory []*RedirectInfo) (*Response, error) {
+func (c *Client) doOnce(ctx context.Context, req *Request, redirectHistory []*RedirectInfo) (response *Response, err error) {
 	startTime := time.Now()
 
 	// Build URL with params
@@ -706,6 +833,9 @@ func (c *Client) doOnce(ctx context.Context, req *Request, redirectHistory []*Re
 	}
 
 	host := parsedURL.Hostname()
+	if err := c.hostFilter().Check(host); err != nil {
+		return nil, err
+	}
 	port := parsedURL.Port()
 	if port == "" {
 		port = "443"
@@ -717,11 +847,27 @@ func (c *Client) doOnce(ctx context.Context, req *Request, redirectHistory []*Re
 		timeout = req.Timeout
 	}
 	ctx, cancel := context.WithTimeout(ctx, timeout)
-	defer cancel()
+	defer func() {
+		// A streamed body keeps the context until it is closed, this hop's
+		// as well as any later redirect's
+		if body, ok := response.stream(); ok {
+			if next := body.cancel; next != nil {
+				body.cancel = func() {
+					next()
+					cancel()
+				}
+			} else {
+				body.cancel = cancel
+			}
+			return
+		}
+		cancel()
+	}()
 
 	// Check if HTTP/3 has failed for this host recently (within 5 minutes)
 	hostKey := host + ":" + port
 	useH3 := c.shouldTryHTTP3(hostKey)
+	ctx = c.withProxyRoute(ctx, hostKey)
 
 	// Build HTTP request
 	method := req.Method
@@ -767,7 +913,7 @@ func (c *Client) doOnce(ctx context.Context, req *Request, redirectHistory []*Re
 
 	// Apply authentication
 	auth := req.Auth
-	if auth == nil {
+	if auth == nil && (req.redirect == nil || !req.redirect.dropCredentials) {
 		auth = c.auth
 	}
 	if auth != nil {
@@ -795,6 +941,16 @@ func (c *Client) doOnce(ctx context.Context, req *Request, redirectHistory []*Re
 		}
 	}
 
+	// Header rules have the last word over presets, auth, cookies and hooks
+	transport.ApplyHeaderRules(httpReq.Header, c.config.HeaderRules, parsedURL.Hostname())
+
+	// Stop at a redirect back to a request already made with the same cookies
+	if len(redirectHistory) > 0 {
+		if loop := transport.FindRedirectLoop(redirectHistory, httpReq.Method, reqURL, httpReq.Header.Get("Cookie")); loop != nil {
+			return nil, loop
+		}
+	}
+
 	// Copy all headers from httpReq to req.Headers for debugging
 	// This captures all headers that will actually be sent (preset headers, auth, cookies, etc.)
 	if req.Headers == nil {
@@ -811,10 +967,44 @@ func (c *Client) doOnce(ctx context.Context, req *Request, redirectHistory []*Re
 		}
 	}
 
+	// Added after the copy above so a redirect doesn't carry this URL's
+	// validators to the next one
+	if req.Conditional {
+		c.applyValidators(httpReq, reqURL)
+	}
+
+	// Fail fast while this origin's circuit is open. Only what happens from
+	// here on counts towards it; errors above are local.
+	var call *circuitCall
+	if c.breaker != nil {
+		if call, err = c.breaker.allow(parsedURL.Scheme+"://"+hostKey, c.circuitProxy(ctx)); err != nil {
+			return nil, err
+		}
+		defer func() {
+			status := 0
+			if response != nil {
+				status = response.StatusCode
+			}
+			call.done(status, err)
+		}()
+	}
+
 	var resp *http.Response
 	var usedProtocol string
 	timing := &protocol.Timing{}
 
+	// Slow request log; the record is emitted once this hop is settled
+	slow := c.traceSlowRequest(startTime, method, reqURL, timing)
+	if slow != nil {
+		defer func() {
+			status := 0
+			if response != nil {
+				status = response.StatusCode
+			}
+			slow.report(usedProtocol, status, err)
+		}()
+	}
+
 	// Determine effective protocol: request-level takes precedence over client-level
 	effectiveProtocol := req.ForceProtocol
 	if effectiveProtocol == ProtocolAuto && c.config.ForceProtocol != ProtocolAuto {
@@ -882,6 +1072,12 @@ func (c *Client) doOnce(ctx context.Context, req *Request, redirectHistory []*Re
 					}
 				}
 			}
+		} else if c.config.RaceH3 && useH3 && c.quicManager != nil {
+			// Race QUIC against TCP the way Chrome does
+			resp, usedProtocol, err = c.doRaced(ctx, hostKey, host, port, httpReq, bodyBytes, timing, startTime)
+			if err != nil {
+				return nil, err
+			}
 		} else {
 			// Try HTTP/2 first (for bot protection cookie flow)
 			resp, usedProtocol, err = c.doHTTP2(ctx, host, port, httpReq, timing, startTime)
@@ -912,6 +1108,10 @@ func (c *Client) doOnce(ctx context.Context, req *Request, redirectHistory []*Re
 		}
 	}
 
+	if c.config.TrackServerClock {
+		c.clock.observe(parsedURL.Scheme+"://"+parsedURL.Host, resp, c.clock.now())
+	}
+
 	// Verify certificate pinning
 	if c.certPinner != nil && c.certPinner.HasPins() && resp.TLS != nil {
 		if err := c.certPinner.Verify(host, resp.TLS.PeerCertificates); err != nil {
@@ -920,14 +1120,21 @@ func (c *Client) doOnce(ctx context.Context, req *Request, redirectHistory []*Re
 		}
 	}
 
-	defer resp.Body.Close()
+	streamed := false
+	defer func() {
+		if !streamed {
+			resp.Body.Close()
+		}
+	}()
 
 	// Build response headers map (multi-value support)
 	headers := make(map[string][]string)
 	for key, values := range resp.Header {
 		lowerKey := strings.ToLower(key)
 		headerValues := make([]string, len(values))
-		copy(headerValues, values)
+		for i, v := range values {
+			headerValues[i] = transport.NormalizeHeaderValue(v)
+		}
 		headers[lowerKey] = headerValues
 	}
 
@@ -973,42 +1180,27 @@ func (c *Client) doOnce(ctx context.Context, req *Request, redirectHistory []*Re
 				StatusCode: resp.StatusCode,
 				URL:        reqURL,
 				Headers:    headers,
+				Method:     httpReq.Method,
+				Cookie:     httpReq.Header.Get("Cookie"),
 			})
 
-			// Determine new method based on redirect code
-			newMethod := method
-			if resp.StatusCode == 303 || (resp.StatusCode == 301 || resp.StatusCode == 302) && method == "POST" {
-				// 303 always changes to GET
-				// 301/302 change POST to GET (browser behavior)
-				newMethod = "GET"
-			}
+			// Browsers replay 307/308 and recompute Referer, Origin and
+			// Sec-Fetch-Site for the new URL
+			newReq := newRedirectRequest(req, httpReq, resp, reqURL, redirectURL, bodyBytes, c.redirectMethods(req), c.redirectCredentials())
 
-			// Create new request for redirect
-			newReq := &Request{
-				Method:          newMethod,
-				URL:             redirectURL,
-				Headers:         req.Headers,
-				Timeout:         req.Timeout,
-				UserAgent:       req.UserAgent,
-				ForceProtocol:   req.ForceProtocol,
-				FetchMode:       req.FetchMode,
-				FetchSite:       FetchSiteCrossSite, // Redirects are usually cross-site
-				Referer:         reqURL,
-				Auth:            req.Auth,
-				FollowRedirects: req.FollowRedirects,
-				MaxRedirects:    req.MaxRedirects,
-				DisableRetry:    true, // Don't retry redirects
+			err := c.checkRedirect(newReq, req, httpReq.Method, resp.StatusCode, redirectHistory, bodyBytes)
+			if err == nil {
+				// Follow redirect; this hop's origin answered
+				call.done(resp.StatusCode, nil)
+				slow.report(usedProtocol, resp.StatusCode, nil)
+				return c.doOnce(ctx, newReq, redirectHistory)
 			}
-
-			// 307/308 preserve body (use cached bytes since original reader was consumed)
-			if resp.StatusCode == 307 || resp.StatusCode == 308 {
-				if len(bodyBytes) > 0 {
-					newReq.Body = bytes.NewReader(bodyBytes)
-				}
+			if !errors.Is(err, ErrUseLastResponse) {
+				resp.Body.Close()
+				return nil, err
 			}
-
-			// Follow redirect
-			return c.doOnce(ctx, newReq, redirectHistory)
+			// Stopped here: the redirect itself is the response
+			redirectHistory = redirectHistory[:len(redirectHistory)-1]
 		}
 	}
 
@@ -1029,36 +1221,66 @@ func (c *Client) doOnce(ctx context.Context, req *Request, redirectHistory []*Re
 				return nil, fmt.Errorf("failed to apply authentication after challenge: %w", err)
 			}
 			// Retry request
+			call.done(resp.StatusCode, nil)
+			slow.report(usedProtocol, resp.StatusCode, nil)
 			return c.doOnce(ctx, req, redirectHistory)
 		}
 	}
 
-	// Read response body
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
-	}
+	// Read response body, or leave it to be read as it arrives
+	limit := c.maxBodySize(req)
+	var body io.ReadCloser
+	var respBody []byte
+	if req.Stream {
+		contentEncoding := resp.Header.Get("Content-Encoding")
+		if c.config.RawBody {
+			contentEncoding = ""
+		}
+		reader, decompressor := setupDecompressor(resp.Body, contentEncoding)
+		body = &streamBody{reader: reader, decompressor: decompressor, raw: resp.Body, limit: limit}
+		streamed = true
+	} else {
+		bodyStart := time.Now()
+		respBody, err = readBody(resp.Body, limit)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read response body: %w", err)
+		}
 
-	// Decompress if needed
-	contentEncoding := resp.Header.Get("Content-Encoding")
-	respBody, err = decompress(respBody, contentEncoding)
-	if err != nil {
-		return nil, fmt.Errorf("failed to decompress response: %w", err)
+		// Decompress if needed
+		if !c.config.RawBody {
+			contentEncoding := resp.Header.Get("Content-Encoding")
+			respBody, err = decompress(respBody, contentEncoding)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decompress response: %w", err)
+			}
+			if limit > 0 && int64(len(respBody)) > limit {
+				return nil, fmt.Errorf("failed to decompress response: %w", &BodyTooLargeError{Limit: limit})
+			}
+		}
+		if slow != nil {
+			slow.body = time.Since(bodyStart)
+		}
+		body = io.NopCloser(bytes.NewReader(respBody))
 	}
 
 	timing.Total = float64(time.Since(startTime).Milliseconds())
 
-	response := &Response{
+	if req.Conditional {
+		c.storeValidators(reqURL, resp)
+	}
+
+	response = &Response{
 		StatusCode:      resp.StatusCode,
 		Headers:         headers,
-		Body:            io.NopCloser(bytes.NewReader(respBody)),
+		Body:            body,
 		FinalURL:        reqURL,
 		Timing:          timing,
 		Protocol:        usedProtocol,
 		Request:         req,
 		RedirectHistory: redirectHistory,
+		NotModified:     req.Conditional && resp.StatusCode == http.StatusNotModified,
 		bodyBytes:       respBody,
-		bodyRead:        true,
+		bodyRead:        !req.Stream,
 	}
 
 	// Run post-response hooks
@@ -1111,10 +1333,10 @@ func (c *Client) doHTTP3(ctx context.Context, host, port string, httpReq *http.R
 	if c.masqueTransport != nil {
 		firstByteTime := time.Now()
 		resp, err := c.masqueTransport.RoundTrip(httpReq)
+		timing.FirstByte = float64(time.Since(firstByteTime).Milliseconds())
 		if err != nil {
 			return nil, "", err
 		}
-		timing.FirstByte = float64(time.Since(firstByteTime).Milliseconds())
 		return resp, "h3", nil
 	}
 
@@ -1122,16 +1344,17 @@ func (c *Client) doHTTP3(ctx context.Context, host, port string, httpReq *http.R
 	if c.socks5H3Transport != nil {
 		firstByteTime := time.Now()
 		resp, err := c.socks5H3Transport.RoundTrip(httpReq)
+		timing.FirstByte = float64(time.Since(firstByteTime).Milliseconds())
 		if err != nil {
 			return nil, "", err
 		}
-		timing.FirstByte = float64(time.Since(firstByteTime).Milliseconds())
 		return resp, "h3", nil
 	}
 
 	// Use QUICManager for direct connections
 	conn, err := c.quicManager.GetConn(ctx, host, port)
 	if err != nil {
+		timing.TLSHandshake = float64(time.Since(connStart).Milliseconds())
 		return nil, "", fmt.Errorf("failed to get QUIC connection: %w", err)
 	}
 
@@ -1145,11 +1368,10 @@ func (c *Client) doHTTP3(ctx context.Context, host, port string, httpReq *http.R
 
 	firstByteTime := time.Now()
 	resp, err := conn.HTTP3RT.RoundTrip(httpReq)
+	timing.FirstByte = float64(time.Since(firstByteTime).Milliseconds())
 	if err != nil {
 		return nil, "", err
 	}
-
-	timing.FirstByte = float64(time.Since(firstByteTime).Milliseconds())
 	return resp, "h3", nil
 }
 
@@ -1157,8 +1379,11 @@ func (c *Client) doHTTP3(ctx context.Context, host, port string, httpReq *http.R
 func (c *Client) doHTTP2(ctx context.Context, host, port string, httpReq *http.Request, timing *protocol.Timing, startTime time.Time) (*http.Response, string, error) {
 	connStart := time.Now()
 
-	conn, err := c.poolManager.GetConn(ctx, host, port)
+	poolManager, _, route := c.tcpRoute(ctx)
+	conn, err := poolManager.GetConn(ctx, host, port)
 	if err != nil {
+		timing.TCPConnect = float64(time.Since(connStart).Milliseconds())
+		c.proxyPool.report(ctx, route, err)
 		return nil, "", fmt.Errorf("failed to get connection: %w", err)
 	}
 
@@ -1172,11 +1397,11 @@ func (c *Client) doHTTP2(ctx context.Context, host, port string, httpReq *http.R
 
 	firstByteTime := time.Now()
 	resp, err := conn.HTTP2Conn.RoundTrip(httpReq)
+	timing.FirstByte = float64(time.Since(firstByteTime).Milliseconds())
+	c.proxyPool.report(ctx, route, err)
 	if err != nil {
 		return nil, "", fmt.Errorf("request failed: %w", err)
 	}
-
-	timing.FirstByte = float64(time.Since(firstByteTime).Milliseconds())
 	return resp, "h2", nil
 }
 
@@ -1184,12 +1409,13 @@ func (c *Client) doHTTP2(ctx context.Context, host, port string, httpReq *http.R
 func (c *Client) doHTTP1(ctx context.Context, host, port string, httpReq *http.Request, timing *protocol.Timing, startTime time.Time) (*http.Response, string, error) {
 	firstByteTime := time.Now()
 
-	resp, err := c.h1Transport.RoundTrip(httpReq)
+	_, h1Transport, route := c.tcpRoute(ctx)
+	resp, err := h1Transport.RoundTrip(httpReq)
+	timing.FirstByte = float64(time.Since(firstByteTime).Milliseconds())
+	c.proxyPool.report(ctx, route, err)
 	if err != nil {
 		return nil, "", fmt.Errorf("HTTP/1.1 request failed: %w", err)
 	}
-
-	timing.FirstByte = float64(time.Since(firstByteTime).Milliseconds())
 	return resp, "h1", nil
 }
 
@@ -1243,6 +1469,9 @@ func (c *Client) Post(ctx context.Context, url string, body io.Reader, headers m
 // Close shuts down the client and all connections
 func (c *Client) Close() {
 	c.poolManager.Close()
+	if c.proxyPool != nil {
+		c.proxyPool.close()
+	}
 	if c.quicManager != nil {
 		c.quicManager.Close()
 	}
@@ -1277,6 +1506,13 @@ func (c *Client) SetProxy(proxyURL string) {
 // This closes all existing TCP-based connections
 // Pass empty string to switch to direct connection (no proxy)
 func (c *Client) SetTCPProxy(proxyURL string) {
+	// An explicit proxy replaces the pool set with WithProxyPool
+	if c.proxyPool != nil {
+		c.proxyPool.close()
+		c.proxyPool = nil
+		c.config.ProxyPool = nil
+	}
+
 	// Close HTTP/2 pools and update proxy
 	c.poolManager.SetProxy(proxyURL)
 
@@ -1418,6 +1654,14 @@ func (c *Client) GetHeaderOrder() []string {
 	return nil
 }
 
+// hostFilter returns the allowed and blocked hosts, nil without any
+func (c *Client) hostFilter() *transport.HostFilter {
+	if len(c.config.AllowedHosts) == 0 && len(c.config.BlockedHosts) == 0 {
+		return nil
+	}
+	return &transport.HostFilter{Allowed: c.config.AllowedHosts, Blocked: c.config.BlockedHosts}
+}
+
 // getHeaderOrder returns the current header order for internal use (no copy).
 func (c *Client) getHeaderOrder() []string {
 	c.customHeaderOrderMu.RLock()
@@ -1622,8 +1866,15 @@ func applyNavigationModeHeaders(httpReq *http.Request, preset *fingerprint.Prese
 	httpReq.Header.Set("Sec-Fetch-User", "?1")
 	httpReq.Header.Set("Upgrade-Insecure-Requests", "1")
 
-	// Priority header (newer Chrome)
-	if v, ok := preset.Headers["Priority"]; ok {
+	// Form submissions (POST etc.) carry the submitting page's origin
+	if httpReq.Method != "GET" && httpReq.Method != "HEAD" {
+		if origin := requestOrigin(req); origin != "" {
+			httpReq.Header.Set("Origin", origin)
+		}
+	}
+
+	// Priority header (newer Chrome and Firefox)
+	if v := preset.PriorityHeader(fingerprint.FetchDestDocument, "h2"); v != "" {
 		httpReq.Header.Set("Priority", v)
 	}
 }
@@ -1657,17 +1908,17 @@ func applyCORSModeHeaders(httpReq *http.Request, preset *fingerprint.Preset, req
 	// NO Cache-Control for CORS
 
 	// Origin header - required for CORS
-	if req.Referer != "" {
-		if refURL, err := url.Parse(req.Referer); err == nil {
-			httpReq.Header.Set("Origin", refURL.Scheme+"://"+refURL.Host)
-		}
+	if origin := requestOrigin(req); origin != "" {
+		httpReq.Header.Set("Origin", origin)
 	} else {
 		httpReq.Header.Set("Origin", parsedURL.Scheme+"://"+parsedURL.Host)
 	}
 
-	// Priority header for CORS mode (Chrome 143+)
-	// CORS uses "u=1, i" (urgency 1, incremental) vs navigation's "u=0, i"
-	httpReq.Header.Set("Priority", "u=1, i")
+	// Priority header for CORS mode, per the preset's browser
+	// Chrome uses "u=1, i" (urgency 1, incremental) vs navigation's "u=0, i"
+	if v := preset.PriorityHeader(fingerprint.FetchDestXHR, "h2"); v != "" {
+		httpReq.Header.Set("Priority", v)
+	}
 }
 
 // detectSecFetchSiteForMode determines the Sec-Fetch-Site header value
@@ -1766,37 +2017,5 @@ func applyOrganicJitter(req *http.Request) {
 
 // decompress decompresses response body based on Content-Encoding
 func decompress(data []byte, encoding string) ([]byte, error) {
-	switch strings.ToLower(encoding) {
-	case "gzip":
-		reader, err := gzip.NewReader(bytes.NewReader(data))
-		if err != nil {
-			return nil, err
-		}
-		defer reader.Close()
-		return io.ReadAll(reader)
-
-	case "br":
-		reader := brotli.NewReader(bytes.NewReader(data))
-		return io.ReadAll(reader)
-
-	case "zstd":
-		decoder, err := zstd.NewReader(bytes.NewReader(data))
-		if err != nil {
-			return nil, err
-		}
-		defer decoder.Close()
-		return io.ReadAll(decoder)
-
-	case "deflate":
-		reader := flate.NewReader(bytes.NewReader(data))
-		defer reader.Close()
-		return io.ReadAll(reader)
-
-	case "", "identity":
-		return data, nil
-
-	default:
-		// Unknown encoding, return as-is
-		return data, nil
-	}
+	return transport.Decompress(data, encoding)
 }
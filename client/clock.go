@@ -0,0 +1,115 @@
+package client
+
+import (
+	"net/url"
+	"sync"
+	"time"
+
+	http "github.com/sardanioss/http"
+)
+
+// skewSmoothing weights a new Date sample against the running estimate. Date
+// has one-second resolution, so single samples are noisy.
+const skewSmoothing = 0.25
+
+// ClockSkew is the measured offset between a server's clock and ours
+type ClockSkew struct {
+	Offset  time.Duration // Server time minus local time; positive = server ahead
+	Samples int           // Date headers the estimate is built from
+	Updated time.Time     // When the last sample was taken (local clock)
+}
+
+// clockTracker estimates per-origin clock skew from response Date headers
+type clockTracker struct {
+	mu     sync.RWMutex
+	skews  map[string]ClockSkew
+	source func() time.Time
+}
+
+func (t *clockTracker) now() time.Time {
+	if t.source != nil {
+		return t.source()
+	}
+	return time.Now()
+}
+
+// observe folds the Date header of a response received at receivedAt into
+// the estimate for origin
+func (t *clockTracker) observe(origin string, resp *http.Response, receivedAt time.Time) {
+	serverDate, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return
+	}
+	// Date is truncated to the second; its midpoint is the best guess
+	sample := serverDate.Add(500 * time.Millisecond).Sub(receivedAt)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.skews == nil {
+		t.skews = make(map[string]ClockSkew)
+	}
+	s := t.skews[origin]
+	if s.Samples == 0 {
+		s.Offset = sample
+	} else {
+		s.Offset += time.Duration(float64(sample-s.Offset) * skewSmoothing)
+	}
+	s.Samples++
+	s.Updated = receivedAt
+	t.skews[origin] = s
+}
+
+func (t *clockTracker) skew(origin string) (ClockSkew, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	s, ok := t.skews[origin]
+	return s, ok
+}
+
+func (t *clockTracker) all() map[string]ClockSkew {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	out := make(map[string]ClockSkew, len(t.skews))
+	for origin, s := range t.skews {
+		out[origin] = s
+	}
+	return out
+}
+
+// originOf returns scheme://host[:port] for rawURL, or rawURL itself if it
+// already is one
+func originOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return rawURL
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// Now returns the current time as the server behind rawURL sees it: the
+// client's clock (WithClock, default the local clock) corrected by the skew
+// measured from that origin's Date headers when WithServerClock is set.
+// Use it for timestamps that a server checks, such as signed payloads:
+//
+//	c.OnPreRequest(func(r *http.Request) error {
+//		r.Header.Set("Date", c.Now(r.URL.String()).UTC().Format(http.TimeFormat))
+//		return nil
+//	})
+func (c *Client) Now(rawURL string) time.Time {
+	now := c.clock.now()
+	if s, ok := c.clock.skew(originOf(rawURL)); ok {
+		now = now.Add(s.Offset)
+	}
+	return now
+}
+
+// ClockSkew returns the skew measured for the origin of rawURL. ok is false
+// until a response with a Date header has been received from it.
+func (c *Client) ClockSkew(rawURL string) (skew ClockSkew, ok bool) {
+	return c.clock.skew(originOf(rawURL))
+}
+
+// ClockSkews returns the skew measured for every origin, keyed by origin
+func (c *Client) ClockSkews() map[string]ClockSkew {
+	return c.clock.all()
+}
@@ -0,0 +1,90 @@
+package client
+
+import (
+	"sync"
+
+	http "github.com/sardanioss/http"
+)
+
+// validators are the cache validators a server returned for a URL
+type validators struct {
+	etag         string
+	lastModified string
+}
+
+// validatorStore remembers the last validators seen per URL for
+// conditional requests. It holds no bodies, so it is not a cache.
+type validatorStore struct {
+	mu      sync.RWMutex
+	entries map[string]validators
+}
+
+func (s *validatorStore) get(url string) (validators, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	v, ok := s.entries[url]
+	return v, ok
+}
+
+func (s *validatorStore) set(url string, v validators) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.entries == nil {
+		s.entries = make(map[string]validators)
+	}
+	s.entries[url] = v
+}
+
+func (s *validatorStore) clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = nil
+}
+
+// applyValidators adds If-None-Match/If-Modified-Since from the last response
+// for url. Validators the caller set on the request are left alone.
+func (c *Client) applyValidators(httpReq *http.Request, url string) {
+	if httpReq.Method != http.MethodGet && httpReq.Method != http.MethodHead {
+		return
+	}
+	if httpReq.Header.Get("If-None-Match") != "" || httpReq.Header.Get("If-Modified-Since") != "" {
+		return
+	}
+	v, ok := c.validators.get(url)
+	if !ok {
+		return
+	}
+	if v.etag != "" {
+		httpReq.Header.Set("If-None-Match", v.etag)
+	}
+	if v.lastModified != "" {
+		httpReq.Header.Set("If-Modified-Since", v.lastModified)
+	}
+}
+
+// storeValidators records the validators of a successful response for url
+func (c *Client) storeValidators(url string, resp *http.Response) {
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return
+	}
+	v := validators{
+		etag:         resp.Header.Get("ETag"),
+		lastModified: resp.Header.Get("Last-Modified"),
+	}
+	if v.etag != "" || v.lastModified != "" {
+		c.validators.set(url, v)
+	}
+}
+
+// Validators returns the ETag and Last-Modified values that a conditional
+// request to url would send, from the last 2xx response to one.
+func (c *Client) Validators(url string) (etag, lastModified string) {
+	v, _ := c.validators.get(url)
+	return v.etag, v.lastModified
+}
+
+// ClearValidators forgets all validators, so the next conditional request
+// to each URL is unconditional.
+func (c *Client) ClearValidators() {
+	c.validators.clear()
+}
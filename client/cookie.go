@@ -4,6 +4,8 @@ import (
 	"net/url"
 	"strings"
 	"time"
+
+	"github.com/sardanioss/httpcloak/fingerprint"
 )
 
 // Cookie represents an HTTP cookie
@@ -17,6 +19,8 @@ type Cookie struct {
 	Secure   bool
 	HttpOnly bool
 	SameSite string // "Strict", "Lax", "None"
+	Priority string // "Low", "Medium", "High"; "" is Medium
+	Created  time.Time
 	Raw      string // original Set-Cookie header
 }
 
@@ -181,6 +185,8 @@ func ParseSetCookie(header string, requestURL *url.URL) *Cookie {
 			cookie.HttpOnly = true
 		case "samesite":
 			cookie.SameSite = value
+		case "priority":
+			cookie.Priority = fingerprint.ParseCookiePriority(value).String()
 		}
 	}
 
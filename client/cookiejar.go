@@ -6,21 +6,35 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/sardanioss/httpcloak/fingerprint"
 )
 
 // CookieJar stores cookies and provides thread-safe access
 type CookieJar struct {
-	mu      sync.RWMutex
-	cookies map[string][]*Cookie // domain -> cookies
+	mu             sync.RWMutex
+	cookies        map[string][]*Cookie // domain -> cookies
+	maxHeaderBytes int
 }
 
 // NewCookieJar creates a new empty cookie jar
 func NewCookieJar() *CookieJar {
 	return &CookieJar{
-		cookies: make(map[string][]*Cookie),
+		cookies:        make(map[string][]*Cookie),
+		maxHeaderBytes: fingerprint.MaxCookieHeaderBytes,
 	}
 }
 
+// SetMaxHeaderBytes sets the largest Cookie header CookieHeader builds.
+// Over the limit, cookies are left out the way Chrome evicts them: Low
+// Priority first, then non-secure, then oldest. Default:
+// fingerprint.MaxCookieHeaderBytes; 0 or less disables the limit.
+func (j *CookieJar) SetMaxHeaderBytes(n int) {
+	j.mu.Lock()
+	j.maxHeaderBytes = n
+	j.mu.Unlock()
+}
+
 // SetCookies adds cookies from Set-Cookie headers to the jar
 func (j *CookieJar) SetCookies(u *url.URL, cookies []*Cookie) {
 	if len(cookies) == 0 {
@@ -38,14 +52,21 @@ func (j *CookieJar) SetCookies(u *url.URL, cookies []*Cookie) {
 		// Get the domain key
 		domain := j.domainKey(cookie.Domain)
 
-		// Remove existing cookie with same name, domain, and path
+		// Remove existing cookie with same name, domain, and path; a
+		// replacement keeps the original creation time
 		existing := j.cookies[domain]
 		filtered := make([]*Cookie, 0, len(existing))
+		created := time.Now()
 		for _, c := range existing {
 			if c.Name != cookie.Name || c.Path != cookie.Path {
 				filtered = append(filtered, c)
+			} else if !c.Created.IsZero() {
+				created = c.Created
 			}
 		}
+		if cookie.Created.IsZero() {
+			cookie.Created = created
+		}
 
 		// Add new cookie if not expired
 		if !cookie.IsExpired() {
@@ -131,9 +152,24 @@ func (j *CookieJar) CookieHeader(u *url.URL) string {
 		return ""
 	}
 
-	parts := make([]string, len(cookies))
+	candidates := make([]fingerprint.CookieCandidate, len(cookies))
 	for i, c := range cookies {
-		parts[i] = c.String()
+		candidates[i] = fingerprint.CookieCandidate{
+			Name:     c.Name,
+			Value:    c.Value,
+			Secure:   c.Secure,
+			Priority: fingerprint.ParseCookiePriority(c.Priority),
+			Created:  c.Created,
+		}
+	}
+	j.mu.RLock()
+	limit := j.maxHeaderBytes
+	j.mu.RUnlock()
+
+	keep := fingerprint.FitCookieHeader(candidates, limit)
+	parts := make([]string, len(keep))
+	for i, k := range keep {
+		parts[i] = cookies[k].String()
 	}
 
 	return strings.Join(parts, "; ")
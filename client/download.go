@@ -0,0 +1,573 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrDownloadChanged is returned when the file changes on the server while
+// it is being downloaded, even after starting over once
+var ErrDownloadChanged = errors.New("download: resource changed on the server")
+
+// errRestart means the ranges on disk no longer match the server's file
+var errRestart = errors.New("download: restart required")
+
+// downloadStatusError is an unexpected response status
+type downloadStatusError int
+
+func (e downloadStatusError) Error() string {
+	return fmt.Sprintf("download: unexpected status %d", int(e))
+}
+
+// stateSaveInterval is how often progress is written to the state file
+const stateSaveInterval = time.Second
+
+// DownloadOptions configures Client.Download
+type DownloadOptions struct {
+	// Headers are added to every request
+	Headers map[string][]string
+
+	// Parallel splits a large file into this many ranges fetched at once.
+	// Default (0 or 1): one request.
+	Parallel int
+
+	// MinChunkSize is the smallest range worth its own request when
+	// splitting. Default: 4MB.
+	MinChunkSize int64
+
+	// Retries is how many times an interrupted range is resumed before
+	// Download gives up. Default: 3. Negative: never.
+	Retries int
+
+	// Timeout bounds each request. Default: 1 hour.
+	Timeout time.Duration
+
+	// Progress is called as data is written. With Parallel it is called
+	// from several goroutines, but never concurrently.
+	Progress func(DownloadProgress)
+}
+
+// DownloadProgress reports how far a download has got
+type DownloadProgress struct {
+	Downloaded int64 // Bytes on disk, including any from an earlier run
+	Total      int64 // -1 if the server didn't say
+}
+
+// DownloadResult describes a finished download
+type DownloadResult struct {
+	Path    string
+	Size    int64
+	ETag    string
+	Resumed bool // Part of the file came from an earlier, interrupted run
+}
+
+// downloadState is what's on disk next to the partial file so an interrupted
+// download can pick up where it stopped
+type downloadState struct {
+	URL          string           `json:"url"`
+	Size         int64            `json:"size"` // -1 if unknown
+	ETag         string           `json:"etag,omitempty"`
+	LastModified string           `json:"lastModified,omitempty"`
+	Ranges       []*downloadRange `json:"ranges"`
+}
+
+// downloadRange is one byte range of the file
+type downloadRange struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`  // Inclusive; -1 if the size is unknown
+	Next  int64 `json:"next"` // First byte not yet written
+}
+
+func (r *downloadRange) done() bool {
+	return r.End >= 0 && r.Next > r.End
+}
+
+func (s *downloadState) downloaded() int64 {
+	var n int64
+	for _, r := range s.Ranges {
+		n += r.Next - r.Start
+	}
+	return n
+}
+
+// ifRange returns the validator for If-Range: a strong ETag, else
+// Last-Modified, as Chrome sends when resuming
+func (s *downloadState) ifRange() string {
+	if s.ETag != "" && !strings.HasPrefix(s.ETag, "W/") {
+		return s.ETag
+	}
+	return s.LastModified
+}
+
+// Download fetches url into path. The file is written to path+".part" with
+// its progress in path+".part.json"; if an earlier call was interrupted,
+// Download resumes it with Range requests. Every response is checked
+// against the ETag and length seen first, and if the file changed on the
+// server the download starts over. opts may be nil.
+func (c *Client) Download(ctx context.Context, url, path string, opts *DownloadOptions) (*DownloadResult, error) {
+	var o DownloadOptions
+	if opts != nil {
+		o = *opts
+	}
+	if o.MinChunkSize <= 0 {
+		o.MinChunkSize = 4 << 20
+	}
+	if o.Retries == 0 {
+		o.Retries = 3
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = time.Hour
+	}
+
+	d := &downloader{
+		c:         c,
+		url:       url,
+		opts:      o,
+		partPath:  path + ".part",
+		statePath: path + ".part.json",
+	}
+	resumed := d.load()
+
+	var err error
+	for restarts := 0; ; restarts++ {
+		if err = d.run(ctx); !errors.Is(err, errRestart) {
+			break
+		}
+		d.discard()
+		resumed = false
+		if restarts == 1 {
+			return nil, ErrDownloadChanged
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.Rename(d.partPath, path); err != nil {
+		return nil, err
+	}
+	os.Remove(d.statePath)
+	return &DownloadResult{
+		Path:    path,
+		Size:    d.state.Size,
+		ETag:    d.state.ETag,
+		Resumed: resumed,
+	}, nil
+}
+
+// downloader runs a single Download
+type downloader struct {
+	c         *Client
+	url       string
+	opts      DownloadOptions
+	partPath  string
+	statePath string
+	file      *os.File
+
+	mu    sync.Mutex
+	state *downloadState
+	saved time.Time
+}
+
+// load reads the state of an earlier run and reports whether it has data
+// to resume from. State for another URL, or without its partial file, is
+// discarded.
+func (d *downloader) load() bool {
+	data, err := os.ReadFile(d.statePath)
+	if err != nil {
+		return false
+	}
+	var s downloadState
+	if json.Unmarshal(data, &s) != nil || s.URL != d.url {
+		d.discard()
+		return false
+	}
+	if _, err := os.Stat(d.partPath); err != nil {
+		d.discard()
+		return false
+	}
+	d.state = &s
+	return s.downloaded() > 0
+}
+
+// discard forgets all progress
+func (d *downloader) discard() {
+	d.state = nil
+	os.Remove(d.partPath)
+	os.Remove(d.statePath)
+}
+
+// saveLocked writes the state file. d.mu must be held.
+func (d *downloader) saveLocked() {
+	d.saved = time.Now()
+	if data, err := json.Marshal(d.state); err == nil {
+		os.WriteFile(d.statePath, data, 0o644)
+	}
+}
+
+// run downloads every range that isn't done yet, probing the server first
+// on a fresh start
+func (d *downloader) run(ctx context.Context) (err error) {
+	d.file, err = os.OpenFile(d.partPath, os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer d.file.Close()
+
+	var first *StreamResponse
+	if d.state == nil {
+		if first, err = d.probe(ctx); err != nil {
+			return err
+		}
+	}
+	defer func() {
+		if err != nil && !errors.Is(err, errRestart) {
+			d.mu.Lock()
+			d.saveLocked()
+			d.mu.Unlock()
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var wg sync.WaitGroup
+	errs := make(chan error, len(d.state.Ranges))
+	for i, r := range d.state.Ranges {
+		var resp *StreamResponse
+		if i == 0 {
+			resp = first
+		}
+		if r.done() {
+			if resp != nil {
+				resp.Close()
+			}
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := d.fetchRange(ctx, r, resp); err != nil {
+				errs <- err
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	// Prefer the error that stopped the others over their cancellations
+	for e := range errs {
+		if err == nil || errors.Is(err, context.Canceled) {
+			err = e
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if d.state.Size >= 0 {
+		info, err := d.file.Stat()
+		if err != nil {
+			return err
+		}
+		if info.Size() != d.state.Size {
+			return fmt.Errorf("download: wrote %d bytes, expected %d", info.Size(), d.state.Size)
+		}
+	}
+	return nil
+}
+
+// probe requests the whole file as an open range to learn its size,
+// validators and whether the server takes ranges, then plans the ranges.
+// The response is returned to be read as the first range.
+func (d *downloader) probe(ctx context.Context) (*StreamResponse, error) {
+	r := &downloadRange{End: -1}
+	d.state = &downloadState{URL: d.url, Size: -1, Ranges: []*downloadRange{r}}
+	resp, err := d.c.DoStream(ctx, d.request(r))
+	if err != nil {
+		d.state = nil
+		return nil, err
+	}
+
+	switch resp.StatusCode {
+	case 206:
+		_, _, total, ok := parseContentRange(firstHeader(resp.Headers, "content-range"))
+		if !ok {
+			resp.Close()
+			d.state = nil
+			return nil, errors.New("download: malformed Content-Range")
+		}
+		d.state.Size = total
+	case 200:
+		d.state.Size = resp.ContentLength
+	case 416:
+		// An empty file has no bytes to range over
+		if _, _, total, ok := parseContentRange(firstHeader(resp.Headers, "content-range")); ok && total == 0 {
+			resp.Close()
+			d.state.Size = 0
+			d.state.Ranges = nil
+			return nil, nil
+		}
+		fallthrough
+	default:
+		resp.Close()
+		d.state = nil
+		return nil, downloadStatusError(resp.StatusCode)
+	}
+
+	d.state.ETag = firstHeader(resp.Headers, "etag")
+	d.state.LastModified = firstHeader(resp.Headers, "last-modified")
+	if d.state.Size >= 0 {
+		r.End = d.state.Size - 1
+		if resp.StatusCode == 206 {
+			d.split()
+		}
+	}
+	return resp, nil
+}
+
+// split divides a file of known size into up to opts.Parallel ranges of at
+// least opts.MinChunkSize. The first range starts at 0, so the probe
+// response can still be read into it.
+func (d *downloader) split() {
+	size := d.state.Size
+	n := int64(d.opts.Parallel)
+	if chunks := size / d.opts.MinChunkSize; chunks < n {
+		n = chunks
+	}
+	if n < 2 {
+		return
+	}
+	d.state.Ranges = make([]*downloadRange, n)
+	for i := int64(0); i < n; i++ {
+		start := size * i / n
+		d.state.Ranges[i] = &downloadRange{Start: start, End: size*(i+1)/n - 1, Next: start}
+	}
+}
+
+// request builds the GET for the rest of r. Content codings would make the
+// byte offsets meaningless, so only identity is accepted.
+func (d *downloader) request(r *downloadRange) *Request {
+	headers := make(map[string][]string, len(d.opts.Headers)+3)
+	for key, values := range d.opts.Headers {
+		switch strings.ToLower(key) {
+		case "range", "if-range", "accept-encoding":
+			continue
+		}
+		headers[key] = values
+	}
+
+	d.mu.Lock()
+	rangeHeader := "bytes=" + strconv.FormatInt(r.Next, 10) + "-"
+	if r.End >= 0 {
+		rangeHeader += strconv.FormatInt(r.End, 10)
+	}
+	validator := d.state.ifRange()
+	d.mu.Unlock()
+
+	headers["Range"] = []string{rangeHeader}
+	headers["Accept-Encoding"] = []string{"identity"}
+	if validator != "" {
+		headers["If-Range"] = []string{validator}
+	}
+	return &Request{
+		Method:  "GET",
+		URL:     d.url,
+		Headers: headers,
+		Timeout: d.opts.Timeout,
+	}
+}
+
+// fetchRange downloads the rest of r, reading resp first if it's already
+// open, and resumes from the last byte written when the transfer breaks
+func (d *downloader) fetchRange(ctx context.Context, r *downloadRange, resp *StreamResponse) error {
+	for attempt := 1; ; attempt++ {
+		var err error
+		if resp == nil {
+			if resp, err = d.c.DoStream(ctx, d.request(r)); err == nil {
+				err = d.accept(resp, r)
+			}
+		}
+		if err == nil {
+			err = d.copyRange(resp, r)
+		}
+		if resp != nil {
+			resp.Close()
+			resp = nil
+		}
+
+		if err == nil || !retryableDownloadError(err) || attempt > d.opts.Retries || ctx.Err() != nil {
+			return err
+		}
+		select {
+		case <-time.After(d.c.calculateRetryWait(ctx, attempt)):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// accept checks a response for the rest of r against what the server said
+// before
+func (d *downloader) accept(resp *StreamResponse, r *downloadRange) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s := d.state
+
+	etag := firstHeader(resp.Headers, "etag")
+	if s.ETag != "" && etag != "" && etag != s.ETag {
+		return errRestart
+	}
+
+	switch resp.StatusCode {
+	case 206:
+		start, end, total, ok := parseContentRange(firstHeader(resp.Headers, "content-range"))
+		if !ok || start != r.Next || (r.End >= 0 && end > r.End) {
+			return errRestart
+		}
+		if s.Size >= 0 && total != s.Size {
+			return errRestart
+		}
+		return nil
+	case 200:
+		// The server ignored the range or the If-Range validator no longer
+		// matches. A single range simply starts over; split ranges can't.
+		if len(s.Ranges) > 1 {
+			return errRestart
+		}
+		if err := d.file.Truncate(0); err != nil {
+			return err
+		}
+		r.Next = 0
+		s.Size = resp.ContentLength
+		r.End = s.Size - 1
+		if s.Size < 0 {
+			r.End = -1
+		}
+		s.ETag = etag
+		s.LastModified = firstHeader(resp.Headers, "last-modified")
+		return nil
+	case 416:
+		return errRestart
+	}
+	return downloadStatusError(resp.StatusCode)
+}
+
+// copyRange writes resp into r from r.Next on
+func (d *downloader) copyRange(resp *StreamResponse, r *downloadRange) error {
+	buf := make([]byte, 32<<10)
+	for {
+		p := buf
+		if r.End >= 0 {
+			left := r.End + 1 - r.Next
+			if left <= 0 {
+				return nil
+			}
+			if left < int64(len(p)) {
+				p = p[:left]
+			}
+		}
+
+		n, err := resp.Read(p)
+		if n > 0 {
+			if _, werr := d.file.WriteAt(p[:n], r.Next); werr != nil {
+				return werr
+			}
+			d.advance(r, int64(n))
+		}
+		if err == io.EOF {
+			if r.End < 0 {
+				// Unknown size: the file ends here
+				d.mu.Lock()
+				d.state.Size = r.Next
+				r.End = r.Next - 1
+				d.mu.Unlock()
+				return nil
+			}
+			if r.Next <= r.End {
+				return io.ErrUnexpectedEOF
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// advance records n more bytes written to r
+func (d *downloader) advance(r *downloadRange, n int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	r.Next += n
+	if time.Since(d.saved) >= stateSaveInterval {
+		d.saveLocked()
+	}
+	if d.opts.Progress != nil {
+		d.opts.Progress(DownloadProgress{Downloaded: d.state.downloaded(), Total: d.state.Size})
+	}
+}
+
+// retryableDownloadError reports whether resuming after err could work:
+// broken transfers and server errors, not a changed file or a 4xx
+func retryableDownloadError(err error) bool {
+	if errors.Is(err, errRestart) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var status downloadStatusError
+	if errors.As(err, &status) {
+		return status >= 500
+	}
+	return true
+}
+
+// parseContentRange parses "bytes start-end/total"; total is -1 for "*".
+// The unsatisfied form "bytes */total" has start and end -1.
+func parseContentRange(v string) (start, end, total int64, ok bool) {
+	rest, found := strings.CutPrefix(strings.TrimSpace(v), "bytes ")
+	if !found {
+		return 0, 0, 0, false
+	}
+	span, size, found := strings.Cut(rest, "/")
+	if !found {
+		return 0, 0, 0, false
+	}
+
+	total = -1
+	if size != "*" {
+		var err error
+		if total, err = strconv.ParseInt(size, 10, 64); err != nil || total < 0 {
+			return 0, 0, 0, false
+		}
+	}
+	if span == "*" {
+		return -1, -1, total, true
+	}
+
+	first, last, found := strings.Cut(span, "-")
+	if !found {
+		return 0, 0, 0, false
+	}
+	start, err1 := strconv.ParseInt(first, 10, 64)
+	end, err2 := strconv.ParseInt(last, 10, 64)
+	if err1 != nil || err2 != nil || start < 0 || end < start || (total >= 0 && end >= total) {
+		return 0, 0, 0, false
+	}
+	return start, end, total, true
+}
+
+// firstHeader returns the first value of a lowercased response header
+func firstHeader(headers map[string][]string, key string) string {
+	if values := headers[key]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
@@ -0,0 +1,250 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Expect declares what a response must look like, for running the client as
+// a prober. Do checks it once the response is in and, if any check fails,
+// returns the response together with an *AssertionError.
+//
+// Example:
+//
+//	resp, err := c.Do(ctx, &client.Request{
+//		Method: "GET",
+//		URL:    "https://example.com/health",
+//		Expect: &client.Expect{
+//			Status:  []int{200},
+//			Headers: map[string]string{"Content-Type": "^application/json"},
+//			JSON:    map[string]any{"$.status": "ok"},
+//		},
+//	})
+type Expect struct {
+	// Status lists the acceptable status codes (empty = any)
+	Status []int
+
+	// Headers maps a header name to a regular expression its value must
+	// match. An empty expression only requires the header to be present.
+	Headers map[string]string
+
+	// BodyContains lists substrings the body must contain
+	BodyContains []string
+
+	// JSON maps a JSONPath to the value the body must have there. Paths are
+	// dotted names and [index] subscripts from the root: "$.data.items[0].id".
+	// A nil value only requires the path to exist.
+	JSON map[string]any
+}
+
+// AssertionFailure is one check of an Expect that a response failed
+type AssertionFailure struct {
+	Check    string // "status", "header", "body" or "json"
+	Target   string // Header name, substring or JSONPath ("" for status)
+	Expected string
+	Actual   string
+}
+
+func (f AssertionFailure) String() string {
+	if f.Target == "" {
+		return fmt.Sprintf("%s: expected %s, got %s", f.Check, f.Expected, f.Actual)
+	}
+	return fmt.Sprintf("%s %s: expected %s, got %s", f.Check, f.Target, f.Expected, f.Actual)
+}
+
+// AssertionError is returned by Do, with the response, when the response
+// fails its request's Expect
+type AssertionError struct {
+	URL        string
+	StatusCode int
+	Failures   []AssertionFailure
+}
+
+func (e *AssertionError) Error() string {
+	parts := make([]string, len(e.Failures))
+	for i, f := range e.Failures {
+		parts[i] = f.String()
+	}
+	return fmt.Sprintf("%s: %d assertion(s) failed: %s", e.URL, len(e.Failures), strings.Join(parts, "; "))
+}
+
+// AssertionResult is reported to the hook set with WithAssertionHook for
+// every request that has an Expect, passed or not
+type AssertionResult struct {
+	URL        string
+	StatusCode int
+	Protocol   string
+	Duration   time.Duration // From sending the request to the checks being done
+	Failures   []AssertionFailure
+}
+
+// Passed reports whether every check held
+func (r AssertionResult) Passed() bool {
+	return len(r.Failures) == 0
+}
+
+// check runs the expectations against resp. The body is read only if a body
+// or JSON check needs it, and stays readable through Bytes, Text and JSON.
+func (e *Expect) check(resp *Response) []AssertionFailure {
+	var failures []AssertionFailure
+	fail := func(check, target, expected, actual string) {
+		failures = append(failures, AssertionFailure{Check: check, Target: target, Expected: expected, Actual: actual})
+	}
+
+	if len(e.Status) > 0 && !slices.Contains(e.Status, resp.StatusCode) {
+		fail("status", "", fmt.Sprint(e.Status), strconv.Itoa(resp.StatusCode))
+	}
+
+	for name, pattern := range e.Headers {
+		values := resp.GetHeaders(name)
+		if len(values) == 0 {
+			fail("header", name, "present", "missing")
+			continue
+		}
+		if pattern == "" {
+			continue
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			fail("header", name, "valid pattern "+strconv.Quote(pattern), err.Error())
+			continue
+		}
+		if !slices.ContainsFunc(values, re.MatchString) {
+			fail("header", name, "match "+strconv.Quote(pattern), strconv.Quote(strings.Join(values, ", ")))
+		}
+	}
+
+	if len(e.BodyContains) == 0 && len(e.JSON) == 0 {
+		return failures
+	}
+	body, err := resp.Bytes()
+	if err != nil {
+		fail("body", "", "readable body", err.Error())
+		return failures
+	}
+	for _, sub := range e.BodyContains {
+		if !bytes.Contains(body, []byte(sub)) {
+			fail("body", strconv.Quote(sub), "contained", "absent")
+		}
+	}
+
+	if len(e.JSON) == 0 {
+		return failures
+	}
+	var doc any
+	if err := json.Unmarshal(body, &doc); err != nil {
+		fail("json", "$", "JSON body", err.Error())
+		return failures
+	}
+	for path, want := range e.JSON {
+		got, err := jsonPath(doc, path)
+		if err != nil {
+			fail("json", path, "present", err.Error())
+			continue
+		}
+		if want == nil {
+			continue
+		}
+		if !jsonEqual(got, want) {
+			fail("json", path, jsonString(want), jsonString(got))
+		}
+	}
+	return failures
+}
+
+// jsonPath looks up path ("$.a.b[0]") in a decoded JSON document
+func jsonPath(doc any, path string) (any, error) {
+	rest, ok := strings.CutPrefix(path, "$")
+	if !ok {
+		return nil, fmt.Errorf("path must start with $")
+	}
+	cur := doc
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			key := rest[:end]
+			rest = rest[end:]
+			obj, ok := cur.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("%s is not an object", key)
+			}
+			if cur, ok = obj[key]; !ok {
+				return nil, fmt.Errorf("no key %q", key)
+			}
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed [")
+			}
+			i, err := strconv.Atoi(rest[1:end])
+			if err != nil {
+				return nil, fmt.Errorf("bad index %q", rest[1:end])
+			}
+			rest = rest[end+1:]
+			arr, ok := cur.([]any)
+			if !ok {
+				return nil, fmt.Errorf("[%d] on a non-array", i)
+			}
+			if i < 0 || i >= len(arr) {
+				return nil, fmt.Errorf("index %d out of %d", i, len(arr))
+			}
+			cur = arr[i]
+		default:
+			return nil, fmt.Errorf("unexpected %q", rest)
+		}
+	}
+	return cur, nil
+}
+
+// jsonEqual compares a decoded JSON value with an expected Go value by
+// putting the latter through JSON too, so 1 equals 1.0
+func jsonEqual(got, want any) bool {
+	data, err := json.Marshal(want)
+	if err != nil {
+		return false
+	}
+	var norm any
+	if err := json.Unmarshal(data, &norm); err != nil {
+		return false
+	}
+	return reflect.DeepEqual(got, norm)
+}
+
+func jsonString(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
+
+// checkExpect checks resp against req.Expect, reports the result to the
+// assertion hook and returns the failures as an *AssertionError
+func (c *Client) checkExpect(req *Request, resp *Response, start time.Time) error {
+	failures := req.Expect.check(resp)
+	if c.config.OnAssertion != nil {
+		c.config.OnAssertion(AssertionResult{
+			URL:        resp.FinalURL,
+			StatusCode: resp.StatusCode,
+			Protocol:   resp.Protocol,
+			Duration:   time.Since(start),
+			Failures:   failures,
+		})
+	}
+	if len(failures) == 0 {
+		return nil
+	}
+	return &AssertionError{URL: resp.FinalURL, StatusCode: resp.StatusCode, Failures: failures}
+}
@@ -4,16 +4,23 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
 	"strings"
 	"sync/atomic"
 	"testing"
 	"time"
 
 	customhttp "github.com/sardanioss/http"
+	"github.com/sardanioss/httpcloak/protocol"
 )
 
 // TestURLBuilder tests URL building and params encoding
@@ -333,6 +340,610 @@ func TestResponseHelpers(t *testing.T) {
 	}
 }
 
+// TestResponseJSONOptions tests JSON decoding options and streaming
+func TestResponseJSONOptions(t *testing.T) {
+	newResp := func(body string) *Response {
+		return &Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader(body))}
+	}
+
+	var data map[string]interface{}
+	if err := newResp(`{"id": 9007199254740993}`).JSON(&data, JSONUseNumber()); err != nil {
+		t.Fatalf("JSON decode failed: %v", err)
+	}
+	if n, ok := data["id"].(json.Number); !ok || n.String() != "9007199254740993" {
+		t.Errorf("Expected json.Number 9007199254740993, got %#v", data["id"])
+	}
+
+	var strict struct {
+		Name string `json:"name"`
+	}
+	if err := newResp(`{"name": "a", "extra": 1}`).JSON(&strict, JSONDisallowUnknownFields()); err == nil {
+		t.Error("Expected unknown field error")
+	}
+	if err := newResp(`{"name": "a"} {}`).JSON(&strict); err == nil {
+		t.Error("Expected error for data after the top-level value")
+	}
+
+	resp := newResp(`[{"name": "a"}, {"name": "b"}]`)
+	dec := resp.JSONStream()
+	if _, err := dec.Token(); err != nil {
+		t.Fatalf("Token failed: %v", err)
+	}
+	var names []string
+	for dec.More() {
+		if err := dec.Decode(&strict); err != nil {
+			t.Fatalf("Decode failed: %v", err)
+		}
+		names = append(names, strict.Name)
+	}
+	if len(names) != 2 || names[1] != "b" {
+		t.Errorf("Expected [a b], got %v", names)
+	}
+	if _, err := resp.Bytes(); err != ErrBodyConsumed {
+		t.Errorf("Expected ErrBodyConsumed after JSONStream, got %v", err)
+	}
+}
+
+// TestResponseXMLCharset tests XML and text decoding of non-UTF-8 bodies
+func TestResponseXMLCharset(t *testing.T) {
+	newResp := func(body []byte, contentType string) *Response {
+		return &Response{
+			StatusCode: 200,
+			Headers:    map[string][]string{"content-type": {contentType}},
+			Body:       io.NopCloser(bytes.NewReader(body)),
+		}
+	}
+	var doc struct {
+		Name string `xml:"name"`
+	}
+
+	// Encoding from the XML declaration (0xe9 is é in ISO-8859-1)
+	latin1 := []byte("<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?><doc><name>Ren\xe9</name></doc>")
+	if err := newResp(latin1, "text/xml").XML(&doc); err != nil {
+		t.Fatalf("XML decode failed: %v", err)
+	}
+	if doc.Name != "René" {
+		t.Errorf("Expected René, got %q", doc.Name)
+	}
+
+	// Content-Type charset overrides the declaration
+	doc.Name = ""
+	declUTF8 := []byte("<?xml version=\"1.0\" encoding=\"UTF-8\"?><doc><name>Ren\xe9</name></doc>")
+	if err := newResp(declUTF8, "application/xml; charset=iso-8859-1").XML(&doc); err != nil {
+		t.Fatalf("XML decode failed: %v", err)
+	}
+	if doc.Name != "René" {
+		t.Errorf("Expected René, got %q", doc.Name)
+	}
+
+	// UTF-16LE with BOM
+	doc.Name = ""
+	var utf16 []byte
+	utf16 = append(utf16, 0xff, 0xfe)
+	for _, r := range `<?xml version="1.0" encoding="UTF-16"?><doc><name>é</name></doc>` {
+		utf16 = append(utf16, byte(r), byte(r>>8))
+	}
+	if err := newResp(utf16, "text/xml").XML(&doc); err != nil {
+		t.Fatalf("XML decode failed: %v", err)
+	}
+	if doc.Name != "é" {
+		t.Errorf("Expected é, got %q", doc.Name)
+	}
+
+	// HTML meta charset
+	html := []byte("<html><head><meta charset=\"windows-1252\"></head><body>\x93hi\x94</body></html>")
+	text, err := newResp(html, "text/html").DecodedText()
+	if err != nil {
+		t.Fatalf("DecodedText failed: %v", err)
+	}
+	if !strings.Contains(text, "\u201chi\u201d") {
+		t.Errorf("Expected curly quotes, got %q", text)
+	}
+}
+
+// TestConditionalValidators tests validator tracking for Request.Conditional
+func TestConditionalValidators(t *testing.T) {
+	c := &Client{}
+	const u = "https://example.com/feed"
+
+	resp := &customhttp.Response{StatusCode: 200, Header: customhttp.Header{}}
+	resp.Header.Set("ETag", `"v1"`)
+	resp.Header.Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+	c.storeValidators(u, resp)
+
+	req, _ := customhttp.NewRequest("GET", u, nil)
+	c.applyValidators(req, u)
+	if got := req.Header.Get("If-None-Match"); got != `"v1"` {
+		t.Errorf("If-None-Match = %q, want \"v1\"", got)
+	}
+	if got := req.Header.Get("If-Modified-Since"); got != "Mon, 02 Jan 2006 15:04:05 GMT" {
+		t.Errorf("If-Modified-Since = %q", got)
+	}
+
+	// Caller-supplied validators win
+	req, _ = customhttp.NewRequest("GET", u, nil)
+	req.Header.Set("If-None-Match", `"mine"`)
+	c.applyValidators(req, u)
+	if got := req.Header.Get("If-None-Match"); got != `"mine"` {
+		t.Errorf("If-None-Match = %q, want caller's value", got)
+	}
+
+	// Non-2xx responses don't replace validators
+	errResp := &customhttp.Response{StatusCode: 500, Header: customhttp.Header{}}
+	errResp.Header.Set("ETag", `"err"`)
+	c.storeValidators(u, errResp)
+	if etag, _ := c.Validators(u); etag != `"v1"` {
+		t.Errorf("Validators() etag = %q after 500, want \"v1\"", etag)
+	}
+
+	// POST is never conditional
+	req, _ = customhttp.NewRequest("POST", u, nil)
+	c.applyValidators(req, u)
+	if req.Header.Get("If-None-Match") != "" {
+		t.Error("POST got If-None-Match")
+	}
+
+	c.ClearValidators()
+	if etag, lm := c.Validators(u); etag != "" || lm != "" {
+		t.Errorf("Validators() after ClearValidators = %q, %q", etag, lm)
+	}
+}
+
+// TestProxyPoolRotation tests proxy rotation, stickiness and ejection
+func TestProxyPoolRotation(t *testing.T) {
+	newPool := func(policy RotationPolicy) *proxyPool {
+		return &proxyPool{
+			policy: policy,
+			sticky: make(map[string]*proxyRoute),
+			routes: []*proxyRoute{
+				{url: "http://user:secret@a:8080"},
+				{url: "http://b:8080"},
+				{url: "http://c:8080"},
+			},
+		}
+	}
+
+	p := newPool(RotatePerRequest)
+	var got []string
+	for i := 0; i < 4; i++ {
+		got = append(got, p.pick("example.com:443").url)
+	}
+	if got[0] == got[1] || got[1] == got[2] || got[0] != got[3] {
+		t.Errorf("per-request rotation = %v, want round-robin", got)
+	}
+
+	// Three failures in a row eject a proxy
+	a := p.routes[0]
+	for i := 0; i < proxyEjectAfter; i++ {
+		p.report(context.Background(), a, fmt.Errorf("dial failed"))
+	}
+	for i := 0; i < 6; i++ {
+		if r := p.pick("example.com:443"); r == a {
+			t.Fatal("ejected proxy was picked")
+		}
+	}
+	stats := p.stats()
+	if !stats[0].Ejected || stats[0].Failures != proxyEjectAfter {
+		t.Errorf("stats[0] = %+v, want ejected with %d failures", stats[0], proxyEjectAfter)
+	}
+	if strings.Contains(stats[0].URL, "secret") {
+		t.Errorf("stats URL leaks password: %s", stats[0].URL)
+	}
+
+	// Canceled and timed-out requests aren't proxy failures
+	b := p.routes[1]
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for i := 0; i < proxyEjectAfter; i++ {
+		p.report(context.Background(), b, context.DeadlineExceeded)
+		p.report(context.Background(), b, fmt.Errorf("request failed: %w", context.Canceled))
+		p.report(ctx, b, fmt.Errorf("read: connection reset"))
+	}
+	if stats := p.stats(); stats[1].Ejected || stats[1].Failures != 0 {
+		t.Errorf("stats[1] = %+v, want no failures after canceled requests", stats[1])
+	}
+
+	// Per-connection keeps a host on one proxy until it is ejected
+	p = newPool(RotatePerConnection)
+	first := p.pick("example.com:443")
+	if other := p.pick("other.com:443"); other == first {
+		t.Error("second host should get the next proxy")
+	}
+	if again := p.pick("example.com:443"); again != first {
+		t.Errorf("host moved from %s to %s", first.url, again.url)
+	}
+	for i := 0; i < proxyEjectAfter; i++ {
+		p.report(context.Background(), first, fmt.Errorf("reset"))
+	}
+	if moved := p.pick("example.com:443"); moved == first {
+		t.Error("host stayed on an ejected proxy")
+	}
+
+	// With every proxy ejected, the pool still returns one
+	for _, r := range p.routes {
+		r.ejectedUntil = time.Now().Add(time.Minute)
+	}
+	if p.pick("example.com:443") == nil {
+		t.Error("pick returned nil with all proxies ejected")
+	}
+}
+
+// TestClockSkew tests skew estimation from Date headers
+func TestClockSkew(t *testing.T) {
+	local := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	c := &Client{clock: clockTracker{source: func() time.Time { return local }}}
+
+	if _, ok := c.ClockSkew("https://api.example.com/v1"); ok {
+		t.Error("skew reported before any response")
+	}
+	if got := c.Now("https://api.example.com/v1"); !got.Equal(local) {
+		t.Errorf("Now() = %v, want clock source %v", got, local)
+	}
+
+	// Server is 90s ahead
+	resp := &customhttp.Response{Header: customhttp.Header{}}
+	resp.Header.Set("Date", local.Add(90*time.Second).Format(customhttp.TimeFormat))
+	c.clock.observe("https://api.example.com", resp, local)
+
+	skew, ok := c.ClockSkew("https://api.example.com/other?x=1")
+	if !ok || skew.Samples != 1 {
+		t.Fatalf("ClockSkew = %+v, %v", skew, ok)
+	}
+	if skew.Offset < 90*time.Second || skew.Offset > 91*time.Second {
+		t.Errorf("Offset = %v, want ~90s", skew.Offset)
+	}
+	if got := c.Now("https://api.example.com/"); got.Sub(local) != skew.Offset {
+		t.Errorf("Now() not corrected: %v", got.Sub(local))
+	}
+	if got := c.Now("https://other.example.com/"); !got.Equal(local) {
+		t.Error("skew applied to a different origin")
+	}
+
+	// Missing or malformed Date is ignored
+	bad := &customhttp.Response{Header: customhttp.Header{}}
+	bad.Header.Set("Date", "yesterday")
+	c.clock.observe("https://api.example.com", bad, local)
+	if skew, _ := c.ClockSkew("https://api.example.com"); skew.Samples != 1 {
+		t.Errorf("Samples = %d after bad Date, want 1", skew.Samples)
+	}
+}
+
+// TestCircuitBreaker tests the closed/open/half-open cycle of one circuit
+func TestCircuitBreaker(t *testing.T) {
+	var events []string
+	b := newCircuitBreaker(CircuitBreakerConfig{
+		FailureThreshold: 2,
+		OpenFor:          20 * time.Millisecond,
+		FailureStatuses:  []int{403},
+		OnEvent: func(e CircuitEvent) {
+			events = append(events, e.From.String()+">"+e.To.String())
+		},
+	})
+	const origin = "https://example.com:443"
+
+	fail := func() {
+		call, err := b.allow(origin, "")
+		if err != nil {
+			t.Fatalf("allow: %v", err)
+		}
+		call.done(403, nil)
+	}
+
+	fail()
+	// A success resets the count
+	call, _ := b.allow(origin, "")
+	call.done(200, nil)
+	fail()
+	if _, err := b.allow(origin, "http://other:8080"); err != nil {
+		t.Errorf("other proxy shares the circuit: %v", err)
+	}
+	fail()
+
+	if _, err := b.allow(origin, ""); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("after threshold: err = %v, want ErrCircuitOpen", err)
+	}
+
+	// A cancelled probe frees its slot without closing the circuit
+	time.Sleep(25 * time.Millisecond)
+	probe, err := b.allow(origin, "")
+	if err != nil {
+		t.Fatalf("half-open probe rejected: %v", err)
+	}
+	if _, err := b.allow(origin, ""); !errors.Is(err, ErrCircuitOpen) {
+		t.Error("second concurrent probe admitted")
+	}
+	probe.done(0, context.Canceled)
+
+	probe, err = b.allow(origin, "")
+	if err != nil {
+		t.Fatalf("probe after cancel rejected: %v", err)
+	}
+	probe.done(200, nil)
+	probe.done(403, nil) // Only the first outcome counts
+
+	want := []string{"closed>open", "open>half-open", "half-open>closed"}
+	if strings.Join(events, ",") != strings.Join(want, ",") {
+		t.Errorf("events = %v, want %v", events, want)
+	}
+	for _, st := range b.status() {
+		if st.Origin == origin && st.Proxy == "" && st.State != CircuitClosed {
+			t.Errorf("final state = %s, want closed", st.State)
+		}
+	}
+}
+
+// TestSlowRequestLog tests threshold filtering and latency attribution
+func TestSlowRequestLog(t *testing.T) {
+	var got []SlowRequest
+	c := &Client{slowLog: &slowRequestLog{threshold: 50 * time.Millisecond, fn: func(r SlowRequest) {
+		got = append(got, r)
+	}}}
+
+	// Fast requests are not reported
+	c.traceSlowRequest(time.Now(), "GET", "https://example.com/", &protocol.Timing{}).report("h2", 200, nil)
+	if len(got) != 0 {
+		t.Fatalf("fast request reported: %+v", got)
+	}
+
+	timing := &protocol.Timing{DNSLookup: 5, TCPConnect: 10, TLSHandshake: 15, FirstByte: 100}
+	trace := c.traceSlowRequest(time.Now().Add(-200*time.Millisecond), "GET", "https://example.com/slow", timing)
+	trace.body = 20 * time.Millisecond
+	trace.report("h2", 200, nil)
+	trace.report("h2", 200, nil) // Reported once
+
+	if len(got) != 1 {
+		t.Fatalf("got %d records, want 1", len(got))
+	}
+	r := got[0]
+	if r.Cause != "server" || r.Server != 100*time.Millisecond || r.Body != 20*time.Millisecond {
+		t.Errorf("record = %+v, want cause server", r)
+	}
+	if sum := r.DNS + r.Connect + r.TLS + r.Queue + r.Server + r.Body; sum != r.Total {
+		t.Errorf("phases sum to %v, total %v", sum, r.Total)
+	}
+	if line := r.String(); !strings.HasPrefix(line, "slow_request method=GET") || !strings.Contains(line, "cause=server") {
+		t.Errorf("String() = %q", line)
+	}
+}
+
+// TestCookieHeaderLimit tests that an oversized Cookie header sheds Low
+// priority cookies first instead of going out too large
+func TestRaceWinners(t *testing.T) {
+	var w raceWinners
+	if _, ok := w.get("example.com:443"); ok {
+		t.Fatal("winner remembered before any race")
+	}
+	w.set("example.com:443", "h3")
+	if proto, ok := w.get("example.com:443"); !ok || proto != "h3" {
+		t.Errorf("winner = %q, %v", proto, ok)
+	}
+	w.winners["example.com:443"] = raceWinner{protocol: "h3", expires: time.Now().Add(-time.Second)}
+	if _, ok := w.get("example.com:443"); ok {
+		t.Error("expired winner still used")
+	}
+	w.set("example.org:443", "h2")
+	w.forget("example.org:443")
+	if _, ok := w.get("example.org:443"); ok {
+		t.Error("forgotten winner still used")
+	}
+}
+
+func TestCookieHeaderLimit(t *testing.T) {
+	u, _ := url.Parse("https://example.com/")
+	jar := NewCookieJar()
+	big := strings.Repeat("v", 3000)
+	jar.SetCookiesFromHeaderList(u, []string{
+		"sid=" + big + "; Secure; Priority=High",
+		"ads=" + big + "; Priority=Low",
+		"prefs=" + big,
+	})
+
+	header := jar.CookieHeader(u)
+	if len(header) > 8182 {
+		t.Fatalf("Cookie header is %d bytes", len(header))
+	}
+	if strings.Contains(header, "ads=") || !strings.Contains(header, "sid=") || !strings.Contains(header, "prefs=") {
+		t.Errorf("wrong cookies dropped: %.40q...", header)
+	}
+
+	jar.SetMaxHeaderBytes(0)
+	if !strings.Contains(jar.CookieHeader(u), "ads=") {
+		t.Error("limit 0 should keep every cookie")
+	}
+}
+
+// TestMultipartBrowserFormat tests boundary formats, part order and
+// streaming of disk files
+func TestMultipartBrowserFormat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "photo.png")
+	if err := os.WriteFile(path, bytes.Repeat([]byte{0x89}, 5000), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	form := NewFormData()
+	form.AddField("z", "last-name-first")
+	form.AddField(`we"ird`, "v")
+	if err := form.AddFilePath("upload", path); err != nil {
+		t.Fatal(err)
+	}
+	form.AddField("a", "after file")
+
+	if !regexp.MustCompile(`^----WebKitFormBoundary[A-Za-z0-9]{16}$`).MatchString(form.Boundary()) {
+		t.Errorf("WebKit boundary = %q", form.Boundary())
+	}
+	gecko := &FormData{Style: BoundaryGecko}
+	if !regexp.MustCompile(`^----geckoformboundary[0-9a-f]{32}$`).MatchString(gecko.Boundary()) {
+		t.Errorf("Gecko boundary = %q", gecko.Boundary())
+	}
+	if BoundaryStyleFor("firefox-147") != BoundaryGecko || BoundaryStyleFor("safari-18") != BoundaryWebKit {
+		t.Error("BoundaryStyleFor picked the wrong style")
+	}
+
+	body, size := form.Reader()
+	data, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != int64(len(data)) {
+		t.Errorf("Reader size = %d, body is %d bytes", size, len(data))
+	}
+	if !bytes.Contains(data, []byte(`name="we%22ird"`)) {
+		t.Error("quote in field name should be percent-encoded")
+	}
+
+	mr := multipart.NewReader(bytes.NewReader(data), form.Boundary())
+	var names []string
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, part.FormName())
+		if part.FileName() == "photo.png" {
+			content, _ := io.ReadAll(part)
+			if len(content) != 5000 || part.Header.Get("Content-Type") != "image/png" {
+				t.Errorf("file part: %d bytes, %s", len(content), part.Header.Get("Content-Type"))
+			}
+		}
+	}
+	if strings.Join(names, ",") != `z,we%22ird,upload,a` {
+		t.Errorf("part order = %v", names)
+	}
+
+	// A file gone before the post fails it rather than sending a short body
+	form = NewFormData()
+	if err := form.AddFilePath("upload", path); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(path)
+	c := NewClient("chrome-144")
+	defer c.Close()
+	if _, err := c.PostMultipart(context.Background(), "https://127.0.0.1:1/", form, nil); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("PostMultipart with a missing file: %v", err)
+	}
+}
+
+// TestDownloadRanges tests Content-Range parsing and range planning
+func TestDownloadRanges(t *testing.T) {
+	tests := []struct {
+		header            string
+		start, end, total int64
+		ok                bool
+	}{
+		{"bytes 0-99/1000", 0, 99, 1000, true},
+		{"bytes 500-999/*", 500, 999, -1, true},
+		{"bytes */0", -1, -1, 0, true},
+		{"bytes 100-50/1000", 0, 0, 0, false},
+		{"bytes 0-1000/1000", 0, 0, 0, false},
+		{"items 0-1/2", 0, 0, 0, false},
+	}
+	for _, tt := range tests {
+		start, end, total, ok := parseContentRange(tt.header)
+		if ok != tt.ok || (ok && (start != tt.start || end != tt.end || total != tt.total)) {
+			t.Errorf("parseContentRange(%q) = %d, %d, %d, %v", tt.header, start, end, total, ok)
+		}
+	}
+
+	d := &downloader{
+		opts:  DownloadOptions{Parallel: 4, MinChunkSize: 10},
+		state: &downloadState{Size: 35, Ranges: []*downloadRange{{End: 34}}},
+	}
+	d.split()
+	if len(d.state.Ranges) != 3 {
+		t.Fatalf("split into %d ranges, want 3 (MinChunkSize caps it)", len(d.state.Ranges))
+	}
+	next := int64(0)
+	for _, r := range d.state.Ranges {
+		if r.Start != next || r.Next != r.Start || r.End < r.Start {
+			t.Errorf("range %+v does not follow byte %d", *r, next)
+		}
+		next = r.End + 1
+	}
+	if next != 35 || d.state.downloaded() != 0 {
+		t.Errorf("ranges end at %d, want 35", next)
+	}
+
+	// Resuming sends If-Range with a strong ETag, else Last-Modified
+	d.state.ETag, d.state.LastModified = `W/"v1"`, "Wed, 01 Jan 2025 00:00:00 GMT"
+	d.state.Ranges[1].Next = 20
+	req := d.request(d.state.Ranges[1])
+	if got := req.Headers["Range"]; len(got) != 1 || got[0] != "bytes=20-22" {
+		t.Errorf("Range = %v, want bytes=20-22", got)
+	}
+	if got := req.Headers["If-Range"]; len(got) != 1 || got[0] != d.state.LastModified {
+		t.Errorf("If-Range = %v, want Last-Modified for a weak ETag", got)
+	}
+}
+
+// TestRetryPolicy tests Retry-After parsing and idempotency checks
+func TestRetryPolicy(t *testing.T) {
+	config := DefaultConfig()
+	WithRetryPolicy(RetryPolicy{MaxRetries: 2, MaxRetryAfter: 30 * time.Second})(config)
+	if !config.RetryEnabled || config.MaxRetries != 2 || config.RetryWaitMin != time.Second {
+		t.Fatalf("policy not applied: enabled=%v max=%d waitMin=%v", config.RetryEnabled, config.MaxRetries, config.RetryWaitMin)
+	}
+	c := &Client{config: config}
+
+	date := "Wed, 01 Jan 2025 00:00:00 GMT"
+	tests := []struct {
+		retryAfter string
+		want       time.Duration
+		ok         bool
+	}{
+		{"", 0, true},
+		{"5", 5 * time.Second, true},
+		{"120", 120 * time.Second, false},
+		{"Wed, 01 Jan 2025 00:00:10 GMT", 10 * time.Second, true}, // Against Date, not the local clock
+		{"Tue, 31 Dec 2024 23:59:00 GMT", 0, true},
+		{"soon", 0, true},
+	}
+	for _, tt := range tests {
+		resp := &Response{Headers: map[string][]string{"date": {date}}}
+		if tt.retryAfter != "" {
+			resp.Headers["retry-after"] = []string{tt.retryAfter}
+		}
+		got, ok := c.retryAfter(resp)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("retryAfter(%q) = %v, %v, want %v, %v", tt.retryAfter, got, ok, tt.want, tt.ok)
+		}
+	}
+
+	for method, want := range map[string]bool{"GET": true, "put": true, "DELETE": true, "POST": false, "PATCH": false} {
+		if got := isIdempotent(&Request{Method: method}); got != want {
+			t.Errorf("isIdempotent(%s) = %v, want %v", method, got, want)
+		}
+	}
+	keyed := &Request{Method: "POST", Headers: map[string][]string{"Idempotency-Key": {"abc"}}}
+	if !isIdempotent(keyed) {
+		t.Error("POST with Idempotency-Key should be idempotent")
+	}
+
+	if !notProcessed(&Response{StatusCode: 429}) {
+		t.Error("429 should count as not processed")
+	}
+	if notProcessed(&Response{StatusCode: 503}) {
+		t.Error("503 without Retry-After may have been processed")
+	}
+	if !notProcessed(&Response{StatusCode: 503, Headers: map[string][]string{"retry-after": {"1"}}}) {
+		t.Error("503 with Retry-After should count as not processed")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if !retryableError(ctx, errors.New("read tcp: connection reset by peer")) {
+		t.Error("connection reset should be retryable")
+	}
+	if retryableError(ctx, errors.New("invalid URL")) {
+		t.Error("invalid URL should not be retryable")
+	}
+	cancel()
+	if retryableError(ctx, errors.New("connection reset by peer")) {
+		t.Error("nothing is retryable once the context is cancelled")
+	}
+}
+
 // TestRetryLogic tests retry wait calculation
 func TestRetryLogic(t *testing.T) {
 	config := DefaultConfig()
@@ -343,9 +954,9 @@ func TestRetryLogic(t *testing.T) {
 	client := &Client{config: config}
 
 	// Test exponential backoff
-	wait1 := client.calculateRetryWait(1)
-	wait2 := client.calculateRetryWait(2)
-	wait3 := client.calculateRetryWait(3)
+	wait1 := client.calculateRetryWait(context.Background(), 1)
+	wait2 := client.calculateRetryWait(context.Background(), 2)
+	wait3 := client.calculateRetryWait(context.Background(), 3)
 
 	// wait2 should be roughly 2x wait1 (with jitter)
 	if wait2 < wait1 {
@@ -485,6 +1096,90 @@ func TestRedirectDetection(t *testing.T) {
 	}
 }
 
+// TestRedirectCredentials checks that credentials stay with their origin
+// across redirects, and stay dropped once the chain has left it
+func TestRedirectCredentials(t *testing.T) {
+	req := &Request{
+		Method:  "GET",
+		URL:     "https://a.example/start",
+		Headers: map[string][]string{"Authorization": {"Bearer t"}, "Cookie": {"k=v"}, "X-Key": {"k"}, "X-Trace": {"1"}},
+		Auth:    NewBearerAuth("t"),
+	}
+	httpReq, _ := customhttp.NewRequest("GET", req.URL, nil)
+	resp := &customhttp.Response{StatusCode: 302, Header: customhttp.Header{}}
+
+	same := newRedirectRequest(req, httpReq, resp, req.URL, "https://a.example/next", nil, RedirectMethodsBrowser, redirectCredentials{})
+	if same.Auth == nil || same.Headers["Authorization"] == nil {
+		t.Error("same-origin redirect dropped credentials")
+	}
+
+	cross := newRedirectRequest(req, httpReq, resp, req.URL, "https://b.example/", nil, RedirectMethodsBrowser, redirectCredentials{extra: []string{"x-key"}})
+	if cross.Auth != nil || cross.Headers["Authorization"] != nil || cross.Headers["Cookie"] != nil || cross.Headers["X-Key"] != nil {
+		t.Errorf("cross-origin redirect kept credentials: %v", cross.Headers)
+	}
+	if cross.Headers["X-Trace"] == nil {
+		t.Error("cross-origin redirect dropped other headers")
+	}
+
+	httpReq2, _ := customhttp.NewRequest("GET", cross.URL, nil)
+	back := newRedirectRequest(cross, httpReq2, resp, cross.URL, "https://a.example/back", nil, RedirectMethodsBrowser, redirectCredentials{})
+	if !back.redirect.dropCredentials {
+		t.Error("chain forgot it left the origin")
+	}
+
+	trusted := newRedirectRequest(req, httpReq, resp, req.URL, "https://b.example/", nil, RedirectMethodsBrowser, redirectCredentials{keep: true})
+	if trusted.Auth == nil || trusted.Headers["Authorization"] == nil {
+		t.Error("trusted redirect dropped credentials")
+	}
+}
+
+// TestExpect checks response assertions, reading the body only when needed
+func TestExpect(t *testing.T) {
+	newResp := func() *Response {
+		return &Response{
+			StatusCode: 200,
+			Headers:    map[string][]string{"content-type": {"application/json; charset=utf-8"}},
+			Body:       io.NopCloser(strings.NewReader(`{"status":"ok","data":{"items":[{"id":7}]}}`)),
+		}
+	}
+
+	pass := &Expect{
+		Status:       []int{200, 204},
+		Headers:      map[string]string{"Content-Type": "^application/json"},
+		BodyContains: []string{`"ok"`},
+		JSON:         map[string]any{"$.status": "ok", "$.data.items[0].id": 7, "$.data": nil},
+	}
+	resp := newResp()
+	if failures := pass.check(resp); len(failures) != 0 {
+		t.Errorf("unexpected failures: %v", failures)
+	}
+	if text, _ := resp.Text(); !strings.Contains(text, "items") {
+		t.Error("body not readable after the checks")
+	}
+
+	fail := &Expect{
+		Status:       []int{201},
+		Headers:      map[string]string{"X-Missing": "", "Content-Type": "xml"},
+		BodyContains: []string{"nope"},
+		JSON:         map[string]any{"$.status": "down", "$.data.items[3]": nil},
+	}
+	failures := fail.check(newResp())
+	checks := map[string]int{}
+	for _, f := range failures {
+		checks[f.Check]++
+	}
+	if checks["status"] != 1 || checks["header"] != 2 || checks["body"] != 1 || checks["json"] != 2 {
+		t.Errorf("failures = %v", failures)
+	}
+
+	headersOnly := &Expect{Status: []int{200}}
+	resp = newResp()
+	headersOnly.check(resp)
+	if resp.bodyRead {
+		t.Error("status check read the body")
+	}
+}
+
 // Integration test with mock server (tests actual HTTP flow)
 func TestIntegrationWithMockServer(t *testing.T) {
 	// Skip if running short tests
@@ -0,0 +1,102 @@
+package client
+
+import (
+	"strings"
+
+	"github.com/sardanioss/httpcloak/fingerprint"
+	"github.com/sardanioss/httpcloak/protocol"
+)
+
+// resolvePreset looks up a preset and applies the config's TLS, HTTP/2 and
+// HTTP/3 overrides to it
+func (c *ClientConfig) resolvePreset(name string) *fingerprint.Preset {
+	preset := fingerprint.Get(name)
+	if c.CustomTLSSpec != nil {
+		preset.CustomClientHelloSpec = c.CustomTLSSpec
+		// The caller's ClientHello is sent as given
+		preset.SignatureAlgorithms = &fingerprint.SignatureAlgorithmRules{Keep: true}
+	}
+	if c.H2Fingerprint != nil {
+		applyH2Fingerprint(&preset.HTTP2Settings, c.H2Fingerprint)
+	}
+	if c.H3Settings != nil {
+		preset.HTTP3Settings = c.H3Settings
+	}
+	if c.AcceptLanguage != "" {
+		applyAcceptLanguage(preset, c.AcceptLanguage)
+	}
+	return preset
+}
+
+// applyH2Fingerprint replaces the preset's connection preface with fp
+func applyH2Fingerprint(s *fingerprint.HTTP2Settings, fp *protocol.H2Fingerprint) {
+	if len(fp.Settings) > 0 {
+		applyH2Settings(s, fp.Settings)
+	}
+	s.ConnectionWindowUpdate = fp.WindowUpdate
+
+	s.PriorityFrames = make([]fingerprint.H2PriorityFrame, len(fp.Priorities))
+	for i, p := range fp.Priorities {
+		s.PriorityFrames[i] = fingerprint.H2PriorityFrame{
+			StreamID:  p.StreamID,
+			StreamDep: p.DependsOn,
+			Exclusive: p.Exclusive,
+			Weight:    p.Weight,
+		}
+	}
+
+	if len(fp.PseudoHeaderOrder) > 0 {
+		s.PseudoHeaderOrder = fp.PseudoHeaderOrder
+	}
+}
+
+// applyH2Settings makes the SETTINGS frame carry exactly settings. Named
+// fields are updated too, since the HTTP/2 layer also uses them as its local
+// limits (frame size, header table size).
+func applyH2Settings(s *fingerprint.HTTP2Settings, settings []protocol.H2Setting) {
+	order := make([]uint16, 0, len(settings))
+	values := make(map[uint16]uint32, len(settings))
+	for _, setting := range settings {
+		order = append(order, setting.ID)
+		values[setting.ID] = setting.Value
+
+		switch setting.ID {
+		case fingerprint.H2SettingHeaderTableSize:
+			s.HeaderTableSize = setting.Value
+		case fingerprint.H2SettingEnablePush:
+			s.EnablePush = setting.Value != 0
+		case fingerprint.H2SettingMaxConcurrentStreams:
+			s.MaxConcurrentStreams = setting.Value
+		case fingerprint.H2SettingInitialWindowSize:
+			s.InitialWindowSize = setting.Value
+		case fingerprint.H2SettingMaxFrameSize:
+			s.MaxFrameSize = setting.Value
+		case fingerprint.H2SettingMaxHeaderListSize:
+			s.MaxHeaderListSize = setting.Value
+		}
+	}
+	s.SettingsOrder = order
+	s.SettingsValues = values
+}
+
+// applyAcceptLanguage swaps the preset's Accept-Language value, keeping
+// its position in the header order
+func applyAcceptLanguage(preset *fingerprint.Preset, value string) {
+	order := make([]fingerprint.HeaderPair, len(preset.HeaderOrder))
+	for i, h := range preset.HeaderOrder {
+		if strings.EqualFold(h.Key, "accept-language") {
+			h.Value = value
+		}
+		order[i] = h
+	}
+	preset.HeaderOrder = order
+
+	headers := make(map[string]string, len(preset.Headers))
+	for k, v := range preset.Headers {
+		if strings.EqualFold(k, "accept-language") {
+			v = value
+		}
+		headers[k] = v
+	}
+	preset.Headers = headers
+}
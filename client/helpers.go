@@ -16,6 +16,7 @@ import (
 	"github.com/klauspost/compress/zstd"
 	"github.com/sardanioss/httpcloak/fingerprint"
 	"github.com/sardanioss/httpcloak/protocol"
+	"github.com/sardanioss/httpcloak/transport"
 )
 
 // extractHost extracts the hostname from a URL string
@@ -116,7 +117,9 @@ func processResponse(resp *http.Response, originalURL string, startTime time.Tim
 	for key, values := range resp.Header {
 		lowerKey := strings.ToLower(key)
 		headerValues := make([]string, len(values))
-		copy(headerValues, values)
+		for i, v := range values {
+			headerValues[i] = transport.NormalizeHeaderValue(v)
+		}
 		headers[lowerKey] = headerValues
 	}
 
@@ -2,8 +2,6 @@ package client
 
 import (
 	"bytes"
-	"compress/flate"
-	"compress/gzip"
 	"context"
 	"fmt"
 	"io"
@@ -12,11 +10,10 @@ import (
 	"strings"
 	"time"
 
-	"github.com/andybalholm/brotli"
-	"github.com/klauspost/compress/zstd"
 	"github.com/sardanioss/httpcloak/fingerprint"
 	"github.com/sardanioss/httpcloak/pool"
 	"github.com/sardanioss/httpcloak/protocol"
+	"github.com/sardanioss/httpcloak/transport"
 )
 
 // HTTP3Client is an HTTP/3 client with QUIC connection pooling
@@ -193,7 +190,7 @@ func (c *HTTP3Client) Do(ctx context.Context, req *Request) (*Response, error) {
 
 	// Decompress if needed
 	contentEncoding := resp.Header.Get("Content-Encoding")
-	body, err = decompressHTTP3(body, contentEncoding)
+	body, err = decompress(body, contentEncoding)
 	if err != nil {
 		return nil, fmt.Errorf("failed to decompress response: %w", err)
 	}
@@ -205,7 +202,9 @@ func (c *HTTP3Client) Do(ctx context.Context, req *Request) (*Response, error) {
 	for key, values := range resp.Header {
 		lowerKey := strings.ToLower(key)
 		headerValues := make([]string, len(values))
-		copy(headerValues, values)
+		for i, v := range values {
+			headerValues[i] = transport.NormalizeHeaderValue(v)
+		}
 		headers[lowerKey] = headerValues
 	}
 
@@ -252,44 +251,3 @@ func (c *HTTP3Client) Stats() map[string]struct {
 } {
 	return c.quicManager.Stats()
 }
-
-// decompressHTTP3 decompresses response body based on Content-Encoding
-func decompressHTTP3(data []byte, encoding string) ([]byte, error) {
-	switch strings.ToLower(encoding) {
-	case "br":
-		reader := brotli.NewReader(bytes.NewReader(data))
-		return io.ReadAll(reader)
-
-	case "gzip":
-		return decompressGzip(data)
-
-	case "zstd":
-		decoder, err := zstd.NewReader(bytes.NewReader(data))
-		if err != nil {
-			return nil, err
-		}
-		defer decoder.Close()
-		return io.ReadAll(decoder)
-
-	case "deflate":
-		reader := flate.NewReader(bytes.NewReader(data))
-		defer reader.Close()
-		return io.ReadAll(reader)
-
-	case "", "identity":
-		return data, nil
-
-	default:
-		return data, nil
-	}
-}
-
-// decompressGzip decompresses gzip data
-func decompressGzip(data []byte) ([]byte, error) {
-	reader, err := gzip.NewReader(bytes.NewReader(data))
-	if err != nil {
-		return nil, err
-	}
-	defer reader.Close()
-	return io.ReadAll(reader)
-}
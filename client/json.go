@@ -0,0 +1,85 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrBodyConsumed is returned by Bytes/Text after JSONStream handed the body
+// to a decoder.
+var ErrBodyConsumed = errors.New("response body already consumed by JSON decoding")
+
+// JSONOption configures how a response body is decoded as JSON
+type JSONOption func(*json.Decoder)
+
+// JSONUseNumber decodes numbers into json.Number instead of float64, so large
+// integer IDs and exact decimals survive decoding into interface{} values.
+func JSONUseNumber() JSONOption {
+	return func(d *json.Decoder) { d.UseNumber() }
+}
+
+// JSONDisallowUnknownFields fails decoding into a struct when the object has
+// a key with no matching field.
+func JSONDisallowUnknownFields() JSONOption {
+	return func(d *json.Decoder) { d.DisallowUnknownFields() }
+}
+
+// NewJSONDecoder returns a json.Decoder over r with opts applied
+func NewJSONDecoder(r io.Reader, opts ...JSONOption) *json.Decoder {
+	dec := json.NewDecoder(r)
+	for _, opt := range opts {
+		opt(dec)
+	}
+	return dec
+}
+
+// DecodeJSON decodes a single JSON value from r into v. Like json.Unmarshal,
+// anything but whitespace after the value is an error.
+func DecodeJSON(r io.Reader, v interface{}, opts ...JSONOption) error {
+	dec := NewJSONDecoder(r, opts...)
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return fmt.Errorf("invalid data after top-level JSON value")
+	}
+	return nil
+}
+
+// JSON decodes the response body as JSON into v. The body stays cached, so
+// Bytes and Text still work afterwards; use JSONStream to decode without
+// holding the raw body.
+func (r *Response) JSON(v interface{}, opts ...JSONOption) error {
+	data, err := r.Bytes()
+	if err != nil {
+		return err
+	}
+	return DecodeJSON(bytes.NewReader(data), v, opts...)
+}
+
+// JSONStream returns a decoder reading the body incrementally, for large
+// arrays or concatenated JSON values, without buffering the raw body. Bytes
+// and Text return ErrBodyConsumed afterwards. Close the response when done.
+func (r *Response) JSONStream(opts ...JSONOption) *json.Decoder {
+	if r.bodyRead || r.Body == nil {
+		return NewJSONDecoder(bytes.NewReader(r.bodyBytes), opts...)
+	}
+	r.bodyConsumed = true
+	return NewJSONDecoder(r.Body, opts...)
+}
+
+// JSON decodes the rest of the stream as a single JSON value into v and
+// closes the response.
+func (r *StreamResponse) JSON(v interface{}, opts ...JSONOption) error {
+	defer r.Close()
+	return DecodeJSON(r.reader, v, opts...)
+}
+
+// JSONStream returns a decoder reading the stream incrementally.
+// Close the response when done.
+func (r *StreamResponse) JSONStream(opts ...JSONOption) *json.Decoder {
+	return NewJSONDecoder(r.reader, opts...)
+}
@@ -2,12 +2,14 @@ package client
 
 import (
 	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"io"
-	"mime/multipart"
-	"net/textproto"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 )
 
@@ -19,10 +21,42 @@ type FormFile struct {
 	MIMEType  string    // MIME type (optional, will be detected)
 }
 
-// FormData represents multipart form data
+// BoundaryStyle selects the multipart boundary format. Servers and anti-bot
+// scripts can tell Go's random hex boundary from a browser's at a glance.
+type BoundaryStyle int
+
+const (
+	// BoundaryAuto uses the client preset's browser (WebKit outside a client)
+	BoundaryAuto BoundaryStyle = iota
+	// BoundaryWebKit is Chrome, Edge and Safari: ----WebKitFormBoundary + 16 alphanumerics
+	BoundaryWebKit
+	// BoundaryGecko is Firefox 125+: ----geckoformboundary + 32 hex digits
+	BoundaryGecko
+)
+
+// BoundaryStyleFor returns the boundary style of a preset's browser
+func BoundaryStyleFor(preset string) BoundaryStyle {
+	if strings.Contains(strings.ToLower(preset), "firefox") {
+		return BoundaryGecko
+	}
+	return BoundaryWebKit
+}
+
+// FormData represents multipart form data. Parts are written in the order
+// they were added, as a browser writes them in document order.
 type FormData struct {
 	Fields map[string]string // Regular form fields
 	Files  []FormFile        // Files to upload
+	Style  BoundaryStyle     // Boundary format
+
+	order    []formPart
+	boundary string
+}
+
+// formPart is one entry in add order: a field name, or an index into Files
+type formPart struct {
+	field string
+	file  int
 }
 
 // NewFormData creates a new FormData instance
@@ -35,19 +69,21 @@ func NewFormData() *FormData {
 
 // AddField adds a form field
 func (f *FormData) AddField(name, value string) *FormData {
+	if _, ok := f.Fields[name]; !ok {
+		f.order = append(f.order, formPart{field: name, file: -1})
+	}
 	f.Fields[name] = value
 	return f
 }
 
 // AddFile adds a file from bytes
 func (f *FormData) AddFile(fieldName, fileName string, content []byte) *FormData {
-	f.Files = append(f.Files, FormFile{
+	return f.addFile(FormFile{
 		FieldName: fieldName,
 		FileName:  fileName,
 		Content:   bytes.NewReader(content),
 		MIMEType:  detectMIMEType(fileName),
 	})
-	return f
 }
 
 // AddFileReader adds a file from an io.Reader
@@ -55,75 +91,248 @@ func (f *FormData) AddFileReader(fieldName, fileName string, content io.Reader,
 	if mimeType == "" {
 		mimeType = detectMIMEType(fileName)
 	}
-	f.Files = append(f.Files, FormFile{
+	return f.addFile(FormFile{
 		FieldName: fieldName,
 		FileName:  fileName,
 		Content:   content,
 		MIMEType:  mimeType,
 	})
-	return f
 }
 
-// AddFilePath adds a file from a filesystem path
+// AddFilePath adds a file from a filesystem path. The file is opened only
+// while its part is being read and closed at EOF. Reader streams it from
+// disk; Encode and PostMultipart hold the whole body in memory, as Client
+// buffers request bodies for retries and redirects.
 func (f *FormData) AddFilePath(fieldName, filePath string) error {
-	file, err := os.Open(filePath)
+	info, err := os.Stat(filePath)
 	if err != nil {
 		return fmt.Errorf("failed to open file: %w", err)
 	}
-	// Note: The file will be read when Encode is called
-	// The caller is responsible for closing the file after the request is made
-
-	f.Files = append(f.Files, FormFile{
+	if info.IsDir() {
+		return fmt.Errorf("failed to open file: %s is a directory", filePath)
+	}
+	f.addFile(FormFile{
 		FieldName: fieldName,
 		FileName:  filepath.Base(filePath),
-		Content:   file,
+		Content:   &diskFile{path: filePath, size: info.Size()},
 		MIMEType:  detectMIMEType(filePath),
 	})
 	return nil
 }
 
+func (f *FormData) addFile(file FormFile) *FormData {
+	f.Files = append(f.Files, file)
+	f.order = append(f.order, formPart{file: len(f.Files) - 1})
+	return f
+}
+
+// Boundary returns the form's boundary, generating it on first use in the
+// form's Style. It stays the same for the life of the form.
+func (f *FormData) Boundary() string {
+	if f.boundary == "" {
+		f.boundary = newBoundary(f.Style)
+	}
+	return f.boundary
+}
+
+// ContentType returns the Content-Type header value, with boundary
+func (f *FormData) ContentType() string {
+	return "multipart/form-data; boundary=" + f.Boundary()
+}
+
+// Reader returns the encoded body as a stream and its length, or -1 if a
+// file part's size isn't known up front. File contents are read lazily.
+func (f *FormData) Reader() (io.Reader, int64) {
+	boundary := f.Boundary()
+	var readers []io.Reader
+	var size int64
+
+	add := func(s string) {
+		readers = append(readers, strings.NewReader(s))
+		if size >= 0 {
+			size += int64(len(s))
+		}
+	}
+
+	for _, p := range f.parts() {
+		if p.file < 0 {
+			add("--" + boundary + "\r\n" +
+				`Content-Disposition: form-data; name="` + escapeQuotes(p.field) + "\"\r\n\r\n" +
+				f.Fields[p.field] + "\r\n")
+			continue
+		}
+		file := f.Files[p.file]
+		mimeType := file.MIMEType
+		if mimeType == "" {
+			mimeType = detectMIMEType(file.FileName)
+		}
+		add("--" + boundary + "\r\n" +
+			`Content-Disposition: form-data; name="` + escapeQuotes(file.FieldName) +
+			`"; filename="` + escapeQuotes(file.FileName) + "\"\r\n" +
+			"Content-Type: " + mimeType + "\r\n\r\n")
+		if file.Content != nil {
+			readers = append(readers, file.Content)
+			if n := readerSize(file.Content); n < 0 {
+				size = -1
+			} else if size >= 0 {
+				size += n
+			}
+		}
+		add("\r\n")
+	}
+	add("--" + boundary + "--\r\n")
+
+	return io.MultiReader(readers...), size
+}
+
 // Encode encodes the form data as multipart/form-data
 // Returns the body bytes and the Content-Type header value (with boundary)
 func (f *FormData) Encode() ([]byte, string, error) {
+	body, size := f.Reader()
 	var buf bytes.Buffer
-	writer := multipart.NewWriter(&buf)
-
-	// Add regular fields
-	for name, value := range f.Fields {
-		if err := writer.WriteField(name, value); err != nil {
-			return nil, "", fmt.Errorf("failed to write field %s: %w", name, err)
-		}
+	if size > 0 {
+		buf.Grow(int(size))
 	}
+	if _, err := buf.ReadFrom(body); err != nil {
+		return nil, "", fmt.Errorf("failed to read form data: %w", err)
+	}
+	return buf.Bytes(), f.ContentType(), nil
+}
 
-	// Add files
-	for _, file := range f.Files {
-		h := make(textproto.MIMEHeader)
-		h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`,
-			escapeQuotes(file.FieldName), escapeQuotes(file.FileName)))
-		h.Set("Content-Type", file.MIMEType)
+// PostMultipart posts form as multipart/form-data. A form left at
+// BoundaryAuto gets the boundary style of the client's preset. The body is
+// encoded up front, so a file that can't be read fails here.
+func (c *Client) PostMultipart(ctx context.Context, url string, form *FormData, headers map[string][]string) (*Response, error) {
+	if form.Style == BoundaryAuto && form.boundary == "" {
+		form.Style = BoundaryStyleFor(c.preset.Name)
+	}
+	h := make(map[string][]string, len(headers)+1)
+	for k, v := range headers {
+		h[k] = v
+	}
+	body, contentType, err := form.Encode()
+	if err != nil {
+		return nil, err
+	}
+	h["Content-Type"] = []string{contentType}
+	return c.Post(ctx, url, bytes.NewReader(body), h)
+}
 
-		part, err := writer.CreatePart(h)
-		if err != nil {
-			return nil, "", fmt.Errorf("failed to create part for %s: %w", file.FieldName, err)
+// parts returns every part in add order. Fields and files assigned to the
+// exported maps directly come last, fields sorted by name.
+func (f *FormData) parts() []formPart {
+	parts := make([]formPart, 0, len(f.Fields)+len(f.Files))
+	seenField := make(map[string]bool, len(f.Fields))
+	seenFile := make(map[int]bool, len(f.Files))
+	for _, p := range f.order {
+		if p.file < 0 {
+			if _, ok := f.Fields[p.field]; ok && !seenField[p.field] {
+				seenField[p.field] = true
+				parts = append(parts, p)
+			}
+		} else if p.file < len(f.Files) && !seenFile[p.file] {
+			seenFile[p.file] = true
+			parts = append(parts, p)
 		}
+	}
 
-		if _, err := io.Copy(part, file.Content); err != nil {
-			return nil, "", fmt.Errorf("failed to copy file content for %s: %w", file.FieldName, err)
+	var rest []string
+	for name := range f.Fields {
+		if !seenField[name] {
+			rest = append(rest, name)
+		}
+	}
+	sort.Strings(rest)
+	for _, name := range rest {
+		parts = append(parts, formPart{field: name, file: -1})
+	}
+	for i := range f.Files {
+		if !seenFile[i] {
+			parts = append(parts, formPart{file: i})
 		}
 	}
+	return parts
+}
+
+// newBoundary generates a boundary the way the browser of style does
+func newBoundary(style BoundaryStyle) string {
+	var raw [16]byte
+	if _, err := rand.Read(raw[:]); err != nil {
+		panic(err)
+	}
+	if style == BoundaryGecko {
+		return "----geckoformboundary" + hex.EncodeToString(raw[:])
+	}
+	// Blink/WebKit map each random byte to one character of this alphabet;
+	// the trailing "AB" pads it to 64 entries
+	const alphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789AB"
+	b := []byte("----WebKitFormBoundary")
+	for _, r := range raw {
+		b = append(b, alphabet[r&0x3f])
+	}
+	return string(b)
+}
+
+// readerSize returns how many bytes r has left, or -1 if unknown
+func readerSize(r io.Reader) int64 {
+	switch r := r.(type) {
+	case *bytes.Reader:
+		return int64(r.Len())
+	case *strings.Reader:
+		return int64(r.Len())
+	case *bytes.Buffer:
+		return int64(r.Len())
+	case *diskFile:
+		return r.size
+	}
+	return -1
+}
+
+// diskFile opens path on first Read and closes it at EOF
+type diskFile struct {
+	path string
+	size int64
+	file *os.File
+	done bool
+}
 
-	if err := writer.Close(); err != nil {
-		return nil, "", fmt.Errorf("failed to close multipart writer: %w", err)
+func (d *diskFile) Read(p []byte) (int, error) {
+	if d.done {
+		return 0, io.EOF
+	}
+	if d.file == nil {
+		file, err := os.Open(d.path)
+		if err != nil {
+			return 0, fmt.Errorf("failed to open file: %w", err)
+		}
+		d.file = file
 	}
+	n, err := d.file.Read(p)
+	if err == io.EOF {
+		d.Close()
+	}
+	return n, err
+}
 
-	return buf.Bytes(), writer.FormDataContentType(), nil
+// Close closes the file if it is open
+func (d *diskFile) Close() error {
+	d.done = true
+	if d.file == nil {
+		return nil
+	}
+	err := d.file.Close()
+	d.file = nil
+	return err
 }
 
-// escapeQuotes escapes quotes in a string for use in Content-Disposition header
+// escapeQuotes escapes a name or filename for Content-Disposition the way
+// browsers do (HTML spec): quotes and line breaks are percent-encoded
 func escapeQuotes(s string) string {
-	return strings.ReplaceAll(s, `"`, `\"`)
+	return quoteEscaper.Replace(s)
 }
 
+var quoteEscaper = strings.NewReplacer(`"`, "%22", "\r", "%0D", "\n", "%0A")
+
 // detectMIMEType detects MIME type from filename
 func detectMIMEType(filename string) string {
 	ext := strings.ToLower(filepath.Ext(filename))
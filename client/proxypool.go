@@ -0,0 +1,227 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/sardanioss/httpcloak/fingerprint"
+	"github.com/sardanioss/httpcloak/pool"
+	"github.com/sardanioss/httpcloak/transport"
+)
+
+// RotationPolicy controls how requests are spread over a proxy pool
+type RotationPolicy int
+
+const (
+	// RotatePerRequest sends each request through the next healthy proxy
+	// (round-robin). Connections to every proxy stay pooled for reuse.
+	RotatePerRequest RotationPolicy = iota
+
+	// RotatePerConnection keeps each host on the proxy its connection was
+	// opened through, so requests to a host reuse one connection. The host
+	// moves to another proxy only when its proxy is ejected.
+	RotatePerConnection
+)
+
+const (
+	// proxyEjectAfter consecutive failures take a proxy out of rotation
+	proxyEjectAfter = 3
+	// proxyEjectFor is how long an ejected proxy stays out of rotation
+	proxyEjectFor = 30 * time.Second
+)
+
+// ProxyStats is a snapshot of one proxy in the pool
+type ProxyStats struct {
+	URL                 string    // Proxy URL with the password redacted
+	Requests            int64     // Requests sent through the proxy
+	Failures            int64     // Requests that failed at the transport level
+	ConsecutiveFailures int       // Failures since the last success
+	Ejected             bool      // Out of rotation until EjectedUntil
+	EjectedUntil        time.Time // Zero if never ejected
+}
+
+// proxyRoute is a proxy with its own connection pools
+type proxyRoute struct {
+	url         string
+	poolManager *pool.Manager
+	h1Transport *transport.HTTP1Transport
+
+	// Guarded by proxyPool.mu
+	requests     int64
+	failures     int64
+	consecutive  int
+	ejectedUntil time.Time
+}
+
+// proxyPool rotates requests over a set of proxies and ejects failing ones
+type proxyPool struct {
+	mu     sync.Mutex
+	routes []*proxyRoute
+	policy RotationPolicy
+	next   int
+	sticky map[string]*proxyRoute // RotatePerConnection: host:port -> route
+}
+
+type proxyRouteKey struct{}
+
+// newProxyPool creates a route per proxy, configured like the client's own
+// TCP transports
+func newProxyPool(proxies []string, policy RotationPolicy, preset *fingerprint.Preset, config *ClientConfig, transportConfig *transport.TransportConfig) *proxyPool {
+	p := &proxyPool{policy: policy, sticky: make(map[string]*proxyRoute)}
+	for _, proxyURL := range proxies {
+		manager := pool.NewManagerWithProxy(preset, proxyURL, config.InsecureSkipVerify)
+		if config.PreferIPv4 {
+			manager.GetDNSCache().SetPreferIPv4(true)
+		}
+		h1 := transport.NewHTTP1TransportWithConfig(preset, manager.GetDNSCache(), &transport.ProxyConfig{URL: proxyURL}, transportConfig)
+		h1.SetInsecureSkipVerify(config.InsecureSkipVerify)
+		h1.SetDrainLimit(config.drainLimit())
+		for requestHost, connectHost := range config.ConnectTo {
+			manager.SetConnectTo(requestHost, connectHost)
+			h1.SetConnectTo(requestHost, connectHost)
+		}
+		if len(config.ECHConfig) > 0 {
+			manager.SetECHConfig(config.ECHConfig)
+		}
+		if config.ECHConfigDomain != "" {
+			manager.SetECHConfigDomain(config.ECHConfigDomain)
+		}
+		if config.CustomTLSSpec != nil {
+			manager.SetCustomTLSSpec(config.CustomTLSSpec)
+		}
+		p.routes = append(p.routes, &proxyRoute{url: proxyURL, poolManager: manager, h1Transport: h1})
+	}
+	return p
+}
+
+// pick chooses the proxy for a request to hostKey. If every proxy is
+// ejected, the one coming back soonest is used rather than failing.
+func (p *proxyPool) pick(hostKey string) *proxyRoute {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	if p.policy == RotatePerConnection {
+		if r, ok := p.sticky[hostKey]; ok && !now.Before(r.ejectedUntil) {
+			return r
+		}
+	}
+
+	var chosen *proxyRoute
+	for i := 0; i < len(p.routes); i++ {
+		r := p.routes[(p.next+i)%len(p.routes)]
+		if !now.Before(r.ejectedUntil) {
+			chosen = r
+			p.next = (p.next + i + 1) % len(p.routes)
+			break
+		}
+	}
+	if chosen == nil {
+		for _, r := range p.routes {
+			if chosen == nil || r.ejectedUntil.Before(chosen.ejectedUntil) {
+				chosen = r
+			}
+		}
+	}
+
+	if p.policy == RotatePerConnection {
+		p.sticky[hostKey] = chosen
+	}
+	return chosen
+}
+
+// report records the outcome of a request sent through r. A request that
+// ended because its context was canceled or timed out says nothing about
+// the proxy, so it isn't counted.
+func (p *proxyPool) report(ctx context.Context, r *proxyRoute, err error) {
+	if p == nil || r == nil {
+		return
+	}
+	if err != nil && (ctx.Err() != nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)) {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	r.requests++
+	if err == nil {
+		r.consecutive = 0
+		return
+	}
+	r.failures++
+	r.consecutive++
+	if r.consecutive >= proxyEjectAfter {
+		r.ejectedUntil = time.Now().Add(proxyEjectFor)
+		r.consecutive = 0
+	}
+}
+
+func (p *proxyPool) stats() []ProxyStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	stats := make([]ProxyStats, len(p.routes))
+	for i, r := range p.routes {
+		stats[i] = ProxyStats{
+			URL:                 redactProxyURL(r.url),
+			Requests:            r.requests,
+			Failures:            r.failures,
+			ConsecutiveFailures: r.consecutive,
+			Ejected:             now.Before(r.ejectedUntil),
+			EjectedUntil:        r.ejectedUntil,
+		}
+	}
+	return stats
+}
+
+func (p *proxyPool) setPreset(preset *fingerprint.Preset) {
+	for _, r := range p.routes {
+		r.poolManager.SetPreset(preset)
+	}
+}
+
+func (p *proxyPool) close() {
+	for _, r := range p.routes {
+		r.poolManager.Close()
+		r.h1Transport.Close()
+	}
+}
+
+func redactProxyURL(proxyURL string) string {
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return proxyURL
+	}
+	return u.Redacted()
+}
+
+// withProxyRoute picks the proxy for a request and attaches it to ctx
+func (c *Client) withProxyRoute(ctx context.Context, hostKey string) context.Context {
+	if c.proxyPool == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, proxyRouteKey{}, c.proxyPool.pick(hostKey))
+}
+
+// tcpRoute returns the HTTP/2 pool and HTTP/1.1 transport for a request:
+// those of the proxy picked for it, or the client's own. The route is nil
+// without a proxy pool.
+func (c *Client) tcpRoute(ctx context.Context) (*pool.Manager, *transport.HTTP1Transport, *proxyRoute) {
+	if r, ok := ctx.Value(proxyRouteKey{}).(*proxyRoute); ok {
+		return r.poolManager, r.h1Transport, r
+	}
+	return c.poolManager, c.h1Transport, nil
+}
+
+// ProxyPoolStats returns a snapshot of each proxy in the pool set with
+// WithProxyPool, or nil without one.
+func (c *Client) ProxyPoolStats() []ProxyStats {
+	if c.proxyPool == nil {
+		return nil
+	}
+	return c.proxyPool.stats()
+}
@@ -0,0 +1,125 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	http "github.com/sardanioss/http"
+	"github.com/sardanioss/httpcloak/protocol"
+)
+
+// raceMemoryTTL is how long an origin keeps the protocol that won its race
+// before it is raced again
+const raceMemoryTTL = 30 * time.Minute
+
+// raceWinners remembers which protocol won the connection race per origin
+type raceWinners struct {
+	mu      sync.Mutex
+	winners map[string]raceWinner
+}
+
+type raceWinner struct {
+	protocol string // "h3" or "h2"
+	expires  time.Time
+}
+
+func (w *raceWinners) get(hostKey string) (string, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	winner, ok := w.winners[hostKey]
+	if !ok || time.Now().After(winner.expires) {
+		return "", false
+	}
+	return winner.protocol, true
+}
+
+func (w *raceWinners) set(hostKey, proto string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.winners == nil {
+		w.winners = make(map[string]raceWinner)
+	}
+	w.winners[hostKey] = raceWinner{protocol: proto, expires: time.Now().Add(raceMemoryTTL)}
+}
+
+func (w *raceWinners) forget(hostKey string) {
+	w.mu.Lock()
+	delete(w.winners, hostKey)
+	w.mu.Unlock()
+}
+
+// raceConnect dials QUIC and TCP+TLS to the origin at the same time, as
+// Chrome does for an origin it hasn't talked to, and returns the protocol
+// whose connection was ready first. The slower dial is left to finish into
+// its pool, where it serves as the fallback. A failed QUIC dial marks the
+// origin as without HTTP/3.
+func (c *Client) raceConnect(ctx context.Context, hostKey, host, port string) (string, error) {
+	type result struct {
+		protocol string
+		err      error
+	}
+	results := make(chan result, 2)
+	go func() {
+		_, err := c.quicManager.GetConn(ctx, host, port)
+		results <- result{"h3", err}
+	}()
+	go func() {
+		poolManager, _, _ := c.tcpRoute(ctx)
+		_, err := poolManager.GetConn(ctx, host, port)
+		results <- result{"h2", err}
+	}()
+
+	var errs []error
+	for range 2 {
+		r := <-results
+		if r.err == nil {
+			return r.protocol, nil
+		}
+		if r.protocol == "h3" {
+			c.markH3Failed(hostKey)
+		}
+		errs = append(errs, r.err)
+	}
+	return "", errors.Join(errs...)
+}
+
+// doRaced sends a request in auto mode with racing on: over the protocol
+// that last won the origin's race, or the winner of a new race, falling back
+// to HTTP/2 and then HTTP/1.1. The pools don't report the dial's phases, so
+// a request that raced leaves DNSLookup, TCPConnect and TLSHandshake zero.
+// The race is still part of Total.
+func (c *Client) doRaced(ctx context.Context, hostKey, host, port string, httpReq *http.Request, bodyBytes []byte, timing *protocol.Timing, startTime time.Time) (*http.Response, string, error) {
+	proto, known := c.raceWinners.get(hostKey)
+	if !known {
+		var err error
+		proto, err = c.raceConnect(ctx, hostKey, host, port)
+		if err != nil {
+			proto = "h1" // Neither connected; HTTP/1.1 dials afresh
+		}
+	}
+
+	if proto == "h3" {
+		resp, used, err := c.doHTTP3(ctx, host, port, httpReq, timing, startTime)
+		if err == nil {
+			c.raceWinners.set(hostKey, "h3")
+			return resp, used, nil
+		}
+		c.markH3Failed(hostKey)
+		c.raceWinners.forget(hostKey)
+		resetRequestBody(httpReq, bodyBytes)
+		proto = "h2"
+	}
+	if proto == "h2" {
+		resp, used, err := c.doHTTP2(ctx, host, port, httpReq, timing, startTime)
+		if err == nil {
+			c.raceWinners.set(hostKey, "h2")
+			return resp, used, nil
+		}
+		c.raceWinners.forget(hostKey)
+		c.markH2Failed(hostKey)
+		resetRequestBody(httpReq, bodyBytes)
+	}
+	return c.doHTTP1(ctx, host, port, httpReq, timing, startTime)
+}
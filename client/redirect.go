@@ -0,0 +1,217 @@
+package client
+
+import (
+	"bytes"
+	"net/url"
+
+	http "github.com/sardanioss/http"
+	"github.com/sardanioss/httpcloak/fingerprint"
+	"github.com/sardanioss/httpcloak/transport"
+)
+
+// CookieDelta lists the cookies one redirect response set or cleared
+type CookieDelta = transport.CookieDelta
+
+// Redirect policy types, shared with sessions
+type (
+	RedirectMethods = transport.RedirectMethods
+	RedirectHop     = transport.RedirectHop
+	RedirectFunc    = transport.RedirectFunc
+)
+
+const (
+	RedirectMethodsBrowser  = transport.RedirectMethodsBrowser
+	RedirectMethodsPreserve = transport.RedirectMethodsPreserve
+	RedirectMethodsGET      = transport.RedirectMethodsGET
+)
+
+// ErrUseLastResponse, returned by a RedirectFunc, makes the request return
+// the redirect response instead of following it
+var ErrUseLastResponse = transport.ErrUseLastResponse
+
+// RedirectLoopError is returned when a redirect chain comes back to a URL it
+// already requested with the same method and Cookie header, instead of
+// following it until MaxRedirects
+type RedirectLoopError = transport.RedirectLoopError
+
+// redirectChain carries what browsers keep constant across a redirect chain:
+// the original referrer and initiator, and the Sec-Fetch-Site and Origin
+// values that only ever get less trusted as the chain moves between origins.
+type redirectChain struct {
+	referrer  string // Referer of the first request
+	initiator string // Origin of the page that started the chain ("" = user)
+	site      fingerprint.FetchSite
+	origin    string // Origin header, "null" once tainted
+	policy    string // Referrer policy, updated by Referrer-Policy responses
+
+	// dropCredentials is set once the chain has left the first request's
+	// origin; from then on the caller's credentials are no longer sent
+	dropCredentials bool
+}
+
+// redirectCredentials is what happens to credentials when a redirect leaves
+// the origin
+type redirectCredentials struct {
+	keep  bool     // Send them on anyway (curl's --location-trusted)
+	extra []string // Headers that count as credentials besides the defaults
+}
+
+// startRedirectChain records the browser state of the first request
+func startRedirectChain(req *Request, httpReq *http.Request) *redirectChain {
+	chain := &redirectChain{
+		referrer: req.Referer,
+		site:     fingerprint.FetchSite(httpReq.Header.Get("Sec-Fetch-Site")),
+		origin:   httpReq.Header.Get("Origin"),
+	}
+	if ref, err := url.Parse(req.Referer); err == nil && ref.Host != "" {
+		chain.initiator = ref.Scheme + "://" + ref.Host
+	}
+	return chain
+}
+
+// newRedirectRequest builds the request that follows a redirect from
+// fromURL to toURL the way a browser would: the method (and body) follow
+// RFC 9110 as browsers implement it, and Referer, Origin and Sec-Fetch-Site
+// are recomputed for the new URL from the state of the whole chain.
+func newRedirectRequest(req *Request, httpReq *http.Request, resp *http.Response, fromURL, toURL string, body []byte, methods RedirectMethods, creds redirectCredentials) *Request {
+	chain := req.redirect
+	if chain == nil {
+		chain = startRedirectChain(req, httpReq)
+	}
+	next := *chain
+	next.policy = fingerprint.ParseReferrerPolicy(resp.Header.Get("Referrer-Policy"), chain.policy)
+	next.site = fingerprint.RedirectFetchSite(chain.site, chain.initiator, toURL)
+	next.origin = fingerprint.RedirectOrigin(chain.origin, fromURL, toURL)
+	next.dropCredentials = chain.dropCredentials || (!creds.keep && fingerprint.CrossOrigin(fromURL, toURL))
+
+	method := methods.Method(resp.StatusCode, httpReq.Method)
+	auth := req.Auth
+	headers := req.Headers
+	if method != httpReq.Method || next.dropCredentials {
+		// The body is dropped, so are the headers describing it; another
+		// origin gets none of the credentials
+		headers = make(map[string][]string, len(req.Headers))
+		for k, v := range req.Headers {
+			if method != httpReq.Method && fingerprint.IsRequestBodyHeader(k) {
+				continue
+			}
+			if next.dropCredentials && fingerprint.IsRedirectCredentialHeader(k, creds.extra) {
+				continue
+			}
+			headers[k] = v
+		}
+	}
+	if next.dropCredentials {
+		auth = nil
+	}
+
+	newReq := &Request{
+		Method:          method,
+		URL:             toURL,
+		Headers:         headers,
+		Timeout:         req.Timeout,
+		UserAgent:       req.UserAgent,
+		ForceProtocol:   req.ForceProtocol,
+		FetchMode:       req.FetchMode,
+		FetchSite:       fetchSiteFromHeader(next.site),
+		Referer:         fingerprint.RedirectReferer(chain.referrer, toURL, next.policy),
+		Auth:            auth,
+		FollowRedirects: req.FollowRedirects,
+		MaxRedirects:    req.MaxRedirects,
+		RedirectMethods: req.RedirectMethods,
+		OnRedirect:      req.OnRedirect,
+		DisableRetry:    true, // Don't retry redirects
+		Conditional:     req.Conditional,
+		Stream:          req.Stream,
+		MaxBodySize:     req.MaxBodySize,
+		Meta:            req.Meta,
+		redirect:        &next,
+	}
+
+	// 307/308 replay the body (buffered, since the original reader was consumed)
+	if method == httpReq.Method && len(body) > 0 {
+		newReq.Body = bytes.NewReader(body)
+	}
+	return newReq
+}
+
+// redirectCredentials returns the client's policy for credentials on
+// cross-origin redirects
+func (c *Client) redirectCredentials() redirectCredentials {
+	return redirectCredentials{keep: c.config.KeepRedirectCredentials, extra: c.config.RedirectCredentialHeaders}
+}
+
+// redirectMethods returns the redirect method policy for req
+func (c *Client) redirectMethods(req *Request) RedirectMethods {
+	if req.RedirectMethods != 0 {
+		return req.RedirectMethods
+	}
+	return c.config.RedirectMethods
+}
+
+// checkRedirect runs the client's and then the request's OnRedirect for the
+// hop to newReq, and applies what they changed. method is the method of the
+// redirected request; its body goes along only if the method is kept.
+func (c *Client) checkRedirect(newReq, req *Request, method string, status int, via []*RedirectInfo, body []byte) error {
+	if c.config.OnRedirect == nil && req.OnRedirect == nil {
+		return nil
+	}
+	hop := &RedirectHop{
+		StatusCode: status,
+		Method:     newReq.Method,
+		URL:        newReq.URL,
+		Headers:    make(map[string][]string, len(newReq.Headers)),
+		Via:        via,
+		Meta:       req.Meta,
+	}
+	// Copied, since newReq may share the caller's header map
+	for k, v := range newReq.Headers {
+		hop.Headers[k] = v
+	}
+	for _, fn := range []RedirectFunc{c.config.OnRedirect, req.OnRedirect} {
+		if fn == nil {
+			continue
+		}
+		if err := fn(hop); err != nil {
+			return err
+		}
+	}
+
+	newReq.Method, newReq.URL, newReq.Headers = hop.Method, hop.URL, hop.Headers
+	newReq.Body = nil
+	if hop.Method == method && len(body) > 0 {
+		newReq.Body = bytes.NewReader(body)
+	}
+	return nil
+}
+
+// fetchSiteFromHeader maps a Sec-Fetch-Site value to a FetchSite override
+func fetchSiteFromHeader(site fingerprint.FetchSite) FetchSite {
+	switch site {
+	case fingerprint.FetchSiteNone:
+		return FetchSiteNone
+	case fingerprint.FetchSiteSameOrigin:
+		return FetchSiteSameOrigin
+	case fingerprint.FetchSiteSameSite:
+		return FetchSiteSameSite
+	case fingerprint.FetchSiteCrossSite:
+		return FetchSiteCrossSite
+	}
+	return FetchSiteAuto
+}
+
+// requestOrigin returns the Origin header for req: the redirect chain's
+// (possibly "null") origin, or the origin of the Referer
+func requestOrigin(req *Request) string {
+	if req.redirect != nil {
+		return req.redirect.origin
+	}
+	if req.Referer == "" {
+		return ""
+	}
+	ref, err := url.Parse(req.Referer)
+	if err != nil || ref.Host == "" {
+		return ""
+	}
+	return ref.Scheme + "://" + ref.Host
+}
@@ -0,0 +1,130 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	http "github.com/sardanioss/http"
+	"github.com/sardanioss/httpcloak/protocol"
+	"github.com/sardanioss/httpcloak/transport"
+)
+
+// RetryPolicy configures retries for WithRetryPolicy. Zero fields take the
+// defaults of DefaultConfig.
+type RetryPolicy struct {
+	MaxRetries    int
+	WaitMin       time.Duration // First backoff; doubles per attempt with ±20% jitter
+	WaitMax       time.Duration // Backoff cap
+	RetryOnStatus []int
+
+	// MaxRetryAfter is the longest Retry-After the client waits out. A
+	// response asking for longer is returned as is. Default: 1 minute.
+	MaxRetryAfter time.Duration
+
+	// RetryNonIdempotent retries POST and PATCH after network errors and
+	// 5xx too. By default they are only retried on 429 or 503 with
+	// Retry-After, which mean the request wasn't processed, or when they
+	// carry an Idempotency-Key header.
+	RetryNonIdempotent bool
+}
+
+// WithRetryPolicy enables retries of transient network errors and
+// RetryOnStatus responses, with exponential backoff that defers to
+// Retry-After. Request bodies are resent from Request.GetBody when set,
+// otherwise from a buffered copy.
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(c *ClientConfig) {
+		c.RetryEnabled = true
+		if p.MaxRetries > 0 {
+			c.MaxRetries = p.MaxRetries
+		}
+		if p.WaitMin > 0 {
+			c.RetryWaitMin = p.WaitMin
+		}
+		if p.WaitMax > 0 {
+			c.RetryWaitMax = p.WaitMax
+		}
+		if len(p.RetryOnStatus) > 0 {
+			c.RetryOnStatus = p.RetryOnStatus
+		}
+		if p.MaxRetryAfter > 0 {
+			c.MaxRetryAfter = p.MaxRetryAfter
+		}
+		c.RetryNonIdempotent = p.RetryNonIdempotent
+	}
+}
+
+// RetryAttempt records one try of a request that was retried
+type RetryAttempt struct {
+	StatusCode int              // 0 if the attempt failed
+	Err        error            // Network error, if any
+	Timing     *protocol.Timing // Timing of this attempt
+	Wait       time.Duration    // Backoff before this attempt
+}
+
+// defaultMaxRetryAfter is used when MaxRetryAfter is unset
+const defaultMaxRetryAfter = time.Minute
+
+// isIdempotent reports whether req may be sent again after it possibly
+// reached the server (RFC 9110 section 9.2.2, plus Idempotency-Key)
+func isIdempotent(req *Request) bool {
+	switch strings.ToUpper(req.Method) {
+	case "", "GET", "HEAD", "OPTIONS", "TRACE", "PUT", "DELETE":
+		return true
+	}
+	return req.GetHeader("Idempotency-Key") != ""
+}
+
+// notProcessed reports whether a status says the server didn't act on the
+// request, so resending is safe for any method
+func notProcessed(resp *Response) bool {
+	return resp.StatusCode == 429 || (resp.StatusCode == 503 && resp.GetHeader("Retry-After") != "")
+}
+
+// retryableError reports whether err is a transient network failure worth
+// another attempt. Cancellation of ctx is not.
+func retryableError(ctx context.Context, err error) bool {
+	if ctx.Err() != nil || errors.Is(err, ErrCircuitOpen) {
+		return false
+	}
+	var loop *RedirectLoopError
+	if errors.As(err, &loop) {
+		return false
+	}
+	return transport.IsRetryable(err)
+}
+
+// retryAfter returns how long resp asks to wait before the next attempt
+// (0 if it doesn't say) and false if that is longer than MaxRetryAfter. An
+// HTTP-date is measured against the response's Date header, so a skewed
+// server clock doesn't stretch or skip the wait.
+func (c *Client) retryAfter(resp *Response) (time.Duration, bool) {
+	v := strings.TrimSpace(resp.GetHeader("Retry-After"))
+	if v == "" {
+		return 0, true
+	}
+	var wait time.Duration
+	if secs, err := strconv.Atoi(v); err == nil {
+		wait = time.Duration(secs) * time.Second
+	} else if at, err := http.ParseTime(v); err == nil {
+		now := time.Now()
+		if date, err := http.ParseTime(resp.GetHeader("Date")); err == nil {
+			now = date
+		}
+		wait = at.Sub(now)
+	} else {
+		return 0, true
+	}
+	if wait < 0 {
+		wait = 0
+	}
+
+	limit := c.config.MaxRetryAfter
+	if limit <= 0 {
+		limit = defaultMaxRetryAfter
+	}
+	return wait, wait <= limit
+}
@@ -0,0 +1,113 @@
+package client
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sardanioss/httpcloak/protocol"
+)
+
+// SlowRequest is the record emitted for a request slower than the threshold
+// set with WithSlowRequestLog. Its phases add up to Total.
+type SlowRequest struct {
+	Start      time.Time
+	Method     string
+	URL        string
+	Protocol   string // "h1", "h2" or "h3"; "" if it failed before a response
+	StatusCode int    // 0 if the request failed
+	Err        error
+	Total      time.Duration
+
+	DNS     time.Duration // Resolving the host (new connections only)
+	Connect time.Duration // TCP connect (new connections only)
+	TLS     time.Duration // TLS/QUIC handshake (new connections only)
+	Queue   time.Duration // Everything else before the request went out: pool waits, protocol fallback, hooks
+	Server  time.Duration // Request sent to first response byte
+	Body    time.Duration // Reading and decoding the response body
+
+	Cause string // Largest phase: "dns", "connect", "tls", "queue", "server" or "body"
+}
+
+// String formats the record as one logfmt line
+func (r SlowRequest) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "slow_request method=%s url=%q proto=%s status=%d total=%s cause=%s dns=%s connect=%s tls=%s queue=%s server=%s body=%s",
+		r.Method, r.URL, r.Protocol, r.StatusCode, r.Total, r.Cause,
+		r.DNS, r.Connect, r.TLS, r.Queue, r.Server, r.Body)
+	if r.Err != nil {
+		fmt.Fprintf(&b, " err=%q", r.Err.Error())
+	}
+	return b.String()
+}
+
+// slowRequestLog reports requests over a latency threshold
+type slowRequestLog struct {
+	threshold time.Duration
+	fn        func(SlowRequest)
+}
+
+// slowRequestTrace collects one request's timing; report emits it at most once
+type slowRequestTrace struct {
+	log      *slowRequestLog
+	start    time.Time
+	method   string
+	url      string
+	timing   *protocol.Timing
+	body     time.Duration
+	reported bool
+}
+
+func (c *Client) traceSlowRequest(start time.Time, method, url string, timing *protocol.Timing) *slowRequestTrace {
+	if c.slowLog == nil {
+		return nil
+	}
+	return &slowRequestTrace{log: c.slowLog, start: start, method: method, url: url, timing: timing}
+}
+
+// report emits the record if the request took at least the threshold
+func (t *slowRequestTrace) report(proto string, statusCode int, err error) {
+	if t == nil || t.reported {
+		return
+	}
+	t.reported = true
+	total := time.Since(t.start)
+	if total < t.log.threshold {
+		return
+	}
+
+	ms := func(v float64) time.Duration { return time.Duration(v * float64(time.Millisecond)) }
+	r := SlowRequest{
+		Start:      t.start,
+		Method:     t.method,
+		URL:        t.url,
+		Protocol:   proto,
+		StatusCode: statusCode,
+		Err:        err,
+		Total:      total,
+		DNS:        ms(t.timing.DNSLookup),
+		Connect:    ms(t.timing.TCPConnect),
+		TLS:        ms(t.timing.TLSHandshake),
+		Server:     ms(t.timing.FirstByte),
+		Body:       t.body,
+	}
+	r.Queue = max(total-r.DNS-r.Connect-r.TLS-r.Server-r.Body, 0)
+
+	r.Cause = "queue"
+	longest := r.Queue
+	for _, phase := range []struct {
+		name string
+		d    time.Duration
+	}{{"dns", r.DNS}, {"connect", r.Connect}, {"tls", r.TLS}, {"server", r.Server}, {"body", r.Body}} {
+		if phase.d > longest {
+			r.Cause, longest = phase.name, phase.d
+		}
+	}
+
+	if t.log.fn != nil {
+		t.log.fn(r)
+		return
+	}
+	fmt.Fprintln(os.Stderr, r.String())
+}
@@ -5,6 +5,7 @@ import (
 	"bytes"
 	"compress/gzip"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	http "github.com/sardanioss/http"
@@ -15,6 +16,7 @@ import (
 	"github.com/andybalholm/brotli"
 	"github.com/klauspost/compress/zstd"
 	"github.com/sardanioss/httpcloak/protocol"
+	"github.com/sardanioss/httpcloak/transport"
 )
 
 // StreamResponse represents a streaming HTTP response
@@ -36,6 +38,9 @@ type StreamResponse struct {
 
 	// Context cancel function - must be called when response is closed
 	cancel context.CancelFunc
+
+	// Unread bytes Close drains rather than resetting an h2/h3 stream
+	drainLimit int64
 }
 
 // Read reads data from the response body
@@ -43,8 +48,20 @@ func (r *StreamResponse) Read(p []byte) (n int, err error) {
 	return r.reader.Read(p)
 }
 
-// Close closes the response body and cancels the context
+// Close closes the response body and cancels the context. HTTP/1.1 bodies
+// are drained by the connection pool; an HTTP/2 or HTTP/3 body with little
+// left is drained here so the stream isn't reset.
 func (r *StreamResponse) Close() error {
+	if r.Protocol != "h1" && r.drainLimit > 0 {
+		return transport.DrainAndClose(r.rawReader, r.ContentLength, r.drainLimit, func() {
+			if r.cancel != nil {
+				r.cancel()
+			}
+			if r.decompressor != nil {
+				r.decompressor.Close()
+			}
+		})
+	}
 	if r.cancel != nil {
 		r.cancel()
 	}
@@ -79,6 +96,20 @@ func (r *StreamResponse) Lines() <-chan string {
 	return ch
 }
 
+// LineReader returns a pull-based reader over the body's lines that reports
+// over-long lines instead of stopping silently. maxLineSize <= 0 uses
+// transport.DefaultMaxLineSize.
+func (r *StreamResponse) LineReader(maxLineSize int) *transport.LineReader {
+	return transport.NewLineReader(r.reader, maxLineSize)
+}
+
+// NDJSON streams the body as newline-delimited JSON into ch, one record per
+// line, and closes ch when done. Sends block until the consumer is ready, so
+// memory stays flat. See transport.DecodeNDJSON.
+func (r *StreamResponse) NDJSON(ctx context.Context, ch chan<- json.RawMessage, maxLineSize int) error {
+	return transport.DecodeNDJSON(ctx, r.reader, ch, maxLineSize)
+}
+
 // IsSuccess returns true if the status code is 2xx
 func (r *StreamResponse) IsSuccess() bool {
 	return r.StatusCode >= 200 && r.StatusCode < 300
@@ -106,6 +137,9 @@ func (c *Client) DoStream(ctx context.Context, req *Request) (*StreamResponse, e
 	}
 
 	host := parsedURL.Hostname()
+	if err := c.hostFilter().Check(host); err != nil {
+		return nil, err
+	}
 	port := parsedURL.Port()
 	if port == "" {
 		port = "443"
@@ -246,12 +280,18 @@ func (c *Client) DoStream(ctx context.Context, req *Request) (*StreamResponse, e
 	for key, values := range resp.Header {
 		lowerKey := strings.ToLower(key)
 		headerValues := make([]string, len(values))
-		copy(headerValues, values)
+		for i, v := range values {
+			headerValues[i] = transport.NormalizeHeaderValue(v)
+		}
 		headers[lowerKey] = headerValues
 	}
 
 	// Setup decompression reader
-	reader, decompressor := setupDecompressor(resp.Body, resp.Header.Get("Content-Encoding"))
+	contentEncoding := resp.Header.Get("Content-Encoding")
+	if c.config.RawBody {
+		contentEncoding = ""
+	}
+	reader, decompressor := setupDecompressor(resp.Body, contentEncoding)
 
 	timing.FirstByte = float64(time.Since(startTime).Milliseconds())
 
@@ -267,6 +307,7 @@ func (c *Client) DoStream(ctx context.Context, req *Request) (*StreamResponse, e
 		decompressor:  decompressor,
 		rawReader:     resp.Body,
 		cancel:        cancel,
+		drainLimit:    c.config.drainLimit(),
 	}, nil
 }
 
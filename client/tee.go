@@ -0,0 +1,67 @@
+package client
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/sardanioss/httpcloak/transport"
+)
+
+// Tee writes the body to w as it is read, by Bytes, JSON, JSONStream or
+// reads of Body, so it can be saved or hashed while it is parsed. A body
+// already read is written to w at once.
+func (r *Response) Tee(w io.Writer) error {
+	if r.bodyRead {
+		_, err := w.Write(r.bodyBytes)
+		return err
+	}
+	if r.bodyConsumed {
+		return ErrBodyConsumed
+	}
+	if r.Body != nil {
+		r.Body = transport.TeeBody(r.Body, w)
+	}
+	return nil
+}
+
+// Split hands the body to n readers that each see all of it, to be read
+// concurrently, one goroutine each (see transport.SplitBody). Bytes and
+// Text return ErrBodyConsumed afterwards. A body already read is shared.
+func (r *Response) Split(n int) []io.ReadCloser {
+	if r.bodyRead || r.Body == nil {
+		readers := make([]io.ReadCloser, n)
+		for i := range readers {
+			readers[i] = io.NopCloser(bytes.NewReader(r.bodyBytes))
+		}
+		return readers
+	}
+	if r.bodyConsumed {
+		return nil
+	}
+	r.bodyConsumed = true
+	return transport.SplitBody(r.Body, n)
+}
+
+// Tee writes the rest of the body to w as it is read
+func (r *StreamResponse) Tee(w io.Writer) {
+	r.reader = transport.TeeBody(r.reader, w)
+}
+
+// Split hands the rest of the body to n readers that each see all of it,
+// to be read concurrently. Don't read the response itself afterwards;
+// closing it, or every reader, ends the stream.
+func (r *StreamResponse) Split(n int) []io.ReadCloser {
+	readers := transport.SplitBody(&splitStreamBody{Reader: r.reader, stream: r}, n)
+	r.reader = io.NopCloser(bytes.NewReader(nil))
+	return readers
+}
+
+// splitStreamBody is a stream's body whose Close closes the stream
+type splitStreamBody struct {
+	io.Reader
+	stream *StreamResponse
+}
+
+func (b *splitStreamBody) Close() error {
+	return b.stream.Close()
+}
@@ -0,0 +1,136 @@
+// Command httpcloak-probe checks URLs with a browser-shaped client and
+// declarative assertions, for uptime checks and synthetic monitoring.
+//
+//	httpcloak-probe -status 200 -header 'Content-Type: ^text/html' -contains '<title>' https://example.com/
+//
+// Each check prints one logfmt line. The exit code is 0 if every URL passed,
+// 1 if any failed and 2 on bad usage. With -interval it keeps probing.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sardanioss/httpcloak/client"
+)
+
+// listFlag collects a flag given several times
+type listFlag []string
+
+func (l *listFlag) String() string     { return strings.Join(*l, ", ") }
+func (l *listFlag) Set(v string) error { *l = append(*l, v); return nil }
+
+func main() {
+	preset := flag.String("preset", "chrome-latest", "browser fingerprint preset")
+	timeout := flag.Duration("timeout", 30*time.Second, "per-request timeout")
+	interval := flag.Duration("interval", 0, "probe again every interval (0 = once)")
+	method := flag.String("method", "GET", "request method")
+	status := flag.String("status", "", "acceptable status codes, comma-separated")
+	var headers, contains, jsonChecks listFlag
+	flag.Var(&headers, "header", "'Name: regexp' the response header must match (repeatable)")
+	flag.Var(&contains, "contains", "substring the body must contain (repeatable)")
+	flag.Var(&jsonChecks, "json", "'$.path=value' the JSON body must hold, or '$.path' to require it (repeatable)")
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: httpcloak-probe [flags] URL...")
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+	expect, err := buildExpect(*status, headers, contains, jsonChecks)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "httpcloak-probe:", err)
+		os.Exit(2)
+	}
+
+	c := client.NewClient(*preset, client.WithTimeout(*timeout))
+	defer c.Close()
+
+	for {
+		ok := true
+		for _, url := range flag.Args() {
+			if !probe(c, *method, url, expect, *timeout) {
+				ok = false
+			}
+		}
+		if *interval <= 0 {
+			if !ok {
+				os.Exit(1)
+			}
+			return
+		}
+		time.Sleep(*interval)
+	}
+}
+
+// probe runs one check and prints its result
+func probe(c *client.Client, method, url string, expect *client.Expect, timeout time.Duration) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	start := time.Now()
+	resp, err := c.Do(ctx, &client.Request{Method: method, URL: url, Expect: expect})
+	elapsed := time.Since(start).Round(time.Millisecond)
+	if resp != nil {
+		defer resp.Close()
+	}
+
+	line := fmt.Sprintf("probe url=%q duration=%s", url, elapsed)
+	if resp != nil {
+		line += fmt.Sprintf(" status=%d proto=%s", resp.StatusCode, resp.Protocol)
+	}
+	if err != nil {
+		line += fmt.Sprintf(" ok=false err=%q", err.Error())
+	} else {
+		line += " ok=true"
+	}
+	fmt.Println(line)
+	return err == nil
+}
+
+func buildExpect(status string, headers, contains, jsonChecks []string) (*client.Expect, error) {
+	expect := &client.Expect{BodyContains: contains}
+	for _, s := range strings.Split(status, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		code, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, fmt.Errorf("bad status %q", s)
+		}
+		expect.Status = append(expect.Status, code)
+	}
+	for _, h := range headers {
+		name, pattern, ok := strings.Cut(h, ":")
+		if !ok {
+			return nil, fmt.Errorf("bad -header %q, want 'Name: regexp'", h)
+		}
+		if expect.Headers == nil {
+			expect.Headers = make(map[string]string)
+		}
+		expect.Headers[strings.TrimSpace(name)] = strings.TrimSpace(pattern)
+	}
+	for _, j := range jsonChecks {
+		if expect.JSON == nil {
+			expect.JSON = make(map[string]any)
+		}
+		path, raw, ok := strings.Cut(j, "=")
+		if !ok {
+			expect.JSON[path] = nil
+			continue
+		}
+		// A value that isn't JSON is taken as a string
+		var value any
+		if err := json.Unmarshal([]byte(raw), &value); err != nil {
+			value = raw
+		}
+		expect.JSON[path] = value
+	}
+	return expect, nil
+}
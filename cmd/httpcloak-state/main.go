@@ -0,0 +1,248 @@
+// Command httpcloak-state inspects and maintains saved session files
+// (Session.Save / SessionState) without loading them into a session.
+//
+//	httpcloak-state show FILE...              summarize cookies, tickets and ECH configs
+//	httpcloak-state validate FILE...          report what loading would drop; exit 1 if anything
+//	httpcloak-state migrate [-w] FILE         upgrade a v3/v4 file to the current format
+//	httpcloak-state redact [-w] FILE          blank cookie values, tickets and proxy passwords
+//	httpcloak-state merge [-o OUT] FILE...    combine files, newest cookie and ticket winning
+//
+// migrate, redact and merge print JSON to stdout unless told to write a file.
+// With HTTPCLOAK_STATE_KEY set to a hex AES key, encrypted files
+// (Session.SaveEncrypted) are read and written files are encrypted.
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sardanioss/httpcloak/session"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	cmd, args := os.Args[1], os.Args[2:]
+
+	var err error
+	switch cmd {
+	case "show":
+		err = forEachFile(args, show)
+	case "validate":
+		err = validate(args)
+	case "migrate":
+		err = rewrite(cmd, args, func(*session.SessionState) {})
+	case "redact":
+		err = rewrite(cmd, args, (*session.SessionState).Redact)
+	case "merge":
+		err = merge(args)
+	default:
+		usage()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "httpcloak-state:", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: httpcloak-state show|validate|migrate|redact|merge [flags] FILE...")
+	os.Exit(2)
+}
+
+// stateKey returns the key from HTTPCLOAK_STATE_KEY, or nil if unset
+func stateKey() ([]byte, error) {
+	v := os.Getenv("HTTPCLOAK_STATE_KEY")
+	if v == "" {
+		return nil, nil
+	}
+	key, err := hex.DecodeString(v)
+	if err != nil {
+		return nil, fmt.Errorf("HTTPCLOAK_STATE_KEY: %w", err)
+	}
+	return key, nil
+}
+
+func readState(path string) (*session.SessionState, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if session.IsEncryptedState(data) {
+		key, err := stateKey()
+		if err != nil {
+			return nil, err
+		}
+		if key == nil {
+			return nil, fmt.Errorf("%s is encrypted; set HTTPCLOAK_STATE_KEY", path)
+		}
+		if data, err = session.DecryptState(data, key); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	st, err := session.ReadSessionState(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return st, nil
+}
+
+func writeState(path string, st *session.SessionState) error {
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	if path == "" {
+		_, err = os.Stdout.Write(append(data, '\n'))
+		return err
+	}
+	key, err := stateKey()
+	if err != nil {
+		return err
+	}
+	if key != nil {
+		if data, err = session.EncryptState(data, key); err != nil {
+			return err
+		}
+	}
+	// Session files hold credentials: owner read/write only, as Save writes them
+	return session.WriteFileAtomic(path, data, 0600)
+}
+
+func forEachFile(paths []string, fn func(string, *session.SessionState)) error {
+	if len(paths) == 0 {
+		usage()
+	}
+	for _, path := range paths {
+		st, err := readState(path)
+		if err != nil {
+			return err
+		}
+		fn(path, st)
+	}
+	return nil
+}
+
+func show(path string, st *session.SessionState) {
+	now := time.Now()
+	fmt.Printf("%s\n", path)
+	preset := ""
+	if st.Config != nil {
+		preset = st.Config.Preset
+	}
+	fmt.Printf("  preset %s, created %s, updated %s\n", preset, st.CreatedAt.Format(time.RFC3339), st.UpdatedAt.Format(time.RFC3339))
+	if st.Build != nil {
+		fmt.Printf("  build %+v\n", *st.Build)
+	}
+
+	fmt.Printf("  cookies (%d domains)\n", len(st.Cookies))
+	for _, domain := range sortedKeys(st.Cookies) {
+		var names []string
+		for _, c := range st.Cookies[domain] {
+			name := c.Name
+			if c.Expires != nil && c.Expires.Before(now) {
+				name += " (expired)"
+			}
+			names = append(names, name)
+		}
+		fmt.Printf("    %-32s %s\n", displayDomain(domain), strings.Join(names, ", "))
+	}
+
+	fmt.Printf("  TLS sessions (%d)\n", len(st.TLSSessions))
+	for _, key := range sortedKeys(st.TLSSessions) {
+		fmt.Printf("    %-40s age %s\n", key, now.Sub(st.TLSSessions[key].CreatedAt).Round(time.Second))
+	}
+
+	fmt.Printf("  ECH configs (%d)\n", len(st.ECHConfigs))
+	for _, host := range sortedKeys(st.ECHConfigs) {
+		line := "    " + host
+		if d, ok := st.Discovery[host]; ok && d.ECHExpires != nil {
+			line += " expires " + d.ECHExpires.Format(time.RFC3339)
+		}
+		fmt.Println(line)
+	}
+	fmt.Printf("  discovery %d hosts, cache %d URLs, dns %d hosts\n", len(st.Discovery), len(st.Cache), len(st.DNS))
+}
+
+func validate(paths []string) error {
+	bad := 0
+	err := forEachFile(paths, func(path string, st *session.SessionState) {
+		problems := st.Validate()
+		if len(problems) == 0 {
+			fmt.Printf("%s: ok\n", path)
+			return
+		}
+		bad++
+		for _, p := range problems {
+			fmt.Printf("%s: %v\n", path, p)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if bad > 0 {
+		return fmt.Errorf("%d of %d files have problems", bad, len(paths))
+	}
+	return nil
+}
+
+// rewrite reads one file, applies fn and writes it back (-w) or to stdout
+func rewrite(cmd string, args []string, fn func(*session.SessionState)) error {
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	inPlace := fs.Bool("w", false, "write the result back to the file")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		usage()
+	}
+	path := fs.Arg(0)
+	st, err := readState(path)
+	if err != nil {
+		return err
+	}
+	fn(st)
+	if *inPlace {
+		return writeState(path, st)
+	}
+	return writeState("", st)
+}
+
+func merge(args []string) error {
+	fs := flag.NewFlagSet("merge", flag.ExitOnError)
+	out := fs.String("o", "", "write the merged state to this file instead of stdout")
+	fs.Parse(args)
+	if fs.NArg() < 2 {
+		usage()
+	}
+	var states []*session.SessionState
+	for _, path := range fs.Args() {
+		st, err := readState(path)
+		if err != nil {
+			return err
+		}
+		states = append(states, st)
+	}
+	return writeState(*out, session.MergeSessionStates(states...))
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func displayDomain(domain string) string {
+	if domain == "" {
+		return "(no domain)"
+	}
+	return domain
+}
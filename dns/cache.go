@@ -3,18 +3,20 @@ package dns
 import (
 	"context"
 	"encoding/base64"
+	"errors"
 	"net"
 	"sync"
 	"time"
-
-	"github.com/miekg/dns"
 )
 
 // Entry represents a cached DNS entry
 type Entry struct {
-	IPs       []net.IP
-	ExpiresAt time.Time
-	LookupAt  time.Time
+	IPs       []net.IP  `json:"ips,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
+	LookupAt  time.Time `json:"lookup_at"`
+
+	// NotFound marks a negative entry: the host has no addresses
+	NotFound bool `json:"not_found,omitempty"`
 }
 
 // IsExpired checks if the entry has expired
@@ -24,12 +26,16 @@ func (e *Entry) IsExpired() bool {
 
 // Cache provides TTL-aware DNS caching
 type Cache struct {
-	entries    map[string]*Entry
-	mu         sync.RWMutex
-	resolver   *net.Resolver
-	defaultTTL time.Duration
-	minTTL     time.Duration
-	preferIPv4 bool // If true, prefer IPv4 over IPv6
+	entries     map[string]*Entry
+	mu          sync.RWMutex
+	resolver    *net.Resolver
+	servers     []string      // Queried directly when set, so record TTLs apply
+	defaultTTL  time.Duration // For answers without a TTL (system resolver)
+	minTTL      time.Duration
+	negativeTTL time.Duration // For hosts that don't resolve, absent an SOA
+	preferIPv4  bool          // If true, prefer IPv4 over IPv6
+
+	addressFilter func(host string, ip net.IP) error // Vets every answer (see SetAddressFilter)
 }
 
 // NewCache creates a new DNS cache
@@ -41,14 +47,32 @@ func NewCache() *Cache {
 		PreferGo: false, // Force CGO resolver for shared library compatibility
 	}
 	return &Cache{
-		entries:    make(map[string]*Entry),
-		resolver:   resolver,
-		defaultTTL: 5 * time.Minute,  // Default TTL if not specified
-		minTTL:     30 * time.Second, // Minimum TTL to prevent hammering
-		preferIPv4: false,
+		entries:     make(map[string]*Entry),
+		resolver:    resolver,
+		defaultTTL:  5 * time.Minute,  // Default TTL if not specified
+		minTTL:      30 * time.Second, // Minimum TTL to prevent hammering
+		negativeTTL: 30 * time.Second,
+		preferIPv4:  false,
 	}
 }
 
+// SetServers makes the cache query these nameservers ("host" or
+// "host:port") itself instead of going through the system resolver, so
+// entries live as long as the records' TTLs. Nil restores the system
+// resolver, whose TTLs aren't visible and get the default TTL.
+func (c *Cache) SetServers(servers []string) {
+	var normalized []string
+	for _, server := range servers {
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "53")
+		}
+		normalized = append(normalized, server)
+	}
+	c.mu.Lock()
+	c.servers = normalized
+	c.mu.Unlock()
+}
+
 // SetPreferIPv4 sets whether to prefer IPv4 addresses over IPv6
 func (c *Cache) SetPreferIPv4(prefer bool) {
 	c.mu.Lock()
@@ -63,50 +87,104 @@ func (c *Cache) PreferIPv4() bool {
 	return c.preferIPv4
 }
 
+// SetAddressFilter makes Resolve fail for a host if filter rejects any of
+// its addresses, cached or fresh. Nil removes the filter.
+func (c *Cache) SetAddressFilter(filter func(host string, ip net.IP) error) {
+	c.mu.Lock()
+	c.addressFilter = filter
+	c.mu.Unlock()
+}
+
 // Resolve looks up the IP addresses for a hostname
-// Returns cached result if available and not expired
+// Returns cached result if available and not expired. A host that
+// recently failed to resolve fails again from the cache.
 func (c *Cache) Resolve(ctx context.Context, host string) ([]net.IP, error) {
+	ips, err := c.resolve(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.RLock()
+	filter := c.addressFilter
+	c.mu.RUnlock()
+	if filter != nil {
+		for _, ip := range ips {
+			if err := filter(host, ip); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return ips, nil
+}
+
+func (c *Cache) resolve(ctx context.Context, host string) ([]net.IP, error) {
 	// Check cache first
 	c.mu.RLock()
 	entry, exists := c.entries[host]
 	c.mu.RUnlock()
 
 	if exists && !entry.IsExpired() {
+		if entry.NotFound {
+			return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+		}
 		return entry.IPs, nil
 	}
 
 	// Cache miss or expired - do actual lookup
-	ips, err := c.lookup(ctx, host)
+	ips, ttl, err := c.lookup(ctx, host)
 	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			c.store(host, &Entry{NotFound: true}, ttl)
+			return nil, err
+		}
 		// If lookup fails but we have stale cache, use it
-		if exists {
+		if exists && !entry.NotFound {
 			return entry.IPs, nil
 		}
 		return nil, err
 	}
 
-	// Cache the result
+	c.store(host, &Entry{IPs: ips}, ttl)
+	return ips, nil
+}
+
+// store caches entry for ttl, bounded below by the minimum TTL. A zero ttl
+// means the answer didn't carry one.
+func (c *Cache) store(host string, entry *Entry, ttl time.Duration) {
 	c.mu.Lock()
-	c.entries[host] = &Entry{
-		IPs:       ips,
-		ExpiresAt: time.Now().Add(c.defaultTTL),
-		LookupAt:  time.Now(),
+	defer c.mu.Unlock()
+	switch {
+	case ttl <= 0 && entry.NotFound:
+		ttl = c.negativeTTL
+	case ttl <= 0:
+		ttl = c.defaultTTL
+	case ttl < c.minTTL:
+		ttl = c.minTTL
 	}
-	c.mu.Unlock()
-
-	return ips, nil
+	entry.LookupAt = time.Now()
+	entry.ExpiresAt = entry.LookupAt.Add(ttl)
+	c.entries[host] = entry
 }
 
-// lookup performs the actual DNS lookup
-func (c *Cache) lookup(ctx context.Context, host string) ([]net.IP, error) {
+// lookup performs the actual DNS lookup, returning the answer's TTL when
+// it is known
+func (c *Cache) lookup(ctx context.Context, host string) ([]net.IP, time.Duration, error) {
 	// Check if host is already an IP
 	if ip := net.ParseIP(host); ip != nil {
-		return []net.IP{ip}, nil
+		return []net.IP{ip}, 0, nil
+	}
+
+	c.mu.RLock()
+	servers := c.servers
+	c.mu.RUnlock()
+	if len(servers) > 0 {
+		return queryAddrs(ctx, servers, host)
 	}
 
 	addrs, err := c.resolver.LookupIPAddr(ctx, host)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
 	ips := make([]net.IP, len(addrs))
@@ -114,7 +192,7 @@ func (c *Cache) lookup(ctx context.Context, host string) ([]net.IP, error) {
 		ips[i] = addr.IP
 	}
 
-	return ips, nil
+	return ips, 0, nil
 }
 
 // ResolveOne returns a single IP address for the hostname
@@ -239,6 +317,44 @@ func (c *Cache) Clear() {
 	c.mu.Unlock()
 }
 
+// SetNegativeTTL sets how long a host that doesn't resolve is remembered
+// when the answer doesn't say (always, with the system resolver)
+func (c *Cache) SetNegativeTTL(ttl time.Duration) {
+	c.mu.Lock()
+	c.negativeTTL = ttl
+	c.mu.Unlock()
+}
+
+// Export returns copies of the unexpired entries keyed by host, for saving
+// alongside a session
+func (c *Cache) Export() map[string]Entry {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	result := make(map[string]Entry)
+	for host, entry := range c.entries {
+		if !entry.IsExpired() {
+			result[host] = *entry
+		}
+	}
+	return result
+}
+
+// Import adds entries saved by Export, skipping those that have expired
+// since
+func (c *Cache) Import(entries map[string]Entry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for host, entry := range entries {
+		if entry.IsExpired() {
+			continue
+		}
+		entry := entry
+		c.entries[host] = &entry
+	}
+}
+
 // SetTTL sets the default TTL for cached entries
 func (c *Cache) SetTTL(ttl time.Duration) {
 	if ttl < c.minTTL {
@@ -367,53 +483,38 @@ func FetchECHConfigs(ctx context.Context, hostname string) ([]byte, error) {
 	return echConfigList, nil
 }
 
-// queryECHFromDNS queries HTTPS records and extracts ECH config
-func queryECHFromDNS(ctx context.Context, hostname string) ([]byte, uint32, error) {
-	// Create DNS client with short timeout - ECH is optional, shouldn't block connections
-	client := &dns.Client{
-		Timeout: 500 * time.Millisecond, // Short timeout - ECH is optional
+// ECHConfigExpiry returns when the cached ECH config for hostname expires,
+// based on the TTL of the HTTPS record it came from.
+func ECHConfigExpiry(hostname string) (time.Time, bool) {
+	if hostname == "" {
+		return time.Time{}, false
 	}
+	echCacheMu.RLock()
+	defer echCacheMu.RUnlock()
+	entry, ok := echCache[hostname]
+	if !ok {
+		return time.Time{}, false
+	}
+	return entry.ExpiresAt, true
+}
 
-	// Create HTTPS query (type 65)
-	msg := new(dns.Msg)
-	msg.SetQuestion(dns.Fqdn(hostname), dns.TypeHTTPS)
-	msg.RecursionDesired = true
-
-	// Use configured DNS servers (defaults to well-known public DNS)
-	dnsServers := GetECHDNSServers()
-
-	var lastErr error
-	for _, server := range dnsServers {
-		resp, _, err := client.ExchangeContext(ctx, msg, server)
-		if err != nil {
-			lastErr = err
-			continue
-		}
-
-		if resp.Rcode != dns.RcodeSuccess {
-			continue
-		}
-
-		// Parse HTTPS records for ECH config
-		for _, answer := range resp.Answer {
-			if https, ok := answer.(*dns.HTTPS); ok {
-				for _, kv := range https.Value {
-					if kv.Key() == dns.SVCB_ECHCONFIG {
-						// ECH config is base64 encoded in the SVCB record
-						echParam, ok := kv.(*dns.SVCBECHConfig)
-						if ok && len(echParam.ECH) > 0 {
-							return echParam.ECH, https.Hdr.Ttl, nil
-						}
-					}
-				}
-			}
+// queryECHFromDNS returns the ECH config of the most preferred HTTPS record
+// carrying one, with the lookup's remaining TTL in seconds
+func queryECHFromDNS(ctx context.Context, hostname string) ([]byte, uint32, error) {
+	entry, err := lookupHTTPS(ctx, hostname)
+	if err != nil {
+		return nil, 0, err
+	}
+	var ttl uint32
+	if remaining := time.Until(entry.expiresAt); remaining > 0 {
+		ttl = uint32(remaining / time.Second)
+	}
+	for _, r := range entry.records {
+		if len(r.ECHConfigList) > 0 {
+			return r.ECHConfigList, ttl, nil
 		}
-
-		// No ECH found in this response, but query succeeded
-		return nil, 300, nil
 	}
-
-	return nil, 0, lastErr
+	return nil, ttl, nil
 }
 
 // FetchECHConfigsBase64 returns ECH configs as base64 string (for debugging)
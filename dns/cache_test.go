@@ -0,0 +1,82 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// serveZone answers A queries for a.test and NXDOMAIN for everything else,
+// counting the queries it gets
+func serveZone(t *testing.T, queries *atomic.Int32) string {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &dns.Server{PacketConn: pc, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		queries.Add(1)
+		resp := new(dns.Msg)
+		resp.SetReply(req)
+		q := req.Question[0]
+		switch {
+		case q.Name == "a.test." && q.Qtype == dns.TypeA:
+			rr, _ := dns.NewRR("a.test. 120 IN A 192.0.2.7")
+			resp.Answer = append(resp.Answer, rr)
+		case q.Name != "a.test.":
+			resp.Rcode = dns.RcodeNameError
+			rr, _ := dns.NewRR("test. 3600 IN SOA ns.test. admin.test. 1 7200 900 1209600 90")
+			resp.Ns = append(resp.Ns, rr)
+		}
+		w.WriteMsg(resp)
+	})}
+	go server.ActivateAndServe()
+	t.Cleanup(func() { server.Shutdown() })
+	return pc.LocalAddr().String()
+}
+
+func TestCacheRecordTTLs(t *testing.T) {
+	var queries atomic.Int32
+	c := NewCache()
+	c.SetServers([]string{serveZone(t, &queries)})
+	ctx := context.Background()
+
+	ips, err := c.Resolve(ctx, "a.test")
+	if err != nil || len(ips) != 1 || !ips[0].Equal(net.IPv4(192, 0, 2, 7)) {
+		t.Fatalf("Resolve = %v, %v", ips, err)
+	}
+	entries := c.Export()
+	if ttl := time.Until(entries["a.test"].ExpiresAt); ttl < 110*time.Second || ttl > 120*time.Second {
+		t.Errorf("a.test cached for %v, want the record's 120s", ttl)
+	}
+
+	// The SOA minimum bounds how long a missing host is remembered
+	for range 2 {
+		var dnsErr *net.DNSError
+		if _, err := c.Resolve(ctx, "missing.test"); !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+			t.Fatalf("missing.test: %v", err)
+		}
+	}
+	if n := queries.Load(); n != 3 { // AAAA and A for a.test, one NXDOMAIN
+		t.Errorf("%d queries, want 3", n)
+	}
+	entries = c.Export()
+	if e := entries["missing.test"]; !e.NotFound || time.Until(e.ExpiresAt) > 90*time.Second {
+		t.Errorf("missing.test entry = %+v", e)
+	}
+
+	// A restored cache answers from the saved entries
+	restored := NewCache()
+	entries["stale.test"] = Entry{IPs: []net.IP{net.IPv4(192, 0, 2, 9)}, ExpiresAt: time.Now().Add(-time.Second)}
+	restored.Import(entries)
+	if ips, err := restored.Resolve(ctx, "a.test"); err != nil || !ips[0].Equal(net.IPv4(192, 0, 2, 7)) {
+		t.Errorf("restored Resolve = %v, %v", ips, err)
+	}
+	if _, ok := restored.Export()["stale.test"]; ok {
+		t.Error("expired entry imported")
+	}
+}
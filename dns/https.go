@@ -0,0 +1,187 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// negativeHTTPSTTL is how long a host without HTTPS records is remembered
+const negativeHTTPSTTL = 300 * time.Second
+
+// HTTPSRecord is a ServiceMode HTTPS (type 65) record (RFC 9460): how the
+// host wants to be reached, as browsers read it before connecting
+type HTTPSRecord struct {
+	Priority uint16 // Lower is preferred
+
+	// Target is the alternative endpoint's name. Empty means the queried
+	// host itself.
+	Target string
+
+	ALPN          []string // Protocols offered, e.g. "h3", "h2"
+	NoDefaultALPN bool     // "http/1.1" is not implied
+	Port          uint16   // 0 when the default port applies
+	IPv4Hints     []net.IP
+	IPv6Hints     []net.IP
+	ECHConfigList []byte
+}
+
+// SupportsHTTP3 reports whether the record offers HTTP/3
+func (r HTTPSRecord) SupportsHTTP3() bool {
+	return slices.Contains(r.ALPN, "h3")
+}
+
+// httpsEntry is a cached HTTPS lookup; records is empty for a host without
+// any
+type httpsEntry struct {
+	records   []HTTPSRecord
+	expiresAt time.Time
+}
+
+var (
+	httpsCache   = make(map[string]*httpsEntry)
+	httpsCacheMu sync.RWMutex
+)
+
+// LookupHTTPS returns the host's HTTPS records, most preferred first,
+// following an AliasMode record once. Results are cached for the records'
+// TTL; a host with none returns an empty slice and no error. Queries go to
+// the ECH DNS servers (see SetECHDNSServers).
+func LookupHTTPS(ctx context.Context, hostname string) ([]HTTPSRecord, error) {
+	entry, err := lookupHTTPS(ctx, hostname)
+	if err != nil {
+		return nil, err
+	}
+	return entry.records, nil
+}
+
+// CachedHTTPS returns the HTTPS records of a previous lookup without
+// querying DNS. ok is false when nothing unexpired is cached.
+func CachedHTTPS(hostname string) (records []HTTPSRecord, ok bool) {
+	httpsCacheMu.RLock()
+	defer httpsCacheMu.RUnlock()
+	entry, exists := httpsCache[hostname]
+	if !exists || time.Now().After(entry.expiresAt) {
+		return nil, false
+	}
+	return entry.records, true
+}
+
+// lookupHTTPS is LookupHTTPS returning the cache entry. A failed query
+// falls back to an expired entry if there is one.
+func lookupHTTPS(ctx context.Context, hostname string) (*httpsEntry, error) {
+	httpsCacheMu.RLock()
+	cached, exists := httpsCache[hostname]
+	httpsCacheMu.RUnlock()
+	if exists && time.Now().Before(cached.expiresAt) {
+		return cached, nil
+	}
+
+	records, ttl, err := queryHTTPS(ctx, hostname)
+	if err != nil {
+		if exists {
+			return cached, nil
+		}
+		return nil, err
+	}
+	entry := &httpsEntry{records: records, expiresAt: time.Now().Add(ttl)}
+	httpsCacheMu.Lock()
+	httpsCache[hostname] = entry
+	httpsCacheMu.Unlock()
+	return entry, nil
+}
+
+// queryHTTPS asks the ECH DNS servers for hostname's HTTPS records and
+// returns the ServiceMode ones sorted by priority, with the lowest TTL seen
+func queryHTTPS(ctx context.Context, hostname string) ([]HTTPSRecord, time.Duration, error) {
+	// Short timeout - the records are optional, they shouldn't block connections
+	client := &dns.Client{Timeout: 500 * time.Millisecond}
+
+	name := hostname
+	for hops := 0; ; hops++ {
+		msg := new(dns.Msg)
+		msg.SetQuestion(dns.Fqdn(name), dns.TypeHTTPS)
+		msg.RecursionDesired = true
+
+		resp, err := exchange(ctx, client, GetECHDNSServers(), msg)
+		if err != nil {
+			return nil, 0, err
+		}
+		if resp.Rcode != dns.RcodeSuccess {
+			return nil, negativeHTTPSTTL, nil
+		}
+
+		var records []HTTPSRecord
+		var alias string
+		ttl := negativeHTTPSTTL
+		for i, answer := range resp.Answer {
+			https, ok := answer.(*dns.HTTPS)
+			if !ok {
+				continue
+			}
+			if recordTTL := time.Duration(https.Hdr.Ttl) * time.Second; i == 0 || recordTTL < ttl {
+				ttl = recordTTL
+			}
+			if https.Priority == 0 {
+				alias = strings.TrimSuffix(https.Target, ".")
+				continue
+			}
+			records = append(records, parseHTTPSRecord(https))
+		}
+
+		// Alias mode points at another name to query; ServiceMode records
+		// at this name take precedence
+		if len(records) == 0 && alias != "" && hops == 0 {
+			name = alias
+			continue
+		}
+		slices.SortStableFunc(records, func(a, b HTTPSRecord) int {
+			return int(a.Priority) - int(b.Priority)
+		})
+		return records, ttl, nil
+	}
+}
+
+// exchange sends msg to each server in turn until one answers
+func exchange(ctx context.Context, client *dns.Client, servers []string, msg *dns.Msg) (*dns.Msg, error) {
+	var lastErr error
+	for _, server := range servers {
+		resp, _, err := client.ExchangeContext(ctx, msg, server)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		return resp, nil
+	}
+	return nil, lastErr
+}
+
+// parseHTTPSRecord converts a ServiceMode record's parameters
+func parseHTTPSRecord(https *dns.HTTPS) HTTPSRecord {
+	r := HTTPSRecord{
+		Priority: https.Priority,
+		Target:   strings.TrimSuffix(https.Target, "."),
+	}
+	for _, kv := range https.Value {
+		switch v := kv.(type) {
+		case *dns.SVCBAlpn:
+			r.ALPN = v.Alpn
+		case *dns.SVCBNoDefaultAlpn:
+			r.NoDefaultALPN = true
+		case *dns.SVCBPort:
+			r.Port = v.Port
+		case *dns.SVCBIPv4Hint:
+			r.IPv4Hints = v.Hint
+		case *dns.SVCBIPv6Hint:
+			r.IPv6Hints = v.Hint
+		case *dns.SVCBECHConfig:
+			r.ECHConfigList = v.ECH
+		}
+	}
+	return r
+}
@@ -0,0 +1,35 @@
+package dns
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestParseHTTPSRecord(t *testing.T) {
+	rr, err := dns.NewRR(`example.com. 300 IN HTTPS 1 . alpn="h3,h2" port=8443 ipv4hint=192.0.2.1 ech=AEX+DQBBpQAgACB/`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := parseHTTPSRecord(rr.(*dns.HTTPS))
+	if !r.SupportsHTTP3() || r.Port != 8443 || r.Target != "" || len(r.IPv4Hints) != 1 || len(r.ECHConfigList) == 0 {
+		t.Errorf("parsed %+v", r)
+	}
+
+	// ECH comes from the most preferred record that has a config
+	httpsCacheMu.Lock()
+	httpsCache["ech.example"] = &httpsEntry{
+		records:   []HTTPSRecord{{Priority: 1, ALPN: []string{"h2"}}, {Priority: 2, ECHConfigList: []byte{1, 2}}},
+		expiresAt: time.Now().Add(time.Minute),
+	}
+	httpsCacheMu.Unlock()
+	ech, ttl, err := queryECHFromDNS(context.Background(), "ech.example")
+	if err != nil || len(ech) != 2 || ttl == 0 || ttl > 60 {
+		t.Errorf("ECH = %v, ttl %d, err %v", ech, ttl, err)
+	}
+	if records, ok := CachedHTTPS("ech.example"); !ok || records[0].SupportsHTTP3() {
+		t.Errorf("cached records = %+v, %v", records, ok)
+	}
+}
@@ -0,0 +1,61 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// queryAddrs resolves host's AAAA and A records against servers, returning
+// the lowest TTL among the answers. A name with neither is not found, for
+// as long as the zone's SOA says (RFC 2308) or 0 when there was none.
+func queryAddrs(ctx context.Context, servers []string, host string) ([]net.IP, time.Duration, error) {
+	client := &dns.Client{Timeout: 2 * time.Second}
+
+	var ips []net.IP
+	var ttl, negativeTTL time.Duration
+	for _, qtype := range []uint16{dns.TypeAAAA, dns.TypeA} {
+		msg := new(dns.Msg)
+		msg.SetQuestion(dns.Fqdn(host), qtype)
+		msg.RecursionDesired = true
+
+		resp, err := exchange(ctx, client, servers, msg)
+		if err != nil {
+			return nil, 0, &net.DNSError{Err: err.Error(), Name: host, IsTemporary: true}
+		}
+		if resp.Rcode != dns.RcodeSuccess && resp.Rcode != dns.RcodeNameError {
+			return nil, 0, &net.DNSError{Err: dns.RcodeToString[resp.Rcode], Name: host, IsTemporary: true}
+		}
+
+		for _, rr := range resp.Answer {
+			switch r := rr.(type) {
+			case *dns.AAAA:
+				ips = append(ips, r.AAAA)
+			case *dns.A:
+				ips = append(ips, r.A)
+			default:
+				continue // CNAMEs on the way
+			}
+			// A TTL of 0 still gets cached for the minimum TTL
+			recordTTL := max(time.Duration(rr.Header().Ttl)*time.Second, time.Second)
+			if ttl == 0 || recordTTL < ttl {
+				ttl = recordTTL
+			}
+		}
+		for _, rr := range resp.Ns {
+			if soa, ok := rr.(*dns.SOA); ok {
+				negativeTTL = time.Duration(min(soa.Hdr.Ttl, soa.Minttl)) * time.Second
+			}
+		}
+		if resp.Rcode == dns.RcodeNameError {
+			break // No other record type exists either
+		}
+	}
+
+	if len(ips) == 0 {
+		return nil, negativeTTL, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	return ips, ttl, nil
+}
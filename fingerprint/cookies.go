@@ -0,0 +1,126 @@
+package fingerprint
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// MaxCookieHeaderBytes is the default budget for a Cookie header value:
+// Apache's and nginx's default 8190-byte request line limit, minus the
+// "Cookie: " field name. Servers reject anything longer with a 400 (or 431),
+// so sending fewer cookies is the only way the request gets through.
+const MaxCookieHeaderBytes = 8190 - len("Cookie: ")
+
+// Chrome's cookie store limits. A cookie whose name and value together
+// exceed MaxCookieBytes is refused. A registrable domain (eTLD+1) holding
+// more than MaxCookiesPerDomain cookies is purged down to 150, and a store
+// holding more than MaxCookies down to 3000, in CookieEvictionOrder.
+const (
+	MaxCookieBytes      = 4096
+	MaxCookiesPerDomain = 180
+	MaxCookies          = 3300
+)
+
+// CookiePriority is the Chrome Priority cookie attribute. Chrome evicts
+// Low cookies before Medium and Medium before High.
+type CookiePriority int
+
+const (
+	CookiePriorityLow CookiePriority = iota
+	CookiePriorityMedium
+	CookiePriorityHigh
+)
+
+// ParseCookiePriority parses a Priority attribute value. Anything other than
+// Low or High is Medium, which is also the default without the attribute.
+func ParseCookiePriority(value string) CookiePriority {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "low":
+		return CookiePriorityLow
+	case "high":
+		return CookiePriorityHigh
+	}
+	return CookiePriorityMedium
+}
+
+func (p CookiePriority) String() string {
+	switch p {
+	case CookiePriorityLow:
+		return "Low"
+	case CookiePriorityHigh:
+		return "High"
+	}
+	return "Medium"
+}
+
+// CookieCandidate is one cookie to be sent in a Cookie header
+type CookieCandidate struct {
+	Name     string
+	Value    string
+	Secure   bool
+	Priority CookiePriority
+	Created  time.Time
+}
+
+// FitCookieHeader returns the indices of the cookies to send so that the
+// joined "name=value; name=value" header stays within maxBytes, in their
+// original order. Cookies are dropped in Chrome's eviction order: by
+// priority, non-secure before secure of the same priority, oldest first.
+// A maxBytes of zero or less keeps everything.
+func FitCookieHeader(cookies []CookieCandidate, maxBytes int) []int {
+	keep := make([]int, len(cookies))
+	size := 0
+	for i, c := range cookies {
+		keep[i] = i
+		size += len(c.Name) + 1 + len(c.Value)
+	}
+	size += 2 * max(len(cookies)-1, 0)
+	if maxBytes <= 0 || size <= maxBytes {
+		return keep
+	}
+
+	order := CookieEvictionOrder(cookies)
+	dropped := make([]bool, len(cookies))
+	remaining := len(cookies)
+	for _, i := range order {
+		if size <= maxBytes {
+			break
+		}
+		size -= len(cookies[i].Name) + 1 + len(cookies[i].Value)
+		if remaining > 1 {
+			size -= 2
+		}
+		remaining--
+		dropped[i] = true
+	}
+
+	keep = keep[:0]
+	for i := range cookies {
+		if !dropped[i] {
+			keep = append(keep, i)
+		}
+	}
+	return keep
+}
+
+// CookieEvictionOrder returns the indices of cookies in the order Chrome
+// evicts them: by priority, non-secure before secure of the same priority,
+// oldest first
+func CookieEvictionOrder(cookies []CookieCandidate) []int {
+	order := make([]int, len(cookies))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		ca, cb := cookies[order[a]], cookies[order[b]]
+		if ca.Priority != cb.Priority {
+			return ca.Priority < cb.Priority
+		}
+		if ca.Secure != cb.Secure {
+			return !ca.Secure
+		}
+		return ca.Created.Before(cb.Created)
+	})
+	return order
+}
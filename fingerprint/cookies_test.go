@@ -0,0 +1,62 @@
+package fingerprint
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func cookieHeaderLen(cookies []CookieCandidate, keep []int) int {
+	parts := make([]string, len(keep))
+	for i, k := range keep {
+		parts[i] = cookies[k].Name + "=" + cookies[k].Value
+	}
+	return len(strings.Join(parts, "; "))
+}
+
+func TestFitCookieHeader(t *testing.T) {
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	big := strings.Repeat("v", 3000)
+	cookies := []CookieCandidate{
+		{Name: "session", Value: big, Secure: true, Priority: CookiePriorityHigh, Created: base},
+		{Name: "tracker_old", Value: big, Priority: CookiePriorityLow, Created: base},
+		{Name: "prefs", Value: big, Priority: CookiePriorityMedium, Created: base.Add(time.Minute)},
+		{Name: "tracker_new", Value: big, Priority: CookiePriorityLow, Created: base.Add(time.Hour)},
+		{Name: "csrf", Value: big, Secure: true, Priority: CookiePriorityMedium, Created: base},
+		{Name: "ab", Value: big, Priority: CookiePriorityMedium, Created: base.Add(2 * time.Minute)},
+	}
+
+	tests := []struct {
+		name  string
+		limit int
+		want  []string
+	}{
+		// Apache/nginx default: Low cookies go first, then the oldest
+		// non-secure Medium one
+		{"8K", MaxCookieHeaderBytes, []string{"session", "csrf"}},
+		// 16K servers (IIS, larger proxies): dropping the older Low cookie is enough
+		{"16K", 16384, []string{"session", "prefs", "tracker_new", "csrf", "ab"}},
+		{"unlimited", 0, []string{"session", "tracker_old", "prefs", "tracker_new", "csrf", "ab"}},
+	}
+	for _, tt := range tests {
+		keep := FitCookieHeader(cookies, tt.limit)
+		var got []string
+		for _, k := range keep {
+			got = append(got, cookies[k].Name)
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s: kept %v, want %v", tt.name, got, tt.want)
+		}
+		if tt.limit > 0 && cookieHeaderLen(cookies, keep) > tt.limit {
+			t.Errorf("%s: header is %d bytes, limit %d", tt.name, cookieHeaderLen(cookies, keep), tt.limit)
+		}
+	}
+}
+
+func TestParseCookiePriority(t *testing.T) {
+	for value, want := range map[string]CookiePriority{"Low": CookiePriorityLow, "HIGH": CookiePriorityHigh, "medium": CookiePriorityMedium, "": CookiePriorityMedium, "urgent": CookiePriorityMedium} {
+		if got := ParseCookiePriority(value); got != want {
+			t.Errorf("ParseCookiePriority(%q) = %v, want %v", value, got, want)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package fingerprint
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// NewRequestContext starts a RequestContext for a request to targetURL, for
+// fetches the helper contexts don't cover. The chained methods fill in the
+// rest; Sec-Fetch-Site stays "none" until From sets an initiator.
+//
+//	ctx := fingerprint.NewRequestContext(fingerprint.FetchModeNavigate, fingerprint.FetchDestIFrame, widgetURL).
+//		From(pageURL).
+//		InFrame(pageURL)
+//	if err := ctx.Validate(); err != nil { ... }
+//	headers := ctx.HeaderMap()
+func NewRequestContext(mode FetchMode, dest FetchDest, targetURL string) RequestContext {
+	return RequestContext{
+		Mode:      mode,
+		Dest:      dest,
+		Site:      FetchSiteNone,
+		TargetURL: targetURL,
+	}
+}
+
+// From sets the document (or worker script) that makes the request and
+// derives Sec-Fetch-Site from it
+func (c RequestContext) From(initiator string) RequestContext {
+	c.Referrer = initiator
+	c.Site = calculateFetchSite(initiator, c.TargetURL)
+	return c
+}
+
+// WithSite overrides the derived Sec-Fetch-Site, e.g. for a redirect chain
+// that crossed sites
+func (c RequestContext) WithSite(site FetchSite) RequestContext {
+	c.Site = site
+	return c
+}
+
+// WithUserActivation marks a navigation the user started (click, keypress),
+// which sends Sec-Fetch-User
+func (c RequestContext) WithUserActivation() RequestContext {
+	c.IsUserTriggered = true
+	return c
+}
+
+// InFrame records that the request comes from a frame embedded in the page
+// at ancestorURL. Without an initiator, the frame's own navigation is
+// attributed to that page.
+func (c RequestContext) InFrame(ancestorURL string) RequestContext {
+	c.AncestorOrigin = originOf(ancestorURL)
+	if c.Referrer == "" && ancestorURL != "" {
+		c.Site = calculateFetchSite(ancestorURL, c.TargetURL)
+	}
+	return c
+}
+
+// CrossSiteAncestor reports whether the top-level page is on a different
+// site than the target. Browsers withhold SameSite cookies from such frames.
+func (c RequestContext) CrossSiteAncestor() bool {
+	return c.AncestorOrigin != "" && calculateFetchSite(c.AncestorOrigin, c.TargetURL) == FetchSiteCrossSite
+}
+
+// Validate reports combinations no browser sends
+func (c RequestContext) Validate() error {
+	if c.Mode == "" || c.Dest == "" || c.Site == "" {
+		return fmt.Errorf("fetch context needs a mode, destination and site")
+	}
+	switch c.Dest {
+	case FetchDestDocument, FetchDestIFrame, FetchDestFrame:
+		if c.Mode != FetchModeNavigate {
+			return fmt.Errorf("%s requests are navigations, not %s", c.Dest, c.Mode)
+		}
+	case FetchDestEmbed, FetchDestObject:
+		if c.Mode != FetchModeNavigate && c.Mode != FetchModeNoCORS {
+			return fmt.Errorf("%s requests are navigate or no-cors, not %s", c.Dest, c.Mode)
+		}
+	case FetchDestWorker, FetchDestSharedWorker, FetchDestServiceWorker:
+		if c.Mode != FetchModeSameOrigin {
+			return fmt.Errorf("%s scripts load in same-origin mode, not %s", c.Dest, c.Mode)
+		}
+	case FetchDestWebSocket:
+		if c.Mode != FetchModeWebSocket {
+			return fmt.Errorf("websocket requests use websocket mode, not %s", c.Mode)
+		}
+	default:
+		if c.Mode == FetchModeNavigate {
+			return fmt.Errorf("navigations go to a document, frame, embed or object, not %s", c.Dest)
+		}
+	}
+	if c.Mode == FetchModeWebSocket && c.Dest != FetchDestWebSocket && c.Dest != FetchDestEmpty {
+		return fmt.Errorf("websocket mode requests have destination websocket or empty, not %s", c.Dest)
+	}
+	if c.IsUserTriggered && c.Mode != FetchModeNavigate {
+		return fmt.Errorf("user activation only applies to navigations")
+	}
+	if c.Site == FetchSiteNone && c.Mode != FetchModeNavigate {
+		return fmt.Errorf("only navigations can have Sec-Fetch-Site none")
+	}
+	if c.Site == FetchSiteNone && c.AncestorOrigin != "" {
+		return fmt.Errorf("frame requests always have an initiating site")
+	}
+	return nil
+}
+
+// HeaderMap returns the context's Sec-Fetch-* headers, ready to merge into
+// request headers
+func (c RequestContext) HeaderMap() map[string][]string {
+	h := GenerateSecFetchHeaders(c)
+	headers := map[string][]string{
+		"Sec-Fetch-Site": {h.Site},
+		"Sec-Fetch-Mode": {h.Mode},
+		"Sec-Fetch-Dest": {h.Dest},
+	}
+	if h.User != "" {
+		headers["Sec-Fetch-User"] = []string{h.User}
+	}
+	return headers
+}
+
+// IFrameContext returns a RequestContext for a frame navigation started by
+// the page embedding it
+func IFrameContext(pageURL, targetURL string) RequestContext {
+	return NewRequestContext(FetchModeNavigate, FetchDestIFrame, targetURL).
+		From(pageURL).
+		InFrame(pageURL)
+}
+
+// WorkerScriptContext returns a RequestContext for loading a worker's
+// script; dest is FetchDestWorker, FetchDestSharedWorker or
+// FetchDestServiceWorker
+func WorkerScriptContext(dest FetchDest, pageURL, scriptURL string) RequestContext {
+	return NewRequestContext(FetchModeSameOrigin, dest, scriptURL).From(pageURL)
+}
+
+// WorkerFetchContext returns a RequestContext for fetch() called inside a
+// worker. The initiator is the worker's script, not the page.
+func WorkerFetchContext(scriptURL, targetURL string) RequestContext {
+	return NewRequestContext(FetchModeCORS, FetchDestEmpty, targetURL).From(scriptURL)
+}
+
+// originOf returns the scheme://host[:port] of rawURL, or "" if it has none
+func originOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return ""
+	}
+	return u.Scheme + "://" + u.Host
+}
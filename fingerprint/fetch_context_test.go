@@ -0,0 +1,44 @@
+package fingerprint
+
+import "testing"
+
+func TestRequestContextBuilder(t *testing.T) {
+	ctx := IFrameContext("https://shop.example/checkout", "https://pay.other.com/widget")
+	if err := ctx.Validate(); err != nil {
+		t.Fatalf("iframe context invalid: %v", err)
+	}
+	h := ctx.HeaderMap()
+	if h["Sec-Fetch-Dest"][0] != "iframe" || h["Sec-Fetch-Mode"][0] != "navigate" || h["Sec-Fetch-Site"][0] != "cross-site" {
+		t.Errorf("iframe headers = %v", h)
+	}
+	if _, ok := h["Sec-Fetch-User"]; ok {
+		t.Error("frame loaded by the page should not send Sec-Fetch-User")
+	}
+	if ctx.AncestorOrigin != "https://shop.example" || !ctx.CrossSiteAncestor() {
+		t.Errorf("ancestor = %q, cross-site = %v", ctx.AncestorOrigin, ctx.CrossSiteAncestor())
+	}
+
+	// fetch() in a worker is attributed to the worker's script
+	ctx = WorkerFetchContext("https://cdn.example.com/worker.js", "https://api.example.com/data")
+	if ctx.Site != FetchSiteSameSite || ctx.Dest != FetchDestEmpty || ctx.Validate() != nil {
+		t.Errorf("worker fetch = %+v", ctx)
+	}
+
+	ctx = NewRequestContext(FetchModeNavigate, FetchDestDocument, "https://example.com/").WithUserActivation()
+	if got := ctx.HeaderMap()["Sec-Fetch-User"]; len(got) != 1 || got[0] != "?1" {
+		t.Errorf("Sec-Fetch-User = %v, want ?1", got)
+	}
+
+	invalid := []RequestContext{
+		NewRequestContext(FetchModeCORS, FetchDestDocument, "https://example.com/").From("https://example.com/"),
+		NewRequestContext(FetchModeNavigate, FetchDestImage, "https://example.com/a.png"),
+		NewRequestContext(FetchModeCORS, FetchDestWorker, "https://example.com/w.js").From("https://example.com/"),
+		NewRequestContext(FetchModeCORS, FetchDestEmpty, "https://example.com/api"), // No initiator
+		NewRequestContext(FetchModeNoCORS, FetchDestImage, "https://example.com/a.png").From("https://example.com/").WithUserActivation(),
+	}
+	for _, ctx := range invalid {
+		if ctx.Validate() == nil {
+			t.Errorf("%s/%s/%s should be invalid", ctx.Mode, ctx.Dest, ctx.Site)
+		}
+	}
+}
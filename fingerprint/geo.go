@@ -0,0 +1,108 @@
+package fingerprint
+
+import "strings"
+
+// countryLocales lists the locales a browser installed in a country most
+// likely runs with, most common first. Countries with several official
+// languages list each of them; any match is consistent.
+var countryLocales = map[string][]string{
+	"AE": {"ar-AE", "en-AE"},
+	"AR": {"es-AR"},
+	"AT": {"de-AT"},
+	"AU": {"en-AU"},
+	"BE": {"nl-BE", "fr-BE", "de-BE"},
+	"BG": {"bg-BG"},
+	"BR": {"pt-BR"},
+	"CA": {"en-CA", "fr-CA"},
+	"CH": {"de-CH", "fr-CH", "it-CH"},
+	"CL": {"es-CL"},
+	"CN": {"zh-CN"},
+	"CO": {"es-CO"},
+	"CZ": {"cs-CZ"},
+	"DE": {"de-DE"},
+	"DK": {"da-DK"},
+	"EG": {"ar-EG"},
+	"ES": {"es-ES", "ca-ES"},
+	"FI": {"fi-FI", "sv-FI"},
+	"FR": {"fr-FR"},
+	"GB": {"en-GB"},
+	"GR": {"el-GR"},
+	"HK": {"zh-HK", "en-HK"},
+	"HU": {"hu-HU"},
+	"ID": {"id-ID"},
+	"IE": {"en-IE"},
+	"IL": {"he-IL"},
+	"IN": {"en-IN", "hi-IN"},
+	"IT": {"it-IT"},
+	"JP": {"ja-JP"},
+	"KR": {"ko-KR"},
+	"MX": {"es-MX"},
+	"MY": {"ms-MY", "en-MY"},
+	"NG": {"en-NG"},
+	"NL": {"nl-NL"},
+	"NO": {"nb-NO"},
+	"NZ": {"en-NZ"},
+	"PH": {"en-PH", "fil-PH"},
+	"PK": {"en-PK", "ur-PK"},
+	"PL": {"pl-PL"},
+	"PT": {"pt-PT"},
+	"RO": {"ro-RO"},
+	"RU": {"ru-RU"},
+	"SA": {"ar-SA"},
+	"SE": {"sv-SE"},
+	"SG": {"en-SG", "zh-SG"},
+	"SK": {"sk-SK"},
+	"TH": {"th-TH"},
+	"TR": {"tr-TR"},
+	"TW": {"zh-TW"},
+	"UA": {"uk-UA"},
+	"US": {"en-US"},
+	"VN": {"vi-VN"},
+	"ZA": {"en-ZA"},
+}
+
+// AcceptLanguageFor returns the Accept-Language a browser set up for the
+// country's main locale sends: Chrome lists the locale, its language and
+// English; Firefox's localized builds send the bare language first. country
+// is an ISO 3166-1 alpha-2 code; it returns "" for countries it doesn't know.
+func AcceptLanguageFor(country string, firefox bool) string {
+	locales := countryLocales[strings.ToUpper(country)]
+	if len(locales) == 0 {
+		return ""
+	}
+	locale := locales[0]
+	lang, _, _ := strings.Cut(locale, "-")
+
+	switch {
+	case locale == "en-US" && firefox:
+		return "en-US,en;q=0.5"
+	case locale == "en-US":
+		return "en-US,en;q=0.9"
+	case lang == "en" && firefox:
+		return locale + ",en;q=0.5"
+	case lang == "en":
+		return locale + ",en-US;q=0.9,en;q=0.8"
+	case firefox:
+		return lang + ",en-US;q=0.7,en;q=0.3"
+	}
+	return locale + "," + lang + ";q=0.9,en-US;q=0.8,en;q=0.7"
+}
+
+// AcceptLanguageMatchesCountry reports whether the preferred language of an
+// Accept-Language value is one spoken in country. Countries it doesn't know
+// always match.
+func AcceptLanguageMatchesCountry(acceptLanguage, country string) bool {
+	locales := countryLocales[strings.ToUpper(country)]
+	if len(locales) == 0 {
+		return true
+	}
+	first, _, _ := strings.Cut(acceptLanguage, ",")
+	first, _, _ = strings.Cut(first, ";")
+	lang, _, _ := strings.Cut(strings.TrimSpace(first), "-")
+	for _, locale := range locales {
+		if l, _, _ := strings.Cut(locale, "-"); strings.EqualFold(l, lang) {
+			return true
+		}
+	}
+	return false
+}
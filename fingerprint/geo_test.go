@@ -0,0 +1,42 @@
+package fingerprint
+
+import "testing"
+
+func TestAcceptLanguageFor(t *testing.T) {
+	tests := []struct {
+		country string
+		firefox bool
+		want    string
+	}{
+		{"US", false, "en-US,en;q=0.9"},
+		{"gb", false, "en-GB,en-US;q=0.9,en;q=0.8"},
+		{"DE", false, "de-DE,de;q=0.9,en-US;q=0.8,en;q=0.7"},
+		{"DE", true, "de,en-US;q=0.7,en;q=0.3"},
+		{"US", true, "en-US,en;q=0.5"},
+		{"XX", false, ""},
+	}
+	for _, tt := range tests {
+		if got := AcceptLanguageFor(tt.country, tt.firefox); got != tt.want {
+			t.Errorf("AcceptLanguageFor(%q, %v) = %q, want %q", tt.country, tt.firefox, got, tt.want)
+		}
+	}
+}
+
+func TestAcceptLanguageMatchesCountry(t *testing.T) {
+	tests := []struct {
+		acceptLanguage, country string
+		want                    bool
+	}{
+		{"en-US,en;q=0.9", "US", true},
+		{"en-US,en;q=0.9", "GB", true},
+		{"en-US,en;q=0.9", "DE", false},
+		{"fr-CH,fr;q=0.9", "CH", true},
+		{"de", "AT", true},
+		{"en-US,en;q=0.9", "XX", true}, // Unknown country: nothing to contradict
+	}
+	for _, tt := range tests {
+		if got := AcceptLanguageMatchesCountry(tt.acceptLanguage, tt.country); got != tt.want {
+			t.Errorf("AcceptLanguageMatchesCountry(%q, %q) = %v, want %v", tt.acceptLanguage, tt.country, got, tt.want)
+		}
+	}
+}
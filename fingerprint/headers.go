@@ -26,19 +26,30 @@ const (
 type FetchDest string
 
 const (
+	FetchDestAudio        FetchDest = "audio"
+	FetchDestAudioWorklet FetchDest = "audioworklet"
 	FetchDestDocument     FetchDest = "document"
 	FetchDestEmbed        FetchDest = "embed"
+	FetchDestEmpty        FetchDest = "empty" // fetch(), XHR, beacons, EventSource
 	FetchDestFont         FetchDest = "font"
+	FetchDestFrame        FetchDest = "frame"
+	FetchDestIFrame       FetchDest = "iframe"
 	FetchDestImage        FetchDest = "image"
+	FetchDestJSON         FetchDest = "json" // JSON module imports
 	FetchDestManifest     FetchDest = "manifest"
 	FetchDestMedia        FetchDest = "media"
 	FetchDestObject       FetchDest = "object"
+	FetchDestPaintWorklet FetchDest = "paintworklet"
 	FetchDestReport       FetchDest = "report"
 	FetchDestScript       FetchDest = "script"
 	FetchDestServiceWorker FetchDest = "serviceworker"
 	FetchDestSharedWorker  FetchDest = "sharedworker"
 	FetchDestStyle        FetchDest = "style"
+	FetchDestTrack        FetchDest = "track"
+	FetchDestVideo        FetchDest = "video"
+	FetchDestWebSocket    FetchDest = "websocket" // Chrome; Firefox sends "empty"
 	FetchDestWorker       FetchDest = "worker"
+	FetchDestXSLT         FetchDest = "xslt"
 	FetchDestXHR          FetchDest = "empty" // XHR/fetch uses "empty"
 )
 
@@ -60,12 +71,16 @@ type RequestContext struct {
 	Dest FetchDest
 	// Site is the relationship between request origin and target
 	Site FetchSite
-	// IsUserTriggered indicates if the request was user-initiated (affects Sec-Fetch-User)
+	// IsUserTriggered indicates if the request was user-initiated (affects Sec-Fetch-User).
+	// This is the browser's user-activation flag: only navigations carry it.
 	IsUserTriggered bool
 	// Referrer is the page that initiated the request (for Sec-Fetch-Site calculation)
 	Referrer string
 	// TargetURL is the URL being requested
 	TargetURL string
+	// AncestorOrigin is the origin of the top-level page when the request
+	// comes from an embedded frame ("" for the top-level page itself)
+	AncestorOrigin string
 }
 
 // NavigationContext returns a RequestContext for page navigation
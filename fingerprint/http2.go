@@ -0,0 +1,157 @@
+package fingerprint
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// HTTP/2 SETTINGS identifiers (RFC 9113 Section 6.5.2, RFC 9218)
+const (
+	H2SettingHeaderTableSize      uint16 = 0x1
+	H2SettingEnablePush           uint16 = 0x2
+	H2SettingMaxConcurrentStreams uint16 = 0x3
+	H2SettingInitialWindowSize    uint16 = 0x4
+	H2SettingMaxFrameSize         uint16 = 0x5
+	H2SettingMaxHeaderListSize    uint16 = 0x6
+	H2SettingNoRFC7540Priorities  uint16 = 0x9
+)
+
+var (
+	// Chrome: HEADER_TABLE_SIZE, ENABLE_PUSH, INITIAL_WINDOW_SIZE, MAX_HEADER_LIST_SIZE
+	chromeSettingsOrder = []uint16{H2SettingHeaderTableSize, H2SettingEnablePush, H2SettingInitialWindowSize, H2SettingMaxHeaderListSize}
+	// Safari/iOS: ENABLE_PUSH, INITIAL_WINDOW_SIZE, MAX_CONCURRENT_STREAMS, NO_RFC7540_PRIORITIES
+	safariSettingsOrder = []uint16{H2SettingEnablePush, H2SettingInitialWindowSize, H2SettingMaxConcurrentStreams, H2SettingNoRFC7540Priorities}
+	// Firefox: HEADER_TABLE_SIZE, ENABLE_PUSH, INITIAL_WINDOW_SIZE, MAX_FRAME_SIZE
+	firefoxSettingsOrder = []uint16{H2SettingHeaderTableSize, H2SettingEnablePush, H2SettingInitialWindowSize, H2SettingMaxFrameSize}
+
+	chromePseudoHeaderOrder  = []string{":method", ":authority", ":scheme", ":path"} // m,a,s,p
+	safariPseudoHeaderOrder  = []string{":method", ":scheme", ":path", ":authority"} // m,s,p,a
+	firefoxPseudoHeaderOrder = []string{":method", ":path", ":authority", ":scheme"} // m,p,a,s
+
+	// Chrome's HEADERS weights for urgencies 0-4, its request priorities
+	// HIGHEST to IDLE (spdy::Spdy3PriorityToHttp2Weight)
+	chromeUrgencyWeights = []uint16{256, 220, 183, 147, 110}
+)
+
+// H2PriorityFrame is a PRIORITY frame (RFC 7540 Section 6.3) sent when the
+// connection opens. Weight is 1-256, as written in Akamai fingerprints; the
+// frame carries Weight-1.
+type H2PriorityFrame struct {
+	StreamID  uint32
+	StreamDep uint32
+	Exclusive bool
+	Weight    uint16
+}
+
+// SettingsFrame returns the SETTINGS identifiers in wire order and their values.
+func (s HTTP2Settings) SettingsFrame() ([]uint16, map[uint16]uint32) {
+	order := s.SettingsOrder
+	if len(order) == 0 {
+		order = chromeSettingsOrder
+		if s.NoRFC7540Priorities {
+			order = safariSettingsOrder
+		}
+	}
+
+	values := make(map[uint16]uint32, len(order))
+	for _, id := range order {
+		switch id {
+		case H2SettingHeaderTableSize:
+			values[id] = s.HeaderTableSize
+		case H2SettingEnablePush:
+			if s.EnablePush {
+				values[id] = 1
+			} else {
+				values[id] = 0
+			}
+		case H2SettingMaxConcurrentStreams:
+			values[id] = s.MaxConcurrentStreams
+		case H2SettingInitialWindowSize:
+			values[id] = s.InitialWindowSize
+		case H2SettingMaxFrameSize:
+			values[id] = s.MaxFrameSize
+		case H2SettingMaxHeaderListSize:
+			values[id] = s.MaxHeaderListSize
+		case H2SettingNoRFC7540Priorities:
+			values[id] = 1
+		}
+		if v, ok := s.SettingsValues[id]; ok {
+			values[id] = v
+		}
+	}
+	return order, values
+}
+
+// PseudoHeaders returns the pseudo-header order for requests.
+func (s HTTP2Settings) PseudoHeaders() []string {
+	if len(s.PseudoHeaderOrder) > 0 {
+		return s.PseudoHeaderOrder
+	}
+	if s.NoRFC7540Priorities {
+		return safariPseudoHeaderOrder
+	}
+	return chromePseudoHeaderOrder
+}
+
+// maxHeaderFramePayload is the frame payload every peer accepts
+// (SETTINGS_MAX_FRAME_SIZE can't be lower)
+const maxHeaderFramePayload = 16384
+
+// HeaderFramePayload returns the largest payload of the HEADERS and
+// CONTINUATION frames carrying a header block. Zero picks Chrome's 16374
+// (16383-byte frames, header included), or 16384 with NoRFC7540Priorities,
+// as Safari sends. Larger values are capped at 16384.
+func (s HTTP2Settings) HeaderFramePayload() int {
+	switch {
+	case s.HeaderFrameSize > maxHeaderFramePayload:
+		return maxHeaderFramePayload
+	case s.HeaderFrameSize > 5: // Room for the priority fields
+		return int(s.HeaderFrameSize)
+	case s.NoRFC7540Priorities:
+		return maxHeaderFramePayload
+	}
+	return 16374
+}
+
+// HeaderWeight returns the HEADERS frame weight (1-256) of a request with
+// the given RFC 9218 urgency, or StreamWeight when UrgencyWeights has none
+// for it. A negative urgency stands for a request without a Priority header.
+func (s HTTP2Settings) HeaderWeight(urgency int) uint16 {
+	if urgency >= 0 && urgency < len(s.UrgencyWeights) && s.UrgencyWeights[urgency] != 0 {
+		return s.UrgencyWeights[urgency]
+	}
+	return s.StreamWeight
+}
+
+// Akamai formats the settings as an Akamai HTTP/2 fingerprint:
+// SETTINGS|WINDOW_UPDATE|PRIORITY|pseudo-header order
+func (s HTTP2Settings) Akamai() string {
+	order, values := s.SettingsFrame()
+	settings := make([]string, len(order))
+	for i, id := range order {
+		settings[i] = strconv.FormatUint(uint64(id), 10) + ":" + strconv.FormatUint(uint64(values[id]), 10)
+	}
+
+	priorities := "0"
+	if len(s.PriorityFrames) > 0 {
+		frames := make([]string, len(s.PriorityFrames))
+		for i, f := range s.PriorityFrames {
+			exclusive := 0
+			if f.Exclusive {
+				exclusive = 1
+			}
+			frames[i] = fmt.Sprintf("%d:%d:%d:%d", f.StreamID, exclusive, f.StreamDep, f.Weight)
+		}
+		priorities = strings.Join(frames, ",")
+	}
+
+	pseudo := make([]string, 0, 4)
+	for _, h := range s.PseudoHeaders() {
+		if name := strings.TrimPrefix(h, ":"); name != "" {
+			pseudo = append(pseudo, name[:1])
+		}
+	}
+	return strings.Join(settings, ";") + "|" + strconv.FormatUint(uint64(s.ConnectionWindowUpdate), 10) +
+		"|" + priorities + "|" + strings.Join(pseudo, ",")
+}
@@ -0,0 +1,171 @@
+package fingerprint
+
+import (
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// HTTP/3 SETTINGS identifiers (RFC 9114, RFC 9204, RFC 9220, RFC 9297 and drafts)
+const (
+	H3SettingQPACKMaxTableCapacity uint64 = 0x1
+	H3SettingMaxFieldSectionSize   uint64 = 0x6
+	H3SettingQPACKBlockedStreams   uint64 = 0x7
+	H3SettingEnableConnectProtocol uint64 = 0x8
+	H3SettingH3Datagram            uint64 = 0x33
+	H3SettingH3DatagramDraft04     uint64 = 0xffd277
+	H3SettingWebTransportDraft00   uint64 = 0x2b603742
+)
+
+const defaultH3MaxFieldSectionSize = 262144
+
+// H3Setting is one HTTP/3 SETTINGS parameter
+type H3Setting struct {
+	ID    uint64
+	Value uint64
+}
+
+// HTTP3Settings describes the SETTINGS frame a client sends on its HTTP/3
+// control stream, the part of the connection hashed into h3 fingerprints.
+type HTTP3Settings struct {
+	// SETTINGS parameters in wire order
+	Settings []H3Setting
+	// GreaseSetting appends a reserved setting (0x1f*N+0x21) with a random
+	// non-zero value, as Chrome and Safari do
+	GreaseSetting bool
+	// GreaseFrames sends a reserved frame type on the control stream
+	GreaseFrames bool
+}
+
+var (
+	chromeH3Settings = HTTP3Settings{
+		Settings: []H3Setting{
+			{H3SettingQPACKMaxTableCapacity, 65536},
+			{H3SettingMaxFieldSectionSize, 262144},
+			{H3SettingQPACKBlockedStreams, 100},
+			{H3SettingH3Datagram, 1},
+		},
+		GreaseSetting: true,
+		GreaseFrames:  true,
+	}
+	safariH3Settings = HTTP3Settings{
+		Settings: []H3Setting{
+			{H3SettingQPACKMaxTableCapacity, 16383},
+			{H3SettingQPACKBlockedStreams, 100},
+		},
+		GreaseSetting: true,
+		GreaseFrames:  true,
+	}
+	firefoxH3Settings = HTTP3Settings{
+		Settings: []H3Setting{
+			{H3SettingQPACKMaxTableCapacity, 65536},
+			{H3SettingQPACKBlockedStreams, 20},
+			{H3SettingWebTransportDraft00, 0},
+			{H3SettingH3DatagramDraft04, 1},
+			{H3SettingH3Datagram, 1},
+			{H3SettingEnableConnectProtocol, 1},
+			{H3SettingMaxFieldSectionSize, 262144},
+		},
+		GreaseSetting: true,
+		GreaseFrames:  true,
+	}
+)
+
+// H3Settings returns the preset's HTTP/3 SETTINGS. Presets without explicit
+// HTTP3Settings get Chrome's, Safari's (NoRFC7540Priorities) or Firefox's
+// layout. A nil preset gets Chrome's.
+func (p *Preset) H3Settings() HTTP3Settings {
+	switch {
+	case p == nil:
+		return chromeH3Settings
+	case p.HTTP3Settings != nil:
+		return *p.HTTP3Settings
+	case strings.Contains(p.Name, "firefox"):
+		return firefoxH3Settings
+	case p.HTTP2Settings.NoRFC7540Priorities:
+		return safariH3Settings
+	}
+	return chromeH3Settings
+}
+
+// Get returns the value of a setting and whether it is sent
+func (s HTTP3Settings) Get(id uint64) (uint64, bool) {
+	for _, setting := range s.Settings {
+		if setting.ID == id {
+			return setting.Value, true
+		}
+	}
+	return 0, false
+}
+
+// MaxFieldSectionSize returns the advertised SETTINGS_MAX_FIELD_SECTION_SIZE,
+// or 256KB (Chrome's value) if the preset doesn't send one
+func (s HTTP3Settings) MaxFieldSectionSize() uint64 {
+	if v, ok := s.Get(H3SettingMaxFieldSectionSize); ok && v > 0 {
+		return v
+	}
+	return defaultH3MaxFieldSectionSize
+}
+
+// ExtendedConnect reports whether the settings advertise extended CONNECT
+// (SETTINGS_ENABLE_CONNECT_PROTOCOL=1, RFC 9220), as Firefox does for
+// WebSockets and WebTransport over HTTP/3
+func (s HTTP3Settings) ExtendedConnect() bool {
+	v, _ := s.Get(H3SettingEnableConnectProtocol)
+	return v == 1
+}
+
+// SettingsFrame returns the SETTINGS identifiers in wire order and their
+// values. With GreaseSetting a fresh reserved identifier is appended, so
+// call it once per transport to keep the GREASE value stable per session.
+func (s HTTP3Settings) SettingsFrame() ([]uint64, map[uint64]uint64) {
+	return s.SettingsFrameFor("")
+}
+
+// SettingsFrameFor is SettingsFrame with the GREASE identifier and value
+// derived from an identity key (see IdentitySeed). An empty key draws them
+// at random.
+func (s HTTP3Settings) SettingsFrameFor(identity string) ([]uint64, map[uint64]uint64) {
+	order := make([]uint64, 0, len(s.Settings)+1)
+	values := make(map[uint64]uint64, len(s.Settings)+1)
+	for _, setting := range s.Settings {
+		if _, dup := values[setting.ID]; !dup {
+			order = append(order, setting.ID)
+		}
+		values[setting.ID] = setting.Value
+	}
+	if s.GreaseSetting {
+		var n uint64
+		var v uint32
+		if r := IdentityRand(identity, "h3-grease-setting"); r != nil {
+			n, v = 1000000000+r.Uint64N(9000000000), r.Uint32()
+		} else {
+			n, v = greaseSettingN(), rand.Uint32()
+		}
+		id := 0x1f*n + 0x21
+		order = append(order, id)
+		values[id] = uint64(1 + v%(1<<32-1)) // never 0, like Chrome
+	}
+	return order, values
+}
+
+// String formats the settings as they appear in h3 fingerprint text, e.g.
+// "1:65536;6:262144;7:100;51:1;GREASE"
+func (s HTTP3Settings) String() string {
+	parts := make([]string, 0, len(s.Settings)+1)
+	for _, setting := range s.Settings {
+		parts = append(parts, strconv.FormatUint(setting.ID, 10)+":"+strconv.FormatUint(setting.Value, 10))
+	}
+	if s.GreaseSetting {
+		parts = append(parts, "GREASE")
+	}
+	return strings.Join(parts, ";")
+}
+
+// greaseSettingN picks N for a GREASE setting ID
+// GREASE IDs are of the form 0x1f * N + 0x21 where N is random
+// Chrome uses very large N values, producing setting IDs like 57836956465
+func greaseSettingN() uint64 {
+	// Generate large N values similar to Chrome (produces 10-11 digit IDs)
+	return uint64(1000000000 + rand.Int63n(9000000000))
+}
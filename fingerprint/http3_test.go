@@ -0,0 +1,75 @@
+package fingerprint
+
+import "testing"
+
+func TestH3SettingsDefaults(t *testing.T) {
+	tests := []struct {
+		preset *Preset
+		want   string
+	}{
+		{nil, "1:65536;6:262144;7:100;51:1;GREASE"},
+		{Chrome143(), "1:65536;6:262144;7:100;51:1;GREASE"},
+		{Safari18(), "1:16383;7:100;GREASE"},
+		{Firefox147(), "1:65536;7:20;727725890:0;16765559:1;51:1;8:1;6:262144;GREASE"},
+	}
+	for _, tt := range tests {
+		if got := tt.preset.H3Settings().String(); got != tt.want {
+			t.Errorf("H3Settings() = %q, want %q", got, tt.want)
+		}
+	}
+
+	if Chrome143().H3Settings().ExtendedConnect() || !Firefox147().H3Settings().ExtendedConnect() {
+		t.Error("ExtendedConnect should follow SETTINGS_ENABLE_CONNECT_PROTOCOL (Firefox only)")
+	}
+}
+
+func TestH3SettingsFrame(t *testing.T) {
+	custom := &HTTP3Settings{
+		Settings: []H3Setting{
+			{H3SettingQPACKBlockedStreams, 16},
+			{H3SettingQPACKMaxTableCapacity, 4096},
+			{H3SettingQPACKBlockedStreams, 32},
+		},
+		GreaseSetting: true,
+	}
+	p := Chrome143()
+	p.HTTP3Settings = custom
+
+	order, values := p.H3Settings().SettingsFrame()
+	if len(order) != 3 || order[0] != H3SettingQPACKBlockedStreams || order[1] != H3SettingQPACKMaxTableCapacity {
+		t.Fatalf("order = %v", order)
+	}
+	if values[H3SettingQPACKBlockedStreams] != 32 {
+		t.Errorf("duplicate setting: got %d, want last value 32", values[H3SettingQPACKBlockedStreams])
+	}
+	grease := order[2]
+	if (grease-0x21)%0x1f != 0 || values[grease] == 0 {
+		t.Errorf("invalid GREASE setting %d:%d", grease, values[grease])
+	}
+	if got := p.H3Settings().MaxFieldSectionSize(); got != 262144 {
+		t.Errorf("MaxFieldSectionSize() = %d, want default 262144", got)
+	}
+}
+
+func TestH3SettingsFrameIdentity(t *testing.T) {
+	settings := Chrome143().H3Settings()
+	grease := func(identity string) (uint64, uint64) {
+		order, values := settings.SettingsFrameFor(identity)
+		id := order[len(order)-1]
+		return id, values[id]
+	}
+	id1, v1 := grease("account-1")
+	id2, v2 := grease("account-1")
+	if id1 != id2 || v1 != v2 {
+		t.Errorf("same identity gave %d=%d and %d=%d", id1, v1, id2, v2)
+	}
+	if (id1-0x21)%0x1f != 0 || v1 == 0 {
+		t.Errorf("GREASE setting %d=%d is malformed", id1, v1)
+	}
+	if other, _ := grease("account-2"); other == id1 {
+		t.Error("different identities gave the same GREASE setting")
+	}
+	if IdentitySeed("account-1", "a") == IdentitySeed("account-1", "b") {
+		t.Error("purposes share a seed")
+	}
+}
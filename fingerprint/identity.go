@@ -0,0 +1,49 @@
+package fingerprint
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"math/rand/v2"
+)
+
+// An identity key (an account ID, say) stands for one logical client. The
+// random choices a browser makes once per install or session, such as the
+// TLS extension order and GREASE values, are derived from it instead of
+// drawn fresh, so the same identity looks the same from any process.
+
+type identityKey struct{}
+
+// WithIdentity returns a context carrying key. Randomness that can be
+// decided per request, like retry jitter, is derived from the key of the
+// request's context.
+func WithIdentity(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, identityKey{}, key)
+}
+
+// IdentityFrom returns the identity key carried by ctx, or ""
+func IdentityFrom(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	key, _ := ctx.Value(identityKey{}).(string)
+	return key
+}
+
+// IdentitySeed derives a seed for one purpose (e.g. "tls-shuffle") from an
+// identity key. Different purposes give unrelated seeds, so the choices
+// they drive are not correlated.
+func IdentitySeed(key, purpose string) int64 {
+	sum := sha256.Sum256([]byte(key + "\x00" + purpose))
+	return int64(binary.LittleEndian.Uint64(sum[:8]))
+}
+
+// IdentityRand returns a generator seeded from key for purpose. It returns
+// nil for an empty key, meaning the caller keeps its usual randomness.
+func IdentityRand(key, purpose string) *rand.Rand {
+	if key == "" {
+		return nil
+	}
+	sum := sha256.Sum256([]byte(key + "\x00" + purpose))
+	return rand.New(rand.NewPCG(binary.LittleEndian.Uint64(sum[:8]), binary.LittleEndian.Uint64(sum[8:16])))
+}
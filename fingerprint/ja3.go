@@ -0,0 +1,255 @@
+package fingerprint
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	tls "github.com/sardanioss/utls"
+)
+
+// TLS extension IDs that SpecFromJA3 maps to typed uTLS extensions
+const (
+	extServerName           uint16 = 0
+	extStatusRequest        uint16 = 5
+	extSupportedCurves      uint16 = 10
+	extSupportedPoints      uint16 = 11
+	extSignatureAlgorithms  uint16 = 13
+	extALPN                 uint16 = 16
+	extSCT                  uint16 = 18
+	extPadding              uint16 = 21
+	extExtendedMasterSecret uint16 = 23
+	extCompressCertificate  uint16 = 27
+	extRecordSizeLimit      uint16 = 28
+	extDelegatedCredentials uint16 = 34
+	extSessionTicket        uint16 = 35
+	extPreSharedKey         uint16 = 41
+	extSupportedVersions    uint16 = 43
+	extPSKKeyExchangeModes  uint16 = 45
+	extSignatureAlgsCert    uint16 = 50
+	extKeyShare             uint16 = 51
+	extApplicationSettings  uint16 = 17513
+	extApplicationSettings2 uint16 = 17613
+	extRenegotiationInfo    uint16 = 0xff01
+)
+
+// ja3SignatureAlgorithms is used for signature_algorithms (and
+// signature_algorithms_cert), whose contents JA3 does not record.
+// This is the list Chrome and Safari send.
+var ja3SignatureAlgorithms = []tls.SignatureScheme{
+	tls.ECDSAWithP256AndSHA256,
+	tls.PSSWithSHA256,
+	tls.PKCS1WithSHA256,
+	tls.ECDSAWithP384AndSHA384,
+	tls.PSSWithSHA384,
+	tls.PKCS1WithSHA384,
+	tls.PSSWithSHA512,
+	tls.PKCS1WithSHA512,
+}
+
+// isGREASE reports whether v is one of the reserved GREASE values (RFC 8701)
+func isGREASE(v uint16) bool {
+	return v&0x0f0f == 0x0a0a && v>>8 == v&0xff
+}
+
+// SpecFromJA3 builds a ClientHelloSpec that reproduces the given JA3 string
+// ("version,ciphers,extensions,curves,point_formats", values dash-separated).
+//
+// JA3 records which extensions are sent and in what order, but not most of
+// their contents. Those are filled in with what current browsers send:
+// ALPN offers h2 and http/1.1, key shares are generated for the first
+// post-quantum hybrid and X25519 (or the first listed curve), and
+// supported_versions offers TLS 1.3 and 1.2. GREASE values in any field are
+// replaced by uTLS placeholders so each handshake gets fresh GREASE.
+// pre_shared_key is dropped since it can only be built from a cached session.
+// Extensions without a typed equivalent are sent empty.
+//
+// uTLS mutates specs while applying them, so call SpecFromJA3 once per
+// connection (see SpecFuncFromJA3).
+func SpecFromJA3(ja3 string) (*tls.ClientHelloSpec, error) {
+	fields := strings.Split(strings.TrimSpace(ja3), ",")
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("ja3: expected 5 comma-separated fields, got %d", len(fields))
+	}
+
+	version, err := strconv.ParseUint(fields[0], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("ja3: invalid TLS version %q", fields[0])
+	}
+	ciphers, err := parseJA3List(fields[1], "cipher")
+	if err != nil {
+		return nil, err
+	}
+	extensions, err := parseJA3List(fields[2], "extension")
+	if err != nil {
+		return nil, err
+	}
+	curves, err := parseJA3List(fields[3], "curve")
+	if err != nil {
+		return nil, err
+	}
+	points, err := parseJA3List(fields[4], "point format")
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphers) == 0 {
+		return nil, fmt.Errorf("ja3: no cipher suites")
+	}
+
+	spec := &tls.ClientHelloSpec{
+		TLSVersMin:         tls.VersionTLS10,
+		TLSVersMax:         uint16(version),
+		CompressionMethods: []uint8{0},
+	}
+
+	grease := false
+	for _, c := range ciphers {
+		if isGREASE(c) {
+			c = tls.GREASE_PLACEHOLDER
+			grease = true
+		}
+		spec.CipherSuites = append(spec.CipherSuites, c)
+	}
+
+	curveIDs := make([]tls.CurveID, 0, len(curves))
+	for _, c := range curves {
+		if isGREASE(c) {
+			c = tls.GREASE_PLACEHOLDER
+		}
+		curveIDs = append(curveIDs, tls.CurveID(c))
+	}
+
+	pointFormats := make([]uint8, 0, len(points))
+	for _, p := range points {
+		if p > 0xff {
+			return nil, fmt.Errorf("ja3: invalid point format %d", p)
+		}
+		pointFormats = append(pointFormats, uint8(p))
+	}
+
+	for _, id := range extensions {
+		if id == extSupportedVersions {
+			spec.TLSVersMax = tls.VersionTLS13
+		}
+		if isGREASE(id) {
+			spec.Extensions = append(spec.Extensions, &tls.UtlsGREASEExtension{})
+			grease = true
+			continue
+		}
+		if id == extPreSharedKey {
+			continue
+		}
+		spec.Extensions = append(spec.Extensions, ja3Extension(id, curveIDs, pointFormats, grease))
+	}
+
+	return spec, nil
+}
+
+// SpecFuncFromJA3 validates ja3 once and returns a function that builds a
+// fresh spec from it on every call, suitable for Preset.CustomClientHelloSpec.
+func SpecFuncFromJA3(ja3 string) (func() *tls.ClientHelloSpec, error) {
+	if _, err := SpecFromJA3(ja3); err != nil {
+		return nil, err
+	}
+	return func() *tls.ClientHelloSpec {
+		spec, _ := SpecFromJA3(ja3)
+		return spec
+	}, nil
+}
+
+// parseJA3List parses one dash-separated JA3 field
+func parseJA3List(field, what string) ([]uint16, error) {
+	if field == "" {
+		return nil, nil
+	}
+	parts := strings.Split(field, "-")
+	values := make([]uint16, 0, len(parts))
+	for _, p := range parts {
+		v, err := strconv.ParseUint(p, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("ja3: invalid %s %q", what, p)
+		}
+		values = append(values, uint16(v))
+	}
+	return values, nil
+}
+
+// ja3Extension returns the uTLS extension for a JA3 extension ID
+func ja3Extension(id uint16, curves []tls.CurveID, points []uint8, grease bool) tls.TLSExtension {
+	switch id {
+	case extServerName:
+		return &tls.SNIExtension{}
+	case extStatusRequest:
+		return &tls.StatusRequestExtension{}
+	case extSupportedCurves:
+		return &tls.SupportedCurvesExtension{Curves: curves}
+	case extSupportedPoints:
+		return &tls.SupportedPointsExtension{SupportedPoints: points}
+	case extSignatureAlgorithms:
+		return &tls.SignatureAlgorithmsExtension{SupportedSignatureAlgorithms: ja3SignatureAlgorithms}
+	case extSignatureAlgsCert:
+		return &tls.SignatureAlgorithmsCertExtension{SupportedSignatureAlgorithms: ja3SignatureAlgorithms}
+	case extALPN:
+		return &tls.ALPNExtension{AlpnProtocols: []string{"h2", "http/1.1"}}
+	case extSCT:
+		return &tls.SCTExtension{}
+	case extPadding:
+		return &tls.UtlsPaddingExtension{GetPaddingLen: tls.BoringPaddingStyle}
+	case extExtendedMasterSecret:
+		return &tls.ExtendedMasterSecretExtension{}
+	case extCompressCertificate:
+		return &tls.CompressCertificateExtension{Algorithms: []tls.CertCompressionAlgo{tls.CertCompressionBrotli}}
+	case extRecordSizeLimit:
+		return &tls.GenericExtension{Id: extRecordSizeLimit, Data: []byte{0x40, 0x01}} // 16385
+	case extDelegatedCredentials:
+		return &tls.DelegatedCredentialsExtension{}
+	case extSessionTicket:
+		return &tls.SessionTicketExtension{}
+	case extSupportedVersions:
+		versions := []uint16{tls.VersionTLS13, tls.VersionTLS12}
+		if grease {
+			versions = append([]uint16{tls.GREASE_PLACEHOLDER}, versions...)
+		}
+		return &tls.SupportedVersionsExtension{Versions: versions}
+	case extPSKKeyExchangeModes:
+		return &tls.PSKKeyExchangeModesExtension{Modes: []uint8{1}} // psk_dhe_ke
+	case extKeyShare:
+		return &tls.KeyShareExtension{KeyShares: ja3KeyShares(curves, grease)}
+	case extApplicationSettings:
+		return &tls.ApplicationSettingsExtension{SupportedProtocols: []string{"h2"}}
+	case extApplicationSettings2:
+		return &tls.ApplicationSettingsExtensionNew{SupportedProtocols: []string{"h2"}}
+	case extRenegotiationInfo:
+		return &tls.RenegotiationInfoExtension{Renegotiation: tls.RenegotiateOnceAsClient}
+	default:
+		return &tls.GenericExtension{Id: id}
+	}
+}
+
+// ja3KeyShares picks the groups to send key shares for. Browsers send one
+// for a post-quantum hybrid if they offer it plus one classical group.
+func ja3KeyShares(curves []tls.CurveID, grease bool) []tls.KeyShare {
+	var shares []tls.KeyShare
+	if grease {
+		shares = append(shares, tls.KeyShare{Group: tls.CurveID(tls.GREASE_PLACEHOLDER), Data: []byte{0}})
+	}
+
+	classical := tls.CurveID(0)
+	for _, c := range curves {
+		switch {
+		case c == tls.CurveID(tls.GREASE_PLACEHOLDER):
+		case c == tls.CurveID(0x11ec) || c == tls.CurveID(0x6399): // X25519MLKEM768, X25519Kyber768Draft00
+			if len(shares) == 0 || shares[len(shares)-1].Group == tls.CurveID(tls.GREASE_PLACEHOLDER) {
+				shares = append(shares, tls.KeyShare{Group: c})
+			}
+		case c == tls.X25519:
+			classical = c
+		case classical == 0 && c < 0x0100: // Skip FFDHE groups
+			classical = c
+		}
+	}
+	if classical == 0 {
+		classical = tls.X25519
+	}
+	return append(shares, tls.KeyShare{Group: classical})
+}
@@ -0,0 +1,85 @@
+package fingerprint
+
+import (
+	"testing"
+
+	tls "github.com/sardanioss/utls"
+)
+
+// Chrome 120 on Windows, as captured (GREASE values included)
+const chromeJA3 = "771,2570-4865-4866-4867-49195-49199-49196-49200-52393-52392-49171-49172-156-157-47-53," +
+	"2570-0-23-65281-10-11-35-16-5-13-18-51-45-43-27-17513-21-2570," +
+	"2570-29-23-24,0"
+
+func TestSpecFromJA3(t *testing.T) {
+	spec, err := SpecFromJA3(chromeJA3)
+	if err != nil {
+		t.Fatalf("SpecFromJA3: %v", err)
+	}
+
+	if spec.CipherSuites[0] != tls.GREASE_PLACEHOLDER {
+		t.Errorf("first cipher = %#x, want GREASE placeholder", spec.CipherSuites[0])
+	}
+	if len(spec.CipherSuites) != 16 {
+		t.Errorf("got %d cipher suites, want 16", len(spec.CipherSuites))
+	}
+	if len(spec.Extensions) != 18 {
+		t.Fatalf("got %d extensions, want 18", len(spec.Extensions))
+	}
+	if spec.TLSVersMax != tls.VersionTLS13 {
+		t.Errorf("TLSVersMax = %#x, want TLS 1.3", spec.TLSVersMax)
+	}
+
+	if _, ok := spec.Extensions[0].(*tls.UtlsGREASEExtension); !ok {
+		t.Errorf("extension 0 = %T, want GREASE", spec.Extensions[0])
+	}
+	if _, ok := spec.Extensions[1].(*tls.SNIExtension); !ok {
+		t.Errorf("extension 1 = %T, want SNI", spec.Extensions[1])
+	}
+	curves, ok := spec.Extensions[4].(*tls.SupportedCurvesExtension)
+	if !ok {
+		t.Fatalf("extension 4 = %T, want supported_groups", spec.Extensions[4])
+	}
+	want := []tls.CurveID{tls.CurveID(tls.GREASE_PLACEHOLDER), tls.X25519, tls.CurveP256, tls.CurveP384}
+	if len(curves.Curves) != len(want) {
+		t.Fatalf("curves = %v, want %v", curves.Curves, want)
+	}
+	for i := range want {
+		if curves.Curves[i] != want[i] {
+			t.Errorf("curve %d = %v, want %v", i, curves.Curves[i], want[i])
+		}
+	}
+
+	ks, ok := spec.Extensions[11].(*tls.KeyShareExtension)
+	if !ok {
+		t.Fatalf("extension 11 = %T, want key_share", spec.Extensions[11])
+	}
+	if len(ks.KeyShares) != 2 || ks.KeyShares[1].Group != tls.X25519 {
+		t.Errorf("key shares = %v, want GREASE + X25519", ks.KeyShares)
+	}
+}
+
+func TestSpecFromJA3FreshSpecs(t *testing.T) {
+	fn, err := SpecFuncFromJA3(chromeJA3)
+	if err != nil {
+		t.Fatalf("SpecFuncFromJA3: %v", err)
+	}
+	if a, b := fn(), fn(); a == b || a.Extensions[1] == b.Extensions[1] {
+		t.Error("specs must not be shared between calls")
+	}
+}
+
+func TestSpecFromJA3Invalid(t *testing.T) {
+	for _, ja3 := range []string{
+		"",
+		"771,4865-4866",
+		"771,,0-10,29,0",
+		"771,4865-x,0,29,0",
+		"771,4865,0,29,256",
+		"70000,4865,0,29,0",
+	} {
+		if _, err := SpecFromJA3(ja3); err == nil {
+			t.Errorf("SpecFromJA3(%q) succeeded, want error", ja3)
+		}
+	}
+}
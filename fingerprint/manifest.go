@@ -0,0 +1,308 @@
+package fingerprint
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	tls "github.com/sardanioss/utls"
+)
+
+// extGREASEECH is the encrypted_client_hello extension, which Chrome and
+// Firefox send as GREASE when no ECH config is known
+const extGREASEECH uint16 = 0xfe0d
+
+// PresetManifest describes every registered preset, for tooling that picks
+// presets or checks fingerprint coverage (see Manifest)
+type PresetManifest struct {
+	Version string          `json:"version"` // PresetDatabaseVersion
+	Presets []ManifestEntry `json:"presets"` // Sorted by name
+}
+
+// ManifestEntry describes one preset as it appears on the wire
+type ManifestEntry struct {
+	Name    string `json:"name"`
+	AliasOf string `json:"aliasOf,omitempty"` // Preset a -latest name points to
+
+	UserAgent string        `json:"userAgent"`
+	Brands    []ClientBrand `json:"brands,omitempty"`   // From sec-ch-ua
+	Platform  string        `json:"platform,omitempty"` // From sec-ch-ua-platform
+	Mobile    bool          `json:"mobile,omitempty"`   // From sec-ch-ua-mobile
+
+	TLS   ManifestTLS `json:"tls"`
+	HTTP2 string      `json:"http2"`           // Akamai fingerprint text (see HTTP2Settings.Akamai)
+	HTTP3 string      `json:"http3,omitempty"` // SETTINGS text (see HTTP3Settings.String)
+
+	Protocols []string `json:"protocols"`
+	Features  []string `json:"features"`
+}
+
+// ClientBrand is one entry of a sec-ch-ua brand list
+type ClientBrand struct {
+	Brand   string `json:"brand"`
+	Version string `json:"version"`
+}
+
+// ManifestTLS holds what a preset's ClientHellos should hash to. JA3 is
+// left out: Chrome shuffles its extensions, so only the sorted JA4 is
+// stable across connections.
+type ManifestTLS struct {
+	ClientHello     string `json:"clientHello"`               // uTLS ClientHelloID, or "custom"
+	QUICClientHello string `json:"quicClientHello,omitempty"` // Same, for HTTP/3
+	JA4             string `json:"ja4,omitempty"`
+	QUICJA4         string `json:"quicJA4,omitempty"`
+}
+
+// Manifest returns BuildManifest as indented JSON
+func Manifest() ([]byte, error) {
+	return json.MarshalIndent(BuildManifest(), "", "  ")
+}
+
+// BuildManifest describes every registered preset, -latest aliases
+// included. Presets without an OS suffix describe the platform they are
+// built on (see GetPlatformInfo).
+func BuildManifest() PresetManifest {
+	names := Available()
+	sort.Strings(names)
+	m := PresetManifest{Version: PresetDatabaseVersion, Presets: make([]ManifestEntry, 0, len(names))}
+	for _, name := range names {
+		entry := manifestEntry(presets[name]())
+		entry.Name = name
+		if entry.AliasOf == name {
+			entry.AliasOf = ""
+		}
+		m.Presets = append(m.Presets, entry)
+	}
+	return m
+}
+
+func manifestEntry(p *Preset) ManifestEntry {
+	e := ManifestEntry{
+		AliasOf:   p.Name,
+		UserAgent: p.UserAgent,
+		HTTP2:     p.HTTP2Settings.Akamai(),
+		Protocols: []string{"h1", "h2"},
+	}
+	for _, h := range p.HeaderOrder {
+		switch strings.ToLower(h.Key) {
+		case "sec-ch-ua":
+			e.Brands = parseClientBrands(h.Value)
+		case "sec-ch-ua-platform":
+			e.Platform = strings.Trim(h.Value, `"`)
+		case "sec-ch-ua-mobile":
+			e.Mobile = h.Value == "?1"
+		}
+	}
+
+	e.TLS.ClientHello = helloName(p.ClientHelloID, p.CustomClientHelloSpec != nil)
+	tcpSpec := presetSpec(p, p.ClientHelloID, p.CustomClientHelloSpec)
+	if tcpSpec != nil {
+		e.TLS.JA4 = specJA4('t', tcpSpec)
+	}
+
+	var features []string
+	if p.SupportHTTP3 {
+		e.Protocols = append(e.Protocols, "h3")
+		e.HTTP3 = p.H3Settings().String()
+		e.TLS.QUICClientHello = helloName(p.QUICClientHelloID, p.CustomQUICClientHelloSpec != nil)
+		if spec := presetSpec(p, p.QUICClientHelloID, p.CustomQUICClientHelloSpec); spec != nil {
+			e.TLS.QUICJA4 = specJA4('q', spec)
+		}
+		if p.QUICPSKClientHelloID.Client != "" {
+			features = append(features, "quic-resumption")
+		}
+	}
+	if p.PSKClientHelloID.Client != "" {
+		features = append(features, "tls-resumption")
+	}
+	if tcpSpec != nil && slices.ContainsFunc(tcpSpec.Extensions, func(ext tls.TLSExtension) bool {
+		id, ok := extensionID(ext)
+		return ok && id == extGREASEECH
+	}) {
+		features = append(features, "ech-grease")
+	}
+	if len(e.Brands) > 0 {
+		features = append(features, "client-hints")
+	}
+	if p.HTTP2Settings.NoRFC7540Priorities {
+		features = append(features, "rfc9218-priorities")
+	} else {
+		features = append(features, "rfc7540-priorities")
+	}
+	if len(p.HTTP2Settings.PriorityFrames) > 0 {
+		features = append(features, "h2-priority-frames")
+	}
+	if len(p.HTTP2Settings.UrgencyWeights) > 0 {
+		features = append(features, "h2-priority-weights")
+	}
+	sort.Strings(features)
+	e.Features = features
+	return e
+}
+
+// parseClientBrands splits a sec-ch-ua value into its brands
+func parseClientBrands(value string) []ClientBrand {
+	var brands []ClientBrand
+	for _, item := range strings.Split(value, ",") {
+		brand, params, _ := strings.Cut(strings.TrimSpace(item), ";")
+		b := ClientBrand{Brand: strings.Trim(brand, `"`)}
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "v="); ok {
+			b.Version = strings.Trim(v, `"`)
+		}
+		if b.Brand != "" {
+			brands = append(brands, b)
+		}
+	}
+	return brands
+}
+
+func helloName(id tls.ClientHelloID, custom bool) string {
+	if custom || id.Client == "" {
+		return "custom"
+	}
+	return id.Client + "_" + id.Version
+}
+
+// presetSpec builds the spec a connection would use, with the preset's
+// signature algorithms applied, or nil if there is none
+func presetSpec(p *Preset, id tls.ClientHelloID, custom func() *tls.ClientHelloSpec) *tls.ClientHelloSpec {
+	var spec *tls.ClientHelloSpec
+	if custom != nil {
+		spec = custom()
+	} else if id.Client != "" {
+		if s, err := tls.UTLSIdToSpecWithSeed(id, 0); err == nil {
+			spec = &s
+		}
+	}
+	if spec != nil {
+		ApplySignatureAlgorithms(spec, p)
+	}
+	return spec
+}
+
+// extensionID returns the wire type of ext. GREASE extensions, whose type
+// is only picked when the hello is built, report false.
+func extensionID(ext tls.TLSExtension) (uint16, bool) {
+	switch ext.(type) {
+	case *tls.UtlsGREASEExtension:
+		return 0, false
+	case *tls.SNIExtension:
+		return extServerName, true // Empty until the host is known
+	case *tls.UtlsPaddingExtension:
+		return extPadding, true // Empty until the hello's length is known
+	}
+	n := ext.Len()
+	if n < 4 {
+		return 0, false
+	}
+	buf := make([]byte, n)
+	if read, _ := ext.Read(buf); read < 2 {
+		return 0, false
+	}
+	return uint16(buf[0])<<8 | uint16(buf[1]), true
+}
+
+// specJA4 computes the JA4 fingerprint of spec for a hello sent to a
+// domain. proto is 't' for TCP or 'q' for QUIC.
+func specJA4(proto byte, spec *tls.ClientHelloSpec) string {
+	version := spec.TLSVersMax
+	sni, alpn := false, ""
+	var extensions, sigAlgs []uint16
+	for _, ext := range spec.Extensions {
+		switch e := ext.(type) {
+		case *tls.SNIExtension:
+			sni = true
+		case *tls.ALPNExtension:
+			if len(e.AlpnProtocols) > 0 {
+				alpn = e.AlpnProtocols[0]
+			}
+		case *tls.SignatureAlgorithmsExtension:
+			for _, scheme := range e.SupportedSignatureAlgorithms {
+				sigAlgs = append(sigAlgs, uint16(scheme))
+			}
+		case *tls.SupportedVersionsExtension:
+			version = 0
+			for _, v := range e.Versions {
+				if !isGREASE(v) && v > version {
+					version = v
+				}
+			}
+		}
+		if id, ok := extensionID(ext); ok && !isGREASE(id) {
+			extensions = append(extensions, id)
+		}
+	}
+	return ja4(proto, version, sni, alpn, spec.CipherSuites, extensions, sigAlgs)
+}
+
+// ja4 formats a JA4 fingerprint (FoxIO's JA4 specification) from the
+// fields of a ClientHello. GREASE values are ignored.
+func ja4(proto byte, version uint16, sni bool, alpn string, ciphers, extensions, sigAlgs []uint16) string {
+	ciphers = slices.DeleteFunc(slices.Clone(ciphers), isGREASE)
+	extensions = slices.DeleteFunc(slices.Clone(extensions), isGREASE)
+
+	var b strings.Builder
+	b.WriteByte(proto)
+	switch version {
+	case tls.VersionTLS13:
+		b.WriteString("13")
+	case tls.VersionTLS12:
+		b.WriteString("12")
+	case tls.VersionTLS11:
+		b.WriteString("11")
+	case tls.VersionTLS10:
+		b.WriteString("10")
+	default:
+		b.WriteString("00")
+	}
+	if sni {
+		b.WriteByte('d')
+	} else {
+		b.WriteByte('i')
+	}
+	fmt.Fprintf(&b, "%02d%02d", min(len(ciphers), 99), min(len(extensions), 99))
+	if alpn == "" {
+		b.WriteString("00")
+	} else {
+		b.WriteByte(alpn[0])
+		b.WriteByte(alpn[len(alpn)-1])
+	}
+
+	slices.Sort(ciphers)
+	b.WriteString("_" + ja4Hash(hexList(ciphers)))
+
+	hashed := slices.DeleteFunc(extensions, func(id uint16) bool {
+		return id == extServerName || id == extALPN
+	})
+	slices.Sort(hashed)
+	raw := hexList(hashed)
+	if len(sigAlgs) > 0 {
+		raw += "_" + hexList(sigAlgs)
+	}
+	if len(hashed) == 0 {
+		raw = ""
+	}
+	b.WriteString("_" + ja4Hash(raw))
+	return b.String()
+}
+
+func hexList(values []uint16) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = fmt.Sprintf("%04x", v)
+	}
+	return strings.Join(parts, ",")
+}
+
+// ja4Hash is the truncated SHA-256 JA4 uses, or zeros for an empty list
+func ja4Hash(s string) string {
+	if s == "" {
+		return "000000000000"
+	}
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])[:12]
+}
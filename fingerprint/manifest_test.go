@@ -0,0 +1,60 @@
+package fingerprint
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestJA4(t *testing.T) {
+	// Chrome's ClientHello from the JA4 specification
+	ciphers := []uint16{0x1301, 0x1302, 0x1303, 0xc02b, 0xc02f, 0xc02c, 0xc030, 0xcca9, 0xcca8, 0xc013, 0xc014, 0x009c, 0x009d, 0x002f, 0x0035, 0x0a0a}
+	extensions := []uint16{0x1a1a, 0x0000, 0x0017, 0xff01, 0x000a, 0x000b, 0x0023, 0x0010, 0x0005, 0x000d, 0x0012, 0x0033, 0x002d, 0x002b, 0x001b, 0x4469, 0x0015}
+	sigAlgs := []uint16{0x0403, 0x0804, 0x0401, 0x0503, 0x0805, 0x0501, 0x0806, 0x0601}
+
+	got := ja4('t', 0x0304, true, "h2", ciphers, extensions, sigAlgs)
+	if want := "t13d1516h2_8daaf6152771_e5627efa2ab1"; got != want {
+		t.Errorf("ja4 = %s, want %s", got, want)
+	}
+	if got := ja4('q', 0x0304, false, "", nil, nil, nil); got != "q13i000000_000000000000_000000000000" {
+		t.Errorf("empty hello ja4 = %s", got)
+	}
+}
+
+func TestManifest(t *testing.T) {
+	data, err := Manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m PresetManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	if m.Version != PresetDatabaseVersion || len(m.Presets) != len(Available()) {
+		t.Fatalf("manifest version %q with %d presets", m.Version, len(m.Presets))
+	}
+
+	byName := make(map[string]ManifestEntry, len(m.Presets))
+	for _, e := range m.Presets {
+		byName[e.Name] = e
+		if e.UserAgent == "" || e.HTTP2 == "" || e.TLS.ClientHello == "" {
+			t.Errorf("%s: incomplete entry %+v", e.Name, e)
+		}
+	}
+
+	latest := byName["chrome-latest"]
+	if latest.AliasOf != "chrome-144" {
+		t.Errorf("chrome-latest aliasOf = %q", latest.AliasOf)
+	}
+	if byName["chrome-144"].AliasOf != "" {
+		t.Errorf("chrome-144 aliasOf = %q", byName["chrome-144"].AliasOf)
+	}
+	if len(latest.Brands) != 3 || latest.Brands[2].Brand != "Google Chrome" || latest.Brands[2].Version != "144" {
+		t.Errorf("chrome-latest brands = %+v", latest.Brands)
+	}
+	if want := "1:65536;2:0;4:6291456;6:262144|15663105|0|m,a,s,p"; latest.HTTP2 != want {
+		t.Errorf("chrome-latest http2 = %s, want %s", latest.HTTP2, want)
+	}
+	if latest.TLS.JA4 == "" || latest.TLS.JA4[:4] != "t13d" {
+		t.Errorf("chrome-latest ja4 = %q", latest.TLS.JA4)
+	}
+}
@@ -68,6 +68,18 @@ type Preset struct {
 	HeaderOrder   []HeaderPair      // Ordered headers for HTTP/2 and HTTP/3
 	HTTP2Settings HTTP2Settings
 	SupportHTTP3  bool
+	// HTTP/3 SETTINGS sent on the control stream (see H3Settings).
+	// Nil picks the browser family's defaults.
+	HTTP3Settings *HTTP3Settings
+	// Priority header per request type (see Priorities).
+	// Nil picks the browser family's rules.
+	Priority *PriorityRules
+	// signature_algorithms and signature_algorithms_cert lists enforced on
+	// every ClientHello (see SignatureRules). Nil picks the browser family's.
+	SignatureAlgorithms *SignatureAlgorithmRules
+	// Padding and frame layout of QUIC Initial packets (see QUICInitial).
+	// Nil picks Chrome's.
+	QUICInitialSettings *QUICInitialSettings
 }
 
 // HTTP2Settings contains HTTP/2 connection settings
@@ -84,6 +96,26 @@ type HTTP2Settings struct {
 	StreamExclusive        bool
 	// RFC 9218 - disables RFC 7540 stream priorities
 	NoRFC7540Priorities bool
+	// SETTINGS identifiers to send, in wire order (see SettingsFrame).
+	// Nil uses Chrome's layout, or Safari's with NoRFC7540Priorities.
+	SettingsOrder []uint16
+	// Pseudo-header order (see PseudoHeaders). Nil uses Chrome's m,a,s,p,
+	// or Safari's m,s,p,a with NoRFC7540Priorities.
+	PseudoHeaderOrder []string
+	// SETTINGS values that override the fields above, keyed by identifier.
+	// Also carries identifiers without a named field (e.g. 0x8).
+	SettingsValues map[uint16]uint32
+	// PRIORITY frames sent right after the connection preface, as older
+	// Firefox versions did to build their dependency tree
+	PriorityFrames []H2PriorityFrame
+	// HEADERS frame weights by RFC 9218 urgency (0-7), read from each
+	// request's Priority header. Chrome weighs every stream by its request
+	// priority this way. Requests without a Priority header, or with an
+	// urgency past the end, get StreamWeight (see HeaderWeight).
+	UrgencyWeights []uint16
+	// Largest payload of the HEADERS and CONTINUATION frames a header block
+	// is split into, priority fields included (see HeaderFramePayload)
+	HeaderFrameSize uint32
 }
 
 // Chrome133 returns the Chrome 133 fingerprint preset
@@ -136,6 +168,7 @@ func Chrome133() *Preset {
 			ConnectionWindowUpdate: 15663105,
 			StreamWeight:           256,
 			StreamExclusive:        true,
+			UrgencyWeights:         chromeUrgencyWeights,
 		},
 		SupportHTTP3: false, // Legacy preset, no proper QUIC fingerprint
 	}
@@ -191,6 +224,7 @@ func Chrome141() *Preset {
 			ConnectionWindowUpdate: 15663105,
 			StreamWeight:           256,
 			StreamExclusive:        true,
+			UrgencyWeights:         chromeUrgencyWeights,
 		},
 		SupportHTTP3: false, // Legacy preset, no proper QUIC fingerprint
 	}
@@ -223,9 +257,10 @@ func Firefox133() *Preset {
 			{"sec-fetch-site", "none"},
 			{"sec-fetch-user", "?1"},
 		},
+		// Akamai: 1:65536;2:0;4:131072;5:16384|12517377|0|m,p,a,s
 		HTTP2Settings: HTTP2Settings{
 			HeaderTableSize:        65536,
-			EnablePush:             true,
+			EnablePush:             false,
 			MaxConcurrentStreams:   0,
 			InitialWindowSize:      131072,
 			MaxFrameSize:           16384,
@@ -233,6 +268,9 @@ func Firefox133() *Preset {
 			ConnectionWindowUpdate: 12517377,
 			StreamWeight:           42,
 			StreamExclusive:        false,
+			HeaderFrameSize:        16384, // 16379-byte first fragment after the priority fields
+			SettingsOrder:          firefoxSettingsOrder,
+			PseudoHeaderOrder:      firefoxPseudoHeaderOrder,
 		},
 		SupportHTTP3: false, // No Firefox QUIC fingerprint in utls
 	}
@@ -289,9 +327,10 @@ func Firefox147() *Preset {
 			{"priority", "u=0, i"},
 			{"te", "trailers"},
 		},
+		// Akamai: 1:65536;2:0;4:131072;5:16384|12517377|0|m,p,a,s
 		HTTP2Settings: HTTP2Settings{
 			HeaderTableSize:        65536,
-			EnablePush:             true,
+			EnablePush:             false,
 			MaxConcurrentStreams:   0,
 			InitialWindowSize:      131072,
 			MaxFrameSize:           16384,
@@ -299,11 +338,62 @@ func Firefox147() *Preset {
 			ConnectionWindowUpdate: 12517377,
 			StreamWeight:           42,
 			StreamExclusive:        false,
+			HeaderFrameSize:        16384,
+			SettingsOrder:          firefoxSettingsOrder,
+			PseudoHeaderOrder:      firefoxPseudoHeaderOrder,
 		},
 		SupportHTTP3: true,
 	}
 }
 
+// Firefox OS tokens as they appear in the User-Agent. Firefox freezes the
+// macOS version at 10.15 and the Windows version at 10.0.
+const (
+	firefoxWindowsOS = "Windows NT 10.0; Win64; x64"
+	firefoxMacOS     = "Macintosh; Intel Mac OS X 10.15"
+	firefoxLinuxOS   = "X11; Linux x86_64"
+)
+
+// newFirefoxPreset builds a platform-specific variant of a Firefox preset.
+// Firefox's TLS stack (NSS) and HTTP/2 and HTTP/3 settings do not vary by
+// OS, so a variant keeps everything of its base preset but the User-Agent.
+func newFirefoxPreset(name string, base func() *Preset, version, uaOS string) *Preset {
+	p := base()
+	p.Name = name
+	p.UserAgent = "Mozilla/5.0 (" + uaOS + "; rv:" + version + ".0) Gecko/20100101 Firefox/" + version + ".0"
+	return p
+}
+
+// Firefox133Windows returns Firefox 133 on Windows
+func Firefox133Windows() *Preset {
+	return newFirefoxPreset("firefox-133-windows", Firefox133, "133", firefoxWindowsOS)
+}
+
+// Firefox133macOS returns Firefox 133 on macOS
+func Firefox133macOS() *Preset {
+	return newFirefoxPreset("firefox-133-macos", Firefox133, "133", firefoxMacOS)
+}
+
+// Firefox133Linux returns Firefox 133 on Linux
+func Firefox133Linux() *Preset {
+	return newFirefoxPreset("firefox-133-linux", Firefox133, "133", firefoxLinuxOS)
+}
+
+// Firefox147Windows returns Firefox 147 on Windows
+func Firefox147Windows() *Preset {
+	return newFirefoxPreset("firefox-147-windows", Firefox147, "147", firefoxWindowsOS)
+}
+
+// Firefox147macOS returns Firefox 147 on macOS
+func Firefox147macOS() *Preset {
+	return newFirefoxPreset("firefox-147-macos", Firefox147, "147", firefoxMacOS)
+}
+
+// Firefox147Linux returns Firefox 147 on Linux
+func Firefox147Linux() *Preset {
+	return newFirefoxPreset("firefox-147-linux", Firefox147, "147", firefoxLinuxOS)
+}
+
 // Chrome143 returns the Chrome 143 fingerprint preset with platform-specific TLS fingerprint
 func Chrome143() *Preset {
 	p := GetPlatformInfo()
@@ -371,6 +461,7 @@ func Chrome143() *Preset {
 			ConnectionWindowUpdate: 15663105,
 			StreamWeight:           256,
 			StreamExclusive:        true,
+			UrgencyWeights:         chromeUrgencyWeights,
 		},
 		SupportHTTP3: true,
 	}
@@ -428,6 +519,7 @@ func Chrome143Windows() *Preset {
 			ConnectionWindowUpdate: 15663105,
 			StreamWeight:           256,
 			StreamExclusive:        true,
+			UrgencyWeights:         chromeUrgencyWeights,
 		},
 		SupportHTTP3: true,
 	}
@@ -485,6 +577,7 @@ func Chrome143Linux() *Preset {
 			ConnectionWindowUpdate: 15663105,
 			StreamWeight:           256,
 			StreamExclusive:        true,
+			UrgencyWeights:         chromeUrgencyWeights,
 		},
 		SupportHTTP3: true,
 	}
@@ -542,6 +635,7 @@ func Chrome143macOS() *Preset {
 			ConnectionWindowUpdate: 15663105,
 			StreamWeight:           256,
 			StreamExclusive:        true,
+			UrgencyWeights:         chromeUrgencyWeights,
 		},
 		SupportHTTP3: true,
 	}
@@ -609,6 +703,7 @@ func Chrome144() *Preset {
 			ConnectionWindowUpdate: 15663105,
 			StreamWeight:           256,
 			StreamExclusive:        true,
+			UrgencyWeights:         chromeUrgencyWeights,
 		},
 		SupportHTTP3: true,
 	}
@@ -662,6 +757,7 @@ func Chrome144Windows() *Preset {
 			ConnectionWindowUpdate: 15663105,
 			StreamWeight:           256,
 			StreamExclusive:        true,
+			UrgencyWeights:         chromeUrgencyWeights,
 		},
 		SupportHTTP3: true,
 	}
@@ -715,6 +811,7 @@ func Chrome144Linux() *Preset {
 			ConnectionWindowUpdate: 15663105,
 			StreamWeight:           256,
 			StreamExclusive:        true,
+			UrgencyWeights:         chromeUrgencyWeights,
 		},
 		SupportHTTP3: true,
 	}
@@ -768,6 +865,7 @@ func Chrome144macOS() *Preset {
 			ConnectionWindowUpdate: 15663105,
 			StreamWeight:           256,
 			StreamExclusive:        true,
+			UrgencyWeights:         chromeUrgencyWeights,
 		},
 		SupportHTTP3: true,
 	}
@@ -1058,6 +1156,7 @@ func AndroidChrome143() *Preset {
 			ConnectionWindowUpdate: 15663105,
 			StreamWeight:           256,
 			StreamExclusive:        true,
+			UrgencyWeights:         chromeUrgencyWeights,
 		},
 		SupportHTTP3: true,
 	}
@@ -1111,43 +1210,58 @@ func AndroidChrome144() *Preset {
 			ConnectionWindowUpdate: 15663105,
 			StreamWeight:           256,
 			StreamExclusive:        true,
+			UrgencyWeights:         chromeUrgencyWeights,
 		},
 		SupportHTTP3: true,
 	}
 }
 
+// PresetDatabaseVersion identifies the revision of the preset definitions below.
+// Bump it whenever a preset's TLS, HTTP/2, HTTP/3 or header profile changes so
+// stored sessions can be traced back to the fingerprints that produced them.
+const PresetDatabaseVersion = "2026.10.1"
+
 // presets is a map of all available presets
 var presets = map[string]func() *Preset{
-	"chrome-133":         Chrome133,
-	"chrome-141":         Chrome141,
-	"chrome-143":         Chrome143,
-	"chrome-143-windows": Chrome143Windows,
-	"chrome-143-linux":   Chrome143Linux,
-	"chrome-143-macos":   Chrome143macOS,
-	"chrome-144":         Chrome144,
-	"chrome-144-windows": Chrome144Windows,
-	"chrome-144-linux":   Chrome144Linux,
-	"chrome-144-macos":   Chrome144macOS,
-	"firefox-133":        Firefox133,
-	"firefox-147":        Firefox147,
-	"safari-18":          Safari18,
-	"ios-chrome-143":     IOSChrome143,
-	"ios-chrome-144":     IOSChrome144,
-	"ios-safari-17":      IOSSafari17,
-	"ios-safari-18":      IOSSafari18,
-	"android-chrome-143": AndroidChrome143,
-	"android-chrome-144": AndroidChrome144,
+	"chrome-133":          Chrome133,
+	"chrome-141":          Chrome141,
+	"chrome-143":          Chrome143,
+	"chrome-143-windows":  Chrome143Windows,
+	"chrome-143-linux":    Chrome143Linux,
+	"chrome-143-macos":    Chrome143macOS,
+	"chrome-144":          Chrome144,
+	"chrome-144-windows":  Chrome144Windows,
+	"chrome-144-linux":    Chrome144Linux,
+	"chrome-144-macos":    Chrome144macOS,
+	"firefox-133":         Firefox133,
+	"firefox-133-windows": Firefox133Windows,
+	"firefox-133-linux":   Firefox133Linux,
+	"firefox-133-macos":   Firefox133macOS,
+	"firefox-147":         Firefox147,
+	"firefox-147-windows": Firefox147Windows,
+	"firefox-147-linux":   Firefox147Linux,
+	"firefox-147-macos":   Firefox147macOS,
+	"safari-18":           Safari18,
+	"ios-chrome-143":      IOSChrome143,
+	"ios-chrome-144":      IOSChrome144,
+	"ios-safari-17":       IOSSafari17,
+	"ios-safari-18":       IOSSafari18,
+	"android-chrome-143":  AndroidChrome143,
+	"android-chrome-144":  AndroidChrome144,
 
 	// -latest aliases (always point to the newest version)
-	"chrome-latest":         Chrome144,
-	"chrome-latest-windows": Chrome144Windows,
-	"chrome-latest-linux":   Chrome144Linux,
-	"chrome-latest-macos":   Chrome144macOS,
-	"firefox-latest":        Firefox147,
-	"safari-latest":         Safari18,
-	"ios-chrome-latest":     IOSChrome144,
-	"ios-safari-latest":     IOSSafari18,
-	"android-chrome-latest": AndroidChrome144,
+	"chrome-latest":          Chrome144,
+	"chrome-latest-windows":  Chrome144Windows,
+	"chrome-latest-linux":    Chrome144Linux,
+	"chrome-latest-macos":    Chrome144macOS,
+	"firefox-latest":         Firefox147,
+	"firefox-latest-windows": Firefox147Windows,
+	"firefox-latest-linux":   Firefox147Linux,
+	"firefox-latest-macos":   Firefox147macOS,
+	"safari-latest":          Safari18,
+	"ios-chrome-latest":      IOSChrome144,
+	"ios-safari-latest":      IOSSafari18,
+	"android-chrome-latest":  AndroidChrome144,
 }
 
 // Get returns a preset by name, or chrome-latest as default
@@ -1241,13 +1355,13 @@ func getFirefox147Spec() *tls.ClientHelloSpec {
 				tls.ECDSAWithP256AndSHA256,
 				tls.ECDSAWithP384AndSHA384,
 				tls.ECDSAWithP521AndSHA512,
-				tls.ECDSAWithSHA1, // Legacy
 				tls.PSSWithSHA256,
 				tls.PSSWithSHA384,
 				tls.PSSWithSHA512,
 				tls.PKCS1WithSHA256,
 				tls.PKCS1WithSHA384,
 				tls.PKCS1WithSHA512,
+				tls.ECDSAWithSHA1, // Legacy
 				tls.PKCS1WithSHA1, // Legacy
 			}},
 			&tls.PSKKeyExchangeModesExtension{Modes: []uint8{1}},    // psk_dhe_ke
@@ -1298,13 +1412,13 @@ func getFirefox147QUICSpec() *tls.ClientHelloSpec {
 				tls.ECDSAWithP256AndSHA256,
 				tls.ECDSAWithP384AndSHA384,
 				tls.ECDSAWithP521AndSHA512,
-				tls.ECDSAWithSHA1,
 				tls.PSSWithSHA256,
 				tls.PSSWithSHA384,
 				tls.PSSWithSHA512,
 				tls.PKCS1WithSHA256,
 				tls.PKCS1WithSHA384,
 				tls.PKCS1WithSHA512,
+				tls.ECDSAWithSHA1,
 				tls.PKCS1WithSHA1,
 			}},
 			&tls.PSKKeyExchangeModesExtension{Modes: []uint8{1}}, // psk_dhe_ke
@@ -1,7 +1,12 @@
 package fingerprint
 
 import (
+	"fmt"
+	"reflect"
+	"strings"
 	"testing"
+
+	tls "github.com/sardanioss/utls"
 )
 
 func TestAvailableWithInfo(t *testing.T) {
@@ -49,7 +54,7 @@ func TestAvailableWithInfo(t *testing.T) {
 		"chrome-144", "chrome-144-windows", "chrome-144-linux", "chrome-144-macos",
 		"safari-18", "ios-chrome-143", "ios-chrome-144",
 		"ios-safari-18", "android-chrome-143", "android-chrome-144",
-		"firefox-147",
+		"firefox-147", "firefox-147-windows", "firefox-147-linux", "firefox-147-macos",
 	}
 	for _, name := range h3Presets {
 		pi, ok := info[name]
@@ -69,7 +74,10 @@ func TestAvailableWithInfo(t *testing.T) {
 	}
 
 	// Known non-H3 presets must NOT have h3
-	noH3Presets := []string{"chrome-133", "chrome-141", "firefox-133", "ios-safari-17"}
+	noH3Presets := []string{
+		"chrome-133", "chrome-141", "ios-safari-17",
+		"firefox-133", "firefox-133-windows", "firefox-133-linux", "firefox-133-macos",
+	}
 	for _, name := range noH3Presets {
 		pi, ok := info[name]
 		if !ok {
@@ -83,3 +91,93 @@ func TestAvailableWithInfo(t *testing.T) {
 		}
 	}
 }
+
+func TestFirefoxPlatformVariantsMatchBase(t *testing.T) {
+	for variant, base := range map[string]string{
+		"firefox-133-windows": "firefox-133", "firefox-133-macos": "firefox-133", "firefox-133-linux": "firefox-133",
+		"firefox-147-windows": "firefox-147", "firefox-147-macos": "firefox-147", "firefox-147-linux": "firefox-147",
+	} {
+		v, b := Get(variant), Get(base)
+		if v.ClientHelloID != b.ClientHelloID || v.QUICClientHelloID != b.QUICClientHelloID {
+			t.Errorf("%s: ClientHello IDs %v/%v, %s has %v/%v", variant, v.ClientHelloID, v.QUICClientHelloID, base, b.ClientHelloID, b.QUICClientHelloID)
+		}
+		if !reflect.DeepEqual(specShape(v.CustomClientHelloSpec), specShape(b.CustomClientHelloSpec)) {
+			t.Errorf("%s: TCP ClientHello differs from %s", variant, base)
+		}
+		if !reflect.DeepEqual(specShape(v.CustomQUICClientHelloSpec), specShape(b.CustomQUICClientHelloSpec)) {
+			t.Errorf("%s: QUIC ClientHello differs from %s", variant, base)
+		}
+		if !reflect.DeepEqual(v.HTTP2Settings, b.HTTP2Settings) {
+			t.Errorf("%s: HTTP/2 settings %+v, %s has %+v", variant, v.HTTP2Settings, base, b.HTTP2Settings)
+		}
+		if !reflect.DeepEqual(v.H3Settings(), b.H3Settings()) {
+			t.Errorf("%s: HTTP/3 settings %v, %s has %v", variant, v.H3Settings(), base, b.H3Settings())
+		}
+		if !reflect.DeepEqual(v.QUICInitial(), b.QUICInitial()) {
+			t.Errorf("%s: QUIC Initial settings differ from %s", variant, base)
+		}
+		if v.SupportHTTP3 != b.SupportHTTP3 {
+			t.Errorf("%s: SupportHTTP3 = %v, %s has %v", variant, v.SupportHTTP3, base, b.SupportHTTP3)
+		}
+		if !reflect.DeepEqual(v.Headers, b.Headers) {
+			t.Errorf("%s: headers %v, %s has %v", variant, v.Headers, base, b.Headers)
+		}
+		if !reflect.DeepEqual(v.HeaderOrder, b.HeaderOrder) {
+			t.Errorf("%s: header order %v, %s has %v", variant, v.HeaderOrder, base, b.HeaderOrder)
+		}
+		if version := strings.TrimPrefix(base, "firefox-"); !strings.HasSuffix(v.UserAgent, "Firefox/"+version+".0") {
+			t.Errorf("%s: User-Agent %q is not Firefox %s", variant, v.UserAgent, version)
+		}
+	}
+}
+
+// specShape describes a ClientHello spec by its cipher suites and
+// extension types, which don't change between calls the way GREASE and key
+// shares do
+func specShape(spec func() *tls.ClientHelloSpec) []string {
+	if spec == nil {
+		return nil
+	}
+	s := spec()
+	var shape []string
+	for _, c := range s.CipherSuites {
+		shape = append(shape, fmt.Sprintf("cipher %#04x", c))
+	}
+	for _, ext := range s.Extensions {
+		shape = append(shape, fmt.Sprintf("%T", ext))
+	}
+	return shape
+}
+
+func TestFirefoxHTTP2Profile(t *testing.T) {
+	for _, name := range []string{"firefox-133", "firefox-147", "firefox-133-windows", "firefox-147-linux"} {
+		settings := Get(name).HTTP2Settings
+
+		order, values := settings.SettingsFrame()
+		wantOrder := []uint16{H2SettingHeaderTableSize, H2SettingEnablePush, H2SettingInitialWindowSize, H2SettingMaxFrameSize}
+		if len(order) != len(wantOrder) {
+			t.Fatalf("%s: settings order %v, want %v", name, order, wantOrder)
+		}
+		for i := range wantOrder {
+			if order[i] != wantOrder[i] {
+				t.Fatalf("%s: settings order %v, want %v", name, order, wantOrder)
+			}
+		}
+		if values[H2SettingEnablePush] != 0 || values[H2SettingMaxFrameSize] != 16384 {
+			t.Errorf("%s: unexpected settings values %v", name, values)
+		}
+
+		pseudo := settings.PseudoHeaders()
+		if len(pseudo) != 4 || pseudo[1] != ":path" || pseudo[3] != ":scheme" {
+			t.Errorf("%s: pseudo-header order %v, want m,p,a,s", name, pseudo)
+		}
+	}
+
+	// Presets without an explicit layout keep the Chrome/Safari defaults
+	if order, _ := Get("chrome-144").HTTP2Settings.SettingsFrame(); order[len(order)-1] != H2SettingMaxHeaderListSize {
+		t.Errorf("chrome-144 settings order changed: %v", order)
+	}
+	if order, _ := Get("safari-18").HTTP2Settings.SettingsFrame(); order[len(order)-1] != H2SettingNoRFC7540Priorities {
+		t.Errorf("safari-18 settings order changed: %v", order)
+	}
+}
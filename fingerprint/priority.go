@@ -0,0 +1,153 @@
+package fingerprint
+
+import (
+	"strconv"
+	"strings"
+)
+
+// PriorityRules describe the Priority request header (RFC 9218) a browser
+// sends for each kind of request. Browsers derive it from their internal
+// request priority, so it differs by destination as well as by browser:
+// Chrome marks render-blocking CSS, scripts and fonts non-incremental and
+// leaves the default urgency (3) off images, while Firefox uses its own
+// urgency scale and also sends the header over HTTP/1.1.
+type PriorityRules struct {
+	// Values maps Sec-Fetch-Dest to the header value
+	Values map[FetchDest]string
+
+	// Default is sent for destinations missing from Values. "" sends no
+	// Priority header for them.
+	Default string
+
+	// HTTP1 sends the header over HTTP/1.1 too. Chrome only sends it on
+	// HTTP/2 and HTTP/3.
+	HTTP1 bool
+
+	// HTTP3 holds values that differ over HTTP/3, by destination
+	HTTP3 map[FetchDest]string
+}
+
+var (
+	chromePriorityRules = PriorityRules{
+		Values: map[FetchDest]string{
+			FetchDestDocument: "u=0, i",
+			FetchDestStyle:    "u=0",
+			FetchDestFont:     "u=0",
+			FetchDestScript:   "u=1",
+			FetchDestImage:    "i",
+			FetchDestXHR:      "u=1, i",
+		},
+		Default: "u=1, i",
+	}
+
+	firefoxPriorityRules = PriorityRules{
+		Values: map[FetchDest]string{
+			FetchDestDocument: "u=0, i",
+			FetchDestStyle:    "u=2",
+			FetchDestScript:   "u=2",
+			FetchDestFont:     "u=3",
+			FetchDestXHR:      "u=4",
+			FetchDestImage:    "u=5, i",
+		},
+		Default: "u=4",
+		HTTP1:   true,
+	}
+)
+
+// Priorities returns the preset's Priority header rules. Presets without
+// explicit Priority rules get their browser family's, unless their
+// navigation headers carry no Priority at all (Safari, older Firefox), in
+// which case no request sends one. A nil preset gets Chrome's.
+func (p *Preset) Priorities() PriorityRules {
+	switch {
+	case p == nil:
+		return chromePriorityRules
+	case p.Priority != nil:
+		return *p.Priority
+	}
+	if _, ok := p.Headers["Priority"]; !ok {
+		return PriorityRules{}
+	}
+	if strings.Contains(p.Name, "firefox") {
+		return firefoxPriorityRules
+	}
+	return chromePriorityRules
+}
+
+// Value returns the Priority header for a request to dest over protocol
+// ("h1", "h2" or "h3"), or "" if the browser sends none
+func (r PriorityRules) Value(dest FetchDest, protocol string) string {
+	if protocol == "h1" && !r.HTTP1 {
+		return ""
+	}
+	if protocol == "h3" {
+		if v, ok := r.HTTP3[dest]; ok {
+			return v
+		}
+	}
+	if v, ok := r.Values[dest]; ok {
+		return v
+	}
+	return r.Default
+}
+
+// Sends reports whether the browser sends a Priority header on protocol
+// for any request
+func (r PriorityRules) Sends(protocol string) bool {
+	if protocol == "h1" && !r.HTTP1 {
+		return false
+	}
+	return len(r.Values) > 0 || len(r.HTTP3) > 0 || r.Default != ""
+}
+
+// PriorityHeader returns the Priority header the preset's browser sends for
+// a request to dest over protocol, or "" if it sends none
+func (p *Preset) PriorityHeader(dest FetchDest, protocol string) string {
+	return p.Priorities().Value(dest, protocol)
+}
+
+// Priority is a request's RFC 9218 priority: urgency 0 (highest) to 7 and
+// whether its response can be processed incrementally
+type Priority struct {
+	Urgency     int
+	Incremental bool
+}
+
+// String formats p as a Priority header value the way Chrome does: "u=0, i",
+// "u=1", "i". Defaults are left out, so urgency 3 without incremental is ""
+// and such a request goes without the header.
+func (p Priority) String() string {
+	var members []string
+	if p.Urgency != 3 && p.Urgency >= 0 && p.Urgency <= 7 {
+		members = append(members, "u="+strconv.Itoa(p.Urgency))
+	}
+	if p.Incremental {
+		members = append(members, "i")
+	}
+	return strings.Join(members, ", ")
+}
+
+// ParsePriority reads the urgency (0-7, default 3) and incremental flag of
+// a Priority header value (RFC 9218 Section 4). Unknown and malformed
+// members are ignored, as the RFC asks.
+func ParsePriority(value string) (urgency int, incremental bool) {
+	urgency = 3
+	for _, member := range strings.Split(value, ",") {
+		member, _, _ = strings.Cut(strings.TrimSpace(member), ";") // Parameters
+		key, v, hasValue := strings.Cut(member, "=")
+		switch key {
+		case "u":
+			if len(v) == 1 && v[0] >= '0' && v[0] <= '7' {
+				urgency = int(v[0] - '0')
+			}
+		case "i":
+			switch {
+			case !hasValue || v == "?1":
+				incremental = true
+			case v == "?0":
+				incremental = false
+			}
+		}
+	}
+	return urgency, incremental
+}
@@ -0,0 +1,88 @@
+package fingerprint
+
+import "testing"
+
+func TestPriorityHeader(t *testing.T) {
+	tests := []struct {
+		preset   string
+		dest     FetchDest
+		protocol string
+		want     string
+	}{
+		{"chrome-143", FetchDestDocument, "h2", "u=0, i"},
+		{"chrome-143", FetchDestDocument, "h3", "u=0, i"},
+		{"chrome-143", FetchDestDocument, "h1", ""},
+		{"chrome-143", FetchDestStyle, "h2", "u=0"},
+		{"chrome-143", FetchDestImage, "h2", "i"},
+		{"chrome-143", FetchDestXHR, "h3", "u=1, i"},
+		{"chrome-143", FetchDestManifest, "h2", "u=1, i"},
+		{"firefox-147-linux", FetchDestDocument, "h1", "u=0, i"},
+		{"firefox-147-linux", FetchDestImage, "h2", "u=5, i"},
+		{"firefox-147-linux", FetchDestXHR, "h2", "u=4"},
+		{"firefox-133", FetchDestDocument, "h2", ""}, // Preset sends no Priority
+		{"safari-18", FetchDestDocument, "h2", ""},
+		{"safari-18", FetchDestXHR, "h3", ""},
+	}
+	for _, tt := range tests {
+		if got := Get(tt.preset).PriorityHeader(tt.dest, tt.protocol); got != tt.want {
+			t.Errorf("%s: PriorityHeader(%s, %s) = %q, want %q", tt.preset, tt.dest, tt.protocol, got, tt.want)
+		}
+	}
+
+	// Explicit rules override the family's, per protocol
+	p := Get("chrome-143")
+	p.Priority = &PriorityRules{
+		Values: map[FetchDest]string{FetchDestDocument: "u=0, i"},
+		HTTP3:  map[FetchDest]string{FetchDestDocument: "u=0"},
+	}
+	if got := p.PriorityHeader(FetchDestDocument, "h3"); got != "u=0" {
+		t.Errorf("HTTP3 override = %q, want u=0", got)
+	}
+	if got := p.PriorityHeader(FetchDestImage, "h2"); got != "" {
+		t.Errorf("destination without a value = %q, want none", got)
+	}
+}
+
+func TestParsePriority(t *testing.T) {
+	tests := []struct {
+		value       string
+		urgency     int
+		incremental bool
+	}{
+		{"", 3, false},
+		{"u=0, i", 0, true},
+		{"i", 3, true},
+		{"u=5, i=?0", 5, false},
+		{"u=1;x=y, i=?1", 1, true},
+		{"u=8, u=x, foo=1", 3, false},
+	}
+	for _, tt := range tests {
+		u, i := ParsePriority(tt.value)
+		if u != tt.urgency || i != tt.incremental {
+			t.Errorf("ParsePriority(%q) = %d, %v, want %d, %v", tt.value, u, i, tt.urgency, tt.incremental)
+		}
+	}
+
+	// String writes Chrome's form, which ParsePriority reads back
+	for _, p := range []Priority{{0, true}, {1, false}, {3, true}, {3, false}, {7, false}} {
+		u, i := ParsePriority(p.String())
+		if u != p.Urgency || i != p.Incremental {
+			t.Errorf("%+v formatted as %q", p, p.String())
+		}
+	}
+	if got := (Priority{Urgency: 0, Incremental: true}).String(); got != "u=0, i" {
+		t.Errorf("String() = %q, want u=0, i", got)
+	}
+
+	// Chrome weighs HEADERS by the urgency its Priority header carries
+	s := Get("chrome-143").HTTP2Settings
+	for value, want := range map[string]uint16{"u=0, i": 256, "u=1": 220, "i": 147} {
+		u, _ := ParsePriority(value)
+		if got := s.HeaderWeight(u); got != want {
+			t.Errorf("chrome-143 weight for %q = %d, want %d", value, got, want)
+		}
+	}
+	if got := s.HeaderWeight(-1); got != s.StreamWeight {
+		t.Errorf("weight without Priority = %d, want %d", got, s.StreamWeight)
+	}
+}
@@ -0,0 +1,37 @@
+package fingerprint
+
+// QUICInitialSettings shapes the client's Initial packets. They travel
+// before any encryption a passive observer can't undo, so their sizes and
+// layout fingerprint the QUIC stack as surely as the ClientHello inside.
+//
+// Retransmission of lost Initials follows the QUIC stack's loss recovery
+// (a PTO doubling from the initial RTT estimate) and isn't set per preset.
+type QUICInitialSettings struct {
+	// PacketSize is the UDP payload every Initial datagram is padded to
+	PacketSize uint16
+
+	// ChromeFrames splits the ClientHello across CRYPTO frames interleaved
+	// with PING and PADDING frames, coalesced the way Chrome lays them out
+	ChromeFrames bool
+
+	// ScrambleClientHello reorders the CRYPTO frames so the SNI isn't in
+	// the first packet, as quic-go does by default. Browsers don't.
+	ScrambleClientHello bool
+}
+
+// chromeQUICInitial is Chrome's layout: 1250-byte datagrams carrying the
+// ClientHello in order
+var chromeQUICInitial = QUICInitialSettings{
+	PacketSize:   1250,
+	ChromeFrames: true,
+}
+
+// QUICInitial returns how the preset's Initial packets are laid out. Presets
+// without explicit QUICInitialSettings, and a nil preset, get Chrome's; no
+// built-in preset sets its own yet.
+func (p *Preset) QUICInitial() QUICInitialSettings {
+	if p != nil && p.QUICInitialSettings != nil {
+		return *p.QUICInitialSettings
+	}
+	return chromeQUICInitial
+}
@@ -0,0 +1,190 @@
+package fingerprint
+
+import (
+	"net/url"
+	"strings"
+)
+
+// RedirectMethod returns the method a browser uses to follow a redirect.
+// 307 and 308 replay the request unchanged; 303 switches to GET (HEAD stays
+// HEAD); 301 and 302 switch only POST to GET.
+func RedirectMethod(status int, method string) string {
+	switch status {
+	case 303:
+		if method != "HEAD" {
+			return "GET"
+		}
+	case 301, 302:
+		if method == "POST" {
+			return "GET"
+		}
+	}
+	return method
+}
+
+// IsRequestBodyHeader reports whether a header describes the request body.
+// Browsers drop these when a redirect changes the method to GET.
+func IsRequestBodyHeader(name string) bool {
+	switch strings.ToLower(name) {
+	case "content-type", "content-length", "content-encoding", "content-language", "content-location":
+		return true
+	}
+	return false
+}
+
+// Referrer policies (https://w3c.github.io/webappsec-referrer-policy/)
+var referrerPolicies = map[string]bool{
+	"no-referrer":                     true,
+	"no-referrer-when-downgrade":      true,
+	"origin":                          true,
+	"origin-when-cross-origin":        true,
+	"same-origin":                     true,
+	"strict-origin":                   true,
+	"strict-origin-when-cross-origin": true,
+	"unsafe-url":                      true,
+}
+
+// ParseReferrerPolicy returns the policy set by a Referrer-Policy header, or
+// current if the header names none. Like browsers, the last recognised token
+// wins, so sites can list fallbacks first.
+func ParseReferrerPolicy(header, current string) string {
+	policy := current
+	for _, token := range strings.Split(header, ",") {
+		token = strings.ToLower(strings.TrimSpace(token))
+		if referrerPolicies[token] {
+			policy = token
+		}
+	}
+	return policy
+}
+
+// RedirectReferer returns the Referer for the next request of a redirect
+// chain. Browsers keep the referrer of the original request (not the
+// redirecting URL) and re-apply the referrer policy at every hop. An empty
+// policy means strict-origin-when-cross-origin, the browser default.
+func RedirectReferer(referrer, nextURL, policy string) string {
+	if referrer == "" {
+		return ""
+	}
+	ref, err := url.Parse(referrer)
+	if err != nil {
+		return ""
+	}
+	next, err := url.Parse(nextURL)
+	if err != nil {
+		return ""
+	}
+
+	ref.User = nil
+	ref.Fragment = ""
+	full := ref.String()
+	origin := ref.Scheme + "://" + ref.Host + "/"
+	sameOrigin := ref.Scheme == next.Scheme && ref.Host == next.Host
+	downgrade := ref.Scheme == "https" && next.Scheme != "https"
+
+	switch policy {
+	case "no-referrer":
+		return ""
+	case "unsafe-url":
+		return full
+	case "origin":
+		return origin
+	case "same-origin":
+		if sameOrigin {
+			return full
+		}
+		return ""
+	case "origin-when-cross-origin":
+		if sameOrigin {
+			return full
+		}
+		return origin
+	case "no-referrer-when-downgrade":
+		if downgrade {
+			return ""
+		}
+		return full
+	case "strict-origin":
+		if downgrade {
+			return ""
+		}
+		return origin
+	default: // strict-origin-when-cross-origin
+		if sameOrigin {
+			return full
+		}
+		if downgrade {
+			return ""
+		}
+		return origin
+	}
+}
+
+// RedirectFetchSite returns Sec-Fetch-Site for the next request of a redirect
+// chain. The value compares every URL in the chain with the initiator and
+// keeps the least trusted result, so once a chain goes cross-site it stays
+// cross-site. User-initiated navigations (site "none") stay "none".
+func RedirectFetchSite(site FetchSite, initiator, nextURL string) FetchSite {
+	if site == FetchSiteNone || site == "" {
+		return FetchSiteNone
+	}
+	next := calculateFetchSite(initiator, nextURL)
+	if next == FetchSiteNone {
+		next = FetchSiteCrossSite
+	}
+	if fetchSiteRank[next] > fetchSiteRank[site] {
+		return next
+	}
+	return site
+}
+
+var fetchSiteRank = map[FetchSite]int{
+	FetchSiteSameOrigin: 1,
+	FetchSiteSameSite:   2,
+	FetchSiteCrossSite:  3,
+}
+
+// RedirectOrigin returns the Origin header for the next request of a
+// redirect chain. A hop to a URL that is cross-origin to both the current URL
+// and the request's origin taints it, and browsers then send "null".
+func RedirectOrigin(origin, currentURL, nextURL string) string {
+	if origin == "" || origin == "null" {
+		return origin
+	}
+	next, err := url.Parse(nextURL)
+	if err != nil {
+		return "null"
+	}
+	nextOrigin := next.Scheme + "://" + next.Host
+	if nextOrigin == origin {
+		return origin
+	}
+	if cur, err := url.Parse(currentURL); err == nil && cur.Scheme+"://"+cur.Host == nextOrigin {
+		return origin
+	}
+	return "null"
+}
+
+// IsRedirectCredentialHeader reports whether a request header carries
+// credentials for the origin it was sent to: Authorization, Cookie, the
+// common API key headers, or one of extra. Browsers and curl don't carry
+// these over when a redirect leaves the origin, and neither must we.
+func IsRedirectCredentialHeader(name string, extra []string) bool {
+	switch strings.ToLower(name) {
+	case "authorization", "cookie", "cookie2", "x-api-key", "x-auth-token":
+		return true
+	}
+	for _, e := range extra {
+		if strings.EqualFold(name, e) {
+			return true
+		}
+	}
+	return false
+}
+
+// CrossOrigin reports whether two URLs differ in scheme, host or port. An
+// unparsable URL counts as cross-origin.
+func CrossOrigin(a, b string) bool {
+	origin := originOf(a)
+	return origin == "" || origin != originOf(b)
+}
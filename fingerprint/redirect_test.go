@@ -0,0 +1,108 @@
+package fingerprint
+
+import "testing"
+
+func TestRedirectMethod(t *testing.T) {
+	tests := []struct {
+		status       int
+		method, want string
+	}{
+		{307, "POST", "POST"},
+		{308, "PUT", "PUT"},
+		{303, "POST", "GET"},
+		{303, "HEAD", "HEAD"},
+		{302, "POST", "GET"},
+		{301, "PUT", "PUT"},
+	}
+	for _, tt := range tests {
+		if got := RedirectMethod(tt.status, tt.method); got != tt.want {
+			t.Errorf("RedirectMethod(%d, %s) = %s, want %s", tt.status, tt.method, got, tt.want)
+		}
+	}
+}
+
+func TestRedirectReferer(t *testing.T) {
+	const ref = "https://shop.example.com/cart?id=1#top"
+	tests := []struct {
+		next, policy, want string
+	}{
+		{"https://shop.example.com/pay", "", "https://shop.example.com/cart?id=1"},
+		{"https://pay.other.com/", "", "https://shop.example.com/"},
+		{"http://shop.example.com/", "", ""},
+		{"https://pay.other.com/", "unsafe-url", "https://shop.example.com/cart?id=1"},
+		{"https://shop.example.com/pay", "no-referrer", ""},
+		{"https://pay.other.com/", "same-origin", ""},
+		{"https://shop.example.com/pay", "origin", "https://shop.example.com/"},
+	}
+	for _, tt := range tests {
+		if got := RedirectReferer(ref, tt.next, tt.policy); got != tt.want {
+			t.Errorf("RedirectReferer(%s, %q) = %q, want %q", tt.next, tt.policy, got, tt.want)
+		}
+	}
+
+	if got := ParseReferrerPolicy("unknown, no-referrer, bogus", ""); got != "no-referrer" {
+		t.Errorf("ParseReferrerPolicy = %q, want no-referrer", got)
+	}
+}
+
+func TestRedirectFetchSiteAndOrigin(t *testing.T) {
+	const initiator = "https://www.example.com"
+
+	site := RedirectFetchSite(FetchSiteSameOrigin, initiator, "https://api.example.com/login")
+	if site != FetchSiteSameSite {
+		t.Errorf("same-site hop: got %s", site)
+	}
+	site = RedirectFetchSite(site, initiator, "https://sso.other.com/")
+	if site != FetchSiteCrossSite {
+		t.Errorf("cross-site hop: got %s", site)
+	}
+	// Returning to the initiator does not make the chain same-origin again
+	if site = RedirectFetchSite(site, initiator, "https://www.example.com/done"); site != FetchSiteCrossSite {
+		t.Errorf("return hop: got %s", site)
+	}
+	if site = RedirectFetchSite(FetchSiteNone, "", "https://other.com/"); site != FetchSiteNone {
+		t.Errorf("user navigation: got %s", site)
+	}
+
+	if got := RedirectOrigin(initiator, "https://www.example.com/a", "https://www.example.com/b"); got != initiator {
+		t.Errorf("same-origin hop: got %s", got)
+	}
+	origin := RedirectOrigin(initiator, "https://www.example.com/a", "https://sso.other.com/")
+	if origin != "null" {
+		t.Errorf("cross-origin hop: got %s, want null", origin)
+	}
+	if got := RedirectOrigin(origin, "https://sso.other.com/", "https://www.example.com/"); got != "null" {
+		t.Errorf("tainted origin must stay null, got %s", got)
+	}
+}
+
+func TestCrossOrigin(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"https://a.example/x", "https://a.example/y?z", false},
+		{"https://a.example/", "http://a.example/", true},
+		{"https://a.example/", "https://b.a.example/", true},
+		{"https://a.example/", "https://a.example:8443/", true},
+		{"https://a.example/", "::bad", true},
+	}
+	for _, tt := range tests {
+		if got := CrossOrigin(tt.a, tt.b); got != tt.want {
+			t.Errorf("CrossOrigin(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestIsRedirectCredentialHeader(t *testing.T) {
+	for _, name := range []string{"Authorization", "cookie", "X-Api-Key", "X-Tenant-Secret"} {
+		if !IsRedirectCredentialHeader(name, []string{"x-tenant-secret"}) {
+			t.Errorf("%s not a credential", name)
+		}
+	}
+	for _, name := range []string{"Accept", "Referer", "Proxy-Authorization"} {
+		if IsRedirectCredentialHeader(name, nil) {
+			t.Errorf("%s is a credential", name)
+		}
+	}
+}
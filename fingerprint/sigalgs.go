@@ -0,0 +1,152 @@
+package fingerprint
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	tls "github.com/sardanioss/utls"
+)
+
+// SignatureAlgorithmRules pins the contents and order of the
+// signature_algorithms (13) and signature_algorithms_cert (50) extensions.
+// Some vendors hash these apart from JA3/JA4, and the lists in utls's
+// parrots drift between releases, so presets state them explicitly.
+type SignatureAlgorithmRules struct {
+	Schemes []tls.SignatureScheme // signature_algorithms, in wire order
+
+	// CertSchemes is signature_algorithms_cert. Nil for browsers that don't
+	// send the extension, which is then removed.
+	CertSchemes []tls.SignatureScheme
+
+	// Keep leaves both extensions as the ClientHello has them, e.g. for a
+	// spec built from a captured fingerprint
+	Keep bool
+}
+
+var (
+	// Chrome and Chromium-based browsers on every platform but iOS
+	chromeSignatureAlgorithms = SignatureAlgorithmRules{Schemes: []tls.SignatureScheme{
+		tls.ECDSAWithP256AndSHA256,
+		tls.PSSWithSHA256,
+		tls.PKCS1WithSHA256,
+		tls.ECDSAWithP384AndSHA384,
+		tls.PSSWithSHA384,
+		tls.PKCS1WithSHA384,
+		tls.PSSWithSHA512,
+		tls.PKCS1WithSHA512,
+	}}
+
+	// NSS keeps the legacy SHA-1 schemes at the end
+	firefoxSignatureAlgorithms = SignatureAlgorithmRules{Schemes: []tls.SignatureScheme{
+		tls.ECDSAWithP256AndSHA256,
+		tls.ECDSAWithP384AndSHA384,
+		tls.ECDSAWithP521AndSHA512,
+		tls.PSSWithSHA256,
+		tls.PSSWithSHA384,
+		tls.PSSWithSHA512,
+		tls.PKCS1WithSHA256,
+		tls.PKCS1WithSHA384,
+		tls.PKCS1WithSHA512,
+		tls.ECDSAWithSHA1,
+		tls.PKCS1WithSHA1,
+	}}
+
+	// Safari and every iOS browser (WebKit). rsa_pss_rsae_sha384 really is
+	// listed twice.
+	safariSignatureAlgorithms = SignatureAlgorithmRules{Schemes: []tls.SignatureScheme{
+		tls.ECDSAWithP256AndSHA256,
+		tls.PSSWithSHA256,
+		tls.PKCS1WithSHA256,
+		tls.ECDSAWithP384AndSHA384,
+		tls.ECDSAWithSHA1,
+		tls.PSSWithSHA384,
+		tls.PSSWithSHA384,
+		tls.PKCS1WithSHA384,
+		tls.PSSWithSHA512,
+		tls.PKCS1WithSHA512,
+		tls.PKCS1WithSHA1,
+	}}
+)
+
+// SignatureRules returns the signature algorithm lists the preset's
+// ClientHello must carry. Presets without explicit rules get their browser
+// family's; a preset from no known family (or a nil one) keeps its spec.
+func (p *Preset) SignatureRules() SignatureAlgorithmRules {
+	switch {
+	case p == nil:
+		return SignatureAlgorithmRules{Keep: true}
+	case p.SignatureAlgorithms != nil:
+		return *p.SignatureAlgorithms
+	}
+	switch name := p.Name; {
+	case strings.HasPrefix(name, "ios-"), strings.Contains(name, "safari"):
+		return safariSignatureAlgorithms
+	case strings.Contains(name, "firefox"):
+		return firefoxSignatureAlgorithms
+	case strings.Contains(name, "chrome"):
+		return chromeSignatureAlgorithms
+	}
+	return SignatureAlgorithmRules{Keep: true}
+}
+
+// ApplySignatureAlgorithms rewrites the signature algorithm extensions of
+// spec to the preset's rules, leaving their position in the extension list
+// alone. A spec without signature_algorithms is left as it is.
+func ApplySignatureAlgorithms(spec *tls.ClientHelloSpec, p *Preset) {
+	rules := p.SignatureRules()
+	if spec == nil || rules.Keep {
+		return
+	}
+	hasSigAlgs := slices.ContainsFunc(spec.Extensions, func(ext tls.TLSExtension) bool {
+		_, ok := ext.(*tls.SignatureAlgorithmsExtension)
+		return ok
+	})
+	if !hasSigAlgs {
+		return
+	}
+
+	extensions := spec.Extensions[:0]
+	for _, ext := range spec.Extensions {
+		switch e := ext.(type) {
+		case *tls.SignatureAlgorithmsExtension:
+			e.SupportedSignatureAlgorithms = slices.Clone(rules.Schemes)
+		case *tls.SignatureAlgorithmsCertExtension:
+			if rules.CertSchemes == nil {
+				continue
+			}
+			e.SupportedSignatureAlgorithms = slices.Clone(rules.CertSchemes)
+		}
+		extensions = append(extensions, ext)
+	}
+	spec.Extensions = extensions
+}
+
+// CheckSignatureAlgorithms reports where the signature algorithm lists of
+// a ClientHello differ from the preset's rules. sigAlgs and certSigAlgs are
+// the lists as sent; certSigAlgs is nil when the extension was absent.
+func CheckSignatureAlgorithms(p *Preset, sigAlgs, certSigAlgs []tls.SignatureScheme) error {
+	rules := p.SignatureRules()
+	if rules.Keep {
+		return nil
+	}
+	if !slices.Equal(sigAlgs, rules.Schemes) {
+		return fmt.Errorf("%s: signature_algorithms %s, want %s", p.Name, schemeList(sigAlgs), schemeList(rules.Schemes))
+	}
+	if (certSigAlgs == nil) != (rules.CertSchemes == nil) || !slices.Equal(certSigAlgs, rules.CertSchemes) {
+		return fmt.Errorf("%s: signature_algorithms_cert %s, want %s", p.Name, schemeList(certSigAlgs), schemeList(rules.CertSchemes))
+	}
+	return nil
+}
+
+// schemeList formats schemes the way fingerprint sites do: "0403,0804,..."
+func schemeList(schemes []tls.SignatureScheme) string {
+	if schemes == nil {
+		return "(absent)"
+	}
+	parts := make([]string, len(schemes))
+	for i, s := range schemes {
+		parts[i] = fmt.Sprintf("%04x", uint16(s))
+	}
+	return strings.Join(parts, ",")
+}
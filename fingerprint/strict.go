@@ -0,0 +1,108 @@
+package fingerprint
+
+import (
+	tls "github.com/sardanioss/utls"
+)
+
+// StrictPresetName names the preset Strict returns
+const StrictPresetName = "strict"
+
+// Strict returns a preset that impersonates no browser: the ClientHello of
+// Go's crypto/tls, Go's HTTP/2 settings and no headers beyond User-Agent and
+// Accept-Encoding, as net/http sends them. Comparing it with a browser
+// preset from the same IP and cookies tells fingerprint-based blocking from
+// IP-based blocking. It has no HTTP/3 and is not listed by Available.
+func Strict() *Preset {
+	return &Preset{
+		Name:                  StrictPresetName,
+		CustomClientHelloSpec: getStrictSpec,
+		UserAgent:             "Go-http-client/1.1",
+		Headers: map[string]string{
+			"Accept-Encoding": "gzip",
+		},
+		HeaderOrder: []HeaderPair{
+			{"user-agent", ""}, // Placeholder - actual value set from preset.UserAgent
+			{"accept-encoding", "gzip"},
+		},
+		// net/http's HTTP/2 client: ENABLE_PUSH, INITIAL_WINDOW_SIZE and
+		// MAX_HEADER_LIST_SIZE, a 1GB connection window and the default
+		// stream priority (weight 16, no dependency)
+		HTTP2Settings: HTTP2Settings{
+			HeaderTableSize:        4096,
+			EnablePush:             false,
+			InitialWindowSize:      4194304,
+			MaxFrameSize:           16384,
+			MaxHeaderListSize:      10485760,
+			ConnectionWindowUpdate: 1073741824,
+			StreamWeight:           16,
+			StreamExclusive:        false,
+			SettingsOrder:          []uint16{H2SettingEnablePush, H2SettingInitialWindowSize, H2SettingMaxHeaderListSize},
+			PseudoHeaderOrder:      []string{":authority", ":method", ":path", ":scheme"}, // a,m,p,s
+		},
+		SignatureAlgorithms: &SignatureAlgorithmRules{Keep: true},
+		SupportHTTP3:        false,
+	}
+}
+
+// getStrictSpec returns the ClientHello crypto/tls sends with its default
+// config: no GREASE, no extension shuffling
+func getStrictSpec() *tls.ClientHelloSpec {
+	return &tls.ClientHelloSpec{
+		CipherSuites: []uint16{
+			tls.TLS_AES_128_GCM_SHA256,
+			tls.TLS_AES_256_GCM_SHA384,
+			tls.TLS_CHACHA20_POLY1305_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
+		},
+		CompressionMethods: []uint8{0},
+		Extensions: []tls.TLSExtension{
+			&tls.SNIExtension{},
+			&tls.StatusRequestExtension{},
+			&tls.SupportedCurvesExtension{Curves: []tls.CurveID{
+				tls.CurveID(0x11ec), // X25519MLKEM768
+				tls.X25519,
+				tls.CurveP256,
+				tls.CurveP384,
+				tls.CurveP521,
+			}},
+			&tls.SupportedPointsExtension{SupportedPoints: []uint8{0}},
+			&tls.SessionTicketExtension{},
+			&tls.SignatureAlgorithmsExtension{SupportedSignatureAlgorithms: []tls.SignatureScheme{
+				tls.PSSWithSHA256,
+				tls.ECDSAWithP256AndSHA256,
+				tls.Ed25519,
+				tls.PSSWithSHA384,
+				tls.PSSWithSHA512,
+				tls.PKCS1WithSHA256,
+				tls.PKCS1WithSHA384,
+				tls.PKCS1WithSHA512,
+				tls.ECDSAWithP384AndSHA384,
+				tls.ECDSAWithP521AndSHA512,
+				tls.PKCS1WithSHA1,
+				tls.ECDSAWithSHA1,
+			}},
+			&tls.RenegotiationInfoExtension{Renegotiation: tls.RenegotiateOnceAsClient},
+			&tls.ExtendedMasterSecretExtension{},
+			&tls.ALPNExtension{AlpnProtocols: []string{"h2", "http/1.1"}},
+			&tls.SCTExtension{},
+			&tls.SupportedVersionsExtension{Versions: []uint16{
+				tls.VersionTLS13,
+				tls.VersionTLS12,
+			}},
+			&tls.KeyShareExtension{KeyShares: []tls.KeyShare{
+				{Group: tls.CurveID(0x11ec)}, // X25519MLKEM768
+				{Group: tls.X25519},
+			}},
+			&tls.PSKKeyExchangeModesExtension{Modes: []uint8{1}}, // psk_dhe_ke
+		},
+	}
+}
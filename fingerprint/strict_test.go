@@ -0,0 +1,30 @@
+package fingerprint
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestStrict(t *testing.T) {
+	p := Strict()
+	if slices.Contains(Available(), p.Name) {
+		t.Error("strict preset listed by Available")
+	}
+	if p.SupportHTTP3 {
+		t.Error("strict preset offers HTTP/3")
+	}
+	if got := p.PriorityHeader(FetchDestDocument, "h2"); got != "" {
+		t.Errorf("Priority = %q, want none", got)
+	}
+	if !p.SignatureRules().Keep {
+		t.Error("signature algorithms rewritten")
+	}
+
+	order, values := p.HTTP2Settings.SettingsFrame()
+	if !slices.Equal(order, []uint16{H2SettingEnablePush, H2SettingInitialWindowSize, H2SettingMaxHeaderListSize}) {
+		t.Errorf("SETTINGS order = %v", order)
+	}
+	if values[H2SettingEnablePush] != 0 || values[H2SettingInitialWindowSize] != 4194304 || values[H2SettingMaxHeaderListSize] != 10485760 {
+		t.Errorf("SETTINGS = %v", values)
+	}
+}
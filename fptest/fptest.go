@@ -0,0 +1,354 @@
+// Package fptest provides property-based checks for request header
+// fingerprints.
+//
+// It generates random request shapes (method, URL, body, extra headers,
+// protocol), builds the headers httpcloak would send for each one and asserts
+// invariants a real browser never breaks:
+//
+//   - preset headers keep the preset's relative order on the wire
+//   - no header is forbidden for the protocol (connection-specific headers on
+//     HTTP/2 and HTTP/3, Priority on Chrome's HTTP/1.1, malformed names/values)
+//   - User-Agent and Client Hints (sec-ch-ua*) describe the same browser
+//
+// Integrators that add or rewrite headers plug their logic in through
+// Options.Mutate (or Options.Build) and call Run from their own tests:
+//
+//	func TestMyHeaders(t *testing.T) {
+//		fptest.Run(t, fingerprint.Get("chrome-144"), fptest.Options{
+//			Mutate: func(r *rand.Rand, s *fptest.Shape) {
+//				s.Headers["X-Api-Key"] = []string{"k"}
+//			},
+//		})
+//	}
+package fptest
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	http "github.com/sardanioss/http"
+	"github.com/sardanioss/httpcloak/fingerprint"
+	"github.com/sardanioss/httpcloak/transport"
+)
+
+// Shape is one generated request
+type Shape struct {
+	Method      string
+	URL         string
+	Protocol    string              // "h1", "h2" or "h3"
+	Headers     map[string][]string // Headers set by the caller on top of the preset
+	HeaderOrder []string            // Custom header order (Session.SetHeaderOrder), nil for the preset's
+	Body        bool
+}
+
+func (s Shape) String() string {
+	return fmt.Sprintf("%s %s over %s (body=%t, headers=%v, order=%v)", s.Method, s.URL, s.Protocol, s.Body, s.Headers, s.HeaderOrder)
+}
+
+// Options controls Run
+type Options struct {
+	// N is the number of shapes to check (default 200)
+	N int
+
+	// Seed makes a run reproducible. 0 picks a time-based seed; the seed is
+	// always included in failure messages.
+	Seed int64
+
+	// Protocols to generate. Default: h1 and h2, plus h3 if the preset supports it.
+	Protocols []string
+
+	// Mutate applies the integrator's header logic to each generated shape
+	Mutate func(r *rand.Rand, s *Shape)
+
+	// Build turns a shape into the headers sent on the wire. Default:
+	// transport.PresetHeaders.
+	Build func(preset *fingerprint.Preset, s Shape) http.Header
+}
+
+// Violation is a broken invariant
+type Violation struct {
+	Rule   string // "order", "forbidden" or "client-hints"
+	Header string
+	Detail string
+}
+
+func (v *Violation) Error() string {
+	if v.Header == "" {
+		return v.Rule + ": " + v.Detail
+	}
+	return fmt.Sprintf("%s: %s: %s", v.Rule, v.Header, v.Detail)
+}
+
+// Run generates opts.N shapes for preset and fails t on the first one that
+// breaks an invariant.
+func Run(t testing.TB, preset *fingerprint.Preset, opts Options) {
+	t.Helper()
+	if preset == nil {
+		t.Fatal("fptest: nil preset")
+	}
+
+	n := opts.N
+	if n <= 0 {
+		n = 200
+	}
+	seed := opts.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	build := opts.Build
+	if build == nil {
+		build = BuildHeaders
+	}
+	protocols := opts.Protocols
+	if len(protocols) == 0 {
+		protocols = []string{"h1", "h2"}
+		if preset.SupportHTTP3 {
+			protocols = append(protocols, "h3")
+		}
+	}
+
+	r := rand.New(rand.NewSource(seed))
+	for i := 0; i < n; i++ {
+		shape := Generate(r, protocols)
+		if opts.Mutate != nil {
+			opts.Mutate(r, &shape)
+		}
+		if err := Check(preset, shape.Protocol, build(preset, shape)); err != nil {
+			t.Fatalf("fptest: preset %s, seed %d, case %d: %s\n%v", preset.Name, seed, i, shape, err)
+		}
+	}
+}
+
+// BuildHeaders returns the headers httpcloak sends for s
+func BuildHeaders(preset *fingerprint.Preset, s Shape) http.Header {
+	return transport.PresetHeaders(preset, s.Headers, s.HeaderOrder, false, s.Protocol)
+}
+
+var (
+	genMethods = []string{"GET", "GET", "GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+	genHosts   = []string{"example.com", "www.example.org", "api.example.net", "127.0.0.1:8443", "xn--bcher-kva.example"}
+	genSegs    = []string{"", "index.html", "api", "v1", "search", "static", "a%20b", "%2F", "ünïcode"}
+
+	// Headers callers commonly set; none of them touch the fingerprint
+	genHeaders = []string{
+		"X-Requested-With", "X-Api-Key", "X-Request-Id", "Authorization",
+		"Referer", "Origin", "Cache-Control", "Pragma", "If-None-Match",
+		"If-Modified-Since", "Range", "DNT",
+	}
+	genContentTypes = []string{"application/json", "application/x-www-form-urlencoded", "text/plain; charset=utf-8", "multipart/form-data; boundary=x"}
+)
+
+// Generate returns a random request shape over one of protocols
+func Generate(r *rand.Rand, protocols []string) Shape {
+	s := Shape{
+		Method:   genMethods[r.Intn(len(genMethods))],
+		Protocol: protocols[r.Intn(len(protocols))],
+		Headers:  make(map[string][]string),
+	}
+
+	scheme := "https"
+	if s.Protocol == "h1" && r.Intn(4) == 0 {
+		scheme = "http"
+	}
+	path := ""
+	for i := r.Intn(4); i > 0; i-- {
+		path += "/" + genSegs[r.Intn(len(genSegs))]
+	}
+	s.URL = scheme + "://" + genHosts[r.Intn(len(genHosts))] + path
+	if r.Intn(3) == 0 {
+		s.URL += fmt.Sprintf("?q=%d&page=%d", r.Intn(1000), r.Intn(10))
+	}
+
+	for i := r.Intn(4); i > 0; i-- {
+		name := genHeaders[r.Intn(len(genHeaders))]
+		// Callers write header names in any case
+		switch r.Intn(3) {
+		case 1:
+			name = strings.ToLower(name)
+		case 2:
+			name = strings.ToUpper(name)
+		}
+		s.Headers[name] = append(s.Headers[name], randomToken(r))
+	}
+
+	if s.Method == "POST" || s.Method == "PUT" || s.Method == "PATCH" {
+		s.Body = r.Intn(4) != 0
+	}
+	if s.Body {
+		s.Headers["Content-Type"] = []string{genContentTypes[r.Intn(len(genContentTypes))]}
+	}
+	return s
+}
+
+func randomToken(r *rand.Rand) string {
+	const alphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-._~"
+	b := make([]byte, 1+r.Intn(24))
+	for i := range b {
+		b[i] = alphabet[r.Intn(len(alphabet))]
+	}
+	return string(b)
+}
+
+// Check verifies the invariants for headers built from preset over protocol.
+// All violations are returned, joined.
+func Check(preset *fingerprint.Preset, protocol string, h http.Header) error {
+	var errs []error
+	errs = append(errs, checkOrder(preset, h)...)
+	errs = append(errs, checkForbidden(protocol, h)...)
+	errs = append(errs, checkClientHints(h)...)
+	return errors.Join(errs...)
+}
+
+// checkOrder verifies every preset header that is present is listed in the
+// wire order, in the preset's relative order.
+func checkOrder(preset *fingerprint.Preset, h http.Header) []error {
+	if len(preset.HeaderOrder) == 0 {
+		return nil
+	}
+	position := make(map[string]int)
+	for i, key := range h[http.HeaderOrderKey] {
+		if _, dup := position[strings.ToLower(key)]; !dup {
+			position[strings.ToLower(key)] = i
+		}
+	}
+
+	var errs []error
+	last, lastKey := -1, ""
+	for _, hp := range preset.HeaderOrder {
+		key := strings.ToLower(hp.Key)
+		if len(h.Values(key)) == 0 {
+			continue
+		}
+		pos, ok := position[key]
+		if !ok {
+			errs = append(errs, &Violation{Rule: "order", Header: key, Detail: "sent but missing from header order"})
+			continue
+		}
+		if pos < last {
+			errs = append(errs, &Violation{Rule: "order", Header: key, Detail: "sent before " + lastKey + ", preset sends it after"})
+			continue
+		}
+		last, lastKey = pos, key
+	}
+	return errs
+}
+
+var (
+	tokenRe = regexp.MustCompile("^[!#$%&'*+\\-.^_`|~0-9A-Za-z]+$")
+
+	// RFC 9113 8.2.2 / RFC 9114 4.2 - connection-specific fields
+	connectionSpecific = []string{"connection", "proxy-connection", "keep-alive", "transfer-encoding", "upgrade"}
+)
+
+// checkForbidden verifies no header is malformed or illegal for protocol.
+func checkForbidden(protocol string, h http.Header) []error {
+	var errs []error
+	for key, values := range h {
+		if key == http.HeaderOrderKey || key == http.PHeaderOrderKey {
+			continue
+		}
+		if !tokenRe.MatchString(key) {
+			errs = append(errs, &Violation{Rule: "forbidden", Header: key, Detail: "invalid header name"})
+		}
+		for _, v := range values {
+			if strings.ContainsAny(v, "\r\n\x00") {
+				errs = append(errs, &Violation{Rule: "forbidden", Header: key, Detail: "control character in value"})
+			}
+		}
+	}
+
+	if ua := h.Get("User-Agent"); strings.HasPrefix(ua, "Go-http-client") {
+		errs = append(errs, &Violation{Rule: "forbidden", Header: "user-agent", Detail: "Go default user agent"})
+	}
+
+	switch protocol {
+	case "h2", "h3":
+		for _, key := range connectionSpecific {
+			if len(h.Values(key)) > 0 {
+				errs = append(errs, &Violation{Rule: "forbidden", Header: key, Detail: "connection-specific header over " + protocol})
+			}
+		}
+		if te := h.Values("Te"); len(te) > 0 && (len(te) > 1 || !strings.EqualFold(te[0], "trailers")) {
+			errs = append(errs, &Violation{Rule: "forbidden", Header: "te", Detail: "only \"trailers\" is allowed over " + protocol})
+		}
+	case "h1":
+		// Chrome only sends Priority on HTTP/2 and HTTP/3
+		if isChromium(h.Get("User-Agent")) && len(h.Values("Priority")) > 0 {
+			errs = append(errs, &Violation{Rule: "forbidden", Header: "priority", Detail: "Chrome does not send Priority over HTTP/1.1"})
+		}
+	}
+	return errs
+}
+
+var (
+	uaChromeVersionRe = regexp.MustCompile(`Chrome/(\d+)`)
+	chBrandVersionRe  = regexp.MustCompile(`"Chromium";v="(\d+)"`)
+)
+
+// isChromium reports whether ua is a Blink browser (iOS Chrome is WebKit)
+func isChromium(ua string) bool {
+	return strings.Contains(ua, "Chrome/") && !strings.Contains(ua, "CriOS/")
+}
+
+// checkClientHints verifies sec-ch-ua* agree with User-Agent.
+func checkClientHints(h http.Header) []error {
+	ua := h.Get("User-Agent")
+	brands := h.Get("Sec-Ch-Ua")
+	mobile := h.Get("Sec-Ch-Ua-Mobile")
+	platform := h.Get("Sec-Ch-Ua-Platform")
+
+	if !isChromium(ua) {
+		if brands != "" || mobile != "" || platform != "" {
+			return []error{&Violation{Rule: "client-hints", Header: "sec-ch-ua", Detail: "sent with a non-Chromium User-Agent"}}
+		}
+		return nil
+	}
+	if brands == "" {
+		// Chromium always sends the low-entropy hints on secure requests
+		return nil
+	}
+
+	var errs []error
+	if m := chBrandVersionRe.FindStringSubmatch(brands); m != nil {
+		if uaMatch := uaChromeVersionRe.FindStringSubmatch(ua); uaMatch != nil && uaMatch[1] != m[1] {
+			errs = append(errs, &Violation{Rule: "client-hints", Header: "sec-ch-ua", Detail: fmt.Sprintf("Chromium %s, User-Agent says Chrome %s", m[1], uaMatch[1])})
+		}
+	}
+
+	wantMobile := "?0"
+	if strings.Contains(ua, " Mobile") {
+		wantMobile = "?1"
+	}
+	if mobile != "" && mobile != wantMobile {
+		errs = append(errs, &Violation{Rule: "client-hints", Header: "sec-ch-ua-mobile", Detail: mobile + " disagrees with User-Agent"})
+	}
+
+	if platform != "" {
+		if want := uaPlatform(ua); want != "" && platform != `"`+want+`"` {
+			errs = append(errs, &Violation{Rule: "client-hints", Header: "sec-ch-ua-platform", Detail: fmt.Sprintf("%s, User-Agent says %q", platform, want)})
+		}
+	}
+	return errs
+}
+
+// uaPlatform returns the sec-ch-ua-platform value matching ua, or "" if unknown
+func uaPlatform(ua string) string {
+	switch {
+	case strings.Contains(ua, "Android"):
+		return "Android"
+	case strings.Contains(ua, "Windows"):
+		return "Windows"
+	case strings.Contains(ua, "Macintosh"):
+		return "macOS"
+	case strings.Contains(ua, "CrOS"):
+		return "Chrome OS"
+	case strings.Contains(ua, "Linux"):
+		return "Linux"
+	}
+	return ""
+}
@@ -0,0 +1,80 @@
+package fptest
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+
+	"github.com/sardanioss/httpcloak/fingerprint"
+)
+
+func TestPresetsHoldInvariants(t *testing.T) {
+	for _, name := range fingerprint.Available() {
+		t.Run(name, func(t *testing.T) {
+			Run(t, fingerprint.Get(name), Options{N: 100, Seed: 1})
+		})
+	}
+}
+
+func TestCheckReportsViolations(t *testing.T) {
+	preset := fingerprint.Get("chrome-144-windows")
+
+	tests := []struct {
+		name   string
+		rule   string
+		mutate func(s *Shape)
+	}{
+		{"user agent without matching hints", "client-hints", func(s *Shape) {
+			s.Headers["User-Agent"] = []string{"Mozilla/5.0 (X11; Linux x86_64; rv:133.0) Gecko/20100101 Firefox/133.0"}
+		}},
+		{"platform hint mismatch", "client-hints", func(s *Shape) {
+			s.Headers["Sec-Ch-Ua-Platform"] = []string{`"Linux"`}
+		}},
+		{"connection header over h2", "forbidden", func(s *Shape) {
+			s.Headers["Connection"] = []string{"keep-alive"}
+		}},
+		{"reversed header order", "order", func(s *Shape) {
+			for i := len(preset.HeaderOrder) - 1; i >= 0; i-- {
+				s.HeaderOrder = append(s.HeaderOrder, preset.HeaderOrder[i].Key)
+			}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := Generate(rand.New(rand.NewSource(1)), []string{"h2"})
+			tt.mutate(&s)
+			err := Check(preset, s.Protocol, BuildHeaders(preset, s))
+			if !hasRule(err, tt.rule) {
+				t.Fatalf("expected a %q violation, got %v", tt.rule, err)
+			}
+		})
+	}
+}
+
+func TestCheckChromePriorityOverH1(t *testing.T) {
+	preset := fingerprint.Get("android-chrome-144")
+	h := BuildHeaders(preset, Shape{Protocol: "h1"})
+	if err := Check(preset, "h1", h); err != nil {
+		t.Fatalf("preset headers over h1: %v", err)
+	}
+
+	h.Set("Priority", "u=0, i")
+	if err := Check(preset, "h1", h); !hasRule(err, "forbidden") {
+		t.Fatalf("expected Priority over h1 to be reported, got %v", err)
+	}
+}
+
+func hasRule(err error, rule string) bool {
+	var joined interface{ Unwrap() []error }
+	if !errors.As(err, &joined) {
+		return false
+	}
+	for _, e := range joined.Unwrap() {
+		var v *Violation
+		if errors.As(e, &v) && v.Rule == rule {
+			return true
+		}
+	}
+	return false
+}
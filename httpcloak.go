@@ -25,7 +25,9 @@ package httpcloak
 import (
 	"bytes"
 	"context"
+	"crypto"
 	"crypto/x509"
+	"database/sql"
 	"encoding/json"
 	"io"
 	"strings"
@@ -36,6 +38,8 @@ import (
 	"github.com/sardanioss/httpcloak/protocol"
 	"github.com/sardanioss/httpcloak/session"
 	"github.com/sardanioss/httpcloak/transport"
+	"github.com/sardanioss/httpcloak/version"
+	utls "github.com/sardanioss/utls"
 )
 
 // systemRoots is pre-loaded at init time to avoid ~40ms delay on first TLS connection
@@ -48,6 +52,23 @@ func init() {
 	systemRoots, _ = x509.SystemCertPool()
 }
 
+// Preload does the one-time work a process's first request would otherwise
+// pay for: root CAs, each preset's ClientHellos and key shares, the
+// resolver configuration and a UDP socket for HTTP/3 (see
+// transport.Preload). Call it during init in Lambda or Cloud Run so cold
+// starts don't add it to the first invocation. presets defaults to
+// chrome-latest.
+func Preload(presets ...string) error {
+	if len(presets) == 0 {
+		presets = []string{"chrome-latest"}
+	}
+	resolved := make([]*fingerprint.Preset, len(presets))
+	for i, name := range presets {
+		resolved[i] = fingerprint.Get(name)
+	}
+	return transport.Preload(resolved...)
+}
+
 // Client is an HTTP client with browser fingerprint spoofing
 type Client struct {
 	inner   *client.Client
@@ -116,16 +137,96 @@ func New(preset string, opts ...Option) *Client {
 type Request struct {
 	Method  string
 	URL     string
+	Host    string              // Overrides the Host header (:authority on HTTP/2 and HTTP/3); the connection still goes to URL's host
 	Headers map[string][]string // Multi-value headers (matches http.Header)
 	Body    io.Reader           // Streaming body for uploads
 	Timeout time.Duration
 
+	// BodySource is a replayable body (transport.BytesBody, FileBody or
+	// FuncBody), used instead of Body. Needed for retries and 307/308
+	// redirects of streamed uploads; Body can only be sent once.
+	BodySource transport.RewindableBody
+
 	// TLSOnly is a per-request override for TLS-only mode.
 	// When set to true, preset HTTP headers are NOT applied - only TLS fingerprinting is used.
 	// When nil, the session's TLSOnly setting is used.
 	// This is useful for LocalProxy where each request can have different TLS-only settings
 	// via the X-HTTPCloak-TlsOnly header.
 	TLSOnly *bool
+
+	// Redirect overrides the session's redirect settings for this request
+	Redirect *RedirectPolicy
+
+	// Priority overrides the RFC 9218 priority the preset's browser would
+	// give the request (nil = the browser's): its Priority header on HTTP/2
+	// and HTTP/3, and its stream weight on HTTP/2. Session only; Client
+	// requests get the browser's.
+	Priority *Priority
+
+	// Meta is caller metadata such as a job ID, never sent on the wire. It
+	// reaches redirect hooks (RedirectHop.Meta), anything given the
+	// request's context (RequestMeta) and comes back on the Response.
+	Meta map[string]any
+
+	// Stream leaves the body on the connection for Response.Body,
+	// BodyReader or SaveTo to read as it arrives, instead of buffering it.
+	// Client only; sessions buffer bodies (see Session.DoStream).
+	Stream bool
+
+	// MaxBodySize fails the request, or reads of a streamed body, once the
+	// body is over this many bytes (0 = no limit). Client only.
+	MaxBodySize int64
+}
+
+// Redirect policy types; see WithRedirectMethods and WithOnRedirect
+type (
+	RedirectPolicy  = transport.RedirectPolicy
+	RedirectMethods = transport.RedirectMethods
+	RedirectHop     = transport.RedirectHop
+	RedirectFunc    = transport.RedirectFunc
+)
+
+const (
+	RedirectMethodsBrowser  = transport.RedirectMethodsBrowser
+	RedirectMethodsPreserve = transport.RedirectMethodsPreserve
+	RedirectMethodsGET      = transport.RedirectMethodsGET
+)
+
+// ErrUseLastResponse, returned by a RedirectFunc, makes the request return
+// the redirect response instead of following it
+var ErrUseLastResponse = transport.ErrUseLastResponse
+
+// ClientTrace hooks into each stage of a request's connection: DNS, dial,
+// TLS handshake, connection reuse, first response byte and HTTP/3 0-RTT.
+// Attach it with WithClientTrace.
+type ClientTrace = transport.ClientTrace
+
+// TLSHandshakeInfo describes a completed TLS handshake for a ClientTrace
+type TLSHandshakeInfo = transport.TLSHandshakeInfo
+
+// WithClientTrace returns a context whose requests report to trace
+//
+//	ctx := httpcloak.WithClientTrace(ctx, &httpcloak.ClientTrace{
+//		DNSDone: func(addrs []net.IP, err error) { log.Println("dns", addrs, err) },
+//		ConnectionReused: func(proto, addr string) { log.Println("reused", proto, addr) },
+//	})
+//	resp, err := session.Get(ctx, url)
+func WithClientTrace(ctx context.Context, trace *ClientTrace) context.Context {
+	return transport.WithClientTrace(ctx, trace)
+}
+
+// WithIdentity returns a context whose requests derive their per-request
+// randomness, such as retry jitter and request gaps, from key (an account
+// ID, say) instead of drawing it fresh. See WithIdentityKey for a whole
+// session.
+func WithIdentity(ctx context.Context, key string) context.Context {
+	return fingerprint.WithIdentity(ctx, key)
+}
+
+// RequestMeta returns the Meta of the request a context belongs to, for
+// hooks such as a challenge solver that are handed the request's context
+func RequestMeta(ctx context.Context) map[string]any {
+	return transport.ContextRequestMeta(ctx)
 }
 
 // RedirectInfo contains information about a redirect response
@@ -133,8 +234,193 @@ type RedirectInfo struct {
 	StatusCode int
 	URL        string
 	Headers    map[string][]string // Multi-value headers
+	Method     string              // Method of the request that got the redirect
+	Cookie     string              // Cookie header sent with that request
+}
+
+// RedirectLoopError is returned when redirects lead back to a URL already
+// requested with the same cookies. Its History and CookieDeltas show each hop
+// and the cookies the server set or cleared along the way.
+type RedirectLoopError = transport.RedirectLoopError
+
+// CookieData is a cookie with its full Set-Cookie metadata
+type CookieData = session.CookieData
+
+// BeaconOptions sets the content type and sending page of a beacon
+type BeaconOptions = session.BeaconOptions
+
+// PollOptions and PollEvent are the options and results of Session.Poll
+type (
+	PollOptions = session.PollOptions
+	PollEvent   = session.PollEvent
+)
+
+// ErrBeaconQuota is returned by SendBeacon when the beacons in flight
+// would exceed the 64 KiB keepalive quota
+var ErrBeaconQuota = session.ErrBeaconQuota
+
+// Page rendering from the session cache; see Session.Render
+type (
+	Page           = session.Page
+	PageResource   = session.PageResource
+	Renderer       = session.Renderer
+	RendererFunc   = session.RendererFunc
+	RenderFormat   = session.RenderFormat
+	ChromeRenderer = session.ChromeRenderer
+)
+
+const (
+	RenderPNG = session.RenderPNG
+	RenderPDF = session.RenderPDF
+)
+
+// ErrPageNotCached is returned by Render for a page whose HTML isn't cached
+var ErrPageNotCached = session.ErrPageNotCached
+
+// Store keeps serialized sessions by ID (see Session.SaveTo and LoadFrom).
+// FileStore, SQLiteStore and RedisStore are the built-in backends.
+type (
+	Store           = session.Store
+	FileStore       = session.FileStore
+	SQLiteStore     = session.SQLiteStore
+	RedisStore      = session.RedisStore
+	RedisOptions    = session.RedisOptions
+	AutoSaveOptions = session.AutoSaveOptions
+)
+
+// ErrStateNotFound is returned by LoadFrom for an ID the store doesn't hold
+var ErrStateNotFound = session.ErrStateNotFound
+
+// NewFileStore returns a Store keeping one file per session in dir
+func NewFileStore(dir string) (*FileStore, error) {
+	return session.NewFileStore(dir)
+}
+
+// NewSQLiteStore returns a Store over a table of a SQLite database opened
+// with any driver, creating the table if needed ("" names it
+// "httpcloak_sessions")
+func NewSQLiteStore(ctx context.Context, db *sql.DB, table string) (*SQLiteStore, error) {
+	return session.NewSQLiteStore(ctx, db, table)
+}
+
+// NewRedisStore returns a Store keeping sessions in Redis
+func NewRedisStore(opts RedisOptions) *RedisStore {
+	return session.NewRedisStore(opts)
+}
+
+// CloneOptions tunes Session.CloneWithOptions
+type CloneOptions = session.CloneOptions
+
+// DuplicateHeaders is how GetHeader reads a header sent more than once (see
+// WithDuplicateHeaders)
+type DuplicateHeaders = transport.DuplicateHeaders
+
+const (
+	DuplicateHeadersFirst = transport.DuplicateHeadersFirst
+	DuplicateHeadersMerge = transport.DuplicateHeadersMerge
+	DuplicateHeadersLast  = transport.DuplicateHeadersLast
+)
+
+// ProtocolDecision is the protocol auto mode uses for an origin, and why
+// (see Session.ProtocolDecision)
+type ProtocolDecision = transport.ProtocolDecision
+
+// ClientCertificate is a certificate for mutual TLS (see
+// WithClientCertificate). Its key is used only as a crypto.Signer, so it
+// may be held by an HSM.
+type ClientCertificate = transport.ClientCertificate
+
+// CertificatePolicy changes certificate verification for some hosts (see
+// WithCertificatePolicy)
+type CertificatePolicy = transport.CertificatePolicy
+
+// ConnInfo describes a new TLS connection and exports keying material from
+// it (see WithConnectionCallback)
+type ConnInfo = transport.ConnInfo
+
+// Priority is a request's RFC 9218 urgency and incremental flag (see
+// Request.Priority)
+type Priority = fingerprint.Priority
+
+// CookieTrace lists the cookie jar's decisions for a request (see
+// WithCookieTrace)
+type CookieTrace = transport.CookieTrace
+
+// CookieDecision is the jar's decision on one cookie: sent, or left out and
+// why
+type CookieDecision = transport.CookieDecision
+
+// ErrPinMismatch is returned when a server's chain has none of the pinned
+// keys
+var ErrPinMismatch = transport.ErrPinMismatch
+
+// SPKIPin returns the "sha256/<base64>" pin of a certificate's public key
+func SPKIPin(cert *x509.Certificate) string {
+	return transport.SPKIPin(cert)
+}
+
+// Authenticator runs one connection-bound handshake (see WithProxyAuth and
+// WithServerAuth). NTLM is built in; Kerberos under Negotiate needs an
+// Authenticator backed by a GSSAPI or SSPI library.
+type Authenticator = transport.Authenticator
+
+// AuthenticatorFunc starts a handshake with a proxy or origin host
+type AuthenticatorFunc = transport.AuthenticatorFunc
+
+// Token is an OAuth2 access token (see WithTokenSource)
+type Token = session.Token
+
+// TokenSource issues the access tokens WithTokenSource sends
+type TokenSource = session.TokenSource
+
+// TokenSourceFunc adapts a function to TokenSource
+type TokenSourceFunc = session.TokenSourceFunc
+
+// NTLMCredentials are the domain, user name and password of an NTLM
+// account
+type NTLMCredentials = transport.NTLMCredentials
+
+// NTLM authenticates with NTLMv2 under the "NTLM" scheme
+func NTLM(creds NTLMCredentials) AuthenticatorFunc {
+	return transport.NTLM(creds)
+}
+
+// NegotiateNTLM authenticates with NTLMv2 wrapped in SPNEGO under the
+// "Negotiate" scheme, as Windows clients do without Kerberos. It does not
+// do Kerberos.
+func NegotiateNTLM(creds NTLMCredentials) AuthenticatorFunc {
+	return transport.NegotiateNTLM(creds)
+}
+
+// LoadClientCertificate reads a PEM certificate chain and private key
+// (keyFile "" if certFile holds both)
+func LoadClientCertificate(certFile, keyFile string) (*ClientCertificate, error) {
+	return transport.LoadClientCertificate(certFile, keyFile)
 }
 
+// ParseClientCertificatePKCS12 parses a PKCS#12 (.p12, .pfx) bundle
+func ParseClientCertificatePKCS12(data []byte, password string) (*ClientCertificate, error) {
+	return transport.ParseClientCertificatePKCS12(data, password)
+}
+
+// NewClientCertificate pairs a signer, such as an HSM key, with its
+// certificate chain, leaf first
+func NewClientCertificate(key crypto.Signer, chain ...*x509.Certificate) (*ClientCertificate, error) {
+	return transport.NewClientCertificate(key, chain...)
+}
+
+// MergePolicy and MergeStrategy control Session.MergeCookies
+type (
+	MergePolicy   = session.MergePolicy
+	MergeStrategy = session.MergeStrategy
+)
+
+const (
+	MergeNewest = session.MergeNewest
+	MergeTheirs = session.MergeTheirs
+	MergeOurs   = session.MergeOurs
+)
+
 // Response represents an HTTP response
 type Response struct {
 	StatusCode int
@@ -143,10 +429,31 @@ type Response struct {
 	FinalURL   string
 	Protocol   string
 	History    []*RedirectInfo
+	Hedged     bool // Served by the duplicate leg of a hedged request (see WithHedging)
+
+	// Revalidated is set when the server answered 304 and the body and
+	// headers are the session's cached copy (see WithoutConditionalRequests)
+	Revalidated bool
+
+	// SetCookies lists the cookies this response set, in header order,
+	// including ones the session's jar refused (see CookieData.Rejected).
+	// Only Session responses fill it in.
+	SetCookies []*CookieData
+
+	// CookieTrace lists the cookies the session's jar held for the final
+	// request's host, which it sent and why it left the rest out. Set while
+	// cookie tracing is on (see WithCookieTrace).
+	CookieTrace *CookieTrace
+
+	// Meta is the Request's Meta, handed back unchanged
+	Meta map[string]any
+
+	headerPolicy transport.DuplicateHeaders // How GetHeader reads repeated headers
 
 	// bodyBytes caches the body after reading
-	bodyBytes []byte
-	bodyRead  bool
+	bodyBytes    []byte
+	bodyRead     bool
+	bodyConsumed bool // Body was handed to a JSONStream decoder
 }
 
 // Close closes the response body.
@@ -163,6 +470,9 @@ func (r *Response) Bytes() ([]byte, error) {
 	if r.bodyRead {
 		return r.bodyBytes, nil
 	}
+	if r.bodyConsumed {
+		return nil, ErrBodyConsumed
+	}
 	if r.Body == nil {
 		return nil, nil
 	}
@@ -186,21 +496,144 @@ func (r *Response) Text() (string, error) {
 	return string(data), nil
 }
 
-// JSON decodes the response body into the given interface.
-func (r *Response) JSON(v interface{}) error {
+// ErrBodyConsumed is returned by Bytes/Text after JSONStream took the body.
+var ErrBodyConsumed = client.ErrBodyConsumed
+
+// JSONOption configures JSON decoding of a response body
+type JSONOption = client.JSONOption
+
+// JSONUseNumber decodes numbers into json.Number instead of float64,
+// preserving large integers and exact decimals.
+func JSONUseNumber() JSONOption { return client.JSONUseNumber() }
+
+// JSONDisallowUnknownFields makes decoding into a struct fail on unknown keys.
+func JSONDisallowUnknownFields() JSONOption { return client.JSONDisallowUnknownFields() }
+
+// JSON decodes the response body into the given interface. The body stays
+// cached for Bytes and Text; use JSONStream to decode without holding it.
+func (r *Response) JSON(v interface{}, opts ...JSONOption) error {
 	data, err := r.Bytes()
 	if err != nil {
 		return err
 	}
-	return json.Unmarshal(data, v)
+	return client.DecodeJSON(bytes.NewReader(data), v, opts...)
 }
 
-// GetHeader returns the first value for the given header key.
-func (r *Response) GetHeader(key string) string {
-	if values := r.Headers[strings.ToLower(key)]; len(values) > 0 {
-		return values[0]
+// JSONStream returns a json.Decoder over the body for decoding large arrays
+// or concatenated values incrementally, without buffering the raw body.
+// Close the response when done.
+func (r *Response) JSONStream(opts ...JSONOption) *json.Decoder {
+	if r.bodyRead || r.Body == nil {
+		return client.NewJSONDecoder(bytes.NewReader(r.bodyBytes), opts...)
+	}
+	r.bodyConsumed = true
+	return client.NewJSONDecoder(r.Body, opts...)
+}
+
+// Tee writes the body to w as it is read, by Bytes, JSON, JSONStream or
+// reads of Body, so it can go to disk or a hash while it is parsed. A body
+// already read is written to w at once.
+func (r *Response) Tee(w io.Writer) error {
+	if r.bodyRead {
+		_, err := w.Write(r.bodyBytes)
+		return err
+	}
+	if r.bodyConsumed {
+		return ErrBodyConsumed
+	}
+	if r.Body != nil {
+		r.Body = transport.TeeBody(r.Body, w)
+	}
+	return nil
+}
+
+// Split hands the body to n readers that each see all of it, without
+// buffering it; read them concurrently, one goroutine each. Bytes and Text
+// return ErrBodyConsumed afterwards. A body already read is shared.
+func (r *Response) Split(n int) []io.ReadCloser {
+	if r.bodyRead || r.Body == nil {
+		readers := make([]io.ReadCloser, n)
+		for i := range readers {
+			readers[i] = io.NopCloser(bytes.NewReader(r.bodyBytes))
+		}
+		return readers
+	}
+	if r.bodyConsumed {
+		return nil
+	}
+	r.bodyConsumed = true
+	return transport.SplitBody(r.Body, n)
+}
+
+// BodyReader returns the body as a reader: the connection itself for a
+// streamed response (see Request.Stream), the buffered copy otherwise.
+// Close the response when done.
+func (r *Response) BodyReader() io.ReadCloser {
+	if r.bodyRead || r.Body == nil {
+		return io.NopCloser(bytes.NewReader(r.bodyBytes))
+	}
+	return r.Body
+}
+
+// SaveTo copies the body to w and closes it, returning the bytes written.
+// With Request.Stream the body goes straight from the connection to w, so
+// downloads of any size use a fixed amount of memory.
+func (r *Response) SaveTo(w io.Writer) (int64, error) {
+	if r.bodyRead {
+		n, err := w.Write(r.bodyBytes)
+		return int64(n), err
+	}
+	if r.bodyConsumed {
+		return 0, ErrBodyConsumed
+	}
+	if r.Body == nil {
+		return 0, nil
+	}
+	defer r.Body.Close()
+	r.bodyConsumed = true
+	return io.Copy(w, r.Body)
+}
+
+// BodyTooLargeError is returned when a response body exceeds
+// Request.MaxBodySize
+type BodyTooLargeError = client.BodyTooLargeError
+
+// XML decodes the response body as XML into v, converting legacy encodings
+// (declared by BOM, Content-Type charset or the XML declaration) to UTF-8.
+func (r *Response) XML(v interface{}) error {
+	data, err := r.Bytes()
+	if err != nil {
+		return err
+	}
+	return client.DecodeXML(data, r.GetHeader("Content-Type"), v)
+}
+
+// DecodedText returns the body converted to UTF-8 using its BOM,
+// Content-Type charset or HTML <meta> charset. Text returns the raw bytes.
+func (r *Response) DecodedText() (string, error) {
+	data, err := r.Bytes()
+	if err != nil {
+		return "", err
+	}
+	utf8Body, err := client.DecodeCharset(data, r.GetHeader("Content-Type"))
+	if err != nil {
+		return "", err
 	}
-	return ""
+	return string(utf8Body), nil
+}
+
+// GetHeader returns the value for the given header key: the first, or as
+// the session's WithDuplicateHeaders policy says. Set-Cookie is never
+// joined; read every line with GetHeaders.
+func (r *Response) GetHeader(key string) string {
+	return r.headerPolicy.HeaderValue(key, r.Headers[strings.ToLower(key)])
+}
+
+// MergedHeaders returns the headers with one value each, repeated lines
+// joined with ", ". Set-Cookie and the authentication challenges, which
+// can't be joined, are left out.
+func (r *Response) MergedHeaders() map[string]string {
+	return transport.MergeHeaders(r.Headers)
 }
 
 // GetHeaders returns all values for the given header key.
@@ -216,11 +649,27 @@ func (c *Client) Do(ctx context.Context, req *Request) (*Response, error) {
 	}
 
 	cReq := &client.Request{
-		Method:  req.Method,
-		URL:     req.URL,
-		Headers: req.Headers,
-		Body:    req.Body,
-		Timeout: timeout,
+		Method:      req.Method,
+		URL:         req.URL,
+		Headers:     req.Headers,
+		Body:        req.Body,
+		Timeout:     timeout,
+		Stream:      req.Stream,
+		MaxBodySize: req.MaxBodySize,
+		Meta:        req.Meta,
+	}
+	if req.Body == nil && req.BodySource != nil {
+		body, err := req.BodySource.Open()
+		if err != nil {
+			return nil, err
+		}
+		cReq.Body, cReq.GetBody = body, req.BodySource.Open
+	}
+	if req.Redirect != nil {
+		cReq.FollowRedirects = req.Redirect.Follow
+		cReq.MaxRedirects = req.Redirect.MaxRedirects
+		cReq.RedirectMethods = req.Redirect.Methods
+		cReq.OnRedirect = req.Redirect.OnRedirect
 	}
 
 	resp, err := c.inner.Do(ctx, cReq)
@@ -234,15 +683,13 @@ func (c *Client) Do(ctx context.Context, req *Request) (*Response, error) {
 		Body:       resp.Body,
 		FinalURL:   resp.FinalURL,
 		Protocol:   resp.Protocol,
+		Meta:       req.Meta,
 	}, nil
 }
 
-// Get performs a GET request
-func (c *Client) Get(ctx context.Context, url string) (*Response, error) {
-	return c.Do(ctx, &Request{
-		Method: "GET",
-		URL:    url,
-	})
+// Get performs a GET request, set up by opts
+func (c *Client) Get(ctx context.Context, url string, opts ...RequestOption) (*Response, error) {
+	return c.Send(ctx, "GET", url, opts...)
 }
 
 // GetWithHeaders performs a GET request with custom headers
@@ -302,25 +749,74 @@ type sessionConfig struct {
 	forceHTTP3         bool
 	insecureSkipVerify bool
 	disableRedirects   bool
+	disableConditional bool
+	preconnectRedirect bool
 	maxRedirects       int
+	redirectMethods    RedirectMethods
+	onRedirect         RedirectFunc
 	retryCount         int
 	retryWaitMin       time.Duration
 	retryWaitMax       time.Duration
 	retryOnStatus      []int
+	hedgeDelay         time.Duration
+	hedgeAllMethods    bool
+	behaviorSeed       int64         // Seeds the session's timing profile (0 = random)
+	identityKey        string        // Derives the session's random choices (see WithIdentityKey)
+	requestGap         time.Duration // Typical pause between requests
 	preferIPv4         bool
 	connectTo          map[string]string // Domain fronting: request_host -> connect_host
 	echConfigDomain    string            // Domain to fetch ECH config from
 	tlsOnly            bool              // TLS-only mode: skip preset headers, set all manually
 	quicIdleTimeout    time.Duration     // QUIC idle timeout (default: 30s)
+	pool               PoolConfig        // Connection pool tuning
 	localAddr          string            // Local IP address to bind outgoing connections
 	keyLogFile         string            // Path to write TLS key log for Wireshark decryption
 	disableECH            bool   // Disable ECH lookup for faster first request
+	strictMode            bool   // No impersonation (see Session.SetStrictMode)
+	cookieTrace           bool   // Record cookie decisions (see WithCookieTrace)
+	dnsServers            []string // Nameservers queried directly for TTL-aware caching
+	persistDNS            bool     // Save resolved addresses with the session state
+	stampBuild            bool     // Record the build in the session state
+	headerRules           []HeaderRule // Headers removed per host
+	allowedHosts          []string     // Only hosts requests may go to
+	blockedHosts          []string     // Hosts requests never go to
+	protocolPolicy        map[string]Protocol // Protocols forced per host pattern
+	h3FailureBackoff      time.Duration       // How long HTTP/3 is skipped after failing (0 = default)
+	credentialHeaders     []string     // More headers dropped on cross-origin redirects
+	keepCredentials       bool         // Send credentials across origins on redirect
+	rawBody               bool   // Don't decode Content-Encoding
+	drainLimit            int64  // Unread body bytes drained on close (0 = default, <0 = never)
 	disableSpeculativeTLS bool   // Disable speculative TLS optimization for proxy connections
+	disableLatencyPinning bool   // Keep racing HTTP/3 even where it is slower
+	ssrfProtection        bool   // Refuse hosts resolving to internal addresses
 	switchProtocol        string // Protocol to switch to after Refresh() (e.g. "h1", "h2", "h3")
 
 	// Distributed session cache
 	sessionCacheBackend       transport.SessionCacheBackend
 	sessionCacheErrorCallback transport.ErrorCallback
+
+	ticketIsolation string // TLS ticket reuse across proxies ("egress" default, "shared")
+
+	duplicateHeaders string // How GetHeader reads repeated headers ("first" default, "merge", "last")
+
+	// Advanced escape hatches (unvalidated fingerprints)
+	clientHelloSpecHook func(spec *utls.ClientHelloSpec)
+	quicConfigHook      func(host string, cfg *transport.QUICConfig)
+
+	geo       *session.GeoOptions       // Accept-Language vs. egress country
+	challenge *session.ChallengeOptions // Captcha solving
+
+	clientCertificates  []*ClientCertificate // Mutual TLS
+	certificatePolicies []*CertificatePolicy // Pinning, custom roots and verification
+
+	connectionCallbacks []*transport.ConnectionCallback // Keying material per connection
+
+	proxyAuth  AuthenticatorFunc // NTLM/Negotiate to the proxy
+	serverAuth AuthenticatorFunc // NTLM/Negotiate to origins
+
+	tokens *session.TokenOptions // OAuth2 access tokens
+
+	autoWarmup *session.AutoWarmupOptions // Warmup before each origin's first request
 }
 
 // WithSessionProxy sets a proxy for the session
@@ -388,6 +884,42 @@ func WithoutRedirects() SessionOption {
 	}
 }
 
+// WithoutConditionalRequests stops the session revalidating URLs it has
+// fetched before. By default a GET to such a URL carries If-None-Match and
+// If-Modified-Since like a browser's, and a 304 reply comes back as the
+// cached 200 with Response.Revalidated set.
+func WithoutConditionalRequests() SessionOption {
+	return func(c *sessionConfig) {
+		c.disableConditional = true
+	}
+}
+
+// WithRedirectPreconnect makes the session start DNS and the TCP and TLS
+// handshakes to a redirect's target origin as soon as the redirect arrives,
+// as Chrome does, instead of after processing it. This shortens multi-hop
+// chains such as SSO logins.
+func WithRedirectPreconnect() SessionOption {
+	return func(c *sessionConfig) {
+		c.preconnectRedirect = true
+	}
+}
+
+// WithRedirectMethods sets how redirects change the request method and body.
+// The default, RedirectMethodsBrowser, matches browsers.
+func WithRedirectMethods(methods RedirectMethods) SessionOption {
+	return func(c *sessionConfig) {
+		c.redirectMethods = methods
+	}
+}
+
+// WithOnRedirect registers a callback that approves or rewrites each redirect
+// before it is followed. Return ErrUseLastResponse to stop at the redirect.
+func WithOnRedirect(fn RedirectFunc) SessionOption {
+	return func(c *sessionConfig) {
+		c.onRedirect = fn
+	}
+}
+
 // WithRedirects configures redirect behavior
 func WithRedirects(follow bool, maxRedirects int) SessionOption {
 	return func(c *sessionConfig) {
@@ -420,6 +952,56 @@ func WithRetryConfig(count int, waitMin, waitMax time.Duration, retryOnStatus []
 	}
 }
 
+// WithHedging enables hedged requests: if no response has arrived after delay,
+// a duplicate is sent on another connection (HTTP/3 vs HTTP/2 where possible)
+// and the first successful response is used. The slower leg is cancelled.
+//
+// Only idempotent methods are hedged; see WithHedgingAllMethods.
+func WithHedging(delay time.Duration) SessionOption {
+	return func(c *sessionConfig) {
+		c.hedgeDelay = delay
+	}
+}
+
+// WithHedgingAllMethods extends hedging to non-idempotent methods such as POST.
+// The server may process both copies - only use this for endpoints that
+// deduplicate (e.g. via an idempotency key header).
+func WithHedgingAllMethods() SessionOption {
+	return func(c *sessionConfig) {
+		c.hedgeAllMethods = true
+	}
+}
+
+// WithBehaviorSeed fixes the seed of the session's timing profile: how
+// brisk it is and how its request gaps, warmup pauses and retry waits vary.
+// Sessions given the same seed behave alike; by default each session gets
+// a random one, kept when the session is saved.
+func WithBehaviorSeed(seed int64) SessionOption {
+	return func(c *sessionConfig) {
+		c.behaviorSeed = seed
+	}
+}
+
+// WithIdentityKey ties the session to a logical identity such as an account
+// ID. The choices a browser makes at random once per session (TLS and QUIC
+// extension order, the HTTP/3 GREASE setting, the timing profile unless
+// WithBehaviorSeed is given) are derived from key, so every session for the
+// same identity, in any process, presents the same way.
+func WithIdentityKey(key string) SessionOption {
+	return func(c *sessionConfig) {
+		c.identityKey = key
+	}
+}
+
+// WithRequestGap spaces the session's requests about gap apart, scaled and
+// varied by its timing profile (see WithBehaviorSeed). Subresources fetched
+// by Warmup and redirects are not delayed.
+func WithRequestGap(gap time.Duration) SessionOption {
+	return func(c *sessionConfig) {
+		c.requestGap = gap
+	}
+}
+
 // WithSessionPreferIPv4 makes the session prefer IPv4 addresses over IPv6.
 // Use this on networks with poor IPv6 connectivity.
 func WithSessionPreferIPv4() SessionOption {
@@ -455,6 +1037,173 @@ func WithDisableECH() SessionOption {
 	}
 }
 
+// WithStrictMode starts the session with impersonation off (see
+// Session.SetStrictMode)
+func WithStrictMode() SessionOption {
+	return func(c *sessionConfig) {
+		c.strictMode = true
+	}
+}
+
+// WithCookieTrace records, on every response, which of the session's cookies
+// were sent and why the others for the host were left out: path, Secure,
+// host-only, expiry or the Cookie header size limit. Sent SameSite cookies a
+// browser would withhold from a request marked cross-site are noted. Turn it
+// on or off later with Session.SetCookieTrace.
+func WithCookieTrace() SessionOption {
+	return func(c *sessionConfig) {
+		c.cookieTrace = true
+	}
+}
+
+// WithDNSServers resolves hosts by querying these nameservers ("1.1.1.1" or
+// "10.0.0.53:5353") instead of the system resolver. Addresses are then
+// cached for exactly their records' TTLs rather than a fixed five minutes.
+func WithDNSServers(servers ...string) SessionOption {
+	return func(c *sessionConfig) {
+		c.dnsServers = servers
+	}
+}
+
+// WithPersistDNS saves the session's DNS cache, including hosts that failed
+// to resolve, with Save/Marshal. A restored session reuses the addresses
+// until their TTLs expire instead of resolving every host again.
+func WithPersistDNS() SessionOption {
+	return func(c *sessionConfig) {
+		c.persistDNS = true
+	}
+}
+
+// WithBuildStamp records the httpcloak build in the state Save/Marshal
+// write (see ImportReport.SourceBuild). When the build that loads the state is
+// the same, its TLS tickets are imported without re-checking them against
+// the preset.
+func WithBuildStamp() SessionOption {
+	return func(c *sessionConfig) {
+		c.stampBuild = true
+	}
+}
+
+// WithRedirectCredentialHeaders adds headers, such as a custom API key
+// header, to those dropped when a redirect leaves the origin. Authorization,
+// Cookie, X-Api-Key and X-Auth-Token always are.
+func WithRedirectCredentialHeaders(names ...string) SessionOption {
+	return func(c *sessionConfig) {
+		c.credentialHeaders = append(c.credentialHeaders, names...)
+	}
+}
+
+// WithKeepRedirectCredentials sends credentials on to every origin a
+// redirect leads to, like curl's --location-trusted. Only for redirects
+// you trust.
+func WithKeepRedirectCredentials() SessionOption {
+	return func(c *sessionConfig) {
+		c.keepCredentials = true
+	}
+}
+
+// HeaderRule removes headers from requests to the hosts it names; see
+// WithHeaderRules
+type HeaderRule = protocol.HeaderRule
+
+// WithHeaderRules strips headers from requests to matching hosts, e.g. never
+// sending Referer to a tracker:
+//
+//	httpcloak.WithHeaderRules(httpcloak.HeaderRule{Hosts: []string{"tracker.example"}, Strip: []string{"Referer"}})
+//
+// Rules run after all other headers are set. Credentials are dropped on
+// cross-origin redirects regardless; see WithRedirectCredentialHeaders.
+func WithHeaderRules(rules ...HeaderRule) SessionOption {
+	return func(c *sessionConfig) {
+		c.headerRules = append(c.headerRules, rules...)
+	}
+}
+
+// ErrHostBlocked is matched by the error of a request to a host
+// WithAllowedHosts or WithBlockedHosts excludes; see HostBlockedError
+var ErrHostBlocked = transport.ErrHostBlocked
+
+// HostBlockedError names the host a request was refused for
+type HostBlockedError = transport.HostBlockedError
+
+// WithAllowedHosts limits the session to hosts matching patterns
+// ("example.com" includes its subdomains). Requests, redirects and warmup
+// subresources to any other host fail with ErrHostBlocked before anything
+// is sent, so an open redirect or an embedded canary can't reach a third
+// party.
+func WithAllowedHosts(patterns ...string) SessionOption {
+	return func(c *sessionConfig) {
+		c.allowedHosts = append(c.allowedHosts, patterns...)
+	}
+}
+
+// WithBlockedHosts fails requests, redirects and warmup subresources to
+// hosts matching patterns with ErrHostBlocked, even if they are allowed
+func WithBlockedHosts(patterns ...string) SessionOption {
+	return func(c *sessionConfig) {
+		c.blockedHosts = append(c.blockedHosts, patterns...)
+	}
+}
+
+// Protocol is an HTTP protocol for WithProtocolPolicy
+type Protocol = transport.Protocol
+
+const (
+	ProtocolAuto  = transport.ProtocolAuto
+	ProtocolHTTP1 = transport.ProtocolHTTP1
+	ProtocolHTTP2 = transport.ProtocolHTTP2
+	ProtocolHTTP3 = transport.ProtocolHTTP3
+)
+
+// WithProtocolPolicy forces the protocol for hosts matching the patterns
+// ("example.com" includes its subdomains), leaving every other host on the
+// session's protocol, auto-negotiation by default. The most specific
+// matching pattern wins; ProtocolAuto puts a host back on
+// auto-negotiation. Session.ProtocolDecision reports a forced host with
+// reason "policy".
+func WithProtocolPolicy(policy map[string]Protocol) SessionOption {
+	return func(c *sessionConfig) {
+		if c.protocolPolicy == nil {
+			c.protocolPolicy = make(map[string]Protocol, len(policy))
+		}
+		for pattern, p := range policy {
+			c.protocolPolicy[pattern] = p
+		}
+	}
+}
+
+// WithH3FailureBackoff sets how long auto-negotiation skips HTTP/3 for an
+// origin after it failed there, going straight to HTTP/2 instead of
+// retrying QUIC on every request. The default is 5 minutes; a negative
+// duration turns the memory off.
+func WithH3FailureBackoff(d time.Duration) SessionOption {
+	return func(c *sessionConfig) {
+		c.h3FailureBackoff = d
+	}
+}
+
+// WithRawBody turns off automatic response decompression. The preset's
+// Accept-Encoding is still sent, so bodies arrive gzip, br or zstd encoded
+// as the server chose; check the Content-Encoding header.
+func WithRawBody() SessionOption {
+	return func(c *sessionConfig) {
+		c.rawBody = true
+	}
+}
+
+// WithDrainLimit sets how much of an unread response body closing it reads
+// and discards so the connection can take the next request (default 256KB).
+// Bigger bodies close the HTTP/1.1 connection or reset the HTTP/2 or HTTP/3
+// stream. A limit of 0 or less never drains.
+func WithDrainLimit(limit int64) SessionOption {
+	return func(c *sessionConfig) {
+		if limit <= 0 {
+			limit = -1 // 0 in SessionConfig means the default
+		}
+		c.drainLimit = limit
+	}
+}
+
 // WithDisableSpeculativeTLS disables the speculative TLS optimization for proxy connections.
 // By default, httpcloak sends the CONNECT request and TLS ClientHello together to save
 // one round-trip (~25% faster). Disable this if you experience issues with certain proxies.
@@ -464,6 +1213,34 @@ func WithDisableSpeculativeTLS() SessionOption {
 	}
 }
 
+// ErrForbiddenAddress is matched by the error of a request WithSSRFProtection
+// refused; see ForbiddenAddressError
+var ErrForbiddenAddress = transport.ErrForbiddenAddress
+
+// ForbiddenAddressError names the host and the internal address it resolved
+// to
+type ForbiddenAddressError = transport.ForbiddenAddressError
+
+// WithSSRFProtection hardens a session fetching user-supplied URLs: requests
+// to hosts resolving to loopback, private, link-local (cloud metadata),
+// CGNAT, multicast or reserved addresses fail with ErrForbiddenAddress.
+// Every DNS answer is checked, on each redirect hop and each dial, so DNS
+// rebinding can't slip an internal address in after the check.
+func WithSSRFProtection() SessionOption {
+	return func(c *sessionConfig) {
+		c.ssrfProtection = true
+	}
+}
+
+// WithDisableLatencyPinning keeps auto mode on HTTP/3 for origins where it
+// measures consistently slower than HTTP/2. By default such an origin is
+// pinned to HTTP/2 for a while (see Session.ProtocolDecision).
+func WithDisableLatencyPinning() SessionOption {
+	return func(c *sessionConfig) {
+		c.disableLatencyPinning = true
+	}
+}
+
 // WithSwitchProtocol sets the protocol to switch to after Refresh().
 // This enables warming up TLS tickets on one protocol (e.g. H3) then serving
 // requests on another (e.g. H2) with TLS session resumption.
@@ -517,6 +1294,21 @@ func WithQuicIdleTimeout(d time.Duration) SessionOption {
 	}
 }
 
+// PoolConfig tunes connection pooling; see WithConnectionPool
+type PoolConfig = transport.PoolConfig
+
+// OriginPoolStats describes the connections to one origin; see
+// Session.PoolStats
+type OriginPoolStats = transport.OriginPoolStats
+
+// WithConnectionPool sets how many connections are kept idle and open per
+// host, and for how long. Durations are rounded down to seconds.
+func WithConnectionPool(cfg PoolConfig) SessionOption {
+	return func(c *sessionConfig) {
+		c.pool = cfg
+	}
+}
+
 // WithSessionCache sets a distributed TLS session cache backend.
 // This enables TLS session ticket sharing across multiple instances (e.g., via Redis).
 // The errorCallback is optional and will be called when backend operations fail.
@@ -527,6 +1319,165 @@ func WithSessionCache(backend transport.SessionCacheBackend, errorCallback trans
 	}
 }
 
+// WithTicketIsolation controls whether TLS session tickets may be reused across
+// different proxies / local addresses for the same origin. The default,
+// transport.TicketIsolationEgress, keeps tickets per egress so resumption never
+// links identities across proxy rotations. transport.TicketIsolationShared
+// restores origin-only keying.
+func WithTicketIsolation(policy transport.TicketIsolation) SessionOption {
+	return func(c *sessionConfig) {
+		c.ticketIsolation = policy.String()
+	}
+}
+
+// WithDuplicateHeaders sets how Response.GetHeader reads a header the server
+// sent more than once: the first line (default), the lines joined with ", "
+// (DuplicateHeadersMerge, never applied to Set-Cookie) or the last line.
+// Response.Headers keeps every line either way.
+func WithDuplicateHeaders(policy DuplicateHeaders) SessionOption {
+	return func(c *sessionConfig) {
+		c.duplicateHeaders = policy.String()
+	}
+}
+
+// WithClientHelloSpecHook registers a callback that can modify the utls
+// ClientHelloSpec derived from the preset before it is used.
+//
+// This is an escape hatch for experimentation. Presets are validated against
+// real browsers; anything changed here is not, and can easily produce a
+// fingerprint that no browser sends. Prefer a stock preset for real traffic.
+func WithClientHelloSpecHook(hook func(spec *utls.ClientHelloSpec)) SessionOption {
+	return func(c *sessionConfig) {
+		c.clientHelloSpecHook = hook
+	}
+}
+
+// WithQUICConfigHook registers a callback that can modify the final quic.Config
+// right before each HTTP/3 dial. The host being dialed is passed for per-target
+// tweaks.
+//
+// Like WithClientHelloSpecHook this bypasses preset validation - QUIC transport
+// parameters and Initial packet shape are fingerprinted too.
+func WithQUICConfigHook(hook func(host string, cfg *transport.QUICConfig)) SessionOption {
+	return func(c *sessionConfig) {
+		c.quicConfigHook = hook
+	}
+}
+
+// WithGeoConsistency checks the preset's Accept-Language against the country
+// of the egress IP, looked up with opts.Lookup (e.g. an offline GeoIP
+// database). Mismatches are reported to opts.OnMismatch; with opts.Adjust
+// the country's Accept-Language is sent instead.
+func WithGeoConsistency(opts session.GeoOptions) SessionOption {
+	return func(c *sessionConfig) {
+		c.geo = &opts
+	}
+}
+
+// WithChallengeSolver solves captchas (reCAPTCHA, hCaptcha, Turnstile) found
+// on challenge responses (403, 429, 503, or a known bot-check interstitial)
+// with opts.Solver and sends the request again with the token, in
+// opts.Header or the widget's form field. With opts.PoW, proof-of-work
+// puzzles are solved locally and answered the same way.
+func WithChallengeSolver(opts session.ChallengeOptions) SessionOption {
+	return func(c *sessionConfig) {
+		c.challenge = &opts
+	}
+}
+
+// WithClientCertificate presents cert to servers asking for mutual TLS,
+// over HTTP/1.1, HTTP/2 and HTTP/3. With hosts ("example.com" includes
+// subdomains) it is only offered to those; otherwise cert.Hosts applies.
+// The first certificate matching a host is used.
+func WithClientCertificate(cert *ClientCertificate, hosts ...string) SessionOption {
+	return func(c *sessionConfig) {
+		if len(hosts) > 0 {
+			scoped := *cert
+			scoped.Hosts = hosts
+			cert = &scoped
+		}
+		c.clientCertificates = append(c.clientCertificates, cert)
+	}
+}
+
+// WithCertificatePolicy changes how the certificates of policy.Hosts are
+// verified: SPKI pins, custom roots, a VerifyPeerCertificate callback or
+// skipping verification, for HTTP/1.1, HTTP/2 and HTTP/3 alike. The first
+// policy covering a host applies.
+func WithCertificatePolicy(policy CertificatePolicy) SessionOption {
+	return func(c *sessionConfig) {
+		c.certificatePolicies = append(c.certificatePolicies, &policy)
+	}
+}
+
+// WithConnectionCallback calls fn with each new TLS connection to hosts
+// ("example.com" includes subdomains; none for every host), over HTTP/1.1,
+// HTTP/2 and HTTP/3, before any request goes out on it. ConnInfo exports
+// the connection's keying material (ExportKeyingMaterial, ChannelBinding)
+// for schemes tying tokens to the TLS session. The request waits for fn;
+// over HTTP/3 it also waits for the handshake, giving up 0-RTT.
+func WithConnectionCallback(fn func(*ConnInfo), hosts ...string) SessionOption {
+	return func(c *sessionConfig) {
+		c.connectionCallbacks = append(c.connectionCallbacks, &transport.ConnectionCallback{Hosts: hosts, Func: fn})
+	}
+}
+
+// WithPinnedKeys accepts only certificate chains of host (and its
+// subdomains) with one of pins ("sha256/<base64>" SPKI hashes, see SPKIPin)
+func WithPinnedKeys(host string, pins ...string) SessionOption {
+	return WithCertificatePolicy(CertificatePolicy{Hosts: []string{host}, Pins: pins})
+}
+
+// WithProxyAuth answers an HTTP proxy's NTLM or Negotiate challenge to
+// CONNECT, on the connection being tunneled:
+//
+//	httpcloak.WithProxyAuth(httpcloak.NTLM(httpcloak.NTLMCredentials{
+//		Domain: "CORP", Username: "alice", Password: "secret",
+//	}))
+func WithProxyAuth(auth AuthenticatorFunc) SessionOption {
+	return func(c *sessionConfig) {
+		c.proxyAuth = auth
+	}
+}
+
+// WithServerAuth answers origins' NTLM or Negotiate challenges. The
+// handshake is bound to one connection, so it runs over HTTP/1.1. A 401
+// challenge received over HTTP/2 or HTTP/3 is not answered there: the
+// request is sent again on a new HTTP/1.1 connection, whose ClientHello
+// offers only http/1.1 in ALPN, and the handshake runs on it. This happens
+// for every such request, so the origin sees each one twice; force
+// HTTP/1.1 for it (WithForceHTTP1 or WithProtocolPolicy) to skip the first.
+// Requests whose body can't be replayed get the 401 back.
+func WithServerAuth(auth AuthenticatorFunc) SessionOption {
+	return func(c *sessionConfig) {
+		c.serverAuth = auth
+	}
+}
+
+// WithTokenSource sends an OAuth2 access token from src in the
+// Authorization header of requests to hosts ("example.com" includes
+// subdomains). Without hosts it goes to the origin each request is made to,
+// and follows redirects to other origins only with
+// WithKeepRedirectCredentials. The token is reused
+// until it expires; when a server answers 401 a new one is fetched and the
+// request sent again, once. Concurrent requests share one call to src.
+// Requests that set their own Authorization header are left alone.
+func WithTokenSource(src TokenSource, hosts ...string) SessionOption {
+	return func(c *sessionConfig) {
+		c.tokens = &session.TokenOptions{Source: src, Hosts: hosts}
+	}
+}
+
+// WithAutoWarmup warms up each origin before the session's first request
+// to it, loading a page and its first few subresources within opts.Budget,
+// so callers don't orchestrate a Warmup per origin. Requests made meanwhile
+// wait for it.
+func WithAutoWarmup(opts session.AutoWarmupOptions) SessionOption {
+	return func(c *sessionConfig) {
+		c.autoWarmup = &opts
+	}
+}
+
 // NewSession creates a new persistent session with cookie management
 func NewSession(preset string, opts ...SessionOption) *Session {
 	cfg := &sessionConfig{
@@ -545,17 +1496,41 @@ func NewSession(preset string, opts ...SessionOption) *Session {
 		Timeout:            int(cfg.timeout.Seconds()),
 		InsecureSkipVerify: cfg.insecureSkipVerify,
 		FollowRedirects:    !cfg.disableRedirects,
+		DisableConditional: cfg.disableConditional,
+		PreconnectRedirects: cfg.preconnectRedirect,
 		MaxRedirects:       cfg.maxRedirects,
+		RedirectMethods:    cfg.redirectMethods.String(),
+		RedirectCredentialHeaders: cfg.credentialHeaders,
+		KeepRedirectCredentials:   cfg.keepCredentials,
 		PreferIPv4:         cfg.preferIPv4,
 		ConnectTo:          cfg.connectTo,
 		ECHConfigDomain:    cfg.echConfigDomain,
 		TLSOnly:            cfg.tlsOnly,
 		QuicIdleTimeout:    int(cfg.quicIdleTimeout.Seconds()),
+		MaxIdleConnsPerHost: cfg.pool.MaxIdleConnsPerHost,
+		MaxConnsPerHost:     cfg.pool.MaxConnsPerHost,
+		IdleConnTimeout:     int(cfg.pool.IdleConnTimeout.Seconds()),
+		MaxConnLifetime:     int(cfg.pool.MaxConnLifetime.Seconds()),
 		LocalAddress:       cfg.localAddr,
 		KeyLogFile:         cfg.keyLogFile,
 		DisableECH:            cfg.disableECH,
+		StrictMode:            cfg.strictMode,
+		CookieTrace:           cfg.cookieTrace,
+		DNSServers:            cfg.dnsServers,
+		PersistDNS:            cfg.persistDNS,
+		StampBuild:            cfg.stampBuild,
+		HeaderRules:           cfg.headerRules,
+		AllowedHosts:          cfg.allowedHosts,
+		BlockedHosts:          cfg.blockedHosts,
+		H3FailureBackoff:      int(cfg.h3FailureBackoff.Milliseconds()),
+		RawBody:               cfg.rawBody,
+		DrainLimit:            cfg.drainLimit,
 		DisableSpeculativeTLS: cfg.disableSpeculativeTLS,
+		DisableLatencyPinning: cfg.disableLatencyPinning,
+		SSRFProtection:        cfg.ssrfProtection,
 		SwitchProtocol:        cfg.switchProtocol,
+		TLSTicketIsolation:    cfg.ticketIsolation,
+		DuplicateHeaders:      cfg.duplicateHeaders,
 	}
 
 	// Retry configuration
@@ -573,6 +1548,23 @@ func NewSession(preset string, opts ...SessionOption) *Session {
 		}
 	}
 
+	sessionCfg.BehaviorSeed = cfg.behaviorSeed
+	sessionCfg.IdentityKey = cfg.identityKey
+	sessionCfg.RequestGap = int(cfg.requestGap.Milliseconds())
+
+	// Hedging configuration
+	if cfg.hedgeDelay > 0 {
+		sessionCfg.HedgeDelay = int(cfg.hedgeDelay.Milliseconds())
+		sessionCfg.HedgeAllMethods = cfg.hedgeAllMethods
+	}
+
+	for pattern, p := range cfg.protocolPolicy {
+		if sessionCfg.ProtocolPolicy == nil {
+			sessionCfg.ProtocolPolicy = make(map[string]string, len(cfg.protocolPolicy))
+		}
+		sessionCfg.ProtocolPolicy[pattern] = p.String()
+	}
+
 	// Protocol forcing
 	if cfg.forceHTTP1 {
 		sessionCfg.ForceHTTP1 = true
@@ -586,12 +1578,24 @@ func NewSession(preset string, opts ...SessionOption) *Session {
 		sessionCfg.ForceHTTP3 = true
 	}
 
-	// Create session with optional distributed cache
+	// Create session with optional distributed cache and escape hatches
 	var s *session.Session
-	if cfg.sessionCacheBackend != nil {
+	if cfg.sessionCacheBackend != nil || cfg.clientHelloSpecHook != nil || cfg.quicConfigHook != nil || cfg.geo != nil || cfg.onRedirect != nil || cfg.challenge != nil || len(cfg.clientCertificates) > 0 || len(cfg.certificatePolicies) > 0 || len(cfg.connectionCallbacks) > 0 || cfg.proxyAuth != nil || cfg.serverAuth != nil || cfg.tokens != nil || cfg.autoWarmup != nil {
 		opts := &session.SessionOptions{
 			SessionCacheBackend:       cfg.sessionCacheBackend,
 			SessionCacheErrorCallback: cfg.sessionCacheErrorCallback,
+			ClientHelloSpecHook:       cfg.clientHelloSpecHook,
+			QUICConfigHook:            cfg.quicConfigHook,
+			OnRedirect:                cfg.onRedirect,
+			Geo:                       cfg.geo,
+			Challenge:                 cfg.challenge,
+			ClientCertificates:        cfg.clientCertificates,
+			CertificatePolicies:       cfg.certificatePolicies,
+			ConnectionCallbacks:       cfg.connectionCallbacks,
+			ProxyAuth:                 cfg.proxyAuth,
+			ServerAuth:                cfg.serverAuth,
+			Tokens:                    cfg.tokens,
+			AutoWarmup:                cfg.autoWarmup,
 		}
 		s = session.NewSessionWithOptions("", sessionCfg, opts)
 	} else {
@@ -602,12 +1606,22 @@ func NewSession(preset string, opts ...SessionOption) *Session {
 
 // Do executes a request within the session, maintaining cookies
 func (s *Session) Do(ctx context.Context, req *Request) (*Response, error) {
+	if req.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, req.Timeout)
+		defer cancel() // The body is read before the session returns
+	}
 	sReq := &transport.Request{
 		Method:     req.Method,
 		URL:        req.URL,
+		Host:       req.Host,
 		Headers:    req.Headers,
 		BodyReader: req.Body,
+		BodySource: req.BodySource,
 		TLSOnly:    req.TLSOnly,
+		Redirect:   req.Redirect,
+		Priority:   req.Priority,
+		Meta:       req.Meta,
 	}
 
 	resp, err := s.inner.Request(ctx, sReq)
@@ -624,17 +1638,26 @@ func (s *Session) Do(ctx context.Context, req *Request) (*Response, error) {
 				StatusCode: h.StatusCode,
 				URL:        h.URL,
 				Headers:    h.Headers,
+				Method:     h.Method,
+				Cookie:     h.Cookie,
 			}
 		}
 	}
 
 	return &Response{
-		StatusCode: resp.StatusCode,
-		Headers:    resp.Headers,
-		Body:       resp.Body,
-		FinalURL:   resp.FinalURL,
-		Protocol:   resp.Protocol,
-		History:    history,
+		StatusCode:  resp.StatusCode,
+		Headers:     resp.Headers,
+		Body:        resp.Body,
+		FinalURL:    resp.FinalURL,
+		Protocol:    resp.Protocol,
+		History:     history,
+		Hedged:      resp.Hedged,
+		SetCookies:  session.ParseSetCookies(resp.Headers, resp.FinalURL),
+		CookieTrace: resp.CookieTrace,
+		Revalidated: resp.Revalidated,
+		Meta:        resp.Meta,
+
+		headerPolicy: resp.HeaderPolicy,
 	}, nil
 }
 
@@ -643,9 +1666,13 @@ func (s *Session) DoWithBody(ctx context.Context, req *Request, bodyReader io.Re
 	sReq := &transport.Request{
 		Method:     req.Method,
 		URL:        req.URL,
+		Host:       req.Host,
 		Headers:    req.Headers,
 		BodyReader: bodyReader,
 		TLSOnly:    req.TLSOnly,
+		Redirect:   req.Redirect,
+		Priority:   req.Priority,
+		Meta:       req.Meta,
 	}
 
 	resp, err := s.inner.Request(ctx, sReq)
@@ -662,23 +1689,54 @@ func (s *Session) DoWithBody(ctx context.Context, req *Request, bodyReader io.Re
 				StatusCode: h.StatusCode,
 				URL:        h.URL,
 				Headers:    h.Headers,
+				Method:     h.Method,
+				Cookie:     h.Cookie,
 			}
 		}
 	}
 
 	return &Response{
-		StatusCode: resp.StatusCode,
-		Headers:    resp.Headers,
-		Body:       resp.Body,
-		FinalURL:   resp.FinalURL,
-		Protocol:   resp.Protocol,
-		History:    history,
+		StatusCode:  resp.StatusCode,
+		Headers:     resp.Headers,
+		Body:        resp.Body,
+		FinalURL:    resp.FinalURL,
+		Protocol:    resp.Protocol,
+		History:     history,
+		Hedged:      resp.Hedged,
+		SetCookies:  session.ParseSetCookies(resp.Headers, resp.FinalURL),
+		CookieTrace: resp.CookieTrace,
+		Revalidated: resp.Revalidated,
+		Meta:        resp.Meta,
+
+		headerPolicy: resp.HeaderPolicy,
 	}, nil
 }
 
 // Get performs a GET request within the session
-func (s *Session) Get(ctx context.Context, url string) (*Response, error) {
-	return s.Do(ctx, &Request{Method: "GET", URL: url})
+func (s *Session) Get(ctx context.Context, url string, opts ...RequestOption) (*Response, error) {
+	return s.Send(ctx, "GET", url, opts...)
+}
+
+// SendBeacon POSTs body to url the way navigator.sendBeacon does and
+// returns once it is queued. The beacon outlives ctx's cancellation and its
+// response is discarded; bodies in flight are capped at 64 KiB in total
+// (ErrBeaconQuota).
+func (s *Session) SendBeacon(ctx context.Context, url string, body []byte) error {
+	return s.inner.SendBeacon(ctx, url, body)
+}
+
+// SendBeaconWithOptions is SendBeacon with a content type and the page
+// sending it
+func (s *Session) SendBeaconWithOptions(ctx context.Context, url string, body []byte, opts BeaconOptions) error {
+	return s.inner.SendBeaconWithOptions(ctx, url, body, opts)
+}
+
+// Poll fetches url every interval with conditional requests and reports
+// changes, errors (after which it backs off) and, with EmitUnchanged, every
+// poll on the returned channel until ctx is done. Identical polls on one
+// session share a poller.
+func (s *Session) Poll(ctx context.Context, url string, interval time.Duration, opts PollOptions) <-chan PollEvent {
+	return s.inner.Poll(ctx, url, interval, opts)
 }
 
 // GetCookies returns all cookies stored in the session
@@ -691,6 +1749,63 @@ func (s *Session) SetCookie(name, value string) {
 	s.inner.SetCookie(name, value)
 }
 
+// CookiesFor returns the cookies, with domain, path, expiry and flags, that
+// the session would send to host. An empty host returns all cookies.
+func (s *Session) CookiesFor(host string) []session.CookieState {
+	return s.inner.CookiesFor(host)
+}
+
+// CookiesAt returns the cookies CookiesFor would return at asOf, leaving
+// out those that will have expired by then
+func (s *Session) CookiesAt(host string, asOf time.Time) []session.CookieState {
+	return s.inner.CookiesAt(host, asOf)
+}
+
+// ExportCookiesAt returns the session's cookies, keyed by domain, that will
+// still be valid at asOf
+func (s *Session) ExportCookiesAt(asOf time.Time) map[string][]session.CookieState {
+	return s.inner.ExportCookiesAt(asOf)
+}
+
+// PutCookie stores a cookie with explicit attributes. Domain ".example.com"
+// makes a domain cookie, "example.com" a host-only cookie and "" a cookie
+// sent to every host.
+func (s *Session) PutCookie(cookie session.CookieState) {
+	s.inner.PutCookie(cookie)
+}
+
+// MergeCookies merges domain-keyed cookies, such as a fresh browser export,
+// into the session, settling conflicts by policy. It returns how many of
+// the given cookies were taken.
+func (s *Session) MergeCookies(cookies map[string][]session.CookieState, policy MergePolicy) int {
+	return s.inner.MergeCookies(cookies, policy)
+}
+
+// SetStrictMode turns impersonation off or back on. In strict mode requests
+// go out as a plain Go client sends them: crypto/tls's ClientHello, Go's
+// HTTP/2 settings, only User-Agent and Accept-Encoding headers, no HTTP/3,
+// client hints or revalidation. Cookies, proxy and local address are kept,
+// so comparing the two modes tells fingerprint-based blocking from IP-based
+// blocking without switching libraries or losing state.
+func (s *Session) SetStrictMode(strict bool) {
+	s.inner.SetStrictMode(strict)
+}
+
+// StrictMode reports whether impersonation is off (see SetStrictMode)
+func (s *Session) StrictMode() bool {
+	return s.inner.StrictMode()
+}
+
+// SetCookieTrace turns cookie tracing on or off (see WithCookieTrace)
+func (s *Session) SetCookieTrace(enabled bool) {
+	s.inner.SetCookieTrace(enabled)
+}
+
+// CookieTrace reports whether cookie tracing is on
+func (s *Session) CookieTrace() bool {
+	return s.inner.CookieTrace()
+}
+
 // SetProxy sets or updates the proxy for all protocols (HTTP/1.1, HTTP/2, HTTP/3)
 // This closes existing connections and recreates transports with the new proxy
 // Pass empty string to switch to direct connection
@@ -750,6 +1865,27 @@ func (s *Session) Warmup(ctx context.Context, url string) error {
 	return s.inner.Warmup(ctx, url)
 }
 
+// Render screenshots pageURL (RenderPNG) or prints it to PDF with r, from
+// the HTML and subresources the session already fetched, so evidence shows
+// what the session was served without fetching again with another
+// fingerprint. Load the page with Warmup first. ChromeRenderer is a
+// reference Renderer running headless Chrome.
+func (s *Session) Render(ctx context.Context, pageURL string, r Renderer, format RenderFormat) ([]byte, error) {
+	return s.inner.Render(ctx, pageURL, r, format)
+}
+
+// CachedPage returns pageURL and its subresources as the session cached
+// them, or nil
+func (s *Session) CachedPage(pageURL string) *Page {
+	return s.inner.CachedPage(pageURL)
+}
+
+// PoolStats reports the session's open connections per origin and
+// protocol, with how many are idle and how many resumed a TLS session
+func (s *Session) PoolStats() []OriginPoolStats {
+	return s.inner.PoolStats()
+}
+
 // Fork creates n new sessions that share cookies and TLS session caches with
 // the parent, but have independent connections. This simulates multiple browser
 // tabs — same cookies, same TLS resumption tickets, same fingerprint, but
@@ -766,6 +1902,23 @@ func (s *Session) Fork(n int) []*Session {
 	return forks
 }
 
+// Clone returns an independent deep copy of the session: cookies, TLS
+// tickets, ECH configs and config are copied, and nothing is shared with
+// the parent afterwards (unlike Fork)
+func (s *Session) Clone() (*Session, error) {
+	return s.CloneWithOptions(CloneOptions{})
+}
+
+// CloneWithOptions is Clone, optionally with a fresh fingerprint seed or a
+// new identity key
+func (s *Session) CloneWithOptions(opts CloneOptions) (*Session, error) {
+	inner, err := s.inner.CloneWithOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Session{inner: inner}, nil
+}
+
 // Close closes the session and releases resources
 func (s *Session) Close() {
 	s.inner.Close()
@@ -785,6 +1938,25 @@ func (s *Session) RefreshWithProtocol(protocol string) error {
 	return s.inner.RefreshWithProtocol(protocol)
 }
 
+// ProtocolDecision returns the protocol auto mode uses for host, why (it
+// won the race, measured faster, or was pinned by hand) and the time to
+// first byte measured over HTTP/2 and HTTP/3
+func (s *Session) ProtocolDecision(host string) ProtocolDecision {
+	return s.inner.ProtocolDecision(host)
+}
+
+// PinProtocol makes auto mode use protocol ("h1", "h2" or "h3") for host
+// for ttl, overriding what it learned or measured
+func (s *Session) PinProtocol(host, protocol string, ttl time.Duration) error {
+	return s.inner.PinProtocol(host, protocol, ttl)
+}
+
+// UnpinProtocol forgets the protocol chosen for host, pinned or learned,
+// so its next request races HTTP/3 and HTTP/2 again
+func (s *Session) UnpinProtocol(host string) {
+	s.inner.UnpinProtocol(host)
+}
+
 // Save exports session state (cookies, TLS sessions) to a file
 func (s *Session) Save(path string) error {
 	return s.inner.Save(path)
@@ -795,6 +1967,184 @@ func (s *Session) Marshal() ([]byte, error) {
 	return s.inner.Marshal()
 }
 
+// SaveEncrypted saves the session like Save, sealed with AES-GCM under key
+// (16, 24 or 32 bytes). Load it with LoadEncrypted.
+func (s *Session) SaveEncrypted(path string, key []byte) error {
+	return s.inner.SaveEncrypted(path, key)
+}
+
+// SaveTo stores the session's state in store under id
+func (s *Session) SaveTo(ctx context.Context, store Store, id string) error {
+	return s.inner.SaveTo(ctx, store, id)
+}
+
+// AutoSave saves the session to store under id whenever it changes, once
+// changes settle for opts.Debounce. Close saves what is still pending.
+func (s *Session) AutoSave(store Store, id string, opts AutoSaveOptions) {
+	s.inner.AutoSave(store, id, opts)
+}
+
+// StopAutoSave stops AutoSave after saving any pending change
+func (s *Session) StopAutoSave() {
+	s.inner.StopAutoSave()
+}
+
+// Suspend stops taking requests, waits for those in flight, captures the
+// session's complete state, in-memory caches included, and closes its
+// connections. Resume the state in a later process.
+func (s *Session) Suspend(ctx context.Context) ([]byte, error) {
+	return s.inner.Suspend(ctx)
+}
+
+// Resume restores a session from Suspend's state
+func Resume(state []byte) (*Session, error) {
+	inner, err := session.Resume(state)
+	if err != nil {
+		return nil, err
+	}
+	return &Session{inner: inner}, nil
+}
+
+// LoadFrom loads the session stored in store under id
+func LoadFrom(ctx context.Context, store Store, id string) (*Session, error) {
+	inner, err := session.LoadFrom(ctx, store, id)
+	if err != nil {
+		return nil, err
+	}
+	return &Session{inner: inner}, nil
+}
+
+// PoolStats describes a SessionPool
+type PoolStats = session.PoolStats
+
+var (
+	// ErrPoolClosed is returned by Checkout once the pool is closed
+	ErrPoolClosed = session.ErrPoolClosed
+
+	// ErrPoolExhausted is returned by Checkout when every session has been
+	// retired and none could be replaced
+	ErrPoolExhausted = session.ErrPoolExhausted
+)
+
+// PoolOptions configures a SessionPool
+type PoolOptions struct {
+	// Size is the number of sessions (default 1)
+	Size int
+
+	// New creates the session for slot i, both at start and to replace a
+	// retired one. Default: a session with Presets[i % len(Presets)]
+	// ("chrome-latest" if empty) and Proxies[i % len(Proxies)].
+	New func(i int) (*Session, error)
+
+	// Presets and Proxies are spread over the slots by the default New
+	Presets []string
+	Proxies []string
+
+	// RequestBudget retires a session once it has made this many requests.
+	// 0 is unlimited.
+	RequestBudget int64
+
+	// Cooldown is how long a checked-in session rests before it is handed
+	// out again
+	Cooldown time.Duration
+
+	// MaxFlags retires a session flagged this many times (default 1)
+	MaxFlags int
+
+	// NoReplace leaves retired slots empty instead of creating a new
+	// session for them
+	NoReplace bool
+
+	// OnRetire is called with each retired session (already closed) and
+	// why: "budget", "flagged", "closed" or the reason passed to
+	// Lease.Retire
+	OnRetire func(s *Session, reason string)
+}
+
+// SessionPool hands out sessions with distinct presets and proxies, one
+// caller at a time each, resting them between uses and retiring those that
+// run out of budget or get flagged
+type SessionPool struct {
+	inner *session.SessionPool
+}
+
+// Lease is a session checked out of a SessionPool. Check it in, or retire
+// it, when done.
+type Lease struct {
+	Session *Session
+
+	inner *session.Lease
+}
+
+// NewSessionPool creates the pool's sessions
+func NewSessionPool(opts PoolOptions) (*SessionPool, error) {
+	innerOpts := session.PoolOptions{
+		Size:          opts.Size,
+		Presets:       opts.Presets,
+		Proxies:       opts.Proxies,
+		RequestBudget: opts.RequestBudget,
+		Cooldown:      opts.Cooldown,
+		MaxFlags:      opts.MaxFlags,
+		NoReplace:     opts.NoReplace,
+	}
+	if opts.New != nil {
+		innerOpts.New = func(i int) (*session.Session, error) {
+			s, err := opts.New(i)
+			if err != nil {
+				return nil, err
+			}
+			return s.inner, nil
+		}
+	}
+	if opts.OnRetire != nil {
+		innerOpts.OnRetire = func(s *session.Session, reason string) {
+			opts.OnRetire(&Session{inner: s}, reason)
+		}
+	}
+	inner, err := session.NewSessionPool(innerOpts)
+	if err != nil {
+		return nil, err
+	}
+	return &SessionPool{inner: inner}, nil
+}
+
+// Checkout hands out the session that has been ready longest, waiting for
+// one to be checked in or to finish its cooldown until ctx is done
+func (p *SessionPool) Checkout(ctx context.Context) (*Lease, error) {
+	inner, err := p.inner.Checkout(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &Lease{Session: &Session{inner: inner.Session}, inner: inner}, nil
+}
+
+// Stats returns the pool's current counts
+func (p *SessionPool) Stats() PoolStats {
+	return p.inner.Stats()
+}
+
+// Close closes the sessions that aren't checked out; the others close when
+// they are checked in
+func (p *SessionPool) Close() {
+	p.inner.Close()
+}
+
+// Checkin returns the session to the pool, retiring it if it has used up
+// its request budget
+func (l *Lease) Checkin() {
+	l.inner.Checkin()
+}
+
+// Flag records that the session was blocked or challenged and checks it in
+func (l *Lease) Flag() {
+	l.inner.Flag()
+}
+
+// Retire closes the session and checks in its slot
+func (l *Lease) Retire(reason string) {
+	l.inner.Retire(reason)
+}
+
 // LoadSession loads a session from a file
 func LoadSession(path string) (*Session, error) {
 	inner, err := session.LoadSession(path)
@@ -804,6 +2154,15 @@ func LoadSession(path string) (*Session, error) {
 	return &Session{inner: inner}, nil
 }
 
+// LoadEncrypted loads a session saved by SaveEncrypted with the same key
+func LoadEncrypted(path string, key []byte) (*Session, error) {
+	inner, err := session.LoadEncrypted(path, key)
+	if err != nil {
+		return nil, err
+	}
+	return &Session{inner: inner}, nil
+}
+
 // UnmarshalSession loads a session from JSON bytes
 func UnmarshalSession(data []byte) (*Session, error) {
 	inner, err := session.UnmarshalSession(data)
@@ -813,6 +2172,13 @@ func UnmarshalSession(data []byte) (*Session, error) {
 	return &Session{inner: inner}, nil
 }
 
+// ImportReport returns what happened to the TLS tickets and ECH configs of a
+// loaded session: which were kept and which were discarded because the current
+// preset could not have negotiated them. Nil for sessions created with NewSession.
+func (s *Session) ImportReport() *session.ImportReport {
+	return s.inner.ImportReport()
+}
+
 // StreamResponse represents a streaming HTTP response where the body
 // is read incrementally. Use this for large file downloads.
 type StreamResponse struct {
@@ -821,6 +2187,7 @@ type StreamResponse struct {
 	FinalURL      string
 	Protocol      string
 	ContentLength int64 // -1 if unknown (chunked encoding)
+	Meta          map[string]any // The Request's Meta
 
 	inner *transport.StreamResponse
 }
@@ -835,6 +2202,12 @@ func (r *StreamResponse) Close() error {
 	return r.inner.Close()
 }
 
+// Trailers returns the trailers sent after the body, complete once it has
+// been read to EOF
+func (r *StreamResponse) Trailers() map[string][]string {
+	return r.inner.Trailers()
+}
+
 // ReadAll reads the entire response body into memory
 // This defeats the purpose of streaming but is useful for small responses
 func (r *StreamResponse) ReadAll() ([]byte, error) {
@@ -846,6 +2219,51 @@ func (r *StreamResponse) ReadChunk(size int) ([]byte, error) {
 	return r.inner.ReadChunk(size)
 }
 
+// JSON decodes the rest of the stream as one JSON value into v and closes
+// the response.
+func (r *StreamResponse) JSON(v interface{}, opts ...JSONOption) error {
+	defer r.Close()
+	return client.DecodeJSON(r, v, opts...)
+}
+
+// JSONStream returns a json.Decoder reading the stream incrementally.
+// Close the response when done.
+func (r *StreamResponse) JSONStream(opts ...JSONOption) *json.Decoder {
+	return client.NewJSONDecoder(r, opts...)
+}
+
+// Tee writes the rest of the body to w as it is read
+func (r *StreamResponse) Tee(w io.Writer) {
+	r.inner.Tee(w)
+}
+
+// Split hands the rest of the body to n readers that each see all of it,
+// to be read concurrently. Don't read the response itself afterwards;
+// closing it, or every reader, ends the stream.
+func (r *StreamResponse) Split(n int) []io.ReadCloser {
+	return r.inner.Split(n)
+}
+
+// Lines returns a channel yielding the body line by line.
+// Close the response when done to stop iteration.
+func (r *StreamResponse) Lines() <-chan string {
+	return r.inner.Lines()
+}
+
+// LineReader returns a pull-based reader over the body's lines with a size
+// cap (maxLineSize <= 0 for transport.DefaultMaxLineSize). Over-long lines
+// are reported as transport.ErrLineTooLong.
+func (r *StreamResponse) LineReader(maxLineSize int) *transport.LineReader {
+	return r.inner.LineReader(maxLineSize)
+}
+
+// NDJSON streams the body as newline-delimited JSON into ch and closes ch
+// when done. Sending blocks until the consumer is ready (or ctx is done), so
+// a slow consumer throttles the download instead of buffering it.
+func (r *StreamResponse) NDJSON(ctx context.Context, ch chan<- json.RawMessage, maxLineSize int) error {
+	return r.inner.NDJSON(ctx, ch, maxLineSize)
+}
+
 // DoStream executes an HTTP request and returns a streaming response
 // The caller is responsible for closing the response when done
 // Note: Streaming does NOT support redirects - use Do() for redirect handling
@@ -853,9 +2271,12 @@ func (s *Session) DoStream(ctx context.Context, req *Request) (*StreamResponse,
 	sReq := &transport.Request{
 		Method:     req.Method,
 		URL:        req.URL,
+		Host:       req.Host,
 		Headers:    req.Headers,
 		BodyReader: req.Body,
+		BodySource: req.BodySource,
 		TLSOnly:    req.TLSOnly,
+		Meta:       req.Meta,
 	}
 
 	resp, err := s.inner.RequestStream(ctx, sReq)
@@ -869,6 +2290,7 @@ func (s *Session) DoStream(ctx context.Context, req *Request) (*StreamResponse,
 		FinalURL:      resp.FinalURL,
 		Protocol:      resp.Protocol,
 		ContentLength: resp.ContentLength,
+		Meta:          resp.Meta,
 		inner:         resp,
 	}, nil
 }
@@ -887,3 +2309,17 @@ func (s *Session) GetStreamWithHeaders(ctx context.Context, url string, headers
 func Presets() []string {
 	return fingerprint.Available()
 }
+
+// PresetManifest returns every preset with its User-Agent, client hint
+// brands, expected JA4 and HTTP/2 and HTTP/3 fingerprints as JSON (see
+// fingerprint.Manifest)
+func PresetManifest() ([]byte, error) {
+	return fingerprint.Manifest()
+}
+
+// Version returns build provenance: the httpcloak release, the preset database
+// revision, the utls/quic-go versions linked in and the build's VCS revision.
+// The same information is stamped into saved session state.
+func Version() version.Info {
+	return version.Get()
+}
@@ -0,0 +1,107 @@
+package pool
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sardanioss/httpcloak/fingerprint"
+	utls "github.com/sardanioss/utls"
+)
+
+// helloCipherSuites accepts one connection on ln and returns the cipher
+// suites of the ClientHello it receives, GREASE left out
+func helloCipherSuites(ln net.Listener) ([]uint16, error) {
+	conn, err := ln.Accept()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return nil, err
+	}
+	record := make([]byte, binary.BigEndian.Uint16(header[3:5]))
+	if _, err := io.ReadFull(conn, record); err != nil {
+		return nil, err
+	}
+	// Handshake header, version, random, session ID, cipher suites
+	b := record
+	if header[0] != 22 || len(b) < 4+2+32+1 || b[0] != 1 {
+		return nil, errors.New("not a ClientHello")
+	}
+	b = b[4+2+32:]
+	b = b[1+int(b[0]):]
+	if len(b) < 2 || len(b) < 2+int(binary.BigEndian.Uint16(b)) {
+		return nil, errors.New("truncated ClientHello")
+	}
+	var suites []uint16
+	for i := 2; i < 2+int(binary.BigEndian.Uint16(b)); i += 2 {
+		if s := binary.BigEndian.Uint16(b[i:]); s&0x0f0f != 0x0a0a {
+			suites = append(suites, s)
+		}
+	}
+	return suites, nil
+}
+
+// dialSuites opens a pool connection to a local server and returns the
+// cipher suites it offered
+func dialSuites(t *testing.T, m *Manager) []uint16 {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	type result struct {
+		suites []uint16
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		suites, err := helloCipherSuites(ln)
+		done <- result{suites, err}
+	}()
+
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	m.GetConn(ctx, "127.0.0.1", port) // Fails once the server hangs up
+
+	got := <-done
+	if got.err != nil {
+		t.Fatal(got.err)
+	}
+	return got.suites
+}
+
+func TestCustomTLSSpecScope(t *testing.T) {
+	custom, err := fingerprint.SpecFuncFromJA3("771,4865-4866,0-10-11-13-43-51,29,0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []uint16{utls.TLS_AES_128_GCM_SHA256, utls.TLS_AES_256_GCM_SHA384}
+
+	// A preset's own custom spec doesn't change what the pool sends
+	preset := fingerprint.Get("chrome-144")
+	preset.CustomClientHelloSpec = custom
+	m := NewManagerWithTLSConfig(preset, true)
+	defer m.Close()
+	if got := dialSuites(t, m); reflect.DeepEqual(got, want) {
+		t.Errorf("pool sent the preset's CustomClientHelloSpec: %#04x", got)
+	}
+
+	m = NewManagerWithTLSConfig(fingerprint.Get("chrome-144"), true)
+	defer m.Close()
+	m.SetCustomTLSSpec(custom)
+	if got := dialSuites(t, m); !reflect.DeepEqual(got, want) {
+		t.Errorf("cipher suites %#04x, want %#04x", got, want)
+	}
+}
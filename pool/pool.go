@@ -138,6 +138,8 @@ type HostPool struct {
 	// ECH (Encrypted Client Hello) configuration
 	echConfig       []byte // Custom ECH configuration
 	echConfigDomain string // Domain to fetch ECH config from
+
+	customSpec func() *utls.ClientHelloSpec // Replaces the preset's ClientHello
 }
 
 // NewHostPool creates a new pool for a specific host
@@ -217,6 +219,14 @@ func (p *HostPool) SetECHConfigDomain(domain string) {
 	p.echConfigDomain = domain
 }
 
+// SetCustomTLSSpec makes new connections send the ClientHello built by spec
+// instead of the preset's. spec is called once per connection.
+func (p *HostPool) SetCustomTLSSpec(spec func() *utls.ClientHelloSpec) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.customSpec = spec
+}
+
 // SetLocalAddr sets the local IP address for outgoing connections
 func (p *HostPool) SetLocalAddr(addr string) {
 	p.mu.Lock()
@@ -352,8 +362,14 @@ func (p *HostPool) createConn(ctx context.Context) (*Conn, error) {
 	var specToUse *utls.ClientHelloSpec
 	var tlsConn *utls.UConn
 
+	// A spec set with SetCustomTLSSpec (e.g. one built from a JA3 string)
+	// takes precedence
+	if p.customSpec != nil {
+		specToUse = p.customSpec()
+	}
+
 	// Prefer PSK spec when available - Chrome always includes PSK extension structure
-	if p.cachedPSKSpec != nil && p.preset.PSKClientHelloID.Client != "" {
+	if specToUse == nil && p.cachedPSKSpec != nil && p.preset.PSKClientHelloID.Client != "" {
 		// Generate fresh PSK spec for this connection
 		if spec, err := utls.UTLSIdToSpecWithSeed(p.preset.PSKClientHelloID, p.shuffleSeed); err == nil {
 			specToUse = &spec
@@ -368,6 +384,7 @@ func (p *HostPool) createConn(ctx context.Context) (*Conn, error) {
 
 	// Create UClient with HelloCustom and apply the fresh spec
 	if specToUse != nil {
+		fingerprint.ApplySignatureAlgorithms(specToUse, p.preset)
 		tlsConn = utls.UClient(rawConn, tlsConfig, utls.HelloCustom)
 		if err := tlsConn.ApplyPreset(specToUse); err != nil {
 			rawConn.Close()
@@ -408,16 +425,10 @@ func (p *HostPool) createConn(ctx context.Context) (*Conn, error) {
 		MaxEncoderHeaderTableSize:  settings.HeaderTableSize,
 
 		// Native fingerprinting via sardanioss/net
-		ConnectionFlow: settings.ConnectionWindowUpdate,
-		Settings:       buildHTTP2Settings(settings),
-		SettingsOrder:  buildHTTP2SettingsOrder(settings),
-		PseudoHeaderOrder: func() []string {
-			// Safari/iOS uses m,s,p,a order; Chrome uses m,a,s,p
-			if settings.NoRFC7540Priorities {
-				return []string{":method", ":scheme", ":path", ":authority"} // Safari order (m,s,p,a)
-			}
-			return []string{":method", ":authority", ":scheme", ":path"} // Chrome order (m,a,s,p)
-		}(),
+		ConnectionFlow:    settings.ConnectionWindowUpdate,
+		Settings:          buildHTTP2Settings(settings),
+		SettingsOrder:     buildHTTP2SettingsOrder(settings),
+		PseudoHeaderOrder: settings.PseudoHeaders(),
 		HeaderPriority: &http2.PriorityParam{
 			Weight:    uint8(settings.StreamWeight - 1), // Wire format is weight-1
 			Exclusive: settings.StreamExclusive,
@@ -440,7 +451,7 @@ func (p *HostPool) createConn(ctx context.Context) (*Conn, error) {
 		HPACKIndexingPolicy: hpack.IndexingChrome,
 	}
 
-	h2Conn, err := h2Transport.NewClientConn(tlsConn)
+	h2Conn, err := h2Transport.NewClientConn(transport.NewHTTP2Conn(tlsConn, settings))
 	if err != nil {
 		tlsConn.Close()
 		return nil, fmt.Errorf("HTTP/2 setup failed: %w", err)
@@ -697,7 +708,7 @@ func (p *HostPool) dialHTTPProxy(ctx context.Context, proxy *proxyConfig) (net.C
 		return nil, fmt.Errorf("no IP addresses found for proxy host %s", proxy.Host)
 	}
 
-	dialer := &net.Dialer{Timeout: p.connectTimeout}
+	dialer := &net.Dialer{Timeout: p.connectTimeout, KeepAlive: 30 * time.Second} // Keep idle tunnels alive
 	if p.localAddr != "" {
 		dialer.LocalAddr = &net.TCPAddr{IP: net.ParseIP(p.localAddr)}
 	}
@@ -706,6 +717,11 @@ func (p *HostPool) dialHTTPProxy(ctx context.Context, proxy *proxyConfig) (net.C
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to proxy: %w", err)
 	}
+	if proxy.Scheme == "https" {
+		if conn, err = transport.DialProxyTLS(ctx, conn, proxy.Host, p.preset, p.insecureSkipVerify); err != nil {
+			return nil, err
+		}
+	}
 
 	// Send CONNECT request
 	targetAddr := net.JoinHostPort(p.host, p.port)
@@ -965,6 +981,7 @@ type Manager struct {
 	connectTo          map[string]string // Domain fronting: request host -> connect host
 	echConfig          []byte            // Custom ECH configuration
 	echConfigDomain    string            // Domain to fetch ECH config from
+	customSpec         func() *utls.ClientHelloSpec
 
 	// Cached TLS specs - shared across all HostPools for consistent fingerprint
 	// Chrome shuffles extension order once per session, not per connection
@@ -1139,6 +1156,9 @@ func (m *Manager) GetPool(host, port string) (*HostPool, error) {
 	if m.echConfigDomain != "" {
 		pool.SetECHConfigDomain(m.echConfigDomain)
 	}
+	if m.customSpec != nil {
+		pool.SetCustomTLSSpec(m.customSpec)
+	}
 	m.pools[key] = pool
 	return pool, nil
 }
@@ -1188,6 +1208,15 @@ func (m *Manager) SetECHConfigDomain(domain string) {
 	m.echConfigDomain = domain
 }
 
+// SetCustomTLSSpec makes new connections send the ClientHello built by spec
+// instead of the preset's. The pool keeps to ClientHelloID otherwise, even
+// for presets with a CustomClientHelloSpec.
+func (m *Manager) SetCustomTLSSpec(spec func() *utls.ClientHelloSpec) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.customSpec = spec
+}
+
 // cleanupLoop periodically cleans up idle connections
 func (m *Manager) cleanupLoop() {
 	ticker := time.NewTicker(m.cleanupInterval)
@@ -1293,52 +1322,22 @@ func (m *Manager) Stats() map[string]struct {
 	return stats
 }
 
-// boolToUint32 converts a bool to uint32 (for HTTP/2 SETTINGS)
-func boolToUint32(b bool) uint32 {
-	if b {
-		return 1
-	}
-	return 0
-}
-
 // buildHTTP2Settings creates the settings map based on preset configuration
 func buildHTTP2Settings(settings fingerprint.HTTP2Settings) map[http2.SettingID]uint32 {
-	// Safari/iOS uses different settings than Chrome
-	if settings.NoRFC7540Priorities {
-		// Safari/iOS settings: ENABLE_PUSH, INITIAL_WINDOW_SIZE, MAX_CONCURRENT_STREAMS, NO_RFC7540_PRIORITIES
-		return map[http2.SettingID]uint32{
-			http2.SettingEnablePush:           boolToUint32(settings.EnablePush),
-			http2.SettingInitialWindowSize:    settings.InitialWindowSize,
-			http2.SettingMaxConcurrentStreams: settings.MaxConcurrentStreams,
-			http2.SettingNoRFC7540Priorities:  1,
-		}
-	}
-	// Chrome settings: HEADER_TABLE_SIZE, ENABLE_PUSH, INITIAL_WINDOW_SIZE, MAX_HEADER_LIST_SIZE
-	return map[http2.SettingID]uint32{
-		http2.SettingHeaderTableSize:   settings.HeaderTableSize,
-		http2.SettingEnablePush:        boolToUint32(settings.EnablePush),
-		http2.SettingInitialWindowSize: settings.InitialWindowSize,
-		http2.SettingMaxHeaderListSize: settings.MaxHeaderListSize,
+	_, values := settings.SettingsFrame()
+	result := make(map[http2.SettingID]uint32, len(values))
+	for id, v := range values {
+		result[http2.SettingID(id)] = v
 	}
+	return result
 }
 
 // buildHTTP2SettingsOrder creates the settings order based on preset configuration
 func buildHTTP2SettingsOrder(settings fingerprint.HTTP2Settings) []http2.SettingID {
-	// Safari/iOS uses different order than Chrome
-	if settings.NoRFC7540Priorities {
-		// Safari/iOS order: 2, 4, 3, 9
-		return []http2.SettingID{
-			http2.SettingEnablePush,
-			http2.SettingInitialWindowSize,
-			http2.SettingMaxConcurrentStreams,
-			http2.SettingNoRFC7540Priorities,
-		}
-	}
-	// Chrome order: 1, 2, 4, 6
-	return []http2.SettingID{
-		http2.SettingHeaderTableSize,
-		http2.SettingEnablePush,
-		http2.SettingInitialWindowSize,
-		http2.SettingMaxHeaderListSize,
+	order, _ := settings.SettingsFrame()
+	result := make([]http2.SettingID, len(order))
+	for i, id := range order {
+		result[i] = http2.SettingID(id)
 	}
+	return result
 }
@@ -1,3 +1,5 @@
+//go:build !js && !wasip1
+
 package pool
 
 import (
@@ -22,14 +24,6 @@ import (
 	utls "github.com/sardanioss/utls"
 )
 
-// HTTP/3 SETTINGS identifiers (Chrome-like)
-const (
-	settingQPACKMaxTableCapacity = 0x1
-	settingMaxFieldSectionSize   = 0x6
-	settingQPACKBlockedStreams   = 0x7
-	settingH3Datagram            = 0x33
-)
-
 // QUIC Transport Parameter IDs
 const (
 	transportParamVersionInfo  = 0x11   // version_information
@@ -416,14 +410,16 @@ func (p *QUICHostPool) createConn(ctx context.Context) (*QUICConn, error) {
 		MaxIncomingUniStreams:        103, // Chrome uses 103
 		Allow0RTT:                    true,
 		EnableDatagrams:              true,  // Chrome enables QUIC datagrams
-		InitialPacketSize:            1250,  // Chrome uses ~1250
-		DisableClientHelloScrambling: true,  // Chrome doesn't scramble SNI, sends fewer packets
-		ChromeStyleInitialPackets:    true,  // Chrome-like frame patterns in Initial packets
 		ClientHelloID:                 clientHelloID,   // Fallback if cached spec fails
 		CachedClientHelloSpec:         selectedSpec,    // Selected spec (regular or PSK) for fingerprint
 		TransportParameterOrder:       quic.TransportParameterOrderChrome, // Chrome transport param ordering
 		TransportParameterShuffleSeed: p.shuffleSeed, // Consistent transport param shuffle per session
 	}
+	initial := p.preset.QUICInitial()
+	quicConfig.InitialPacketSize = initial.PacketSize
+	quicConfig.ChromeStyleInitialPackets = initial.ChromeFrames
+	quicConfig.DisableClientHelloScrambling = !initial.ScrambleClientHello
+
 	// Only set ECHConfigList if we have a config - matches proxy path behavior
 	// Setting nil explicitly vs not setting at all triggers different behavior in quic-go
 	if len(echConfigList) > 0 {
@@ -444,33 +440,9 @@ func (p *QUICHostPool) createConn(ctx context.Context) (*QUICConn, error) {
 		port = 443
 	}
 
-	// Generate large GREASE setting ID like Chrome (0x1f * N + 0x21 where N is large)
-	greaseSettingN := uint64(1000000000 + rand.Int63n(9000000000))
-	greaseSettingID := 0x1f*greaseSettingN + 0x21
-	// Generate non-zero random 32-bit value (Chrome never sends 0)
-	greaseSettingValue := uint64(1 + rand.Uint32()%(1<<32-1))
-
-	// HTTP/3 QPACK settings - Safari/iOS uses different values than Chrome
-	// Safari/iOS: QPACK_MAX_TABLE_CAPACITY=16383 (0x3fff)
-	// Chrome: QPACK_MAX_TABLE_CAPACITY=65536 (0x10000)
-	qpackMaxTableCapacity := uint64(65536) // Chrome default
-	if p.preset != nil && p.preset.HTTP2Settings.NoRFC7540Priorities {
-		// Safari/iOS uses smaller QPACK table
-		qpackMaxTableCapacity = 16383
-	}
-
-	// HTTP/3 additional settings
-	additionalSettings := map[uint64]uint64{
-		settingQPACKMaxTableCapacity: qpackMaxTableCapacity, // Browser-specific QPACK table capacity
-		settingQPACKBlockedStreams:   100,                   // Both Chrome and Safari use 100
-		greaseSettingID:              greaseSettingValue,    // Random non-zero GREASE value
-	}
-
-	// Add Chrome-specific settings (not sent by Safari/iOS)
-	if p.preset == nil || !p.preset.HTTP2Settings.NoRFC7540Priorities {
-		additionalSettings[settingMaxFieldSectionSize] = 262144 // Chrome's MAX_FIELD_SECTION_SIZE
-		additionalSettings[settingH3Datagram] = 1               // Chrome enables H3_DATAGRAM
-	}
+	// HTTP/3 SETTINGS from the preset
+	h3Settings := p.preset.H3Settings()
+	_, additionalSettings := h3Settings.SettingsFrame()
 
 	// Order IPs based on preference
 	var preferredIPs, fallbackIPs []net.IP
@@ -491,8 +463,8 @@ func (p *QUICHostPool) createConn(ctx context.Context) (*QUICConn, error) {
 		QUICConfig:             quicConfig,
 		EnableDatagrams:        true,       // Chrome enables H3_DATAGRAM
 		AdditionalSettings:     additionalSettings,
-		MaxResponseHeaderBytes: 262144,     // Chrome's MAX_FIELD_SECTION_SIZE (256KB)
-		SendGreaseFrames:       true,       // Chrome sends GREASE frames
+		MaxResponseHeaderBytes: int(h3Settings.MaxFieldSectionSize()),
+		SendGreaseFrames:       h3Settings.GreaseFrames,
 		Dial: func(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (*quic.Conn, error) {
 			// Combine all IPs, preferred first
 			allIPs := append(preferredIPs, fallbackIPs...)
@@ -917,12 +889,3 @@ func (m *QUICManager) Stats() map[string]struct {
 
 	return stats
 }
-
-// generateGREASESettingID generates a valid GREASE setting ID
-// GREASE IDs are of the form 0x1f * N + 0x21 where N is random
-// Chrome uses very large N values, producing setting IDs like 57836956465
-func generateGREASESettingID() uint64 {
-	// Generate large N values similar to Chrome (produces 10-11 digit IDs)
-	n := uint64(1000000000 + rand.Int63n(9000000000))
-	return 0x1f*n + 0x21
-}
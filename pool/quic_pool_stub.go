@@ -0,0 +1,66 @@
+//go:build js || wasip1
+
+package pool
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	http "github.com/sardanioss/http"
+	"github.com/sardanioss/httpcloak/dns"
+	"github.com/sardanioss/httpcloak/fingerprint"
+)
+
+// ErrQUICUnavailable is returned by QUICManager on platforms without UDP sockets
+var ErrQUICUnavailable = errors.New("QUIC is not available on this platform")
+
+// QUICConn represents a persistent QUIC connection. Never produced on this
+// platform.
+type QUICConn struct {
+	Host       string
+	HTTP3RT    http.RoundTripper
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+	UseCount   int64
+}
+
+// QUICManager is a placeholder on platforms without UDP sockets; GetConn
+// always fails so callers fall back to TCP.
+type QUICManager struct {
+	dnsCache *dns.Cache
+}
+
+// NewQUICManager creates a placeholder QUIC manager
+func NewQUICManager(preset *fingerprint.Preset, dnsCache *dns.Cache) *QUICManager {
+	return &QUICManager{dnsCache: dnsCache}
+}
+
+func (m *QUICManager) SetMaxConnsPerHost(max int)                   {}
+func (m *QUICManager) SetConnectTo(requestHost, connectHost string) {}
+func (m *QUICManager) SetECHConfig(echConfig []byte)                {}
+func (m *QUICManager) SetECHConfigDomain(domain string)             {}
+func (m *QUICManager) SetDisableECH(disable bool)                   {}
+func (m *QUICManager) SetInsecureSkipVerify(skip bool)              {}
+func (m *QUICManager) SetLocalAddr(addr string)                     {}
+func (m *QUICManager) Close()                                       {}
+func (m *QUICManager) CloseAllConnections()                         {}
+func (m *QUICManager) CloseAllPools()                               {}
+
+// GetConn always fails with ErrQUICUnavailable
+func (m *QUICManager) GetConn(ctx context.Context, host, port string) (*QUICConn, error) {
+	return nil, ErrQUICUnavailable
+}
+
+// Stats returns overall manager statistics (always empty)
+func (m *QUICManager) Stats() map[string]struct {
+	Total    int
+	Healthy  int
+	Requests int64
+} {
+	return map[string]struct {
+		Total    int
+		Healthy  int
+		Requests int64
+	}{}
+}
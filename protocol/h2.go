@@ -0,0 +1,151 @@
+package protocol
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// H2Fingerprint describes what a client sends when it opens an HTTP/2
+// connection: the fields hashed into an Akamai HTTP/2 fingerprint
+// ("SETTINGS|WINDOW_UPDATE|PRIORITY|PSEUDO_HEADER_ORDER").
+type H2Fingerprint struct {
+	// SETTINGS parameters in the order they are sent
+	Settings []H2Setting `json:"settings"`
+
+	// Connection-level WINDOW_UPDATE increment (0 = none sent)
+	WindowUpdate uint32 `json:"windowUpdate,omitempty"`
+
+	// PRIORITY frames sent after the preface
+	Priorities []H2Priority `json:"priorities,omitempty"`
+
+	// Pseudo-header order, e.g. [":method", ":authority", ":scheme", ":path"].
+	// Empty keeps the preset's order.
+	PseudoHeaderOrder []string `json:"pseudoHeaderOrder,omitempty"`
+}
+
+// H2Setting is one SETTINGS parameter
+type H2Setting struct {
+	ID    uint16 `json:"id"`
+	Value uint32 `json:"value"`
+}
+
+// H2Priority is one PRIORITY frame. Weight is 1-256 as in Akamai
+// fingerprints (the frame carries Weight-1).
+type H2Priority struct {
+	StreamID  uint32 `json:"streamId"`
+	Exclusive bool   `json:"exclusive,omitempty"`
+	DependsOn uint32 `json:"dependsOn,omitempty"`
+	Weight    uint16 `json:"weight"`
+}
+
+var pseudoHeaderLetters = map[string]string{
+	"m": ":method",
+	"a": ":authority",
+	"s": ":scheme",
+	"p": ":path",
+}
+
+// ParseAkamaiH2 parses an Akamai HTTP/2 fingerprint such as
+// "1:65536;2:0;4:6291456;6:262144|15663105|0|m,a,s,p".
+// SETTINGS may be separated by ';' or ','; a PRIORITY field of "0" means none.
+func ParseAkamaiH2(s string) (*H2Fingerprint, error) {
+	parts := strings.Split(strings.TrimSpace(s), "|")
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("akamai h2: expected 4 '|'-separated fields, got %d", len(parts))
+	}
+	fp := &H2Fingerprint{}
+
+	for _, kv := range strings.FieldsFunc(parts[0], func(r rune) bool { return r == ';' || r == ',' }) {
+		id, value, ok := strings.Cut(kv, ":")
+		if !ok {
+			return nil, fmt.Errorf("akamai h2: invalid setting %q", kv)
+		}
+		i, err := strconv.ParseUint(id, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("akamai h2: invalid setting id %q", id)
+		}
+		v, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("akamai h2: invalid setting value %q", value)
+		}
+		fp.Settings = append(fp.Settings, H2Setting{ID: uint16(i), Value: uint32(v)})
+	}
+
+	if parts[1] != "" {
+		w, err := strconv.ParseUint(parts[1], 10, 31)
+		if err != nil {
+			return nil, fmt.Errorf("akamai h2: invalid window update %q", parts[1])
+		}
+		fp.WindowUpdate = uint32(w)
+	}
+
+	if parts[2] != "" && parts[2] != "0" {
+		for _, frame := range strings.Split(parts[2], ",") {
+			f := strings.Split(frame, ":")
+			if len(f) != 4 {
+				return nil, fmt.Errorf("akamai h2: invalid priority %q", frame)
+			}
+			var n [4]uint64
+			for i, field := range f {
+				v, err := strconv.ParseUint(field, 10, 31)
+				if err != nil {
+					return nil, fmt.Errorf("akamai h2: invalid priority %q", frame)
+				}
+				n[i] = v
+			}
+			if n[1] > 1 || n[3] < 1 || n[3] > 256 {
+				return nil, fmt.Errorf("akamai h2: invalid priority %q", frame)
+			}
+			fp.Priorities = append(fp.Priorities, H2Priority{
+				StreamID:  uint32(n[0]),
+				Exclusive: n[1] == 1,
+				DependsOn: uint32(n[2]),
+				Weight:    uint16(n[3]),
+			})
+		}
+	}
+
+	if parts[3] != "" {
+		for _, letter := range strings.Split(parts[3], ",") {
+			name, ok := pseudoHeaderLetters[letter]
+			if !ok {
+				return nil, fmt.Errorf("akamai h2: invalid pseudo-header %q", letter)
+			}
+			fp.PseudoHeaderOrder = append(fp.PseudoHeaderOrder, name)
+		}
+	}
+
+	return fp, nil
+}
+
+// String formats the fingerprint in Akamai notation
+func (fp *H2Fingerprint) String() string {
+	settings := make([]string, len(fp.Settings))
+	for i, s := range fp.Settings {
+		settings[i] = fmt.Sprintf("%d:%d", s.ID, s.Value)
+	}
+
+	priorities := "0"
+	if len(fp.Priorities) > 0 {
+		frames := make([]string, len(fp.Priorities))
+		for i, p := range fp.Priorities {
+			exclusive := 0
+			if p.Exclusive {
+				exclusive = 1
+			}
+			frames[i] = fmt.Sprintf("%d:%d:%d:%d", p.StreamID, exclusive, p.DependsOn, p.Weight)
+		}
+		priorities = strings.Join(frames, ",")
+	}
+
+	pseudo := make([]string, 0, len(fp.PseudoHeaderOrder))
+	for _, h := range fp.PseudoHeaderOrder {
+		if name := strings.TrimPrefix(h, ":"); name != "" {
+			pseudo = append(pseudo, name[:1])
+		}
+	}
+
+	return strings.Join(settings, ";") + "|" + strconv.FormatUint(uint64(fp.WindowUpdate), 10) +
+		"|" + priorities + "|" + strings.Join(pseudo, ",")
+}
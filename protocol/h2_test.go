@@ -0,0 +1,39 @@
+package protocol
+
+import "testing"
+
+func TestParseAkamaiH2(t *testing.T) {
+	tests := []string{
+		"1:65536;2:0;4:6291456;6:262144|15663105|0|m,a,s,p",
+		"1:65536;4:131072;5:16384|12517377|3:0:0:201,5:0:0:101,7:0:0:1,9:0:7:1,11:0:3:1,13:0:0:241|m,p,a,s",
+		"2:0;3:100;4:2097152;8:1;9:1|10420225|0|m,s,a,p",
+	}
+	for _, s := range tests {
+		fp, err := ParseAkamaiH2(s)
+		if err != nil {
+			t.Fatalf("ParseAkamaiH2(%q): %v", s, err)
+		}
+		if got := fp.String(); got != s {
+			t.Errorf("round trip: got %q, want %q", got, s)
+		}
+	}
+
+	fp, _ := ParseAkamaiH2(tests[1])
+	if len(fp.Priorities) != 6 || fp.Priorities[3] != (H2Priority{StreamID: 9, DependsOn: 7, Weight: 1}) {
+		t.Errorf("unexpected priorities %+v", fp.Priorities)
+	}
+	if fp.PseudoHeaderOrder[1] != ":path" {
+		t.Errorf("pseudo-header order = %v", fp.PseudoHeaderOrder)
+	}
+
+	for _, s := range []string{
+		"1:65536|0|m,a,s,p",
+		"1=65536|0|0|m,a,s,p",
+		"1:65536|0|3:0:0:0|m,a,s,p",
+		"1:65536|0|0|m,x",
+	} {
+		if _, err := ParseAkamaiH2(s); err == nil {
+			t.Errorf("ParseAkamaiH2(%q) succeeded, want error", s)
+		}
+	}
+}
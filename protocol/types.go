@@ -5,6 +5,11 @@
 // Each message is a single JSON object followed by a newline.
 package protocol
 
+import (
+	"maps"
+	"slices"
+)
+
 // MessageType represents the type of IPC message
 type MessageType string
 
@@ -128,6 +133,22 @@ type SessionCreateRequest struct {
 	Options *SessionConfig `json:"options,omitempty"`
 }
 
+// HeaderRule limits the headers sent to some hosts, e.g. never sending
+// Referer to a tracker. It applies to the finished request, preset headers
+// included.
+type HeaderRule struct {
+	// Hosts the rule covers. "example.com" includes its subdomains; "*"
+	// matches every host.
+	Hosts []string `json:"hosts"`
+
+	// Strip lists headers never sent to these hosts
+	Strip []string `json:"strip,omitempty"`
+
+	// Allow, if set, lists the only headers sent to these hosts; all others
+	// are removed
+	Allow []string `json:"allow,omitempty"`
+}
+
 // SessionConfig contains session configuration
 type SessionConfig struct {
 	// Browser fingerprint preset (e.g., "chrome-143", "firefox-133")
@@ -151,8 +172,19 @@ type SessionConfig struct {
 	Timeout int `json:"timeout,omitempty"`
 
 	// Redirect behavior
-	FollowRedirects bool `json:"followRedirects,omitempty"`
-	MaxRedirects    int  `json:"maxRedirects,omitempty"`
+	FollowRedirects bool   `json:"followRedirects,omitempty"`
+	MaxRedirects    int    `json:"maxRedirects,omitempty"`
+	RedirectMethods string `json:"redirectMethods,omitempty"` // "browser" (default), "preserve", "get"
+
+	// PreconnectRedirects starts DNS and the connection to a redirect's
+	// target as soon as the redirect arrives, while the session processes it
+	PreconnectRedirects bool `json:"preconnectRedirects,omitempty"`
+
+	// Authorization, Cookie and the headers in RedirectCredentialHeaders are
+	// dropped when a redirect leaves the origin, unless
+	// KeepRedirectCredentials is set (curl's --location-trusted)
+	RedirectCredentialHeaders []string `json:"redirectCredentialHeaders,omitempty"`
+	KeepRedirectCredentials   bool     `json:"keepRedirectCredentials,omitempty"`
 
 	// Retry configuration
 	RetryEnabled  bool  `json:"retryEnabled,omitempty"`
@@ -161,6 +193,33 @@ type SessionConfig struct {
 	RetryWaitMax  int   `json:"retryWaitMax,omitempty"`  // Milliseconds
 	RetryOnStatus []int `json:"retryOnStatus,omitempty"` // Status codes to retry
 
+	// Hedging: if no response arrives within HedgeDelay, send a duplicate on
+	// another connection and use whichever answers first (0 = disabled)
+	HedgeDelay      int  `json:"hedgeDelay,omitempty"`      // Milliseconds
+	HedgeAllMethods bool `json:"hedgeAllMethods,omitempty"` // Also hedge non-idempotent methods (POST, PATCH)
+
+	// BehaviorSeed seeds the session's timing profile (see
+	// session.BehaviorClock). 0 picks a random seed, which is then stored
+	// here so a saved session keeps its profile.
+	BehaviorSeed int64 `json:"behaviorSeed,omitempty"`
+
+	// IdentityKey names the logical client this session plays, e.g. an
+	// account ID. The TLS and QUIC extension order, the HTTP/3 GREASE
+	// setting and, unless BehaviorSeed is set, the timing profile are
+	// derived from it, so the identity presents the same way from any
+	// process. "" keeps them random.
+	IdentityKey string `json:"identityKey,omitempty"`
+
+	// RequestGap is the typical pause between the session's requests in
+	// milliseconds, scaled and varied by its timing profile. 0 sends
+	// requests as soon as they are made.
+	RequestGap int `json:"requestGap,omitempty"`
+
+	// DisableConditional stops the session revalidating URLs it fetched
+	// before with If-None-Match/If-Modified-Since, and serving the cached
+	// body when the server answers 304
+	DisableConditional bool `json:"disableConditional,omitempty"`
+
 	// TLS options
 	InsecureSkipVerify bool `json:"insecureSkipVerify,omitempty"`
 
@@ -189,6 +248,13 @@ type SessionConfig struct {
 	// Connections are closed after this duration of inactivity
 	QuicIdleTimeout int `json:"quicIdleTimeout,omitempty"`
 
+	// Connection pool tuning; zero keeps the default (see transport.PoolConfig).
+	// Timeouts are in seconds.
+	MaxIdleConnsPerHost int `json:"maxIdleConnsPerHost,omitempty"`
+	MaxConnsPerHost     int `json:"maxConnsPerHost,omitempty"`
+	IdleConnTimeout     int `json:"idleConnTimeout,omitempty"`
+	MaxConnLifetime     int `json:"maxConnLifetime,omitempty"`
+
 	// KeyLogFile is the path to write TLS key log for Wireshark decryption.
 	// If set, overrides the global SSLKEYLOGFILE environment variable for this session.
 	KeyLogFile string `json:"keyLogFile,omitempty"`
@@ -197,12 +263,73 @@ type SessionConfig struct {
 	// ECH adds ~15-20ms to first connection but provides extra privacy
 	DisableECH bool `json:"disableEch,omitempty"`
 
+	// StrictMode turns impersonation off: requests go out as a plain client
+	// sends them, with the same cookies and egress (see Session.SetStrictMode)
+	StrictMode bool `json:"strictMode,omitempty"`
+
+	// CookieTrace records on each response which cookies the jar sent for
+	// the request and why it left others out (see Session.SetCookieTrace)
+	CookieTrace bool `json:"cookieTrace,omitempty"`
+
+	// DNSServers are queried directly ("host" or "host:port") instead of the
+	// system resolver, so cached addresses expire with their records' TTLs
+	DNSServers []string `json:"dnsServers,omitempty"`
+
+	// PersistDNS saves resolved addresses (and hosts that didn't resolve)
+	// with the session state, so a restored session connects to the same
+	// endpoints until their TTLs run out
+	PersistDNS bool `json:"persistDns,omitempty"`
+
+	// StampBuild records the httpcloak build (preset database, utls and
+	// quic-go versions) in the saved session state. Off by default, since
+	// it reveals which library wrote the file; a restored session can skip
+	// checking its TLS tickets when the build is unchanged.
+	StampBuild bool `json:"stampBuild,omitempty"`
+
+	// HeaderRules remove headers from requests to particular hosts (see
+	// HeaderRule)
+	HeaderRules []HeaderRule `json:"headerRules,omitempty"`
+
+	// AllowedHosts, if set, are the only hosts requests, redirects and
+	// warmup subresources may go to; BlockedHosts are never requested.
+	// Patterns match like HeaderRule hosts.
+	AllowedHosts []string `json:"allowedHosts,omitempty"`
+	BlockedHosts []string `json:"blockedHosts,omitempty"`
+
+	// ProtocolPolicy forces a protocol ("h1", "h2", "h3" or "auto") for
+	// hosts matching its patterns, which match like HeaderRule hosts; the
+	// most specific pattern wins. Other hosts use the session's protocol.
+	ProtocolPolicy map[string]string `json:"protocolPolicy,omitempty"`
+
+	// H3FailureBackoff is how long auto mode skips HTTP/3 for an origin
+	// after it failed there, in milliseconds. 0 uses the default (5
+	// minutes); negative tries HTTP/3 again on every request.
+	H3FailureBackoff int `json:"h3FailureBackoff,omitempty"`
+
+	// RawBody returns response bodies without decoding Content-Encoding
+	// (gzip, br, zstd, deflate). Accept-Encoding is still sent.
+	RawBody bool `json:"rawBody,omitempty"`
+
+	// DrainLimit is how many unread body bytes closing a response drains so
+	// its connection can be reused. 0 uses the default (256KB); negative
+	// never drains.
+	DrainLimit int64 `json:"drainLimit,omitempty"`
+
 	// DisableSpeculativeTLS disables the speculative TLS optimization for proxy connections.
 	// When false (default), CONNECT request and TLS ClientHello are sent together,
 	// saving one round-trip (~25% faster proxy connections). Set to true if you
 	// experience issues with certain proxies.
 	DisableSpeculativeTLS bool `json:"disableSpeculativeTls,omitempty"`
 
+	// DisableLatencyPinning stops auto mode from pinning an origin to HTTP/2
+	// when its HTTP/3 is consistently slower
+	DisableLatencyPinning bool `json:"disableLatencyPinning,omitempty"`
+
+	// SSRFProtection refuses requests, redirects included, to hosts
+	// resolving to internal addresses (loopback, private, link-local, cloud
+	// metadata)
+	SSRFProtection bool `json:"ssrfProtection,omitempty"`
+
 	// SwitchProtocol is the protocol to switch to after Refresh().
 	// Valid values: "h1", "h2", "h3", "" (no switch).
 	// When set, Refresh() will close connections and switch to this protocol,
@@ -210,10 +337,52 @@ type SessionConfig struct {
 	// with TLS session resumption.
 	SwitchProtocol string `json:"switchProtocol,omitempty"`
 
+	// TLSTicketIsolation controls TLS session ticket reuse across egress paths.
+	// "egress" (default): tickets are partitioned per proxy/local address, so a
+	// ticket issued through one proxy is never presented through another.
+	// "shared": tickets are keyed by origin only and reused across proxies.
+	TLSTicketIsolation string `json:"tlsTicketIsolation,omitempty"`
+
+	// DuplicateHeaders is how GetHeader reads a response header sent more
+	// than once: "first" (default), "merge" (joined with ", ", never
+	// Set-Cookie) or "last". Headers always keeps every line.
+	DuplicateHeaders string `json:"duplicateHeaders,omitempty"`
+
 	// Default authentication (can be overridden per-request)
 	Auth *AuthConfig `json:"auth,omitempty"`
 }
 
+// Clone returns a deep copy of c: its maps, slices and Auth are copied
+// rather than shared
+func (c *SessionConfig) Clone() *SessionConfig {
+	if c == nil {
+		return nil
+	}
+	cp := *c
+	cp.RedirectCredentialHeaders = slices.Clone(c.RedirectCredentialHeaders)
+	cp.RetryOnStatus = slices.Clone(c.RetryOnStatus)
+	cp.ConnectTo = maps.Clone(c.ConnectTo)
+	cp.DNSServers = slices.Clone(c.DNSServers)
+	cp.AllowedHosts = slices.Clone(c.AllowedHosts)
+	cp.BlockedHosts = slices.Clone(c.BlockedHosts)
+	cp.ProtocolPolicy = maps.Clone(c.ProtocolPolicy)
+	if c.HeaderRules != nil {
+		cp.HeaderRules = make([]HeaderRule, len(c.HeaderRules))
+		for i, rule := range c.HeaderRules {
+			cp.HeaderRules[i] = HeaderRule{
+				Hosts: slices.Clone(rule.Hosts),
+				Strip: slices.Clone(rule.Strip),
+				Allow: slices.Clone(rule.Allow),
+			}
+		}
+	}
+	if c.Auth != nil {
+		auth := *c.Auth
+		cp.Auth = &auth
+	}
+	return &cp
+}
+
 // SessionCreateResponse contains the created session info
 type SessionCreateResponse struct {
 	ID      string      `json:"id"`
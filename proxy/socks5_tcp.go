@@ -284,3 +284,14 @@ func IsSOCKS5URL(proxyURL string) bool {
 	}
 	return parsed.Scheme == "socks5" || parsed.Scheme == "socks5h"
 }
+
+// IsRemoteDNSURL checks if the URL is a socks5h proxy URL. Target hostnames
+// are always sent to SOCKS5 proxies unresolved; socks5h additionally rules
+// out local lookups made for the target, such as ECH (HTTPS record) fetches.
+func IsRemoteDNSURL(proxyURL string) bool {
+	parsed, err := url.Parse(proxyURL)
+	if err != nil {
+		return false
+	}
+	return parsed.Scheme == "socks5h"
+}
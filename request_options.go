@@ -0,0 +1,190 @@
+package httpcloak
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/sardanioss/httpcloak/transport"
+)
+
+// RequestOption sets part of a request built by NewRequest, Get or Send
+type RequestOption func(*Request) error
+
+// NewRequest builds a request from options:
+//
+//	req, err := httpcloak.NewRequest("POST", "https://api.example.com/items",
+//		httpcloak.WithHeader("X-Api-Key", key),
+//		httpcloak.WithJSONBody(item),
+//		httpcloak.WithRequestTimeout(5*time.Second))
+func NewRequest(method, url string, opts ...RequestOption) (*Request, error) {
+	req := &Request{Method: method, URL: url}
+	for _, opt := range opts {
+		if err := opt(req); err != nil {
+			return nil, err
+		}
+	}
+	return req, nil
+}
+
+// WithHeader adds a value to a request header
+func WithHeader(key, value string) RequestOption {
+	return func(r *Request) error {
+		if r.Headers == nil {
+			r.Headers = make(map[string][]string)
+		}
+		r.Headers[key] = append(r.Headers[key], value)
+		return nil
+	}
+}
+
+// WithHeaders adds every value of headers to the request's
+func WithHeaders(headers map[string][]string) RequestOption {
+	return func(r *Request) error {
+		if r.Headers == nil {
+			r.Headers = make(map[string][]string, len(headers))
+		}
+		for key, values := range headers {
+			r.Headers[key] = append(r.Headers[key], values...)
+		}
+		return nil
+	}
+}
+
+// WithQuery adds a query parameter to the request URL
+func WithQuery(key, value string) RequestOption {
+	return func(r *Request) error {
+		u, err := url.Parse(r.URL)
+		if err != nil {
+			return err
+		}
+		q := u.Query()
+		q.Add(key, value)
+		u.RawQuery = q.Encode()
+		r.URL = u.String()
+		return nil
+	}
+}
+
+// WithBody sends body, streamed, with the given Content-Type ("" for none).
+// It can only be sent once; retries and 307/308 redirects need a
+// replayable body (WithBytesBody).
+func WithBody(body io.Reader, contentType string) RequestOption {
+	return func(r *Request) error {
+		r.Body, r.BodySource = body, nil
+		return setContentType(r, contentType)
+	}
+}
+
+// WithBytesBody sends body, replayable, with the given Content-Type
+func WithBytesBody(body []byte, contentType string) RequestOption {
+	return func(r *Request) error {
+		r.Body, r.BodySource = nil, transport.BytesBody(body)
+		return setContentType(r, contentType)
+	}
+}
+
+// WithJSONBody sends v encoded as JSON
+func WithJSONBody(v any) RequestOption {
+	return func(r *Request) error {
+		body, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("json body: %w", err)
+		}
+		return WithBytesBody(body, "application/json")(r)
+	}
+}
+
+// WithFormBody sends form url-encoded
+func WithFormBody(form url.Values) RequestOption {
+	return WithBytesBody([]byte(form.Encode()), "application/x-www-form-urlencoded")
+}
+
+// WithRequestTimeout bounds the whole request, body included
+func WithRequestTimeout(d time.Duration) RequestOption {
+	return func(r *Request) error {
+		r.Timeout = d
+		return nil
+	}
+}
+
+// WithStreamedBody leaves the response body on the connection, to be read
+// with Response.BodyReader or SaveTo as it arrives (see Request.Stream)
+func WithStreamedBody() RequestOption {
+	return func(r *Request) error {
+		r.Stream = true
+		return nil
+	}
+}
+
+// WithMaxBodySize fails the request once the response body is over n bytes
+func WithMaxBodySize(n int64) RequestOption {
+	return func(r *Request) error {
+		r.MaxBodySize = n
+		return nil
+	}
+}
+
+// WithNoRedirect returns redirect responses as they are instead of
+// following them
+func WithNoRedirect() RequestOption {
+	return func(r *Request) error {
+		follow := false
+		if r.Redirect == nil {
+			r.Redirect = &RedirectPolicy{}
+		}
+		r.Redirect.Follow = &follow
+		return nil
+	}
+}
+
+// WithMeta attaches caller metadata to the request (see Request.Meta)
+func WithMeta(key string, value any) RequestOption {
+	return func(r *Request) error {
+		if r.Meta == nil {
+			r.Meta = make(map[string]any)
+		}
+		r.Meta[key] = value
+		return nil
+	}
+}
+
+// setContentType replaces the request's Content-Type, unless contentType is
+// empty
+func setContentType(r *Request, contentType string) error {
+	if contentType == "" {
+		return nil
+	}
+	if r.Headers == nil {
+		r.Headers = make(map[string][]string)
+	}
+	for key := range r.Headers {
+		if strings.EqualFold(key, "Content-Type") {
+			delete(r.Headers, key)
+		}
+	}
+	r.Headers["Content-Type"] = []string{contentType}
+	return nil
+}
+
+// Send builds a request from options and executes it
+func (c *Client) Send(ctx context.Context, method, url string, opts ...RequestOption) (*Response, error) {
+	req, err := NewRequest(method, url, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return c.Do(ctx, req)
+}
+
+// Send builds a request from options and executes it within the session
+func (s *Session) Send(ctx context.Context, method, url string, opts ...RequestOption) (*Response, error) {
+	req, err := NewRequest(method, url, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return s.Do(ctx, req)
+}
@@ -0,0 +1,169 @@
+package httpcloak
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sardanioss/httpcloak/client"
+)
+
+// newTestTLSClient returns a Client that trusts httptest's TLS servers (it
+// only speaks HTTPS)
+func newTestTLSClient(t *testing.T) *Client {
+	t.Helper()
+	c := &Client{
+		inner:   client.NewClient("chrome-143", client.WithInsecureSkipVerify(), client.WithForceHTTP1()),
+		timeout: 30 * time.Second,
+	}
+	t.Cleanup(c.Close)
+	return c
+}
+
+func TestWithQueryKeepsQuery(t *testing.T) {
+	req, err := NewRequest("GET", "https://example.com/search?q=go&page=2#top", WithQuery("q", "cloak"), WithQuery("lang", "en"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(req.URL)
+	if got := u.Query(); strings.Join(got["q"], ",") != "go,cloak" || got.Get("page") != "2" || got.Get("lang") != "en" {
+		t.Errorf("query = %v", got)
+	}
+	if u.Fragment != "top" {
+		t.Errorf("fragment lost: %s", req.URL)
+	}
+}
+
+func TestBodyOptionReplacesContentType(t *testing.T) {
+	req, err := NewRequest("POST", "https://example.com",
+		WithHeader("content-type", "text/plain"),
+		WithJSONBody(map[string]int{"a": 1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(req.Headers) != 1 || strings.Join(req.Headers["Content-Type"], ",") != "application/json" {
+		t.Errorf("headers = %v", req.Headers)
+	}
+
+	// An empty type leaves the header alone
+	req, _ = NewRequest("POST", "https://example.com", WithHeader("Content-Type", "text/csv"), WithBody(strings.NewReader("a,b"), ""))
+	if got := req.Headers["Content-Type"]; len(got) != 1 || got[0] != "text/csv" {
+		t.Errorf("Content-Type = %v", got)
+	}
+}
+
+func TestWithNoRedirect(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			http.Redirect(w, r, "/next", http.StatusFound)
+		}
+	}))
+	defer srv.Close()
+
+	c := newTestTLSClient(t)
+	resp, err := c.Get(context.Background(), srv.URL, WithNoRedirect())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusFound {
+		t.Errorf("Client status = %d, want the 302 itself", resp.StatusCode)
+	}
+
+	s := NewSession("chrome-143", WithForceHTTP1(), WithInsecureSkipVerify())
+	defer s.Close()
+	if resp, err = s.Get(context.Background(), srv.URL, WithNoRedirect()); err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusFound {
+		t.Errorf("Session status = %d, want the 302 itself", resp.StatusCode)
+	}
+}
+
+func TestWithRequestTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	s := NewSession("chrome-143", WithForceHTTP1())
+	defer s.Close()
+	start := time.Now()
+	if _, err := s.Get(context.Background(), srv.URL, WithRequestTimeout(100*time.Millisecond)); err == nil {
+		t.Fatal("request outlived its timeout")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("timeout took %v", elapsed)
+	}
+}
+
+func TestBytesBodyReplayedOn307(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			io.Copy(io.Discard, r.Body)
+			http.Redirect(w, r, "/upload", http.StatusTemporaryRedirect)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		w.Write([]byte(r.Method + " " + r.Header.Get("Content-Type") + " " + string(body)))
+	}))
+	defer srv.Close()
+
+	want := `POST application/json {"id":7}`
+	c := newTestTLSClient(t)
+	resp, err := c.Send(context.Background(), "POST", srv.URL, WithJSONBody(map[string]int{"id": 7}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := resp.Text(); body != want {
+		t.Errorf("Client: redirect target got %q, want %q", body, want)
+	}
+
+	s := NewSession("chrome-143", WithForceHTTP1(), WithInsecureSkipVerify(), WithRedirects(true, 5))
+	defer s.Close()
+	if resp, err = s.Send(context.Background(), "POST", srv.URL, WithJSONBody(map[string]int{"id": 7})); err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := resp.Text(); body != want {
+		t.Errorf("Session: redirect target got %q, want %q", body, want)
+	}
+}
+
+func TestClientRequestMeta(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			http.Redirect(w, r, "/next", http.StatusFound)
+		}
+	}))
+	defer srv.Close()
+
+	c := newTestTLSClient(t)
+	var hopMeta map[string]any
+	resp, err := c.Get(context.Background(), srv.URL,
+		WithMeta("job", 42),
+		func(r *Request) error {
+			r.Redirect = &RedirectPolicy{OnRedirect: func(hop *RedirectHop) error {
+				hopMeta = hop.Meta
+				return nil
+			}}
+			return nil
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hopMeta["job"] != 42 {
+		t.Errorf("RedirectHop.Meta = %v", hopMeta)
+	}
+	if resp.Meta["job"] != 42 {
+		t.Errorf("Response.Meta = %v", resp.Meta)
+	}
+}
@@ -0,0 +1,188 @@
+package httpcloak
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sardanioss/httpcloak/transport"
+)
+
+// Transport is an http.RoundTripper that sends requests through a Session,
+// so code built on net/http, third-party SDKs included, gets the session's
+// fingerprint, cookies and connections by swapping in the transport:
+//
+//	client := &http.Client{Transport: httpcloak.NewTransport(session)}
+//
+// Like any RoundTripper it doesn't follow redirects; http.Client does.
+// Request.Host, if set, is sent as the Host (or :authority) while the
+// connection goes to the URL's host.
+// Bodies stream both ways, the request's context cancels it, and response
+// trailers are filled in when the body is read to EOF. Compressed bodies
+// arrive decoded, with Response.Uncompressed set.
+type Transport struct {
+	session *Session
+}
+
+// NewTransport returns a RoundTripper backed by s
+func NewTransport(s *Session) *Transport {
+	return &Transport{session: s}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL == nil {
+		closeRequestBody(req)
+		return nil, errors.New("httpcloak: nil Request.URL")
+	}
+	headers := make(map[string][]string, len(req.Header)+1)
+	for key, values := range req.Header {
+		headers[key] = values
+	}
+
+	hcReq := &Request{
+		Method:  req.Method,
+		URL:     req.URL.String(),
+		Headers: headers,
+	}
+	if req.Host != "" && req.Host != req.URL.Host {
+		hcReq.Host = req.Host
+	}
+	if req.Body != nil && req.Body != http.NoBody {
+		if req.GetBody != nil && req.ContentLength > 0 {
+			// Replayable, so HTTP/2 can resend it after a GOAWAY
+			req.Body.Close()
+			hcReq.BodySource = transport.FuncBody(req.GetBody, req.ContentLength)
+		} else {
+			hcReq.Body = req.Body
+			if req.ContentLength > 0 {
+				headers["Content-Length"] = []string{fmt.Sprint(req.ContentLength)}
+			}
+		}
+	}
+
+	resp, err := t.session.DoStream(req.Context(), hcReq)
+	if err != nil {
+		closeRequestBody(req)
+		if ctxErr := contextError(req.Context(), err); ctxErr != nil {
+			return nil, ctxErr // As net/http reports it
+		}
+		return nil, err
+	}
+	return newHTTPResponse(req, resp), nil
+}
+
+// newHTTPResponse translates a streamed response to net/http's
+func newHTTPResponse(req *http.Request, resp *StreamResponse) *http.Response {
+	header := make(http.Header, len(resp.Headers))
+	for key, values := range resp.Headers {
+		header[http.CanonicalHeaderKey(key)] = values
+	}
+
+	httpResp := &http.Response{
+		Status:        fmt.Sprintf("%d %s", resp.StatusCode, http.StatusText(resp.StatusCode)),
+		StatusCode:    resp.StatusCode,
+		Header:        header,
+		ContentLength: resp.ContentLength,
+		Request:       req,
+	}
+	switch resp.Protocol {
+	case "h2":
+		httpResp.Proto, httpResp.ProtoMajor = "HTTP/2.0", 2
+	case "h3":
+		httpResp.Proto, httpResp.ProtoMajor = "HTTP/3.0", 3
+	default:
+		httpResp.Proto, httpResp.ProtoMajor, httpResp.ProtoMinor = "HTTP/1.1", 1, 1
+	}
+	if resp.inner.Decompressed {
+		header.Del("Content-Encoding")
+		header.Del("Content-Length")
+		httpResp.ContentLength = -1
+		httpResp.Uncompressed = true
+	}
+
+	// Announced trailers are listed with no value until the body ends
+	httpResp.Trailer = make(http.Header)
+	for key := range resp.Trailers() {
+		httpResp.Trailer[http.CanonicalHeaderKey(key)] = nil
+	}
+	for _, value := range header.Values("Trailer") {
+		for _, key := range strings.Split(value, ",") {
+			if key = strings.TrimSpace(key); key != "" {
+				httpResp.Trailer[http.CanonicalHeaderKey(key)] = nil
+			}
+		}
+	}
+	header.Del("Trailer")
+	body := &trailerBody{StreamResponse: resp, trailer: httpResp.Trailer, ctx: req.Context()}
+	// Cancelling the request aborts reading the body too
+	body.stop = context.AfterFunc(body.ctx, func() { resp.Close() })
+	httpResp.Body = body
+	return httpResp
+}
+
+// trailerBody copies the trailers into the Response once the body is read
+// to EOF
+type trailerBody struct {
+	*StreamResponse
+	trailer http.Header
+	ctx     context.Context
+	stop    func() bool
+}
+
+func (b *trailerBody) Read(p []byte) (int, error) {
+	n, err := b.StreamResponse.Read(p)
+	if err == io.EOF {
+		for key, values := range b.Trailers() {
+			b.trailer[http.CanonicalHeaderKey(key)] = values
+		}
+	} else if err != nil && b.ctx.Err() != nil {
+		err = b.ctx.Err()
+	}
+	return n, err
+}
+
+func (b *trailerBody) Close() error {
+	b.stop()
+	return b.StreamResponse.Close()
+}
+
+// contextDeadlineSlack is how long before its context's deadline an i/o
+// timeout is still put down to the context
+const contextDeadlineSlack = 100 * time.Millisecond
+
+// contextError returns ctx's error if it is what made a request fail with
+// err. The context's deadline is also set on the connection, which can time
+// out a moment before the context itself reports it; such a timeout waits
+// for the context to catch up.
+func contextError(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	var netErr net.Error
+	deadline, ok := ctx.Deadline()
+	if !ok || !errors.As(err, &netErr) || !netErr.Timeout() || time.Until(deadline) > contextDeadlineSlack {
+		return nil
+	}
+	timer := time.NewTimer(time.Until(deadline) + contextDeadlineSlack)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// closeRequestBody closes the body of a request that wasn't sent, as a
+// RoundTripper must
+func closeRequestBody(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+}
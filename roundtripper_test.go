@@ -0,0 +1,178 @@
+package httpcloak
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestClient(t *testing.T) *http.Client {
+	t.Helper()
+	s := NewSession("chrome-143", WithForceHTTP1())
+	t.Cleanup(s.Close)
+	return &http.Client{Transport: NewTransport(s)}
+}
+
+func TestTransportStreamsRequestBody(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Write([]byte(strconv.Itoa(len(body)) + " " + strings.Join(r.TransferEncoding, ",")))
+	}))
+	defer srv.Close()
+
+	pr, pw := io.Pipe()
+	go func() {
+		for range 4 {
+			pw.Write(bytes.Repeat([]byte("x"), 1000))
+			time.Sleep(5 * time.Millisecond)
+		}
+		pw.Close()
+	}()
+	req, _ := http.NewRequest("POST", srv.URL, pr) // Unknown length
+	resp, err := newTestClient(t).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if got, _ := io.ReadAll(resp.Body); string(got) != "4000 chunked" {
+		t.Errorf("server got %q, want 4000 chunked bytes", got)
+	}
+}
+
+func TestTransportTrailers(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Trailer", "X-Checksum")
+		w.Write([]byte("body"))
+		w.Header().Set("X-Checksum", "abc123")
+	}))
+	defer srv.Close()
+
+	resp, err := newTestClient(t).Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if _, ok := resp.Trailer["X-Checksum"]; !ok {
+		t.Fatalf("announced trailer missing before EOF: %v", resp.Trailer)
+	}
+	if body, _ := io.ReadAll(resp.Body); string(body) != "body" {
+		t.Errorf("body = %q", body)
+	}
+	if got := resp.Trailer.Get("X-Checksum"); got != "abc123" {
+		t.Errorf("trailer after EOF = %q, want abc123", got)
+	}
+}
+
+func TestTransportDecompresses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write([]byte("hello, gzip"))
+		zw.Close()
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+		w.Write(buf.Bytes())
+	}))
+	defer srv.Close()
+
+	resp, err := newTestClient(t).Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "hello, gzip" {
+		t.Errorf("body = %q", body)
+	}
+	if !resp.Uncompressed || resp.Header.Get("Content-Encoding") != "" || resp.ContentLength != -1 {
+		t.Errorf("Uncompressed = %v, Content-Encoding = %q, ContentLength = %d", resp.Uncompressed, resp.Header.Get("Content-Encoding"), resp.ContentLength)
+	}
+}
+
+func TestTransportCancel(t *testing.T) {
+	arrived := make(chan struct{}, 1)
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		arrived <- struct{}{}
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+	client := newTestClient(t)
+
+	// Cancelled once the server has the request
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-arrived
+		cancel()
+	}()
+	req, _ := http.NewRequestWithContext(ctx, "GET", srv.URL, nil)
+	if _, err := client.Do(req); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled: err = %v, want context.Canceled", err)
+	}
+
+	// Cancelling while the body is read aborts the read
+	bodySrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("partial"))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer bodySrv.Close()
+	ctx, cancel = context.WithCancel(context.Background())
+	req, _ = http.NewRequestWithContext(ctx, "GET", bodySrv.URL, nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, len("partial"))
+	if _, err := io.ReadFull(resp.Body, buf); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if _, err := io.ReadAll(resp.Body); !errors.Is(err, context.Canceled) {
+		t.Errorf("body read after cancel: err = %v, want context.Canceled", err)
+	}
+	resp.Body.Close()
+
+	// A deadline also times out the connection, whichever notices first
+	for i := range 5 {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		req, _ := http.NewRequestWithContext(ctx, "GET", srv.URL, nil)
+		_, err := client.Do(req)
+		cancel()
+		<-arrived
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("deadline %d: err = %v, want context.DeadlineExceeded", i, err)
+		}
+	}
+}
+
+func TestTransportHost(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Host))
+	}))
+	defer srv.Close()
+
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	req.Host = "api.example"
+	resp, err := newTestClient(t).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if got, _ := io.ReadAll(resp.Body); string(got) != "api.example" {
+		t.Errorf("server saw Host %q, want api.example", got)
+	}
+}
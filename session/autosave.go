@@ -0,0 +1,133 @@
+package session
+
+import (
+	"context"
+	"time"
+)
+
+// AutoSaveOptions tunes Session.AutoSave
+type AutoSaveOptions struct {
+	// Debounce is how long the session must go unchanged before it is
+	// saved (default 2s)
+	Debounce time.Duration
+
+	// MaxDelay bounds how long a change waits while further changes keep
+	// resetting the debounce (default 30s)
+	MaxDelay time.Duration
+
+	// Timeout bounds each save, so a store that stops answering can't
+	// hold up Close (default 10s)
+	Timeout time.Duration
+
+	// OnError is called with failed saves, which are otherwise dropped;
+	// the next change tries again
+	OnError func(error)
+}
+
+// autoSaver saves a session to a Store after it changes
+type autoSaver struct {
+	s     *Session
+	store Store
+	id    string
+	opts  AutoSaveOptions
+
+	dirty chan struct{} // Signalled by markChanged
+	stop  chan struct{} // Closed by StopAutoSave
+	done  chan struct{} // Closed when run returns
+}
+
+// AutoSave keeps the session saved in store under id: once it changes
+// (a request completes, cookies are set or cleared) and then stays
+// unchanged for opts.Debounce, it is saved with SaveTo. A session that
+// keeps changing is still saved every opts.MaxDelay. AutoSave replaces any
+// earlier AutoSave; StopAutoSave, and Close, save what is pending and stop.
+func (s *Session) AutoSave(store Store, id string, opts AutoSaveOptions) {
+	if opts.Debounce <= 0 {
+		opts.Debounce = 2 * time.Second
+	}
+	if opts.MaxDelay <= 0 {
+		opts.MaxDelay = 30 * time.Second
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	a := &autoSaver{
+		s:     s,
+		store: store,
+		id:    id,
+		opts:  opts,
+		dirty: make(chan struct{}, 1),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	if old := s.autoSave.Swap(a); old != nil {
+		old.close()
+	}
+	go a.run()
+}
+
+// StopAutoSave stops AutoSave, saving any change not yet saved first
+func (s *Session) StopAutoSave() {
+	if a := s.autoSave.Swap(nil); a != nil {
+		a.close()
+	}
+}
+
+// markChanged tells AutoSave that the session's state changed
+func (s *Session) markChanged() {
+	if a := s.autoSave.Load(); a != nil {
+		select {
+		case a.dirty <- struct{}{}:
+		default: // A save is already pending
+		}
+	}
+}
+
+func (a *autoSaver) close() {
+	close(a.stop)
+	<-a.done
+}
+
+func (a *autoSaver) run() {
+	defer close(a.done)
+	for {
+		select {
+		case <-a.dirty:
+		case <-a.stop:
+			return
+		}
+
+		debounce := time.NewTimer(a.opts.Debounce)
+		deadline := time.NewTimer(a.opts.MaxDelay)
+		stopped := false
+	wait:
+		for {
+			select {
+			case <-a.dirty:
+				debounce.Reset(a.opts.Debounce)
+			case <-debounce.C:
+				break wait
+			case <-deadline.C:
+				break wait
+			case <-a.stop:
+				stopped = true
+				break wait
+			}
+		}
+		debounce.Stop()
+		deadline.Stop()
+
+		a.save()
+		if stopped {
+			return
+		}
+	}
+}
+
+func (a *autoSaver) save() {
+	ctx, cancel := context.WithTimeout(context.Background(), a.opts.Timeout)
+	defer cancel()
+	if err := a.s.SaveTo(ctx, a.store, a.id); err != nil && a.opts.OnError != nil {
+		a.opts.OnError(err)
+	}
+}
@@ -0,0 +1,92 @@
+package session
+
+import (
+	"context"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/sardanioss/httpcloak/transport"
+)
+
+// AutoWarmupOptions has the session warm up each origin before its first
+// request: an abbreviated Warmup of a page on the origin, so an API call
+// arrives with the cookies, TLS session and cache state of a visitor who
+// loaded the site first.
+type AutoWarmupOptions struct {
+	// Budget bounds each warmup. The request goes out when it runs out,
+	// whatever is left unfetched. Default: 3s.
+	Budget time.Duration
+
+	// Subresources is how many of the page's subresources are fetched:
+	// stylesheets and fonts first, then scripts, then images. Default: 10.
+	Subresources int
+
+	// Path is the page loaded. Default: "/".
+	Path string
+
+	// Hosts limits warmups to these hosts ("example.com" includes
+	// subdomains); empty for every host
+	Hosts []string
+}
+
+// autoWarmupState tracks the origins warmed up, or being warmed up
+type autoWarmupState struct {
+	mu      sync.Mutex
+	origins map[string]chan struct{} // Closed once the warmup is over
+}
+
+// autoWarmupKey marks the context of a warmup's own requests
+type autoWarmupKey struct{}
+
+// autoWarmup warms up the origin of reqURL, the first time a request goes
+// there. Requests to the origin arriving meanwhile wait for the same
+// warmup. Its failures are ignored: the request goes out regardless.
+func (s *Session) autoWarmup(ctx context.Context, reqURL string) {
+	if s.options == nil || s.options.AutoWarmup == nil || ctx.Value(autoWarmupKey{}) != nil || s.strict() {
+		return
+	}
+	opts := s.options.AutoWarmup
+	u, err := url.Parse(reqURL)
+	if err != nil || u.Host == "" {
+		return
+	}
+	filter := &transport.HostFilter{Allowed: opts.Hosts}
+	if filter.Check(u.Hostname()) != nil {
+		return
+	}
+
+	origin := u.Scheme + "://" + u.Host
+	s.warmups.mu.Lock()
+	done, started := s.warmups.origins[origin]
+	if !started {
+		if s.warmups.origins == nil {
+			s.warmups.origins = make(map[string]chan struct{})
+		}
+		done = make(chan struct{})
+		s.warmups.origins[origin] = done
+	}
+	s.warmups.mu.Unlock()
+	if started {
+		select {
+		case <-done:
+		case <-ctx.Done():
+		}
+		return
+	}
+	defer close(done)
+
+	budget, limit, path := opts.Budget, opts.Subresources, opts.Path
+	if budget <= 0 {
+		budget = 3 * time.Second
+	}
+	if limit <= 0 {
+		limit = 10
+	}
+	if path == "" {
+		path = "/"
+	}
+	warmCtx, cancel := context.WithTimeout(context.WithValue(ctx, autoWarmupKey{}, true), budget)
+	defer cancel()
+	s.warmup(warmCtx, origin+path, limit)
+}
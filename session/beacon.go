@@ -0,0 +1,118 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"mime"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/sardanioss/httpcloak/fingerprint"
+	"github.com/sardanioss/httpcloak/transport"
+)
+
+// MaxBeaconBytes is Chrome's keepalive quota: the bodies of a document's
+// beacons still in flight may not add up to more than this
+const MaxBeaconBytes = 64 << 10
+
+// beaconTimeout bounds how long a beacon may outlive its caller
+const beaconTimeout = 30 * time.Second
+
+// ErrBeaconQuota is returned by SendBeacon when the body would take the
+// session's in-flight beacons over MaxBeaconBytes. navigator.sendBeacon
+// returns false in the same case.
+var ErrBeaconQuota = errors.New("beacon exceeds the 64 KiB keepalive quota")
+
+// BeaconOptions describes a navigator.sendBeacon() call beyond its URL and body
+type BeaconOptions struct {
+	// ContentType of the body. "" sends "text/plain;charset=UTF-8", as for
+	// a string. Types other than text/plain, form-urlencoded and
+	// multipart/form-data make it a CORS request, as a Blob of that type does.
+	ContentType string
+
+	// PageURL is the document sending the beacon. It sets Origin, Referer
+	// and Sec-Fetch-Site; "" sends them as for a same-origin page.
+	PageURL string
+}
+
+// SendBeacon POSTs body to url as navigator.sendBeacon(url, body) does. It
+// returns once the beacon is queued: the request runs on its own, survives
+// ctx being cancelled for up to 30 seconds, and its response body is never
+// read. Bodies are limited by the keepalive quota (see ErrBeaconQuota).
+func (s *Session) SendBeacon(ctx context.Context, url string, body []byte) error {
+	return s.SendBeaconWithOptions(ctx, url, body, BeaconOptions{})
+}
+
+// SendBeaconWithOptions is SendBeacon with a content type and sending page
+func (s *Session) SendBeaconWithOptions(ctx context.Context, url string, body []byte, opts BeaconOptions) error {
+	if !s.IsActive() {
+		return ErrSessionClosed
+	}
+	size := int64(len(body))
+	if s.beaconBytes.Add(size) > MaxBeaconBytes {
+		s.beaconBytes.Add(-size)
+		return ErrBeaconQuota
+	}
+
+	req := &transport.Request{
+		Method:  "POST",
+		URL:     url,
+		Body:    body,
+		Headers: beaconHeaders(url, opts),
+	}
+	// Keep ctx's values (trace, identity) but not its cancellation
+	bctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), beaconTimeout)
+	go func() {
+		defer cancel()
+		defer s.beaconBytes.Add(-size)
+		if resp, err := s.Request(bctx, req); err == nil {
+			resp.Body.Close()
+		}
+	}()
+	return nil
+}
+
+// beaconHeaders returns the headers Chrome sends with a beacon
+func beaconHeaders(target string, opts BeaconOptions) map[string][]string {
+	contentType := opts.ContentType
+	if contentType == "" {
+		contentType = "text/plain;charset=UTF-8"
+	}
+	mode := fingerprint.FetchModeNoCORS
+	if mediaType, _, err := mime.ParseMediaType(contentType); err != nil || !isCORSSafelistedType(mediaType) {
+		mode = fingerprint.FetchModeCORS
+	}
+
+	page := opts.PageURL
+	if page == "" {
+		if u, err := url.Parse(target); err == nil {
+			page = u.Scheme + "://" + u.Host + "/"
+		}
+	}
+	reqCtx := fingerprint.NewRequestContext(mode, fingerprint.FetchDestEmpty, target).From(page)
+	secFetch := fingerprint.GenerateSecFetchHeaders(reqCtx)
+
+	headers := map[string][]string{
+		"Accept":         {"*/*"},
+		"Content-Type":   {contentType},
+		"Sec-Fetch-Site": {secFetch.Site},
+		"Sec-Fetch-Mode": {secFetch.Mode},
+		"Sec-Fetch-Dest": {secFetch.Dest},
+		"Referer":        {page},
+	}
+	if u, err := url.Parse(page); err == nil && u.Host != "" {
+		headers["Origin"] = []string{u.Scheme + "://" + u.Host}
+	}
+	return headers
+}
+
+// isCORSSafelistedType reports whether a body of this media type can be
+// sent without a preflight
+func isCORSSafelistedType(mediaType string) bool {
+	switch strings.ToLower(mediaType) {
+	case "text/plain", "application/x-www-form-urlencoded", "multipart/form-data":
+		return true
+	}
+	return false
+}
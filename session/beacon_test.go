@@ -0,0 +1,26 @@
+package session
+
+import "testing"
+
+func TestBeaconHeaders(t *testing.T) {
+	h := beaconHeaders("https://stats.example.com/collect", BeaconOptions{PageURL: "https://www.example.com/article"})
+	want := map[string]string{
+		"Content-Type":   "text/plain;charset=UTF-8",
+		"Sec-Fetch-Mode": "no-cors",
+		"Sec-Fetch-Dest": "empty",
+		"Sec-Fetch-Site": "same-site",
+		"Origin":         "https://www.example.com",
+		"Referer":        "https://www.example.com/article",
+	}
+	for name, v := range want {
+		if got := h[name]; len(got) != 1 || got[0] != v {
+			t.Errorf("%s = %v, want %q", name, got, v)
+		}
+	}
+
+	// A JSON Blob is not CORS-safelisted
+	h = beaconHeaders("https://api.example.net/log", BeaconOptions{ContentType: "application/json"})
+	if h["Sec-Fetch-Mode"][0] != "cors" || h["Sec-Fetch-Site"][0] != "same-origin" || h["Origin"][0] != "https://api.example.net" {
+		t.Errorf("JSON beacon headers = %v", h)
+	}
+}
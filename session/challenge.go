@@ -0,0 +1,286 @@
+package session
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/sardanioss/httpcloak/transport"
+)
+
+// ChallengeType identifies a captcha widget
+type ChallengeType string
+
+const (
+	ChallengeRecaptchaV2 ChallengeType = "recaptcha-v2"
+	ChallengeRecaptchaV3 ChallengeType = "recaptcha-v3"
+	ChallengeHCaptcha    ChallengeType = "hcaptcha"
+	ChallengeTurnstile   ChallengeType = "turnstile"
+)
+
+// Challenge is a captcha found in a response, with what solving services
+// ask for
+type Challenge struct {
+	Type       ChallengeType
+	SiteKey    string
+	Action     string // data-action (Turnstile, reCAPTCHA v3), if any
+	Enterprise bool   // reCAPTCHA Enterprise
+	URL        string // Page that showed it
+	StatusCode int
+	HTML       string
+	PoW        *PoWChallenge // Set for ChallengePoW
+}
+
+// ChallengeSolver returns a token for a captcha, typically from a solving
+// service such as 2captcha or CapSolver
+type ChallengeSolver interface {
+	Solve(ctx context.Context, ch *Challenge) (token string, err error)
+}
+
+// ChallengeSolverFunc adapts a function to ChallengeSolver
+type ChallengeSolverFunc func(ctx context.Context, ch *Challenge) (string, error)
+
+func (f ChallengeSolverFunc) Solve(ctx context.Context, ch *Challenge) (string, error) {
+	return f(ctx, ch)
+}
+
+// ChallengeOptions configures captcha solving for a session
+type ChallengeOptions struct {
+	Solver ChallengeSolver
+
+	// PoW solves proof-of-work challenges locally, with or without Solver.
+	// Captchas are looked for first.
+	PoW *PoWOptions
+
+	// Header sends the token in this request header. Otherwise it goes in
+	// the form field the widget posts (g-recaptcha-response,
+	// h-captcha-response or cf-turnstile-response), or Field if set: in
+	// the query string for GET, in the body for url-encoded forms.
+	Header string
+	Field  string
+
+	// MaxAttempts is how many challenges one request may solve. Default: 1.
+	MaxAttempts int
+}
+
+var (
+	sitekeyTagPattern  = regexp.MustCompile(`(?i)<[^>]*\bdata-sitekey\s*=[^>]*>`)
+	sitekeyPattern     = regexp.MustCompile(`(?i)\bdata-sitekey\s*=\s*["']([^"']+)["']`)
+	classPattern       = regexp.MustCompile(`(?i)\bclass\s*=\s*["']([^"']*)["']`)
+	actionPattern      = regexp.MustCompile(`(?i)\bdata-action\s*=\s*["']([^"']+)["']`)
+	recaptchaV3Pattern = regexp.MustCompile(`(?i)recaptcha/(api|enterprise)\.js\?[^"'>]*\brender=([\w-]+)`)
+)
+
+// interstitialMarkers identify bot-check pages served with a 200 status
+var interstitialMarkers = []string{
+	"/cdn-cgi/challenge-platform/", // Cloudflare
+	"_cf_chl_opt",
+	"captcha-delivery.com", // DataDome
+	"px-captcha",           // PerimeterX
+	"/_incapsula_resource", // Imperva
+}
+
+// isChallengePage reports whether a response is a bot check rather than the
+// page asked for: a 403, 429 or 503, or an interstitial marker. Sites using
+// reCAPTCHA v3 load its script on every page and forms carry widgets, so
+// their presence alone is no reason to solve.
+func isChallengePage(statusCode int, html string) bool {
+	switch statusCode {
+	case 403, 429, 503:
+		return true
+	}
+	for _, m := range interstitialMarkers {
+		if strings.Contains(html, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// DetectChallenge returns the captcha on an HTML page, or nil. Widgets are
+// found by their data-sitekey element (reCAPTCHA v2, hCaptcha, Turnstile)
+// or the render= parameter of the reCAPTCHA v3 script.
+func DetectChallenge(pageURL string, statusCode int, html string) *Challenge {
+	enterprise := strings.Contains(html, "recaptcha/enterprise.js")
+	for _, tag := range sitekeyTagPattern.FindAllString(html, -1) {
+		ch := &Challenge{URL: pageURL, StatusCode: statusCode, HTML: html}
+		var class string
+		if m := classPattern.FindStringSubmatch(tag); m != nil {
+			class = " " + m[1] + " "
+		}
+		switch {
+		case strings.Contains(class, " cf-turnstile "):
+			ch.Type = ChallengeTurnstile
+		case strings.Contains(class, " h-captcha "):
+			ch.Type = ChallengeHCaptcha
+		case strings.Contains(class, " g-recaptcha "):
+			ch.Type = ChallengeRecaptchaV2
+			ch.Enterprise = enterprise
+		default:
+			continue
+		}
+		if m := sitekeyPattern.FindStringSubmatch(tag); m != nil {
+			ch.SiteKey = m[1]
+		}
+		if m := actionPattern.FindStringSubmatch(tag); m != nil {
+			ch.Action = m[1]
+		}
+		if ch.SiteKey != "" {
+			return ch
+		}
+	}
+	if m := recaptchaV3Pattern.FindStringSubmatch(html); m != nil && m[2] != "explicit" {
+		return &Challenge{
+			Type:       ChallengeRecaptchaV3,
+			SiteKey:    m[2],
+			Enterprise: strings.EqualFold(m[1], "enterprise"),
+			URL:        pageURL,
+			StatusCode: statusCode,
+			HTML:       html,
+		}
+	}
+	return nil
+}
+
+// challengeField is the form field the widget submits its token in
+func challengeField(t ChallengeType) string {
+	switch t {
+	case ChallengeHCaptcha:
+		return "h-captcha-response"
+	case ChallengeTurnstile:
+		return "cf-turnstile-response"
+	case ChallengePoW:
+		return "pow"
+	}
+	return "g-recaptcha-response"
+}
+
+// challengeAttemptsKey counts captchas solved for one request
+type challengeAttemptsKey struct{}
+
+// solveChallenge checks a final response for a captcha or proof-of-work
+// puzzle. Captchas are only looked for on challenge pages (see
+// isChallengePage). If there is one and attempts remain, it is solved and the request
+// to send again, carrying the token, is returned with the context to send it
+// in. resp's body stays readable either way.
+func (s *Session) solveChallenge(ctx context.Context, req *transport.Request, resp *transport.Response) (context.Context, *transport.Request, error) {
+	if s.options == nil || s.options.Challenge == nil {
+		return nil, nil, nil
+	}
+	opts := s.options.Challenge
+	if opts.Solver == nil && opts.PoW == nil {
+		return nil, nil, nil
+	}
+	maxAttempts := opts.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = 1
+	}
+	attempts, _ := ctx.Value(challengeAttemptsKey{}).(int)
+	if attempts >= maxAttempts || resp.Body == nil {
+		return nil, nil, nil
+	}
+
+	// Puzzles may come in a header; captchas need an HTML page
+	isHTML := strings.Contains(strings.ToLower(resp.GetHeader("Content-Type")), "html")
+	if !isHTML && opts.PoW == nil {
+		return nil, nil, nil
+	}
+	var html string
+	if isHTML {
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		if err != nil {
+			return nil, nil, err
+		}
+		html = string(body)
+	}
+
+	var ch *Challenge
+	if opts.Solver != nil && html != "" && isChallengePage(resp.StatusCode, html) {
+		ch = DetectChallenge(req.URL, resp.StatusCode, html)
+	}
+	if ch == nil && opts.PoW != nil {
+		ch = opts.PoW.detect(req.URL, resp.StatusCode, resp.Headers, html)
+	}
+	if ch == nil {
+		return nil, nil, nil
+	}
+
+	header, field := opts.Header, opts.Field
+	var token string
+	var err error
+	if ch.Type == ChallengePoW {
+		token, err = SolvePoW(ctx, ch.PoW, opts.PoW.maxDifficulty())
+		if err != nil {
+			return nil, nil, fmt.Errorf("solve proof-of-work on %s: %w", req.URL, err)
+		}
+		if ch.PoW.Header != "" || ch.PoW.Field != "" {
+			header, field = ch.PoW.Header, ch.PoW.Field
+		}
+	} else {
+		token, err = opts.Solver.Solve(ctx, ch)
+		if err != nil {
+			return nil, nil, fmt.Errorf("solve %s captcha on %s: %w", ch.Type, req.URL, err)
+		}
+	}
+	if field == "" {
+		field = challengeField(ch.Type)
+	}
+	retry, err := withChallengeToken(req, header, field, token)
+	if err != nil {
+		return nil, nil, err
+	}
+	return context.WithValue(ctx, challengeAttemptsKey{}, attempts+1), retry, nil
+}
+
+// withChallengeToken returns a copy of req carrying token in header, or else
+// in form field: the query string for GET and HEAD, the body for url-encoded
+// forms. Other bodies need a header.
+func withChallengeToken(req *transport.Request, header, field, token string) (*transport.Request, error) {
+	retry := *req
+	retry.Headers = make(map[string][]string, len(req.Headers))
+	for k, v := range req.Headers {
+		if k != "Cookie" { // Rebuilt from the jar
+			retry.Headers[k] = v
+		}
+	}
+	if header != "" {
+		setHeader(retry.Headers, header, token)
+		return &retry, nil
+	}
+
+	switch strings.ToUpper(req.Method) {
+	case "", "GET", "HEAD":
+		u, err := url.Parse(req.URL)
+		if err != nil {
+			return nil, err
+		}
+		q := u.Query()
+		q.Set(field, token)
+		u.RawQuery = q.Encode()
+		retry.URL = u.String()
+		return &retry, nil
+	}
+
+	contentType := headerValue(req.Headers, "Content-Type")
+	isForm := contentType == "" || strings.HasPrefix(strings.ToLower(contentType), "application/x-www-form-urlencoded")
+	if !isForm || req.BodyReader != nil || req.BodySource != nil {
+		return nil, fmt.Errorf("captcha token can't be added to a %q request body; set ChallengeOptions.Header", contentType)
+	}
+	form, err := url.ParseQuery(string(req.Body))
+	if err != nil {
+		return nil, fmt.Errorf("captcha token: %w", err)
+	}
+	form.Set(field, token)
+	retry.Body = []byte(form.Encode())
+	if contentType == "" {
+		setHeader(retry.Headers, "Content-Type", "application/x-www-form-urlencoded")
+	}
+	setHeader(retry.Headers, "Content-Length", "")
+	return &retry, nil
+}
@@ -0,0 +1,121 @@
+package session
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/sardanioss/httpcloak/transport"
+)
+
+func TestDetectChallenge(t *testing.T) {
+	tests := []struct {
+		name, html string
+		want       ChallengeType
+		siteKey    string
+	}{
+		{"recaptcha v2", `<div class="g-recaptcha" data-sitekey="6Lc_v2"></div>`, ChallengeRecaptchaV2, "6Lc_v2"},
+		{"hcaptcha", `<div data-sitekey='hc-key' class="h-captcha"></div>`, ChallengeHCaptcha, "hc-key"},
+		{"turnstile", `<div class="cf-turnstile extra" data-sitekey="0x4AAA" data-action="login"></div>`, ChallengeTurnstile, "0x4AAA"},
+		{"recaptcha v3", `<script src="https://www.google.com/recaptcha/api.js?render=6Lc_v3"></script>`, ChallengeRecaptchaV3, "6Lc_v3"},
+		{"explicit render", `<script src="https://www.google.com/recaptcha/api.js?render=explicit"></script>`, "", ""},
+		{"unrelated sitekey", `<div class="map" data-sitekey="x"></div>`, "", ""},
+	}
+	for _, tt := range tests {
+		ch := DetectChallenge("https://example.com/login", 403, tt.html)
+		if tt.want == "" {
+			if ch != nil {
+				t.Errorf("%s: detected %s", tt.name, ch.Type)
+			}
+			continue
+		}
+		if ch == nil || ch.Type != tt.want || ch.SiteKey != tt.siteKey {
+			t.Errorf("%s: got %+v, want %s with sitekey %s", tt.name, ch, tt.want, tt.siteKey)
+		}
+	}
+	if ch := DetectChallenge("", 200, tests[2].html); ch.Action != "login" {
+		t.Errorf("Turnstile action = %q, want login", ch.Action)
+	}
+}
+
+func TestSolveChallengeOnlyOnChallengePages(t *testing.T) {
+	var solved int
+	s := &Session{options: &SessionOptions{Challenge: &ChallengeOptions{
+		Solver: ChallengeSolverFunc(func(ctx context.Context, ch *Challenge) (string, error) {
+			solved++
+			return "tok", nil
+		}),
+	}}}
+	v3 := `<script src="https://www.google.com/recaptcha/api.js?render=6Lc_v3"></script>`
+	tests := []struct {
+		name   string
+		status int
+		html   string
+		solve  bool
+	}{
+		{"v3 script on ordinary page", 200, v3, false},
+		{"form widget on ordinary page", 200, `<div class="g-recaptcha" data-sitekey="6Lc_v2"></div>`, false},
+		{"v3 on 403", 403, v3, true},
+		{"turnstile interstitial", 200, `<script src="/cdn-cgi/challenge-platform/h/g/orchestrate"></script><div class="cf-turnstile" data-sitekey="0x4AAA"></div>`, true},
+	}
+	for _, tt := range tests {
+		solved = 0
+		req := &transport.Request{Method: "GET", URL: "https://example.com/"}
+		resp := &transport.Response{
+			StatusCode: tt.status,
+			Headers:    map[string][]string{"content-type": {"text/html"}},
+			Body:       io.NopCloser(strings.NewReader(tt.html)),
+		}
+		_, retry, err := s.solveChallenge(context.Background(), req, resp)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if (retry != nil) != tt.solve || (solved == 1) != tt.solve {
+			t.Errorf("%s: retry = %v, solved %d times", tt.name, retry != nil, solved)
+		}
+		if body, _ := io.ReadAll(resp.Body); string(body) != tt.html {
+			t.Errorf("%s: body not readable after detection", tt.name)
+		}
+	}
+}
+
+func TestChallengeToken(t *testing.T) {
+	get := &transport.Request{Method: "GET", URL: "https://example.com/search?q=a"}
+	retry, err := withChallengeToken(get, "", "g-recaptcha-response", "tok")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(retry.URL)
+	if u.Query().Get("g-recaptcha-response") != "tok" || u.Query().Get("q") != "a" {
+		t.Errorf("GET retry URL = %s", retry.URL)
+	}
+
+	post := &transport.Request{
+		Method:  "POST",
+		URL:     "https://example.com/login",
+		Headers: map[string][]string{"Content-Type": {"application/x-www-form-urlencoded"}, "Cookie": {"a=1"}},
+		Body:    []byte("user=bob"),
+	}
+	retry, err = withChallengeToken(post, "", "cf-turnstile-response", "tok")
+	if err != nil {
+		t.Fatal(err)
+	}
+	form, _ := url.ParseQuery(string(retry.Body))
+	if form.Get("user") != "bob" || form.Get("cf-turnstile-response") != "tok" {
+		t.Errorf("POST retry body = %s", retry.Body)
+	}
+	if _, ok := retry.Headers["Cookie"]; ok || string(post.Body) != "user=bob" {
+		t.Error("retry kept the Cookie header or changed the original request")
+	}
+
+	post.Headers["Content-Type"] = []string{"application/json"}
+	if _, err := withChallengeToken(post, "", "g-recaptcha-response", "tok"); err == nil {
+		t.Error("token added to a JSON body")
+	}
+	retry, err = withChallengeToken(post, "X-Captcha-Token", "", "tok")
+	if err != nil || headerValue(retry.Headers, "X-Captcha-Token") != "tok" {
+		t.Errorf("header token: %v %v", retry.Headers, err)
+	}
+}
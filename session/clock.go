@@ -0,0 +1,124 @@
+package session
+
+import (
+	"context"
+	"math"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/sardanioss/httpcloak/fingerprint"
+)
+
+// BehaviorClock times a session's waits: the gap between requests, the
+// pauses in Warmup and retry backoff. Its profile is drawn once from the
+// session's seed, so a session is consistently brisk or sluggish and its
+// delays scatter in their own way. Thousands of sessions sharing one
+// uniform jitter range would form a cluster of their own.
+type BehaviorClock struct {
+	mu     sync.Mutex
+	rng    *rand.Rand
+	tempo  float64 // Multiplies every delay: below 1 is brisk, above slow
+	spread float64 // Sigma of the log-normal variation of each delay
+}
+
+// NewBehaviorClock derives a clock's profile from seed. The same seed always
+// gives the same tempo and spread.
+func NewBehaviorClock(seed int64) *BehaviorClock {
+	rng := rand.New(rand.NewPCG(uint64(seed), 0x9e3779b97f4a7c15))
+	tempo := math.Exp(rng.NormFloat64() * 0.25)
+	return &BehaviorClock{
+		rng:    rng,
+		tempo:  min(max(tempo, 0.6), 1.7),
+		spread: 0.1 + rng.Float64()*0.3,
+	}
+}
+
+// Tempo returns the factor the session's delays are scaled by on average
+func (c *BehaviorClock) Tempo() float64 {
+	return c.tempo
+}
+
+// Delay returns base as this session would wait it: scaled by the tempo and
+// varied log-normally, so most waits land near the scaled base and a few
+// run long, as a person's do
+func (c *BehaviorClock) Delay(base time.Duration) time.Duration {
+	if base <= 0 {
+		return 0
+	}
+	c.mu.Lock()
+	v := c.rng.NormFloat64()
+	c.mu.Unlock()
+	// Mean-preserving: E[exp(σv - σ²/2)] = 1
+	factor := c.tempo * math.Exp(c.spread*v-c.spread*c.spread/2)
+	return time.Duration(float64(base) * factor)
+}
+
+// Between returns a delay for a wait a browser spends somewhere between
+// minimum and maximum
+func (c *BehaviorClock) Between(minimum, maximum time.Duration) time.Duration {
+	return c.Delay((minimum + maximum) / 2)
+}
+
+// BehaviorClock returns the clock timing this session's waits. Forks share
+// their parent's.
+func (s *Session) BehaviorClock() *BehaviorClock {
+	return s.clock
+}
+
+// clockFor returns the clock timing a request's waits: the one for the
+// identity in ctx (see fingerprint.WithIdentity) if there is one, so that
+// identity's requests are timed alike in any session, else the session's
+func (s *Session) clockFor(ctx context.Context) *BehaviorClock {
+	id := fingerprint.IdentityFrom(ctx)
+	if id == "" {
+		return s.clock
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	clock := s.identityClocks[id]
+	if clock == nil {
+		if s.identityClocks == nil {
+			s.identityClocks = make(map[string]*BehaviorClock)
+		}
+		clock = NewBehaviorClock(fingerprint.IdentitySeed(id, "behavior"))
+		s.identityClocks[id] = clock
+	}
+	return clock
+}
+
+// awaitRequestGap holds a request until the session's request gap (see
+// protocol.SessionConfig.RequestGap) has passed since the previous one.
+// Each request reserves its slot, so concurrent requests are spaced too.
+func (s *Session) awaitRequestGap(ctx context.Context) error {
+	if s.Config == nil || s.Config.RequestGap <= 0 {
+		return nil
+	}
+	gap := s.clockFor(ctx).Delay(time.Duration(s.Config.RequestGap) * time.Millisecond)
+
+	s.mu.Lock()
+	now := time.Now()
+	start := now
+	if s.nextRequestAt.After(now) {
+		start = s.nextRequestAt
+	}
+	s.nextRequestAt = start.Add(gap)
+	s.mu.Unlock()
+
+	return sleepCtx(ctx, start.Sub(now))
+}
+
+// sleepCtx waits for d or until ctx is done
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,66 @@
+package session
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sardanioss/httpcloak/protocol"
+)
+
+func TestBehaviorClockProfile(t *testing.T) {
+	a, b := NewBehaviorClock(42), NewBehaviorClock(42)
+	if a.Tempo() != b.Tempo() || a.Delay(time.Second) != b.Delay(time.Second) {
+		t.Error("same seed gave different profiles")
+	}
+
+	// Sessions differ from each other, not just request to request
+	tempos := make(map[float64]bool)
+	for seed := int64(1); seed <= 20; seed++ {
+		tempo := NewBehaviorClock(seed).Tempo()
+		if tempo < 0.6 || tempo > 1.7 {
+			t.Errorf("seed %d: tempo %v out of range", seed, tempo)
+		}
+		tempos[tempo] = true
+	}
+	if len(tempos) < 15 {
+		t.Errorf("only %d distinct tempos from 20 seeds", len(tempos))
+	}
+
+	// Delays average out at the tempo-scaled base
+	c := NewBehaviorClock(7)
+	var total time.Duration
+	for range 2000 {
+		total += c.Delay(100 * time.Millisecond)
+	}
+	mean := float64(total/2000) / float64(100*time.Millisecond)
+	if mean < c.Tempo()*0.9 || mean > c.Tempo()*1.1 {
+		t.Errorf("mean factor %.3f, tempo %.3f", mean, c.Tempo())
+	}
+	if c.Delay(0) != 0 {
+		t.Error("zero base delayed")
+	}
+}
+
+func TestRequestGap(t *testing.T) {
+	s := &Session{Config: &protocol.SessionConfig{RequestGap: 30}, clock: NewBehaviorClock(3)}
+	ctx := context.Background()
+
+	start := time.Now()
+	for range 3 {
+		if err := s.awaitRequestGap(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The first request goes at once; the next two wait out a gap each
+	if elapsed := time.Since(start); elapsed < 10*time.Millisecond {
+		t.Errorf("three requests in %v, expected them spaced", elapsed)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	s.nextRequestAt = time.Now().Add(time.Hour)
+	if err := s.awaitRequestGap(cancelled); err != context.Canceled {
+		t.Errorf("cancelled wait = %v", err)
+	}
+}
@@ -0,0 +1,79 @@
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// CloneOptions tunes Session.CloneWithOptions
+type CloneOptions struct {
+	// FreshFingerprint clears the behaviour seed and identity key, so the
+	// clone rolls its own timing profile and, like any session without an
+	// identity key, its own TLS extension order and HTTP/3 GREASE. Cookies
+	// and TLS tickets are still copied; clear them if the clone must not be
+	// linkable to its parent.
+	FreshFingerprint bool
+
+	// IdentityKey gives the clone its own identity key (see
+	// protocol.SessionConfig.IdentityKey), deriving its seeds from it
+	IdentityKey string
+}
+
+// Clone returns an independent copy of the session: cookies, TLS session
+// tickets, ECH configs, learned protocols, validators and cached bodies,
+// client hints, DNS entries and config are deep-copied into a new session
+// with its own connections. Unlike Fork, nothing is shared afterwards, so a
+// warmed-up session can be cloned into workers that each evolve on their
+// own.
+func (s *Session) Clone() (*Session, error) {
+	return s.CloneWithOptions(CloneOptions{})
+}
+
+// CloneWithOptions is Clone, optionally with a new fingerprint identity
+func (s *Session) CloneWithOptions(opts CloneOptions) (*Session, error) {
+	if !s.IsActive() {
+		return nil, ErrSessionClosed
+	}
+
+	state := s.snapshotState()
+	if state.DNS == nil {
+		if dnsCache := s.transport.GetDNSCache(); dnsCache != nil {
+			state.DNS = dnsCache.Export()
+		}
+	}
+	// The clone keeps the in-memory state Suspend would, but not the ID
+	// and counters
+	state.Suspended = s.suspendedState()
+	state.Suspended.ID = ""
+	state.Suspended.LastUsed = time.Now()
+	state.Suspended.RequestCount = 0
+
+	// A round trip through the state encoding leaves nothing shared, the
+	// config's maps and slices included
+	data, err := json.Marshal(state)
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy session: %w", err)
+	}
+	var copied SessionState
+	if err := json.Unmarshal(data, &copied); err != nil {
+		return nil, fmt.Errorf("failed to copy session: %w", err)
+	}
+
+	if opts.FreshFingerprint || opts.IdentityKey != "" {
+		// NewSession derives the seed from the key, or picks a random one
+		copied.Config.IdentityKey = opts.IdentityKey
+		copied.Config.BehaviorSeed = 0
+	}
+
+	s.mu.RLock()
+	options := s.options
+	sourceBuild := s.sourceBuild
+	s.mu.RUnlock()
+
+	clone := restoreSession(&copied, options)
+	clone.mu.Lock()
+	clone.sourceBuild = sourceBuild
+	clone.mu.Unlock()
+	return clone, nil
+}
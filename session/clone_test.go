@@ -0,0 +1,65 @@
+package session
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/sardanioss/httpcloak/dns"
+	"github.com/sardanioss/httpcloak/protocol"
+)
+
+func TestCloneIsIndependent(t *testing.T) {
+	s := NewSession("", &protocol.SessionConfig{
+		Preset:    "chrome-143",
+		ConnectTo: map[string]string{"a.example": "b.example"},
+	})
+	defer s.Close()
+	s.SetCookie("sid", "1")
+	s.mu.Lock()
+	s.clientHints["a.example"] = map[string]bool{"sec-ch-ua-arch": true}
+	s.mu.Unlock()
+	s.transport.GetDNSCache().Import(map[string]dns.Entry{
+		"a.example": {IPs: []net.IP{net.IPv4(192, 0, 2, 1)}, ExpiresAt: time.Now().Add(time.Hour)},
+	})
+
+	clone, err := s.Clone()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clone.Close()
+
+	// Change everything on the parent, in place where it's a map
+	s.SetCookie("sid", "2")
+	s.mu.Lock()
+	s.clientHints["a.example"]["sec-ch-ua-model"] = true
+	s.clientHints["b.example"] = map[string]bool{"sec-ch-ua-arch": true}
+	s.Config.ConnectTo["a.example"] = "c.example"
+	s.mu.Unlock()
+	s.transport.GetDNSCache().Import(map[string]dns.Entry{
+		"a.example": {IPs: []net.IP{net.IPv4(192, 0, 2, 2)}, ExpiresAt: time.Now().Add(time.Hour)},
+	})
+
+	if got := clone.GetCookies()["sid"]; got != "1" {
+		t.Errorf("clone cookie = %q, want 1", got)
+	}
+	clone.mu.RLock()
+	hints := clone.clientHints
+	connectTo := clone.Config.ConnectTo["a.example"]
+	clone.mu.RUnlock()
+	if len(hints) != 1 || len(hints["a.example"]) != 1 || !hints["a.example"]["sec-ch-ua-arch"] {
+		t.Errorf("clone client hints = %v", hints)
+	}
+	if connectTo != "b.example" {
+		t.Errorf("clone ConnectTo = %q, want b.example", connectTo)
+	}
+	if ips := clone.transport.GetDNSCache().Export()["a.example"].IPs; len(ips) != 1 || !ips[0].Equal(net.IPv4(192, 0, 2, 1)) {
+		t.Errorf("clone DNS = %v", ips)
+	}
+
+	// And the other way round
+	clone.SetCookie("sid", "3")
+	if got := s.GetCookies()["sid"]; got != "2" {
+		t.Errorf("parent cookie = %q after the clone's changed, want 2", got)
+	}
+}
@@ -0,0 +1,218 @@
+package session
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/sardanioss/httpcloak/fingerprint"
+	"github.com/sardanioss/httpcloak/transport"
+	"github.com/sardanioss/httpcloak/version"
+	tls "github.com/sardanioss/utls"
+)
+
+// ImportReport describes what happened to the resumption state (TLS tickets
+// and ECH configs) of a session file when it was loaded.
+//
+// Tickets are checked against the ClientHello the current preset will send;
+// anything the preset could not have negotiated is discarded instead of being
+// resumed with mismatched parameters.
+type ImportReport struct {
+	// SourceBuild is the build that wrote the state (nil for older files)
+	SourceBuild *version.Info `json:"source_build,omitempty"`
+
+	// BuildChanged is true when the state was written by a different preset
+	// database, utls or quic-go version than the one currently running
+	BuildChanged bool `json:"build_changed"`
+
+	// ImportedTLSSessions is the number of TLS sessions kept
+	ImportedTLSSessions int `json:"imported_tls_sessions"`
+
+	// DroppedTLSSessions maps the persisted key (e.g. "h2:example.com:443")
+	// to the reason it was discarded
+	DroppedTLSSessions map[string]string `json:"dropped_tls_sessions,omitempty"`
+
+	// DroppedECHConfigs maps host to the reason its ECH config was discarded
+	DroppedECHConfigs map[string]string `json:"dropped_ech_configs,omitempty"`
+
+	// TLSImportError is why kept TLS sessions could not be put into the
+	// session caches, if they couldn't
+	TLSImportError string `json:"tls_import_error,omitempty"`
+}
+
+// Clean returns true if nothing had to be discarded.
+func (r *ImportReport) Clean() bool {
+	return len(r.DroppedTLSSessions) == 0 && len(r.DroppedECHConfigs) == 0 && r.TLSImportError == ""
+}
+
+// ImportReport returns the compatibility report produced when this session was
+// restored from saved state, or nil for sessions created fresh.
+func (s *Session) ImportReport() *ImportReport {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.importReport
+}
+
+// buildChanged reports whether a stored build differs from the running one in
+// anything that affects the fingerprint.
+func buildChanged(stored *version.Info) bool {
+	if stored == nil {
+		// Pre-provenance file: unknown origin, treat as changed so tickets
+		// get the full check
+		return true
+	}
+	current := version.Get()
+	return stored.PresetDatabase != current.PresetDatabase ||
+		stored.UTLS != current.UTLS ||
+		stored.QUICGo != current.QUICGo
+}
+
+// importResumptionState validates persisted TLS sessions and ECH configs
+// against the session's preset, imports whatever is still consistent along
+// with the discovery cache, and records the outcome in s.importReport.
+// ECH configs must be imported before TLS sessions - the tickets were issued
+// under those configs.
+func (s *Session) importResumptionState(tlsSessions map[string]transport.TLSSessionState, echConfigs map[string]string, discovery map[string]transport.DiscoveryEntry, build *version.Info) {
+	preset := fingerprint.Get(s.Config.Preset)
+	report, keptTLS, keptECH := checkResumptionState(preset, tlsSessions, echConfigs, discovery, build, time.Now())
+
+	s.importECHConfigs(keptECH)
+	s.transport.ImportDiscovery(keptDiscovery(discovery, report.DroppedECHConfigs))
+	if err := s.importTLSSessions(keptTLS); err != nil {
+		// Cookies are the main thing - report it rather than fail the load
+		report.TLSImportError = err.Error()
+	}
+
+	s.mu.Lock()
+	s.importReport = report
+	s.mu.Unlock()
+}
+
+// checkResumptionState decides which persisted TLS sessions and ECH configs
+// are still consistent with preset as of now, and reports why the others
+// are dropped. It changes nothing, so SessionState.Validate runs it too. A
+// nil preset leaves only the structural checks.
+func checkResumptionState(preset *fingerprint.Preset, tlsSessions map[string]transport.TLSSessionState, echConfigs map[string]string, discovery map[string]transport.DiscoveryEntry, build *version.Info, now time.Time) (report *ImportReport, keptTLS map[string]transport.TLSSessionState, keptECH map[string]string) {
+	report = &ImportReport{
+		SourceBuild:  build,
+		BuildChanged: buildChanged(build),
+	}
+
+	// Validate ECH configs first - dropping one invalidates the h3 tickets for that host
+	keptECH = make(map[string]string, len(echConfigs))
+	for host, b64 := range echConfigs {
+		raw, err := base64.StdEncoding.DecodeString(b64)
+		if err != nil {
+			report.dropECH(host, "invalid base64")
+			continue
+		}
+		if err := transport.ValidateECHConfigList(raw); err != nil {
+			report.dropECH(host, err.Error())
+			continue
+		}
+		if entry, ok := discovery[host]; ok && entry.ECHExpires != nil && now.After(*entry.ECHExpires) {
+			// Past the HTTPS record's TTL - a browser would have re-queried by now
+			report.dropECH(host, "expired")
+			continue
+		}
+		keptECH[host] = b64
+	}
+
+	specs := make(map[string]*tls.ClientHelloSpec, 3)
+	specFor := func(proto string) *tls.ClientHelloSpec {
+		if !report.BuildChanged || preset == nil {
+			// Same preset database and utls: the ClientHello that got the
+			// ticket is the one that will present it
+			return nil
+		}
+		key := proto
+		if proto == "h1" {
+			key = "h2" // H1 and H2 share the TCP ClientHello
+		}
+		if spec, ok := specs[key]; ok {
+			return spec
+		}
+		spec, err := transport.PresetClientHelloSpec(preset, key)
+		if err != nil {
+			spec = nil // Can't expand the preset - only structural checks apply
+		}
+		specs[key] = spec
+		return spec
+	}
+
+	keptTLS = make(map[string]transport.TLSSessionState, len(tlsSessions))
+	for key, state := range tlsSessions {
+		if len(key) <= 3 || key[2] != ':' {
+			report.dropTLS(key, "unrecognized key format")
+			continue
+		}
+		proto, origin := key[:2], key[3:]
+
+		if age := now.Sub(state.CreatedAt); age > transport.TLSSessionMaxAge {
+			report.dropTLS(key, fmt.Sprintf("expired: %s old, past the %s limit", age.Round(time.Minute), transport.TLSSessionMaxAge))
+			continue
+		}
+		if _, err := base64.StdEncoding.DecodeString(state.Ticket); err != nil {
+			report.dropTLS(key, "ticket: invalid base64")
+			continue
+		}
+		if proto == "h3" {
+			if reason, dropped := report.DroppedECHConfigs[originHost(origin)]; dropped {
+				report.dropTLS(key, "ECH config discarded: "+reason)
+				continue
+			}
+		}
+		if err := state.CheckCompatibility(specFor(proto), ticketALPN[proto]); err != nil {
+			report.dropTLS(key, err.Error())
+			continue
+		}
+		keptTLS[key] = state
+	}
+	report.ImportedTLSSessions = len(keptTLS)
+	return report, keptTLS, keptECH
+}
+
+// ticketALPN is the ALPN protocol a ticket's cache key prefix was
+// negotiated with
+var ticketALPN = map[string]string{"h1": "http/1.1", "h2": "h2", "h3": "h3"}
+
+func (r *ImportReport) dropTLS(key, reason string) {
+	if r.DroppedTLSSessions == nil {
+		r.DroppedTLSSessions = make(map[string]string)
+	}
+	r.DroppedTLSSessions[key] = reason
+}
+
+func (r *ImportReport) dropECH(host, reason string) {
+	if r.DroppedECHConfigs == nil {
+		r.DroppedECHConfigs = make(map[string]string)
+	}
+	r.DroppedECHConfigs[host] = reason
+}
+
+// keptDiscovery returns discovery without the ECH lifetimes of configs that
+// were dropped on import.
+func keptDiscovery(discovery map[string]transport.DiscoveryEntry, droppedECH map[string]string) map[string]transport.DiscoveryEntry {
+	if len(droppedECH) == 0 {
+		return discovery
+	}
+	kept := make(map[string]transport.DiscoveryEntry, len(discovery))
+	for host, entry := range discovery {
+		if _, dropped := droppedECH[host]; dropped {
+			entry.ECHExpires = nil
+		}
+		kept[host] = entry
+	}
+	return kept
+}
+
+// originHost extracts the host from a session cache key, which may carry an
+// egress partition prefix ("egress-…|host:port") and/or a port.
+func originHost(origin string) string {
+	_, origin = transport.SplitTicketPartition(origin)
+	if host, _, err := net.SplitHostPort(origin); err == nil {
+		return host
+	}
+	return origin
+}
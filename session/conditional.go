@@ -0,0 +1,171 @@
+package session
+
+import (
+	"bytes"
+	"io"
+	"strings"
+
+	"github.com/sardanioss/httpcloak/transport"
+)
+
+const (
+	// maxCachedBody is the largest body kept to answer a 304 with. Bigger
+	// responses keep only their validators.
+	maxCachedBody = 2 << 20
+
+	// maxCachedBodies bounds the bodies a session holds in all
+	maxCachedBodies = 32 << 20
+)
+
+// cachedResponse is the 200 response a 304 stands for
+type cachedResponse struct {
+	headers map[string][]string // Without Set-Cookie
+	body    []byte
+}
+
+// conditionalEnabled reports whether the session revalidates URLs it has
+// fetched before (see protocol.SessionConfig.DisableConditional)
+func (s *Session) conditionalEnabled() bool {
+	return s.Config == nil || !s.Config.DisableConditional
+}
+
+// isConditionalMethod reports whether browsers revalidate requests with method
+func isConditionalMethod(method string) bool {
+	return method == "" || method == "GET" || method == "HEAD"
+}
+
+// hasHeader reports whether headers has name, in any case
+func hasHeader(headers map[string][]string, name string) bool {
+	for k := range headers {
+		if strings.EqualFold(k, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyValidators adds If-None-Match/If-Modified-Since for a URL fetched
+// before, unless the caller set its own, and reports whether it did. The
+// caller holds s.mu.
+func (s *Session) applyValidators(req *transport.Request) bool {
+	if !s.conditionalEnabled() || !isConditionalMethod(req.Method) {
+		return false
+	}
+	if hasHeader(req.Headers, "If-None-Match") || hasHeader(req.Headers, "If-Modified-Since") {
+		return false
+	}
+	cached, exists := s.cacheEntries[req.URL]
+	if !exists {
+		return false
+	}
+	if cached.etag != "" {
+		req.Headers["If-None-Match"] = []string{cached.etag}
+	}
+	if cached.lastModified != "" {
+		req.Headers["If-Modified-Since"] = []string{cached.lastModified}
+	}
+	return true
+}
+
+// serveNotModified turns a 304 to a revalidation the session sent into the
+// cached 200 it confirms, with the headers the 304 updated, as a browser
+// serves it from its cache. Without a cached body the 304 is left as is.
+func (s *Session) serveNotModified(url string, resp *transport.Response) {
+	s.mu.RLock()
+	var cached *cachedResponse
+	if entry := s.cacheEntries[url]; entry != nil {
+		cached = entry.response
+	}
+	s.mu.RUnlock()
+	if cached == nil {
+		return
+	}
+
+	headers := make(map[string][]string, len(cached.headers)+len(resp.Headers))
+	for k, v := range cached.headers {
+		headers[k] = v
+	}
+	for k, v := range resp.Headers {
+		if strings.EqualFold(k, "set-cookie") {
+			continue // Already stored; the 304's own cookies were taken in
+		}
+		headers[strings.ToLower(k)] = v
+	}
+	if resp.Body != nil {
+		resp.Body.Close()
+	}
+	resp.StatusCode = 200
+	resp.Headers = headers
+	resp.Body = io.NopCloser(bytes.NewReader(cached.body))
+	resp.Revalidated = true
+}
+
+// captureBody tees a 200 response's body as the caller reads it, and keeps
+// it to answer later 304s for url once it has been read to the end
+func (s *Session) captureBody(url string, resp *transport.Response) {
+	if resp.Body == nil || resp.StatusCode != 200 {
+		return
+	}
+	headers := make(map[string][]string, len(resp.Headers))
+	for k, v := range resp.Headers {
+		if !strings.EqualFold(k, "set-cookie") {
+			headers[strings.ToLower(k)] = v
+		}
+	}
+	resp.Body = &bodyCapture{ReadCloser: resp.Body, done: func(body []byte) {
+		s.storeCachedResponse(url, &cachedResponse{headers: headers, body: body})
+	}}
+}
+
+// storeCachedResponse attaches a body to url's cache entry if the entry
+// still exists and the session has room
+func (s *Session) storeCachedResponse(url string, cached *cachedResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry := s.cacheEntries[url]
+	if entry == nil || entry.etag != firstValue(cached.headers, "etag") || entry.lastModified != firstValue(cached.headers, "last-modified") {
+		return // Revalidated with other validators in the meantime
+	}
+	size := len(cached.body)
+	if entry.response != nil {
+		size -= len(entry.response.body)
+	}
+	if s.cachedBodyBytes+size > maxCachedBodies {
+		return
+	}
+	s.cachedBodyBytes += size
+	entry.response = cached
+}
+
+func firstValue(headers map[string][]string, name string) string {
+	if v := headers[name]; len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// bodyCapture copies a body as it is read and hands the copy to done at EOF.
+// Bodies over maxCachedBody, or not read to the end, are not kept.
+type bodyCapture struct {
+	io.ReadCloser
+	buf      bytes.Buffer
+	done     func([]byte)
+	overflow bool
+}
+
+func (c *bodyCapture) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	if !c.overflow {
+		if c.buf.Len()+n > maxCachedBody {
+			c.overflow = true
+			c.buf = bytes.Buffer{}
+		} else {
+			c.buf.Write(p[:n])
+		}
+	}
+	if err == io.EOF && !c.overflow && c.done != nil {
+		c.done(bytes.Clone(c.buf.Bytes()))
+		c.done = nil
+	}
+	return n, err
+}
@@ -0,0 +1,63 @@
+package session
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/sardanioss/httpcloak/protocol"
+	"github.com/sardanioss/httpcloak/transport"
+)
+
+func TestConditionalRevalidation(t *testing.T) {
+	s := &Session{Config: &protocol.SessionConfig{}, cacheEntries: make(map[string]*cacheEntry)}
+	const url = "https://example.com/app.js"
+
+	// First fetch: validators stored, body kept once read to the end
+	first := &transport.Response{
+		StatusCode: 200,
+		Headers: map[string][]string{
+			"etag":         {`"v1"`},
+			"content-type": {"text/javascript"},
+			"set-cookie":   {"a=b"},
+		},
+		Body: io.NopCloser(strings.NewReader("console.log(1)")),
+	}
+	s.storeCacheHeaders(url, first.Headers)
+	s.captureBody(url, first)
+	if _, err := io.ReadAll(first.Body); err != nil {
+		t.Fatal(err)
+	}
+
+	req := &transport.Request{Method: "GET", URL: url, Headers: map[string][]string{}}
+	if !s.applyValidators(req) || req.Headers["If-None-Match"][0] != `"v1"` {
+		t.Fatalf("validators not applied: %v", req.Headers)
+	}
+
+	notModified := &transport.Response{
+		StatusCode: 304,
+		Headers:    map[string][]string{"etag": {`"v1"`}, "cache-control": {"max-age=60"}},
+		Body:       io.NopCloser(strings.NewReader("")),
+	}
+	s.serveNotModified(url, notModified)
+	body, _ := io.ReadAll(notModified.Body)
+	if notModified.StatusCode != 200 || !notModified.Revalidated || string(body) != "console.log(1)" {
+		t.Errorf("304 served as %d %q (revalidated %v)", notModified.StatusCode, body, notModified.Revalidated)
+	}
+	h := notModified.Headers
+	if h["content-type"] == nil || h["cache-control"] == nil || h["set-cookie"] != nil {
+		t.Errorf("served headers = %v", h)
+	}
+
+	// The caller's own validators, and POSTs, are left alone
+	own := &transport.Request{Method: "GET", URL: url, Headers: map[string][]string{"if-none-match": {`"x"`}}}
+	post := &transport.Request{Method: "POST", URL: url, Headers: map[string][]string{}}
+	if s.applyValidators(own) || s.applyValidators(post) {
+		t.Error("validators applied over the caller's or to a POST")
+	}
+
+	s.Config.DisableConditional = true
+	if s.applyValidators(&transport.Request{Method: "GET", URL: url, Headers: map[string][]string{}}) {
+		t.Error("validators applied with DisableConditional")
+	}
+}
@@ -0,0 +1,30 @@
+package session
+
+import (
+	"time"
+
+	"github.com/sardanioss/httpcloak/protocol"
+	"github.com/sardanioss/httpcloak/transport"
+)
+
+// poolConfig returns the connection pool settings in config
+func poolConfig(config *protocol.SessionConfig) transport.PoolConfig {
+	return transport.PoolConfig{
+		MaxIdleConnsPerHost: config.MaxIdleConnsPerHost,
+		MaxConnsPerHost:     config.MaxConnsPerHost,
+		IdleConnTimeout:     time.Duration(config.IdleConnTimeout) * time.Second,
+		MaxConnLifetime:     time.Duration(config.MaxConnLifetime) * time.Second,
+	}
+}
+
+// PoolStats reports the session's open connections per origin and
+// protocol, with how many are idle and how many resumed a TLS session
+func (s *Session) PoolStats() []transport.OriginPoolStats {
+	s.mu.RLock()
+	t := s.transport
+	s.mu.RUnlock()
+	if t == nil {
+		return nil
+	}
+	return t.PoolStats()
+}
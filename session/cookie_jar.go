@@ -5,12 +5,20 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/sardanioss/httpcloak/fingerprint"
+	"github.com/sardanioss/httpcloak/transport"
+	"golang.org/x/net/publicsuffix"
 )
 
 // CookieJar manages cookies with proper domain and path scoping
 // Cookies are stored by domain, then by (path, name) tuple
 type CookieJar struct {
 	mu sync.RWMutex
+	// Largest Cookie header BuildCookieHeader builds; 0 or less is unlimited
+	maxHeaderBytes int
+	// Cookies kept per registrable domain and in total (see SetCookieLimits)
+	maxPerDomain, maxTotal int
 	// Primary key: domain (normalized)
 	// Secondary key: path + "\x00" + name
 	cookies map[string]map[string]*CookieData
@@ -28,16 +36,59 @@ type CookieData struct {
 	Secure    bool
 	HttpOnly  bool
 	SameSite  string
+	Priority  string
 	CreatedAt time.Time
+
+	// Rejected is why the jar refused the cookie, set only on the list
+	// ParseSetCookies returns. Stored cookies leave it empty.
+	Rejected string
+}
+
+// ExpiresAt returns when the cookie expires and false for a session cookie.
+// Max-Age counts from when the jar stored the cookie and wins over Expires.
+func (c *CookieData) ExpiresAt() (time.Time, bool) {
+	if c.MaxAge != 0 {
+		return c.CreatedAt.Add(time.Duration(c.MaxAge) * time.Second), true
+	}
+	if c.Expires != nil {
+		return *c.Expires, true
+	}
+	return time.Time{}, false
+}
+
+// ExpiredAt reports whether the cookie has expired by t
+func (c *CookieData) ExpiredAt(t time.Time) bool {
+	expires, ok := c.ExpiresAt()
+	return ok && !expires.After(t)
 }
 
+// Reasons the jar refuses a Set-Cookie, reported in CookieData.Rejected
+const (
+	RejectDomainMismatch = "domain attribute does not match the request host"
+	RejectInsecure       = "secure cookie set over an insecure connection"
+	RejectPublicSuffix   = "domain attribute is a public suffix"
+	RejectTooLarge       = "name and value exceed 4096 bytes"
+)
+
 // NewCookieJar creates a new empty cookie jar
 func NewCookieJar() *CookieJar {
 	return &CookieJar{
-		cookies: make(map[string]map[string]*CookieData),
+		cookies:        make(map[string]map[string]*CookieData),
+		maxHeaderBytes: fingerprint.MaxCookieHeaderBytes,
+		maxPerDomain:   fingerprint.MaxCookiesPerDomain,
+		maxTotal:       fingerprint.MaxCookies,
 	}
 }
 
+// SetMaxHeaderBytes sets the largest Cookie header BuildCookieHeader builds.
+// Cookies that don't fit are left out in Chrome's eviction order (see
+// fingerprint.FitCookieHeader). 0 or less disables the limit.
+func (j *CookieJar) SetMaxHeaderBytes(n int) {
+	j.mu.Lock()
+	j.maxHeaderBytes = n
+	j.mu.Unlock()
+}
+
 // cookieKey generates a unique key for a cookie within a domain
 func cookieKey(path, name string) string {
 	return path + "\x00" + name
@@ -50,45 +101,21 @@ func (j *CookieJar) Set(requestHost string, cookie *CookieData, requestSecure bo
 	j.mu.Lock()
 	defer j.mu.Unlock()
 
-	// Normalize the request host (lowercase, no port)
-	requestHost = strings.ToLower(requestHost)
-	if idx := strings.LastIndex(requestHost, ":"); idx != -1 {
-		// Check if it's not an IPv6 address
-		if !strings.Contains(requestHost, "]") || idx > strings.Index(requestHost, "]") {
-			requestHost = requestHost[:idx]
-		}
+	requestHost = normalizeRequestHost(requestHost)
+	if rejectReason(requestHost, cookie, requestSecure) != "" {
+		return
 	}
 
-	// Determine effective domain
-	var domain string
-	var hostOnly bool
-
-	if cookie.Domain == "" {
-		// No Domain attribute: host-only cookie
-		domain = requestHost
-		hostOnly = true
-	} else {
-		// Domain attribute specified
-		domain = strings.ToLower(cookie.Domain)
-
-		// Remove leading dot for comparison (we'll add it back for storage)
-		domainWithoutDot := strings.TrimPrefix(domain, ".")
-
-		// Validate: request host must be the domain or a subdomain of it
-		if !isDomainMatch(requestHost, domainWithoutDot) {
-			return // Reject: can't set cookie for unrelated domain
-		}
-
-		// Store with leading dot to indicate it's a domain cookie
-		domain = "." + domainWithoutDot
+	// Determine effective domain: host-only without a Domain attribute (or
+	// with one naming a public suffix), otherwise stored with a leading dot
+	// to mark a domain cookie
+	domain := requestHost
+	hostOnly := true
+	if cookie.Domain != "" && !isPublicSuffix(cookieDomainAttr(cookie)) {
+		domain = "." + cookieDomainAttr(cookie)
 		hostOnly = false
 	}
 
-	// Secure cookies can only be set over HTTPS
-	if cookie.Secure && !requestSecure {
-		return // Reject
-	}
-
 	// Default path if not specified
 	path := cookie.Path
 	if path == "" || path[0] != '/' {
@@ -107,14 +134,57 @@ func (j *CookieJar) Set(requestHost string, cookie *CookieData, requestSecure bo
 		Secure:    cookie.Secure,
 		HttpOnly:  cookie.HttpOnly,
 		SameSite:  cookie.SameSite,
+		Priority:  cookie.Priority,
 		CreatedAt: time.Now(),
 	}
 
-	// Store the cookie
+	// Store the cookie. Replacing one keeps its creation time (RFC 6265
+	// 5.3), so the Cookie header order doesn't shift when a value changes.
 	if j.cookies[domain] == nil {
 		j.cookies[domain] = make(map[string]*CookieData)
 	}
-	j.cookies[domain][cookieKey(path, cookie.Name)] = stored
+	key := cookieKey(path, cookie.Name)
+	if old := j.cookies[domain][key]; old != nil {
+		stored.CreatedAt = old.CreatedAt
+	}
+	j.cookies[domain][key] = stored
+	j.enforceLimits([]string{domain})
+}
+
+// normalizeRequestHost lowercases host and strips its port
+func normalizeRequestHost(requestHost string) string {
+	requestHost = strings.ToLower(requestHost)
+	if idx := strings.LastIndex(requestHost, ":"); idx != -1 {
+		// Check if it's not an IPv6 address
+		if !strings.Contains(requestHost, "]") || idx > strings.Index(requestHost, "]") {
+			requestHost = requestHost[:idx]
+		}
+	}
+	return requestHost
+}
+
+// rejectReason returns why Set would refuse cookie from requestHost, or ""
+func rejectReason(requestHost string, cookie *CookieData, requestSecure bool) string {
+	if cookie.Domain != "" {
+		domain := cookieDomainAttr(cookie)
+		// Request host must be the domain or a subdomain of it
+		if !isDomainMatch(requestHost, domain) {
+			return RejectDomainMismatch
+		}
+		// No supercookies for a whole suffix (Domain=co.uk, Domain=github.io).
+		// The host itself may name its suffix; the cookie becomes host-only.
+		if isPublicSuffix(domain) && domain != requestHost {
+			return RejectPublicSuffix
+		}
+	}
+	// Secure cookies can only be set over HTTPS
+	if cookie.Secure && !requestSecure {
+		return RejectInsecure
+	}
+	if len(cookie.Name)+len(cookie.Value) > fingerprint.MaxCookieBytes {
+		return RejectTooLarge
+	}
+	return ""
 }
 
 // Get returns all cookies that should be sent for a request
@@ -122,8 +192,25 @@ func (j *CookieJar) Set(requestHost string, cookie *CookieData, requestSecure bo
 // requestPath is the request path
 // requestSecure is true if the request is over HTTPS
 func (j *CookieJar) Get(requestHost, requestPath string, requestSecure bool) []*CookieData {
+	return j.GetAt(requestHost, requestPath, requestSecure, time.Now())
+}
+
+// GetAt is Get evaluated as of asOf: cookies that will have expired by then
+// are left out. A scheduler can use it to see whether a request made at asOf
+// would still carry a login cookie.
+func (j *CookieJar) GetAt(requestHost, requestPath string, requestSecure bool, asOf time.Time) []*CookieData {
+	return j.match(requestHost, requestPath, requestSecure, asOf, nil)
+}
+
+// match returns the cookies to send for a request, as GetAt. filtered, if
+// not nil, is called for each cookie of a matching domain left out, with
+// the reason.
+func (j *CookieJar) match(requestHost, requestPath string, requestSecure bool, asOf time.Time, filtered func(c *CookieData, reason string)) []*CookieData {
 	j.mu.RLock()
 	defer j.mu.RUnlock()
+	if filtered == nil {
+		filtered = func(*CookieData, string) {}
+	}
 
 	// Normalize
 	requestHost = strings.ToLower(requestHost)
@@ -137,7 +224,6 @@ func (j *CookieJar) Get(requestHost, requestPath string, requestSecure bool) []*
 		requestPath = "/"
 	}
 
-	now := time.Now()
 	var matches []*CookieData
 
 	// Check all domains that might match
@@ -150,21 +236,25 @@ func (j *CookieJar) Get(requestHost, requestPath string, requestSecure bool) []*
 		for _, cookie := range domainCookies {
 			// Host-only check
 			if cookie.HostOnly && domain != requestHost {
+				filtered(cookie, FilterHostOnly)
 				continue
 			}
 
 			// Path match
 			if !isPathMatch(requestPath, cookie.Path) {
+				filtered(cookie, FilterPath)
 				continue
 			}
 
 			// Secure check
 			if cookie.Secure && !requestSecure {
+				filtered(cookie, FilterSecure)
 				continue
 			}
 
 			// Expiration check
-			if cookie.Expires != nil && cookie.Expires.Before(now) {
+			if cookie.ExpiredAt(asOf) {
+				filtered(cookie, FilterExpired)
 				continue
 			}
 
@@ -172,12 +262,20 @@ func (j *CookieJar) Get(requestHost, requestPath string, requestSecure bool) []*
 		}
 	}
 
-	// Sort: longer path first, then older creation time first
+	// Sort: longer path first, then older creation time first. Name and
+	// domain break ties, so the header doesn't depend on map order.
 	sort.Slice(matches, func(i, k int) bool {
-		if len(matches[i].Path) != len(matches[k].Path) {
-			return len(matches[i].Path) > len(matches[k].Path)
+		a, b := matches[i], matches[k]
+		if len(a.Path) != len(b.Path) {
+			return len(a.Path) > len(b.Path)
 		}
-		return matches[i].CreatedAt.Before(matches[k].CreatedAt)
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.Before(b.CreatedAt)
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Domain < b.Domain
 	})
 
 	return matches
@@ -234,7 +332,7 @@ func (j *CookieJar) ClearExpired() {
 	now := time.Now()
 	for domain, domainCookies := range j.cookies {
 		for key, cookie := range domainCookies {
-			if cookie.Expires != nil && cookie.Expires.Before(now) {
+			if cookie.ExpiredAt(now) {
 				delete(domainCookies, key)
 			}
 		}
@@ -256,19 +354,115 @@ func (j *CookieJar) Count() int {
 	return count
 }
 
+// List returns the unexpired cookies that would be sent to host, regardless of
+// path and Secure. An empty host lists every cookie in the jar.
+func (j *CookieJar) List(host string) []CookieState {
+	return j.ListAt(host, time.Now())
+}
+
+// ListAt is List evaluated as of asOf, leaving out cookies that will have
+// expired by then
+func (j *CookieJar) ListAt(host string, asOf time.Time) []CookieState {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+
+	host = strings.ToLower(host)
+	var matches []*CookieData
+	for domain, domainCookies := range j.cookies {
+		if host != "" && !j.domainMatchesHost(domain, host) {
+			continue
+		}
+		for _, c := range domainCookies {
+			if c.ExpiredAt(asOf) {
+				continue
+			}
+			matches = append(matches, c)
+		}
+	}
+
+	sort.Slice(matches, func(i, k int) bool {
+		if matches[i].Domain != matches[k].Domain {
+			return matches[i].Domain < matches[k].Domain
+		}
+		return matches[i].CreatedAt.Before(matches[k].CreatedAt)
+	})
+
+	result := make([]CookieState, 0, len(matches))
+	for _, c := range matches {
+		createdAt := c.CreatedAt
+		result = append(result, CookieState{
+			Name:      c.Name,
+			Value:     c.Value,
+			Domain:    c.Domain,
+			Path:      c.Path,
+			Expires:   c.Expires,
+			MaxAge:    c.MaxAge,
+			Secure:    c.Secure,
+			HttpOnly:  c.HttpOnly,
+			SameSite:  c.SameSite,
+			Priority:  c.Priority,
+			CreatedAt: &createdAt,
+		})
+	}
+	return result
+}
+
+// Put stores a cookie as given, without the checks applied to Set-Cookie.
+// Domain uses the jar's storage convention: ".example.com" for a domain
+// cookie, "example.com" for a host-only cookie and "" for a global cookie
+// sent to every host.
+func (j *CookieJar) Put(c CookieState) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	domain := strings.ToLower(c.Domain)
+	path := c.Path
+	if path == "" || path[0] != '/' {
+		path = "/"
+	}
+	createdAt := time.Now()
+	if c.CreatedAt != nil {
+		createdAt = *c.CreatedAt
+	}
+
+	if j.cookies[domain] == nil {
+		j.cookies[domain] = make(map[string]*CookieData)
+	}
+	j.cookies[domain][cookieKey(path, c.Name)] = &CookieData{
+		Name:      c.Name,
+		Value:     c.Value,
+		Domain:    domain,
+		HostOnly:  domain != "" && !strings.HasPrefix(domain, "."),
+		Path:      path,
+		Expires:   c.Expires,
+		MaxAge:    c.MaxAge,
+		Secure:    c.Secure,
+		HttpOnly:  c.HttpOnly,
+		SameSite:  c.SameSite,
+		Priority:  c.Priority,
+		CreatedAt: createdAt,
+	}
+	j.enforceLimits([]string{domain})
+}
+
 // Export exports all cookies grouped by domain for serialization
 func (j *CookieJar) Export() map[string][]CookieState {
+	return j.ExportAt(time.Now())
+}
+
+// ExportAt exports the cookies that will still be valid at asOf, so a
+// session persisted for a later job carries only what will work by then
+func (j *CookieJar) ExportAt(asOf time.Time) map[string][]CookieState {
 	j.mu.RLock()
 	defer j.mu.RUnlock()
 
-	now := time.Now()
 	result := make(map[string][]CookieState)
 
 	for domain, domainCookies := range j.cookies {
 		var cookies []CookieState
 		for _, c := range domainCookies {
 			// Skip expired cookies
-			if c.Expires != nil && c.Expires.Before(now) {
+			if c.ExpiredAt(asOf) {
 				continue
 			}
 
@@ -283,6 +477,7 @@ func (j *CookieJar) Export() map[string][]CookieState {
 				Secure:    c.Secure,
 				HttpOnly:  c.HttpOnly,
 				SameSite:  c.SameSite,
+				Priority:  c.Priority,
 				CreatedAt: &createdAt,
 			})
 		}
@@ -337,10 +532,12 @@ func (j *CookieJar) Import(cookies map[string][]CookieState) {
 				Secure:    c.Secure,
 				HttpOnly:  c.HttpOnly,
 				SameSite:  c.SameSite,
+				Priority:  c.Priority,
 				CreatedAt: createdAt,
 			}
 		}
 	}
+	j.enforceLimits(j.storedDomains())
 }
 
 // ImportV4 imports cookies from the v4 format (flat list)
@@ -392,9 +589,11 @@ func (j *CookieJar) ImportV4(cookies []CookieState) {
 			Secure:    c.Secure,
 			HttpOnly:  c.HttpOnly,
 			SameSite:  c.SameSite,
+			Priority:  c.Priority,
 			CreatedAt: now,
 		}
 	}
+	j.enforceLimits(j.storedDomains())
 }
 
 // domainMatchesHost checks if a cookie domain matches a request host
@@ -425,6 +624,19 @@ func (j *CookieJar) domainMatchesHost(cookieDomain, requestHost string) bool {
 	return false
 }
 
+// cookieDomainAttr returns the cookie's Domain attribute lowercased and
+// without its leading dot
+func cookieDomainAttr(cookie *CookieData) string {
+	return strings.TrimPrefix(strings.ToLower(cookie.Domain), ".")
+}
+
+// isPublicSuffix reports whether domain is on the Public Suffix List, ICANN
+// or private section, as browsers treat both
+func isPublicSuffix(domain string) bool {
+	suffix, _ := publicsuffix.PublicSuffix(domain)
+	return suffix == domain
+}
+
 // isDomainMatch checks if host is equal to or a subdomain of domain
 func isDomainMatch(host, domain string) bool {
 	if host == domain {
@@ -460,14 +672,53 @@ func isPathMatch(requestPath, cookiePath string) bool {
 
 // BuildCookieHeader builds the Cookie header value for a request
 func (j *CookieJar) BuildCookieHeader(requestHost, requestPath string, requestSecure bool) string {
-	cookies := j.Get(requestHost, requestPath, requestSecure)
+	return j.buildCookieHeader(requestHost, requestPath, requestSecure, nil)
+}
+
+// buildCookieHeader builds the Cookie header, recording each decision in
+// trace if it isn't nil
+func (j *CookieJar) buildCookieHeader(requestHost, requestPath string, requestSecure bool, trace *transport.CookieTrace) string {
+	var filtered func(c *CookieData, reason string)
+	if trace != nil {
+		filtered = func(c *CookieData, reason string) {
+			trace.Cookies = append(trace.Cookies, cookieDecision(c, false, reason))
+		}
+	}
+	cookies := j.match(requestHost, requestPath, requestSecure, time.Now(), filtered)
 	if len(cookies) == 0 {
 		return ""
 	}
 
+	candidates := make([]fingerprint.CookieCandidate, len(cookies))
+	for i, c := range cookies {
+		candidates[i] = fingerprint.CookieCandidate{
+			Name:     c.Name,
+			Value:    c.Value,
+			Secure:   c.Secure,
+			Priority: fingerprint.ParseCookiePriority(c.Priority),
+			Created:  c.CreatedAt,
+		}
+	}
+	j.mu.RLock()
+	limit := j.maxHeaderBytes
+	j.mu.RUnlock()
+
 	var parts []string
-	for _, c := range cookies {
-		parts = append(parts, c.Name+"="+c.Value)
+	fit := fingerprint.FitCookieHeader(candidates, limit)
+	for _, k := range fit {
+		parts = append(parts, cookies[k].Name+"="+cookies[k].Value)
+	}
+	if trace != nil {
+		sent := make([]bool, len(cookies))
+		for _, k := range fit {
+			trace.Cookies = append(trace.Cookies, cookieDecision(cookies[k], true, ""))
+			sent[k] = true
+		}
+		for k, c := range cookies {
+			if !sent[k] {
+				trace.Cookies = append(trace.Cookies, cookieDecision(c, false, FilterHeaderSize))
+			}
+		}
 	}
 
 	return strings.Join(parts, "; ")
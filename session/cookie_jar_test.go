@@ -0,0 +1,208 @@
+package session
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sardanioss/httpcloak/protocol"
+	"github.com/sardanioss/httpcloak/transport"
+)
+
+func TestParseSetCookies(t *testing.T) {
+	headers := map[string][]string{"Set-Cookie": {
+		"sid=abc; Path=/; Secure; HttpOnly; SameSite=lax",
+		"tracker=1; Domain=other.com",
+		"garbage",
+		"pref=dark; Domain=.example.com",
+	}}
+	cookies := ParseSetCookies(headers, "https://www.example.com/login")
+	if len(cookies) != 3 {
+		t.Fatalf("got %d cookies, want 3", len(cookies))
+	}
+	if c := cookies[0]; c.Name != "sid" || !c.Secure || !c.HttpOnly || c.SameSite != "Lax" || c.Rejected != "" {
+		t.Errorf("sid = %+v", c)
+	}
+	if cookies[1].Rejected != RejectDomainMismatch || cookies[2].Rejected != "" {
+		t.Errorf("rejections = %q, %q", cookies[1].Rejected, cookies[2].Rejected)
+	}
+
+	// The jar keeps exactly the cookies reported as accepted
+	insecure := ParseSetCookies(headers, "http://www.example.com/login")
+	if insecure[0].Rejected != RejectInsecure {
+		t.Errorf("secure cookie over http: Rejected = %q", insecure[0].Rejected)
+	}
+	jar := NewCookieJar()
+	for _, c := range insecure {
+		jar.Set("www.example.com", c, false)
+	}
+	if got := jar.BuildCookieHeader("www.example.com", "/", false); got != "pref=dark" {
+		t.Errorf("jar holds %q, want pref=dark", got)
+	}
+}
+
+func TestCookieJarAsOf(t *testing.T) {
+	jar := NewCookieJar()
+	now := time.Now()
+	inHour := now.Add(time.Hour)
+	jar.Set("example.com", &CookieData{Name: "sid", Value: "1", Expires: &inHour}, true)
+	jar.Set("example.com", &CookieData{Name: "csrf", Value: "2", MaxAge: 600}, true)
+	jar.Set("example.com", &CookieData{Name: "theme", Value: "3"}, true)
+
+	names := func(cookies []*CookieData) (s string) {
+		for _, c := range cookies {
+			s += c.Name + " "
+		}
+		return s
+	}
+	if got := names(jar.GetAt("example.com", "/", true, now.Add(30*time.Minute))); got != "sid theme " {
+		t.Errorf("in 30 minutes: %q", got)
+	}
+	if got := names(jar.GetAt("example.com", "/", true, now.Add(2*time.Hour))); got != "theme " {
+		t.Errorf("in 2 hours: %q", got)
+	}
+	if got := jar.ExportAt(now.Add(5 * time.Minute)); len(got["example.com"]) != 3 {
+		t.Errorf("export in 5 minutes = %v", got)
+	}
+	if got := jar.ListAt("", now.Add(2*time.Hour)); len(got) != 1 || got[0].Name != "theme" {
+		t.Errorf("list in 2 hours = %+v", got)
+	}
+}
+
+func TestCookieJarPublicSuffix(t *testing.T) {
+	headers := map[string][]string{"Set-Cookie": {
+		"super=1; Domain=.co.uk",
+		"pages=1; Domain=github.io",
+		"site=1; Domain=shop.co.uk",
+	}}
+	cookies := ParseSetCookies(headers, "https://www.shop.co.uk/")
+	if cookies[0].Rejected != RejectPublicSuffix || cookies[2].Rejected != "" {
+		t.Errorf("rejections = %q, %q", cookies[0].Rejected, cookies[2].Rejected)
+	}
+	if cookies := ParseSetCookies(headers, "https://me.github.io/"); cookies[1].Rejected != RejectPublicSuffix {
+		t.Errorf("Domain=github.io from me.github.io: Rejected = %q", cookies[1].Rejected)
+	}
+
+	// A host that is itself a public suffix gets a host-only cookie
+	jar := NewCookieJar()
+	jar.Set("github.io", &CookieData{Name: "own", Value: "1", Domain: "github.io"}, true)
+	if got := jar.BuildCookieHeader("github.io", "/", true); got != "own=1" {
+		t.Errorf("github.io holds %q", got)
+	}
+	if got := jar.BuildCookieHeader("me.github.io", "/", true); got != "" {
+		t.Errorf("own cookie leaked to me.github.io: %q", got)
+	}
+}
+
+func TestCookieJarMerge(t *testing.T) {
+	older, newer := time.Unix(100, 0), time.Unix(200, 0)
+	ours := NewCookieJar()
+	ours.Import(map[string][]CookieState{
+		"example.com":     {{Name: "sid", Value: "ours", Domain: "example.com", CreatedAt: &newer}},
+		".login.test.com": {{Name: "auth", Value: "ours", Domain: ".login.test.com", CreatedAt: &newer}},
+	})
+	theirs := NewCookieJar()
+	theirs.Import(map[string][]CookieState{
+		"example.com":     {{Name: "sid", Value: "theirs", Domain: "example.com", CreatedAt: &older}, {Name: "new", Value: "1", Domain: "example.com", CreatedAt: &older}},
+		".login.test.com": {{Name: "auth", Value: "theirs", Domain: ".login.test.com", CreatedAt: &older}},
+	})
+
+	policy := MergePolicy{Domains: map[string]MergeStrategy{"test.com": MergeTheirs}}
+	if n := ours.Merge(theirs, policy); n != 2 {
+		t.Errorf("took %d cookies, want 2", n)
+	}
+	values := map[string]CookieState{}
+	for _, c := range ours.List("") {
+		values[c.Name] = c
+	}
+	if values["sid"].Value != "ours" || values["auth"].Value != "theirs" {
+		t.Errorf("merged = %+v", values)
+	}
+	if c := values["new"]; c.CreatedAt == nil || !c.CreatedAt.Equal(older) {
+		t.Errorf("creation time lost: %+v", c)
+	}
+	if got := ours.BuildCookieHeader("www.example.com", "/", true); got != "" {
+		t.Errorf("host-only cookies sent to a subdomain: %q", got)
+	}
+}
+
+func TestCookieJarLimits(t *testing.T) {
+	big := strings.Repeat("x", 4096)
+	if c := ParseSetCookies(map[string][]string{"Set-Cookie": {"big=" + big}}, "https://example.com/"); c[0].Rejected != RejectTooLarge {
+		t.Errorf("4 KiB value: Rejected = %q", c[0].Rejected)
+	}
+
+	jar := NewCookieJar()
+	jar.SetCookieLimits(6, 0)
+	jar.Set("example.com", &CookieData{Name: "keep", Value: "1", Priority: "High"}, true)
+	for i := range 6 {
+		host := "www.example.com"
+		if i%2 == 1 {
+			host = "api.example.com"
+		}
+		jar.Set(host, &CookieData{Name: "c" + strconv.Itoa(i), Value: "1"}, true)
+		time.Sleep(time.Millisecond)
+	}
+	jar.Set("other.com", &CookieData{Name: "x", Value: "1"}, true)
+
+	// 7 cookies under example.com: purged to 5, the oldest Medium ones first
+	names := map[string]bool{}
+	for _, c := range jar.List("") {
+		names[c.Name] = true
+	}
+	if len(names) != 6 || !names["keep"] || !names["x"] || names["c0"] || names["c1"] {
+		t.Errorf("after eviction: %v", names)
+	}
+
+	// Updating a cookie keeps its place in the header
+	jar.Set("www.example.com", &CookieData{Name: "c2", Value: "2"}, true)
+	if got := jar.BuildCookieHeader("www.example.com", "/", true); got != "c2=2; c4=1" {
+		t.Errorf("header = %q", got)
+	}
+}
+
+func TestCookieJarTrace(t *testing.T) {
+	jar := NewCookieJar()
+	jar.Set("example.com", &CookieData{Name: "sid", Value: "1", Secure: true, SameSite: "Strict"}, true)
+	jar.Set("example.com", &CookieData{Name: "admin", Value: "2", Path: "/admin"}, true)
+	jar.Set("example.com", &CookieData{Name: "old", Value: "3", MaxAge: 60}, true)
+	jar.cookies["example.com"][cookieKey("/", "old")].CreatedAt = time.Now().Add(-time.Hour)
+	jar.Set("other.com", &CookieData{Name: "elsewhere", Value: "4"}, true)
+
+	s := &Session{cookies: jar, Config: &protocol.SessionConfig{CookieTrace: true}}
+	req := &transport.Request{URL: "http://example.com/", Headers: map[string][]string{"Sec-Fetch-Site": {"cross-site"}}}
+	header, trace := s.buildCookieHeader(req, "example.com", "/", false)
+	if header != "" {
+		t.Errorf("Cookie header %q, want none", header)
+	}
+	if len(trace.Cookies) != 3 {
+		t.Fatalf("%d decisions, want 3: %+v", len(trace.Cookies), trace.Cookies)
+	}
+	for name, want := range map[string]string{"sid": FilterSecure, "admin": FilterPath, "old": FilterExpired} {
+		if d, ok := trace.Decision(name); !ok || d.Sent || d.Reason != want {
+			t.Errorf("%s: %+v, want left out for %q", name, d, want)
+		}
+	}
+
+	// Sent over HTTPS, but a browser would hold the Strict cookie back
+	_, trace = s.buildCookieHeader(req, "example.com", "/", true)
+	if d, _ := trace.Decision("sid"); !d.Sent || d.Note != NoteSameSiteStrict {
+		t.Errorf("sid over https: %+v", d)
+	}
+	if sent := trace.Sent(); len(sent) != 1 || len(trace.Filtered()) != 2 {
+		t.Errorf("sent %+v, filtered %+v", sent, trace.Filtered())
+	}
+
+	jar.SetMaxHeaderBytes(3)
+	jar.Set("example.com", &CookieData{Name: "big", Value: strings.Repeat("x", 10)}, true)
+	_, trace = s.buildCookieHeader(req, "example.com", "/", true)
+	if d, _ := trace.Decision("big"); d.Sent || d.Reason != FilterHeaderSize {
+		t.Errorf("oversized cookie: %+v", d)
+	}
+
+	s.Config.CookieTrace = false
+	if _, trace = s.buildCookieHeader(req, "example.com", "/", true); trace != nil {
+		t.Error("trace recorded with tracing off")
+	}
+}
@@ -0,0 +1,116 @@
+package session
+
+import (
+	"strings"
+	"time"
+
+	"github.com/sardanioss/httpcloak/fingerprint"
+	"golang.org/x/net/publicsuffix"
+)
+
+// SetCookieLimits sets how many cookies the jar keeps per registrable
+// domain and in total. Past either limit the jar evicts, expired cookies
+// first and then in Chrome's order (fingerprint.CookieEvictionOrder), down
+// to five sixths of a domain's limit or ten elevenths of the total, as
+// Chrome purges 180 to 150 and 3300 to 3000. 0 or less disables a limit.
+func (j *CookieJar) SetCookieLimits(perDomain, total int) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.maxPerDomain, j.maxTotal = perDomain, total
+	j.enforceLimits(j.storedDomains())
+}
+
+// storedDomains returns every domain key in the jar (caller holds j.mu)
+func (j *CookieJar) storedDomains() []string {
+	domains := make([]string, 0, len(j.cookies))
+	for domain := range j.cookies {
+		domains = append(domains, domain)
+	}
+	return domains
+}
+
+// registrableDomain returns the eTLD+1 a stored domain key counts against.
+// IPs, single labels and the global "" key count on their own.
+func registrableDomain(domain string) string {
+	host := strings.TrimPrefix(domain, ".")
+	if etld1, err := publicsuffix.EffectiveTLDPlusOne(host); err == nil {
+		return etld1
+	}
+	return host
+}
+
+// storedCookie is a cookie with where it is kept, for eviction
+type storedCookie struct {
+	domain, key string
+	cookie      *CookieData
+}
+
+// enforceLimits evicts from the registrable domains of the given domain
+// keys, then from the whole jar, until both limits hold (caller holds j.mu)
+func (j *CookieJar) enforceLimits(changed []string) {
+	now := time.Now()
+	if j.maxPerDomain > 0 {
+		groups := make(map[string]bool)
+		for _, domain := range changed {
+			groups[registrableDomain(domain)] = true
+		}
+		for group := range groups {
+			j.evict(now, j.maxPerDomain, j.maxPerDomain*5/6, func(domain string) bool {
+				return registrableDomain(domain) == group
+			})
+		}
+	}
+	if j.maxTotal > 0 {
+		j.evict(now, j.maxTotal, j.maxTotal*10/11, func(string) bool { return true })
+	}
+}
+
+// evict brings the cookies under the domain keys matched by in down to
+// target once they number more than limit (caller holds j.mu)
+func (j *CookieJar) evict(now time.Time, limit, target int, in func(domain string) bool) {
+	var cookies []storedCookie
+	for domain, domainCookies := range j.cookies {
+		if !in(domain) {
+			continue
+		}
+		for key, c := range domainCookies {
+			cookies = append(cookies, storedCookie{domain, key, c})
+		}
+	}
+	if len(cookies) <= limit {
+		return
+	}
+
+	remove := func(sc storedCookie) {
+		delete(j.cookies[sc.domain], sc.key)
+		if len(j.cookies[sc.domain]) == 0 {
+			delete(j.cookies, sc.domain)
+		}
+	}
+
+	// Expired cookies go first, without counting against the purge
+	live := cookies[:0]
+	for _, sc := range cookies {
+		if sc.cookie.ExpiredAt(now) {
+			remove(sc)
+		} else {
+			live = append(live, sc)
+		}
+	}
+	if len(live) <= limit {
+		return
+	}
+
+	candidates := make([]fingerprint.CookieCandidate, len(live))
+	for i, sc := range live {
+		candidates[i] = fingerprint.CookieCandidate{
+			Name:     sc.cookie.Name,
+			Secure:   sc.cookie.Secure,
+			Priority: fingerprint.ParseCookiePriority(sc.cookie.Priority),
+			Created:  sc.cookie.CreatedAt,
+		}
+	}
+	for _, i := range fingerprint.CookieEvictionOrder(candidates)[:len(live)-target] {
+		remove(live[i])
+	}
+}
@@ -0,0 +1,94 @@
+package session
+
+import (
+	"strings"
+	"time"
+)
+
+// MergeStrategy picks between two cookies with the same domain, path and name
+type MergeStrategy int
+
+const (
+	MergeNewest MergeStrategy = iota // The cookie created later wins
+	MergeTheirs                      // The merged-in jar's cookie wins
+	MergeOurs                        // The receiving jar's cookie wins
+)
+
+// MergePolicy says how CookieJar.Merge settles conflicts. The zero value
+// keeps the newest cookie everywhere.
+type MergePolicy struct {
+	Default MergeStrategy
+
+	// Domains overrides Default for cookies of a domain and its subdomains,
+	// e.g. {"example.com": MergeTheirs} to take a fresh browser export's
+	// login cookies. The longest matching domain applies.
+	Domains map[string]MergeStrategy
+}
+
+// strategyFor returns the strategy for a cookie stored under domain
+func (p MergePolicy) strategyFor(domain string) MergeStrategy {
+	host := strings.TrimPrefix(domain, ".")
+	strategy, matched := p.Default, ""
+	for d, s := range p.Domains {
+		d = strings.TrimPrefix(strings.ToLower(d), ".")
+		if (host == d || strings.HasSuffix(host, "."+d)) && len(d) > len(matched) {
+			strategy, matched = s, d
+		}
+	}
+	return strategy
+}
+
+// Merge copies other's unexpired cookies into j, keeping their creation
+// times and host-only flags. Where both jars hold a cookie with the same
+// domain, path and name, policy picks the one kept. It returns how many of
+// other's cookies were taken.
+func (j *CookieJar) Merge(other *CookieJar, policy MergePolicy) int {
+	if other == nil || other == j {
+		return 0
+	}
+
+	// Snapshot other first so the two jars are never locked together
+	now := time.Now()
+	theirs := make(map[string]map[string]CookieData)
+	other.mu.RLock()
+	for domain, domainCookies := range other.cookies {
+		for key, c := range domainCookies {
+			if c.ExpiredAt(now) {
+				continue
+			}
+			if theirs[domain] == nil {
+				theirs[domain] = make(map[string]CookieData)
+			}
+			theirs[domain][key] = *c
+		}
+	}
+	other.mu.RUnlock()
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	taken := 0
+	var merged []string
+	for domain, domainCookies := range theirs {
+		merged = append(merged, domain)
+		strategy := policy.strategyFor(domain)
+		if j.cookies[domain] == nil {
+			j.cookies[domain] = make(map[string]*CookieData)
+		}
+		for key, c := range domainCookies {
+			if ours, ok := j.cookies[domain][key]; ok && !ours.ExpiredAt(now) {
+				switch strategy {
+				case MergeOurs:
+					continue
+				case MergeNewest:
+					if !c.CreatedAt.After(ours.CreatedAt) {
+						continue
+					}
+				}
+			}
+			j.cookies[domain][key] = &c
+			taken++
+		}
+	}
+	j.enforceLimits(merged)
+	return taken
+}
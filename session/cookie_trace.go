@@ -0,0 +1,91 @@
+package session
+
+import (
+	"strings"
+
+	"github.com/sardanioss/httpcloak/transport"
+)
+
+// Reasons the jar leaves a stored cookie out of a request, reported in
+// transport.CookieDecision.Reason
+const (
+	FilterHostOnly   = "host-only cookie set by another host"
+	FilterPath       = "cookie path does not match the request path"
+	FilterSecure     = "secure cookie on an insecure request"
+	FilterExpired    = "cookie has expired"
+	FilterHeaderSize = "Cookie header size limit reached"
+)
+
+// Notes on sent cookies a browser would have withheld, reported in
+// transport.CookieDecision.Note
+const (
+	NoteSameSiteStrict = "SameSite=Strict cookie on a cross-site request"
+	NoteSameSiteLax    = "SameSite=Lax cookie on a cross-site request that is not a top-level GET navigation"
+)
+
+// SetCookieTrace turns cookie tracing on or off. While on, every response
+// carries a transport.CookieTrace of the cookies the jar held for the
+// request's host: which were sent, and why the others were left out.
+func (s *Session) SetCookieTrace(enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Config != nil {
+		s.Config.CookieTrace = enabled
+	}
+}
+
+// CookieTrace reports whether cookie tracing is on (see SetCookieTrace)
+func (s *Session) CookieTrace() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.Config != nil && s.Config.CookieTrace
+}
+
+// cookieDecision describes the jar's decision on c
+func cookieDecision(c *CookieData, sent bool, reason string) transport.CookieDecision {
+	return transport.CookieDecision{
+		Name:     c.Name,
+		Domain:   c.Domain,
+		Path:     c.Path,
+		SameSite: c.SameSite,
+		Sent:     sent,
+		Reason:   reason,
+	}
+}
+
+// buildCookieHeader builds the Cookie header for req from the jar, and its
+// trace if the session traces cookies
+func (s *Session) buildCookieHeader(req *transport.Request, host, path string, secure bool) (string, *transport.CookieTrace) {
+	if !s.CookieTrace() {
+		return s.cookies.BuildCookieHeader(host, path, secure), nil
+	}
+	trace := &transport.CookieTrace{Host: host, Path: path, Secure: secure}
+	header := s.cookies.buildCookieHeader(host, path, secure, trace)
+	noteSameSite(trace, req)
+	return header, trace
+}
+
+// noteSameSite notes the sent SameSite cookies a browser would withhold
+// from req, judging by its Sec-Fetch-Site and Sec-Fetch-Mode headers
+func noteSameSite(trace *transport.CookieTrace, req *transport.Request) {
+	if !strings.EqualFold(headerValue(req.Headers, "Sec-Fetch-Site"), "cross-site") {
+		return
+	}
+	method := req.Method
+	if method == "" {
+		method = "GET"
+	}
+	topLevelGet := method == "GET" && strings.EqualFold(headerValue(req.Headers, "Sec-Fetch-Mode"), "navigate")
+	for i := range trace.Cookies {
+		d := &trace.Cookies[i]
+		if !d.Sent {
+			continue
+		}
+		switch {
+		case strings.EqualFold(d.SameSite, "Strict"):
+			d.Note = NoteSameSiteStrict
+		case strings.EqualFold(d.SameSite, "Lax") && !topLevelGet:
+			d.Note = NoteSameSiteLax
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package session
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// encryptedStateMagic starts an encrypted session file. It is also the
+// AES-GCM additional data, binding the ciphertext to the format version.
+var encryptedStateMagic = []byte("HCSESS1\x00")
+
+// ErrStateDecrypt is returned when encrypted session data can't be
+// decrypted: the key is wrong or the data was altered
+var ErrStateDecrypt = errors.New("failed to decrypt session state: wrong key or corrupted data")
+
+// IsEncryptedState reports whether data was produced by EncryptState
+func IsEncryptedState(data []byte) bool {
+	return bytes.HasPrefix(data, encryptedStateMagic)
+}
+
+// EncryptState seals serialized session state with AES-GCM. key must be 16,
+// 24 or 32 bytes (AES-128, -192 or -256); a fresh random nonce is used for
+// every call.
+func EncryptState(data, key []byte) ([]byte, error) {
+	gcm, err := stateCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, len(encryptedStateMagic)+len(nonce)+len(data)+gcm.Overhead())
+	out = append(out, encryptedStateMagic...)
+	out = append(out, nonce...)
+	return gcm.Seal(out, nonce, data, encryptedStateMagic), nil
+}
+
+// DecryptState opens data sealed by EncryptState
+func DecryptState(data, key []byte) ([]byte, error) {
+	if !IsEncryptedState(data) {
+		return nil, errors.New("session state is not encrypted")
+	}
+	gcm, err := stateCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	data = data[len(encryptedStateMagic):]
+	if len(data) < gcm.NonceSize()+gcm.Overhead() {
+		return nil, ErrStateDecrypt
+	}
+	nonce, sealed := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	plain, err := gcm.Open(nil, nonce, sealed, encryptedStateMagic)
+	if err != nil {
+		return nil, ErrStateDecrypt
+	}
+	return plain, nil
+}
+
+func stateCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("session state key: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// SaveEncrypted is Save with the file sealed by EncryptState, so the
+// cookies and TLS tickets it holds aren't readable at rest without key
+func (s *Session) SaveEncrypted(path string, key []byte) error {
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+
+	data, err := s.Marshal()
+	if err != nil {
+		return fmt.Errorf("failed to marshal session: %w", err)
+	}
+	sealed, err := EncryptState(data, key)
+	if err != nil {
+		return err
+	}
+	if err := WriteFileAtomic(path, sealed, 0600); err != nil {
+		return fmt.Errorf("failed to write session file: %w", err)
+	}
+	return nil
+}
+
+// LoadEncrypted loads a session saved by SaveEncrypted
+func LoadEncrypted(path string, key []byte) (*Session, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read session file: %w", err)
+	}
+	plain, err := DecryptState(data, key)
+	if err != nil {
+		return nil, err
+	}
+	return UnmarshalSession(plain)
+}
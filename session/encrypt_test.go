@@ -0,0 +1,35 @@
+package session
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestEncryptState(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	plain := []byte(`{"version":5,"cookies":{"example.com":[{"name":"sid","value":"secret"}]}}`)
+	sealed, err := EncryptState(plain, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsEncryptedState(sealed) || bytes.Contains(sealed, []byte("secret")) {
+		t.Fatal("state not sealed")
+	}
+	got, err := DecryptState(sealed, key)
+	if err != nil || !bytes.Equal(got, plain) {
+		t.Fatalf("DecryptState = %q, %v", got, err)
+	}
+
+	wrong := bytes.Repeat([]byte{8}, 32)
+	if _, err := DecryptState(sealed, wrong); !errors.Is(err, ErrStateDecrypt) {
+		t.Errorf("wrong key: %v", err)
+	}
+	sealed[len(sealed)-1] ^= 1
+	if _, err := DecryptState(sealed, key); !errors.Is(err, ErrStateDecrypt) {
+		t.Errorf("tampered data: %v", err)
+	}
+	if _, err := EncryptState(plain, key[:10]); err == nil {
+		t.Error("10-byte key accepted")
+	}
+}
@@ -51,7 +51,10 @@ func (s *Session) forkOne() *Session {
 	var transportConfig *transport.TransportConfig
 	needsConfig := len(cfgCopy.ConnectTo) > 0 || cfgCopy.ECHConfigDomain != "" ||
 		cfgCopy.TLSOnly || cfgCopy.QuicIdleTimeout > 0 || cfgCopy.LocalAddress != "" ||
-		cfgCopy.DisableSpeculativeTLS
+		cfgCopy.DisableSpeculativeTLS || cfgCopy.DisableLatencyPinning || cfgCopy.SSRFProtection || cfgCopy.TLSTicketIsolation != "" || cfgCopy.IdentityKey != "" || poolConfig(&cfgCopy) != (transport.PoolConfig{})
+	if s.options != nil && (s.options.ClientHelloSpecHook != nil || s.options.QUICConfigHook != nil || len(s.options.ClientCertificates) > 0 || len(s.options.CertificatePolicies) > 0 || len(s.options.ConnectionCallbacks) > 0 || s.options.ProxyAuth != nil || s.options.ServerAuth != nil) {
+		needsConfig = true
+	}
 	if needsConfig {
 		transportConfig = &transport.TransportConfig{
 			ConnectTo:             cfgCopy.ConnectTo,
@@ -61,6 +64,20 @@ func (s *Session) forkOne() *Session {
 			LocalAddr:            cfgCopy.LocalAddress,
 			DisableSpeculativeTLS: cfgCopy.DisableSpeculativeTLS,
 		}
+		transportConfig.TicketIsolation, _ = transport.ParseTicketIsolation(cfgCopy.TLSTicketIsolation)
+		transportConfig.IdentityKey = cfgCopy.IdentityKey
+		transportConfig.DisableLatencyPinning = cfgCopy.DisableLatencyPinning
+		transportConfig.SSRFProtection = cfgCopy.SSRFProtection
+		transportConfig.Pool = poolConfig(&cfgCopy)
+		if s.options != nil {
+			transportConfig.ClientHelloSpecHook = s.options.ClientHelloSpecHook
+			transportConfig.QUICConfigHook = s.options.QUICConfigHook
+			transportConfig.ClientCertificates = s.options.ClientCertificates
+			transportConfig.CertificatePolicies = s.options.CertificatePolicies
+			transportConfig.ConnectionCallbacks = s.options.ConnectionCallbacks
+			transportConfig.ProxyAuth = s.options.ProxyAuth
+			transportConfig.ServerAuth = s.options.ServerAuth
+		}
 	}
 
 	// Create new transport
@@ -85,10 +102,31 @@ func (s *Session) forkOne() *Session {
 			dnsCache.SetPreferIPv4(true)
 		}
 	}
+	if len(cfgCopy.DNSServers) > 0 {
+		if dnsCache := t.GetDNSCache(); dnsCache != nil {
+			dnsCache.SetServers(cfgCopy.DNSServers)
+		}
+	}
+	if len(cfgCopy.HeaderRules) > 0 {
+		t.SetHeaderRules(cfgCopy.HeaderRules)
+	}
+	if len(cfgCopy.AllowedHosts) > 0 || len(cfgCopy.BlockedHosts) > 0 {
+		t.SetHostFilter(&transport.HostFilter{Allowed: cfgCopy.AllowedHosts, Blocked: cfgCopy.BlockedHosts})
+	}
+	applyProtocolPolicy(t, &cfgCopy)
 
 	if cfgCopy.DisableECH {
 		t.SetDisableECH(true)
 	}
+	if cfgCopy.StrictMode {
+		t.SetStrictMode(true)
+	}
+	if cfgCopy.RawBody {
+		t.SetRawBody(true)
+	}
+	if cfgCopy.DrainLimit != 0 {
+		t.SetDrainLimit(cfgCopy.DrainLimit)
+	}
 
 	// Share TLS session caches (shared pointers for 0-RTT resumption)
 	if parentH1 := s.transport.GetHTTP1Transport(); parentH1 != nil {
@@ -134,17 +172,20 @@ func (s *Session) forkOne() *Session {
 	}
 
 	return &Session{
-		ID:             generateID(),
-		CreatedAt:      time.Now(),
-		LastUsed:       time.Now(),
-		RequestCount:   0,
-		Config:         &cfgCopy,
-		transport:      t,
-		cookies:        s.cookies, // shared pointer — thread-safe CookieJar
-		cacheEntries:   cacheEntries,
-		clientHints:    clientHints,
-		keyLogWriter:   nil, // no key log on fork to avoid double-close
-		switchProtocol: switchProto,
-		active:         true,
+		ID:              generateID(),
+		CreatedAt:       time.Now(),
+		LastUsed:        time.Now(),
+		RequestCount:    0,
+		Config:          &cfgCopy,
+		transport:       t,
+		cookies:         s.cookies, // shared pointer — thread-safe CookieJar
+		cacheEntries:    cacheEntries,
+		cachedBodyBytes: s.cachedBodyBytes,
+		clientHints:     clientHints,
+		keyLogWriter:    nil, // no key log on fork to avoid double-close
+		switchProtocol:  switchProto,
+		options:         s.options,
+		clock:           s.clock, // same person behind every tab
+		active:          true,
 	}
 }
@@ -0,0 +1,71 @@
+package session
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sardanioss/httpcloak/protocol"
+)
+
+// The fuzz targets cover the parsers fed by servers. Run one with
+// go test ./session -run '^$' -fuzz FuzzParseSetCookies
+
+func FuzzParseSetCookies(f *testing.F) {
+	f.Add("id=1; Path=/; Domain=.example.com; Secure; HttpOnly; SameSite=Lax", "https://www.example.com/login")
+	f.Add("a=b; Max-Age=-1; Expires=Wed, 21 Oct 2015 07:28:00 GMT", "http://example.com")
+	f.Add("__Host-x=y; Path=/; Secure; Priority=High", "https://example.com/")
+	f.Add("=; ;;=;Domain=;Path", "https://[::1]:8443/")
+	f.Fuzz(func(t *testing.T, line, requestURL string) {
+		headers := map[string][]string{"set-cookie": strings.Split(line, "\n")}
+		cookies := ParseSetCookies(headers, requestURL)
+		for _, c := range cookies {
+			if c.Name == "" {
+				t.Fatalf("cookie without a name from %q", line)
+			}
+		}
+
+		s := &Session{cookies: NewCookieJar()}
+		s.extractCookies(headers, requestURL)
+		host := extractHost(requestURL)
+		s.cookies.BuildCookieHeader(host, extractPath(requestURL), isSecureURL(requestURL))
+		s.cookies.Export()
+	})
+}
+
+func FuzzParseSubresources(f *testing.F) {
+	f.Add([]byte(`<link rel="stylesheet" href="/a.css"><link rel=preload as=font href="f.woff2"><script src="//cdn.example.com/x.js"></script><img src="i.png">`), "https://example.com/page")
+	f.Add([]byte(`<img src=><link href rel><script src="javascript:alert(1)"`), "https://example.com")
+	f.Add([]byte("<link rel=icon href='%zz'><img src='http://[::1'>"), "not a url")
+	f.Fuzz(func(t *testing.T, body []byte, baseURL string) {
+		resources := parseSubresources(body, baseURL)
+		if len(resources) > maxSubresources {
+			t.Fatalf("%d subresources, more than %d", len(resources), maxSubresources)
+		}
+		css, js, img := groupByPriority(resources)
+		firstResources(len(resources)/2, css, js, img)
+	})
+}
+
+func FuzzSessionState(f *testing.F) {
+	f.Add([]byte(`{"version":4,"config":{"preset":"chrome-143"},"cookies":[{"name":"a","value":"1","domain":".example.com"}],
+		"tls_sessions":{"h2:example.com:443":{"ticket":"AAAA","state":"AAAA","created_at":"2020-01-01T00:00:00Z"}}}`))
+	f.Add([]byte(`{"version":5,"cookies":{"example.com":[{"name":"b","value":"2","path":"/","expires":"2999-01-01T00:00:00Z"}]},
+		"ech_configs":{"example.com":"!!"},"discovery":{"example.com":{"protocol":"h3"}},"suspended":{"client_hints":{"x":["Sec-CH-UA-Arch"]}}}`))
+	f.Add([]byte(`{"version":3,"preset":"firefox-133","cookies":[{"name":"","value":""}],"tls_sessions":{"::":{}}}`))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		st, err := ReadSessionState(data)
+		if err != nil {
+			return
+		}
+		st.Validate()
+		MergeSessionStates(st, st)
+
+		// Import into a live session, as loading does. The saved config is
+		// replaced: it could name a key log file to write.
+		st.Config = &protocol.SessionConfig{Preset: "chrome-latest"}
+		s := restoreSession(st, nil)
+		defer s.Close()
+		s.CookiesFor("example.com")
+		st.Redact()
+	})
+}
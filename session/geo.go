@@ -0,0 +1,148 @@
+package session
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/sardanioss/httpcloak/fingerprint"
+)
+
+// GeoLookup maps an egress IP to its ISO 3166-1 alpha-2 country code,
+// usually from an offline GeoIP database
+type GeoLookup func(ip netip.Addr) (country string, err error)
+
+// GeoOptions checks that the preset's Accept-Language fits the country
+// requests leave from. A German IP asking for en-US only is a common reason
+// for soft blocks.
+type GeoOptions struct {
+	// Lookup resolves the egress IP's country. Required.
+	Lookup GeoLookup
+
+	// EgressIP is the address servers see. Default: the proxy host's
+	// address, which is right for most datacenter proxies but not for
+	// rotating residential gateways. Without a proxy or EgressIP nothing is
+	// checked.
+	EgressIP netip.Addr
+
+	// Adjust sends the country's Accept-Language instead of the preset's
+	// when they contradict. Otherwise the mismatch is only reported.
+	Adjust bool
+
+	// OnMismatch is called once per egress whose country contradicts the
+	// preset's Accept-Language
+	OnMismatch func(GeoMismatch)
+}
+
+// GeoMismatch describes an Accept-Language that contradicts the egress IP
+type GeoMismatch struct {
+	Proxy          string
+	EgressIP       netip.Addr
+	Country        string
+	AcceptLanguage string // What the preset sends
+	Adjusted       string // What is sent instead ("" unless Adjust is set)
+}
+
+// geoState caches the outcome of the check for the current egress
+type geoState struct {
+	mu             sync.Mutex
+	proxy          string
+	resolved       bool
+	acceptLanguage string // Replacement Accept-Language, "" for none
+}
+
+// applyGeo sets Accept-Language for the egress country when GeoOptions.Adjust
+// is on. An Accept-Language the caller set is left alone.
+func (s *Session) applyGeo(ctx context.Context, headers map[string][]string) {
+	if s.options == nil || s.options.Geo == nil || s.options.Geo.Lookup == nil {
+		return
+	}
+	if s.Config != nil && (s.Config.TLSOnly || s.Config.StrictMode) {
+		return
+	}
+	if headerValue(headers, "Accept-Language") != "" {
+		return
+	}
+	if al := s.geoAcceptLanguage(ctx); al != "" {
+		headers["Accept-Language"] = []string{al}
+	}
+}
+
+// geoAcceptLanguage runs the check once per proxy and returns the
+// Accept-Language to send instead of the preset's, if any
+func (s *Session) geoAcceptLanguage(ctx context.Context) string {
+	opts := s.options.Geo
+	acceptLanguage, mismatch := s.checkGeo(ctx, opts)
+	// Outside g.mu, so the callback may use the session
+	if mismatch != nil && opts.OnMismatch != nil {
+		opts.OnMismatch(*mismatch)
+	}
+	return acceptLanguage
+}
+
+// checkGeo does the work of geoAcceptLanguage under g.mu, returning the
+// mismatch to report the first time one is found for the proxy
+func (s *Session) checkGeo(ctx context.Context, opts *GeoOptions) (string, *GeoMismatch) {
+	proxy := s.GetProxy()
+	g := &s.geo
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.resolved && g.proxy == proxy {
+		return g.acceptLanguage, nil
+	}
+	g.proxy, g.acceptLanguage = proxy, ""
+
+	ip := opts.EgressIP
+	if !ip.IsValid() && proxy != "" {
+		var err error
+		if ip, err = proxyAddr(ctx, proxy); err != nil {
+			return "", nil // Try again on the next request
+		}
+	}
+	g.resolved = true
+	if !ip.IsValid() {
+		return "", nil
+	}
+	country, err := opts.Lookup(ip)
+	if err != nil || country == "" {
+		return "", nil
+	}
+
+	preset := s.transport.GetPreset()
+	current := preset.Headers["Accept-Language"]
+	if current == "" || fingerprint.AcceptLanguageMatchesCountry(current, country) {
+		return "", nil
+	}
+
+	mismatch := &GeoMismatch{
+		Proxy:          proxy,
+		EgressIP:       ip,
+		Country:        strings.ToUpper(country),
+		AcceptLanguage: current,
+	}
+	if opts.Adjust {
+		g.acceptLanguage = fingerprint.AcceptLanguageFor(country, strings.Contains(preset.Name, "firefox"))
+		mismatch.Adjusted = g.acceptLanguage
+	}
+	return g.acceptLanguage, mismatch
+}
+
+// proxyAddr returns the address of a proxy URL's host
+func proxyAddr(ctx context.Context, proxyURL string) (netip.Addr, error) {
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	host := u.Hostname()
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return addr.Unmap(), nil
+	}
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	return addrs[0].Unmap(), nil
+}
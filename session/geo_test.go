@@ -0,0 +1,45 @@
+package session
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/sardanioss/httpcloak/fingerprint"
+	"github.com/sardanioss/httpcloak/protocol"
+)
+
+func TestGeoMismatchCallbackOutsideLock(t *testing.T) {
+	var s *Session
+	var got []GeoMismatch
+	s = NewSessionWithOptions("", &protocol.SessionConfig{Preset: "firefox-133-linux"}, &SessionOptions{
+		Geo: &GeoOptions{
+			Lookup:   func(netip.Addr) (string, error) { return "de", nil },
+			EgressIP: netip.MustParseAddr("192.0.2.1"),
+			Adjust:   true,
+			OnMismatch: func(m GeoMismatch) {
+				got = append(got, m)
+				s.geoAcceptLanguage(context.Background()) // Would deadlock under the lock
+			},
+		},
+	})
+	defer s.Close()
+
+	done := make(chan string, 1)
+	go func() { done <- s.geoAcceptLanguage(context.Background()) }()
+	var al string
+	select {
+	case al = <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("OnMismatch ran with the geo lock held")
+	}
+
+	if len(got) != 1 || got[0].Country != "DE" || got[0].AcceptLanguage != "en-US,en;q=0.5" {
+		t.Fatalf("mismatches = %+v", got)
+	}
+	// The Firefox form, from the session's own preset
+	if want := fingerprint.AcceptLanguageFor("de", true); al != want || got[0].Adjusted != want {
+		t.Errorf("Accept-Language = %q, reported %q", al, got[0].Adjusted)
+	}
+}
@@ -0,0 +1,36 @@
+package session
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/sardanioss/httpcloak/transport"
+)
+
+// doTransport sends req through the transport, hedging it if the session is
+// configured to.
+func (s *Session) doTransport(ctx context.Context, req *transport.Request) (*transport.Response, error) {
+	if delay := s.hedgeDelay(req.Method); delay > 0 {
+		return s.transport.DoHedged(ctx, req, delay)
+	}
+	return s.transport.Do(ctx, req)
+}
+
+// hedgeDelay returns how long to wait before hedging a request with the given
+// method, or 0 if it must not be hedged. Only idempotent methods (RFC 9110
+// section 9.2.2) are hedged unless HedgeAllMethods is set - a duplicated POST
+// may be processed twice by the server.
+func (s *Session) hedgeDelay(method string) time.Duration {
+	if s.Config == nil || s.Config.HedgeDelay <= 0 {
+		return 0
+	}
+	if !s.Config.HedgeAllMethods {
+		switch strings.ToUpper(method) {
+		case "", "GET", "HEAD", "OPTIONS", "TRACE", "PUT", "DELETE":
+		default:
+			return 0
+		}
+	}
+	return time.Duration(s.Config.HedgeDelay) * time.Millisecond
+}
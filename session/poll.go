@@ -0,0 +1,265 @@
+package session
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sardanioss/httpcloak/transport"
+)
+
+// PollOptions tunes Session.Poll
+type PollOptions struct {
+	// Headers are sent with every poll
+	Headers map[string][]string
+
+	// MaxBackoff caps the wait after consecutive failures, which doubles
+	// from the interval (default 16 times the interval)
+	MaxBackoff time.Duration
+
+	// EmitUnchanged also reports polls that found nothing new
+	EmitUnchanged bool
+}
+
+// PollEvent is the outcome of one poll
+type PollEvent struct {
+	URL        string
+	Time       time.Time
+	StatusCode int
+	Headers    map[string][]string
+	Body       []byte
+
+	// Changed is set when the resource differs from the previous successful
+	// poll, and on the first one
+	Changed bool
+
+	// Err is a transport error, or a 429/5xx status, after which the poller
+	// backs off
+	Err error
+}
+
+// Poll fetches url every interval and reports what it finds on the returned
+// channel, which is closed once ctx is done or the session closes. Polls are
+// conditional: the session's validators make unchanged resources cheap 304s
+// (see protocol.SessionConfig.DisableConditional), and bodies are compared
+// otherwise. Intervals are varied by the session's timing profile and
+// doubled after failures.
+//
+// Polls of the same URL with the same headers and interval share one
+// poller: each caller gets every event, and a caller joining late starts
+// with the latest one.
+func (s *Session) Poll(ctx context.Context, url string, interval time.Duration, opts PollOptions) <-chan PollEvent {
+	ch := make(chan PollEvent, 1)
+	if interval <= 0 {
+		ch <- PollEvent{URL: url, Time: time.Now(), Err: errors.New("poll interval must be positive")}
+		close(ch)
+		return ch
+	}
+	sub := &pollSubscriber{ctx: ctx, ch: ch}
+	key := pollKey(url, interval, opts.Headers)
+
+	s.pollMu.Lock()
+	p := s.pollers[key]
+	if p == nil {
+		if s.pollers == nil {
+			s.pollers = make(map[string]*poller)
+		}
+		// The poller keeps ctx's values (trace, identity) but outlives the
+		// first caller as long as others are listening
+		pctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		p = &poller{
+			s:        s,
+			key:      key,
+			url:      url,
+			interval: interval,
+			opts:     opts,
+			cancel:   cancel,
+			done:     make(chan struct{}),
+		}
+		s.pollers[key] = p
+		go p.run(pctx)
+	}
+	p.mu.Lock()
+	p.subs = append(p.subs, sub)
+	if p.last != nil {
+		ch <- *p.last
+	}
+	p.mu.Unlock()
+	s.pollMu.Unlock()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			p.unsubscribe(sub)
+		case <-p.done:
+		}
+	}()
+	return ch
+}
+
+// pollKey identifies polls that can share a poller
+func pollKey(url string, interval time.Duration, headers map[string][]string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\x00%d", url, interval)
+	fields := make([]string, 0, len(headers))
+	for name, values := range headers {
+		fields = append(fields, strings.ToLower(name)+"="+strings.Join(values, ","))
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		b.WriteString("\x00" + field)
+	}
+	return b.String()
+}
+
+type pollSubscriber struct {
+	ctx    context.Context
+	ch     chan PollEvent
+	closed bool
+}
+
+// poller runs the polls shared by its subscribers
+type poller struct {
+	s        *Session
+	key      string
+	url      string
+	interval time.Duration
+	opts     PollOptions
+	cancel   context.CancelFunc
+	done     chan struct{} // Closed when the poller ends
+
+	mu   sync.Mutex
+	subs []*pollSubscriber
+	last *PollEvent
+}
+
+func (p *poller) run(ctx context.Context) {
+	defer p.stop()
+
+	clock := p.s.clockFor(ctx)
+	maxBackoff := p.opts.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = 16 * p.interval
+	}
+
+	var prevBody []byte
+	first := true
+	wait := p.interval
+	for {
+		ev := p.poll(ctx)
+		if errors.Is(ev.Err, ErrSessionClosed) || ctx.Err() != nil {
+			return
+		}
+		if ev.Err != nil {
+			wait = min(2*wait, maxBackoff)
+		} else {
+			wait = p.interval
+			ev.Changed = first || !bytes.Equal(ev.Body, prevBody)
+			prevBody, first = ev.Body, false
+		}
+		if ev.Err != nil || ev.Changed || p.opts.EmitUnchanged {
+			p.publish(ev)
+		}
+		if sleepCtx(ctx, clock.Delay(wait)) != nil {
+			return
+		}
+	}
+}
+
+// poll makes one request. A 304 the session could not serve from its
+// cache (and so passed on) carries the previous body forward.
+func (p *poller) poll(ctx context.Context) PollEvent {
+	ev := PollEvent{URL: p.url, Time: time.Now()}
+	headers := make(map[string][]string, len(p.opts.Headers))
+	for k, v := range p.opts.Headers {
+		headers[k] = append([]string(nil), v...)
+	}
+	resp, err := p.s.Request(ctx, &transport.Request{Method: "GET", URL: p.url, Headers: headers})
+	if err != nil {
+		ev.Err = err
+		return ev
+	}
+	defer resp.Body.Close()
+	ev.StatusCode, ev.Headers = resp.StatusCode, resp.Headers
+	if resp.StatusCode == 304 {
+		p.mu.Lock()
+		if p.last != nil {
+			ev.Body = p.last.Body
+		}
+		p.mu.Unlock()
+		return ev
+	}
+	if ev.Body, err = io.ReadAll(resp.Body); err != nil {
+		ev.Err = err
+		return ev
+	}
+	if resp.StatusCode == 429 || resp.StatusCode >= 500 {
+		ev.Err = fmt.Errorf("poll %s: status %d", p.url, resp.StatusCode)
+	}
+	return ev
+}
+
+// publish hands ev to every subscriber, waiting for slow ones unless they
+// leave
+func (p *poller) publish(ev PollEvent) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if ev.Err == nil {
+		p.last = &ev
+	}
+	for _, sub := range p.subs {
+		select {
+		case sub.ch <- ev:
+		case <-sub.ctx.Done():
+		}
+	}
+}
+
+// unsubscribe closes sub's channel; the last subscriber out stops the poller
+func (p *poller) unsubscribe(sub *pollSubscriber) {
+	p.s.pollMu.Lock()
+	defer p.s.pollMu.Unlock()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, other := range p.subs {
+		if other == sub {
+			p.subs = append(p.subs[:i], p.subs[i+1:]...)
+			break
+		}
+	}
+	if !sub.closed {
+		sub.closed = true
+		close(sub.ch)
+	}
+	if len(p.subs) == 0 {
+		p.cancel()
+		if p.s.pollers[p.key] == p {
+			delete(p.s.pollers, p.key)
+		}
+	}
+}
+
+// stop closes every subscriber's channel once the poller ends on its own
+func (p *poller) stop() {
+	p.s.pollMu.Lock()
+	defer p.s.pollMu.Unlock()
+	if p.s.pollers[p.key] == p {
+		delete(p.s.pollers, p.key)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, sub := range p.subs {
+		if !sub.closed {
+			sub.closed = true
+			close(sub.ch)
+		}
+	}
+	p.cancel()
+	close(p.done)
+}
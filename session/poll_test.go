@@ -0,0 +1,17 @@
+package session
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPollKey(t *testing.T) {
+	a := pollKey("https://example.com/feed", time.Second, map[string][]string{"Accept": {"application/json"}, "X-Id": {"1"}})
+	b := pollKey("https://example.com/feed", time.Second, map[string][]string{"x-id": {"1"}, "accept": {"application/json"}})
+	if a != b {
+		t.Errorf("same poll, different keys: %q, %q", a, b)
+	}
+	if a == pollKey("https://example.com/feed", 2*time.Second, map[string][]string{"Accept": {"application/json"}, "X-Id": {"1"}}) {
+		t.Error("polls at different intervals share a key")
+	}
+}
@@ -0,0 +1,339 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sardanioss/httpcloak/protocol"
+)
+
+// ErrPoolClosed is returned by Checkout once the pool is closed
+var ErrPoolClosed = errors.New("session pool is closed")
+
+// ErrPoolExhausted is returned by Checkout when every session has been
+// retired and none could be replaced
+var ErrPoolExhausted = errors.New("session pool has no sessions left")
+
+// PoolOptions configures a SessionPool
+type PoolOptions struct {
+	// Size is the number of sessions (default 1)
+	Size int
+
+	// New creates the session for slot i, both at start and to replace a
+	// retired one. Default: a session with Presets[i % len(Presets)]
+	// ("chrome-latest" if empty) and Proxies[i % len(Proxies)].
+	New func(i int) (*Session, error)
+
+	// Presets and Proxies are spread over the slots by the default New
+	Presets []string
+	Proxies []string
+
+	// RequestBudget retires a session once it has made this many requests
+	// (redirects included). 0 is unlimited.
+	RequestBudget int64
+
+	// Cooldown is how long a checked-in session rests before it is handed
+	// out again
+	Cooldown time.Duration
+
+	// MaxFlags retires a session flagged this many times (default 1)
+	MaxFlags int
+
+	// NoReplace leaves retired slots empty instead of creating a new
+	// session for them
+	NoReplace bool
+
+	// OnRetire is called with each retired session (already closed) and
+	// why: "budget", "flagged", "closed" (by the caller) or the reason
+	// passed to Lease.Retire
+	OnRetire func(s *Session, reason string)
+}
+
+// SessionPool hands out sessions with distinct presets and proxies, one
+// caller at a time each, resting them between uses and retiring those that
+// run out of budget or get flagged (blocked, challenged).
+type SessionPool struct {
+	opts PoolOptions
+
+	mu      sync.Mutex
+	slots   []*poolSlot
+	changed chan struct{} // Closed and replaced when a slot frees up
+	retired int
+	closed  bool
+}
+
+type poolSlot struct {
+	index   int
+	session *Session
+	inUse   bool
+	readyAt time.Time // End of the cooldown
+	flags   int
+	lastErr error // Why the slot is empty, if it is
+
+	replacing bool // A new session is being created for the slot
+}
+
+// Lease is a session checked out of a SessionPool. Check it in, or retire
+// it, when done.
+type Lease struct {
+	Session *Session
+
+	pool *SessionPool
+	slot *poolSlot
+	once sync.Once
+}
+
+// PoolStats describes a SessionPool
+type PoolStats struct {
+	Sessions int // Live sessions
+	InUse    int
+	Cooling  int // Checked in and resting
+	Retired  int // Sessions retired so far
+}
+
+// NewSessionPool creates the pool's sessions
+func NewSessionPool(opts PoolOptions) (*SessionPool, error) {
+	if opts.Size <= 0 {
+		opts.Size = 1
+	}
+	if opts.MaxFlags <= 0 {
+		opts.MaxFlags = 1
+	}
+	if opts.New == nil {
+		presets, proxies := opts.Presets, opts.Proxies
+		opts.New = func(i int) (*Session, error) {
+			config := &protocol.SessionConfig{Preset: "chrome-latest"}
+			if len(presets) > 0 {
+				config.Preset = presets[i%len(presets)]
+			}
+			if len(proxies) > 0 {
+				config.Proxy = proxies[i%len(proxies)]
+			}
+			return NewSession("", config), nil
+		}
+	}
+
+	p := &SessionPool{opts: opts, changed: make(chan struct{})}
+	for i := 0; i < opts.Size; i++ {
+		s, err := opts.New(i)
+		if err != nil {
+			p.Close()
+			return nil, fmt.Errorf("session pool slot %d: %w", i, err)
+		}
+		p.slots = append(p.slots, &poolSlot{index: i, session: s})
+	}
+	return p, nil
+}
+
+// Checkout hands out the session that has been ready longest, waiting for
+// one to be checked in or to finish its cooldown until ctx is done
+func (p *SessionPool) Checkout(ctx context.Context) (*Lease, error) {
+	for {
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			return nil, ErrPoolClosed
+		}
+		now := time.Now()
+		var ready, next *poolSlot
+		live := 0
+		for _, slot := range p.slots {
+			if slot.replacing {
+				live++
+			}
+			if slot.session == nil {
+				continue
+			}
+			live++
+			if slot.inUse {
+				continue
+			}
+			if !slot.readyAt.After(now) {
+				if ready == nil || slot.readyAt.Before(ready.readyAt) {
+					ready = slot
+				}
+			} else if next == nil || slot.readyAt.Before(next.readyAt) {
+				next = slot
+			}
+		}
+		if ready != nil {
+			ready.inUse = true
+			p.mu.Unlock()
+			return &Lease{Session: ready.session, pool: p, slot: ready}, nil
+		}
+		if live == 0 {
+			err := ErrPoolExhausted
+			for _, slot := range p.slots {
+				if slot.lastErr != nil {
+					err = fmt.Errorf("%w: %w", ErrPoolExhausted, slot.lastErr)
+				}
+			}
+			p.mu.Unlock()
+			return nil, err
+		}
+		changed := p.changed
+		p.mu.Unlock()
+
+		var wake <-chan time.Time
+		var timer *time.Timer
+		if next != nil {
+			timer = time.NewTimer(time.Until(next.readyAt))
+			wake = timer.C
+		}
+		select {
+		case <-changed:
+		case <-wake:
+		case <-ctx.Done():
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Checkin returns the session to the pool. It rests for the pool's
+// Cooldown, unless it has used up its request budget, which retires it.
+func (l *Lease) Checkin() {
+	l.release("")
+}
+
+// Flag records that the session was blocked or challenged and checks it
+// in. It is retired once flagged MaxFlags times.
+func (l *Lease) Flag() {
+	l.release("flagged")
+}
+
+// Retire closes the session and checks in its slot, which gets a new
+// session unless the pool has NoReplace
+func (l *Lease) Retire(reason string) {
+	if reason == "" {
+		reason = "retired"
+	}
+	l.release(reason)
+}
+
+// release checks the lease in once. reason is "" for a plain checkin.
+func (l *Lease) release(reason string) {
+	l.once.Do(func() { l.pool.release(l.slot, reason) })
+}
+
+func (p *SessionPool) release(slot *poolSlot, reason string) {
+	p.mu.Lock()
+	slot.inUse = false
+	slot.readyAt = time.Now().Add(p.opts.Cooldown)
+
+	s := slot.session
+	switch {
+	case reason == "flagged":
+		slot.flags++
+		if slot.flags < p.opts.MaxFlags {
+			reason = ""
+		}
+	case reason == "" && !s.IsActive():
+		reason = "closed"
+	case reason == "" && p.opts.RequestBudget > 0 && s.requestCount() >= p.opts.RequestBudget:
+		reason = "budget"
+	}
+	closed := p.closed
+	if reason != "" || closed {
+		slot.session = nil
+	}
+	if reason != "" {
+		p.retired++
+		slot.replacing = !closed && !p.opts.NoReplace
+	}
+	p.mu.Unlock()
+
+	if reason != "" || closed {
+		s.Close()
+	}
+	if reason != "" {
+		if p.opts.OnRetire != nil {
+			p.opts.OnRetire(s, reason)
+		}
+		if !closed && !p.opts.NoReplace {
+			p.replace(slot)
+		}
+	}
+
+	p.mu.Lock()
+	close(p.changed)
+	p.changed = make(chan struct{})
+	p.mu.Unlock()
+}
+
+// replace creates a new session for an emptied slot
+func (p *SessionPool) replace(slot *poolSlot) {
+	s, err := p.opts.New(slot.index)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	slot.replacing = false
+	if err != nil {
+		slot.lastErr = err
+		return
+	}
+	if p.closed {
+		s.Close()
+		return
+	}
+	slot.session, slot.flags, slot.lastErr = s, 0, nil
+	slot.readyAt = time.Time{}
+}
+
+// Stats returns the pool's current counts
+func (p *SessionPool) Stats() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	stats := PoolStats{Retired: p.retired}
+	for _, slot := range p.slots {
+		if slot.session == nil {
+			continue
+		}
+		stats.Sessions++
+		if slot.inUse {
+			stats.InUse++
+		} else if slot.readyAt.After(now) {
+			stats.Cooling++
+		}
+	}
+	return stats
+}
+
+// Close closes the sessions that aren't checked out; the others close when
+// they are checked in. Checkout fails from then on.
+func (p *SessionPool) Close() {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.closed = true
+	var idle []*Session
+	for _, slot := range p.slots {
+		if slot.session != nil && !slot.inUse {
+			idle = append(idle, slot.session)
+			slot.session = nil
+		}
+	}
+	close(p.changed)
+	p.changed = make(chan struct{})
+	p.mu.Unlock()
+
+	for _, s := range idle {
+		s.Close()
+	}
+}
+
+func (s *Session) requestCount() int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.RequestCount
+}
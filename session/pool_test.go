@@ -0,0 +1,70 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSessionPool(t *testing.T) {
+	created := 0
+	var retired []string
+	pool, err := NewSessionPool(PoolOptions{
+		Size: 2,
+		New: func(i int) (*Session, error) {
+			created++
+			return &Session{ID: strconv.Itoa(created), active: true}, nil
+		},
+		RequestBudget: 3,
+		Cooldown:      time.Hour,
+		MaxFlags:      2,
+		OnRetire:      func(s *Session, reason string) { retired = append(retired, s.ID+":"+reason) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	a, err := pool.Checkout(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := pool.Checkout(context.Background())
+	if err != nil || b.Session == a.Session {
+		t.Fatalf("second checkout = %v, %v", b, err)
+	}
+
+	// Both are out, then cooling down
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := pool.Checkout(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("checkout of a busy pool: %v", err)
+	}
+	a.Flag()
+	a.Checkin() // A lease is released once
+	if st := pool.Stats(); st.InUse != 1 || st.Cooling != 1 || st.Retired != 0 {
+		t.Fatalf("stats after flag = %+v", st)
+	}
+
+	// Running out of budget replaces the session
+	b.Session.RequestCount = 3
+	b.Checkin()
+	if len(retired) != 1 || retired[0] != "2:budget" || b.Session.IsActive() {
+		t.Fatalf("retired = %v", retired)
+	}
+	c, err := pool.Checkout(context.Background())
+	if err != nil || c.Session.ID != "3" {
+		t.Fatalf("checkout after retirement = %+v, %v", c, err)
+	}
+	c.Retire("")
+	if st := pool.Stats(); st.Sessions != 2 || st.Retired != 2 || retired[1] != "3:retired" {
+		t.Fatalf("stats after retire = %+v, %v", st, retired)
+	}
+
+	pool.Close()
+	if _, err := pool.Checkout(context.Background()); !errors.Is(err, ErrPoolClosed) {
+		t.Fatalf("checkout of a closed pool: %v", err)
+	}
+}
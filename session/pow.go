@@ -0,0 +1,188 @@
+package session
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+	"math/bits"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ChallengePoW is a proof-of-work puzzle, solved locally (see PoWOptions)
+const ChallengePoW ChallengeType = "pow"
+
+// defaultMaxPoWDifficulty bounds the work a puzzle may ask for: 2^24
+// hashes, about a second of SHA-256
+const defaultMaxPoWDifficulty = 24
+
+// PoWChallenge is a hashcash-style puzzle: find a counter such that the hash
+// of Prefix followed by the counter in decimal starts with Difficulty zero
+// bits
+type PoWChallenge struct {
+	Algorithm  string // "sha256" (default), "sha1" or "sha512"
+	Prefix     string
+	Difficulty int // Leading zero bits
+
+	// Stamp sends Prefix+counter as the answer, as hashcash does, instead
+	// of the counter alone
+	Stamp bool
+
+	// Header or Field is where the page wants the answer, if it says.
+	// Otherwise ChallengeOptions.Header and Field apply, then field "pow".
+	Header string
+	Field  string
+}
+
+// PoWParser finds a proof-of-work puzzle in a response, or returns nil. html
+// is empty for responses that aren't HTML.
+type PoWParser func(pageURL string, headers map[string][]string, html string) *PoWChallenge
+
+// PoWOptions enables solving proof-of-work challenges in ChallengeOptions
+type PoWOptions struct {
+	// Parsers are tried in order. Default: DefaultPoWParsers.
+	Parsers []PoWParser
+
+	// MaxDifficulty refuses puzzles asking for more leading zero bits, which
+	// would stall the request. Default: 24.
+	MaxDifficulty int
+}
+
+// DefaultPoWParsers recognize a hashcash stamp in an X-Hashcash response
+// header and data-pow-* attributes on a page
+var DefaultPoWParsers = []PoWParser{ParseHashcashHeader, ParsePoWAttributes}
+
+// detect runs the parsers over a response
+func (o *PoWOptions) detect(pageURL string, statusCode int, headers map[string][]string, html string) *Challenge {
+	parsers := o.Parsers
+	if parsers == nil {
+		parsers = DefaultPoWParsers
+	}
+	for _, parse := range parsers {
+		if p := parse(pageURL, headers, html); p != nil {
+			return &Challenge{Type: ChallengePoW, URL: pageURL, StatusCode: statusCode, HTML: html, PoW: p}
+		}
+	}
+	return nil
+}
+
+func (o *PoWOptions) maxDifficulty() int {
+	if o.MaxDifficulty > 0 {
+		return o.MaxDifficulty
+	}
+	return defaultMaxPoWDifficulty
+}
+
+// ParseHashcashHeader reads a hashcash v1 stamp without its counter,
+// "1:bits:date:resource:ext:rand:", from the X-Hashcash response header. The
+// stamp completed with the counter goes back in the same request header.
+func ParseHashcashHeader(pageURL string, headers map[string][]string, html string) *PoWChallenge {
+	stamp := headerValue(headers, "X-Hashcash")
+	parts := strings.Split(stamp, ":")
+	if len(parts) != 7 || parts[0] != "1" || parts[6] != "" {
+		return nil
+	}
+	difficulty, err := strconv.Atoi(parts[1])
+	if err != nil || difficulty <= 0 {
+		return nil
+	}
+	return &PoWChallenge{
+		Algorithm:  "sha1",
+		Prefix:     stamp,
+		Difficulty: difficulty,
+		Stamp:      true,
+		Header:     "X-Hashcash",
+	}
+}
+
+var (
+	powTagPattern        = regexp.MustCompile(`(?i)<[^>]*\bdata-pow-challenge\s*=[^>]*>`)
+	powChallengePattern  = regexp.MustCompile(`(?i)\bdata-pow-challenge\s*=\s*["']([^"']+)["']`)
+	powDifficultyPattern = regexp.MustCompile(`(?i)\bdata-pow-difficulty\s*=\s*["']?(\d+)`)
+	powAlgorithmPattern  = regexp.MustCompile(`(?i)\bdata-pow-algorithm\s*=\s*["']([\w-]+)["']`)
+	powFieldPattern      = regexp.MustCompile(`(?i)\bdata-pow-field\s*=\s*["']([^"']+)["']`)
+)
+
+// ParsePoWAttributes reads a puzzle from the element carrying
+// data-pow-challenge (the prefix) and data-pow-difficulty (zero bits), with
+// optional data-pow-algorithm and data-pow-field
+func ParsePoWAttributes(pageURL string, headers map[string][]string, html string) *PoWChallenge {
+	tag := powTagPattern.FindString(html)
+	if tag == "" {
+		return nil
+	}
+	challenge := powChallengePattern.FindStringSubmatch(tag)
+	difficulty := powDifficultyPattern.FindStringSubmatch(tag)
+	if challenge == nil || difficulty == nil {
+		return nil
+	}
+	p := &PoWChallenge{Prefix: challenge[1]}
+	p.Difficulty, _ = strconv.Atoi(difficulty[1])
+	if m := powAlgorithmPattern.FindStringSubmatch(tag); m != nil {
+		p.Algorithm = strings.ToLower(strings.ReplaceAll(m[1], "-", ""))
+	}
+	if m := powFieldPattern.FindStringSubmatch(tag); m != nil {
+		p.Field = m[1]
+	}
+	return p
+}
+
+// powHash returns the hash function for a puzzle's algorithm
+func powHash(algorithm string) (func() hash.Hash, error) {
+	switch strings.ToLower(algorithm) {
+	case "", "sha256":
+		return sha256.New, nil
+	case "sha1":
+		return sha1.New, nil
+	case "sha512":
+		return sha512.New, nil
+	}
+	return nil, fmt.Errorf("unsupported proof-of-work algorithm %q", algorithm)
+}
+
+// leadingZeroBits counts the zero bits at the start of sum
+func leadingZeroBits(sum []byte) int {
+	n := 0
+	for _, b := range sum {
+		if b != 0 {
+			return n + bits.LeadingZeros8(b)
+		}
+		n += 8
+	}
+	return n
+}
+
+// SolvePoW finds the answer to p, refusing puzzles harder than maxDifficulty
+// bits (0 for no limit). It checks ctx as it goes.
+func SolvePoW(ctx context.Context, p *PoWChallenge, maxDifficulty int) (string, error) {
+	newHash, err := powHash(p.Algorithm)
+	if err != nil {
+		return "", err
+	}
+	if p.Difficulty < 0 || (maxDifficulty > 0 && p.Difficulty > maxDifficulty) {
+		return "", fmt.Errorf("proof-of-work difficulty %d exceeds the limit of %d bits", p.Difficulty, maxDifficulty)
+	}
+
+	h := newHash()
+	buf := []byte(p.Prefix)
+	var sum []byte
+	for counter := uint64(0); ; counter++ {
+		if counter&0xfff == 0 && ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		buf = strconv.AppendUint(buf[:len(p.Prefix)], counter, 10)
+		h.Reset()
+		h.Write(buf)
+		sum = h.Sum(sum[:0])
+		if leadingZeroBits(sum) >= p.Difficulty {
+			if p.Stamp {
+				return string(buf), nil
+			}
+			return strconv.FormatUint(counter, 10), nil
+		}
+	}
+}
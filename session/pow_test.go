@@ -0,0 +1,51 @@
+package session
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"strconv"
+	"testing"
+)
+
+func TestSolvePoW(t *testing.T) {
+	html := `<form><div id="pow" data-pow-challenge="a1b2c3" data-pow-difficulty="12" data-pow-field="pow_nonce"></div></form>`
+	p := ParsePoWAttributes("https://example.com/", nil, html)
+	if p == nil || p.Prefix != "a1b2c3" || p.Difficulty != 12 || p.Field != "pow_nonce" {
+		t.Fatalf("parsed %+v", p)
+	}
+	answer, err := SolvePoW(context.Background(), p, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := strconv.ParseUint(answer, 10, 64); err != nil {
+		t.Fatalf("answer %q is not a counter", answer)
+	}
+	sum := sha256.Sum256([]byte(p.Prefix + answer))
+	if leadingZeroBits(sum[:]) < 12 {
+		t.Errorf("sha256(%s%s) = %x lacks 12 zero bits", p.Prefix, answer, sum)
+	}
+
+	// A hashcash stamp is answered with the completed stamp
+	headers := map[string][]string{"x-hashcash": {"1:10:260101:example.com::c2FsdA==:"}}
+	p = ParseHashcashHeader("", headers, "")
+	if p == nil || p.Algorithm != "sha1" || p.Header != "X-Hashcash" {
+		t.Fatalf("hashcash parsed %+v", p)
+	}
+	stamp, err := SolvePoW(context.Background(), p, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum := sha1.Sum([]byte(stamp)); leadingZeroBits(sum[:]) < 10 || stamp[:len(p.Prefix)] != p.Prefix {
+		t.Errorf("stamp %q = %x", stamp, sum)
+	}
+
+	if _, err := SolvePoW(context.Background(), &PoWChallenge{Difficulty: 40}, defaultMaxPoWDifficulty); err == nil {
+		t.Error("puzzle over the difficulty limit was attempted")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := SolvePoW(ctx, &PoWChallenge{Difficulty: 64}, 0); err != context.Canceled {
+		t.Errorf("canceled solve = %v", err)
+	}
+}
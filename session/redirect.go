@@ -0,0 +1,173 @@
+package session
+
+import (
+	"context"
+	"net/url"
+	"strings"
+
+	"github.com/sardanioss/httpcloak/fingerprint"
+	"github.com/sardanioss/httpcloak/transport"
+)
+
+// redirectChain carries browser state across a redirect chain so Referer,
+// Origin and Sec-Fetch-Site set on the first request are recomputed per hop
+// instead of being copied unchanged.
+type redirectChain struct {
+	referrer  string // Referer of the first request
+	initiator string // Origin of the page that started the chain
+	site      fingerprint.FetchSite
+	origin    string // "null" once tainted by a cross-origin hop
+	policy    string // Referrer policy, updated by Referrer-Policy responses
+}
+
+func startRedirectChain(headers map[string][]string) *redirectChain {
+	chain := &redirectChain{
+		referrer: headerValue(headers, "Referer"),
+		site:     fingerprint.FetchSite(headerValue(headers, "Sec-Fetch-Site")),
+		origin:   headerValue(headers, "Origin"),
+	}
+	if ref, err := url.Parse(chain.referrer); err == nil && ref.Host != "" {
+		chain.initiator = ref.Scheme + "://" + ref.Host
+	}
+	return chain
+}
+
+// next returns the chain state after following a redirect from fromURL to
+// toURL with the given method, and rewrites headers for the new request.
+// Headers the caller did not set stay unset; the preset supplies them.
+func (c *redirectChain) next(headers, respHeaders map[string][]string, method, fromURL, toURL string) *redirectChain {
+	next := *c
+	next.policy = fingerprint.ParseReferrerPolicy(headerValue(respHeaders, "Referrer-Policy"), c.policy)
+	if c.site != "" {
+		next.site = fingerprint.RedirectFetchSite(c.site, c.initiator, toURL)
+		setHeader(headers, "Sec-Fetch-Site", string(next.site))
+	}
+	if c.origin != "" {
+		next.origin = fingerprint.RedirectOrigin(c.origin, fromURL, toURL)
+		setHeader(headers, "Origin", next.origin)
+	}
+	if c.referrer != "" {
+		setHeader(headers, "Referer", fingerprint.RedirectReferer(c.referrer, toURL, next.policy))
+	}
+	// Navigations only send Origin with a body; a 303 to GET drops it
+	if (method == "GET" || method == "HEAD") && isNavigation(headers) {
+		setHeader(headers, "Origin", "")
+	}
+	return &next
+}
+
+func isNavigation(headers map[string][]string) bool {
+	mode := headerValue(headers, "Sec-Fetch-Mode")
+	return mode == "" || mode == string(fingerprint.FetchModeNavigate)
+}
+
+// headerValue returns the first value of a header, matching the name
+// case-insensitively
+func headerValue(headers map[string][]string, name string) string {
+	for k, v := range headers {
+		if strings.EqualFold(k, name) && len(v) > 0 {
+			return v[0]
+		}
+	}
+	return ""
+}
+
+// setHeader replaces a header under any casing; an empty value removes it
+func setHeader(headers map[string][]string, name, value string) {
+	for k := range headers {
+		if strings.EqualFold(k, name) {
+			delete(headers, k)
+		}
+	}
+	if value != "" {
+		headers[name] = []string{value}
+	}
+}
+
+// redirectSettings returns whether to follow redirects, the hop limit and
+// the method policy, from the session config overridden by the request's
+func (s *Session) redirectSettings(p *transport.RedirectPolicy) (follow bool, maxRedirects int, methods transport.RedirectMethods) {
+	follow, maxRedirects = true, 10
+	if s.Config != nil {
+		follow = s.Config.FollowRedirects
+		if s.Config.MaxRedirects > 0 {
+			maxRedirects = s.Config.MaxRedirects
+		}
+		// Unknown policy names fall back to browser behavior
+		methods, _ = transport.ParseRedirectMethods(s.Config.RedirectMethods)
+	}
+	if p != nil {
+		if p.Follow != nil {
+			follow = *p.Follow
+		}
+		if p.MaxRedirects > 0 {
+			maxRedirects = p.MaxRedirects
+		}
+		if p.Methods != 0 {
+			methods = p.Methods
+		}
+	}
+	return follow, maxRedirects, methods
+}
+
+// preconnectRedirect starts connecting to the target of a redirect response
+// in the background, if the session preconnects and the target is another
+// origin. The returned channel is closed when the connection is ready (or
+// failed); it is nil when there is nothing to wait for.
+func (s *Session) preconnectRedirect(ctx context.Context, fromURL string, headers map[string][]string) <-chan struct{} {
+	if s.Config == nil || !s.Config.PreconnectRedirects {
+		return nil
+	}
+	location := headerValue(headers, "Location")
+	if location == "" {
+		return nil
+	}
+	target := resolveURL(fromURL, location)
+	if !fingerprint.CrossOrigin(fromURL, target) {
+		return nil // Already connected
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.transport.Preconnect(ctx, target)
+	}()
+	return done
+}
+
+// awaitPreconnect waits for a preconnect started by preconnectRedirect, so
+// the redirected request finds its connection instead of dialing another
+func awaitPreconnect(ctx context.Context, done <-chan struct{}) {
+	if done == nil {
+		return
+	}
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+}
+
+// redirectCredentials reports whether a redirect from fromURL to toURL drops
+// the request's credentials, and the headers counted as credentials besides
+// the defaults (see fingerprint.IsRedirectCredentialHeader)
+func (s *Session) redirectCredentials(fromURL, toURL string) (scrub bool, extra []string) {
+	if s.Config != nil {
+		if s.Config.KeepRedirectCredentials {
+			return false, nil
+		}
+		extra = s.Config.RedirectCredentialHeaders
+	}
+	return fingerprint.CrossOrigin(fromURL, toURL), extra
+}
+
+// checkRedirect runs the session's and then the request's redirect callback
+func (s *Session) checkRedirect(hop *transport.RedirectHop, p *transport.RedirectPolicy) error {
+	if s.options != nil && s.options.OnRedirect != nil {
+		if err := s.options.OnRedirect(hop); err != nil {
+			return err
+		}
+	}
+	if p != nil && p.OnRedirect != nil {
+		return p.OnRedirect(hop)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package session
+
+import (
+	"context"
+	"errors"
+)
+
+// RenderFormat is what a Renderer produces
+type RenderFormat string
+
+const (
+	RenderPNG RenderFormat = "png"
+	RenderPDF RenderFormat = "pdf"
+)
+
+// ErrPageNotCached is returned by Render for a page whose HTML the session
+// didn't keep
+var ErrPageNotCached = errors.New("page not in the session cache")
+
+// Page is an HTML page and the subresources it loaded, as the session
+// fetched them
+type Page struct {
+	URL       string
+	HTML      []byte
+	Resources map[string]*PageResource // By absolute URL
+}
+
+// PageResource is a subresource body with its response headers
+type PageResource struct {
+	ContentType string
+	Body        []byte
+}
+
+// Renderer turns a page into a screenshot or PDF from its content alone,
+// without fetching anything. A request it can't answer from page.Resources
+// must fail rather than go to the network, which would fetch with another
+// fingerprint.
+type Renderer interface {
+	Render(ctx context.Context, page *Page, format RenderFormat) ([]byte, error)
+}
+
+// RendererFunc adapts a function to Renderer
+type RendererFunc func(ctx context.Context, page *Page, format RenderFormat) ([]byte, error)
+
+func (f RendererFunc) Render(ctx context.Context, page *Page, format RenderFormat) ([]byte, error) {
+	return f(ctx, page, format)
+}
+
+// CachedPage returns pageURL as the session last loaded it, with the
+// subresources Warmup found on it, or nil if its HTML isn't cached. Only
+// responses carrying validators are cached, up to the session's cache size,
+// so resources may be missing.
+func (s *Session) CachedPage(pageURL string) *Page {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	entry := s.cacheEntries[pageURL]
+	if entry == nil || entry.response == nil {
+		return nil
+	}
+	page := &Page{
+		URL:       pageURL,
+		HTML:      entry.response.body,
+		Resources: make(map[string]*PageResource, len(entry.subresources)),
+	}
+	for _, res := range entry.subresources {
+		if cached := s.cacheEntries[res.url]; cached != nil && cached.response != nil {
+			page.Resources[res.url] = &PageResource{
+				ContentType: firstValue(cached.response.headers, "content-type"),
+				Body:        cached.response.body,
+			}
+		}
+	}
+	return page
+}
+
+// Render captures pageURL with r from the session's cache, so evidence
+// matches what the session was served and nothing is fetched again. Load
+// the page with Warmup first.
+func (s *Session) Render(ctx context.Context, pageURL string, r Renderer, format RenderFormat) ([]byte, error) {
+	page := s.CachedPage(pageURL)
+	if page == nil {
+		return nil, ErrPageNotCached
+	}
+	return r.Render(ctx, page, format)
+}
@@ -0,0 +1,187 @@
+package session
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// chromeBinaries are looked up in PATH when ChromeRenderer.Path is empty
+var chromeBinaries = []string{"google-chrome", "google-chrome-stable", "chromium", "chromium-browser", "chrome"}
+
+// ChromeRenderer renders pages with headless Chrome. The page is served to
+// Chrome from a loopback server holding its cached resources, and every
+// other host goes through an unreachable proxy, so Chrome loads nothing
+// from the network.
+type ChromeRenderer struct {
+	// Path of the Chrome or Chromium binary. Default: the first of
+	// google-chrome, chromium and chrome in PATH.
+	Path string
+
+	// Width and Height of the viewport. Default: 1920x1080.
+	Width, Height int
+
+	// Args are extra command-line flags, e.g. --no-sandbox when running as
+	// root
+	Args []string
+}
+
+// Render implements Renderer
+func (c *ChromeRenderer) Render(ctx context.Context, page *Page, format RenderFormat) ([]byte, error) {
+	bin, err := c.binary()
+	if err != nil {
+		return nil, err
+	}
+	pageURL, err := url.Parse(page.URL)
+	if err != nil {
+		return nil, fmt.Errorf("render %s: %w", page.URL, err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	server := &http.Server{Handler: &pageServer{page: page, origin: pageURL, base: "http://" + ln.Addr().String()}}
+	go server.Serve(ln)
+	defer server.Close()
+
+	dir, err := os.MkdirTemp("", "httpcloak-render-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	width, height := c.Width, c.Height
+	if width <= 0 || height <= 0 {
+		width, height = 1920, 1080
+	}
+	out := filepath.Join(dir, "page."+string(format))
+	args := []string{
+		"--headless=new",
+		"--disable-gpu",
+		"--hide-scrollbars",
+		"--no-first-run",
+		"--user-data-dir=" + filepath.Join(dir, "profile"),
+		"--proxy-server=127.0.0.1:9", // Loopback is never proxied
+		fmt.Sprintf("--window-size=%d,%d", width, height),
+	}
+	switch format {
+	case RenderPNG:
+		args = append(args, "--screenshot="+out)
+	case RenderPDF:
+		args = append(args, "--print-to-pdf="+out, "--no-pdf-header-footer")
+	default:
+		return nil, fmt.Errorf("render: unsupported format %q", format)
+	}
+	args = append(args, c.Args...)
+	args = append(args, "http://"+ln.Addr().String()+localPath(pageURL))
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, bin, args...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("render %s: %w: %s", page.URL, err, strings.TrimSpace(stderr.String()))
+	}
+	return os.ReadFile(out)
+}
+
+// binary returns the Chrome binary to run
+func (c *ChromeRenderer) binary() (string, error) {
+	if c.Path != "" {
+		return c.Path, nil
+	}
+	for _, name := range chromeBinaries {
+		if path, err := exec.LookPath(name); err == nil {
+			return path, nil
+		}
+	}
+	return "", errors.New("render: Chrome not found in PATH; set ChromeRenderer.Path")
+}
+
+// localPath maps an http(s) URL into the page server's namespace:
+// https://host/path?q is served at /https/host/path?q
+func localPath(u *url.URL) string {
+	path := "/" + u.Scheme + "/" + u.Host + u.EscapedPath()
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+	return path
+}
+
+// pageServer serves a Page's HTML and resources under their localPath.
+// Root-relative paths, as CSS resolves them, are taken to be on the page's
+// origin.
+type pageServer struct {
+	page   *Page
+	origin *url.URL
+	base   string // The server's own http://host:port
+}
+
+func (s *pageServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	target := s.resolve(r.URL)
+	if target == s.page.URL {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(s.rewrite(s.page.HTML))
+		return
+	}
+	res := s.page.Resources[target]
+	if res == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if res.ContentType != "" {
+		w.Header().Set("Content-Type", res.ContentType)
+	}
+	body := res.Body
+	if strings.Contains(res.ContentType, "css") {
+		body = s.rewrite(body)
+	}
+	w.Write(body)
+}
+
+// resolve returns the original URL of a request to the server
+func (s *pageServer) resolve(u *url.URL) string {
+	path := u.EscapedPath()
+	for _, scheme := range []string{"https", "http"} {
+		if rest, ok := strings.CutPrefix(path, "/"+scheme+"/"); ok {
+			target := scheme + "://" + rest
+			if u.RawQuery != "" {
+				target += "?" + u.RawQuery
+			}
+			return target
+		}
+	}
+	target := *s.origin
+	target.Path, target.RawPath, target.RawQuery, target.Fragment = u.Path, u.RawPath, u.RawQuery, ""
+	return target.String()
+}
+
+// rewrite points the absolute and protocol-relative URLs on the origins of
+// the page and its resources in body at the server, so Chrome asks it for
+// them. Relative URLs already resolve there.
+func (s *pageServer) rewrite(body []byte) []byte {
+	seen := make(map[string]bool)
+	var pairs []string
+	for _, target := range append([]string{s.page.URL}, slices.Collect(maps.Keys(s.page.Resources))...) {
+		u, err := url.Parse(target)
+		if err != nil || u.Host == "" || seen[u.Scheme+u.Host] {
+			continue
+		}
+		seen[u.Scheme+u.Host] = true
+		pairs = append(pairs, u.Scheme+"://"+u.Host, s.base+"/"+u.Scheme+"/"+u.Host)
+		if u.Scheme == s.origin.Scheme {
+			pairs = append(pairs, "//"+u.Host, s.base+"/"+u.Scheme+"/"+u.Host)
+		}
+	}
+	return []byte(strings.NewReplacer(pairs...).Replace(string(body)))
+}
@@ -0,0 +1,50 @@
+package session
+
+import (
+	"io"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestPageServer(t *testing.T) {
+	page := &Page{
+		URL:  "https://example.com/news/today",
+		HTML: []byte(`<link href="https://cdn.example.net/a.css"><img src="//example.com/logo.png"><script src="app.js"></script>`),
+		Resources: map[string]*PageResource{
+			"https://cdn.example.net/a.css":   {ContentType: "text/css", Body: []byte(`body{background:url(/bg.png)}`)},
+			"https://example.com/logo.png":    {ContentType: "image/png", Body: []byte("png")},
+			"https://example.com/news/app.js": {ContentType: "text/javascript", Body: []byte("js")},
+			"https://example.com/bg.png":      {ContentType: "image/png", Body: []byte("bg")},
+		},
+	}
+	origin, _ := url.Parse(page.URL)
+	s := &pageServer{page: page, origin: origin, base: "http://127.0.0.1:1"}
+
+	get := func(path string) (int, string) {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		body, _ := io.ReadAll(rec.Body)
+		return rec.Code, string(body)
+	}
+
+	_, html := get("/https/example.com/news/today")
+	for _, want := range []string{`href="http://127.0.0.1:1/https/cdn.example.net/a.css"`, `src="http://127.0.0.1:1/https/example.com/logo.png"`, `src="app.js"`} {
+		if !strings.Contains(html, want) {
+			t.Errorf("page missing %s: %s", want, html)
+		}
+	}
+	for path, want := range map[string]string{
+		"/https/cdn.example.net/a.css":   "body{background:url(/bg.png)}",
+		"/https/example.com/news/app.js": "js",
+		"/bg.png":                        "bg", // Root-relative, from the CSS
+	} {
+		if code, body := get(path); code != 200 || body != want {
+			t.Errorf("%s: %d %q, want %q", path, code, body, want)
+		}
+	}
+	if code, _ := get("/https/tracker.example.org/pixel.gif"); code != 404 {
+		t.Errorf("uncached resource: %d, want 404", code)
+	}
+}
@@ -9,14 +9,19 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net/url"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/sardanioss/httpcloak/dns"
 	"github.com/sardanioss/httpcloak/fingerprint"
 	"github.com/sardanioss/httpcloak/protocol"
 	"github.com/sardanioss/httpcloak/transport"
+	"github.com/sardanioss/httpcloak/version"
+	utls "github.com/sardanioss/utls"
 )
 
 // generateID generates a random session ID (16 bytes = 32 hex chars)
@@ -38,12 +43,57 @@ type SessionOptions struct {
 
 	// SessionCacheErrorCallback is called when backend operations fail
 	SessionCacheErrorCallback transport.ErrorCallback
+
+	// ClientHelloSpecHook adjusts the utls spec before it is applied.
+	// Advanced/unsupported - see transport.TransportConfig.ClientHelloSpecHook.
+	ClientHelloSpecHook func(spec *utls.ClientHelloSpec)
+
+	// QUICConfigHook adjusts the quic.Config right before each QUIC dial.
+	// Advanced/unsupported - see transport.TransportConfig.QUICConfigHook.
+	QUICConfigHook func(host string, cfg *transport.QUICConfig)
+
+	// OnRedirect approves or rewrites each redirect before it is followed
+	OnRedirect transport.RedirectFunc
+
+	// Geo checks Accept-Language against the egress IP's country
+	Geo *GeoOptions
+
+	// Challenge solves captchas in responses and retries with the token
+	Challenge *ChallengeOptions
+
+	// ClientCertificates are presented to servers asking for mutual TLS
+	// (see transport.ClientCertificate)
+	ClientCertificates []*transport.ClientCertificate
+
+	// CertificatePolicies pin or relax certificate verification per host
+	// (see transport.CertificatePolicy)
+	CertificatePolicies []*transport.CertificatePolicy
+
+	// ConnectionCallbacks are handed each new TLS connection to their hosts
+	// (see transport.ConnectionCallback)
+	ConnectionCallbacks []*transport.ConnectionCallback
+
+	// ProxyAuth and ServerAuth answer NTLM or Negotiate challenges from the
+	// proxy and from origins (see transport.TransportConfig)
+	ProxyAuth  transport.AuthenticatorFunc
+	ServerAuth transport.AuthenticatorFunc
+
+	// Tokens authorizes requests with OAuth2 access tokens, refreshed when
+	// they expire or are refused
+	Tokens *TokenOptions
+
+	// AutoWarmup, if set, warms up each origin before its first request
+	AutoWarmup *AutoWarmupOptions
 }
 
 // cacheEntry stores cache validation headers for a URL
 type cacheEntry struct {
-	etag         string // ETag header value
-	lastModified string // Last-Modified header value
+	etag         string        // ETag header value
+	lastModified string        // Last-Modified header value
+	subresources []subresource // Found on the page by Warmup
+
+	// response answers 304s to the session's revalidations; not persisted
+	response *cachedResponse
 }
 
 // Session represents a persistent HTTP session with connection affinity
@@ -59,7 +109,8 @@ type Session struct {
 	cookies   *CookieJar
 
 	// Cache validation headers per URL (for If-None-Match, If-Modified-Since)
-	cacheEntries map[string]*cacheEntry
+	cacheEntries    map[string]*cacheEntry
+	cachedBodyBytes int // Size of the cacheEntries' response bodies
 
 	// Client hints requested by each host via Accept-CH header
 	// Key: host (e.g., "example.com"), Value: set of requested hint names
@@ -74,7 +125,46 @@ type Session struct {
 	// switchProtocol is the protocol to switch to on Refresh()
 	switchProtocol transport.Protocol
 
+	// sourceBuild is the build info stored in the state this session was
+	// loaded from (nil for fresh sessions and pre-provenance state files)
+	sourceBuild *version.Info
+
+	// importReport records what was kept/discarded when loading saved state
+	importReport *ImportReport
+
+	// options holds the non-serializable options the session was created with
+	// (carried over to forks)
+	options *SessionOptions
+
+	// Egress country check for GeoOptions
+	geo geoState
+
+	// Current OAuth2 access token for TokenOptions
+	tokens tokenCache
+
+	// Origins AutoWarmup has warmed up
+	warmups autoWarmupState
+
+	// Timing profile for request gaps, warmup pauses and retry backoff
+	clock          *BehaviorClock
+	identityClocks map[string]*BehaviorClock // Per-request identities (see clockFor)
+	nextRequestAt  time.Time                 // Earliest start of the next request (RequestGap)
+
+	// Body bytes of beacons in flight (see SendBeacon)
+	beaconBytes atomic.Int64
+
+	// Running pollers by URL, headers and interval (see Poll)
+	pollMu  sync.Mutex
+	pollers map[string]*poller
+
+	// Saves the session after it changes (see AutoSave)
+	autoSave atomic.Pointer[autoSaver]
+
+	// Requests in progress, which Suspend waits for
+	inflight atomic.Int64
+
 	mu     sync.RWMutex
+	saveMu sync.Mutex // Orders Save calls (see Save)
 	active bool
 }
 
@@ -114,8 +204,8 @@ func NewSessionWithOptions(id string, config *protocol.SessionConfig, opts *Sess
 
 	// Create transport config with ConnectTo, ECH, TLS-only, QUIC timeout, localAddr, and session cache settings
 	var transportConfig *transport.TransportConfig
-	needsConfig := len(config.ConnectTo) > 0 || config.ECHConfigDomain != "" || config.TLSOnly || config.QuicIdleTimeout > 0 || config.LocalAddress != "" || keyLogWriter != nil || config.DisableSpeculativeTLS
-	if opts != nil && opts.SessionCacheBackend != nil {
+	needsConfig := len(config.ConnectTo) > 0 || config.ECHConfigDomain != "" || config.TLSOnly || config.QuicIdleTimeout > 0 || config.LocalAddress != "" || keyLogWriter != nil || config.DisableSpeculativeTLS || config.DisableLatencyPinning || config.SSRFProtection || config.TLSTicketIsolation != "" || config.IdentityKey != "" || poolConfig(config) != (transport.PoolConfig{})
+	if opts != nil && (opts.SessionCacheBackend != nil || opts.ClientHelloSpecHook != nil || opts.QUICConfigHook != nil || len(opts.ClientCertificates) > 0 || len(opts.CertificatePolicies) > 0 || len(opts.ConnectionCallbacks) > 0 || opts.ProxyAuth != nil || opts.ServerAuth != nil) {
 		needsConfig = true
 	}
 
@@ -129,10 +219,23 @@ func NewSessionWithOptions(id string, config *protocol.SessionConfig, opts *Sess
 			KeyLogWriter:         keyLogWriter,
 			DisableSpeculativeTLS: config.DisableSpeculativeTLS,
 		}
+		// Unknown policy names fall back to the safe default (egress isolation)
+		transportConfig.TicketIsolation, _ = transport.ParseTicketIsolation(config.TLSTicketIsolation)
+		transportConfig.IdentityKey = config.IdentityKey
+		transportConfig.DisableLatencyPinning = config.DisableLatencyPinning
+		transportConfig.SSRFProtection = config.SSRFProtection
+		transportConfig.Pool = poolConfig(config)
 		// Add session cache backend if provided
 		if opts != nil {
 			transportConfig.SessionCacheBackend = opts.SessionCacheBackend
 			transportConfig.SessionCacheErrorCallback = opts.SessionCacheErrorCallback
+			transportConfig.ClientHelloSpecHook = opts.ClientHelloSpecHook
+			transportConfig.QUICConfigHook = opts.QUICConfigHook
+			transportConfig.ClientCertificates = opts.ClientCertificates
+			transportConfig.CertificatePolicies = opts.CertificatePolicies
+			transportConfig.ConnectionCallbacks = opts.ConnectionCallbacks
+			transportConfig.ProxyAuth = opts.ProxyAuth
+			transportConfig.ServerAuth = opts.ServerAuth
 		}
 	}
 
@@ -170,11 +273,41 @@ func NewSessionWithOptions(id string, config *protocol.SessionConfig, opts *Sess
 			dnsCache.SetPreferIPv4(true)
 		}
 	}
+	if len(config.DNSServers) > 0 {
+		if dnsCache := t.GetDNSCache(); dnsCache != nil {
+			dnsCache.SetServers(config.DNSServers)
+		}
+	}
+	if len(config.HeaderRules) > 0 {
+		t.SetHeaderRules(config.HeaderRules)
+	}
+	if len(config.AllowedHosts) > 0 || len(config.BlockedHosts) > 0 {
+		t.SetHostFilter(&transport.HostFilter{Allowed: config.AllowedHosts, Blocked: config.BlockedHosts})
+	}
+	applyProtocolPolicy(t, config)
 
 	// Disable ECH lookup for faster first request
 	if config.DisableECH {
 		t.SetDisableECH(true)
 	}
+	if config.StrictMode {
+		t.SetStrictMode(true)
+	}
+
+	if config.RawBody {
+		t.SetRawBody(true)
+	}
+
+	if config.DrainLimit != 0 {
+		t.SetDrainLimit(config.DrainLimit)
+	}
+
+	if config.BehaviorSeed == 0 && config.IdentityKey != "" {
+		config.BehaviorSeed = fingerprint.IdentitySeed(config.IdentityKey, "behavior")
+	}
+	if config.BehaviorSeed == 0 {
+		config.BehaviorSeed = randInt64(math.MaxInt64) + 1
+	}
 
 	// Parse switch protocol if configured
 	switchProto := transport.ProtocolAuto
@@ -197,17 +330,44 @@ func NewSessionWithOptions(id string, config *protocol.SessionConfig, opts *Sess
 		clientHints:    make(map[string]map[string]bool),
 		keyLogWriter:   keyLogWriter,
 		switchProtocol: switchProto,
+		options:        opts,
+		clock:          NewBehaviorClock(config.BehaviorSeed),
 		active:         true,
 	}
 }
 
 // Request executes an HTTP request within this session
 func (s *Session) Request(ctx context.Context, req *transport.Request) (*transport.Response, error) {
-	return s.requestWithRedirects(ctx, req, 0, nil)
+	s.inflight.Add(1)
+	defer s.inflight.Add(-1)
+
+	s.autoWarmup(ctx, req.URL)
+	if err := s.awaitRequestGap(ctx); err != nil {
+		return nil, err
+	}
+	resp, err := s.requestWithRedirects(transport.WithRequestMeta(ctx, req.Meta), req, 0, nil, nil)
+	if resp != nil {
+		resp.Meta = req.Meta
+		resp.HeaderPolicy = s.headerPolicy()
+	}
+	s.markChanged()
+	return resp, err
 }
 
-// requestWithRedirects handles the actual request with redirect following
-func (s *Session) requestWithRedirects(ctx context.Context, req *transport.Request, redirectCount int, history []*transport.RedirectInfo) (*transport.Response, error) {
+// headerPolicy returns the configured DuplicateHeaders policy
+func (s *Session) headerPolicy() transport.DuplicateHeaders {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.Config == nil {
+		return transport.DuplicateHeadersFirst
+	}
+	policy, _ := transport.ParseDuplicateHeaders(s.Config.DuplicateHeaders)
+	return policy
+}
+
+// requestWithRedirects handles the actual request with redirect following.
+// chain is the browser state of the redirect chain req continues (nil at the start).
+func (s *Session) requestWithRedirects(ctx context.Context, req *transport.Request, redirectCount int, history []*transport.RedirectInfo, chain *redirectChain) (*transport.Response, error) {
 	s.mu.Lock()
 	if !s.active {
 		s.mu.Unlock()
@@ -221,22 +381,17 @@ func (s *Session) requestWithRedirects(ctx context.Context, req *transport.Reque
 	}
 
 	// Add cache-control: max-age=0 if session was refreshed (simulates browser F5)
-	if s.refreshed {
+	if s.refreshed && !s.strict() {
 		req.Headers["cache-control"] = []string{"max-age=0"}
 	}
 
 	// Add cache validation headers (If-None-Match, If-Modified-Since)
 	// This makes requests look like a real browser that caches resources
-	if cached, exists := s.cacheEntries[req.URL]; exists {
-		if cached.etag != "" {
-			req.Headers["If-None-Match"] = []string{cached.etag}
-		}
-		if cached.lastModified != "" {
-			req.Headers["If-Modified-Since"] = []string{cached.lastModified}
-		}
-	}
+	revalidating := !s.strict() && s.applyValidators(req)
 	s.mu.Unlock()
 
+	s.applyGeo(ctx, req.Headers)
+
 	// Execute request with retry logic if configured
 	var resp *transport.Response
 	var err error
@@ -276,9 +431,17 @@ func (s *Session) requestWithRedirects(ctx context.Context, req *transport.Reque
 		origCookie = c[0]
 	}
 
+	var token *Token // Access token sent with the last attempt
+	origin := req.URL
+	if len(history) > 0 {
+		origin = history[0].URL
+	}
+	var cookieTrace *transport.CookieTrace
+	clock := s.clockFor(ctx)
 	for attempt := 0; attempt <= maxRetries; attempt++ {
 		// Build Cookie header fresh each attempt from original + session cookies
-		sessionCookies := s.cookies.BuildCookieHeader(requestHost, requestPath, requestSecure)
+		var sessionCookies string
+		sessionCookies, cookieTrace = s.buildCookieHeader(req, requestHost, requestPath, requestSecure)
 		if sessionCookies != "" {
 			if origCookie != "" {
 				req.Headers["Cookie"] = []string{origCookie + "; " + sessionCookies}
@@ -289,10 +452,29 @@ func (s *Session) requestWithRedirects(ctx context.Context, req *transport.Reque
 			req.Headers["Cookie"] = []string{origCookie}
 		}
 
+		// A redirect back to a URL already requested with the same cookies
+		// would loop until the redirect limit
+		if attempt == 0 && len(history) > 0 {
+			method := req.Method
+			if method == "" {
+				method = "GET"
+			}
+			if loopErr := transport.FindRedirectLoop(history, method, req.URL, headerValue(req.Headers, "Cookie")); loopErr != nil {
+				return nil, loopErr
+			}
+		}
+
 		// Apply high-entropy client hints if the host requested them via Accept-CH
-		s.applyClientHints(host, req.Headers)
+		if !s.strict() {
+			s.applyClientHints(host, req.Headers)
+		}
 
-		resp, err = s.transport.Do(ctx, req)
+		sendReq, tokenUsed, tokenErr := s.authorize(ctx, req, origin)
+		if tokenErr != nil {
+			return nil, tokenErr
+		}
+		token = tokenUsed
+		resp, err = s.doTransport(ctx, sendReq)
 
 		// If no error and no retry config, or this is the last attempt, break
 		if maxRetries == 0 {
@@ -326,15 +508,21 @@ func (s *Session) requestWithRedirects(ctx context.Context, req *transport.Reque
 			break
 		}
 
-		// Calculate wait time with exponential backoff and jitter
+		// A streamed body was used up by this attempt
+		if !req.Replayable() {
+			if err != nil {
+				err = fmt.Errorf("%w (not retried: %w)", err, transport.ErrBodyNotRewindable)
+			}
+			break
+		}
+
+		// Calculate wait time with exponential backoff, jittered the way
+		// this session waits
 		waitTime := retryWaitMin * time.Duration(1<<uint(attempt))
 		if waitTime > retryWaitMax {
 			waitTime = retryWaitMax
 		}
-
-		// Add some jitter (±25%)
-		jitter := time.Duration(float64(waitTime) * 0.25)
-		waitTime = waitTime - jitter + time.Duration(randInt64(int64(jitter*2)))
+		waitTime = clock.Delay(waitTime)
 
 		select {
 		case <-ctx.Done():
@@ -347,6 +535,13 @@ func (s *Session) requestWithRedirects(ctx context.Context, req *transport.Reque
 	if err != nil {
 		return nil, err
 	}
+	resp.CookieTrace = cookieTrace
+
+	// Connect to a redirect's target while the response is processed
+	var preconnect <-chan struct{}
+	if follow, _, _ := s.redirectSettings(req.Redirect); follow && isRedirectStatus(resp.StatusCode) {
+		preconnect = s.preconnectRedirect(ctx, req.URL, resp.Headers)
+	}
 
 	// Extract cookies from final response (in case we didn't retry or it's a success)
 	s.extractCookies(resp.Headers, req.URL)
@@ -354,20 +549,32 @@ func (s *Session) requestWithRedirects(ctx context.Context, req *transport.Reque
 	// Parse Accept-CH header to store requested client hints for this host
 	s.parseAcceptCH(host, resp.Headers)
 
+	// A refused access token: replace it and send the request again
+	retryCtx, retry, err := s.refreshRefusedToken(ctx, req, resp, token)
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	if retry != nil {
+		resp.Body.Close()
+		return s.requestWithRedirects(retryCtx, retry, redirectCount, history, chain)
+	}
+
+	// A 304 to our own revalidation is answered from the cache
+	if revalidating && resp.StatusCode == 304 {
+		s.serveNotModified(req.URL, resp)
+	}
+
 	// Store cache validation headers from response for future requests
 	s.storeCacheHeaders(req.URL, resp.Headers)
+	if s.conditionalEnabled() && (req.Method == "" || req.Method == "GET") && !resp.Revalidated {
+		s.captureBody(req.URL, resp)
+	}
 
 	// Handle redirects
 	if isRedirectStatus(resp.StatusCode) {
 		// Check if we should follow redirects
-		followRedirects := true
-		maxRedirects := 10
-		if s.Config != nil {
-			followRedirects = s.Config.FollowRedirects
-			if s.Config.MaxRedirects > 0 {
-				maxRedirects = s.Config.MaxRedirects
-			}
-		}
+		followRedirects, maxRedirects, methods := s.redirectSettings(req.Redirect)
 
 		if followRedirects {
 			if redirectCount >= maxRedirects {
@@ -391,52 +598,104 @@ func (s *Session) requestWithRedirects(ctx context.Context, req *transport.Reque
 			}
 
 			// Add current response to redirect history
+			method := req.Method
+			if method == "" {
+				method = "GET"
+			}
 			redirectInfo := &transport.RedirectInfo{
 				StatusCode: resp.StatusCode,
 				URL:        req.URL,
 				Headers:    resp.Headers,
+				Method:     method,
+				Cookie:     headerValue(req.Headers, "Cookie"),
 			}
 			history = append(history, redirectInfo)
 
 			// Resolve relative URL
 			redirectURL := resolveURL(req.URL, location)
 
-			// Determine new method
-			newMethod := req.Method
-			if resp.StatusCode == 303 || ((resp.StatusCode == 301 || resp.StatusCode == 302) && req.Method == "POST") {
-				newMethod = "GET"
-			}
+			// Determine new method (by default 307/308 replay, 303 and POST 301/302 become GET)
+			newMethod := methods.Method(resp.StatusCode, method)
 
 			// Create redirect request
 			newReq := &transport.Request{
-				Method:  newMethod,
-				URL:     redirectURL,
-				Headers: make(map[string][]string),
+				Method:   newMethod,
+				URL:      redirectURL,
+				Headers:  make(map[string][]string),
+				Priority: req.Priority,
 			}
 
 			// Copy safe headers
+			scrub, credentialHeaders := s.redirectCredentials(req.URL, redirectURL)
 			for k, v := range req.Headers {
 				// Don't copy Content-* headers on method change
-				if newMethod != req.Method && (k == "Content-Type" || k == "Content-Length" || k == "content-type" || k == "content-length") {
+				if newMethod != method && fingerprint.IsRequestBodyHeader(k) {
 					continue
 				}
 				// Don't copy Cookie header (will be re-added from session)
 				if k == "Cookie" || k == "cookie" {
 					continue
 				}
+				// Credentials stay with the origin they were meant for
+				if scrub && fingerprint.IsRedirectCredentialHeader(k, credentialHeaders) {
+					continue
+				}
 				newReq.Headers[k] = v
 			}
 
-			// 307/308 preserve body
-			if resp.StatusCode == 307 || resp.StatusCode == 308 {
+			// Recompute Referer, Origin and Sec-Fetch-Site for the new URL
+			if chain == nil {
+				chain = startRedirectChain(req.Headers)
+			}
+			nextChain := chain.next(newReq.Headers, resp.Headers, newMethod, req.URL, redirectURL)
+
+			hop := &transport.RedirectHop{
+				StatusCode: resp.StatusCode,
+				Method:     newMethod,
+				URL:        redirectURL,
+				Headers:    newReq.Headers,
+				Via:        history,
+				Meta:       req.Meta,
+			}
+			if err := s.checkRedirect(hop, req.Redirect); err != nil {
+				if errors.Is(err, transport.ErrUseLastResponse) {
+					resp.History = history[:len(history)-1]
+					return resp, nil
+				}
+				if resp.Body != nil {
+					resp.Body.Close()
+				}
+				return nil, err
+			}
+			newReq.Method, newReq.URL, newReq.Headers = hop.Method, hop.URL, hop.Headers
+			newReq.Redirect = req.Redirect
+			newReq.Meta = req.Meta
+
+			// The body goes along when the method is kept (307/308 by default)
+			if hop.Method == method {
+				if !req.Replayable() {
+					return nil, fmt.Errorf("%w: %d redirect to %s", transport.ErrBodyNotRewindable, resp.StatusCode, hop.URL)
+				}
 				newReq.Body = req.Body
+				newReq.BodySource = req.BodySource
 			}
 
 			// Follow redirect with accumulated history
-			return s.requestWithRedirects(ctx, newReq, redirectCount+1, history)
+			awaitPreconnect(ctx, preconnect)
+			return s.requestWithRedirects(redirectTokenContext(ctx), newReq, redirectCount+1, history, nextChain)
 		}
 	}
 
+	// A captcha page: solve it and send the request again with the token
+	retryCtx, retry, err = s.solveChallenge(ctx, req, resp)
+	if err != nil {
+		return nil, err
+	}
+	if retry != nil {
+		resp.Body.Close()
+		return s.requestWithRedirects(retryCtx, retry, redirectCount, history, chain)
+	}
+
 	// Set history on final response
 	resp.History = history
 	return resp, nil
@@ -473,20 +732,36 @@ func (s *Session) Post(ctx context.Context, url string, body []byte, headers map
 	})
 }
 
-// extractCookies extracts cookies with full metadata from response headers
+// extractCookies stores the cookies a response set in the session's jar
 // requestURL is the URL that was requested (needed for domain scoping)
 func (s *Session) extractCookies(headers map[string][]string, requestURL string) {
+	requestHost := extractHost(requestURL)
+	requestSecure := isSecureURL(requestURL)
+	for _, cookie := range ParseSetCookies(headers, requestURL) {
+		if cookie.Rejected == "" {
+			s.cookies.Set(requestHost, cookie, requestSecure)
+		}
+	}
+}
+
+// ParseSetCookies parses the Set-Cookie headers of a response to requestURL,
+// in order, with full metadata. Cookies the jar refuses keep their parsed
+// attributes and carry the reason in Rejected, so a caller can compare what
+// a server issued with what the session kept. Lines without a name=value
+// pair are skipped, as the jar ignores them.
+func ParseSetCookies(headers map[string][]string, requestURL string) []*CookieData {
 	// Try both cases - some responses might have different casing
 	setCookies, exists := headers["set-cookie"]
 	if !exists {
 		setCookies, exists = headers["Set-Cookie"]
 	}
 	if !exists || len(setCookies) == 0 {
-		return
+		return nil
 	}
 
-	requestHost := extractHost(requestURL)
+	requestHost := normalizeRequestHost(extractHost(requestURL))
 	requestSecure := isSecureURL(requestURL)
+	var cookies []*CookieData
 
 	// Each Set-Cookie header is now a separate element in the slice
 	for _, line := range setCookies {
@@ -568,12 +843,15 @@ func (s *Session) extractCookies(headers map[string][]string, requestURL string)
 				default:
 					cookie.SameSite = attrValue
 				}
+			case "priority":
+				cookie.Priority = fingerprint.ParseCookiePriority(attrValue).String()
 			}
 		}
 
-		// Use CookieJar to store with proper domain scoping
-		s.cookies.Set(requestHost, cookie, requestSecure)
+		cookie.Rejected = rejectReason(requestHost, cookie, requestSecure)
+		cookies = append(cookies, cookie)
 	}
+	return cookies
 }
 
 // splitBySemicolon splits a string by semicolon
@@ -668,10 +946,20 @@ func (s *Session) storeCacheHeaders(url string, headers map[string][]string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	s.cacheEntries[url] = &cacheEntry{
+	entry := &cacheEntry{
 		etag:         etag,
 		lastModified: lastModified,
 	}
+	if prev := s.cacheEntries[url]; prev != nil {
+		entry.subresources = prev.subresources
+		// The body is still the one the validators stand for
+		if prev.response != nil && prev.etag == etag && prev.lastModified == lastModified {
+			entry.response = prev.response
+		} else if prev.response != nil {
+			s.cachedBodyBytes -= len(prev.response.body)
+		}
+	}
+	s.cacheEntries[url] = entry
 }
 
 // parseAcceptCH parses the Accept-CH response header and stores the requested client hints
@@ -895,6 +1183,9 @@ func (s *Session) IsActive() bool {
 
 // Close marks the session as inactive and closes connections
 func (s *Session) Close() {
+	// Save pending changes while the session can still be snapshotted
+	s.StopAutoSave()
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -902,7 +1193,11 @@ func (s *Session) Close() {
 		return
 	}
 	s.active = false
+	s.closeConnections()
+}
 
+// closeConnections closes the transport and key log (caller holds s.mu)
+func (s *Session) closeConnections() {
 	if s.transport != nil {
 		s.transport.Close()
 	}
@@ -930,6 +1225,23 @@ func parseProtocol(proto string) (transport.Protocol, error) {
 	}
 }
 
+// applyProtocolPolicy hands config's per-host protocols and HTTP/3 failure
+// backoff to t. Entries naming an unknown protocol are ignored.
+func applyProtocolPolicy(t *transport.Transport, config *protocol.SessionConfig) {
+	if len(config.ProtocolPolicy) > 0 {
+		policy := make(map[string]transport.Protocol, len(config.ProtocolPolicy))
+		for pattern, proto := range config.ProtocolPolicy {
+			if p, err := parseProtocol(proto); err == nil {
+				policy[pattern] = p
+			}
+		}
+		t.SetProtocolPolicy(policy)
+	}
+	if config.H3FailureBackoff != 0 {
+		t.SetH3FailureBackoff(time.Duration(config.H3FailureBackoff) * time.Millisecond)
+	}
+}
+
 // Refresh closes all connections but keeps TLS session caches and cookies intact.
 // This simulates a browser page refresh - new TCP/QUIC connections but TLS resumption.
 // If a switchProtocol was configured, the session switches to that protocol.
@@ -987,6 +1299,52 @@ func (s *Session) RefreshWithProtocol(proto string) error {
 	return nil
 }
 
+// ProtocolDecision returns the protocol auto mode uses for host, why, and
+// the latency measured for it
+func (s *Session) ProtocolDecision(host string) transport.ProtocolDecision {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.transport == nil {
+		return transport.ProtocolDecision{}
+	}
+	return s.transport.ProtocolDecision(host)
+}
+
+// PinProtocol makes auto mode use proto ("h1", "h2" or "h3") for host for
+// ttl, whatever it measured
+func (s *Session) PinProtocol(host, proto string, ttl time.Duration) error {
+	p, err := parseProtocol(proto)
+	if err != nil {
+		return err
+	}
+	if p == transport.ProtocolAuto {
+		return fmt.Errorf("invalid protocol %q: must be h1, h2 or h3", proto)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if !s.active {
+		return ErrSessionClosed
+	}
+	if s.transport != nil {
+		s.transport.PinProtocol(host, p, ttl)
+	}
+	return nil
+}
+
+// UnpinProtocol forgets the protocol chosen for host, so its next request
+// races again
+func (s *Session) UnpinProtocol(host string) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.transport != nil {
+		s.transport.UnpinProtocol(host)
+	}
+}
+
 // Touch updates the last used timestamp
 func (s *Session) Touch() {
 	s.mu.Lock()
@@ -1006,6 +1364,7 @@ func (s *Session) GetCookies() map[string]string {
 // For domain-specific cookies, use Set-Cookie headers from responses.
 func (s *Session) SetCookie(name, value string) {
 	s.cookies.SetSimple(name, value)
+	s.markChanged()
 }
 
 // SetCookies sets multiple cookies for this session
@@ -1014,11 +1373,49 @@ func (s *Session) SetCookies(cookies map[string]string) {
 	for k, v := range cookies {
 		s.cookies.SetSimple(k, v)
 	}
+	s.markChanged()
+}
+
+// CookiesFor returns the cookies with full metadata that would be sent to
+// host (path and Secure aside). An empty host returns every cookie.
+func (s *Session) CookiesFor(host string) []CookieState {
+	return s.cookies.List(host)
+}
+
+// CookiesAt is CookiesFor as of asOf: cookies that will have expired by
+// then are left out. Checking a login cookie against a job's start time
+// tells whether a persisted session is worth warming.
+func (s *Session) CookiesAt(host string, asOf time.Time) []CookieState {
+	return s.cookies.ListAt(host, asOf)
+}
+
+// ExportCookiesAt returns the cookies, keyed by domain, that will still be
+// valid at asOf
+func (s *Session) ExportCookiesAt(asOf time.Time) map[string][]CookieState {
+	return s.cookies.ExportAt(asOf)
+}
+
+// PutCookie stores a cookie with explicit domain, path and attributes.
+// See CookieJar.Put for how Domain is interpreted.
+func (s *Session) PutCookie(cookie CookieState) {
+	s.cookies.Put(cookie)
+	s.markChanged()
+}
+
+// MergeCookies merges domain-keyed cookies, such as a fresh browser export,
+// into the session's jar under policy. See CookieJar.Merge.
+func (s *Session) MergeCookies(cookies map[string][]CookieState, policy MergePolicy) int {
+	other := NewCookieJar()
+	other.Import(cookies)
+	n := s.cookies.Merge(other, policy)
+	s.markChanged()
+	return n
 }
 
 // ClearCookies removes all cookies from this session
 func (s *Session) ClearCookies() {
 	s.cookies.Clear()
+	s.markChanged()
 }
 
 // ClearCache clears all cached URLs (removes If-None-Match/If-Modified-Since headers)
@@ -1026,6 +1423,8 @@ func (s *Session) ClearCache() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.cacheEntries = make(map[string]*cacheEntry)
+	s.cachedBodyBytes = 0
+	s.markChanged()
 }
 
 // SetProxy sets or updates the proxy for all protocols (HTTP/1.1, HTTP/2, HTTP/3)
@@ -1310,6 +1709,14 @@ type StreamResponse = transport.StreamResponse
 // The caller is responsible for closing the response when done
 // Note: Streaming does NOT support redirects - use Request() for redirect handling
 func (s *Session) RequestStream(ctx context.Context, req *transport.Request) (*StreamResponse, error) {
+	s.inflight.Add(1)
+	defer s.inflight.Add(-1)
+
+	s.autoWarmup(ctx, req.URL)
+	if err := s.awaitRequestGap(ctx); err != nil {
+		return nil, err
+	}
+
 	s.mu.Lock()
 	if !s.active {
 		s.mu.Unlock()
@@ -1337,14 +1744,23 @@ func (s *Session) RequestStream(ctx context.Context, req *transport.Request) (*S
 	}
 	s.mu.Unlock()
 
+	s.applyGeo(ctx, req.Headers)
+
+	req, _, err := s.authorize(ctx, req, req.URL)
+	if err != nil {
+		return nil, err
+	}
+
 	// Execute streaming request (no retry or redirect support for streams)
-	resp, err := s.transport.DoStream(ctx, req)
+	resp, err := s.transport.DoStream(transport.WithRequestMeta(ctx, req.Meta), req)
 	if err != nil {
 		return nil, err
 	}
+	resp.Meta = req.Meta
 
 	// Extract cookies from response
 	s.extractCookies(resp.Headers, req.URL)
+	s.markChanged()
 
 	return resp, nil
 }
@@ -1401,6 +1817,56 @@ func (s *Session) importCookiesV4(cookies []CookieState) {
 	s.cookies.ImportV4(cookies)
 }
 
+// exportCache exports the cache validators (caller holds s.mu)
+func (s *Session) exportCache() map[string]CacheEntryState {
+	if len(s.cacheEntries) == 0 {
+		return nil
+	}
+	cache := make(map[string]CacheEntryState, len(s.cacheEntries))
+	for url, entry := range s.cacheEntries {
+		state := CacheEntryState{
+			ETag:         entry.etag,
+			LastModified: entry.lastModified,
+		}
+		for _, r := range entry.subresources {
+			sub := SubresourceState{URL: r.url, Type: r.typ.String()}
+			if p := r.priority; p != nil {
+				sub.Priority = fmt.Sprintf("u=%d", p.Urgency) // Explicit, as u=3 is otherwise ""
+				if p.Incremental {
+					sub.Priority += ", i"
+				}
+			}
+			state.Subresources = append(state.Subresources, sub)
+		}
+		cache[url] = state
+	}
+	return cache
+}
+
+// importCache restores cache validators saved by exportCache (caller holds s.mu)
+func (s *Session) importCache(cache map[string]CacheEntryState) {
+	for url, state := range cache {
+		if state.ETag == "" && state.LastModified == "" {
+			continue
+		}
+		entry := &cacheEntry{
+			etag:         state.ETag,
+			lastModified: state.LastModified,
+		}
+		for _, r := range state.Subresources {
+			if typ, ok := parseResourceType(r.Type); ok && r.URL != "" {
+				sub := subresource{url: r.URL, typ: typ}
+				if r.Priority != "" {
+					urgency, incremental := fingerprint.ParsePriority(r.Priority)
+					sub.priority = &fingerprint.Priority{Urgency: urgency, Incremental: incremental}
+				}
+				entry.subresources = append(entry.subresources, sub)
+			}
+		}
+		s.cacheEntries[url] = entry
+	}
+}
+
 // exportTLSSessions exports TLS sessions from all transport caches
 func (s *Session) exportTLSSessions() (map[string]transport.TLSSessionState, error) {
 	allSessions := make(map[string]transport.TLSSessionState)
@@ -1466,28 +1932,36 @@ func (s *Session) importTLSSessions(sessions map[string]transport.TLSSessionStat
 		}
 	}
 
+	var errs []error
+
 	// Import to HTTP/1.1 transport
 	if h1 := s.transport.GetHTTP1Transport(); h1 != nil && len(h1Sessions) > 0 {
 		if cache, ok := h1.GetSessionCache().(*transport.PersistableSessionCache); ok {
-			cache.Import(h1Sessions)
+			if err := cache.Import(h1Sessions); err != nil {
+				errs = append(errs, fmt.Errorf("h1: %w", err))
+			}
 		}
 	}
 
 	// Import to HTTP/2 transport
 	if h2 := s.transport.GetHTTP2Transport(); h2 != nil && len(h2Sessions) > 0 {
 		if cache, ok := h2.GetSessionCache().(*transport.PersistableSessionCache); ok {
-			cache.Import(h2Sessions)
+			if err := cache.Import(h2Sessions); err != nil {
+				errs = append(errs, fmt.Errorf("h2: %w", err))
+			}
 		}
 	}
 
 	// Import to HTTP/3 transport
 	if h3 := s.transport.GetHTTP3Transport(); h3 != nil && len(h3Sessions) > 0 {
 		if cache, ok := h3.GetSessionCache().(*transport.PersistableSessionCache); ok {
-			cache.Import(h3Sessions)
+			if err := cache.Import(h3Sessions); err != nil {
+				errs = append(errs, fmt.Errorf("h3: %w", err))
+			}
 		}
 	}
 
-	return nil
+	return errors.Join(errs...)
 }
 
 // exportECHConfigs exports ECH configs from HTTP/3 transport
@@ -1534,8 +2008,17 @@ func (s *Session) importECHConfigs(configs map[string]string) {
 	h3.SetECHConfigCache(rawConfigs)
 }
 
-// Marshal exports session state to JSON bytes
+// Marshal exports session state to JSON bytes. The state is snapshotted
+// under the session lock and encoded after it is released, so requests
+// running meanwhile cannot change it halfway through.
 func (s *Session) Marshal() ([]byte, error) {
+	return json.MarshalIndent(s.snapshotState(), "", "  ")
+}
+
+// snapshotState copies the session's persistable state. Every part is a
+// fresh copy, the config included, so the result can be encoded without
+// holding any lock.
+func (s *Session) snapshotState() *SessionState {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
@@ -1554,14 +2037,32 @@ func (s *Session) Marshal() ([]byte, error) {
 	// that were used when creating the TLS session tickets
 	echConfigs := s.exportECHConfigs()
 
-	// Save the full config
-	config := s.Config
-	if config == nil {
-		config = &protocol.SessionConfig{
-			Preset: "chrome-131",
+	// Export learned protocols and ECH lifetimes so the restored session
+	// dials the same way without racing or querying HTTPS records again
+	discovery := s.transport.ExportDiscovery()
+
+	// Resolved addresses only travel with the state when asked for
+	var dnsEntries map[string]dns.Entry
+	if s.Config != nil && s.Config.PersistDNS {
+		if dnsCache := s.transport.GetDNSCache(); dnsCache != nil {
+			dnsEntries = dnsCache.Export()
 		}
 	}
 
+	// Save the full config
+	config := &protocol.SessionConfig{
+		Preset: "chrome-131",
+	}
+	if s.Config != nil {
+		config = s.Config.Clone()
+	}
+
+	// The build is only recorded when asked for
+	var build *version.Info
+	if config.StampBuild {
+		info := version.Get()
+		build = &info
+	}
 	state := &SessionState{
 		Version:     SessionStateVersion,
 		CreatedAt:   s.CreatedAt,
@@ -1570,20 +2071,38 @@ func (s *Session) Marshal() ([]byte, error) {
 		Cookies:     cookies,
 		TLSSessions: tlsSessions,
 		ECHConfigs:  echConfigs,
+		Discovery:   discovery,
+		Cache:       s.exportCache(),
+		DNS:         dnsEntries,
+		Build:       build,
 	}
+	return state
+}
 
-	return json.MarshalIndent(state, "", "  ")
+// SourceBuild returns the build information recorded in the state file this
+// session was restored from, or nil if the session was created fresh or the
+// file has no build stamp (see StampBuild). Compare with version.Get() to spot sessions
+// produced by a different preset database or TLS stack.
+func (s *Session) SourceBuild() *version.Info {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.sourceBuild
 }
 
-// Save exports session state to a file
+// Save exports session state to a file. The file is replaced atomically
+// (see WriteFileAtomic), and concurrent saves are serialized so the last
+// snapshot taken is the one left on disk.
 func (s *Session) Save(path string) error {
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+
 	data, err := s.Marshal()
 	if err != nil {
 		return fmt.Errorf("failed to marshal session: %w", err)
 	}
 
 	// Write with restrictive permissions (owner read/write only)
-	if err := os.WriteFile(path, data, 0600); err != nil {
+	if err := WriteFileAtomic(path, data, 0600); err != nil {
 		return fmt.Errorf("failed to write session file: %w", err)
 	}
 
@@ -1618,6 +2137,9 @@ type sessionStateV3 struct {
 
 // UnmarshalSession loads a session from JSON bytes
 func UnmarshalSession(data []byte) (*Session, error) {
+	if IsEncryptedState(data) {
+		return nil, errors.New("session data is encrypted: load it with LoadEncrypted")
+	}
 	// First, check the version
 	var versionCheck struct {
 		Version int `json:"version"`
@@ -1647,6 +2169,11 @@ func UnmarshalSession(data []byte) (*Session, error) {
 		return nil, fmt.Errorf("failed to parse session data: %w", err)
 	}
 
+	return restoreSession(&state, nil), nil
+}
+
+// restoreSession creates a session from decoded v5+ state
+func restoreSession(state *SessionState, options *SessionOptions) *Session {
 	// Use the full config from the saved state
 	config := state.Config
 	if config == nil {
@@ -1655,24 +2182,27 @@ func UnmarshalSession(data []byte) (*Session, error) {
 		}
 	}
 
-	session := NewSession("", config)
+	session := NewSessionWithOptions("", config, options)
 	session.CreatedAt = state.CreatedAt
+	session.sourceBuild = state.Build
 
 	// Import cookies (v5 format)
 	session.mu.Lock()
 	session.importCookies(state.Cookies)
+	session.importCache(state.Cache)
 	session.mu.Unlock()
 
-	// Import ECH configs FIRST - this must be done before TLS sessions
-	// because the TLS session tickets need the correct ECH config for resumption
-	session.importECHConfigs(state.ECHConfigs)
-
-	// Import TLS sessions
-	if err := session.importTLSSessions(state.TLSSessions); err != nil {
-		// Log but don't fail - cookies are the main thing
+	// Import ECH configs and TLS sessions, discarding anything the current
+	// preset could not have negotiated (see ImportReport)
+	session.importResumptionState(state.TLSSessions, state.ECHConfigs, state.Discovery, state.Build)
+	if dnsCache := session.transport.GetDNSCache(); dnsCache != nil && len(state.DNS) > 0 {
+		dnsCache.Import(state.DNS)
+	}
+	if state.Suspended != nil {
+		session.applySuspendedState(state.Suspended)
 	}
 
-	return session, nil
+	return session
 }
 
 // unmarshalSessionV4 handles loading v4 format sessions (flat cookie list)
@@ -1698,13 +2228,9 @@ func unmarshalSessionV4(data []byte) (*Session, error) {
 	session.importCookiesV4(state.Cookies)
 	session.mu.Unlock()
 
-	// Import ECH configs FIRST
-	session.importECHConfigs(state.ECHConfigs)
-
-	// Import TLS sessions
-	if err := session.importTLSSessions(state.TLSSessions); err != nil {
-		// Log but don't fail
-	}
+	// Import ECH configs and TLS sessions, discarding anything the current
+	// preset could not have negotiated (see ImportReport)
+	session.importResumptionState(state.TLSSessions, state.ECHConfigs, nil, nil)
 
 	return session, nil
 }
@@ -1734,13 +2260,9 @@ func unmarshalSessionV3(data []byte) (*Session, error) {
 	session.importCookiesV4(state.Cookies)
 	session.mu.Unlock()
 
-	// Import ECH configs
-	session.importECHConfigs(state.ECHConfigs)
-
-	// Import TLS sessions
-	if err := session.importTLSSessions(state.TLSSessions); err != nil {
-		// Log but don't fail
-	}
+	// Import ECH configs and TLS sessions, discarding anything the current
+	// preset could not have negotiated (see ImportReport)
+	session.importResumptionState(state.TLSSessions, state.ECHConfigs, nil, nil)
 
 	return session, nil
 }
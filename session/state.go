@@ -3,8 +3,10 @@ package session
 import (
 	"time"
 
+	"github.com/sardanioss/httpcloak/dns"
 	"github.com/sardanioss/httpcloak/protocol"
 	"github.com/sardanioss/httpcloak/transport"
+	"github.com/sardanioss/httpcloak/version"
 )
 
 const SessionStateVersion = 5
@@ -30,6 +32,51 @@ type SessionState struct {
 	// This is essential for session resumption - the same ECH config must be used
 	// when resuming as was used when creating the session ticket
 	ECHConfigs map[string]string `json:"ech_configs,omitempty"`
+
+	// Discovery stores what was learned per host besides cookies and tickets:
+	// the protocol auto mode settled on (racing/Alt-Svc) and the DNS TTL of
+	// each ECH config, so a restored session skips rediscovery until they expire
+	Discovery map[string]transport.DiscoveryEntry `json:"discovery,omitempty"`
+
+	// Cache stores the validators of URLs the session fetched, keyed by URL,
+	// so a restored session revalidates them with conditional requests the
+	// way a returning visitor's browser does
+	Cache map[string]CacheEntryState `json:"cache,omitempty"`
+
+	// DNS stores the session's resolved addresses and negative answers,
+	// keyed by host, when the config sets PersistDNS
+	DNS map[string]dns.Entry `json:"dns,omitempty"`
+
+	// Build records which httpcloak build (preset database, utls/quic-go
+	// versions) produced this state, when the config sets StampBuild.
+	Build *version.Info `json:"build,omitempty"`
+
+	// Suspended holds the in-memory state only Session.Suspend saves
+	Suspended *SuspendedState `json:"suspended,omitempty"`
+}
+
+// SuspendedState is what a suspended session keeps beyond saved state:
+// its identity and counters, the client hints hosts asked for, the bodies
+// that answer 304s and a pending Refresh
+type SuspendedState struct {
+	ID           string    `json:"id"`
+	LastUsed     time.Time `json:"last_used"`
+	RequestCount int64     `json:"request_count"`
+
+	// ClientHints maps hosts to the hints they requested with Accept-CH
+	ClientHints map[string][]string `json:"client_hints,omitempty"`
+
+	// Responses maps URLs to the responses their cache validators stand for
+	Responses map[string]CachedResponseState `json:"responses,omitempty"`
+
+	Refreshed      bool   `json:"refreshed,omitempty"`
+	SwitchProtocol string `json:"switch_protocol,omitempty"` // "h1", "h2", "h3"; "" for auto
+}
+
+// CachedResponseState is a cached response body and its headers
+type CachedResponseState struct {
+	Headers map[string][]string `json:"headers,omitempty"`
+	Body    []byte              `json:"body"`
 }
 
 // SessionStateV4 represents the v4 format for migration
@@ -43,6 +90,26 @@ type SessionStateV4 struct {
 	ECHConfigs  map[string]string                    `json:"ech_configs,omitempty"`
 }
 
+// CacheEntryState is a URL's cache validators, sent back as If-None-Match
+// and If-Modified-Since. For a page Warmup loaded it also lists the
+// subresources found there, which Warmup fetches again when the page
+// comes back 304 without a body to parse.
+type CacheEntryState struct {
+	ETag         string             `json:"etag,omitempty"`
+	LastModified string             `json:"last_modified,omitempty"`
+	Subresources []SubresourceState `json:"subresources,omitempty"`
+}
+
+// SubresourceState is a subresource Warmup found on a page
+type SubresourceState struct {
+	URL  string `json:"url"`
+	Type string `json:"type"` // "style", "script", "image" or "font"
+
+	// Priority is the RFC 9218 priority the page's markup gave it, e.g.
+	// "u=3" for an async script; empty for its destination's default
+	Priority string `json:"priority,omitempty"`
+}
+
 // CookieState represents a serializable cookie with full metadata
 type CookieState struct {
 	Name      string     `json:"name"`
@@ -54,5 +121,6 @@ type CookieState struct {
 	Secure    bool       `json:"secure,omitempty"`
 	HttpOnly  bool       `json:"http_only,omitempty"`
 	SameSite  string     `json:"same_site,omitempty"`
+	Priority  string     `json:"priority,omitempty"`
 	CreatedAt *time.Time `json:"created_at,omitempty"` // v5: for sorting
 }
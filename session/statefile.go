@@ -0,0 +1,260 @@
+package session
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/sardanioss/httpcloak/fingerprint"
+	"github.com/sardanioss/httpcloak/protocol"
+	"github.com/sardanioss/httpcloak/transport"
+)
+
+// ReadSessionState parses saved session data without restoring a session
+// from it, upgrading v3 and v4 files to the current format. Only the JSON
+// is checked; Validate reports what loading would drop.
+func ReadSessionState(data []byte) (*SessionState, error) {
+	if IsEncryptedState(data) {
+		return nil, errors.New("session data is encrypted: decrypt it first (see DecryptState)")
+	}
+	var versionCheck struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(data, &versionCheck); err != nil {
+		return nil, fmt.Errorf("failed to parse session data: %w", err)
+	}
+	if versionCheck.Version > SessionStateVersion {
+		return nil, fmt.Errorf("session file version %d is newer than supported version %d",
+			versionCheck.Version, SessionStateVersion)
+	}
+
+	switch {
+	case versionCheck.Version <= 3:
+		var old sessionStateV3
+		if err := json.Unmarshal(data, &old); err != nil {
+			return nil, fmt.Errorf("failed to parse v3 session data: %w", err)
+		}
+		return &SessionState{
+			Version:   SessionStateVersion,
+			CreatedAt: old.CreatedAt,
+			UpdatedAt: old.UpdatedAt,
+			Config: &protocol.SessionConfig{
+				Preset:          old.Preset,
+				ForceHTTP3:      old.ForceHTTP3,
+				ECHConfigDomain: old.ECHConfigDomain,
+				Proxy:           old.Proxy,
+				TCPProxy:        old.TCPProxy,
+				UDPProxy:        old.UDPProxy,
+			},
+			Cookies:     cookiesByDomain(old.Cookies),
+			TLSSessions: old.TLSSessions,
+			ECHConfigs:  old.ECHConfigs,
+		}, nil
+	case versionCheck.Version == 4:
+		var old SessionStateV4
+		if err := json.Unmarshal(data, &old); err != nil {
+			return nil, fmt.Errorf("failed to parse v4 session data: %w", err)
+		}
+		return &SessionState{
+			Version:     SessionStateVersion,
+			CreatedAt:   old.CreatedAt,
+			UpdatedAt:   old.UpdatedAt,
+			Config:      old.Config,
+			Cookies:     cookiesByDomain(old.Cookies),
+			TLSSessions: old.TLSSessions,
+			ECHConfigs:  old.ECHConfigs,
+		}, nil
+	}
+
+	var state SessionState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse session data: %w", err)
+	}
+	return &state, nil
+}
+
+// cookiesByDomain keys a v3/v4 flat cookie list by domain, as
+// CookieJar.ImportV4 does
+func cookiesByDomain(cookies []CookieState) map[string][]CookieState {
+	if len(cookies) == 0 {
+		return nil
+	}
+	byDomain := make(map[string][]CookieState)
+	for _, c := range cookies {
+		domain := strings.ToLower(c.Domain)
+		byDomain[domain] = append(byDomain[domain], c)
+	}
+	return byDomain
+}
+
+// Validate lists what is wrong with the state as of now: missing or unknown
+// preset, malformed or expired cookies, and the TLS tickets and ECH configs
+// a restore would drop, for the same reasons (see ImportReport). A nil
+// result means it loads intact.
+func (st *SessionState) Validate() []error {
+	var problems []error
+	add := func(format string, args ...any) {
+		problems = append(problems, fmt.Errorf(format, args...))
+	}
+	now := time.Now()
+
+	if st.Config == nil || st.Config.Preset == "" {
+		add("missing preset")
+	} else if !slices.Contains(fingerprint.Available(), st.Config.Preset) {
+		add("preset %q is unknown to this build", st.Config.Preset)
+	}
+
+	for domain, cookies := range st.Cookies {
+		for _, c := range cookies {
+			if c.Name == "" {
+				add("cookie in %q has no name", domain)
+			}
+			if c.Domain != "" && !strings.EqualFold(c.Domain, domain) {
+				add("cookie %s has domain %q but is filed under %q", c.Name, c.Domain, domain)
+			}
+			if c.Expires != nil && c.Expires.Before(now) {
+				add("cookie %s for %q expired %s", c.Name, domain, c.Expires.Format(time.RFC3339))
+			}
+		}
+	}
+
+	// The same checks a restore runs, so the two can't disagree
+	var preset *fingerprint.Preset
+	if st.Config != nil && slices.Contains(fingerprint.Available(), st.Config.Preset) {
+		preset = fingerprint.Get(st.Config.Preset)
+	}
+	report, _, _ := checkResumptionState(preset, st.TLSSessions, st.ECHConfigs, st.Discovery, st.Build, now)
+	for _, host := range slices.Sorted(maps.Keys(report.DroppedECHConfigs)) {
+		add("ECH config for %s would be dropped: %s", host, report.DroppedECHConfigs[host])
+	}
+	for _, key := range slices.Sorted(maps.Keys(report.DroppedTLSSessions)) {
+		add("TLS session %s would be dropped: %s", key, report.DroppedTLSSessions[key])
+	}
+	return problems
+}
+
+// Redact blanks the secrets in the state so it can be shared: cookie values,
+// TLS tickets and proxy credentials. A redacted state still loads, as a
+// session without working cookies or resumption.
+func (st *SessionState) Redact() {
+	for domain, cookies := range st.Cookies {
+		for i := range cookies {
+			cookies[i].Value = "REDACTED"
+		}
+		st.Cookies[domain] = cookies
+	}
+	for key, ticket := range st.TLSSessions {
+		ticket.Ticket, ticket.State = "", ""
+		st.TLSSessions[key] = ticket
+	}
+	if st.Config != nil {
+		cfg := *st.Config
+		cfg.Proxy = redactURL(cfg.Proxy)
+		cfg.TCPProxy = redactURL(cfg.TCPProxy)
+		cfg.UDPProxy = redactURL(cfg.UDPProxy)
+		st.Config = &cfg
+	}
+}
+
+// redactURL replaces the password in a URL's userinfo
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.User == nil {
+		return raw
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), "REDACTED")
+	}
+	return u.String()
+}
+
+// MergeSessionStates combines saved states of the same identity into one.
+// The first state's config is kept. Of two cookies with the same domain,
+// path and name, and of two tickets for the same origin, the newer wins;
+// for everything else keyed by host or URL, the later state's entry does.
+func MergeSessionStates(states ...*SessionState) *SessionState {
+	merged := &SessionState{Version: SessionStateVersion}
+	cookies := make(map[string]map[string]CookieState)
+	for i, st := range states {
+		if i == 0 || st.CreatedAt.Before(merged.CreatedAt) {
+			merged.CreatedAt = st.CreatedAt
+		}
+		if st.UpdatedAt.After(merged.UpdatedAt) {
+			merged.UpdatedAt = st.UpdatedAt
+		}
+		if merged.Config == nil {
+			merged.Config = st.Config
+		}
+		if st.Build != nil {
+			merged.Build = st.Build
+		}
+
+		for domain, list := range st.Cookies {
+			if cookies[domain] == nil {
+				cookies[domain] = make(map[string]CookieState)
+			}
+			for _, c := range list {
+				path := c.Path
+				if path == "" {
+					path = "/"
+				}
+				key := cookieKey(path, c.Name)
+				if prev, ok := cookies[domain][key]; ok && cookieCreated(prev).After(cookieCreated(c)) {
+					continue
+				}
+				cookies[domain][key] = c
+			}
+		}
+		for key, ticket := range st.TLSSessions {
+			if merged.TLSSessions == nil {
+				merged.TLSSessions = make(map[string]transport.TLSSessionState)
+			}
+			if prev, ok := merged.TLSSessions[key]; ok && prev.CreatedAt.After(ticket.CreatedAt) {
+				continue
+			}
+			merged.TLSSessions[key] = ticket
+		}
+		merged.ECHConfigs = mergeMap(merged.ECHConfigs, st.ECHConfigs)
+		merged.Discovery = mergeMap(merged.Discovery, st.Discovery)
+		merged.Cache = mergeMap(merged.Cache, st.Cache)
+		merged.DNS = mergeMap(merged.DNS, st.DNS)
+	}
+
+	if len(cookies) > 0 {
+		merged.Cookies = make(map[string][]CookieState, len(cookies))
+		for domain, byKey := range cookies {
+			for _, c := range byKey {
+				merged.Cookies[domain] = append(merged.Cookies[domain], c)
+			}
+			slices.SortFunc(merged.Cookies[domain], func(a, b CookieState) int {
+				return cookieCreated(a).Compare(cookieCreated(b))
+			})
+		}
+	}
+	return merged
+}
+
+func cookieCreated(c CookieState) time.Time {
+	if c.CreatedAt == nil {
+		return time.Time{}
+	}
+	return *c.CreatedAt
+}
+
+func mergeMap[V any](dst, src map[string]V) map[string]V {
+	if len(src) == 0 {
+		return dst
+	}
+	if dst == nil {
+		dst = make(map[string]V, len(src))
+	}
+	for k, v := range src {
+		dst[k] = v
+	}
+	return dst
+}
@@ -0,0 +1,131 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ErrStateNotFound is returned by Store.Load for an unknown session ID
+var ErrStateNotFound = errors.New("session state not found")
+
+// Store keeps serialized session state (see Session.Marshal) by session ID.
+// Implementations must be safe for concurrent use.
+type Store interface {
+	// Save stores data under id, replacing what was there
+	Save(ctx context.Context, id string, data []byte) error
+
+	// Load returns the data stored under id, or ErrStateNotFound
+	Load(ctx context.Context, id string) ([]byte, error)
+
+	// Delete removes id. Deleting an unknown ID is not an error.
+	Delete(ctx context.Context, id string) error
+
+	// List returns the stored IDs in no particular order
+	List(ctx context.Context) ([]string, error)
+}
+
+// SaveTo stores the session's state in store under id. Like Save,
+// concurrent calls are serialized so the last snapshot taken is the one
+// stored.
+func (s *Session) SaveTo(ctx context.Context, store Store, id string) error {
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+
+	data, err := s.Marshal()
+	if err != nil {
+		return fmt.Errorf("failed to marshal session: %w", err)
+	}
+	if err := store.Save(ctx, id, data); err != nil {
+		return fmt.Errorf("failed to store session %q: %w", id, err)
+	}
+	return nil
+}
+
+// LoadFrom loads the session stored in store under id
+func LoadFrom(ctx context.Context, store Store, id string) (*Session, error) {
+	data, err := store.Load(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return UnmarshalSession(data)
+}
+
+// FileStore keeps each session in its own file, <dir>/<id>.json, written
+// with WriteFileAtomic
+type FileStore struct {
+	dir string
+}
+
+// NewFileStore returns a FileStore over dir, creating it if needed
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+const fileStoreExt = ".json"
+
+func (f *FileStore) path(id string) (string, error) {
+	if id == "" || id == "." || id == ".." || strings.ContainsAny(id, `/\`) || strings.ContainsRune(id, 0) {
+		return "", fmt.Errorf("invalid session ID %q", id)
+	}
+	return filepath.Join(f.dir, id+fileStoreExt), nil
+}
+
+// Save writes data to the session's file
+func (f *FileStore) Save(_ context.Context, id string, data []byte) error {
+	path, err := f.path(id)
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomic(path, data, 0600)
+}
+
+// Load reads the session's file
+func (f *FileStore) Load(_ context.Context, id string) ([]byte, error) {
+	path, err := f.path(id)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrStateNotFound
+	}
+	return data, err
+}
+
+// Delete removes the session's file
+func (f *FileStore) Delete(_ context.Context, id string) error {
+	path, err := f.path(id)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// List returns the IDs of the session files in the directory
+func (f *FileStore) List(_ context.Context) ([]string, error) {
+	entries, err := os.ReadDir(f.dir)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, e := range entries {
+		name := e.Name()
+		// Skip WriteFileAtomic's temporary files
+		if e.Type().IsRegular() && strings.HasSuffix(name, fileStoreExt) && !strings.HasPrefix(name, ".") {
+			ids = append(ids, strings.TrimSuffix(name, fileStoreExt))
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
@@ -0,0 +1,318 @@
+package session
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RedisOptions configures a RedisStore
+type RedisOptions struct {
+	// Addr is the server's host:port (default "localhost:6379")
+	Addr string
+
+	// Username and Password authenticate with AUTH; Username may be empty
+	Username string
+	Password string
+
+	// DB is the database to SELECT
+	DB int
+
+	// Prefix is put before session IDs to form keys (default
+	// "httpcloak:session:")
+	Prefix string
+
+	// TTL expires sessions that are not saved again in time. 0 keeps them.
+	TTL time.Duration
+
+	// DialTimeout bounds connecting and authenticating (default 5s)
+	DialTimeout time.Duration
+
+	// TLS, if set, connects over TLS (rediss://). ServerName defaults to
+	// Addr's host.
+	TLS *tls.Config
+
+	// MaxReplySize caps the length of a single string in a reply
+	// (default 512MB, Redis's own proto-max-bulk-len)
+	MaxReplySize int
+}
+
+// defaultRedisMaxReplySize is Redis's default proto-max-bulk-len
+const defaultRedisMaxReplySize = 512 << 20
+
+// RedisStore keeps sessions as Redis strings. It speaks RESP over a single
+// connection, redialled after errors, so it needs no client library.
+type RedisStore struct {
+	opts RedisOptions
+
+	mu   sync.Mutex
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// redisError is an error reply from the server
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+// NewRedisStore returns a store for the server in opts. It connects on
+// first use.
+func NewRedisStore(opts RedisOptions) *RedisStore {
+	if opts.Addr == "" {
+		opts.Addr = "localhost:6379"
+	}
+	if opts.Prefix == "" {
+		opts.Prefix = "httpcloak:session:"
+	}
+	if opts.DialTimeout <= 0 {
+		opts.DialTimeout = 5 * time.Second
+	}
+	if opts.MaxReplySize <= 0 {
+		opts.MaxReplySize = defaultRedisMaxReplySize
+	}
+	return &RedisStore{opts: opts}
+}
+
+// Save SETs the session's key, with the TTL if one is configured
+func (r *RedisStore) Save(ctx context.Context, id string, data []byte) error {
+	args := []string{"SET", r.opts.Prefix + id, string(data)}
+	if r.opts.TTL > 0 {
+		args = append(args, "PX", strconv.FormatInt(r.opts.TTL.Milliseconds(), 10))
+	}
+	_, err := r.do(ctx, args...)
+	return err
+}
+
+// Load GETs the session's key
+func (r *RedisStore) Load(ctx context.Context, id string) ([]byte, error) {
+	reply, err := r.do(ctx, "GET", r.opts.Prefix+id)
+	if err != nil {
+		return nil, err
+	}
+	data, ok := reply.([]byte)
+	if !ok || data == nil {
+		return nil, ErrStateNotFound
+	}
+	return data, nil
+}
+
+// Delete DELs the session's key
+func (r *RedisStore) Delete(ctx context.Context, id string) error {
+	_, err := r.do(ctx, "DEL", r.opts.Prefix+id)
+	return err
+}
+
+// List SCANs for keys under the prefix
+func (r *RedisStore) List(ctx context.Context) ([]string, error) {
+	match := redisGlobEscape(r.opts.Prefix) + "*"
+	var ids []string
+	cursor := "0"
+	for {
+		reply, err := r.do(ctx, "SCAN", cursor, "MATCH", match, "COUNT", "100")
+		if err != nil {
+			return nil, err
+		}
+		page, ok := reply.([]any)
+		if !ok || len(page) != 2 {
+			return nil, errors.New("redis: unexpected SCAN reply")
+		}
+		next, _ := page[0].([]byte)
+		keys, _ := page[1].([]any)
+		for _, k := range keys {
+			if key, ok := k.([]byte); ok {
+				ids = append(ids, strings.TrimPrefix(string(key), r.opts.Prefix))
+			}
+		}
+		if cursor = string(next); cursor == "0" || cursor == "" {
+			return ids, nil
+		}
+	}
+}
+
+// Close closes the connection
+func (r *RedisStore) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.conn == nil {
+		return nil
+	}
+	err := r.conn.Close()
+	r.conn, r.r = nil, nil
+	return err
+}
+
+// do sends one command and reads its reply. Connection errors drop the
+// connection so the next command redials. Cancelling ctx closes the
+// connection, so a server that stops answering can't hold the store.
+func (r *RedisStore) do(ctx context.Context, args ...string) (any, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.conn == nil {
+		if err := r.dial(ctx); err != nil {
+			return nil, err
+		}
+	}
+	deadline, _ := ctx.Deadline()
+	r.conn.SetDeadline(deadline)
+	conn := r.conn
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	reply, err := r.roundTrip(args...)
+	var replyErr redisError
+	if err != nil && !errors.As(err, &replyErr) {
+		r.conn.Close()
+		r.conn, r.r = nil, nil
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("redis: %w", ctx.Err())
+		}
+	}
+	return reply, err
+}
+
+// dial connects, authenticates and selects the database (caller holds r.mu)
+func (r *RedisStore) dial(ctx context.Context) error {
+	var conn net.Conn
+	var err error
+	d := &net.Dialer{Timeout: r.opts.DialTimeout}
+	if r.opts.TLS != nil {
+		cfg := r.opts.TLS.Clone()
+		if cfg.ServerName == "" {
+			cfg.ServerName, _, _ = net.SplitHostPort(r.opts.Addr)
+		}
+		td := &tls.Dialer{NetDialer: d, Config: cfg}
+		conn, err = td.DialContext(ctx, "tcp", r.opts.Addr)
+	} else {
+		conn, err = d.DialContext(ctx, "tcp", r.opts.Addr)
+	}
+	if err != nil {
+		return fmt.Errorf("redis: %w", err)
+	}
+	conn.SetDeadline(time.Now().Add(r.opts.DialTimeout))
+	r.conn, r.r = conn, bufio.NewReader(conn)
+
+	var setup [][]string
+	if r.opts.Password != "" {
+		if r.opts.Username != "" {
+			setup = append(setup, []string{"AUTH", r.opts.Username, r.opts.Password})
+		} else {
+			setup = append(setup, []string{"AUTH", r.opts.Password})
+		}
+	}
+	if r.opts.DB != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(r.opts.DB)})
+	}
+	for _, cmd := range setup {
+		if _, err := r.roundTrip(cmd...); err != nil {
+			conn.Close()
+			r.conn, r.r = nil, nil
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *RedisStore) roundTrip(args ...string) (any, error) {
+	if _, err := r.conn.Write(appendRESPCommand(nil, args)); err != nil {
+		return nil, err
+	}
+	return readRESP(r.r, r.opts.MaxReplySize)
+}
+
+// appendRESPCommand encodes a command as an array of bulk strings
+func appendRESPCommand(b []byte, args []string) []byte {
+	b = append(b, '*')
+	b = strconv.AppendInt(b, int64(len(args)), 10)
+	b = append(b, "\r\n"...)
+	for _, arg := range args {
+		b = append(b, '$')
+		b = strconv.AppendInt(b, int64(len(arg)), 10)
+		b = append(b, "\r\n"...)
+		b = append(b, arg...)
+		b = append(b, "\r\n"...)
+	}
+	return b
+}
+
+// readRESP reads one reply: a string for simple strings, int64 for
+// integers, []byte for bulk strings (nil for null), []any for arrays and
+// redisError for errors. Bulk strings longer than maxSize are refused, and
+// memory grows with what the server actually sends rather than the lengths
+// it announces.
+func readRESP(r *bufio.Reader, maxSize int) (any, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, errors.New("redis: malformed reply")
+	}
+	kind, body := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+':
+		return body, nil
+	case '-':
+		return nil, redisError(body)
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, fmt.Errorf("redis: malformed bulk length %q", body)
+		}
+		if n < 0 {
+			return []byte(nil), nil
+		}
+		if n > maxSize {
+			return nil, fmt.Errorf("redis: reply of %d bytes exceeds the %d byte limit", n, maxSize)
+		}
+		var data bytes.Buffer
+		if _, err := io.CopyN(&data, r, int64(n)+2); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		return data.Bytes()[:n], nil
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, fmt.Errorf("redis: malformed array length %q", body)
+		}
+		if n < 0 {
+			return []any(nil), nil
+		}
+		items := make([]any, 0, min(n, 1024))
+		for range n {
+			item, err := readRESP(r, maxSize)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: unknown reply type %q", kind)
+}
+
+// redisGlobEscape escapes the characters SCAN MATCH treats as patterns
+func redisGlobEscape(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		if strings.ContainsRune(`*?[]\`, c) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
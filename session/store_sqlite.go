@@ -0,0 +1,88 @@
+package session
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// SQLiteStore keeps sessions in a table of a SQLite database. The caller
+// opens db with the driver of their choice (mattn/go-sqlite3,
+// modernc.org/sqlite, ...), so httpcloak itself links none.
+type SQLiteStore struct {
+	db *sql.DB
+
+	save, load, del, list string
+}
+
+var sqlIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// NewSQLiteStore returns a store over table in db, creating the table if
+// it does not exist. An empty table name means "httpcloak_sessions".
+func NewSQLiteStore(ctx context.Context, db *sql.DB, table string) (*SQLiteStore, error) {
+	if table == "" {
+		table = "httpcloak_sessions"
+	}
+	if !sqlIdentifier.MatchString(table) {
+		return nil, fmt.Errorf("invalid table name %q", table)
+	}
+	create := `CREATE TABLE IF NOT EXISTS ` + table + ` (
+		id TEXT PRIMARY KEY,
+		data BLOB NOT NULL,
+		updated_at INTEGER NOT NULL
+	)`
+	if _, err := db.ExecContext(ctx, create); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", table, err)
+	}
+	return &SQLiteStore{
+		db: db,
+		save: `INSERT INTO ` + table + ` (id, data, updated_at) VALUES (?, ?, ?)
+			ON CONFLICT(id) DO UPDATE SET data = excluded.data, updated_at = excluded.updated_at`,
+		load: `SELECT data FROM ` + table + ` WHERE id = ?`,
+		del:  `DELETE FROM ` + table + ` WHERE id = ?`,
+		list: `SELECT id FROM ` + table,
+	}, nil
+}
+
+// Save upserts the session's row
+func (q *SQLiteStore) Save(ctx context.Context, id string, data []byte) error {
+	_, err := q.db.ExecContext(ctx, q.save, id, data, time.Now().Unix())
+	return err
+}
+
+// Load reads the session's row
+func (q *SQLiteStore) Load(ctx context.Context, id string) ([]byte, error) {
+	var data []byte
+	err := q.db.QueryRowContext(ctx, q.load, id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrStateNotFound
+	}
+	return data, err
+}
+
+// Delete removes the session's row
+func (q *SQLiteStore) Delete(ctx context.Context, id string) error {
+	_, err := q.db.ExecContext(ctx, q.del, id)
+	return err
+}
+
+// List returns the IDs of every row
+func (q *SQLiteStore) List(ctx context.Context) ([]string, error) {
+	rows, err := q.db.QueryContext(ctx, q.list)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
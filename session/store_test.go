@@ -0,0 +1,191 @@
+package session
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileStore(t *testing.T) {
+	ctx := context.Background()
+	dir := filepath.Join(t.TempDir(), "sessions")
+	store, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Load(ctx, "a"); !errors.Is(err, ErrStateNotFound) {
+		t.Fatalf("Load of missing ID: %v", err)
+	}
+	for _, id := range []string{"b", "a"} {
+		if err := store.Save(ctx, id, []byte(`{"id":"`+id+`"}`)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.Save(ctx, "a", []byte(`{"id":"a2"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := store.Load(ctx, "a"); err != nil || string(data) != `{"id":"a2"}` {
+		t.Fatalf("Load = %s, %v", data, err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ".a.json.tmp123"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if ids, err := store.List(ctx); err != nil || !reflect.DeepEqual(ids, []string{"a", "b"}) {
+		t.Fatalf("List = %v, %v", ids, err)
+	}
+
+	if err := store.Delete(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete(ctx, "a"); err != nil {
+		t.Fatalf("second Delete: %v", err)
+	}
+	if ids, _ := store.List(ctx); !reflect.DeepEqual(ids, []string{"b"}) {
+		t.Fatalf("List after Delete = %v", ids)
+	}
+
+	for _, id := range []string{"", "..", "../x", `a\b`} {
+		if err := store.Save(ctx, id, nil); err == nil {
+			t.Errorf("Save(%q) succeeded", id)
+		}
+	}
+}
+
+func TestRESP(t *testing.T) {
+	if got := string(appendRESPCommand(nil, []string{"SET", "k", "v1"})); got != "*3\r\n$3\r\nSET\r\n$1\r\nk\r\n$2\r\nv1\r\n" {
+		t.Errorf("command = %q", got)
+	}
+
+	r := bufio.NewReader(strings.NewReader("+OK\r\n:3\r\n$5\r\nhello\r\n$-1\r\n*2\r\n$1\r\n0\r\n*1\r\n$3\r\nabc\r\n-ERR bad\r\n"))
+	want := []any{"OK", int64(3), []byte("hello"), []byte(nil), []any{[]byte("0"), []any{[]byte("abc")}}}
+	for i, w := range want {
+		got, err := readRESP(r, defaultRedisMaxReplySize)
+		if err != nil || !reflect.DeepEqual(got, w) {
+			t.Errorf("reply %d = %#v, %v; want %#v", i, got, err, w)
+		}
+	}
+	var replyErr redisError
+	if _, err := readRESP(r, defaultRedisMaxReplySize); !errors.As(err, &replyErr) || string(replyErr) != "ERR bad" {
+		t.Errorf("error reply: %v", err)
+	}
+
+	if got := redisGlobEscape("app:[x]*"); got != `app:\[x\]\*` {
+		t.Errorf("escape = %s", got)
+	}
+}
+
+// fakeRedis serves one connection: reply is called with each command read
+// and returns the raw RESP to answer with, "" to leave it unanswered
+func fakeRedis(t *testing.T, ln net.Listener, reply func(cmd []any) string) {
+	t.Helper()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for {
+			cmd, err := readRESP(r, defaultRedisMaxReplySize)
+			if err != nil {
+				return
+			}
+			if resp := reply(cmd.([]any)); resp != "" {
+				conn.Write([]byte(resp))
+			}
+		}
+	}()
+}
+
+func TestRedisStoreCancel(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	fakeRedis(t, ln, func([]any) string { return "" }) // Never answers
+
+	store := NewRedisStore(RedisOptions{Addr: ln.Addr().String()})
+	defer store.Close()
+	ctx, cancel := context.WithCancel(context.Background()) // No deadline
+	time.AfterFunc(50*time.Millisecond, cancel)
+	done := make(chan error, 1)
+	go func() { done <- store.Save(ctx, "a", []byte("{}")) }()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Save = %v, want context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Save ignored the cancelled context")
+	}
+}
+
+func TestRedisStoreReplyLimit(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	fakeRedis(t, ln, func([]any) string { return "$1099511627776\r\nabc" })
+
+	store := NewRedisStore(RedisOptions{Addr: ln.Addr().String(), MaxReplySize: 1 << 20})
+	defer store.Close()
+	if _, err := store.Load(context.Background(), "a"); err == nil || !strings.Contains(err.Error(), "limit") {
+		t.Errorf("Load = %v, want the reply refused", err)
+	}
+}
+
+func TestRedisStoreTLS(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	fakeRedis(t, ln, func(cmd []any) string {
+		if string(cmd[0].([]byte)) == "GET" {
+			return "$2\r\n{}\r\n"
+		}
+		return "-ERR unknown command\r\n"
+	})
+
+	store := NewRedisStore(RedisOptions{Addr: ln.Addr().String(), TLS: &tls.Config{RootCAs: roots}})
+	defer store.Close()
+	if data, err := store.Load(context.Background(), "a"); err != nil || string(data) != "{}" {
+		t.Errorf("Load over TLS = %q, %v", data, err)
+	}
+}
@@ -0,0 +1,31 @@
+package session
+
+// SetStrictMode turns impersonation off or back on for the session's next
+// requests. In strict mode they go out as a plain client sends them (see
+// transport.Transport.SetStrictMode): no browser ClientHello or headers,
+// no client hints, revalidation, Accept-Language or warmups. Cookies, the
+// proxy and the local address stay, so a block seen in one mode and not the
+// other comes from the fingerprint rather than the IP.
+func (s *Session) SetStrictMode(strict bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.transport != nil {
+		s.transport.SetStrictMode(strict)
+	}
+	if s.Config != nil {
+		s.Config.StrictMode = strict
+	}
+}
+
+// StrictMode reports whether impersonation is off (see SetStrictMode)
+func (s *Session) StrictMode() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.strict()
+}
+
+// strict reports whether the session is in strict mode
+func (s *Session) strict() bool {
+	return s.Config != nil && s.Config.StrictMode
+}
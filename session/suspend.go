@@ -0,0 +1,147 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/sardanioss/httpcloak/transport"
+)
+
+// suspendPollInterval is how often Suspend checks for requests in flight
+const suspendPollInterval = 10 * time.Millisecond
+
+// Suspend pauses the session for a process that is about to go away: new
+// requests fail with ErrSessionClosed, requests in flight are waited for
+// (until ctx is done, which leaves the session running and returns
+// ctx.Err()), and then the complete state is captured and the connections
+// closed. Besides what Marshal saves, the state keeps the session's ID and
+// counters, client hint preferences, cached response bodies, DNS entries
+// and a pending Refresh. Pass it to Resume to carry on where it left off.
+func (s *Session) Suspend(ctx context.Context) ([]byte, error) {
+	s.mu.Lock()
+	if !s.active {
+		s.mu.Unlock()
+		return nil, ErrSessionClosed
+	}
+	s.active = false
+	s.mu.Unlock()
+
+	for s.inflight.Load() > 0 {
+		if err := sleepCtx(ctx, suspendPollInterval); err != nil {
+			s.mu.Lock()
+			s.active = true
+			s.mu.Unlock()
+			return nil, err
+		}
+	}
+	s.StopAutoSave()
+
+	state := s.snapshotState()
+	if state.DNS == nil {
+		if dnsCache := s.transport.GetDNSCache(); dnsCache != nil {
+			state.DNS = dnsCache.Export()
+		}
+	}
+	state.Suspended = s.suspendedState()
+
+	s.mu.Lock()
+	s.closeConnections()
+	s.mu.Unlock()
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal session: %w", err)
+	}
+	return data, nil
+}
+
+// suspendedState copies the in-memory state Suspend keeps
+func (s *Session) suspendedState() *SuspendedState {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	st := &SuspendedState{
+		ID:           s.ID,
+		LastUsed:     s.LastUsed,
+		RequestCount: s.RequestCount,
+		Refreshed:    s.refreshed,
+	}
+	if s.switchProtocol != transport.ProtocolAuto {
+		st.SwitchProtocol = s.switchProtocol.String()
+	}
+	if len(s.clientHints) > 0 {
+		st.ClientHints = make(map[string][]string, len(s.clientHints))
+		for host, hints := range s.clientHints {
+			names := make([]string, 0, len(hints))
+			for name, on := range hints {
+				if on {
+					names = append(names, name)
+				}
+			}
+			sort.Strings(names)
+			st.ClientHints[host] = names
+		}
+	}
+	for url, entry := range s.cacheEntries {
+		if entry.response == nil {
+			continue
+		}
+		if st.Responses == nil {
+			st.Responses = make(map[string]CachedResponseState)
+		}
+		st.Responses[url] = CachedResponseState{Headers: entry.response.headers, Body: entry.response.body}
+	}
+	return st
+}
+
+// applySuspendedState restores what suspendedState captured. The cache
+// validators must already be imported.
+func (s *Session) applySuspendedState(st *SuspendedState) {
+	s.mu.Lock()
+	if st.ID != "" {
+		s.ID = st.ID
+	}
+	s.LastUsed = st.LastUsed
+	s.RequestCount = st.RequestCount
+	s.refreshed = st.Refreshed
+	if p, err := parseProtocol(st.SwitchProtocol); err == nil && p != transport.ProtocolAuto {
+		s.switchProtocol = p
+	}
+	for host, names := range st.ClientHints {
+		hints := make(map[string]bool, len(names))
+		for _, name := range names {
+			hints[name] = true
+		}
+		s.clientHints[host] = hints
+	}
+	s.mu.Unlock()
+
+	for url, r := range st.Responses {
+		s.storeCachedResponse(url, &cachedResponse{headers: r.Headers, body: r.Body})
+	}
+}
+
+// Resume restores a session from Suspend's state
+func Resume(data []byte) (*Session, error) {
+	return ResumeWithOptions(data, nil)
+}
+
+// ResumeWithOptions is Resume with the options that can't be saved
+// (hooks, cache backends), which the suspended session had in its
+// SessionOptions
+func ResumeWithOptions(data []byte, opts *SessionOptions) (*Session, error) {
+	if IsEncryptedState(data) {
+		return nil, fmt.Errorf("session data is encrypted: decrypt it with DecryptState first")
+	}
+	var state SessionState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse session data: %w", err)
+	}
+	if state.Version != SessionStateVersion {
+		return nil, fmt.Errorf("session state version %d is not %d", state.Version, SessionStateVersion)
+	}
+	return restoreSession(&state, opts), nil
+}
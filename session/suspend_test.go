@@ -0,0 +1,49 @@
+package session
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/sardanioss/httpcloak/transport"
+)
+
+func TestSuspendedStateRoundTrip(t *testing.T) {
+	s := &Session{
+		ID:             "abc",
+		RequestCount:   7,
+		cacheEntries:   make(map[string]*cacheEntry),
+		clientHints:    map[string]map[string]bool{"example.com": {"sec-ch-ua-arch": true, "sec-ch-ua-model": true}},
+		refreshed:      true,
+		switchProtocol: transport.ProtocolHTTP2,
+	}
+	s.storeCacheHeaders("https://example.com/", map[string][]string{"etag": {`"v1"`}})
+	s.storeCachedResponse("https://example.com/", &cachedResponse{
+		headers: map[string][]string{"etag": {`"v1"`}, "content-type": {"text/html"}},
+		body:    []byte("<html>"),
+	})
+
+	// Through JSON, as Suspend and Resume do
+	data, err := json.Marshal(&SessionState{Cache: s.exportCache(), Suspended: s.suspendedState()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var state SessionState
+	if err := json.Unmarshal(data, &state); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := &Session{cacheEntries: make(map[string]*cacheEntry), clientHints: make(map[string]map[string]bool)}
+	restored.importCache(state.Cache)
+	restored.applySuspendedState(state.Suspended)
+
+	if restored.ID != "abc" || restored.RequestCount != 7 || !restored.refreshed || restored.switchProtocol != transport.ProtocolHTTP2 {
+		t.Errorf("restored session = %+v", restored)
+	}
+	if hints := restored.clientHints["example.com"]; len(hints) != 2 || !hints["sec-ch-ua-arch"] {
+		t.Errorf("restored client hints = %v", restored.clientHints)
+	}
+	entry := restored.cacheEntries["https://example.com/"]
+	if entry == nil || entry.response == nil || string(entry.response.body) != "<html>" || restored.cachedBodyBytes != 6 {
+		t.Errorf("restored cached response = %+v", entry)
+	}
+}
@@ -0,0 +1,182 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sardanioss/httpcloak/fingerprint"
+	"github.com/sardanioss/httpcloak/transport"
+)
+
+// tokenExpiryDelta is how long before its expiry a token is replaced, so
+// it doesn't expire on the way to the server
+const tokenExpiryDelta = 10 * time.Second
+
+// Token is an OAuth2 access token
+type Token struct {
+	AccessToken string
+	TokenType   string    // Authorization scheme. Default: Bearer
+	Expiry      time.Time // Zero if the token doesn't expire
+}
+
+// valid reports whether t can still be sent
+func (t *Token) valid() bool {
+	return t != nil && t.AccessToken != "" && (t.Expiry.IsZero() || time.Until(t.Expiry) > tokenExpiryDelta)
+}
+
+// header returns the Authorization header carrying t
+func (t *Token) header() string {
+	tokenType := t.TokenType
+	if tokenType == "" || strings.EqualFold(tokenType, "bearer") {
+		tokenType = "Bearer"
+	}
+	return tokenType + " " + t.AccessToken
+}
+
+// TokenSource issues access tokens, typically by running a refresh token or
+// client credentials grant. The session caches the token and calls Token
+// again only once it has expired or a server refused it with a 401, one
+// call at a time.
+type TokenSource interface {
+	Token(ctx context.Context) (*Token, error)
+}
+
+// TokenSourceFunc adapts a function to TokenSource
+type TokenSourceFunc func(ctx context.Context) (*Token, error)
+
+func (f TokenSourceFunc) Token(ctx context.Context) (*Token, error) {
+	return f(ctx)
+}
+
+// TokenOptions configures OAuth2 authorization for a session
+type TokenOptions struct {
+	Source TokenSource
+
+	// Hosts the token is sent to, matched like header rule hosts:
+	// "example.com" includes its subdomains. Empty sends it to the origin
+	// of each request, and to redirect targets on other origins only with
+	// KeepRedirectCredentials.
+	Hosts []string
+}
+
+// tokenCache holds a session's current token and the refresh in flight
+type tokenCache struct {
+	mu      sync.Mutex
+	token   *Token
+	refresh *tokenRefresh
+}
+
+// tokenRefresh is one call to the TokenSource, shared by the requests
+// waiting for it
+type tokenRefresh struct {
+	done  chan struct{}
+	token *Token
+	err   error
+}
+
+// get returns a valid token other than stale, asking src for a new one if
+// needed. Concurrent callers share a single call to src.
+func (c *tokenCache) get(ctx context.Context, src TokenSource, stale *Token) (*Token, error) {
+	c.mu.Lock()
+	if c.token.valid() && c.token != stale {
+		token := c.token
+		c.mu.Unlock()
+		return token, nil
+	}
+	r := c.refresh
+	if r == nil {
+		r = &tokenRefresh{done: make(chan struct{})}
+		c.refresh = r
+		c.mu.Unlock()
+
+		r.token, r.err = src.Token(ctx)
+		if r.err == nil && (r.token == nil || r.token.AccessToken == "") {
+			r.err = fmt.Errorf("token source returned no access token")
+		}
+		c.mu.Lock()
+		if r.err == nil {
+			c.token = r.token
+		}
+		c.refresh = nil
+		c.mu.Unlock()
+		close(r.done)
+	} else {
+		c.mu.Unlock()
+		select {
+		case <-r.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if r.err != nil {
+		return nil, fmt.Errorf("oauth2 token: %w", r.err)
+	}
+	return r.token, nil
+}
+
+// tokenRetriedKey marks a request already sent again with a refreshed token
+type tokenRetriedKey struct{}
+
+// redirectTokenContext returns the context for a redirect's next hop, which
+// gets its own retry with a refreshed token
+func redirectTokenContext(ctx context.Context) context.Context {
+	if ctx.Value(tokenRetriedKey{}) == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, tokenRetriedKey{}, nil)
+}
+
+// authorize returns req as it is sent, with the session's access token in
+// its Authorization header, and the token used. origin is the URL the
+// request's redirect chain started at. Requests that set their own
+// Authorization, and hosts outside TokenOptions.Hosts (or, without Hosts,
+// other origins than the chain's), are sent as they are with a nil token.
+func (s *Session) authorize(ctx context.Context, req *transport.Request, origin string) (*transport.Request, *Token, error) {
+	if s.options == nil || s.options.Tokens == nil || s.options.Tokens.Source == nil || headerValue(req.Headers, "Authorization") != "" {
+		return req, nil, nil
+	}
+	if hosts := s.options.Tokens.Hosts; len(hosts) > 0 {
+		filter := &transport.HostFilter{Allowed: hosts}
+		if filter.Check(extractHost(req.URL)) != nil {
+			return req, nil, nil
+		}
+	} else if fingerprint.CrossOrigin(origin, req.URL) && (s.Config == nil || !s.Config.KeepRedirectCredentials) {
+		return req, nil, nil
+	}
+	token, err := s.tokens.get(ctx, s.options.Tokens.Source, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Kept off req, so redirects don't carry it to hosts it isn't meant for
+	authorized := *req
+	authorized.Headers = make(map[string][]string, len(req.Headers)+1)
+	for k, v := range req.Headers {
+		authorized.Headers[k] = v
+	}
+	authorized.Headers["Authorization"] = []string{token.header()}
+	return &authorized, token, nil
+}
+
+// refreshRefusedToken checks a response to a request authorized with token.
+// If the server refused the token with a 401, it is replaced and the request
+// to send again is returned with the context to send it in. Each request is
+// retried at most once.
+func (s *Session) refreshRefusedToken(ctx context.Context, req *transport.Request, resp *transport.Response, token *Token) (context.Context, *transport.Request, error) {
+	if token == nil || resp.StatusCode != 401 || ctx.Value(tokenRetriedKey{}) != nil || !req.Replayable() {
+		return nil, nil, nil
+	}
+	if _, err := s.tokens.get(ctx, s.options.Tokens.Source, token); err != nil {
+		return nil, nil, err
+	}
+	retry := *req
+	retry.Headers = make(map[string][]string, len(req.Headers))
+	for k, v := range req.Headers {
+		if k != "Cookie" { // Rebuilt from the jar
+			retry.Headers[k] = v
+		}
+	}
+	return context.WithValue(ctx, tokenRetriedKey{}, true), &retry, nil
+}
@@ -0,0 +1,104 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sardanioss/httpcloak/protocol"
+)
+
+func TestTokenCacheSingleFlight(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	src := TokenSourceFunc(func(ctx context.Context) (*Token, error) {
+		n := calls.Add(1)
+		<-release
+		return &Token{AccessToken: fmt.Sprintf("t%d", n), Expiry: time.Now().Add(time.Hour)}, nil
+	})
+
+	var c tokenCache
+	var wg sync.WaitGroup
+	tokens := make([]*Token, 8)
+	for i := range tokens {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tokens[i], _ = c.get(context.Background(), src, nil)
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("token source called %d times, want 1", n)
+	}
+	for _, tok := range tokens {
+		if tok == nil || tok.AccessToken != "t1" {
+			t.Fatalf("got %+v, want t1", tok)
+		}
+	}
+
+	// Cached until refused
+	if tok, _ := c.get(context.Background(), src, nil); tok.AccessToken != "t1" {
+		t.Errorf("cached token = %s, want t1", tok.AccessToken)
+	}
+	if tok, _ := c.get(context.Background(), src, tokens[0]); tok.AccessToken != "t2" {
+		t.Errorf("refreshed token = %s, want t2", tok.AccessToken)
+	}
+}
+
+func TestTokenHeader(t *testing.T) {
+	for tokenType, want := range map[string]string{
+		"":       "Bearer abc",
+		"bearer": "Bearer abc",
+		"MAC":    "MAC abc",
+	} {
+		if got := (&Token{AccessToken: "abc", TokenType: tokenType}).header(); got != want {
+			t.Errorf("%q: got %q, want %q", tokenType, got, want)
+		}
+	}
+	if (&Token{AccessToken: "abc", Expiry: time.Now().Add(time.Second)}).valid() {
+		t.Error("token about to expire is valid")
+	}
+}
+
+func TestTokenStaysOnOrigin(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	defer target.Close()
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			t.Errorf("origin got Authorization %q", r.Header.Get("Authorization"))
+		}
+		http.Redirect(w, r, target.URL+"/landing", http.StatusFound)
+	}))
+	defer origin.Close()
+
+	src := TokenSourceFunc(func(ctx context.Context) (*Token, error) {
+		return &Token{AccessToken: "secret"}, nil
+	})
+	for keep, want := range map[bool]string{false: "", true: "Bearer secret"} {
+		s := NewSessionWithOptions("", &protocol.SessionConfig{
+			Preset:                  "chrome-143",
+			ForceHTTP1:              true,
+			FollowRedirects:         true,
+			KeepRedirectCredentials: keep,
+		}, &SessionOptions{Tokens: &TokenOptions{Source: src}})
+		resp, err := s.Get(context.Background(), origin.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := resp.Bytes()
+		if string(body) != want {
+			t.Errorf("keep=%v: redirect target got Authorization %q, want %q", keep, body, want)
+		}
+		s.Close()
+	}
+}
@@ -3,8 +3,9 @@ package session
 import (
 	"context"
 	"io"
+	"net/url"
+	"sort"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/sardanioss/httpcloak/fingerprint"
@@ -16,22 +17,51 @@ import (
 type resourceType int
 
 const (
-	resourceCSS   resourceType = iota
+	resourceCSS resourceType = iota
 	resourceJS
 	resourceImage
 	resourceFont
 )
 
+// String returns the name used for the type in saved session state
+func (t resourceType) String() string {
+	switch t {
+	case resourceCSS:
+		return "style"
+	case resourceJS:
+		return "script"
+	case resourceImage:
+		return "image"
+	case resourceFont:
+		return "font"
+	}
+	return "unknown"
+}
+
+// parseResourceType is the inverse of resourceType.String
+func parseResourceType(name string) (resourceType, bool) {
+	for _, t := range []resourceType{resourceCSS, resourceJS, resourceImage, resourceFont} {
+		if t.String() == name {
+			return t, true
+		}
+	}
+	return 0, false
+}
+
 // subresource is a URL discovered in the HTML with its type.
 type subresource struct {
-	url  string
-	typ  resourceType
+	url string
+	typ resourceType
+
+	// priority is what Chrome would give it when that differs from the
+	// preset's value for its destination (see chromePriority)
+	priority *fingerprint.Priority
 }
 
 // maxSubresources caps how many subresources we fetch.
 const maxSubresources = 50
 
-// concurrencyLimit matches Chrome's per-host H1 connection limit.
+// concurrencyLimit matches Chrome's per-origin H1 connection limit.
 const concurrencyLimit = 6
 
 // Warmup simulates a real browser page load: fetches the HTML, discovers
@@ -42,7 +72,18 @@ const concurrencyLimit = 6
 // Navigation failure returns an error. Subresource failures are silently
 // ignored (matching browser behavior). A non-HTML response returns nil
 // (the navigation still warmed TLS/cookies).
+//
+// A session that loaded the page before (including one restored with
+// LoadSession) sends its cached validators, so the server can answer 304
+// like it would to a returning visitor. The page's subresources are then
+// the ones found on the previous load, each revalidated in turn.
 func (s *Session) Warmup(ctx context.Context, url string) error {
+	return s.warmup(ctx, url, 0)
+}
+
+// warmup loads url like Warmup, fetching at most limit subresources in
+// priority order (0 for no limit)
+func (s *Session) warmup(ctx context.Context, url string, limit int) error {
 	// 1. Navigation request — preset headers apply automatically
 	resp, err := s.Request(ctx, &transport.Request{
 		Method: "GET",
@@ -58,26 +99,37 @@ func (s *Session) Warmup(ctx context.Context, url string) error {
 		return err
 	}
 
-	// Non-HTML response — still warmed TLS/cookies, return success
-	ct := ""
-	if vals, ok := resp.Headers["content-type"]; ok && len(vals) > 0 {
-		ct = vals[0]
-	}
-	if !strings.Contains(ct, "text/html") {
-		return nil
+	pageURL := resp.FinalURL
+	if pageURL == "" {
+		pageURL = url
 	}
 
-	// 2. Parse HTML and extract subresource URLs
-	resources := parseSubresources(body, url)
+	var resources []subresource
+	if resp.StatusCode == 304 {
+		// 2. Not modified: the browser would render its cached copy
+		resources = s.cachedSubresources(pageURL)
+	} else {
+		// Non-HTML response — still warmed TLS/cookies, return success
+		ct := ""
+		if vals, ok := resp.Headers["content-type"]; ok && len(vals) > 0 {
+			ct = vals[0]
+		}
+		if !strings.Contains(ct, "text/html") {
+			return nil
+		}
+
+		// 2. Parse HTML and extract subresource URLs
+		resources = parseSubresources(body, url)
+		s.rememberSubresources(pageURL, resources)
+	}
 
 	// 3. Group by priority: [CSS+Fonts] → [JS] → [Images]
 	cssAndFonts, scripts, images := groupByPriority(resources)
+	if limit > 0 {
+		cssAndFonts, scripts, images = firstResources(limit, cssAndFonts, scripts, images)
+	}
 
 	// 4. Fetch batches with inter-batch delays
-	pageURL := resp.FinalURL
-	if pageURL == "" {
-		pageURL = url
-	}
 
 	batches := [][]subresource{cssAndFonts, scripts, images}
 	delays := []struct{ min, max int }{{0, 0}, {50, 150}, {100, 300}}
@@ -94,7 +146,7 @@ func (s *Session) Warmup(ctx context.Context, url string) error {
 
 		// Inter-batch delay (skip for first batch)
 		if i > 0 && delays[i].max > 0 {
-			if err := interBatchDelay(ctx, delays[i].min, delays[i].max); err != nil {
+			if err := s.interBatchDelay(ctx, delays[i].min, delays[i].max); err != nil {
 				return err
 			}
 		}
@@ -105,11 +157,33 @@ func (s *Session) Warmup(ctx context.Context, url string) error {
 	return nil
 }
 
+// rememberSubresources records a page's subresources with its cache entry,
+// for the next Warmup that gets a 304. Pages without validators are never
+// revalidated, so there is nothing to record.
+func (s *Session) rememberSubresources(pageURL string, resources []subresource) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if entry := s.cacheEntries[pageURL]; entry != nil {
+		entry.subresources = resources
+	}
+}
+
+// cachedSubresources returns the subresources recorded for pageURL
+func (s *Session) cachedSubresources(pageURL string) []subresource {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if entry := s.cacheEntries[pageURL]; entry != nil {
+		return entry.subresources
+	}
+	return nil
+}
+
 // parseSubresources tokenizes HTML and extracts subresource URLs.
 func parseSubresources(body []byte, baseURL string) []subresource {
 	tokenizer := html.NewTokenizer(strings.NewReader(string(body)))
 	seen := make(map[string]bool)
 	var resources []subresource
+	images := 0
 
 	for {
 		tt := tokenizer.Next()
@@ -124,26 +198,20 @@ func parseSubresources(body []byte, baseURL string) []subresource {
 		if !hasAttr {
 			continue
 		}
-		tagName := string(tn)
+		attrs := tagAttrs(tokenizer)
 
-		switch tagName {
+		var src string
+		var typ resourceType
+		switch string(tn) {
 		case "link":
-			href, rel, as := parseLinkAttrs(tokenizer)
-			if href == "" {
-				continue
-			}
-			var typ resourceType
-			var matched bool
-			switch rel {
+			src = attrs["href"]
+			switch strings.ToLower(attrs["rel"]) {
 			case "stylesheet":
 				typ = resourceCSS
-				matched = true
 			case "icon":
 				typ = resourceImage
-				matched = true
 			case "preload":
-				matched = true
-				switch as {
+				switch strings.ToLower(attrs["as"]) {
 				case "style":
 					typ = resourceCSS
 				case "script":
@@ -153,36 +221,31 @@ func parseSubresources(body []byte, baseURL string) []subresource {
 				case "font":
 					typ = resourceFont
 				default:
-					matched = false
-				}
-			}
-			if matched {
-				resolved := resolveURL(baseURL, href)
-				if !seen[resolved] {
-					seen[resolved] = true
-					resources = append(resources, subresource{url: resolved, typ: typ})
+					continue
 				}
+			default:
+				continue
 			}
-
 		case "script":
-			src := getAttr(tokenizer, "src")
-			if src != "" {
-				resolved := resolveURL(baseURL, src)
-				if !seen[resolved] {
-					seen[resolved] = true
-					resources = append(resources, subresource{url: resolved, typ: resourceJS})
-				}
-			}
-
+			src, typ = attrs["src"], resourceJS
 		case "img":
-			src := getAttr(tokenizer, "src")
-			if src != "" {
-				resolved := resolveURL(baseURL, src)
-				if !seen[resolved] {
-					seen[resolved] = true
-					resources = append(resources, subresource{url: resolved, typ: resourceImage})
-				}
+			src, typ = attrs["src"], resourceImage
+		default:
+			continue
+		}
+		if src == "" {
+			continue
+		}
+
+		resolved := resolveURL(baseURL, src)
+		if !seen[resolved] {
+			seen[resolved] = true
+			img := string(tn) == "img"
+			r := subresource{url: resolved, typ: typ, priority: chromePriority(typ, attrs, img && images < boostedImages)}
+			if img {
+				images++
 			}
+			resources = append(resources, r)
 		}
 
 		if len(resources) >= maxSubresources {
@@ -193,38 +256,55 @@ func parseSubresources(body []byte, baseURL string) []subresource {
 	return resources
 }
 
-// parseLinkAttrs extracts href, rel, and as attributes from a <link> tag.
-func parseLinkAttrs(z *html.Tokenizer) (href, rel, as string) {
-	for {
-		key, val, more := z.TagAttr()
-		k := string(key)
-		switch k {
-		case "href":
-			href = string(val)
-		case "rel":
-			rel = strings.ToLower(string(val))
-		case "as":
-			as = strings.ToLower(string(val))
+// boostedImages is how many of a page's first images Chrome loads at Medium
+// rather than Low priority, expecting them in the viewport
+const boostedImages = 5
+
+// chromePriority returns the priority Chrome gives a subresource whose
+// markup moves it off the default for its destination, or nil when the
+// preset's value for the destination applies. Chrome's request priorities
+// map to urgencies VeryHigh 0, High 1, Medium 2, Low 3 and VeryLow 4; only
+// images load incrementally. boost marks one of the page's first <img>.
+func chromePriority(typ resourceType, attrs map[string]string, boost bool) *fingerprint.Priority {
+	fetchPriority := strings.ToLower(attrs["fetchpriority"])
+	switch typ {
+	case resourceCSS:
+		if fetchPriority == "low" {
+			return &fingerprint.Priority{Urgency: 1}
 		}
-		if !more {
-			break
+	case resourceJS:
+		_, async := attrs["async"]
+		_, deferred := attrs["defer"]
+		if fetchPriority == "high" {
+			return nil
+		}
+		if fetchPriority == "low" || async || deferred {
+			return &fingerprint.Priority{Urgency: 3}
+		}
+	case resourceImage:
+		switch {
+		case fetchPriority == "high":
+			return &fingerprint.Priority{Urgency: 1, Incremental: true}
+		case fetchPriority == "" && boost:
+			return &fingerprint.Priority{Urgency: 2, Incremental: true}
 		}
 	}
-	return
+	return nil
 }
 
-// getAttr extracts a single attribute value from the current tag's remaining attributes.
-func getAttr(z *html.Tokenizer, name string) string {
+// tagAttrs reads the current tag's attributes
+func tagAttrs(z *html.Tokenizer) map[string]string {
+	attrs := make(map[string]string)
 	for {
 		key, val, more := z.TagAttr()
-		if string(key) == name {
-			return string(val)
+		if _, ok := attrs[string(key)]; !ok { // The first of a repeated attribute wins
+			attrs[string(key)] = string(val)
 		}
 		if !more {
 			break
 		}
 	}
-	return ""
+	return attrs
 }
 
 // groupByPriority splits resources into three batches matching Chrome's loading order.
@@ -242,109 +322,196 @@ func groupByPriority(resources []subresource) (cssAndFonts, scripts, images []su
 	return
 }
 
-// fetchBatch fetches a batch of subresources concurrently (up to concurrencyLimit).
-// Errors are silently ignored (matches browser behavior).
-func fetchBatch(ctx context.Context, s *Session, batch []subresource, pageURL string) {
-	sem := make(chan struct{}, concurrencyLimit)
-	var wg sync.WaitGroup
+// firstResources trims batches to their first n resources overall, in order
+func firstResources(n int, cssAndFonts, scripts, images []subresource) ([]subresource, []subresource, []subresource) {
+	batches := [][]subresource{cssAndFonts, scripts, images}
+	for i, batch := range batches {
+		batches[i] = batch[:min(n, len(batch))]
+		n -= len(batches[i])
+	}
+	return batches[0], batches[1], batches[2]
+}
 
-	for _, res := range batch {
-		if ctx.Err() != nil {
-			break
+// fetchBatch fetches a batch of subresources as Chrome schedules them (see
+// scheduleFetches). Errors are silently ignored (matches browser behavior).
+func fetchBatch(ctx context.Context, s *Session, batch []subresource, pageURL string) {
+	scheduleFetches(ctx, batch, pageURL, func(r subresource) {
+		headers := buildSubresourceHeaders(r.typ, pageURL, r.url)
+		req := &transport.Request{
+			Method:   "GET",
+			URL:      r.url,
+			Headers:  headers,
+			Priority: r.priority,
 		}
 
-		wg.Add(1)
-		sem <- struct{}{} // acquire
-
-		go func(r subresource) {
-			defer wg.Done()
-			defer func() { <-sem }() // release
+		// Subresources load together, outside the request gap
+		resp, err := s.requestWithRedirects(ctx, req, 0, nil, nil)
+		if err != nil {
+			return
+		}
+		// Discard body — side effects (cookies/cache/TLS) already captured
+		if resp.Body != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+	})
+}
 
-			if ctx.Err() != nil {
-				return
+// maxDelayableInFlight is how many delayable requests (below Medium
+// priority: images, async scripts) Chrome's ResourceScheduler lets a page
+// have in flight at once
+const maxDelayableInFlight = 10
+
+// scheduleFetches runs fetch for each resource the way Chrome's loader
+// schedules a page's subresources, returning when all are done or ctx is:
+//   - higher priorities start first, and at the same priority the page's own
+//     site goes before third parties, so a third-party script waits behind
+//     first-party ones rather than racing them for the connection budget
+//   - each origin has at most concurrencyLimit requests in flight, as an
+//     HTTP/1.1 socket pool allows, whatever the other origins are doing
+//   - at most maxDelayableInFlight delayable requests run at once
+//
+// A resource that can't start yet doesn't hold up later ones that can. The
+// per-origin cap applies over HTTP/2 and HTTP/3 too: which protocol an
+// origin speaks isn't known before its connection is made.
+func scheduleFetches(ctx context.Context, batch []subresource, pageURL string, fetch func(subresource)) {
+	pending := fetchQueue(batch, pageURL)
+	inFlight := make(map[string]int) // By origin
+	delayableInFlight := 0
+	done := make(chan queuedFetch, len(pending))
+	running := 0
+	for {
+		if ctx.Err() == nil {
+			rest := pending[:0]
+			for _, q := range pending {
+				delayable := q.urgency >= 2 // Below Medium
+				if inFlight[q.origin] >= concurrencyLimit || delayable && delayableInFlight >= maxDelayableInFlight {
+					rest = append(rest, q)
+					continue
+				}
+				inFlight[q.origin]++
+				if delayable {
+					delayableInFlight++
+				}
+				running++
+				go func(q queuedFetch) {
+					defer func() { done <- q }()
+					fetch(q.res)
+				}(q)
 			}
-
-			headers := buildSubresourceHeaders(r.typ, pageURL, r.url)
-			req := &transport.Request{
-				Method:  "GET",
-				URL:     r.url,
-				Headers: headers,
+			pending = rest
+		}
+		if running == 0 {
+			return
+		}
+		select {
+		case q := <-done:
+			running--
+			inFlight[q.origin]--
+			if q.urgency >= 2 {
+				delayableInFlight--
 			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
 
-			resp, err := s.Request(ctx, req)
-			if err != nil {
-				return
-			}
-			// Discard body — side effects (cookies/cache/TLS) already captured
-			if resp.Body != nil {
-				io.Copy(io.Discard, resp.Body)
-				resp.Body.Close()
-			}
-		}(res)
+// queuedFetch is a subresource waiting in scheduleFetches
+type queuedFetch struct {
+	res        subresource
+	origin     string
+	urgency    int
+	thirdParty bool
+}
+
+// fetchQueue orders a batch for scheduleFetches: by urgency, then the
+// page's own site before third parties, then document order
+func fetchQueue(batch []subresource, pageURL string) []queuedFetch {
+	queue := make([]queuedFetch, len(batch))
+	for i, r := range batch {
+		queue[i] = queuedFetch{res: r, origin: resourceOrigin(r.url), urgency: fetchUrgency(r), thirdParty: thirdParty(pageURL, r.url)}
+	}
+	sort.SliceStable(queue, func(i, k int) bool {
+		a, b := queue[i], queue[k]
+		if a.urgency != b.urgency {
+			return a.urgency < b.urgency
+		}
+		return !a.thirdParty && b.thirdParty
+	})
+	return queue
+}
+
+// fetchUrgency returns the RFC 9218 urgency Chrome gives r: its own
+// priority, or its destination's (style and font 0, script 1, image 3)
+func fetchUrgency(r subresource) int {
+	if r.priority != nil {
+		return r.priority.Urgency
+	}
+	switch r.typ {
+	case resourceJS:
+		return 1
+	case resourceImage:
+		return 3
 	}
+	return 0
+}
 
-	// Context-aware wait
-	done := make(chan struct{})
-	go func() {
-		wg.Wait()
-		close(done)
-	}()
-	select {
-	case <-done:
-	case <-ctx.Done():
+// resourceOrigin returns the scheme://host[:port] a resource is fetched from
+func resourceOrigin(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
 	}
+	return u.Scheme + "://" + u.Host
+}
+
+// thirdParty reports whether target is on another site than the page
+func thirdParty(pageURL, target string) bool {
+	site := fingerprint.GenerateSecFetchHeaders(fingerprint.ImageContext(pageURL, target)).Site
+	return site == string(fingerprint.FetchSiteCrossSite)
 }
 
 // buildSubresourceHeaders returns the headers for a subresource request,
-// overriding the preset's navigation defaults with per-type values.
+// overriding the preset's navigation defaults with per-type values. Priority
+// is left to the transport, which picks the preset's value for the
+// Sec-Fetch-Dest and the protocol the request goes out on, or the
+// subresource's own priority when its markup changes it.
 func buildSubresourceHeaders(typ resourceType, pageURL, targetURL string) map[string][]string {
 	var reqCtx fingerprint.RequestContext
-	var accept, priority string
+	var accept string
 
 	switch typ {
 	case resourceCSS:
 		reqCtx = fingerprint.StyleContext(pageURL, targetURL)
 		accept = "text/css,*/*;q=0.1"
-		priority = "u=0, i"
 	case resourceJS:
 		reqCtx = fingerprint.ScriptContext(pageURL, targetURL)
 		accept = "*/*"
-		priority = "u=1"
 	case resourceImage:
 		reqCtx = fingerprint.ImageContext(pageURL, targetURL)
 		accept = "image/avif,image/webp,image/apng,image/svg+xml,image/*,*/*;q=0.8"
-		priority = "u=2"
 	case resourceFont:
 		reqCtx = fingerprint.FontContext(pageURL, targetURL)
 		accept = "*/*"
-		priority = "u=3"
 	}
 
 	secFetch := fingerprint.GenerateSecFetchHeaders(reqCtx)
 
 	headers := map[string][]string{
-		"Accept":          {accept},
-		"Sec-Fetch-Site":  {secFetch.Site},
-		"Sec-Fetch-Mode":  {secFetch.Mode},
-		"Sec-Fetch-Dest":  {secFetch.Dest},
-		"Referer":         {pageURL},
-		"Priority":        {priority},
+		"Accept":         {accept},
+		"Sec-Fetch-Site": {secFetch.Site},
+		"Sec-Fetch-Mode": {secFetch.Mode},
+		"Sec-Fetch-Dest": {secFetch.Dest},
+		"Referer":        {pageURL},
 	}
 
 	return headers
 }
 
-// interBatchDelay waits a random duration between min and max milliseconds,
-// respecting context cancellation.
-func interBatchDelay(ctx context.Context, minMs, maxMs int) error {
-	d := time.Duration(minMs) * time.Millisecond
-	if maxMs > minMs {
-		d += time.Duration(randInt64(int64(maxMs-minMs))) * time.Millisecond
-	}
-	select {
-	case <-time.After(d):
-		return nil
-	case <-ctx.Done():
-		return ctx.Err()
-	}
+// interBatchDelay waits between min and max milliseconds as timed by the
+// session's behavior clock, respecting context cancellation.
+func (s *Session) interBatchDelay(ctx context.Context, minMs, maxMs int) error {
+	d := s.clock.Between(time.Duration(minMs)*time.Millisecond, time.Duration(maxMs)*time.Millisecond)
+	return sleepCtx(ctx, d)
 }
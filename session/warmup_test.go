@@ -2,9 +2,14 @@ package session
 
 import (
 	"context"
+	"fmt"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/sardanioss/httpcloak/fingerprint"
+	"github.com/sardanioss/httpcloak/transport"
 )
 
 func TestParseSubresources(t *testing.T) {
@@ -201,6 +206,21 @@ func TestGroupByPriority_Empty(t *testing.T) {
 	}
 }
 
+func TestFirstResources(t *testing.T) {
+	css := []subresource{{url: "a.css", typ: resourceCSS}, {url: "b.woff2", typ: resourceFont}}
+	js := []subresource{{url: "c.js", typ: resourceJS}, {url: "d.js", typ: resourceJS}}
+	img := []subresource{{url: "e.png", typ: resourceImage}}
+
+	css3, js3, img3 := firstResources(3, css, js, img)
+	if len(css3) != 2 || len(js3) != 1 || js3[0].url != "c.js" || len(img3) != 0 {
+		t.Errorf("first 3: %v %v %v", css3, js3, img3)
+	}
+	css9, js9, img9 := firstResources(9, css, js, img)
+	if len(css9) != 2 || len(js9) != 2 || len(img9) != 1 {
+		t.Errorf("first 9: %v %v %v", css9, js9, img9)
+	}
+}
+
 func TestBuildSubresourceHeaders_CSS(t *testing.T) {
 	headers := buildSubresourceHeaders(resourceCSS, "https://example.com/page", "https://example.com/style.css")
 
@@ -208,7 +228,7 @@ func TestBuildSubresourceHeaders_CSS(t *testing.T) {
 	assertHeader(t, headers, "Sec-Fetch-Mode", "no-cors")
 	assertHeader(t, headers, "Sec-Fetch-Dest", "style")
 	assertHeader(t, headers, "Referer", "https://example.com/page")
-	assertHeader(t, headers, "Priority", "u=0, i")
+	assertPriority(t, headers, "u=0")
 	assertHeader(t, headers, "Sec-Fetch-Site", "same-origin")
 }
 
@@ -218,7 +238,7 @@ func TestBuildSubresourceHeaders_JS(t *testing.T) {
 	assertHeader(t, headers, "Accept", "*/*")
 	assertHeader(t, headers, "Sec-Fetch-Mode", "no-cors")
 	assertHeader(t, headers, "Sec-Fetch-Dest", "script")
-	assertHeader(t, headers, "Priority", "u=1")
+	assertPriority(t, headers, "u=1")
 }
 
 func TestBuildSubresourceHeaders_Image(t *testing.T) {
@@ -227,7 +247,7 @@ func TestBuildSubresourceHeaders_Image(t *testing.T) {
 	assertHeader(t, headers, "Accept", "image/avif,image/webp,image/apng,image/svg+xml,image/*,*/*;q=0.8")
 	assertHeader(t, headers, "Sec-Fetch-Mode", "no-cors")
 	assertHeader(t, headers, "Sec-Fetch-Dest", "image")
-	assertHeader(t, headers, "Priority", "u=2")
+	assertPriority(t, headers, "i")
 }
 
 func TestBuildSubresourceHeaders_Font(t *testing.T) {
@@ -236,7 +256,20 @@ func TestBuildSubresourceHeaders_Font(t *testing.T) {
 	assertHeader(t, headers, "Accept", "*/*")
 	assertHeader(t, headers, "Sec-Fetch-Mode", "cors")
 	assertHeader(t, headers, "Sec-Fetch-Dest", "font")
-	assertHeader(t, headers, "Priority", "u=3")
+	assertPriority(t, headers, "u=0")
+}
+
+// assertPriority checks the Priority header Chrome sends over HTTP/2 for
+// headers, and that none goes out over HTTP/1.1
+func assertPriority(t *testing.T, headers map[string][]string, want string) {
+	t.Helper()
+	preset := fingerprint.Get("chrome-143")
+	if got := transport.PresetHeaders(preset, headers, nil, false, "h2").Get("Priority"); got != want {
+		t.Errorf("Priority over h2 = %q, want %q", got, want)
+	}
+	if got := transport.PresetHeaders(preset, headers, nil, false, "h1").Get("Priority"); got != "" {
+		t.Errorf("Priority over h1 = %q, want none", got)
+	}
 }
 
 func TestBuildSubresourceHeaders_CrossSite(t *testing.T) {
@@ -266,14 +299,16 @@ func TestInterBatchDelay_ContextCancellation(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	cancel() // cancel immediately
 
-	err := interBatchDelay(ctx, 1000, 2000)
+	s := &Session{clock: NewBehaviorClock(1)}
+	err := s.interBatchDelay(ctx, 1000, 2000)
 	if err != context.Canceled {
 		t.Errorf("expected context.Canceled, got %v", err)
 	}
 }
 
 func TestInterBatchDelay_ZeroDelay(t *testing.T) {
-	err := interBatchDelay(context.Background(), 0, 0)
+	s := &Session{clock: NewBehaviorClock(1)}
+	err := s.interBatchDelay(context.Background(), 0, 0)
 	if err != nil {
 		t.Errorf("expected nil error, got %v", err)
 	}
@@ -290,3 +325,144 @@ func assertHeader(t *testing.T, headers map[string][]string, key, want string) {
 		t.Errorf("header %q = %q, want %q", key, vals[0], want)
 	}
 }
+
+func TestCacheStateRoundTrip(t *testing.T) {
+	s := &Session{cacheEntries: make(map[string]*cacheEntry)}
+	s.storeCacheHeaders("https://example.com/", map[string][]string{"etag": {`"v1"`}})
+	page := []subresource{
+		{url: "https://example.com/app.css", typ: resourceCSS},
+		{url: "https://example.com/app.js", typ: resourceJS},
+	}
+	s.rememberSubresources("https://example.com/", page)
+	s.rememberSubresources("https://example.com/uncached", page) // No validators, not kept
+
+	// A revalidation that repeats the ETag keeps the page's subresources
+	s.storeCacheHeaders("https://example.com/", map[string][]string{"etag": {`"v1"`}})
+
+	restored := &Session{cacheEntries: make(map[string]*cacheEntry)}
+	restored.importCache(s.exportCache())
+	got := restored.cachedSubresources("https://example.com/")
+	if len(got) != 2 || got[0] != page[0] || got[1] != page[1] {
+		t.Errorf("restored subresources = %+v", got)
+	}
+	if entry := restored.cacheEntries["https://example.com/"]; entry == nil || entry.etag != `"v1"` {
+		t.Errorf("restored entry = %+v", entry)
+	}
+	if len(restored.cacheEntries) != 1 {
+		t.Errorf("restored %d entries, want 1", len(restored.cacheEntries))
+	}
+}
+
+func TestParseSubresources_Priority(t *testing.T) {
+	html := []byte(`<html><head>
+	<link rel="stylesheet" href="/late.css" fetchpriority="low">
+	<link rel="icon" href="/favicon.ico">
+	<script src="/app.js"></script>
+	<script src="/tracker.js" async></script>
+	<script src="/hero.js" defer fetchpriority="high"></script>
+</head><body>
+	<img src="/1.png"><img src="/2.png" fetchpriority="low"><img src="/3.png"><img src="/4.png">
+	<img src="/5.png"><img src="/6.png"><img src="/7.png" fetchpriority="high">
+</body></html>`)
+
+	want := map[string]*fingerprint.Priority{
+		"/late.css":    {Urgency: 1},
+		"/favicon.ico": nil,
+		"/app.js":      nil,
+		"/tracker.js":  {Urgency: 3},
+		"/hero.js":     nil,
+		"/1.png":       {Urgency: 2, Incremental: true},
+		"/2.png":       nil,
+		"/5.png":       {Urgency: 2, Incremental: true}, // Fifth <img>
+		"/6.png":       nil,
+		"/7.png":       {Urgency: 1, Incremental: true},
+	}
+	for _, r := range parseSubresources(html, "https://example.com") {
+		path := strings.TrimPrefix(r.url, "https://example.com")
+		w, ok := want[path]
+		if !ok {
+			continue
+		}
+		if (r.priority == nil) != (w == nil) || w != nil && *r.priority != *w {
+			t.Errorf("%s: priority %+v, want %+v", path, r.priority, w)
+		}
+	}
+
+	// Kept through saved state, urgency 3 included
+	s := &Session{cacheEntries: make(map[string]*cacheEntry)}
+	s.storeCacheHeaders("https://example.com/", map[string][]string{"etag": {`"v1"`}})
+	page := []subresource{{url: "https://example.com/tracker.js", typ: resourceJS, priority: &fingerprint.Priority{Urgency: 3}}}
+	s.rememberSubresources("https://example.com/", page)
+	restored := &Session{cacheEntries: make(map[string]*cacheEntry)}
+	restored.importCache(s.exportCache())
+	got := restored.cachedSubresources("https://example.com/")
+	if len(got) != 1 || got[0].priority == nil || *got[0].priority != *page[0].priority {
+		t.Errorf("restored subresources = %+v", got)
+	}
+}
+
+func TestFetchQueue(t *testing.T) {
+	page := "https://www.example.com/"
+	batch := []subresource{
+		{url: "https://cdn.tracker.net/t.js", typ: resourceJS},
+		{url: "https://static.example.com/app.js", typ: resourceJS},
+		{url: "https://www.example.com/lazy.js", typ: resourceJS, priority: &fingerprint.Priority{Urgency: 3}},
+		{url: "https://www.example.com/main.js", typ: resourceJS},
+	}
+	var got []string
+	for _, q := range fetchQueue(batch, page) {
+		got = append(got, q.res.url)
+	}
+	want := []string{
+		"https://static.example.com/app.js", // First party, same site
+		"https://www.example.com/main.js",
+		"https://cdn.tracker.net/t.js", // Third party, behind them
+		"https://www.example.com/lazy.js",
+	}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("order %v, want %v", got, want)
+	}
+}
+
+func TestScheduleFetchesLimits(t *testing.T) {
+	var batch []subresource
+	for i := 0; i < 20; i++ {
+		batch = append(batch, subresource{url: fmt.Sprintf("https://example.com/%d.css", i), typ: resourceCSS})
+		batch = append(batch, subresource{url: fmt.Sprintf("https://img%d.example.net/i.png", i), typ: resourceImage})
+	}
+
+	var mu sync.Mutex
+	perOrigin := make(map[string]int)
+	images, maxImages, maxOrigin, fetched := 0, 0, 0, 0
+	scheduleFetches(context.Background(), batch, "https://example.com/", func(r subresource) {
+		origin := resourceOrigin(r.url)
+		mu.Lock()
+		perOrigin[origin]++
+		maxOrigin = max(maxOrigin, perOrigin[origin])
+		if r.typ == resourceImage {
+			images++
+			maxImages = max(maxImages, images)
+		}
+		mu.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+
+		mu.Lock()
+		perOrigin[origin]--
+		if r.typ == resourceImage {
+			images--
+		}
+		fetched++
+		mu.Unlock()
+	})
+
+	if fetched != len(batch) {
+		t.Errorf("fetched %d of %d", fetched, len(batch))
+	}
+	if maxOrigin != concurrencyLimit {
+		t.Errorf("%d requests to one origin at once, want %d", maxOrigin, concurrencyLimit)
+	}
+	if maxImages != maxDelayableInFlight {
+		t.Errorf("%d images in flight at once, want %d", maxImages, maxDelayableInFlight)
+	}
+}
@@ -0,0 +1,107 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+
+	http "github.com/sardanioss/http"
+)
+
+// ErrBodyNotRewindable is returned when a request has to be sent again (retry
+// after an error, 307/308 redirect) but its body is a one-shot BodyReader that
+// was already consumed. A retryable status is returned as-is instead. Set
+// Request.BodySource to make the body replayable.
+var ErrBodyNotRewindable = errors.New("request body cannot be replayed; use Request.BodySource")
+
+// RewindableBody is a request body that can be read from the start any
+// number of times, so retries and redirects resend it in full.
+type RewindableBody interface {
+	// Open returns a new reader positioned at the start of the body
+	Open() (io.ReadCloser, error)
+	// Len returns the body size in bytes, or -1 if unknown (sent chunked)
+	Len() int64
+}
+
+type bytesBody []byte
+
+func (b bytesBody) Open() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(b)), nil }
+func (b bytesBody) Len() int64                   { return int64(len(b)) }
+
+// BytesBody returns a RewindableBody over an in-memory buffer
+func BytesBody(b []byte) RewindableBody {
+	return bytesBody(b)
+}
+
+type fileBody string
+
+func (f fileBody) Open() (io.ReadCloser, error) { return os.Open(string(f)) }
+
+func (f fileBody) Len() int64 {
+	info, err := os.Stat(string(f))
+	if err != nil {
+		return -1
+	}
+	return info.Size()
+}
+
+// FileBody returns a RewindableBody that reopens the file at path for each
+// send, so large uploads are never held in memory
+func FileBody(path string) RewindableBody {
+	return fileBody(path)
+}
+
+type funcBody struct {
+	open   func() (io.ReadCloser, error)
+	length int64
+}
+
+func (f funcBody) Open() (io.ReadCloser, error) { return f.open() }
+func (f funcBody) Len() int64                   { return f.length }
+
+// FuncBody returns a RewindableBody that calls open for each send.
+// length is the body size, or -1 if unknown.
+func FuncBody(open func() (io.ReadCloser, error), length int64) RewindableBody {
+	return funcBody{open: open, length: length}
+}
+
+// Replayable reports whether the request can be sent more than once. Only a
+// BodyReader without a BodySource is lost after the first send.
+func (r *Request) Replayable() bool {
+	return r.BodyReader == nil || r.BodySource != nil
+}
+
+// newHTTPRequest builds the outgoing request. BodySource is opened afresh on
+// every call, so falling back to another protocol resends the whole body.
+func newHTTPRequest(ctx context.Context, method string, req *Request) (*http.Request, error) {
+	var body io.Reader
+	switch {
+	case req.BodySource != nil:
+		rc, err := req.BodySource.Open()
+		if err != nil {
+			return nil, err
+		}
+		body = rc
+	case req.BodyReader != nil:
+		body = req.BodyReader
+	case len(req.Body) > 0:
+		body = bytes.NewReader(req.Body)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, method, req.URL, body)
+	if err != nil {
+		if rc, ok := body.(io.Closer); ok && req.BodySource != nil {
+			rc.Close()
+		}
+		return nil, err
+	}
+
+	httpReq.Host = req.Host
+	if req.BodySource != nil {
+		httpReq.ContentLength = req.BodySource.Len()
+		httpReq.GetBody = req.BodySource.Open // Lets HTTP/2 resend after GOAWAY
+	}
+	return httpReq, nil
+}
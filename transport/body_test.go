@@ -0,0 +1,63 @@
+package transport
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRewindableBodies(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "upload.bin")
+	if err := os.WriteFile(path, []byte("file body"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	bodies := map[string]RewindableBody{
+		"bytes": BytesBody([]byte("file body")),
+		"file":  FileBody(path),
+		"func": FuncBody(func() (io.ReadCloser, error) {
+			return io.NopCloser(strings.NewReader("file body")), nil
+		}, 9),
+	}
+	for name, body := range bodies {
+		if body.Len() != 9 {
+			t.Errorf("%s: Len = %d, want 9", name, body.Len())
+		}
+		// Every send must see the whole body
+		for i := 0; i < 2; i++ {
+			req, err := newHTTPRequest(context.Background(), "POST", &Request{URL: "https://example.com/", BodySource: body})
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			data, _ := io.ReadAll(req.Body)
+			req.Body.Close()
+			if string(data) != "file body" || req.ContentLength != 9 {
+				t.Errorf("%s send %d: got %q (length %d)", name, i, data, req.ContentLength)
+			}
+		}
+	}
+
+	if FileBody(filepath.Join(t.TempDir(), "missing")).Len() != -1 {
+		t.Error("missing file should have unknown length")
+	}
+}
+
+func TestRequestReplayable(t *testing.T) {
+	tests := []struct {
+		req  Request
+		want bool
+	}{
+		{Request{}, true},
+		{Request{Body: []byte("x")}, true},
+		{Request{BodyReader: strings.NewReader("x")}, false},
+		{Request{BodyReader: strings.NewReader("x"), BodySource: BytesBody([]byte("x"))}, true},
+	}
+	for i, tt := range tests {
+		if got := tt.req.Replayable(); got != tt.want {
+			t.Errorf("case %d: Replayable = %v, want %v", i, got, tt.want)
+		}
+	}
+}
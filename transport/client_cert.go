@@ -0,0 +1,166 @@
+package transport
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	utls "github.com/sardanioss/utls"
+	"golang.org/x/crypto/pkcs12"
+)
+
+// ClientCertificate is a certificate for mutual TLS, presented to servers
+// that ask for one. The private key is only used through crypto.Signer, so
+// it can live in an HSM or a cloud KMS.
+type ClientCertificate struct {
+	// Hosts the certificate is offered to. "example.com" includes its
+	// subdomains; "*" or no hosts at all matches every host.
+	Hosts []string
+
+	// Certificate is the chain, leaf first, in DER
+	Certificate [][]byte
+
+	// PrivateKey is the leaf's key
+	PrivateKey crypto.Signer
+}
+
+// NewClientCertificate pairs a signer with its certificate chain, leaf first
+func NewClientCertificate(key crypto.Signer, chain ...*x509.Certificate) (*ClientCertificate, error) {
+	if len(chain) == 0 {
+		return nil, errors.New("client certificate: no certificate")
+	}
+	if !publicKeysEqual(chain[0].PublicKey, key.Public()) {
+		return nil, errors.New("client certificate: private key does not match the certificate")
+	}
+	cert := &ClientCertificate{PrivateKey: key}
+	for _, c := range chain {
+		cert.Certificate = append(cert.Certificate, c.Raw)
+	}
+	return cert, nil
+}
+
+// LoadClientCertificate reads a PEM certificate chain and private key.
+// keyFile may be "" when certFile holds both.
+func LoadClientCertificate(certFile, keyFile string) (*ClientCertificate, error) {
+	certPEM, err := os.ReadFile(certFile)
+	if err != nil {
+		return nil, fmt.Errorf("client certificate: %w", err)
+	}
+	var keyPEM []byte
+	if keyFile != "" && keyFile != certFile {
+		if keyPEM, err = os.ReadFile(keyFile); err != nil {
+			return nil, fmt.Errorf("client certificate: %w", err)
+		}
+	}
+	return ParseClientCertificatePEM(certPEM, keyPEM)
+}
+
+// ParseClientCertificatePEM parses a PEM certificate chain and a PKCS#1,
+// PKCS#8 or SEC 1 private key. The first key found is used.
+func ParseClientCertificatePEM(certPEM, keyPEM []byte) (*ClientCertificate, error) {
+	var blocks []*pem.Block
+	for rest := append(append([]byte{}, certPEM...), keyPEM...); ; {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			break
+		}
+		blocks = append(blocks, block)
+	}
+	return clientCertificateFromPEM(blocks)
+}
+
+// ParseClientCertificatePKCS12 parses a PKCS#12 (.p12, .pfx) bundle. Only
+// the legacy encryption (3DES, RC2) is supported; convert bundles encrypted
+// with AES to PEM first.
+func ParseClientCertificatePKCS12(data []byte, password string) (*ClientCertificate, error) {
+	blocks, err := pkcs12.ToPEM(data, password)
+	if err != nil {
+		return nil, fmt.Errorf("client certificate: %w", err)
+	}
+	return clientCertificateFromPEM(blocks)
+}
+
+// clientCertificateFromPEM builds a certificate from PEM blocks, putting the
+// certificate matching the key first
+func clientCertificateFromPEM(blocks []*pem.Block) (*ClientCertificate, error) {
+	var chain []*x509.Certificate
+	var key crypto.Signer
+	for _, block := range blocks {
+		switch {
+		case block.Type == "CERTIFICATE":
+			c, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("client certificate: %w", err)
+			}
+			chain = append(chain, c)
+		case strings.HasSuffix(block.Type, "PRIVATE KEY") && key == nil:
+			var err error
+			if key, err = parsePrivateKey(block.Bytes); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if key == nil {
+		return nil, errors.New("client certificate: no private key")
+	}
+	for i, c := range chain {
+		if publicKeysEqual(c.PublicKey, key.Public()) {
+			chain[0], chain[i] = chain[i], chain[0]
+			break
+		}
+	}
+	return NewClientCertificate(key, chain...)
+}
+
+// parsePrivateKey parses a PKCS#1, PKCS#8 or SEC 1 key, whatever its PEM
+// block says
+func parsePrivateKey(der []byte) (crypto.Signer, error) {
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		if signer, ok := key.(crypto.Signer); ok {
+			return signer, nil
+		}
+		return nil, fmt.Errorf("client certificate: unsupported private key type %T", key)
+	}
+	if key, err := x509.ParseECPrivateKey(der); err == nil {
+		return key, nil
+	}
+	return nil, errors.New("client certificate: cannot parse private key")
+}
+
+func publicKeysEqual(a, b crypto.PublicKey) bool {
+	k, ok := a.(interface{ Equal(crypto.PublicKey) bool })
+	return ok && k.Equal(b)
+}
+
+// matches reports whether the certificate is offered to host
+func (c *ClientCertificate) matches(host string) bool {
+	return len(c.Hosts) == 0 || hostMatchesAny(host, c.Hosts)
+}
+
+// applyClientCertificate makes cfg present the first client certificate
+// matching host when the server asks for one. Safe on a nil config.
+func (c *TransportConfig) applyClientCertificate(cfg *utls.Config, host string) {
+	if c == nil || len(c.ClientCertificates) == 0 {
+		return
+	}
+	var cert *ClientCertificate
+	for _, cc := range c.ClientCertificates {
+		if cc.matches(host) {
+			cert = cc
+			break
+		}
+	}
+	if cert == nil {
+		return
+	}
+	cfg.GetClientCertificate = func(*utls.CertificateRequestInfo) (*utls.Certificate, error) {
+		return &utls.Certificate{Certificate: cert.Certificate, PrivateKey: cert.PrivateKey}, nil
+	}
+}
@@ -0,0 +1,70 @@
+package transport
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	utls "github.com/sardanioss/utls"
+)
+
+func TestClientCertificate(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	leaf, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	issuer, err := x509.CreateCertificate(rand.Reader, template, template, &other.PublicKey, other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The chain is reordered so the key's certificate comes first
+	certPEM := append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: issuer}),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf})...)
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	cert, err := ParseClientCertificatePEM(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cert.Certificate) != 2 || string(cert.Certificate[0]) != string(leaf) {
+		t.Fatalf("chain has %d certificates, leaf first: %v", len(cert.Certificate), string(cert.Certificate[0]) == string(leaf))
+	}
+
+	if _, err := ParseClientCertificatePEM(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: issuer}), keyPEM); err == nil {
+		t.Error("a key without its certificate was accepted")
+	}
+
+	cert.Hosts = []string{"*.corp.example"}
+	config := &TransportConfig{ClientCertificates: []*ClientCertificate{cert}}
+	for host, want := range map[string]bool{"corp.example": true, "api.corp.example": true, "example.com": false} {
+		cfg := &utls.Config{}
+		config.applyClientCertificate(cfg, host)
+		if got := cfg.GetClientCertificate != nil; got != want {
+			t.Errorf("%s: certificate offered = %v", host, got)
+		}
+	}
+	var nilConfig *TransportConfig
+	nilConfig.applyClientCertificate(&utls.Config{}, "corp.example")
+}
@@ -0,0 +1,87 @@
+package transport
+
+import (
+	"crypto/x509"
+
+	utls "github.com/sardanioss/utls"
+)
+
+// ConnectionCallback is called with each new TLS connection to its hosts,
+// before any request goes out on it, so callers can tie tokens to the
+// connection: token binding, channel bindings (RFC 9266), signed exchanges
+// keyed to the TLS session.
+type ConnectionCallback struct {
+	// Hosts the callback covers. "example.com" includes its subdomains; "*"
+	// or no hosts at all matches every host.
+	Hosts []string
+
+	// Func runs on the goroutine dialing the connection, and the request
+	// waits for it. For HTTP/3 the dial then waits for the handshake to
+	// complete, giving up 0-RTT.
+	Func func(*ConnInfo)
+}
+
+// ConnInfo describes an established TLS connection
+type ConnInfo struct {
+	Host             string
+	Port             string
+	Protocol         string // "h1", "h2" or "h3"
+	Version          uint16
+	CipherSuite      uint16
+	Resumed          bool // Resumed from a session ticket
+	PeerCertificates []*x509.Certificate
+
+	exportKeyingMaterial func(label string, context []byte, length int) ([]byte, error)
+}
+
+// ExportKeyingMaterial returns length bytes of keying material exported
+// from the connection's secrets (RFC 5705, RFC 8446 section 7.5). The server
+// derives the same bytes for the same label and context; no other
+// connection does. TLS 1.2 connections without the extended master secret
+// export nothing.
+func (c *ConnInfo) ExportKeyingMaterial(label string, context []byte, length int) ([]byte, error) {
+	return c.exportKeyingMaterial(label, context, length)
+}
+
+// ChannelBinding returns the connection's tls-exporter channel binding
+// (RFC 9266): 32 bytes exported with the label "EXPORTER-Channel-Binding"
+// and no context
+func (c *ConnInfo) ChannelBinding() ([]byte, error) {
+	return c.ExportKeyingMaterial("EXPORTER-Channel-Binding", nil, 32)
+}
+
+// connInfo describes a TCP connection's handshake
+func connInfo(host, port, protocol string, state utls.ConnectionState) *ConnInfo {
+	return &ConnInfo{
+		Host:                 host,
+		Port:                 port,
+		Protocol:             protocol,
+		Version:              state.Version,
+		CipherSuite:          state.CipherSuite,
+		Resumed:              state.DidResume,
+		PeerCertificates:     state.PeerCertificates,
+		exportKeyingMaterial: state.ExportKeyingMaterial,
+	}
+}
+
+// connectionCallbacks returns the callbacks covering host. Safe on a nil
+// config.
+func (c *TransportConfig) connectionCallbacks(host string) []func(*ConnInfo) {
+	if c == nil {
+		return nil
+	}
+	var funcs []func(*ConnInfo)
+	for _, cb := range c.ConnectionCallbacks {
+		if cb.Func != nil && (len(cb.Hosts) == 0 || hostMatchesAny(host, cb.Hosts)) {
+			funcs = append(funcs, cb.Func)
+		}
+	}
+	return funcs
+}
+
+// onConnection runs the callbacks covering info.Host
+func (c *TransportConfig) onConnection(info *ConnInfo) {
+	for _, f := range c.connectionCallbacks(info.Host) {
+		f(info)
+	}
+}
@@ -0,0 +1,79 @@
+package transport
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	utls "github.com/sardanioss/utls"
+)
+
+func TestConnectionCallback(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "api.example.com"},
+		DNSNames:     []string{"api.example.com"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	local, remote := net.Pipe()
+	defer local.Close()
+	server := tls.Server(remote, &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}})
+	defer server.Close()
+	serverDone := make(chan error, 1)
+	go func() { serverDone <- server.Handshake() }()
+
+	client := utls.UClient(local, &utls.Config{ServerName: "api.example.com", InsecureSkipVerify: true}, utls.HelloGolang)
+	if err := client.Handshake(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-serverDone; err != nil {
+		t.Fatal(err)
+	}
+
+	var got *ConnInfo
+	config := &TransportConfig{ConnectionCallbacks: []*ConnectionCallback{
+		{Hosts: []string{"example.com"}, Func: func(info *ConnInfo) { got = info }},
+		{Hosts: []string{"other.test"}, Func: func(*ConnInfo) { t.Error("callback ran for another host") }},
+	}}
+	config.onConnection(connInfo("api.example.com", "443", "h2", client.ConnectionState()))
+	if got == nil {
+		t.Fatal("callback didn't run")
+	}
+	if got.Protocol != "h2" || got.Version != tls.VersionTLS13 || len(got.PeerCertificates) != 1 {
+		t.Errorf("info = %+v", got)
+	}
+
+	binding, err := got.ChannelBinding()
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := server.ConnectionState()
+	want, err := state.ExportKeyingMaterial("EXPORTER-Channel-Binding", nil, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(binding, want) {
+		t.Error("channel binding differs from the server's")
+	}
+
+	var nilConfig *TransportConfig
+	nilConfig.onConnection(got)
+}
@@ -0,0 +1,156 @@
+package transport
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	http "github.com/sardanioss/http"
+)
+
+// authenticateConnect answers a proxy's 407 to connectReq on conn, the same
+// connection, resending the CONNECT with each token of the handshake. It
+// returns the proxy's last response, or resp when there is nothing to
+// answer.
+func authenticateConnect(conn net.Conn, br *bufio.Reader, connectReq string, resp *http.Response, newAuth AuthenticatorFunc, proxyURL string, deadline time.Time) (*http.Response, error) {
+	if newAuth == nil || resp.StatusCode != http.StatusProxyAuthRequired || resp.Close {
+		return resp, nil
+	}
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL: %w", err)
+	}
+	auth, err := newAuth(u.Hostname())
+	if err != nil || auth == nil {
+		return resp, err
+	}
+	challenge, offered := authChallenge(resp.Header.Values("Proxy-Authenticate"), auth.Scheme())
+	if !offered {
+		return resp, nil
+	}
+
+	for round := 0; round < maxAuthRounds; round++ {
+		token, err := auth.Next(challenge)
+		if err != nil {
+			return nil, fmt.Errorf("proxy authentication: %w", err)
+		}
+		req := strings.TrimSuffix(connectReq, "\r\n") + "Proxy-Authorization: " + authHeader(auth, token) + "\r\n\r\n"
+		if _, err := conn.Write([]byte(req)); err != nil {
+			return nil, fmt.Errorf("failed to send CONNECT request: %w", err)
+		}
+		conn.SetReadDeadline(deadline)
+		resp, err = http.ReadResponse(br, nil)
+		conn.SetReadDeadline(time.Time{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CONNECT response: %w", err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusProxyAuthRequired || resp.Close {
+			return resp, nil
+		}
+		if challenge, offered = authChallenge(resp.Header.Values("Proxy-Authenticate"), auth.Scheme()); !offered || challenge == nil {
+			return resp, nil // Rejected
+		}
+	}
+	return nil, fmt.Errorf("proxy authentication: %w", errAuthRounds)
+}
+
+// authenticate answers an origin's 401 to req on conn, the same connection,
+// resending req with each token of the handshake. On a connection
+// forwarding to a proxy it answers the proxy's 407 the same way. It returns
+// the last response, or resp when there is nothing to answer. Called with
+// conn.mu held.
+func (t *HTTP1Transport) authenticate(conn *http1Conn, req *http.Request, resp *http.Response) (*http.Response, error) {
+	if t.config == nil || resp.Close {
+		return resp, nil
+	}
+	newAuth, host := t.config.ServerAuth, req.URL.Hostname()
+	status, challengeHeader, authorizationHeader := http.StatusUnauthorized, "WWW-Authenticate", "Authorization"
+	if conn.viaProxy && resp.StatusCode == http.StatusProxyAuthRequired {
+		if u, err := url.Parse(t.proxy.URL); err == nil {
+			host = u.Hostname()
+		}
+		newAuth = t.config.ProxyAuth
+		status, challengeHeader, authorizationHeader = http.StatusProxyAuthRequired, "Proxy-Authenticate", "Proxy-Authorization"
+	}
+	if newAuth == nil || resp.StatusCode != status {
+		return resp, nil
+	}
+	// Every round resends the body
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return resp, nil
+	}
+	auth, err := newAuth(host)
+	if err != nil || auth == nil {
+		return resp, err
+	}
+	challenge, offered := authChallenge(resp.Header.Values(challengeHeader), auth.Scheme())
+	if !offered {
+		return resp, nil
+	}
+
+	for round := 0; round < maxAuthRounds; round++ {
+		token, err := auth.Next(challenge)
+		if err != nil {
+			resp.Body.Close()
+			return nil, fmt.Errorf("%s authentication: %w", authTarget(status), err)
+		}
+		// Drain the challenge so the next response can be read
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		next := req.Clone(req.Context())
+		next.Header.Set(authorizationHeader, authHeader(auth, token))
+		if req.GetBody != nil {
+			if next.Body, err = req.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+		if err := t.writeRequest(conn, next); err != nil {
+			return nil, err
+		}
+		if resp, err = readResponse(conn.br, next); err != nil {
+			return nil, err
+		}
+		if conn.viaProxy {
+			applyProxyConnection(resp)
+		}
+
+		if resp.StatusCode != status || resp.Close {
+			return resp, nil
+		}
+		if challenge, offered = authChallenge(resp.Header.Values(challengeHeader), auth.Scheme()); !offered || challenge == nil {
+			return resp, nil // Rejected
+		}
+	}
+	resp.Body.Close()
+	return nil, fmt.Errorf("%s authentication: %w", authTarget(status), errAuthRounds)
+}
+
+// authTarget names who a handshake answering status authenticates to
+func authTarget(status int) string {
+	if status == http.StatusProxyAuthRequired {
+		return "proxy"
+	}
+	return "server"
+}
+
+// needsHTTP1Auth reports whether resp, received over HTTP/2 or HTTP/3, is
+// an origin's challenge ServerAuth answers, which can only be done over
+// HTTP/1.1
+func (t *Transport) needsHTTP1Auth(req *Request, resp *Response) bool {
+	if t.config == nil || t.config.ServerAuth == nil || resp.StatusCode != http.StatusUnauthorized || resp.Protocol == "h1" || !req.Replayable() {
+		return false
+	}
+	auth, err := t.config.ServerAuth(extractHost(req.URL))
+	if err != nil || auth == nil {
+		return false
+	}
+	_, offered := authChallenge(resp.Headers["www-authenticate"], auth.Scheme())
+	return offered
+}
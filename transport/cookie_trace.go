@@ -0,0 +1,71 @@
+package transport
+
+// CookieTrace records what a session's cookie jar did for one request: each
+// stored cookie whose domain matched the request host, and whether it went
+// into the Cookie header. Cookies the caller set in the request's own Cookie
+// header are not the jar's and don't appear.
+type CookieTrace struct {
+	Host    string
+	Path    string
+	Secure  bool // Request was over HTTPS
+	Cookies []CookieDecision
+}
+
+// CookieDecision is the jar's decision on one stored cookie
+type CookieDecision struct {
+	Name     string
+	Domain   string // With a leading dot for domain cookies
+	Path     string
+	SameSite string
+	Sent     bool
+
+	// Reason is why the cookie was left out; empty when it was sent
+	Reason string
+
+	// Note flags a sent cookie a browser would have withheld, e.g. a
+	// SameSite=Strict cookie on a request marked cross-site. The jar doesn't
+	// know the page a request comes from, so it sends these anyway.
+	Note string
+}
+
+// Sent returns the decisions for the cookies that were sent, in header order
+func (t *CookieTrace) Sent() []CookieDecision {
+	return t.filter(true)
+}
+
+// Filtered returns the decisions for the cookies that were left out
+func (t *CookieTrace) Filtered() []CookieDecision {
+	return t.filter(false)
+}
+
+func (t *CookieTrace) filter(sent bool) []CookieDecision {
+	if t == nil {
+		return nil
+	}
+	var out []CookieDecision
+	for _, d := range t.Cookies {
+		if d.Sent == sent {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+// Decision returns the jar's decision on the cookie named name, and false
+// if the jar held no such cookie for the request's host. With several of
+// that name it returns the one sent, if any.
+func (t *CookieTrace) Decision(name string) (CookieDecision, bool) {
+	if t == nil {
+		return CookieDecision{}, false
+	}
+	var found *CookieDecision
+	for i := range t.Cookies {
+		if d := &t.Cookies[i]; d.Name == name && (found == nil || d.Sent && !found.Sent) {
+			found = d
+		}
+	}
+	if found == nil {
+		return CookieDecision{}, false
+	}
+	return *found, true
+}
@@ -0,0 +1,60 @@
+package transport
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+func encodeWith(t *testing.T, data []byte, newWriter func(io.Writer) io.WriteCloser) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := newWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecompress(t *testing.T) {
+	plain := bytes.Repeat([]byte("httpcloak "), 200)
+
+	gz := func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }
+	br := func(w io.Writer) io.WriteCloser { return brotli.NewWriter(w) }
+	zs := func(w io.Writer) io.WriteCloser { z, _ := zstd.NewWriter(w); return z }
+	zl := func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) }
+	raw := func(w io.Writer) io.WriteCloser { f, _ := flate.NewWriter(w, flate.DefaultCompression); return f }
+
+	tests := []struct {
+		encoding string
+		body     []byte
+	}{
+		{"gzip", encodeWith(t, plain, gz)},
+		{"br", encodeWith(t, plain, br)},
+		{"zstd", encodeWith(t, plain, zs)},
+		{"deflate", encodeWith(t, plain, zl)},  // RFC 9110: zlib-wrapped
+		{"deflate", encodeWith(t, plain, raw)}, // What some servers send
+		{"gzip, br", encodeWith(t, encodeWith(t, plain, gz), br)},
+		{"identity", plain},
+		{"compress", plain}, // Unknown: passed through
+	}
+	for _, tt := range tests {
+		got, err := Decompress(tt.body, tt.encoding)
+		if err != nil {
+			t.Errorf("Decompress(%q): %v", tt.encoding, err)
+			continue
+		}
+		if !bytes.Equal(got, plain) {
+			t.Errorf("Decompress(%q) = %d bytes, want %d", tt.encoding, len(got), len(plain))
+		}
+	}
+}
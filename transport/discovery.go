@@ -0,0 +1,177 @@
+package transport
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultDiscoveryTTL is how long a protocol learned by racing stays trusted
+// when the origin gave no Alt-Svc lifetime. Matches the Alt-Svc default of
+// ma=86400 (RFC 7838).
+const defaultDiscoveryTTL = 24 * time.Hour
+
+// DiscoveryEntry is what a Transport learned about a host beyond its A/AAAA
+// records. It is persisted with the session so a restored session dials the
+// way it did before instead of re-racing and re-querying HTTPS records.
+type DiscoveryEntry struct {
+	// Protocol is the protocol auto mode settled on ("h1", "h2" or "h3")
+	Protocol string `json:"protocol,omitempty"`
+
+	// ProtocolExpires is when Protocol must be rediscovered
+	ProtocolExpires *time.Time `json:"protocol_expires,omitempty"`
+
+	// ECHExpires is when the host's ECH config reaches the TTL of the HTTPS
+	// record it came from
+	ECHExpires *time.Time `json:"ech_expires,omitempty"`
+}
+
+// knownProtocol returns the learned protocol for host, ignoring stale entries.
+func (t *Transport) knownProtocol(host string) (Protocol, bool) {
+	t.protocolSupportMu.RLock()
+	defer t.protocolSupportMu.RUnlock()
+
+	p, ok := t.protocolSupport[host]
+	if !ok {
+		return ProtocolAuto, false
+	}
+	if expires, ok := t.protocolExpiry[host]; ok && time.Now().After(expires) {
+		return ProtocolAuto, false
+	}
+	return p, true
+}
+
+// learnProtocol records the protocol auto mode should use for host.
+func (t *Transport) learnProtocol(host string, p Protocol, ttl time.Duration) {
+	t.protocolSupportMu.Lock()
+	t.protocolSupport[host] = p
+	t.protocolExpiry[host] = time.Now().Add(ttl)
+	delete(t.protocolPins, host)
+	t.protocolSupportMu.Unlock()
+}
+
+// observeAltSvc applies an Alt-Svc response header to what we know about host.
+// An h3 advertisement refreshes the lifetime of a learned HTTP/3 entry to its
+// ma value; "clear" withdraws HTTP/3 so the next request races again.
+// Racing results for TCP protocols are left alone - the race already showed
+// QUIC losing on this path.
+func (t *Transport) observeAltSvc(host string, resp *Response) {
+	if resp == nil || host == "" {
+		return
+	}
+	values := resp.Headers["alt-svc"]
+	if len(values) == 0 {
+		return
+	}
+	maxAge, advertised, cleared := parseAltSvcH3(strings.Join(values, ","))
+
+	t.protocolSupportMu.Lock()
+	defer t.protocolSupportMu.Unlock()
+	if t.protocolSupport[host] != ProtocolHTTP3 {
+		return
+	}
+	switch {
+	case cleared:
+		delete(t.protocolSupport, host)
+		delete(t.protocolExpiry, host)
+		delete(t.protocolPins, host)
+	case advertised:
+		t.protocolExpiry[host] = time.Now().Add(maxAge)
+	}
+}
+
+// parseAltSvcH3 extracts the HTTP/3 alternative from an Alt-Svc header value.
+func parseAltSvcH3(value string) (maxAge time.Duration, advertised, cleared bool) {
+	for _, alt := range strings.Split(value, ",") {
+		alt = strings.TrimSpace(alt)
+		if alt == "clear" {
+			return 0, false, true
+		}
+		params := strings.Split(alt, ";")
+		protoID, _, _ := strings.Cut(params[0], "=")
+		if strings.TrimSpace(protoID) != "h3" || advertised {
+			continue
+		}
+		advertised = true
+		maxAge = defaultDiscoveryTTL
+		for _, param := range params[1:] {
+			k, v, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if k != "ma" {
+				continue
+			}
+			if secs, err := strconv.ParseInt(strings.Trim(v, `"`), 10, 64); err == nil && secs >= 0 {
+				maxAge = time.Duration(secs) * time.Second
+			}
+		}
+	}
+	return maxAge, advertised, false
+}
+
+// ExportDiscovery returns the learned protocol and ECH lifetime for each host.
+// Stale entries are skipped.
+func (t *Transport) ExportDiscovery() map[string]DiscoveryEntry {
+	now := time.Now()
+	result := make(map[string]DiscoveryEntry)
+
+	t.protocolSupportMu.RLock()
+	for host, p := range t.protocolSupport {
+		expires, ok := t.protocolExpiry[host]
+		if !ok {
+			expires = now.Add(defaultDiscoveryTTL)
+		}
+		if now.After(expires) {
+			continue
+		}
+		result[host] = DiscoveryEntry{Protocol: p.String(), ProtocolExpires: &expires}
+	}
+	t.protocolSupportMu.RUnlock()
+
+	if t.h3Transport != nil {
+		for host, expires := range t.h3Transport.GetECHConfigExpiry() {
+			entry := result[host]
+			entry.ECHExpires = &expires
+			result[host] = entry
+		}
+	}
+
+	if len(result) == 0 {
+		return nil
+	}
+	return result
+}
+
+// ImportDiscovery restores state produced by ExportDiscovery. Expired protocol
+// entries are dropped. ECH lifetimes are restored as-is; the ECH configs
+// themselves are imported separately through the HTTP/3 transport.
+func (t *Transport) ImportDiscovery(entries map[string]DiscoveryEntry) {
+	now := time.Now()
+	echExpiry := make(map[string]time.Time)
+
+	t.protocolSupportMu.Lock()
+	for host, entry := range entries {
+		if entry.ECHExpires != nil {
+			echExpiry[host] = *entry.ECHExpires
+		}
+		if entry.ProtocolExpires == nil || now.After(*entry.ProtocolExpires) {
+			continue
+		}
+		var p Protocol
+		switch entry.Protocol {
+		case "h1":
+			p = ProtocolHTTP1
+		case "h2":
+			p = ProtocolHTTP2
+		case "h3":
+			p = ProtocolHTTP3
+		default:
+			continue
+		}
+		t.protocolSupport[host] = p
+		t.protocolExpiry[host] = *entry.ProtocolExpires
+	}
+	t.protocolSupportMu.Unlock()
+
+	if t.h3Transport != nil && len(echExpiry) > 0 {
+		t.h3Transport.SetECHConfigExpiry(echExpiry)
+	}
+}
@@ -0,0 +1,28 @@
+package transport
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseAltSvcH3(t *testing.T) {
+	tests := []struct {
+		value      string
+		maxAge     time.Duration
+		advertised bool
+		cleared    bool
+	}{
+		{`h3=":443"; ma=3600`, time.Hour, true, false},
+		{`h3-29=":443"; ma=60, h3=":443"; ma=120`, 2 * time.Minute, true, false},
+		{`h3=":443"`, defaultDiscoveryTTL, true, false},
+		{`h2="alt.example.com:443"; ma=60`, 0, false, false},
+		{`clear`, 0, false, true},
+	}
+	for _, tt := range tests {
+		maxAge, advertised, cleared := parseAltSvcH3(tt.value)
+		if maxAge != tt.maxAge || advertised != tt.advertised || cleared != tt.cleared {
+			t.Errorf("parseAltSvcH3(%q) = (%v, %v, %v), want (%v, %v, %v)",
+				tt.value, maxAge, advertised, cleared, tt.maxAge, tt.advertised, tt.cleared)
+		}
+	}
+}
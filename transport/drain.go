@@ -0,0 +1,45 @@
+package transport
+
+import (
+	"io"
+	"time"
+)
+
+// DefaultDrainLimit is how much of an unread response body closing it will
+// read and discard so the connection stays reusable. Bodies with more left
+// close the HTTP/1.1 connection or reset the HTTP/2 or HTTP/3 stream.
+const DefaultDrainLimit = 256 << 10
+
+// drainTimeout bounds a background drain waiting on a slow server
+const drainTimeout = 5 * time.Second
+
+// drainBody reads and discards the rest of body, at most limit bytes, and
+// reports whether it reached the end
+func drainBody(body io.Reader, limit int64) bool {
+	n, err := io.CopyN(io.Discard, body, limit+1)
+	return err == io.EOF && n <= limit
+}
+
+// DrainAndClose closes a streamed HTTP/2 or HTTP/3 response body. If the
+// body is no longer than limit (contentLength -1 means unknown), the rest is
+// read and discarded in the background first so the stream ends normally;
+// otherwise it is reset right away. cleanup, if set, runs after the body is
+// closed.
+func DrainAndClose(body io.ReadCloser, contentLength, limit int64, cleanup func()) error {
+	if limit <= 0 || contentLength > limit {
+		if cleanup != nil {
+			defer cleanup()
+		}
+		return body.Close()
+	}
+	go func() {
+		timer := time.AfterFunc(drainTimeout, func() { body.Close() })
+		drainBody(body, limit)
+		timer.Stop()
+		body.Close()
+		if cleanup != nil {
+			cleanup()
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,57 @@
+package transport
+
+import (
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type trackedBody struct {
+	io.Reader
+	mu     sync.Mutex
+	closed bool
+}
+
+func (b *trackedBody) Close() error {
+	b.mu.Lock()
+	b.closed = true
+	b.mu.Unlock()
+	return nil
+}
+
+func TestDrainAndClose(t *testing.T) {
+	tests := []struct {
+		name          string
+		body          string
+		contentLength int64
+		limit         int64
+		drained       bool
+	}{
+		{"small", "hello", 5, 16, true},
+		{"unknown length", "hello", -1, 16, true},
+		{"declared too large", "hello", 32, 16, false},
+		{"disabled", "hello", 5, 0, false},
+	}
+	for _, tt := range tests {
+		body := &trackedBody{Reader: strings.NewReader(tt.body)}
+		done := make(chan struct{})
+		if err := DrainAndClose(body, tt.contentLength, tt.limit, func() { close(done) }); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		<-done
+		if !body.closed {
+			t.Errorf("%s: body not closed", tt.name)
+		}
+		if rest, _ := io.ReadAll(body.Reader); (len(rest) == 0) != tt.drained {
+			t.Errorf("%s: %d bytes left unread, drained = %v", tt.name, len(rest), tt.drained)
+		}
+	}
+
+	if !drainBody(strings.NewReader("abc"), 3) {
+		t.Error("drainBody stopped short of a body exactly at the limit")
+	}
+	if drainBody(strings.NewReader("abcd"), 3) {
+		t.Error("drainBody reported the end of a body over the limit")
+	}
+}
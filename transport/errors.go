@@ -279,6 +279,24 @@ func categorizeError(err error) error {
 	return ErrConnection
 }
 
+// IsRetryable reports whether err, possibly wrapped, is a transient network
+// failure that a new attempt may not hit
+func IsRetryable(err error) bool {
+	var te *TransportError
+	if errors.As(err, &te) {
+		return te.Retryable
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return true
+	}
+	return isRetryableError(err)
+}
+
 // isRetryableError determines if an error is retryable
 func isRetryableError(err error) bool {
 	if err == nil {
@@ -0,0 +1,554 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sardanioss/httpcloak/fingerprint"
+	"github.com/sardanioss/net/http2"
+	"github.com/sardanioss/net/http2/hpack"
+)
+
+// SETTINGS_ENABLE_CONNECT_PROTOCOL (RFC 8441 Section 3)
+const h2SettingEnableConnectProtocol http2.SettingID = 0x8
+
+// extendedConnectStreamID is the stream the tunnel runs on; it is the only
+// stream opened on its connection
+const extendedConnectStreamID = 1
+
+// ErrExtendedConnectNotSupported is returned when the server's SETTINGS do
+// not include SETTINGS_ENABLE_CONNECT_PROTOCOL=1, so :protocol can't be sent
+var ErrExtendedConnectNotSupported = errors.New("server does not support extended CONNECT (RFC 8441)")
+
+// ExtendedConnectRejectedError is returned when the server answers an
+// extended CONNECT with a non-2xx status
+type ExtendedConnectRejectedError struct {
+	StatusCode int
+	Headers    map[string][]string
+}
+
+func (e *ExtendedConnectRejectedError) Error() string {
+	return fmt.Sprintf("extended CONNECT rejected with status %d", e.StatusCode)
+}
+
+// ExtendedConnectStream is a tunnel opened with an RFC 8441 extended CONNECT,
+// e.g. a WebSocket over HTTP/2. Read returns the DATA the server sends on the
+// stream and Write sends DATA; framing of the tunnelled protocol (WebSocket
+// frames, etc.) is up to the caller. The stream owns its connection.
+type ExtendedConnectStream struct {
+	StatusCode int
+	Headers    map[string][]string
+
+	conn net.Conn
+	fr   *http2.Framer
+	wmu  sync.Mutex // Serializes frame writes
+
+	mu           sync.Mutex
+	cond         *sync.Cond
+	connWindow   int64 // Send windows (RFC 9113 Section 6.9)
+	streamWindow int64
+	maxFrameSize uint32
+	connErr      error // Set once the connection is unusable
+	writeClosed  bool
+
+	data     chan []byte // DATA payloads; closed at END_STREAM or on error
+	readErr  error       // Valid once data is closed
+	pending  []byte
+	unacked  uint32
+	done     chan struct{}
+	closeErr error
+	once     sync.Once
+}
+
+// ExtendedConnect opens an RFC 8441 tunnel to rawURL (https:// or wss://) on
+// a new HTTP/2 connection with the preset's TLS and HTTP/2 fingerprint.
+// protocol is the :protocol value, e.g. "websocket"; headers are sent as
+// regular request headers. For WebSockets pass sec-websocket-version: 13 and
+// no Sec-WebSocket-Key, as RFC 8441 replaces the key/accept exchange.
+// There is no HTTP/3 counterpart (RFC 9220) yet.
+func (t *HTTP2Transport) ExtendedConnect(ctx context.Context, rawURL, protocol string, headers map[string][]string) (*ExtendedConnectStream, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL: %w", err)
+	}
+	if u.Scheme != "https" && u.Scheme != "wss" {
+		return nil, fmt.Errorf("extended CONNECT requires an https:// or wss:// URL, got %q", u.Scheme)
+	}
+	port := u.Port()
+	if port == "" {
+		port = "443"
+	}
+
+	tlsConn, err := t.dialTLS(ctx, u.Hostname(), port)
+	if err != nil {
+		var alpnErr *ALPNMismatchError
+		if errors.As(err, &alpnErr) {
+			alpnErr.TLSConn.Close()
+		}
+		return nil, err
+	}
+
+	userAgent := t.preset.UserAgent
+	if t.config != nil && t.config.TLSOnly {
+		userAgent = ""
+	}
+	s, err := openExtendedConnect(ctx, tlsConn, t.preset.HTTP2Settings, u, protocol, headers, userAgent)
+	if err != nil {
+		tlsConn.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// openExtendedConnect sends the connection preface and the CONNECT request
+// on conn and waits for the response
+func openExtendedConnect(ctx context.Context, conn net.Conn, settings fingerprint.HTTP2Settings, u *url.URL, protocol string, headers map[string][]string, userAgent string) (*ExtendedConnectStream, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+
+	// Preface, SETTINGS, WINDOW_UPDATE and PRIORITY frames go out in one
+	// write, as the regular HTTP/2 transport sends them
+	order, values := settings.SettingsFrame()
+	var flight bytes.Buffer
+	flight.WriteString(http2.ClientPreface)
+	pf := http2.NewFramer(&flight, nil)
+	params := make([]http2.Setting, 0, len(order))
+	for _, id := range order {
+		params = append(params, http2.Setting{ID: http2.SettingID(id), Val: values[id]})
+	}
+	pf.WriteSettings(params...)
+	if settings.ConnectionWindowUpdate > 0 {
+		pf.WriteWindowUpdate(0, settings.ConnectionWindowUpdate)
+	}
+	flight.Write(encodePriorityFrames(settings.PriorityFrames))
+	if _, err := conn.Write(flight.Bytes()); err != nil {
+		return nil, fmt.Errorf("HTTP/2 preface: %w", err)
+	}
+
+	s := &ExtendedConnectStream{
+		conn:         conn,
+		fr:           http2.NewFramer(conn, conn),
+		connWindow:   65535,
+		streamWindow: 65535,
+		maxFrameSize: 16384,
+		data:         make(chan []byte, 8),
+		done:         make(chan struct{}),
+	}
+	s.cond = sync.NewCond(&s.mu)
+	s.fr.ReadMetaHeaders = hpack.NewDecoder(4096, nil)
+	if v, ok := values[fingerprint.H2SettingMaxFrameSize]; ok && v > 0 {
+		s.fr.SetMaxReadFrameSize(v)
+	}
+
+	// The server preface is a SETTINGS frame; :protocol may only be sent
+	// once it has enabled the extension
+	f, err := s.fr.ReadFrame()
+	if err != nil {
+		return nil, fmt.Errorf("reading server SETTINGS: %w", err)
+	}
+	sf, ok := f.(*http2.SettingsFrame)
+	if !ok || sf.IsAck() {
+		return nil, fmt.Errorf("expected server SETTINGS, got %T", f)
+	}
+	enabled := false
+	sf.ForeachSetting(func(st http2.Setting) error {
+		if st.ID == h2SettingEnableConnectProtocol {
+			enabled = st.Val == 1
+		}
+		return nil
+	})
+	s.applySettings(sf)
+	if err := s.writeFrame(func(fr *http2.Framer) error { return fr.WriteSettingsAck() }); err != nil {
+		return nil, err
+	}
+	if !enabled {
+		return nil, ErrExtendedConnectNotSupported
+	}
+
+	if err := s.writeHeaders(settings, u, protocol, headers, userAgent); err != nil {
+		return nil, err
+	}
+
+	for {
+		f, err := s.fr.ReadFrame()
+		if err != nil {
+			return nil, fmt.Errorf("reading extended CONNECT response: %w", err)
+		}
+		if done, err := s.handleControl(f); done || err != nil {
+			if err == nil {
+				err = fmt.Errorf("stream closed before response headers")
+			}
+			return nil, err
+		}
+		hf, ok := f.(*http2.MetaHeadersFrame)
+		if !ok || hf.StreamID != extendedConnectStreamID {
+			continue
+		}
+
+		status := 0
+		fmt.Sscanf(hf.PseudoValue("status"), "%d", &status)
+		respHeaders := make(map[string][]string)
+		for _, field := range hf.RegularFields() {
+			respHeaders[field.Name] = append(respHeaders[field.Name], field.Value)
+		}
+		if status == 0 || status/100 == 1 {
+			continue // Interim response
+		}
+		if status/100 != 2 {
+			return nil, &ExtendedConnectRejectedError{StatusCode: status, Headers: respHeaders}
+		}
+		if hf.StreamEnded() {
+			return nil, fmt.Errorf("server ended the extended CONNECT stream")
+		}
+		s.StatusCode = status
+		s.Headers = respHeaders
+		go s.readLoop()
+		return s, nil
+	}
+}
+
+// writeHeaders sends the CONNECT request HEADERS. Pseudo-headers follow the
+// preset's order with :protocol last, as Chrome sends it.
+func (s *ExtendedConnectStream) writeHeaders(settings fingerprint.HTTP2Settings, u *url.URL, protocol string, headers map[string][]string, userAgent string) error {
+	var block bytes.Buffer
+	enc := hpack.NewEncoder(&block)
+	for _, name := range settings.PseudoHeaders() {
+		var value string
+		switch name {
+		case ":method":
+			value = "CONNECT"
+		case ":authority":
+			value = u.Host
+		case ":scheme":
+			value = "https"
+		case ":path":
+			value = u.RequestURI()
+		default:
+			continue
+		}
+		enc.WriteField(hpack.HeaderField{Name: name, Value: value})
+	}
+	enc.WriteField(hpack.HeaderField{Name: ":protocol", Value: protocol})
+
+	fields := make(map[string][]string, len(headers)+1)
+	for name, vals := range headers {
+		name = strings.ToLower(name)
+		switch name {
+		case "host", "connection", "upgrade", "keep-alive", "proxy-connection", "transfer-encoding", "sec-websocket-key":
+			continue // Connection-specific or replaced by :protocol (RFC 8441 Section 5)
+		}
+		fields[name] = append(fields[name], vals...)
+	}
+	if _, ok := fields["user-agent"]; !ok && userAgent != "" {
+		fields["user-agent"] = []string{userAgent}
+	}
+	for _, name := range orderHeaderNames(fields) {
+		for _, v := range fields[name] {
+			enc.WriteField(hpack.HeaderField{Name: name, Value: v})
+		}
+	}
+
+	var priority http2.PriorityParam
+	if !settings.NoRFC7540Priorities {
+		urgency := -1
+		if v, ok := fields["priority"]; ok && len(v) > 0 {
+			urgency, _ = fingerprint.ParsePriority(v[0])
+		}
+		priority = http2.PriorityParam{
+			Weight:    uint8(settings.HeaderWeight(urgency) - 1), // Wire format is weight-1
+			Exclusive: settings.StreamExclusive,
+		}
+	}
+
+	return s.writeFrame(func(fr *http2.Framer) error {
+		frag := block.Bytes()
+		first := frag
+		if uint32(len(first)) > s.maxFrameSize {
+			first = frag[:s.maxFrameSize]
+		}
+		frag = frag[len(first):]
+		if err := fr.WriteHeaders(http2.HeadersFrameParam{
+			StreamID:      extendedConnectStreamID,
+			BlockFragment: first,
+			EndHeaders:    len(frag) == 0,
+			Priority:      priority,
+		}); err != nil {
+			return err
+		}
+		for len(frag) > 0 {
+			chunk := frag
+			if uint32(len(chunk)) > s.maxFrameSize {
+				chunk = frag[:s.maxFrameSize]
+			}
+			frag = frag[len(chunk):]
+			if err := fr.WriteContinuation(extendedConnectStreamID, len(frag) == 0, chunk); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// orderHeaderNames puts known headers in h2HeaderOrder and the rest after
+// them alphabetically
+func orderHeaderNames(fields map[string][]string) []string {
+	names := make([]string, 0, len(fields))
+	for _, name := range h2HeaderOrder {
+		if _, ok := fields[name]; ok {
+			names = append(names, name)
+		}
+	}
+	known := len(names)
+	for name := range fields {
+		found := false
+		for _, k := range names[:known] {
+			if k == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names[known:])
+	return names
+}
+
+// handleControl processes connection-level frames and frames that end the
+// stream. done reports that the stream is over (err says why, if abnormal).
+func (s *ExtendedConnectStream) handleControl(f http2.Frame) (done bool, err error) {
+	switch f := f.(type) {
+	case *http2.SettingsFrame:
+		if f.IsAck() {
+			return false, nil
+		}
+		s.applySettings(f)
+		return false, s.writeFrame(func(fr *http2.Framer) error { return fr.WriteSettingsAck() })
+	case *http2.PingFrame:
+		if f.IsAck() {
+			return false, nil
+		}
+		return false, s.writeFrame(func(fr *http2.Framer) error { return fr.WritePing(true, f.Data) })
+	case *http2.WindowUpdateFrame:
+		s.mu.Lock()
+		if f.StreamID == 0 {
+			s.connWindow += int64(f.Increment)
+		} else if f.StreamID == extendedConnectStreamID {
+			s.streamWindow += int64(f.Increment)
+		}
+		s.cond.Broadcast()
+		s.mu.Unlock()
+	case *http2.RSTStreamFrame:
+		if f.StreamID == extendedConnectStreamID {
+			return true, fmt.Errorf("stream reset by server: %v", f.ErrCode)
+		}
+	case *http2.GoAwayFrame:
+		if f.LastStreamID < extendedConnectStreamID {
+			return true, fmt.Errorf("connection closed by server (GOAWAY %v)", f.ErrCode)
+		}
+	}
+	return false, nil
+}
+
+// applySettings adjusts send limits to the server's SETTINGS
+func (s *ExtendedConnectStream) applySettings(f *http2.SettingsFrame) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f.ForeachSetting(func(st http2.Setting) error {
+		switch st.ID {
+		case http2.SettingInitialWindowSize:
+			// Changes apply to open streams by the difference (Section 6.9.2)
+			s.streamWindow += int64(st.Val) - 65535
+		case http2.SettingMaxFrameSize:
+			s.maxFrameSize = st.Val
+		}
+		return nil
+	})
+	s.cond.Broadcast()
+}
+
+// readLoop delivers DATA to Read and answers control frames until the
+// connection fails or the stream is closed
+func (s *ExtendedConnectStream) readLoop() {
+	dataOpen := true
+	endData := func(err error) {
+		if dataOpen {
+			s.readErr = err
+			close(s.data)
+			dataOpen = false
+		}
+	}
+
+	for {
+		f, err := s.fr.ReadFrame()
+		if err != nil {
+			s.fail(err)
+			endData(err)
+			return
+		}
+		if done, err := s.handleControl(f); done || err != nil {
+			if err == nil {
+				err = io.EOF
+			}
+			s.fail(err)
+			endData(err)
+			return
+		}
+
+		switch f := f.(type) {
+		case *http2.DataFrame:
+			if f.StreamID != extendedConnectStreamID || !dataOpen {
+				s.ack(f.Length, 0)
+				continue
+			}
+			// Padding counts against flow control but never reaches Read
+			if padding := f.Length - uint32(len(f.Data())); padding > 0 {
+				s.ack(padding, padding)
+			}
+			if len(f.Data()) > 0 {
+				// Data() is only valid until the next ReadFrame
+				payload := append([]byte(nil), f.Data()...)
+				select {
+				case s.data <- payload:
+				case <-s.done:
+					return
+				}
+			}
+			if f.StreamEnded() {
+				endData(io.EOF)
+			}
+		case *http2.MetaHeadersFrame:
+			if f.StreamID == extendedConnectStreamID && f.StreamEnded() {
+				endData(io.EOF) // Trailers
+			}
+		}
+	}
+}
+
+// fail records a connection error and wakes blocked writers
+func (s *ExtendedConnectStream) fail(err error) {
+	s.mu.Lock()
+	if s.connErr == nil {
+		s.connErr = err
+	}
+	s.cond.Broadcast()
+	s.mu.Unlock()
+}
+
+func (s *ExtendedConnectStream) writeFrame(write func(*http2.Framer) error) error {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	return write(s.fr)
+}
+
+// ack returns flow-control credit for bytes received on the connection and,
+// if stream is non-zero, on the stream
+func (s *ExtendedConnectStream) ack(conn, stream uint32) {
+	s.writeFrame(func(fr *http2.Framer) error {
+		if conn > 0 {
+			if err := fr.WriteWindowUpdate(0, conn); err != nil {
+				return err
+			}
+		}
+		if stream > 0 {
+			return fr.WriteWindowUpdate(extendedConnectStreamID, stream)
+		}
+		return nil
+	})
+}
+
+// Read reads data the server sent on the stream. It returns io.EOF once the
+// server has closed its side.
+func (s *ExtendedConnectStream) Read(p []byte) (int, error) {
+	if len(s.pending) == 0 {
+		select {
+		case payload, ok := <-s.data:
+			if !ok {
+				return 0, s.readErr
+			}
+			s.pending = payload
+		case <-s.done:
+			return 0, ErrClosed
+		}
+	}
+	n := copy(p, s.pending)
+	s.pending = s.pending[n:]
+	s.unacked += uint32(n)
+	if len(s.pending) == 0 {
+		s.ack(s.unacked, s.unacked)
+		s.unacked = 0
+	}
+	return n, nil
+}
+
+// Write sends p as DATA frames, waiting for flow-control window as needed
+func (s *ExtendedConnectStream) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		s.mu.Lock()
+		for s.connErr == nil && !s.writeClosed && (s.connWindow <= 0 || s.streamWindow <= 0) {
+			s.cond.Wait()
+		}
+		if s.writeClosed {
+			s.mu.Unlock()
+			return written, ErrClosed
+		}
+		if s.connErr != nil {
+			err := s.connErr
+			s.mu.Unlock()
+			return written, err
+		}
+		n := int64(len(p))
+		n = min(n, s.connWindow, s.streamWindow, int64(s.maxFrameSize))
+		s.connWindow -= n
+		s.streamWindow -= n
+		s.mu.Unlock()
+
+		if err := s.writeFrame(func(fr *http2.Framer) error {
+			return fr.WriteData(extendedConnectStreamID, false, p[:n])
+		}); err != nil {
+			return written, err
+		}
+		written += int(n)
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// CloseWrite ends the client side of the stream (END_STREAM). The server
+// can keep sending until it closes its side.
+func (s *ExtendedConnectStream) CloseWrite() error {
+	s.mu.Lock()
+	if s.writeClosed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.writeClosed = true
+	s.cond.Broadcast()
+	s.mu.Unlock()
+	return s.writeFrame(func(fr *http2.Framer) error {
+		return fr.WriteData(extendedConnectStreamID, true, nil)
+	})
+}
+
+// Close ends the stream and closes its connection
+func (s *ExtendedConnectStream) Close() error {
+	s.once.Do(func() {
+		s.CloseWrite()
+		close(s.done)
+		s.closeErr = s.conn.Close()
+	})
+	return s.closeErr
+}
@@ -0,0 +1,159 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/sardanioss/httpcloak/fingerprint"
+	"github.com/sardanioss/net/http2"
+	"github.com/sardanioss/net/http2/hpack"
+)
+
+// serveExtendedConnect runs a minimal HTTP/2 server for one connection: it
+// advertises SETTINGS_ENABLE_CONNECT_PROTOCOL=enable, sends the request's
+// pseudo-headers to fields, answers 200 and echoes stream DATA.
+func serveExtendedConnect(t *testing.T, ln net.Listener, enable uint32, fields chan<- []hpack.HeaderField) {
+	conn, err := ln.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	preface := make([]byte, len(http2.ClientPreface))
+	if _, err := io.ReadFull(conn, preface); err != nil || string(preface) != http2.ClientPreface {
+		t.Errorf("bad client preface %q: %v", preface, err)
+		return
+	}
+	fr := http2.NewFramer(conn, conn)
+	fr.ReadMetaHeaders = hpack.NewDecoder(4096, nil)
+	fr.WriteSettings(http2.Setting{ID: h2SettingEnableConnectProtocol, Val: enable})
+
+	var hbuf bytes.Buffer
+	enc := hpack.NewEncoder(&hbuf)
+	for {
+		f, err := fr.ReadFrame()
+		if err != nil {
+			return
+		}
+		switch f := f.(type) {
+		case *http2.MetaHeadersFrame:
+			fields <- f.Fields
+			enc.WriteField(hpack.HeaderField{Name: ":status", Value: "200"})
+			enc.WriteField(hpack.HeaderField{Name: "sec-websocket-protocol", Value: "chat"})
+			fr.WriteHeaders(http2.HeadersFrameParam{StreamID: f.StreamID, BlockFragment: hbuf.Bytes(), EndHeaders: true})
+		case *http2.DataFrame:
+			if len(f.Data()) > 0 {
+				fr.WriteData(f.StreamID, false, append([]byte(nil), f.Data()...))
+			}
+			if f.StreamEnded() {
+				fr.WriteData(f.StreamID, true, nil)
+			}
+		}
+	}
+}
+
+func TestExtendedConnect(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	fields := make(chan []hpack.HeaderField, 1)
+	go serveExtendedConnect(t, ln, 1, fields)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	settings := fingerprint.HTTP2Settings{
+		HeaderTableSize:        65536,
+		InitialWindowSize:      6291456,
+		MaxHeaderListSize:      262144,
+		ConnectionWindowUpdate: 15663105,
+		StreamWeight:           256,
+		StreamExclusive:        true,
+	}
+	u, _ := url.Parse("wss://example.com/chat?room=1")
+	s, err := openExtendedConnect(ctx, conn, settings, u, "websocket", map[string][]string{
+		"Sec-WebSocket-Version": {"13"},
+		"Sec-WebSocket-Key":     {"dropped"},
+		"Origin":                {"https://example.com"},
+	}, "test-agent")
+	if err != nil {
+		t.Fatalf("openExtendedConnect: %v", err)
+	}
+	defer s.Close()
+
+	if s.StatusCode != 200 || s.Headers["sec-websocket-protocol"][0] != "chat" {
+		t.Errorf("response = %d %v", s.StatusCode, s.Headers)
+	}
+
+	var names []string
+	got := make(map[string]string)
+	for _, f := range <-fields {
+		names = append(names, f.Name)
+		got[f.Name] = f.Value
+	}
+	wantPseudo := []string{":method", ":authority", ":scheme", ":path", ":protocol"}
+	for i, name := range wantPseudo {
+		if i >= len(names) || names[i] != name {
+			t.Fatalf("header order = %v, want pseudo-headers %v first", names, wantPseudo)
+		}
+	}
+	if got[":method"] != "CONNECT" || got[":protocol"] != "websocket" || got[":scheme"] != "https" || got[":path"] != "/chat?room=1" {
+		t.Errorf("pseudo-headers = %v", got)
+	}
+	if _, ok := got["sec-websocket-key"]; ok {
+		t.Error("Sec-WebSocket-Key must not be sent over HTTP/2")
+	}
+	if got["user-agent"] != "test-agent" || got["sec-websocket-version"] != "13" {
+		t.Errorf("regular headers = %v", got)
+	}
+
+	msg := bytes.Repeat([]byte("x"), 40000) // More than one DATA frame
+	if _, err := s.Write(msg); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := s.CloseWrite(); err != nil {
+		t.Fatalf("CloseWrite: %v", err)
+	}
+	echo, err := io.ReadAll(s)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if !bytes.Equal(echo, msg) {
+		t.Errorf("echoed %d bytes, want %d", len(echo), len(msg))
+	}
+}
+
+func TestExtendedConnectNotSupported(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go serveExtendedConnect(t, ln, 0, make(chan []hpack.HeaderField, 1))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	u, _ := url.Parse("https://example.com/")
+	_, err = openExtendedConnect(ctx, conn, fingerprint.HTTP2Settings{}, u, "websocket", nil, "")
+	if !errors.Is(err, ErrExtendedConnectNotSupported) {
+		t.Errorf("err = %v, want ErrExtendedConnectNotSupported", err)
+	}
+}
@@ -0,0 +1,226 @@
+//go:build js
+
+package transport
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"syscall/js"
+	"time"
+
+	http "github.com/sardanioss/http"
+	"github.com/sardanioss/httpcloak/protocol"
+)
+
+// doPlatform routes every request through Fetch - js/wasm has no sockets, so
+// none of the fingerprinted transports can dial. TLS and HTTP/2 framing are
+// the host's own; only headers the host lets scripts set reach the wire.
+// Fetch follows redirects and decodes the body itself, so the response is
+// already final and decompressed.
+func (t *Transport) doPlatform(ctx context.Context, req *Request) (*Response, bool, error) {
+	resp, err := t.doFetch(ctx, req)
+	return resp, true, err
+}
+
+func (t *Transport) doFetch(ctx context.Context, req *Request) (*Response, error) {
+	startTime := time.Now()
+	timing := &protocol.Timing{}
+
+	parsedURL, err := url.Parse(req.URL)
+	if err != nil {
+		return nil, NewRequestError("parse_url", "", "", "fetch", err)
+	}
+	host := parsedURL.Hostname()
+	port := parsedURL.Port()
+
+	timeout := t.timeout
+	if req.Timeout > 0 {
+		timeout = req.Timeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	method := req.Method
+	if method == "" {
+		method = "GET"
+	}
+
+	httpReq, err := newHTTPRequest(ctx, method, req)
+	if err != nil {
+		return nil, NewRequestError("create_request", host, port, "fetch", err)
+	}
+
+	effectiveTLSOnly := t.tlsOnly
+	if req.TLSOnly != nil {
+		effectiveTLSOnly = *req.TLSOnly
+	}
+	applyPresetHeaders(httpReq, t.preset, t.getHeaderOrder(), effectiveTLSOnly, "h1")
+	for key, values := range req.Headers {
+		for i, value := range values {
+			if i == 0 {
+				httpReq.Header.Set(key, value)
+			} else {
+				httpReq.Header.Add(key, value)
+			}
+		}
+	}
+
+	applyRequestPriority(httpReq, t.preset, req.Headers, req.Priority, effectiveTLSOnly, "h1")
+	t.applyHeaderRules(httpReq)
+
+	reqStart := time.Now()
+	resp, err := fetch(httpReq)
+	if err != nil {
+		return nil, WrapError("roundtrip", host, port, "fetch", err)
+	}
+
+	ContextClientTrace(ctx).gotFirstResponseByte()
+	timing.FirstByte = float64(time.Since(reqStart).Milliseconds())
+
+	body, err := resp.readBody(ctx)
+	if err != nil {
+		return nil, NewRequestError("read_body", host, port, "fetch", err)
+	}
+
+	timing.Total = float64(time.Since(startTime).Milliseconds())
+
+	headers := buildHeadersMap(resp.header)
+	// The body is already decoded; drop the header so callers don't decode twice
+	delete(headers, "content-encoding")
+
+	// Where Fetch's redirects ended; empty for opaque responses
+	finalURL := resp.url
+	if finalURL == "" {
+		finalURL = req.URL
+	}
+
+	return &Response{
+		StatusCode: resp.status,
+		Headers:    headers,
+		Body:       io.NopCloser(bytes.NewReader(body)),
+		FinalURL:   finalURL,
+		Timing:     timing,
+		Protocol:   "fetch",
+		bodyBytes:  body,
+		bodyRead:   true,
+	}, nil
+}
+
+// fetchResponse is a Fetch API Response whose headers have arrived
+type fetchResponse struct {
+	status int
+	header http.Header
+	url    string // Response.url, after redirects
+
+	value js.Value
+	abort js.Value // AbortController, or undefined
+}
+
+// fetch sends req through the host's Fetch API (browser or Node), as the
+// js http.Transport does, and returns once the headers arrive. Calling fetch
+// directly rather than through http.Transport gives access to Response.url.
+func fetch(req *http.Request) (*fetchResponse, error) {
+	ac := js.Global().Get("AbortController")
+	if !ac.IsUndefined() {
+		ac = ac.New()
+	}
+
+	opt := js.Global().Get("Object").New()
+	opt.Set("method", req.Method)
+	opt.Set("credentials", "same-origin")
+	if !ac.IsUndefined() {
+		opt.Set("signal", ac.Get("signal"))
+	}
+	headers := js.Global().Get("Headers").New()
+	for key, values := range req.Header {
+		for _, value := range values {
+			headers.Call("append", key, value)
+		}
+	}
+	opt.Set("headers", headers)
+	if req.Body != nil {
+		body, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if len(body) != 0 {
+			buf := js.Global().Get("Uint8Array").New(len(body))
+			js.CopyBytesToJS(buf, body)
+			opt.Set("body", buf)
+		}
+	}
+
+	value, err := awaitPromise(req.Context(), ac, js.Global().Call("fetch", req.URL.String(), opt))
+	if err != nil {
+		return nil, err
+	}
+	resp := &fetchResponse{
+		status: value.Get("status").Int(),
+		header: http.Header{},
+		url:    value.Get("url").String(),
+		value:  value,
+		abort:  ac,
+	}
+	entries := value.Get("headers").Call("entries")
+	for {
+		next := entries.Call("next")
+		if next.Get("done").Bool() {
+			break
+		}
+		pair := next.Get("value")
+		key := http.CanonicalHeaderKey(pair.Index(0).String())
+		resp.header[key] = append(resp.header[key], pair.Index(1).String())
+	}
+	return resp, nil
+}
+
+// readBody reads the whole response body
+func (r *fetchResponse) readBody(ctx context.Context) ([]byte, error) {
+	buf, err := awaitPromise(ctx, r.abort, r.value.Call("arrayBuffer"))
+	if err != nil {
+		return nil, err
+	}
+	data := js.Global().Get("Uint8Array").New(buf)
+	body := make([]byte, data.Get("byteLength").Int())
+	js.CopyBytesToGo(body, data)
+	return body, nil
+}
+
+// awaitPromise waits for promise to settle, aborting the fetch through ac
+// if ctx ends first
+func awaitPromise(ctx context.Context, ac, promise js.Value) (js.Value, error) {
+	var (
+		valueCh          = make(chan js.Value, 1)
+		errCh            = make(chan error, 1)
+		success, failure js.Func
+	)
+	success = js.FuncOf(func(this js.Value, args []js.Value) any {
+		success.Release()
+		failure.Release()
+		valueCh <- args[0]
+		return nil
+	})
+	failure = js.FuncOf(func(this js.Value, args []js.Value) any {
+		success.Release()
+		failure.Release()
+		errCh <- fmt.Errorf("fetch() failed: %s", args[0].Get("message").String())
+		return nil
+	})
+	promise.Call("then", success, failure)
+
+	select {
+	case <-ctx.Done():
+		if !ac.IsUndefined() {
+			ac.Call("abort")
+		}
+		return js.Value{}, ctx.Err()
+	case value := <-valueCh:
+		return value, nil
+	case err := <-errCh:
+		return js.Value{}, err
+	}
+}
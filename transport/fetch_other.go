@@ -0,0 +1,11 @@
+//go:build !js
+
+package transport
+
+import "context"
+
+// doPlatform lets platforms without raw sockets substitute their own HTTP
+// stack. Everywhere else the fingerprinted transports handle the request.
+func (t *Transport) doPlatform(ctx context.Context, req *Request) (*Response, bool, error) {
+	return nil, false, nil
+}
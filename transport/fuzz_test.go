@@ -0,0 +1,48 @@
+package transport
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/sardanioss/httpcloak/fingerprint"
+)
+
+// fuzzHeaders parses "Name: value" lines, as headers echoed from a server
+// or carried over a redirect arrive
+func fuzzHeaders(block string) map[string][]string {
+	headers := make(map[string][]string)
+	for _, line := range strings.Split(block, "\n") {
+		name, value, _ := strings.Cut(line, ":")
+		headers[name] = append(headers[name], strings.TrimSpace(value))
+	}
+	return headers
+}
+
+// FuzzPresetHeaders merges arbitrary headers and header orders with each
+// preset's. Run it with go test ./transport -run '^$' -fuzz FuzzPresetHeaders
+func FuzzPresetHeaders(f *testing.F) {
+	f.Add("Cookie: a=b\nSec-Fetch-Dest: image\nSec-Fetch-Mode: no-cors\nX-Custom: 1", "x-custom,user-agent,cookie", uint8(0), "h2", false)
+	f.Add("Priority: u=3\nPriority: i\n: \n:authority: evil", "", uint8(3), "h3", false)
+	f.Add("user-agent\nUSER-AGENT: x\nSec-Fetch-Dest:", ",,", uint8(7), "h1", true)
+	names := fingerprint.Available()
+	sort.Strings(names)
+	f.Fuzz(func(t *testing.T, block, order string, presetIndex uint8, protocol string, tlsOnly bool) {
+		headers := fuzzHeaders(block)
+		var headerOrder []string
+		if order != "" {
+			headerOrder = strings.Split(order, ",")
+		}
+		preset := fingerprint.Get(names[int(presetIndex)%len(names)])
+		PresetHeaders(preset, headers, headerOrder, tlsOnly, protocol)
+
+		MergeHeaders(headers)
+		lower := make(map[string][]string, len(headers))
+		for name, values := range headers {
+			lower[strings.ToLower(name)] = values
+		}
+		if ordered := orderHeaderNames(lower); len(ordered) != len(lower) {
+			t.Fatalf("%d headers ordered as %d", len(lower), len(ordered))
+		}
+	})
+}
@@ -0,0 +1,224 @@
+package transport
+
+import (
+	"encoding/binary"
+	"net"
+	"sync"
+
+	"github.com/sardanioss/httpcloak/fingerprint"
+	"github.com/sardanioss/net/http2/hpack"
+	tls "github.com/sardanioss/utls"
+)
+
+const (
+	h2FrameHeaderLen = 9
+
+	h2FrameHeaders      = 0x1
+	h2FrameContinuation = 0x9
+
+	h2FlagEndStream  = 0x1
+	h2FlagEndHeaders = 0x4
+	h2FlagPadded     = 0x8
+	h2FlagPriority   = 0x20
+)
+
+// h2ClientPreface opens every HTTP/2 connection (RFC 9113 Section 3.4)
+const h2ClientPreface = "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"
+
+// NewHTTP2Conn wraps an HTTP/2 TLS connection so its framing matches the
+// preset: PRIORITY frames follow the connection preface, HEADERS carry the
+// weight of their request's urgency, and header blocks too large for one
+// frame are split into HEADERS and CONTINUATION frames the size the browser
+// sends.
+func NewHTTP2Conn(conn *tls.UConn, settings fingerprint.HTTP2Settings) net.Conn {
+	return &headerFrameConn{
+		UConn: conn,
+		next:  NewPriorityFrameConn(conn, settings.PriorityFrames),
+		framer: headerFramer{
+			limit:   settings.HeaderFramePayload(),
+			weigher: newHeaderWeigher(settings),
+		},
+	}
+}
+
+// headerFrameConn passes the http2 client's writes through a headerFramer
+type headerFrameConn struct {
+	*tls.UConn
+	next net.Conn // conn, or its PRIORITY frame wrapper
+
+	mu     sync.Mutex
+	framer headerFramer
+}
+
+func (c *headerFrameConn) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := c.framer.frame(p)
+	if len(out) == 0 {
+		return len(p), nil
+	}
+	if _, err := c.next.Write(out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// headerFramer re-frames the header blocks in a client's HTTP/2 byte
+// stream. The http2 client splits blocks at the peer's frame size and
+// doesn't count the priority fields of HEADERS against it; browsers cap
+// every frame's payload, those fields included, at limit. Other frames pass
+// through untouched, as do header blocks that fit in one frame unless
+// weigher reweighs them.
+type headerFramer struct {
+	limit   int
+	weigher *headerWeigher // Nil leaves HEADERS weights as sent
+
+	started bool   // Connection preface passed
+	pending []byte // Start of a frame the next write completes
+
+	// Header block being collected from HEADERS and CONTINUATION frames
+	collecting bool
+	streamID   uint32
+	flags      byte   // END_STREAM and PRIORITY of the HEADERS frame
+	priority   []byte // Its priority fields
+	block      []byte
+}
+
+// frame consumes p and returns the bytes to send in its place. Frames cut
+// short at the end of p are held until the next call.
+func (f *headerFramer) frame(p []byte) []byte {
+	buf := append(f.pending, p...)
+	f.pending = nil
+	out := make([]byte, 0, len(buf))
+
+	if !f.started {
+		if len(buf) < len(h2ClientPreface) {
+			f.pending = buf
+			return nil
+		}
+		out = append(out, buf[:len(h2ClientPreface)]...)
+		buf = buf[len(h2ClientPreface):]
+		f.started = true
+	}
+
+	for len(buf) >= h2FrameHeaderLen {
+		length := int(buf[0])<<16 | int(buf[1])<<8 | int(buf[2])
+		if len(buf) < h2FrameHeaderLen+length {
+			break
+		}
+		frame := buf[:h2FrameHeaderLen+length]
+		buf = buf[len(frame):]
+		typ, flags, payload := frame[3], frame[4], frame[h2FrameHeaderLen:]
+
+		switch {
+		case typ == h2FrameHeaders && (flags&h2FlagEndHeaders == 0 || length > f.limit || f.weigher != nil):
+			if flags&h2FlagPadded != 0 && len(payload) > 0 {
+				padding := int(payload[0])
+				if padding >= len(payload) {
+					out = append(out, frame...) // Malformed; not ours to fix
+					continue
+				}
+				payload = payload[1 : len(payload)-padding]
+			}
+			f.collecting = true
+			f.streamID = binary.BigEndian.Uint32(frame[5:9]) & 0x7fffffff
+			f.flags = flags & (h2FlagEndStream | h2FlagPriority)
+			f.priority = nil
+			if flags&h2FlagPriority != 0 && len(payload) >= 5 {
+				f.priority = append([]byte(nil), payload[:5]...)
+				payload = payload[5:]
+			}
+			f.block = append([]byte(nil), payload...)
+		case typ == h2FrameContinuation && f.collecting:
+			f.block = append(f.block, payload...)
+		default:
+			out = append(out, frame...)
+			continue
+		}
+		if flags&h2FlagEndHeaders != 0 {
+			out = f.appendHeaderBlock(out)
+		}
+	}
+	if len(buf) > 0 {
+		f.pending = append([]byte(nil), buf...)
+	}
+	return out
+}
+
+// appendHeaderBlock appends the collected header block to out, split into
+// HEADERS and CONTINUATION frames of at most limit payload bytes
+func (f *headerFramer) appendHeaderBlock(out []byte) []byte {
+	block := f.block
+	if f.weigher != nil {
+		// Every block is decoded, weighed or not, to keep the table in step
+		if weight, ok := f.weigher.weight(block); ok && f.priority != nil {
+			f.priority[4] = weight
+		}
+	}
+	typ, flags, prefix := byte(h2FrameHeaders), f.flags, f.priority
+	for {
+		n := min(f.limit-len(prefix), len(block))
+		chunk := block[:n]
+		block = block[n:]
+		if len(block) == 0 {
+			flags |= h2FlagEndHeaders
+		}
+		length := len(prefix) + len(chunk)
+		out = append(out, byte(length>>16), byte(length>>8), byte(length), typ, flags)
+		out = binary.BigEndian.AppendUint32(out, f.streamID)
+		out = append(out, prefix...)
+		out = append(out, chunk...)
+		if len(block) == 0 {
+			break
+		}
+		typ, flags, prefix = h2FrameContinuation, 0, nil
+	}
+	f.collecting, f.priority, f.block = false, nil, nil
+	return out
+}
+
+// headerWeigher finds the weight of each HEADERS frame from the urgency of
+// its request's Priority header, as Chrome weighs streams by request
+// priority. It decodes every header block sent on the connection, in order,
+// to keep its HPACK table in step with the client's encoder.
+type headerWeigher struct {
+	settings fingerprint.HTTP2Settings
+	dec      *hpack.Decoder
+	urgency  int
+	failed   bool // A block didn't decode; the table is lost
+}
+
+// newHeaderWeigher returns a weigher for settings, or nil if the preset
+// weighs every stream alike
+func newHeaderWeigher(settings fingerprint.HTTP2Settings) *headerWeigher {
+	if len(settings.UrgencyWeights) == 0 {
+		return nil
+	}
+	w := &headerWeigher{settings: settings}
+	// Room for any table size the encoder is allowed; it sends size updates
+	w.dec = hpack.NewDecoder(65536, func(f hpack.HeaderField) {
+		if f.Name == "priority" {
+			w.urgency, _ = fingerprint.ParsePriority(f.Value)
+		}
+	})
+	return w
+}
+
+// weight returns the wire weight (weight-1) for a request's header block.
+// ok is false once a block fails to decode: from then on weights are left
+// as the client sent them.
+func (w *headerWeigher) weight(block []byte) (weight byte, ok bool) {
+	if w.failed {
+		return 0, false
+	}
+	w.urgency = -1
+	if _, err := w.dec.Write(block); err != nil {
+		w.failed = true
+		return 0, false
+	}
+	if err := w.dec.Close(); err != nil {
+		w.failed = true
+		return 0, false
+	}
+	return byte(w.settings.HeaderWeight(w.urgency) - 1), true
+}
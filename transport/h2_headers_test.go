@@ -0,0 +1,128 @@
+package transport
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/sardanioss/httpcloak/fingerprint"
+	"github.com/sardanioss/net/http2/hpack"
+)
+
+// h2Frame serializes one HTTP/2 frame
+func h2Frame(typ, flags byte, streamID uint32, payload []byte) []byte {
+	n := len(payload)
+	out := []byte{byte(n >> 16), byte(n >> 8), byte(n), typ, flags}
+	out = binary.BigEndian.AppendUint32(out, streamID)
+	return append(out, payload...)
+}
+
+func TestHeaderFramerSplitsLargeBlocks(t *testing.T) {
+	block := bytes.Repeat([]byte{'x'}, 40000)
+	priority := []byte{0x80, 0, 0, 0, 255}
+
+	// As the http2 client writes it: 16384 bytes of block after the priority
+	var in []byte
+	in = append(in, h2ClientPreface...)
+	in = append(in, h2Frame(h2FrameHeaders, h2FlagEndStream|h2FlagPriority, 1, append(append([]byte(nil), priority...), block[:16384]...))...)
+	in = append(in, h2Frame(h2FrameContinuation, 0, 1, block[16384:32768])...)
+	in = append(in, h2Frame(h2FrameContinuation, h2FlagEndHeaders, 1, block[32768:])...)
+	ping := h2Frame(0x6, 0, 0, make([]byte, 8))
+	in = append(in, ping...)
+
+	// Written in pieces cutting frames short
+	f := headerFramer{limit: 16374}
+	var out []byte
+	for _, piece := range [][]byte{in[:10], in[10:5000], in[5000:20000], in[20000:]} {
+		out = append(out, f.frame(piece)...)
+	}
+
+	if !bytes.HasPrefix(out, []byte(h2ClientPreface)) {
+		t.Fatal("preface missing")
+	}
+	out = out[len(h2ClientPreface):]
+	var got []byte
+	var lengths []int
+	for i := 0; len(out) >= h2FrameHeaderLen; i++ {
+		length := int(out[0])<<16 | int(out[1])<<8 | int(out[2])
+		typ, flags, payload := out[3], out[4], out[h2FrameHeaderLen:h2FrameHeaderLen+length]
+		frame := out[:h2FrameHeaderLen+length]
+		out = out[len(frame):]
+		if typ == 0x6 {
+			if !bytes.Equal(frame, ping) || len(out) != 0 {
+				t.Errorf("PING frame altered or misplaced")
+			}
+			break
+		}
+		lengths = append(lengths, length)
+		if i == 0 {
+			if typ != h2FrameHeaders || flags != h2FlagEndStream|h2FlagPriority || !bytes.Equal(payload[:5], priority) {
+				t.Fatalf("first frame: type %d flags %#x", typ, flags)
+			}
+			payload = payload[5:]
+		} else if typ != h2FrameContinuation {
+			t.Fatalf("frame %d: type %d, want CONTINUATION", i, typ)
+		}
+		if last := len(got)+len(payload) == len(block); last != (flags&h2FlagEndHeaders != 0) {
+			t.Errorf("frame %d: END_HEADERS %v", i, !last)
+		}
+		got = append(got, payload...)
+	}
+	if !bytes.Equal(got, block) {
+		t.Error("header block changed")
+	}
+	if want := []int{16374, 16374, 40000 + 5 - 2*16374}; len(lengths) != 3 || lengths[0] != want[0] || lengths[1] != want[1] || lengths[2] != want[2] {
+		t.Errorf("frame lengths %v, want %v", lengths, want)
+	}
+}
+
+func TestHeaderFramerPassesSmallBlocks(t *testing.T) {
+	var in []byte
+	in = append(in, h2ClientPreface...)
+	in = append(in, h2Frame(h2FrameHeaders, h2FlagEndHeaders, 1, []byte("small"))...)
+	f := headerFramer{limit: 16374}
+	if out := f.frame(in); !bytes.Equal(out, in) {
+		t.Error("small header block re-framed")
+	}
+}
+
+func TestHeaderFramerWeighsByUrgency(t *testing.T) {
+	// Header blocks from one encoder, so later ones index earlier fields
+	var block bytes.Buffer
+	enc := hpack.NewEncoder(&block)
+	encode := func(priority string) []byte {
+		block.Reset()
+		enc.WriteField(hpack.HeaderField{Name: ":method", Value: "GET"})
+		if priority != "" {
+			enc.WriteField(hpack.HeaderField{Name: "priority", Value: priority})
+		}
+		return append([]byte(nil), block.Bytes()...)
+	}
+
+	settings := fingerprint.Get("chrome-143").HTTP2Settings
+	f := headerFramer{limit: settings.HeaderFramePayload(), weigher: newHeaderWeigher(settings)}
+	f.frame([]byte(h2ClientPreface))
+	tests := []struct {
+		priority string
+		weight   byte
+	}{
+		{"u=0, i", 255},
+		{"u=1", 219},
+		{"u=1", 219}, // From the dynamic table
+		{"i", 146},
+		{"", 255}, // StreamWeight
+	}
+	for i, tt := range tests {
+		payload := append([]byte{0x80, 0, 0, 0, 255}, encode(tt.priority)...)
+		out := f.frame(h2Frame(h2FrameHeaders, h2FlagEndHeaders|h2FlagPriority, uint32(2*i+1), payload))
+		if len(out) != h2FrameHeaderLen+len(payload) {
+			t.Fatalf("%q: %d bytes out, want %d", tt.priority, len(out), h2FrameHeaderLen+len(payload))
+		}
+		if got := out[h2FrameHeaderLen+4]; got != tt.weight {
+			t.Errorf("%q: wire weight %d, want %d", tt.priority, got, tt.weight)
+		}
+		if !bytes.Equal(out[h2FrameHeaderLen+5:], payload[5:]) {
+			t.Errorf("%q: header block changed", tt.priority)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package transport
+
+import (
+	"encoding/binary"
+	"net"
+	"sync/atomic"
+
+	"github.com/sardanioss/httpcloak/fingerprint"
+	tls "github.com/sardanioss/utls"
+)
+
+// priorityFrameConn appends PRIORITY frames to the first write on a new
+// HTTP/2 connection. The http2 client flushes the preface, SETTINGS and
+// WINDOW_UPDATE in that write, so the frames land right behind them as they
+// do from a browser.
+type priorityFrameConn struct {
+	*tls.UConn
+	frames []byte
+	sent   atomic.Bool
+}
+
+func (c *priorityFrameConn) Write(p []byte) (int, error) {
+	if !c.sent.CompareAndSwap(false, true) {
+		return c.UConn.Write(p)
+	}
+	buf := make([]byte, 0, len(p)+len(c.frames))
+	buf = append(buf, p...)
+	buf = append(buf, c.frames...)
+	n, err := c.UConn.Write(buf)
+	if n > len(p) {
+		n = len(p)
+	}
+	return n, err
+}
+
+// NewPriorityFrameConn wraps an HTTP/2 TLS connection so it sends frames
+// after the connection preface. Without frames conn is returned as-is.
+func NewPriorityFrameConn(conn *tls.UConn, frames []fingerprint.H2PriorityFrame) net.Conn {
+	if len(frames) == 0 {
+		return conn
+	}
+	return &priorityFrameConn{UConn: conn, frames: encodePriorityFrames(frames)}
+}
+
+// encodePriorityFrames serializes PRIORITY frames (RFC 7540 Section 6.3)
+func encodePriorityFrames(frames []fingerprint.H2PriorityFrame) []byte {
+	const frameTypePriority = 0x2
+	buf := make([]byte, 0, len(frames)*14)
+	for _, f := range frames {
+		dep := f.StreamDep & 0x7fffffff
+		if f.Exclusive {
+			dep |= 1 << 31
+		}
+		weight := f.Weight
+		if weight == 0 {
+			weight = 16 // RFC 7540 default
+		}
+		buf = append(buf, 0, 0, 5, frameTypePriority, 0) // length, type, flags
+		buf = binary.BigEndian.AppendUint32(buf, f.StreamID&0x7fffffff)
+		buf = binary.BigEndian.AppendUint32(buf, dep)
+		buf = append(buf, byte(weight-1))
+	}
+	return buf
+}
@@ -0,0 +1,6 @@
+//go:build js || wasip1
+
+package transport
+
+// h3TransportConfig returns nil: the HTTP/3 stub keeps no config
+func h3TransportConfig(*HTTP3Transport) *TransportConfig { return nil }
@@ -0,0 +1,12 @@
+//go:build !js && !wasip1
+
+package transport
+
+// h3TransportConfig returns the config of an HTTP/3 transport, nil if there
+// is none
+func h3TransportConfig(h3 *HTTP3Transport) *TransportConfig {
+	if h3 == nil {
+		return nil
+	}
+	return h3.config
+}
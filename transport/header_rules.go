@@ -0,0 +1,57 @@
+package transport
+
+import (
+	"strings"
+
+	http "github.com/sardanioss/http"
+	"github.com/sardanioss/httpcloak/protocol"
+)
+
+// SetHeaderRules sets the rules that remove headers from requests to
+// matching hosts (see protocol.HeaderRule)
+func (t *Transport) SetHeaderRules(rules []protocol.HeaderRule) {
+	t.headerRules = rules
+}
+
+// applyHeaderRules runs the transport's header rules over a request about to
+// be sent
+func (t *Transport) applyHeaderRules(httpReq *http.Request) {
+	ApplyHeaderRules(httpReq.Header, t.headerRules, httpReq.URL.Hostname())
+}
+
+// ApplyHeaderRules removes the headers the rules matching host don't allow.
+// The header ordering keys are kept.
+func ApplyHeaderRules(header http.Header, rules []protocol.HeaderRule, host string) {
+	for _, rule := range rules {
+		if !headerRuleMatches(rule, host) {
+			continue
+		}
+		for _, name := range rule.Strip {
+			header.Del(name)
+		}
+		if len(rule.Allow) == 0 {
+			continue
+		}
+		for name := range header {
+			if name == http.HeaderOrderKey || name == http.PHeaderOrderKey {
+				continue
+			}
+			allowed := false
+			for _, a := range rule.Allow {
+				if strings.EqualFold(name, a) {
+					allowed = true
+					break
+				}
+			}
+			if !allowed {
+				delete(header, name)
+			}
+		}
+	}
+}
+
+// headerRuleMatches reports whether host is one of the rule's hosts or a
+// subdomain of one
+func headerRuleMatches(rule protocol.HeaderRule, host string) bool {
+	return hostMatchesAny(host, rule.Hosts)
+}
@@ -0,0 +1,46 @@
+package transport
+
+import (
+	"testing"
+
+	http "github.com/sardanioss/http"
+	"github.com/sardanioss/httpcloak/protocol"
+)
+
+func TestApplyHeaderRules(t *testing.T) {
+	rules := []protocol.HeaderRule{
+		{Hosts: []string{"tracker.example"}, Strip: []string{"referer"}},
+		{Hosts: []string{"*.api.example"}, Allow: []string{"Accept", "Authorization"}},
+	}
+	newHeader := func() http.Header {
+		return http.Header{
+			"Referer":            []string{"https://site.example/"},
+			"Accept":             []string{"*/*"},
+			"Authorization":      []string{"Bearer t"},
+			"User-Agent":         []string{"ua"},
+			http.HeaderOrderKey:  []string{"accept", "user-agent"},
+			http.PHeaderOrderKey: []string{":method"},
+		}
+	}
+
+	h := newHeader()
+	ApplyHeaderRules(h, rules, "cdn.tracker.example")
+	if h.Get("Referer") != "" || h.Get("User-Agent") == "" {
+		t.Errorf("tracker subdomain: %v", h)
+	}
+
+	h = newHeader()
+	ApplyHeaderRules(h, rules, "v1.api.example")
+	if len(h) != 4 || h.Get("User-Agent") != "" || h.Get("Authorization") == "" {
+		t.Errorf("allow list: %v", h)
+	}
+	if h[http.HeaderOrderKey] == nil || h[http.PHeaderOrderKey] == nil {
+		t.Error("allow list dropped the header order")
+	}
+
+	h = newHeader()
+	ApplyHeaderRules(h, rules, "other.example")
+	if len(h) != 6 {
+		t.Errorf("unmatched host changed: %v", h)
+	}
+}
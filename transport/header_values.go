@@ -0,0 +1,89 @@
+package transport
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DuplicateHeaders decides how GetHeader reads a response header the server
+// sent in more than one field line. Response.Headers always keeps every
+// line as its own value, in the order received.
+type DuplicateHeaders int
+
+const (
+	// DuplicateHeadersFirst reads the first line. Default.
+	DuplicateHeadersFirst DuplicateHeaders = iota
+
+	// DuplicateHeadersMerge joins the lines with ", ", which RFC 9110
+	// makes equivalent for list-based fields such as Vary, Link and
+	// Cache-Control
+	DuplicateHeadersMerge
+
+	// DuplicateHeadersLast reads the last line
+	DuplicateHeadersLast
+)
+
+// unjoinable lists the fields whose lines can't be joined with commas:
+// Set-Cookie values contain them (Expires) and so do the parameters of
+// authentication challenges
+var unjoinable = map[string]bool{
+	"set-cookie":         true,
+	"www-authenticate":   true,
+	"proxy-authenticate": true,
+}
+
+// String returns the policy name as used in protocol.SessionConfig.
+func (d DuplicateHeaders) String() string {
+	switch d {
+	case DuplicateHeadersMerge:
+		return "merge"
+	case DuplicateHeadersLast:
+		return "last"
+	default:
+		return "first"
+	}
+}
+
+// ParseDuplicateHeaders parses a policy name ("first", "merge" or "last").
+// The empty string selects the default (first).
+func ParseDuplicateHeaders(s string) (DuplicateHeaders, error) {
+	switch strings.ToLower(s) {
+	case "", "first":
+		return DuplicateHeadersFirst, nil
+	case "merge":
+		return DuplicateHeadersMerge, nil
+	case "last":
+		return DuplicateHeadersLast, nil
+	default:
+		return DuplicateHeadersFirst, fmt.Errorf("unknown duplicate header policy %q (want \"first\", \"merge\" or \"last\")", s)
+	}
+}
+
+// HeaderValue reads values, the lines of header name, as one value.
+// Set-Cookie and the authentication challenges are never joined: merging
+// reads their first line.
+func (d DuplicateHeaders) HeaderValue(name string, values []string) string {
+	switch {
+	case len(values) == 0:
+		return ""
+	case d == DuplicateHeadersLast:
+		return values[len(values)-1]
+	case d == DuplicateHeadersMerge && !unjoinable[strings.ToLower(name)]:
+		return strings.Join(values, ", ")
+	default:
+		return values[0]
+	}
+}
+
+// MergeHeaders returns headers with one value per field, lines joined as
+// RFC 9110 allows. Set-Cookie and the authentication challenges, which
+// can't be joined, are left out; read their lines from headers.
+func MergeHeaders(headers map[string][]string) map[string]string {
+	merged := make(map[string]string, len(headers))
+	for name, values := range headers {
+		if len(values) > 0 && !unjoinable[strings.ToLower(name)] {
+			merged[name] = strings.Join(values, ", ")
+		}
+	}
+	return merged
+}
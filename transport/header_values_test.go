@@ -0,0 +1,48 @@
+package transport
+
+import (
+	"reflect"
+	"testing"
+
+	http "github.com/sardanioss/http"
+)
+
+func TestDuplicateHeaders(t *testing.T) {
+	header := http.Header{}
+	header.Add("Set-Cookie", "a=1; Expires=Wed, 21 Oct 2026 07:28:00 GMT")
+	header.Add("Set-Cookie", "b=2")
+	header.Add("Vary", "Accept-Encoding")
+	header.Add("Vary", "Origin")
+	headers := buildHeadersMap(header)
+
+	// Every line is kept, cookies never joined
+	if got := headers["set-cookie"]; len(got) != 2 || got[1] != "b=2" {
+		t.Fatalf("set-cookie = %q", got)
+	}
+
+	tests := []struct {
+		policy       DuplicateHeaders
+		vary, cookie string
+	}{
+		{DuplicateHeadersFirst, "Accept-Encoding", "a=1; Expires=Wed, 21 Oct 2026 07:28:00 GMT"},
+		{DuplicateHeadersMerge, "Accept-Encoding, Origin", "a=1; Expires=Wed, 21 Oct 2026 07:28:00 GMT"},
+		{DuplicateHeadersLast, "Origin", "b=2"},
+	}
+	for _, tt := range tests {
+		resp := &Response{Headers: headers, HeaderPolicy: tt.policy}
+		if got := resp.GetHeader("Vary"); got != tt.vary {
+			t.Errorf("%s: Vary = %q", tt.policy, got)
+		}
+		if got := resp.GetHeader("Set-Cookie"); got != tt.cookie {
+			t.Errorf("%s: Set-Cookie = %q", tt.policy, got)
+		}
+		if p, err := ParseDuplicateHeaders(tt.policy.String()); err != nil || p != tt.policy {
+			t.Errorf("%s: parsed as %v, %v", tt.policy, p, err)
+		}
+	}
+
+	want := map[string]string{"vary": "Accept-Encoding, Origin"}
+	if got := MergeHeaders(headers); !reflect.DeepEqual(got, want) {
+		t.Errorf("MergeHeaders = %q", got)
+	}
+}
@@ -0,0 +1,197 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"time"
+)
+
+// hedgeResult carries the outcome of one leg of a hedged request
+type hedgeResult struct {
+	resp   *Response
+	err    error
+	hedged bool
+}
+
+// DoHedged executes req like Do, but if no response has arrived after delay a
+// duplicate is sent on a different connection. The first successful response
+// wins and the other leg is cancelled.
+//
+// The duplicate goes over a different protocol than the primary when the
+// transport is in auto mode (H3 <-> H2, or a fresh HTTP/1.1 connection when
+// QUIC isn't usable), so it never queues behind the same stalled connection.
+// With a forced protocol it uses that protocol; for HTTP/2 and HTTP/3 this
+// means a second stream on the pooled connection.
+//
+// A streaming BodyReader is buffered so both legs can send it; a BodySource
+// is opened by each leg instead. Callers are
+// responsible for only hedging requests that are safe to send twice.
+func (t *Transport) DoHedged(ctx context.Context, req *Request, delay time.Duration) (*Response, error) {
+	if delay <= 0 {
+		return t.Do(ctx, req)
+	}
+	if err := t.hostFilter.Check(extractHost(req.URL)); err != nil {
+		return nil, err
+	}
+	if err := t.checkAddresses(ctx, extractHost(req.URL)); err != nil {
+		return nil, err
+	}
+	if req.BodyReader != nil && req.BodySource == nil {
+		body, err := io.ReadAll(req.BodyReader)
+		if err != nil {
+			return nil, NewRequestError("read_body", "", "", "", err)
+		}
+		buffered := *req
+		buffered.Body = body
+		buffered.BodyReader = nil
+		req = &buffered
+	}
+
+	hedgeReq := t.hedgeRequest(req)
+	return raceHedge(ctx, delay,
+		func(ctx context.Context) (*Response, error) {
+			return t.Do(ctx, req)
+		},
+		func(ctx context.Context) (*Response, error) {
+			// Picked when the hedge fires, from what the primary leg learned
+			return t.doProtocol(ctx, hedgeReq, t.hedgeProtocol(req.URL))
+		})
+}
+
+// raceHedge runs primary, and hedge too if primary hasn't answered after
+// delay. The first success is returned and the other leg is cancelled; a
+// response it still produces is closed, so its buffered body is released.
+func raceHedge(ctx context.Context, delay time.Duration, primary, hedge func(context.Context) (*Response, error)) (*Response, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // Cancels whichever leg is still running
+
+	results := make(chan hedgeResult, 2)
+	go func() {
+		resp, err := primary(ctx)
+		results <- hedgeResult{resp: resp, err: err}
+	}()
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	inFlight := 1
+	var firstErr error
+	for {
+		select {
+		case <-timer.C:
+			inFlight++
+			go func() {
+				resp, err := hedge(ctx)
+				results <- hedgeResult{resp: resp, err: err, hedged: true}
+			}()
+
+		case r := <-results:
+			inFlight--
+			if r.err == nil {
+				closeHedgeLosers(results, inFlight)
+				r.resp.Hedged = r.hedged
+				return r.resp, nil
+			}
+			if firstErr == nil {
+				firstErr = r.err
+			}
+			if inFlight == 0 {
+				// Both legs failed, or the primary failed before the hedge
+				// fired - hedging is not a hidden retry
+				return nil, firstErr
+			}
+
+		case <-ctx.Done():
+			closeHedgeLosers(results, inFlight)
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// closeHedgeLosers waits in the background for the n legs still running
+// and closes any response they return
+func closeHedgeLosers(results <-chan hedgeResult, n int) {
+	if n == 0 {
+		return
+	}
+	go func() {
+		for i := 0; i < n; i++ {
+			if r := <-results; r.resp != nil {
+				r.resp.Close()
+			}
+		}
+	}()
+}
+
+// hedgeRequest copies req for the duplicate leg so the two legs never share
+// a header map.
+func (t *Transport) hedgeRequest(req *Request) *Request {
+	dup := *req
+	dup.Headers = make(map[string][]string, len(req.Headers))
+	for k, v := range req.Headers {
+		dup.Headers[k] = append([]string(nil), v...)
+	}
+	return &dup
+}
+
+// hedgeProtocol picks the protocol for the duplicate leg of a request to
+// rawURL: the opposite of what the primary leg will use, where possible.
+func (t *Transport) hedgeProtocol(rawURL string) Protocol {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Scheme == "http" {
+		return ProtocolHTTP1
+	}
+	if p := t.protocolFor(parsed.Hostname()); p != ProtocolAuto {
+		return p
+	}
+
+	if p, ok := t.knownProtocol(parsed.Hostname()); ok && p == ProtocolHTTP3 {
+		return ProtocolHTTP2
+	}
+	if t.hedgeCanUseQUIC() && !t.h3Failed(parsed.Hostname()) {
+		return ProtocolHTTP3
+	}
+	// H1 transport opens a new connection for a concurrent request
+	return ProtocolHTTP1
+}
+
+// hedgeCanUseQUIC reports whether an HTTP/3 leg could be attempted at all.
+func (t *Transport) hedgeCanUseQUIC() bool {
+	if !quicSupported || t.preset == nil || !t.preset.SupportHTTP3 || t.h3ProxyError != nil {
+		return false
+	}
+	if t.proxy == nil {
+		return true
+	}
+	udpProxy := t.proxy.UDPProxy
+	if udpProxy == "" {
+		udpProxy = t.proxy.URL
+	}
+	if udpProxy == "" {
+		// Only a TCP proxy configured - H3 would bypass it
+		return t.proxy.TCPProxy == ""
+	}
+	return SupportsQUIC(udpProxy)
+}
+
+// doProtocol executes req over a specific protocol, bypassing auto selection.
+func (t *Transport) doProtocol(ctx context.Context, req *Request, p Protocol) (*Response, error) {
+	if resp, ok, err := t.doPlatform(ctx, req); ok {
+		return resp, err
+	}
+	switch p {
+	case ProtocolHTTP1:
+		return t.doHTTP1(ctx, req)
+	case ProtocolHTTP3:
+		return t.doHTTP3(ctx, req)
+	default:
+		resp, err := t.doHTTP2(ctx, req)
+		var alpnErr *ALPNMismatchError
+		if err != nil && errors.As(err, &alpnErr) {
+			return t.doHTTP1WithTLSConn(ctx, req, alpnErr)
+		}
+		return resp, err
+	}
+}
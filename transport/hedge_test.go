@@ -0,0 +1,112 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// closeTracker is a response body that reports its Close
+type closeTracker struct {
+	io.Reader
+	closed chan struct{}
+}
+
+func (b *closeTracker) Close() error {
+	close(b.closed)
+	return nil
+}
+
+func hedgeResponse(body string) (*Response, *closeTracker) {
+	tracker := &closeTracker{Reader: strings.NewReader(body), closed: make(chan struct{})}
+	return &Response{StatusCode: 200, Body: tracker}, tracker
+}
+
+func TestRaceHedgeFirstSuccessWins(t *testing.T) {
+	primary := func(ctx context.Context) (*Response, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	hedge := func(ctx context.Context) (*Response, error) {
+		resp, _ := hedgeResponse("hedge")
+		return resp, nil
+	}
+	resp, err := raceHedge(context.Background(), 10*time.Millisecond, primary, hedge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Hedged {
+		t.Error("winning duplicate not marked Hedged")
+	}
+
+	// A primary answering before the delay never starts the duplicate
+	hedged := make(chan struct{}, 1)
+	primary = func(ctx context.Context) (*Response, error) {
+		resp, _ := hedgeResponse("primary")
+		return resp, nil
+	}
+	hedge = func(ctx context.Context) (*Response, error) {
+		hedged <- struct{}{}
+		return nil, errors.New("unexpected duplicate")
+	}
+	resp, err = raceHedge(context.Background(), time.Hour, primary, hedge)
+	if err != nil || resp.Hedged {
+		t.Fatalf("resp.Hedged = %v, err = %v", resp != nil && resp.Hedged, err)
+	}
+	select {
+	case <-hedged:
+		t.Error("duplicate sent although the primary answered in time")
+	default:
+	}
+}
+
+func TestRaceHedgeBothLegsFail(t *testing.T) {
+	errPrimary := errors.New("primary failed")
+	primary := func(ctx context.Context) (*Response, error) {
+		time.Sleep(30 * time.Millisecond)
+		return nil, errPrimary
+	}
+	hedge := func(ctx context.Context) (*Response, error) {
+		return nil, errors.New("duplicate failed")
+	}
+	_, err := raceHedge(context.Background(), 10*time.Millisecond, primary, hedge)
+	if err == nil || err.Error() != "duplicate failed" {
+		t.Errorf("err = %v, want the first error to arrive", err)
+	}
+
+	// A primary failing before the delay is not retried by the duplicate
+	_, err = raceHedge(context.Background(), time.Hour, func(ctx context.Context) (*Response, error) {
+		return nil, errPrimary
+	}, hedge)
+	if !errors.Is(err, errPrimary) {
+		t.Errorf("err = %v, want %v", err, errPrimary)
+	}
+}
+
+func TestRaceHedgeClosesLoser(t *testing.T) {
+	loser, tracker := hedgeResponse("late")
+	primary := func(ctx context.Context) (*Response, error) {
+		<-ctx.Done()
+		// The response was already on its way when the leg was cancelled
+		return loser, nil
+	}
+	hedge := func(ctx context.Context) (*Response, error) {
+		resp, _ := hedgeResponse("hedge")
+		return resp, nil
+	}
+	resp, err := raceHedge(context.Background(), 10*time.Millisecond, primary, hedge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == loser {
+		t.Fatal("late response won")
+	}
+	select {
+	case <-tracker.closed:
+	case <-time.After(time.Second):
+		t.Error("losing leg's response was never closed")
+	}
+}
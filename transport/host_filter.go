@@ -0,0 +1,67 @@
+package transport
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrHostBlocked is matched (errors.Is) by the HostBlockedError of a
+// request to a host the allow and block lists exclude
+var ErrHostBlocked = errors.New("host blocked")
+
+// HostBlockedError is returned for a request, redirect or warmup
+// subresource to a blocked host. Nothing is sent to it.
+type HostBlockedError struct {
+	Host string
+}
+
+func (e *HostBlockedError) Error() string {
+	return "host blocked: " + e.Host
+}
+
+// Is makes errors.Is(err, ErrHostBlocked) match
+func (e *HostBlockedError) Is(target error) bool {
+	return target == ErrHostBlocked
+}
+
+// HostFilter scopes requests to some hosts. Patterns are matched like
+// header rule hosts: "example.com" includes its subdomains and "*" matches
+// every host.
+type HostFilter struct {
+	// Allowed, if set, lists the only hosts requests may go to
+	Allowed []string
+
+	// Blocked lists hosts requests never go to, even if allowed
+	Blocked []string
+}
+
+// Check returns a *HostBlockedError if the filter excludes host. Safe on a
+// nil filter.
+func (f *HostFilter) Check(host string) error {
+	if f == nil {
+		return nil
+	}
+	if hostMatchesAny(host, f.Blocked) || (len(f.Allowed) > 0 && !hostMatchesAny(host, f.Allowed)) {
+		return &HostBlockedError{Host: host}
+	}
+	return nil
+}
+
+// hostMatchesAny reports whether host is one of patterns or a subdomain of
+// one
+func hostMatchesAny(host string, patterns []string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, h := range patterns {
+		h = strings.ToLower(strings.TrimSuffix(strings.TrimPrefix(h, "*."), "."))
+		if h == "*" || host == h || strings.HasSuffix(host, "."+h) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetHostFilter scopes the transport's requests (see HostFilter). nil
+// removes the filter.
+func (t *Transport) SetHostFilter(f *HostFilter) {
+	t.hostFilter = f
+}
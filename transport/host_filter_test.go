@@ -0,0 +1,35 @@
+package transport
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestHostFilter(t *testing.T) {
+	f := &HostFilter{Allowed: []string{"example.com", "*.cdn.test"}, Blocked: []string{"ads.example.com"}}
+	for host, allowed := range map[string]bool{
+		"example.com":       true,
+		"www.example.com":   true,
+		"img.cdn.test":      true,
+		"ads.example.com":   false,
+		"x.ads.example.com": false,
+		"webhook.site":      false,
+		"notexample.com":    false,
+	} {
+		err := f.Check(host)
+		if (err == nil) != allowed {
+			t.Errorf("%s: %v", host, err)
+		}
+		if err != nil && !errors.Is(err, ErrHostBlocked) {
+			t.Errorf("%s: %v is not ErrHostBlocked", host, err)
+		}
+	}
+
+	var none *HostFilter
+	if err := none.Check("anything.test"); err != nil {
+		t.Errorf("nil filter: %v", err)
+	}
+	if err := (&HostFilter{Blocked: []string{"tracker.test"}}).Check("example.com"); err != nil {
+		t.Errorf("block list only: %v", err)
+	}
+}
@@ -0,0 +1,65 @@
+package transport
+
+import (
+	"bufio"
+	"fmt"
+	"net/url"
+	"strings"
+
+	http "github.com/sardanioss/http"
+	"github.com/sardanioss/httpcloak/proxy"
+)
+
+// Plain http:// requests through an HTTP proxy aren't tunneled: like a
+// browser, the transport sends them to the proxy in absolute form
+// ("GET http://host/path HTTP/1.1") with Proxy-Connection: keep-alive, and
+// pools the connections per proxy, shared by every origin, apart from the
+// tunnels to https:// origins.
+
+// forwardsThroughProxy reports whether requests with scheme are forwarded
+// to the proxy rather than tunneled through it
+func (t *HTTP1Transport) forwardsThroughProxy(scheme string) bool {
+	return scheme == "http" && t.proxy != nil && t.proxy.URL != "" && !proxy.IsSOCKS5URL(t.proxy.URL)
+}
+
+// proxyPoolKey is the pool key of the connections forwarding to the proxy
+func (t *HTTP1Transport) proxyPoolKey() string {
+	return "proxy://" + proxyHostPort(t.proxy.URL)
+}
+
+// absoluteRequestURI returns the absolute-form request target of req,
+// without credentials or fragment
+func absoluteRequestURI(req *http.Request) string {
+	u := *req.URL
+	u.User = nil
+	u.Fragment = ""
+	u.RawFragment = ""
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	return u.String()
+}
+
+// writeProxyHeaders writes the headers meant for the proxy: the keep-alive
+// browsers send, unless req sets its own, and, unless a handshake set one,
+// Basic credentials
+func (t *HTTP1Transport) writeProxyHeaders(w *bufio.Writer, req *http.Request) {
+	if req.Header.Get("Proxy-Connection") == "" && !strings.EqualFold(req.Header.Get("Connection"), "close") {
+		w.WriteString("Proxy-Connection: keep-alive\r\n")
+	}
+	if req.Header.Get("Proxy-Authorization") != "" {
+		return
+	}
+	if proxyURL, err := url.Parse(t.proxy.URL); err == nil {
+		if auth := t.getProxyAuth(proxyURL); auth != "" {
+			fmt.Fprintf(w, "Proxy-Authorization: Basic %s\r\n", auth)
+		}
+	}
+}
+
+// applyProxyConnection honours a forwarding proxy's Proxy-Connection: close
+func applyProxyConnection(resp *http.Response) {
+	if strings.EqualFold(resp.Header.Get("Proxy-Connection"), "close") {
+		resp.Close = true
+	}
+}
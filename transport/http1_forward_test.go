@@ -0,0 +1,31 @@
+package transport
+
+import (
+	"testing"
+
+	http "github.com/sardanioss/http"
+)
+
+func TestAbsoluteRequestURI(t *testing.T) {
+	for raw, want := range map[string]string{
+		"http://example.com":                    "http://example.com/",
+		"http://example.com?q=1":                "http://example.com/?q=1",
+		"http://user:pw@example.com:8080/a?b#c": "http://example.com:8080/a?b",
+	} {
+		req, err := http.NewRequest("GET", raw, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := absoluteRequestURI(req); got != want {
+			t.Errorf("%s: got %s, want %s", raw, got, want)
+		}
+	}
+}
+
+func TestApplyProxyConnection(t *testing.T) {
+	resp := &http.Response{Header: http.Header{"Proxy-Connection": {"close"}}}
+	applyProxyConnection(resp)
+	if !resp.Close {
+		t.Error("Proxy-Connection: close did not close the connection")
+	}
+}
@@ -9,8 +9,10 @@ import (
 	"net"
 	"net/textproto"
 	"net/url"
+	"runtime"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	http "github.com/sardanioss/http"
@@ -33,17 +35,23 @@ type HTTP1Transport struct {
 	// Connection pool
 	idleConns   map[string][]*http1Conn
 	idleConnsMu sync.Mutex
+	conns       *connTracker // Every open connection, idle or not
 
 	// TLS session cache for resumption
 	sessionCache utls.ClientSessionCache
 
+	// ticketPartition scopes sessionCache to the current egress (see TicketIsolation)
+	ticketPartition string
+
 	// Configuration
 	maxIdleConnsPerHost int
 	maxIdleTime         time.Duration
+	maxConnAge          time.Duration // 0 for no limit
 	connectTimeout      time.Duration
 	responseTimeout     time.Duration
 	insecureSkipVerify  bool
 	localAddr           string // Local IP to bind outgoing connections
+	drainLimit          atomic.Int64
 
 	// Cleanup
 	stopCleanup chan struct{}
@@ -64,6 +72,8 @@ type http1Conn struct {
 	useCount   int64
 	mu         sync.Mutex
 	closed     bool
+	viaProxy   bool   // Forwards absolute-form requests to an HTTP proxy
+	release    func() // Called once closed (see connTracker)
 }
 
 // NewHTTP1Transport creates a new HTTP/1.1 transport with uTLS
@@ -104,17 +114,35 @@ func NewHTTP1TransportWithConfig(preset *fingerprint.Preset, dnsCache *dns.Cache
 		responseTimeout:     60 * time.Second,
 		stopCleanup:         make(chan struct{}),
 	}
+	t.drainLimit.Store(DefaultDrainLimit)
 
 	// Apply localAddr from config
 	if config != nil && config.LocalAddr != "" {
 		t.localAddr = config.LocalAddr
 	}
 
+	pool := config.pool()
+	if pool.MaxIdleConnsPerHost > 0 {
+		t.maxIdleConnsPerHost = pool.MaxIdleConnsPerHost
+	}
+	if pool.IdleConnTimeout > 0 {
+		t.maxIdleTime = pool.IdleConnTimeout
+	}
+	t.maxConnAge = pool.MaxConnLifetime
+	t.conns = newConnTracker(pool.MaxConnsPerHost)
+
 	go t.cleanupLoop()
 
 	return t
 }
 
+// SetDrainLimit sets how many unread body bytes closing a response will
+// drain to keep its connection (default DefaultDrainLimit). 0 closes the
+// connection instead whenever a body is closed before EOF.
+func (t *HTTP1Transport) SetDrainLimit(limit int64) {
+	t.drainLimit.Store(limit)
+}
+
 // SetConnectTo sets a host mapping for domain fronting
 func (t *HTTP1Transport) SetConnectTo(requestHost, connectHost string) {
 	if t.config == nil {
@@ -174,24 +202,17 @@ func (t *HTTP1Transport) RoundTrip(req *http.Request) (*http.Response, error) {
 		}
 	}
 
-	// Use connect host for pool key (domain fronting: multiple request hosts share one connection)
-	connectHost := t.getConnectHost(host)
-	key := fmt.Sprintf("%s://%s:%s", scheme, connectHost, port)
+	key := t.poolKey(scheme, host, port)
 
 	// Try to get an idle connection
 	conn, err := t.getIdleConn(key)
 	if err == nil && conn != nil {
+		ContextClientTrace(req.Context()).connectionReused("h1", key)
 		resp, err := t.doRequest(conn, req)
 		if err == nil {
 			// Wrap the body to handle connection lifecycle
 			// Connection will be returned to pool or closed when body is fully read
-			resp.Body = &pooledBodyWrapper{
-				body:      resp.Body,
-				conn:      conn,
-				key:       key,
-				transport: t,
-				keepAlive: t.shouldKeepAlive(req, resp),
-			}
+			t.wrapPooledBody(req, resp, conn, key)
 			return resp, nil
 		}
 		// Connection failed, close it and try new one
@@ -199,7 +220,7 @@ func (t *HTTP1Transport) RoundTrip(req *http.Request) (*http.Response, error) {
 	}
 
 	// Create new connection (pass request host for SNI, connectHost used internally for DNS)
-	conn, err = t.createConn(req.Context(), host, port, scheme)
+	conn, err = t.newConn(req.Context(), key, host, port, scheme)
 	if err != nil {
 		return nil, err
 	}
@@ -211,13 +232,7 @@ func (t *HTTP1Transport) RoundTrip(req *http.Request) (*http.Response, error) {
 	}
 
 	// Wrap the body to handle connection lifecycle
-	resp.Body = &pooledBodyWrapper{
-		body:      resp.Body,
-		conn:      conn,
-		key:       key,
-		transport: t,
-		keepAlive: t.shouldKeepAlive(req, resp),
-	}
+	t.wrapPooledBody(req, resp, conn, key)
 
 	return resp, nil
 }
@@ -269,49 +284,100 @@ func (t *HTTP1Transport) RoundTripWithTLSConn(req *http.Request, tlsConn *utls.U
 }
 
 // pooledBodyWrapper wraps response body to return connection to pool when done.
-// Uses sync.Once to safely handle concurrent Read(EOF) and Close().
+// Closing a body that wasn't read to the end drains it in the background if
+// it's small enough (see SetDrainLimit) and closes the connection otherwise.
+// A body dropped without Close is released the same way once it's garbage
+// collected, so an abandoned response doesn't hold its connection forever.
 type pooledBodyWrapper struct {
-	body      io.ReadCloser
-	conn      *http1Conn
-	key       string
-	transport *HTTP1Transport
-	keepAlive bool
-	once      sync.Once
+	*pooledBody
+}
+
+// pooledBody is the wrapper's state, kept apart so the cleanup attached to
+// the wrapper can reach it without keeping the wrapper alive
+type pooledBody struct {
+	body          io.ReadCloser
+	conn          *http1Conn
+	key           string
+	transport     *HTTP1Transport
+	keepAlive     bool
+	contentLength int64
+	read          int64
+	eof           bool
+	once          sync.Once // Returns or closes the connection
+	closeOnce     sync.Once
+}
+
+func (t *HTTP1Transport) wrapPooledBody(req *http.Request, resp *http.Response, conn *http1Conn, key string) {
+	w := &pooledBodyWrapper{&pooledBody{
+		body:          resp.Body,
+		conn:          conn,
+		key:           key,
+		transport:     t,
+		keepAlive:     t.shouldKeepAlive(req, resp),
+		contentLength: resp.ContentLength,
+	}}
+	runtime.AddCleanup(w, (*pooledBody).release, w.pooledBody)
+	resp.Body = w
 }
 
 func (w *pooledBodyWrapper) Read(p []byte) (n int, err error) {
 	n, err = w.body.Read(p)
+	w.read += int64(n)
 	if err == io.EOF {
+		w.eof = true
 		w.handleClose()
 	}
 	return n, err
 }
 
 func (w *pooledBodyWrapper) Close() error {
-	// Close body first to drain remaining data, THEN return conn to pool.
-	// Reversing this order causes a race: conn goes back to pool while
-	// body.Close() is still draining from the same underlying bufio.Reader.
-	err := w.body.Close()
-	if err != nil {
-		// Body drain failed (e.g., deadline hit on large response).
-		// Connection's bufio.Reader is mid-body — don't pool it.
-		w.once.Do(func() { w.conn.close() })
-		return err
-	}
-	w.handleClose()
+	w.release()
 	return nil
 }
 
-func (w *pooledBodyWrapper) handleClose() {
-	w.once.Do(func() {
+// release gives the connection back: straight away if the body was read to
+// the end, after a background drain if what's left fits the drain limit.
+// Anything else closes the connection.
+func (b *pooledBody) release() {
+	b.closeOnce.Do(func() {
+		// Close the body before returning the conn to the pool: body.Close()
+		// reads the chunked trailer from the same bufio.Reader. A body read
+		// up to its Content-Length closes without I/O.
+		if b.eof || b.read == b.contentLength {
+			if b.body.Close() != nil {
+				b.once.Do(b.conn.close)
+				return
+			}
+			b.handleClose()
+			return
+		}
+		limit := b.transport.drainLimit.Load()
+		if !b.keepAlive || limit <= 0 || b.contentLength > limit {
+			b.once.Do(b.conn.close)
+			return
+		}
+		go func() {
+			b.conn.conn.SetReadDeadline(time.Now().Add(drainTimeout))
+			if drainBody(b.body, limit) && b.body.Close() == nil {
+				b.handleClose()
+				return
+			}
+			// Still mid-body: the connection can't carry another request
+			b.once.Do(b.conn.close)
+		}()
+	})
+}
+
+func (b *pooledBody) handleClose() {
+	b.once.Do(func() {
 		// Clear deadline before returning conn to pool — the next request
 		// will set its own deadline. Without this, the stale deadline from
 		// the previous request would fire during the next request's I/O.
-		w.conn.conn.SetDeadline(time.Time{})
-		if w.keepAlive {
-			w.transport.putIdleConn(w.key, w.conn)
+		b.conn.conn.SetDeadline(time.Time{})
+		if b.keepAlive {
+			b.transport.putIdleConn(b.key, b.conn)
 		} else {
-			w.conn.close()
+			b.conn.close()
 		}
 	})
 }
@@ -327,9 +393,10 @@ func (w *streamBodyWrapper) Read(p []byte) (n int, err error) {
 }
 
 func (w *streamBodyWrapper) Close() error {
-	err := w.body.Close()
+	// The connection goes first: closing the body waits for a Read in
+	// progress, which only a closed connection interrupts
 	w.conn.close()
-	return err
+	return w.body.Close()
 }
 
 // StreamRoundTrip performs an HTTP request for streaming - connection is NOT pooled
@@ -361,7 +428,7 @@ func (t *HTTP1Transport) StreamRoundTrip(req *http.Request) (*http.Response, err
 	}
 
 	// Create new connection (don't use pool for streaming)
-	conn, err := t.createConn(req.Context(), host, port, scheme)
+	conn, err := t.newConn(req.Context(), t.poolKey(scheme, host, port), host, port, scheme)
 	if err != nil {
 		return nil, err
 	}
@@ -390,16 +457,26 @@ func (t *HTTP1Transport) createConn(ctx context.Context, host, port, scheme stri
 	// Use connect host for DNS resolution and proxy CONNECT (may differ for domain fronting)
 	connectHost := t.getConnectHost(host)
 	targetAddr := net.JoinHostPort(connectHost, port)
+	trace := ContextClientTrace(ctx)
 
 	if t.proxy != nil && t.proxy.URL != "" {
-		rawConn, err = t.dialThroughProxy(ctx, connectHost, port)
+		proxyAddr := proxyHostPort(t.proxy.URL)
+		trace.connectStart("tcp", proxyAddr)
+		if t.forwardsThroughProxy(scheme) {
+			rawConn, _, err = t.dialHTTPProxy(ctx)
+		} else {
+			rawConn, err = t.dialThroughProxy(ctx, connectHost, port)
+		}
+		trace.connectDone("tcp", proxyAddr, err)
 		if err != nil {
 			return nil, NewProxyError("dial_proxy", host, port, err)
 		}
 	} else {
 		// Direct connection with DNS resolution and IPv4/IPv6 fallback
 		// Resolve connectHost (may be different from request host for domain fronting)
+		trace.dnsStart(connectHost)
 		ips, err := t.dnsCache.ResolveAllSorted(ctx, connectHost)
+		trace.dnsDone(ips, err)
 		if err != nil {
 			return nil, NewDNSError(host, err)
 		}
@@ -443,7 +520,9 @@ func (t *HTTP1Transport) createConn(ctx context.Context, host, port, scheme stri
 			}
 			addr := net.JoinHostPort(ip.String(), port)
 
+			trace.connectStart(network, addr)
 			rawConn, err = dialer.DialContext(ctx, network, addr)
+			trace.connectDone(network, addr, err)
 			if err == nil {
 				break // Connection successful
 			}
@@ -471,6 +550,7 @@ func (t *HTTP1Transport) createConn(ctx context.Context, host, port, scheme stri
 		conn:       rawConn,
 		createdAt:  time.Now(),
 		lastUsedAt: time.Now(),
+		viaProxy:   t.forwardsThroughProxy(scheme),
 	}
 
 	// For HTTPS, wrap with uTLS
@@ -488,17 +568,34 @@ func (t *HTTP1Transport) createConn(ctx context.Context, host, port, scheme stri
 			InsecureSkipVerify:                 t.insecureSkipVerify,
 			MinVersion:                         tls.VersionTLS12,
 			MaxVersion:                         tls.VersionTLS13,
-			ClientSessionCache:                 t.sessionCache,
+			ClientSessionCache:                 t.ticketCache(),
 			NextProtos:                         []string{"http/1.1"}, // Force HTTP/1.1 only
 			PreferSkipResumptionOnNilExtension: true,                 // Skip resumption if spec has no PSK extension
 			KeyLogWriter:                       keyLogWriter,
 		}
+		t.config.applyHostTLS(tlsConfig, host)
 
 		// For HTTP/1.1 transport, use ClientHelloID or Custom Spec if available
 		var tlsConn *utls.UConn
 		if t.preset.CustomClientHelloSpec != nil {
+			spec := t.preset.CustomClientHelloSpec()
+			t.config.applyClientHelloSpecHook(t.preset, spec)
 			tlsConn = utls.UClient(rawConn, tlsConfig, utls.HelloCustom)
-			if err := tlsConn.ApplyPreset(t.preset.CustomClientHelloSpec()); err != nil {
+			if err := tlsConn.ApplyPreset(spec); err != nil {
+				rawConn.Close()
+				return nil, NewTLSError("apply_preset", host, port, "h1", err)
+			}
+		} else if (t.config != nil && t.config.ClientHelloSpecHook != nil) || !t.preset.SignatureRules().Keep {
+			// Pinned signature algorithms and the spec hook need a concrete
+			// spec to work on - expand the ClientHelloID
+			spec, err := utls.UTLSIdToSpec(t.preset.ClientHelloID)
+			if err != nil {
+				rawConn.Close()
+				return nil, NewTLSError("build_spec", host, port, "h1", err)
+			}
+			t.config.applyClientHelloSpecHook(t.preset, &spec)
+			tlsConn = utls.UClient(rawConn, tlsConfig, utls.HelloCustom)
+			if err := tlsConn.ApplyPreset(&spec); err != nil {
 				rawConn.Close()
 				return nil, NewTLSError("apply_preset", host, port, "h1", err)
 			}
@@ -506,7 +603,7 @@ func (t *HTTP1Transport) createConn(ctx context.Context, host, port, scheme stri
 			// Note: ClientHelloID includes ALPN with [h2, http/1.1], so we must modify it
 			tlsConn = utls.UClient(rawConn, tlsConfig, t.preset.ClientHelloID)
 		}
-		tlsConn.SetSessionCache(t.sessionCache)
+		tlsConn.SetSessionCache(t.ticketCache())
 
 		// Build handshake state first - this populates Extensions from ClientHelloID
 		if err := tlsConn.BuildHandshakeState(); err != nil {
@@ -523,6 +620,7 @@ func (t *HTTP1Transport) createConn(ctx context.Context, host, port, scheme stri
 			}
 		}
 
+		trace.tlsHandshakeStart()
 		if err := tlsConn.HandshakeContext(ctx); err != nil {
 			rawConn.Close()
 
@@ -538,7 +636,7 @@ func (t *HTTP1Transport) createConn(ctx context.Context, host, port, scheme stri
 
 				// Redo TLS setup on the clean connection
 				tlsConn = utls.UClient(rawConn, tlsConfig, t.preset.ClientHelloID)
-				tlsConn.SetSessionCache(t.sessionCache)
+				tlsConn.SetSessionCache(t.ticketCache())
 				if buildErr := tlsConn.BuildHandshakeState(); buildErr != nil {
 					rawConn.Close()
 					return nil, NewTLSError("build_handshake", host, port, "h1", buildErr)
@@ -551,15 +649,19 @@ func (t *HTTP1Transport) createConn(ctx context.Context, host, port, scheme stri
 				}
 				if hsErr := tlsConn.HandshakeContext(ctx); hsErr != nil {
 					rawConn.Close()
+					trace.tlsHandshakeDone(TLSHandshakeInfo{ServerName: host}, hsErr)
 					return nil, NewTLSError("tls_handshake", host, port, "h1", hsErr)
 				}
 
 				// Update conn to use new rawConn
 				conn.conn = rawConn
 			} else {
+				trace.tlsHandshakeDone(TLSHandshakeInfo{ServerName: host}, err)
 				return nil, NewTLSError("tls_handshake", host, port, "h1", err)
 			}
 		}
+		trace.tlsHandshakeDone(tlsInfo(tlsConn.ConnectionState()), nil)
+		t.config.onConnection(connInfo(host, port, "h1", tlsConn.ConnectionState()))
 
 		conn.tlsConn = tlsConn
 		conn.conn = tlsConn
@@ -608,45 +710,9 @@ func (t *HTTP1Transport) dialThroughSOCKS5(ctx context.Context, targetHost, targ
 // By default, uses speculative TLS: sends CONNECT + ClientHello together to save one round-trip.
 // Can be disabled via TransportConfig.DisableSpeculativeTLS.
 func (t *HTTP1Transport) dialThroughHTTPProxy(ctx context.Context, targetHost, targetPort string) (net.Conn, error) {
-	proxyURL, err := url.Parse(t.proxy.URL)
-	if err != nil {
-		return nil, fmt.Errorf("invalid proxy URL: %w", err)
-	}
-
-	proxyHost := proxyURL.Hostname()
-	proxyPort := proxyURL.Port()
-	if proxyPort == "" {
-		if proxyURL.Scheme == "https" {
-			proxyPort = "443"
-		} else {
-			proxyPort = "8080"
-		}
-	}
-
-	// Pre-resolve proxy hostname using CGO-compatible resolver
-	// Required for shared library usage where Go's pure-Go resolver doesn't work
-	resolver := &net.Resolver{PreferGo: false}
-	proxyIPs, err := resolver.LookupHost(ctx, proxyHost)
-	if err != nil {
-		return nil, fmt.Errorf("failed to resolve proxy host %s: %w", proxyHost, err)
-	}
-	if len(proxyIPs) == 0 {
-		return nil, fmt.Errorf("no IP addresses found for proxy host %s", proxyHost)
-	}
-
-	dialer := &net.Dialer{
-		Timeout:   t.connectTimeout,
-		KeepAlive: 30 * time.Second,
-	}
-	if t.localAddr != "" {
-		dialer.LocalAddr = &net.TCPAddr{IP: net.ParseIP(t.localAddr)}
-	}
-
-	// Dial using resolved IP to avoid DNS lookup in net.Dialer
-	proxyAddr := net.JoinHostPort(proxyIPs[0], proxyPort)
-	conn, err := dialer.DialContext(ctx, "tcp", proxyAddr)
+	conn, proxyURL, err := t.dialHTTPProxy(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to proxy: %w", err)
+		return nil, err
 	}
 
 	// Build CONNECT request
@@ -662,7 +728,7 @@ func (t *HTTP1Transport) dialThroughHTTPProxy(ctx context.Context, targetHost, t
 	connectReq += "Connection: keep-alive\r\n\r\n"
 
 	// Check if speculative TLS is disabled (explicitly or via blocklist)
-	if (t.config != nil && t.config.DisableSpeculativeTLS) || IsProxyNoSpeculative(t.proxy.URL) {
+	if (t.config != nil && (t.config.DisableSpeculativeTLS || t.config.ProxyAuth != nil)) || IsProxyNoSpeculative(t.proxy.URL) {
 		// Traditional flow: send CONNECT, wait for 200 OK, then return conn for TLS
 		return t.dialHTTPProxyBlocking(ctx, conn, connectReq)
 	}
@@ -672,13 +738,12 @@ func (t *HTTP1Transport) dialThroughHTTPProxy(ctx context.Context, targetHost, t
 	return NewSpeculativeConn(conn, connectReq), nil
 }
 
-// dialHTTPProxyBlockingFresh opens a new TCP connection to the proxy and performs
-// the traditional blocking CONNECT flow. Used as fallback when speculative TLS fails
-// and the original connection is corrupted.
-func (t *HTTP1Transport) dialHTTPProxyBlockingFresh(ctx context.Context, targetHost, targetPort string) (net.Conn, error) {
+// dialHTTPProxy opens a connection to the HTTP proxy, over TLS for an
+// https:// proxy
+func (t *HTTP1Transport) dialHTTPProxy(ctx context.Context) (net.Conn, *url.URL, error) {
 	proxyURL, err := url.Parse(t.proxy.URL)
 	if err != nil {
-		return nil, fmt.Errorf("invalid proxy URL: %w", err)
+		return nil, nil, fmt.Errorf("invalid proxy URL: %w", err)
 	}
 
 	proxyHost := proxyURL.Hostname()
@@ -691,13 +756,15 @@ func (t *HTTP1Transport) dialHTTPProxyBlockingFresh(ctx context.Context, targetH
 		}
 	}
 
+	// Pre-resolve proxy hostname using CGO-compatible resolver
+	// Required for shared library usage where Go's pure-Go resolver doesn't work
 	resolver := &net.Resolver{PreferGo: false}
 	proxyIPs, err := resolver.LookupHost(ctx, proxyHost)
 	if err != nil {
-		return nil, fmt.Errorf("failed to resolve proxy host %s: %w", proxyHost, err)
+		return nil, nil, fmt.Errorf("failed to resolve proxy host %s: %w", proxyHost, err)
 	}
 	if len(proxyIPs) == 0 {
-		return nil, fmt.Errorf("no IP addresses found for proxy host %s", proxyHost)
+		return nil, nil, fmt.Errorf("no IP addresses found for proxy host %s", proxyHost)
 	}
 
 	dialer := &net.Dialer{
@@ -708,10 +775,27 @@ func (t *HTTP1Transport) dialHTTPProxyBlockingFresh(ctx context.Context, targetH
 		dialer.LocalAddr = &net.TCPAddr{IP: net.ParseIP(t.localAddr)}
 	}
 
+	// Dial using resolved IP to avoid DNS lookup in net.Dialer
 	proxyAddr := net.JoinHostPort(proxyIPs[0], proxyPort)
 	conn, err := dialer.DialContext(ctx, "tcp", proxyAddr)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to proxy: %w", err)
+		return nil, nil, fmt.Errorf("failed to connect to proxy: %w", err)
+	}
+	if proxyURL.Scheme == "https" {
+		if conn, err = DialProxyTLS(ctx, conn, proxyHost, t.preset, t.insecureSkipVerify); err != nil {
+			return nil, nil, err
+		}
+	}
+	return conn, proxyURL, nil
+}
+
+// dialHTTPProxyBlockingFresh opens a new TCP connection to the proxy and performs
+// the traditional blocking CONNECT flow. Used as fallback when speculative TLS fails
+// and the original connection is corrupted.
+func (t *HTTP1Transport) dialHTTPProxyBlockingFresh(ctx context.Context, targetHost, targetPort string) (net.Conn, error) {
+	conn, proxyURL, err := t.dialHTTPProxy(ctx)
+	if err != nil {
+		return nil, err
 	}
 
 	targetAddr := net.JoinHostPort(targetHost, targetPort)
@@ -749,6 +833,12 @@ func (t *HTTP1Transport) dialHTTPProxyBlocking(ctx context.Context, conn net.Con
 		return nil, fmt.Errorf("failed to read CONNECT response: %w", err)
 	}
 	resp.Body.Close()
+	if t.config != nil {
+		if resp, err = authenticateConnect(conn, br, connectReq, resp, t.config.ProxyAuth, t.proxy.URL, deadline); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
 
 	if resp.StatusCode != http.StatusOK {
 		conn.Close()
@@ -778,6 +868,9 @@ func (c *bufferedConn) Read(p []byte) (int, error) {
 
 // getProxyAuth returns base64-encoded proxy credentials
 func (t *HTTP1Transport) getProxyAuth(proxyURL *url.URL) string {
+	if t.config != nil && t.config.ProxyAuth != nil {
+		return "" // The handshake authenticates instead
+	}
 	username := t.proxy.Username
 	password := t.proxy.Password
 
@@ -821,18 +914,35 @@ func (t *HTTP1Transport) doRequest(conn *http1Conn, req *http.Request) (*http.Re
 	// (body is returned to caller via pooledBodyWrapper). The deadline is
 	// cleared in handleClose() when the body is done and conn returns to pool.
 
+	// Cancelling the request expires the deadline, interrupting the write
+	// and the wait for the response head. Reading the body is left to the
+	// caller to cancel.
+	stop := context.AfterFunc(req.Context(), func() { conn.conn.SetDeadline(time.Now()) })
+	resp, err := t.exchange(conn, req)
+	if !stop() && err != nil {
+		return nil, req.Context().Err()
+	}
+	return resp, err
+}
+
+// exchange writes req on conn and reads the response head
+func (t *HTTP1Transport) exchange(conn *http1Conn, req *http.Request) (*http.Response, error) {
 	// Write request
 	if err := t.writeRequest(conn, req); err != nil {
 		return nil, err
 	}
 
 	// Read response
-	resp, err := http.ReadResponse(conn.br, req)
+	resp, err := readResponse(conn.br, req)
 	if err != nil {
 		return nil, err
 	}
+	if conn.viaProxy {
+		applyProxyConnection(resp)
+	}
 
-	return resp, nil
+	// Answer a connection-bound challenge on this connection
+	return t.authenticate(conn, req, resp)
 }
 
 // writeRequest writes an HTTP/1.1 request with browser-like header ordering
@@ -842,6 +952,9 @@ func (t *HTTP1Transport) writeRequest(conn *http1Conn, req *http.Request) error
 	if uri == "" {
 		uri = "/"
 	}
+	if conn.viaProxy {
+		uri = absoluteRequestURI(req)
+	}
 	fmt.Fprintf(conn.bw, "%s %s HTTP/1.1\r\n", req.Method, uri)
 
 	// Host header first (browser behavior)
@@ -850,6 +963,9 @@ func (t *HTTP1Transport) writeRequest(conn *http1Conn, req *http.Request) error
 		host = req.URL.Host
 	}
 	fmt.Fprintf(conn.bw, "Host: %s\r\n", host)
+	if conn.viaProxy {
+		t.writeProxyHeaders(conn.bw, req)
+	}
 
 	// Determine if we need chunked encoding (unknown content length with body)
 	// http.NoBody is an explicit "no body" sentinel — don't use chunked for it
@@ -1065,6 +1181,10 @@ func (t *HTTP1Transport) writeHeadersInOrder(w *bufio.Writer, req *http.Request,
 
 // shouldKeepAlive determines if connection should be reused
 func (t *HTTP1Transport) shouldKeepAlive(req *http.Request, resp *http.Response) bool {
+	if resp.Close {
+		return false
+	}
+
 	// Check response Connection header
 	if strings.EqualFold(resp.Header.Get("Connection"), "close") {
 		return false
@@ -1080,14 +1200,25 @@ func (t *HTTP1Transport) shouldKeepAlive(req *http.Request, resp *http.Response)
 		return true
 	}
 
-	// HTTP/1.0 with explicit keep-alive
-	if strings.ToLower(resp.Header.Get("Connection")) == "keep-alive" {
+	// HTTP/1.0 with explicit keep-alive (from a forwarding proxy, in
+	// Proxy-Connection)
+	if strings.EqualFold(resp.Header.Get("Connection"), "keep-alive") || strings.EqualFold(resp.Header.Get("Proxy-Connection"), "keep-alive") {
 		return true
 	}
 
 	return false
 }
 
+// poolKey returns the pool a request to host goes in
+func (t *HTTP1Transport) poolKey(scheme, host, port string) string {
+	if t.forwardsThroughProxy(scheme) {
+		// One pool per proxy, shared by the origins it forwards to
+		return t.proxyPoolKey()
+	}
+	// Use connect host for pool key (domain fronting: multiple request hosts share one connection)
+	return fmt.Sprintf("%s://%s:%s", scheme, t.getConnectHost(host), port)
+}
+
 // getIdleConn retrieves an idle connection from the pool
 func (t *HTTP1Transport) getIdleConn(key string) (*http1Conn, error) {
 	t.idleConnsMu.Lock()
@@ -1103,7 +1234,7 @@ func (t *HTTP1Transport) getIdleConn(key string) (*http1Conn, error) {
 	t.idleConns[key] = conns[:len(conns)-1]
 
 	// Check if connection is still valid
-	if time.Since(conn.lastUsedAt) > t.maxIdleTime {
+	if t.expired(conn) {
 		conn.close()
 		return nil, nil
 	}
@@ -1134,14 +1265,20 @@ func (t *HTTP1Transport) putIdleConn(key string, conn *http1Conn) {
 
 	conn.lastUsedAt = time.Now()
 	t.idleConns[key] = append(conns, conn)
+	t.conns.wake()
+}
+
+// expired reports whether an idle connection was idle too long, or is past
+// its lifetime
+func (t *HTTP1Transport) expired(conn *http1Conn) bool {
+	return time.Since(conn.lastUsedAt) > t.maxIdleTime || (t.maxConnAge > 0 && time.Since(conn.createdAt) > t.maxConnAge)
 }
 
 // close closes an http1Conn
 func (c *http1Conn) close() {
 	c.mu.Lock()
-	defer c.mu.Unlock()
-
 	if c.closed {
+		c.mu.Unlock()
 		return
 	}
 	c.closed = true
@@ -1151,6 +1288,11 @@ func (c *http1Conn) close() {
 	} else if c.conn != nil {
 		c.conn.Close()
 	}
+	c.mu.Unlock()
+
+	if c.release != nil {
+		c.release()
+	}
 }
 
 // cleanupLoop periodically removes stale connections
@@ -1176,7 +1318,7 @@ func (t *HTTP1Transport) cleanup() {
 	for key, conns := range t.idleConns {
 		var active []*http1Conn
 		for _, conn := range conns {
-			if time.Since(conn.lastUsedAt) > t.maxIdleTime {
+			if t.expired(conn) {
 				go conn.close()
 			} else {
 				active = append(active, conn)
@@ -1268,6 +1410,17 @@ func (t *HTTP1Transport) SetSessionCache(cache utls.ClientSessionCache) {
 	t.sessionCache = cache
 }
 
+// SetTicketPartition scopes TLS session lookups to an egress partition.
+// An empty partition uses origin-only keys.
+func (t *HTTP1Transport) SetTicketPartition(partition string) {
+	t.ticketPartition = partition
+}
+
+// ticketCache returns the session cache as seen from the current egress partition
+func (t *HTTP1Transport) ticketCache() utls.ClientSessionCache {
+	return scopeSessionCache(t.sessionCache, t.ticketPartition)
+}
+
 // Stats returns transport statistics
 func (t *HTTP1Transport) Stats() map[string]HTTP1ConnStats {
 	t.idleConnsMu.Lock()
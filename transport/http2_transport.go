@@ -3,9 +3,7 @@ package transport
 import (
 	"bufio"
 	"context"
-	crand "crypto/rand"
 	"encoding/base64"
-	"encoding/binary"
 	"fmt"
 	"io"
 	"net"
@@ -23,6 +21,19 @@ import (
 	utls "github.com/sardanioss/utls"
 )
 
+// h2HeaderOrder is Chrome 143's regular header order (verified via tls.peet.ws)
+var h2HeaderOrder = []string{
+	"cache-control", // appears on reload/session resumption
+	"sec-ch-ua", "sec-ch-ua-mobile", "sec-ch-ua-platform",
+	"upgrade-insecure-requests", "user-agent",
+	"content-type", "content-length", // for POST requests
+	"accept", "origin", // origin for CORS
+	"sec-fetch-site", "sec-fetch-mode", "sec-fetch-user", "sec-fetch-dest",
+	"referer",
+	"accept-encoding", "accept-language",
+	"cookie", "priority",
+}
+
 // HTTP2Transport is a custom HTTP/2 transport with uTLS fingerprinting
 // and proper connection reuse
 type HTTP2Transport struct {
@@ -38,6 +49,9 @@ type HTTP2Transport struct {
 	// TLS session resumption cache (shared across connections)
 	sessionCache utls.ClientSessionCache
 
+	// ticketPartition scopes sessionCache to the current egress (see TicketIsolation)
+	ticketPartition string
+
 	// Shuffle seed for consistent TLS extension order across all connections
 	// Chrome shuffles extensions once per session, not per connection
 	// Each connection needs a fresh spec (ApplyPreset mutates it), but same seed
@@ -99,12 +113,10 @@ func NewHTTP2TransportWithConfig(preset *fingerprint.Preset, dnsCache *dns.Cache
 		sessionCache = NewPersistableSessionCache()
 	}
 
-	// Generate random seed for TLS extension shuffling
+	// Seed for TLS extension shuffling
 	// Chrome shuffles extensions once per session, not per connection
 	// This seed ensures consistent ordering across all connections in this transport
-	var seedBytes [8]byte
-	crand.Read(seedBytes[:])
-	shuffleSeed := int64(binary.LittleEndian.Uint64(seedBytes[:]))
+	shuffleSeed := newShuffleSeed(config)
 
 	// Check if PSK spec is available for this preset
 	hasPSKSpec := preset.PSKClientHelloID.Client != ""
@@ -128,6 +140,12 @@ func NewHTTP2TransportWithConfig(preset *fingerprint.Preset, dnsCache *dns.Cache
 	if config != nil && config.LocalAddr != "" {
 		t.localAddr = config.LocalAddr
 	}
+	if pool := config.pool(); pool.IdleConnTimeout > 0 {
+		t.maxIdleTime = pool.IdleConnTimeout
+	}
+	if pool := config.pool(); pool.MaxConnLifetime > 0 {
+		t.maxConnAge = pool.MaxConnLifetime
+	}
 
 	// Start background cleanup
 	go t.cleanupLoop()
@@ -219,6 +237,7 @@ func (t *HTTP2Transport) getOrCreateConn(ctx context.Context, host, port, key st
 	t.connsMu.RUnlock()
 
 	if exists && t.isConnUsable(conn) {
+		ContextClientTrace(ctx).connectionReused("h2", key)
 		return conn, nil
 	}
 
@@ -228,6 +247,7 @@ func (t *HTTP2Transport) getOrCreateConn(ctx context.Context, host, port, key st
 	// Double-check after acquiring write lock
 	if conn, exists = t.conns[key]; exists && t.isConnUsable(conn) {
 		t.connsMu.Unlock()
+		ContextClientTrace(ctx).connectionReused("h2", key)
 		return conn, nil
 	}
 
@@ -259,6 +279,14 @@ func (t *HTTP2Transport) getOrCreateConn(ctx context.Context, host, port, key st
 	return newConn, nil
 }
 
+// Preconnect opens a connection to host:port for later requests, unless a
+// usable one is pooled already
+func (t *HTTP2Transport) Preconnect(ctx context.Context, host, port string) error {
+	key := net.JoinHostPort(t.getConnectHost(host), port)
+	_, err := t.getOrCreateConn(ctx, host, port, key)
+	return err
+}
+
 // isConnUsable checks if a connection is still usable
 // Note: We don't check CanTakeNewRequest() here because it can return false
 // even when the connection is fine. We'll handle errors during actual use.
@@ -287,24 +315,94 @@ func (t *HTTP2Transport) isConnUsable(conn *persistentConn) bool {
 
 // createConn creates a new persistent connection
 func (t *HTTP2Transport) createConn(ctx context.Context, host, port string) (*persistentConn, error) {
+	tlsConn, err := t.dialTLS(ctx, host, port)
+	if err != nil {
+		return nil, err
+	}
+
+	// Build HTTP/2 settings from preset
+	settings := t.preset.HTTP2Settings
+
+	// Check TLSOnly mode - disables automatic compression and user-agent
+	tlsOnly := t.config != nil && t.config.TLSOnly
+	userAgent := t.preset.UserAgent
+	if tlsOnly {
+		userAgent = "" // Don't set default User-Agent in TLS-only mode
+	}
+
+	// Create HTTP/2 transport with native fingerprinting (no frame interception needed)
+	h2Transport := &http2.Transport{
+		AllowHTTP:                  false,
+		DisableCompression:         tlsOnly, // Disable auto Accept-Encoding in TLS-only mode
+		StrictMaxConcurrentStreams: false,
+		ReadIdleTimeout:            t.maxIdleTime,
+		PingTimeout:                15 * time.Second,
+
+		// Native fingerprinting via sardanioss/net
+		ConnectionFlow:    settings.ConnectionWindowUpdate,
+		Settings:          h2SettingsMap(settings),
+		SettingsOrder:     h2SettingsOrder(settings),
+		PseudoHeaderOrder: settings.PseudoHeaders(),
+		HeaderPriority: &http2.PriorityParam{
+			Weight:    uint8(settings.StreamWeight - 1), // Wire format is weight-1
+			Exclusive: settings.StreamExclusive,
+			StreamDep: 0,
+		},
+		HeaderOrder:         h2HeaderOrder,
+		UserAgent:           userAgent,
+		StreamPriorityMode:  http2.StreamPriorityChrome,
+		HPACKIndexingPolicy: hpack.IndexingChrome,
+	}
+
+	h2Conn, err := h2Transport.NewClientConn(NewHTTP2Conn(tlsConn, settings))
+	if err != nil {
+		tlsConn.Close()
+		return nil, fmt.Errorf("HTTP/2 setup failed: %w", err)
+	}
+
+	// Check if session was resumed (faster TLS handshake)
+	connState := tlsConn.ConnectionState()
+	sessionResumed := connState.DidResume
+
+	return &persistentConn{
+		host:           host,
+		tlsConn:        tlsConn,
+		h2Conn:         h2Conn,
+		createdAt:      time.Now(),
+		lastUsedAt:     time.Now(),
+		useCount:       0,
+		sessionResumed: sessionResumed,
+		tlsVersion:     connState.Version,
+		cipherSuite:    connState.CipherSuite,
+	}, nil
+}
+
+// dialTLS opens a fingerprinted TLS connection to host:port (through the
+// proxy, if any) and checks that h2 was negotiated. On an ALPN mismatch it
+// returns *ALPNMismatchError carrying the open connection.
+func (t *HTTP2Transport) dialTLS(ctx context.Context, host, port string) (*utls.UConn, error) {
 	var rawConn net.Conn
 	var err error
 
 	// Get the connection host (may be different for domain fronting)
 	connectHost := t.getConnectHost(host)
-
-	targetAddr := net.JoinHostPort(host, port)
+	trace := ContextClientTrace(ctx)
 
 	if t.proxy != nil && t.proxy.URL != "" {
 		// Connect through proxy - use connectHost for proxy CONNECT
+		proxyAddr := proxyHostPort(t.proxy.URL)
+		trace.connectStart("tcp", proxyAddr)
 		rawConn, err = t.dialThroughProxy(ctx, connectHost, port)
+		trace.connectDone("tcp", proxyAddr, err)
 		if err != nil {
 			return nil, fmt.Errorf("proxy connection failed: %w", err)
 		}
 	} else {
 		// Direct connection with DNS resolution and IPv4/IPv6 fallback
 		// Resolve the connection host, not request host
+		trace.dnsStart(connectHost)
 		ips, err := t.dnsCache.ResolveAllSorted(ctx, connectHost)
+		trace.dnsDone(ips, err)
 		if err != nil {
 			return nil, fmt.Errorf("DNS resolution failed: %w", err)
 		}
@@ -356,7 +454,9 @@ func (t *HTTP2Transport) createConn(ctx context.Context, host, port string) (*pe
 				perAddr = 10 * time.Second
 			}
 			dialCtx, dialCancel := context.WithTimeout(ctx, perAddr)
+			trace.connectStart(network, addr)
 			rawConn, err = dialer.DialContext(dialCtx, network, addr)
+			trace.connectDone(network, addr, err)
 			dialCancel()
 			if err == nil {
 				break // Connection successful
@@ -400,6 +500,7 @@ func (t *HTTP2Transport) createConn(ctx context.Context, host, port string) (*pe
 			}
 		}
 	}
+	t.config.applyClientHelloSpecHook(t.preset, specToUse)
 
 	// Fetch ECH config if needed
 	var echConfigList []byte
@@ -439,11 +540,12 @@ func (t *HTTP2Transport) createConn(ctx context.Context, host, port string) (*pe
 		EncryptedClientHelloConfigList:     echConfigList, // ECH configuration (if available)
 		KeyLogWriter:                       keyLogWriter,
 	}
+	t.config.applyHostTLS(tlsConfig, host)
 
 	// Only enable session cache if we have PSK spec - prevents panic when session
 	// is cached but spec doesn't have PSK extension (TOCTOU race mitigation)
 	if t.hasPSKSpec {
-		tlsConfig.ClientSessionCache = t.sessionCache
+		tlsConfig.ClientSessionCache = t.ticketCache()
 	}
 
 	// Create UClient with HelloCustom and apply our fresh spec
@@ -463,10 +565,11 @@ func (t *HTTP2Transport) createConn(ctx context.Context, host, port string) (*pe
 
 	// Set session cache for TLS resumption (only if PSK spec available)
 	if t.hasPSKSpec {
-		tlsConn.SetSessionCache(t.sessionCache)
+		tlsConn.SetSessionCache(t.ticketCache())
 	}
 
 	// Perform TLS handshake
+	trace.tlsHandshakeStart()
 	if err := tlsConn.HandshakeContext(ctx); err != nil {
 		rawConn.Close()
 
@@ -495,6 +598,7 @@ func (t *HTTP2Transport) createConn(ctx context.Context, host, port string) (*pe
 					fallbackSpec = &spec
 				}
 			}
+			t.config.applyClientHelloSpecHook(t.preset, fallbackSpec)
 
 			// Redo TLS handshake on the clean connection
 			if fallbackSpec != nil {
@@ -507,24 +611,29 @@ func (t *HTTP2Transport) createConn(ctx context.Context, host, port string) (*pe
 				tlsConn = utls.UClient(rawConn, tlsConfig, t.preset.ClientHelloID)
 			}
 			if t.hasPSKSpec {
-				tlsConn.SetSessionCache(t.sessionCache)
+				tlsConn.SetSessionCache(t.ticketCache())
 			}
 
 			if hsErr := tlsConn.HandshakeContext(ctx); hsErr != nil {
 				rawConn.Close()
+				trace.tlsHandshakeDone(TLSHandshakeInfo{ServerName: host}, hsErr)
 				return nil, fmt.Errorf("TLS handshake failed (after speculative fallback): %w", hsErr)
 			}
 			// Fall through to ALPN check below
 			goto alpnCheck
 		}
 
+		trace.tlsHandshakeDone(TLSHandshakeInfo{ServerName: host}, err)
 		return nil, fmt.Errorf("TLS handshake failed: %w", err)
 	}
 
 alpnCheck:
 	// Check ALPN negotiation result
 	state := tlsConn.ConnectionState()
+	trace.tlsHandshakeDone(tlsInfo(state), nil)
 	if state.NegotiatedProtocol != "h2" {
+		// Runs before the connection is handed to HTTP/1.1
+		t.config.onConnection(connInfo(host, port, "h1", state))
 		// Return ALPNMismatchError with the TLS connection so caller can reuse it for H1
 		// DO NOT close the connection - caller is responsible for closing or reusing
 		return nil, &ALPNMismatchError{
@@ -535,85 +644,9 @@ alpnCheck:
 			Port:       port,
 		}
 	}
+	t.config.onConnection(connInfo(host, port, "h2", state))
 
-	// Build HTTP/2 settings from preset
-	settings := t.preset.HTTP2Settings
-
-	// Check TLSOnly mode - disables automatic compression and user-agent
-	tlsOnly := t.config != nil && t.config.TLSOnly
-	userAgent := t.preset.UserAgent
-	if tlsOnly {
-		userAgent = "" // Don't set default User-Agent in TLS-only mode
-	}
-
-	// Create HTTP/2 transport with native fingerprinting (no frame interception needed)
-	h2Transport := &http2.Transport{
-		AllowHTTP:                  false,
-		DisableCompression:         tlsOnly, // Disable auto Accept-Encoding in TLS-only mode
-		StrictMaxConcurrentStreams: false,
-		ReadIdleTimeout:            t.maxIdleTime,
-		PingTimeout:                15 * time.Second,
-
-		// Native fingerprinting via sardanioss/net
-		ConnectionFlow: settings.ConnectionWindowUpdate,
-		Settings: map[http2.SettingID]uint32{
-			http2.SettingHeaderTableSize:   settings.HeaderTableSize,
-			http2.SettingEnablePush:        boolToUint32(settings.EnablePush),
-			http2.SettingInitialWindowSize: settings.InitialWindowSize,
-			http2.SettingMaxHeaderListSize: settings.MaxHeaderListSize,
-		},
-		SettingsOrder: []http2.SettingID{
-			http2.SettingHeaderTableSize,
-			http2.SettingEnablePush,
-			http2.SettingInitialWindowSize,
-			http2.SettingMaxHeaderListSize,
-		},
-		PseudoHeaderOrder: []string{":method", ":authority", ":scheme", ":path"}, // Chrome order (m,a,s,p)
-		HeaderPriority: &http2.PriorityParam{
-			Weight:    uint8(settings.StreamWeight - 1), // Wire format is weight-1
-			Exclusive: settings.StreamExclusive,
-			StreamDep: 0,
-		},
-		HeaderOrder: []string{
-			// Chrome 143 header order (verified via tls.peet.ws)
-			"cache-control", // appears on reload/session resumption
-			"sec-ch-ua", "sec-ch-ua-mobile", "sec-ch-ua-platform",
-			"upgrade-insecure-requests", "user-agent",
-			"content-type", "content-length", // for POST requests
-			"accept", "origin", // origin for CORS
-			"sec-fetch-site", "sec-fetch-mode", "sec-fetch-user", "sec-fetch-dest",
-			"referer",
-			"accept-encoding", "accept-language",
-			"cookie", "priority",
-		},
-		UserAgent:           userAgent,
-		StreamPriorityMode:  http2.StreamPriorityChrome,
-		HPACKIndexingPolicy: hpack.IndexingChrome,
-	}
-
-	h2Conn, err := h2Transport.NewClientConn(tlsConn)
-	if err != nil {
-		tlsConn.Close()
-		return nil, fmt.Errorf("HTTP/2 setup failed: %w", err)
-	}
-
-	_ = targetAddr // Used in proxy connection
-
-	// Check if session was resumed (faster TLS handshake)
-	connState := tlsConn.ConnectionState()
-	sessionResumed := connState.DidResume
-
-	return &persistentConn{
-		host:           host,
-		tlsConn:        tlsConn,
-		h2Conn:         h2Conn,
-		createdAt:      time.Now(),
-		lastUsedAt:     time.Now(),
-		useCount:       0,
-		sessionResumed: sessionResumed,
-		tlsVersion:     connState.Version,
-		cipherSuite:    connState.CipherSuite,
-	}, nil
+	return tlsConn, nil
 }
 
 // dialThroughProxy establishes a connection through a proxy using CONNECT
@@ -693,6 +726,11 @@ func (t *HTTP2Transport) dialThroughHTTPProxy(ctx context.Context, targetHost, t
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to proxy: %w", err)
 	}
+	if proxyURL.Scheme == "https" {
+		if conn, err = DialProxyTLS(ctx, conn, proxyHost, t.preset, t.insecureSkipVerify); err != nil {
+			return nil, err
+		}
+	}
 
 	// Build CONNECT request
 	targetAddr := net.JoinHostPort(targetHost, targetPort)
@@ -707,7 +745,7 @@ func (t *HTTP2Transport) dialThroughHTTPProxy(ctx context.Context, targetHost, t
 	connectReq += "\r\n"
 
 	// Check if speculative TLS is disabled (explicitly or via blocklist)
-	if (t.config != nil && t.config.DisableSpeculativeTLS) || IsProxyNoSpeculative(t.proxy.URL) {
+	if (t.config != nil && (t.config.DisableSpeculativeTLS || t.config.ProxyAuth != nil)) || IsProxyNoSpeculative(t.proxy.URL) {
 		// Traditional flow: send CONNECT, wait for 200 OK, then return conn for TLS
 		return t.dialHTTPProxyBlocking(ctx, conn, connectReq)
 	}
@@ -758,6 +796,11 @@ func (t *HTTP2Transport) dialHTTPProxyBlockingFresh(ctx context.Context, targetH
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to proxy: %w", err)
 	}
+	if proxyURL.Scheme == "https" {
+		if conn, err = DialProxyTLS(ctx, conn, proxyHost, t.preset, t.insecureSkipVerify); err != nil {
+			return nil, err
+		}
+	}
 
 	targetAddr := net.JoinHostPort(targetHost, targetPort)
 	connectReq := fmt.Sprintf("CONNECT %s HTTP/1.1\r\nHost: %s\r\n", targetAddr, targetAddr)
@@ -794,6 +837,12 @@ func (t *HTTP2Transport) dialHTTPProxyBlocking(ctx context.Context, conn net.Con
 		return nil, fmt.Errorf("failed to read CONNECT response: %w", err)
 	}
 	resp.Body.Close()
+	if t.config != nil {
+		if resp, err = authenticateConnect(conn, reader, connectReq, resp, t.config.ProxyAuth, t.proxy.URL, deadline); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
 
 	if resp.StatusCode != http.StatusOK {
 		conn.Close()
@@ -812,6 +861,9 @@ func (t *HTTP2Transport) dialHTTPProxyBlocking(ctx context.Context, conn net.Con
 
 // getProxyAuth returns base64-encoded proxy authentication credentials
 func (t *HTTP2Transport) getProxyAuth(proxyURL *url.URL) string {
+	if t.config != nil && t.config.ProxyAuth != nil {
+		return "" // The handshake authenticates instead
+	}
 	// First check struct fields
 	username := t.proxy.Username
 	password := t.proxy.Password
@@ -936,6 +988,17 @@ func (t *HTTP2Transport) SetSessionCache(cache utls.ClientSessionCache) {
 	t.sessionCache = cache
 }
 
+// SetTicketPartition scopes TLS session lookups to an egress partition.
+// An empty partition uses origin-only keys.
+func (t *HTTP2Transport) SetTicketPartition(partition string) {
+	t.ticketPartition = partition
+}
+
+// ticketCache returns the session cache as seen from the current egress partition
+func (t *HTTP2Transport) ticketCache() utls.ClientSessionCache {
+	return scopeSessionCache(t.sessionCache, t.ticketPartition)
+}
+
 // SetInsecureSkipVerify sets whether to skip TLS certificate verification
 func (t *HTTP2Transport) SetInsecureSkipVerify(skip bool) {
 	t.insecureSkipVerify = skip
@@ -1110,10 +1173,22 @@ func (t *HTTP2Transport) Connect(ctx context.Context, host, port string) error {
 	return nil
 }
 
-// boolToUint32 converts a bool to uint32 (for HTTP/2 SETTINGS)
-func boolToUint32(b bool) uint32 {
-	if b {
-		return 1
+// h2SettingsMap returns the preset's SETTINGS values keyed for the http2 transport
+func h2SettingsMap(settings fingerprint.HTTP2Settings) map[http2.SettingID]uint32 {
+	_, values := settings.SettingsFrame()
+	result := make(map[http2.SettingID]uint32, len(values))
+	for id, v := range values {
+		result[http2.SettingID(id)] = v
+	}
+	return result
+}
+
+// h2SettingsOrder returns the preset's SETTINGS wire order
+func h2SettingsOrder(settings fingerprint.HTTP2Settings) []http2.SettingID {
+	order, _ := settings.SettingsFrame()
+	result := make([]http2.SettingID, len(order))
+	for i, id := range order {
+		result[i] = http2.SettingID(id)
 	}
-	return 0
+	return result
 }
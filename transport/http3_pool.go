@@ -0,0 +1,95 @@
+//go:build !js && !wasip1
+
+package transport
+
+import (
+	"context"
+	"net"
+
+	"github.com/sardanioss/quic-go"
+	tls "github.com/sardanioss/utls"
+)
+
+// quicDialFunc is http3.Transport's Dial
+type quicDialFunc func(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (*quic.Conn, error)
+
+// trackConns wraps dial to record the connections it opens until they
+// close, for PoolStats, and to run the ConnectionCallbacks. http3.Transport
+// pools them out of sight.
+func (t *HTTP3Transport) trackConns(dial quicDialFunc) quicDialFunc {
+	return func(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (*quic.Conn, error) {
+		conn, err := dial(ctx, addr, tlsCfg, cfg)
+		if err != nil {
+			return nil, err
+		}
+		if err := t.onConnection(ctx, conn, addr); err != nil {
+			conn.CloseWithError(0, "")
+			return nil, err
+		}
+		t.openConnsMu.Lock()
+		if t.openConns == nil {
+			t.openConns = make(map[*quic.Conn]string)
+		}
+		t.openConns[conn] = addr
+		t.openConnsMu.Unlock()
+		go func() {
+			<-conn.Context().Done()
+			t.openConnsMu.Lock()
+			delete(t.openConns, conn)
+			t.openConnsMu.Unlock()
+		}()
+		return conn, nil
+	}
+}
+
+// poolStats reports the open QUIC connections per host
+func (t *HTTP3Transport) poolStats() []OriginPoolStats {
+	t.openConnsMu.Lock()
+	defer t.openConnsMu.Unlock()
+
+	byOrigin := make(map[string]*OriginPoolStats)
+	var stats []OriginPoolStats
+	for conn, addr := range t.openConns {
+		s := byOrigin[addr]
+		if s == nil {
+			s = &OriginPoolStats{Origin: "https://" + addr, Protocol: "h3"}
+			byOrigin[addr] = s
+		}
+		s.Open++
+		if conn.ConnectionState().TLS.DidResume {
+			s.Resumed++
+		}
+	}
+	for _, s := range byOrigin {
+		stats = append(stats, *s)
+	}
+	return stats
+}
+
+// onConnection runs the ConnectionCallbacks covering addr's host on conn,
+// once its handshake completes
+func (t *HTTP3Transport) onConnection(ctx context.Context, conn *quic.Conn, addr string) error {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || len(t.config.connectionCallbacks(host)) == 0 {
+		return nil
+	}
+	select {
+	case <-conn.HandshakeComplete():
+	case <-conn.Context().Done():
+		return context.Cause(conn.Context())
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	state := conn.ConnectionState().TLS
+	t.config.onConnection(&ConnInfo{
+		Host:                 host,
+		Port:                 port,
+		Protocol:             "h3",
+		Version:              state.Version,
+		CipherSuite:          state.CipherSuite,
+		Resumed:              state.DidResume,
+		PeerCertificates:     state.PeerCertificates,
+		exportKeyingMaterial: state.ExportKeyingMaterial,
+	})
+	return nil
+}
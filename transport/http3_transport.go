@@ -1,8 +1,9 @@
+//go:build !js && !wasip1
+
 package transport
 
 import (
 	"context"
-	crand "crypto/rand"
 	"encoding/binary"
 	"fmt"
 	"io"
@@ -25,14 +26,6 @@ import (
 	utls "github.com/sardanioss/utls"
 )
 
-// HTTP/3 SETTINGS identifiers
-const (
-	settingQPACKMaxTableCapacity = 0x1
-	settingMaxFieldSectionSize   = 0x6
-	settingQPACKBlockedStreams   = 0x7
-	settingH3Datagram            = 0x33
-)
-
 // QUIC transport parameter IDs (Chrome-specific)
 const (
 	tpVersionInformation = 0x11   // RFC 9368 version negotiation
@@ -100,6 +93,9 @@ type HTTP3Transport struct {
 	// TLS session cache for 0-RTT resumption
 	sessionCache tls.ClientSessionCache
 
+	// ticketPartition scopes sessionCache to the current egress (see TicketIsolation)
+	ticketPartition string
+
 	// Cached ClientHelloSpec for consistent TLS fingerprint
 	// Chrome shuffles TLS extensions once per session, not per connection
 	cachedClientHelloSpec *utls.ClientHelloSpec
@@ -119,6 +115,10 @@ type HTTP3Transport struct {
 	dialCount    int64 // Number of times dialQUIC was called (new connections)
 	mu           sync.RWMutex
 
+	// QUIC connections open, by dialed host:port (see trackConns)
+	openConns   map[*quic.Conn]string
+	openConnsMu sync.Mutex
+
 	// Configuration
 	quicConfig *quic.Config
 	tlsConfig  *tls.Config
@@ -126,6 +126,7 @@ type HTTP3Transport struct {
 	// Proxy support for SOCKS5 UDP relay via udpbara
 	proxyConfig   *ProxyConfig
 	udpbaraTunnel *udpbara.Tunnel // SOCKS5 UDP relay tunnel (shared across dials)
+	remoteDNS     bool            // socks5h: target hosts are never looked up locally
 	proxyConns    []*proxyQUICConn
 	proxyConnsMu  sync.Mutex
 	quicTransport *quic.Transport // Only used for direct connections
@@ -140,6 +141,7 @@ type HTTP3Transport struct {
 	// When resuming a session, we must use the same ECH config that was used
 	// to create the original session ticket, not a fresh one from DNS
 	echConfigCache   map[string][]byte
+	echConfigExpiry  map[string]time.Time // DNS TTL of each cached config, for persistence
 	echConfigCacheMu sync.RWMutex
 
 	// Skip TLS certificate verification (for testing)
@@ -182,7 +184,7 @@ func (t *HTTP3Transport) hasSessionForHost(host string) bool {
 	if !ok {
 		return false
 	}
-	_, found := cache.Get(host)
+	_, found := cache.Get(scopedTicketKey(t.ticketPartition, host))
 	return found
 }
 
@@ -198,6 +200,30 @@ func (t *HTTP3Transport) getSpecForHost(host string) *utls.ClientHelloSpec {
 	return t.cachedClientHelloSpec
 }
 
+// applyQUICInitial pads and lays out the Initial packets of cfg the way the
+// preset's browser does
+func applyQUICInitial(cfg *quic.Config, preset *fingerprint.Preset) {
+	initial := preset.QUICInitial()
+	cfg.InitialPacketSize = initial.PacketSize
+	cfg.ChromeStyleInitialPackets = initial.ChromeFrames
+	cfg.DisableClientHelloScrambling = !initial.ScrambleClientHello
+}
+
+// applyClientHelloSpecHooks pins the preset's signature algorithms and runs
+// TransportConfig.ClientHelloSpecHook over every cached QUIC spec. QUIC specs
+// are built once per transport (Chrome shuffles extensions once per session),
+// so the hook runs here rather than per dial.
+func (t *HTTP3Transport) applyClientHelloSpecHooks() {
+	for _, spec := range []*utls.ClientHelloSpec{
+		t.cachedClientHelloSpec,
+		t.cachedClientHelloSpecPSK,
+		t.cachedClientHelloSpecInner,
+		t.cachedClientHelloSpecInnerPSK,
+	} {
+		t.config.applyClientHelloSpecHook(t.preset, spec)
+	}
+}
+
 // getInnerSpecForHost returns the appropriate inner ClientHelloSpec for MASQUE connections
 // Only use PSK spec when there's an actual session to resume.
 func (t *HTTP3Transport) getInnerSpecForHost(host string) *utls.ClientHelloSpec {
@@ -215,10 +241,8 @@ func NewHTTP3Transport(preset *fingerprint.Preset, dnsCache *dns.Cache) (*HTTP3T
 
 // NewHTTP3TransportWithTransportConfig creates a new HTTP/3 transport with advanced config
 func NewHTTP3TransportWithTransportConfig(preset *fingerprint.Preset, dnsCache *dns.Cache, config *TransportConfig) (*HTTP3Transport, error) {
-	// Generate shuffle seed for session-consistent ordering
-	var seedBytes [8]byte
-	crand.Read(seedBytes[:])
-	shuffleSeed := int64(binary.LittleEndian.Uint64(seedBytes[:]))
+	// Shuffle seed for session-consistent ordering
+	shuffleSeed := newShuffleSeed(config)
 
 	// Create session cache - with optional distributed backend
 	var sessionCache *PersistableSessionCache
@@ -234,12 +258,13 @@ func NewHTTP3TransportWithTransportConfig(preset *fingerprint.Preset, dnsCache *
 	}
 
 	t := &HTTP3Transport{
-		preset:         preset,
-		dnsCache:       dnsCache,
-		sessionCache:   sessionCache,
-		shuffleSeed:    shuffleSeed,
-		config:         config,
-		echConfigCache: make(map[string][]byte), // Cache for ECH configs (for session resumption)
+		preset:          preset,
+		dnsCache:        dnsCache,
+		sessionCache:    sessionCache,
+		shuffleSeed:     shuffleSeed,
+		config:          config,
+		echConfigCache:  make(map[string][]byte), // Cache for ECH configs (for session resumption)
+		echConfigExpiry: make(map[string]time.Time),
 	}
 
 	// Get the ClientHelloID for TLS fingerprinting in QUIC
@@ -278,6 +303,9 @@ func NewHTTP3TransportWithTransportConfig(preset *fingerprint.Preset, dnsCache *
 		}
 	}
 
+	// Let the caller adjust the cached QUIC specs (advanced, see TransportConfig.ClientHelloSpecHook)
+	t.applyClientHelloSpecHooks()
+
 	// Determine key log writer - config override or global
 	var keyLogWriter io.Writer
 	if config != nil && config.KeyLogWriter != nil {
@@ -315,57 +343,17 @@ func NewHTTP3TransportWithTransportConfig(preset *fingerprint.Preset, dnsCache *
 		MaxIncomingUniStreams:         103, // Chrome uses 103
 		Allow0RTT:                     true,
 		EnableDatagrams:               true,                               // Chrome enables QUIC datagrams
-		InitialPacketSize:             1250,                               // Chrome uses ~1250
 		DisablePathMTUDiscovery:       false,                              // Still allow PMTUD for optimal performance
-		DisableClientHelloScrambling:  true,                               // Chrome doesn't scramble SNI, sends fewer packets
-		ChromeStyleInitialPackets:     true,                               // Chrome-like frame patterns in Initial packets
 		ClientHelloID:                 clientHelloID,                      // Fallback if cached spec fails
 		CachedClientHelloSpec:         t.cachedClientHelloSpec,            // Cached spec for consistent fingerprint
 		TransportParameterOrder:       quic.TransportParameterOrderChrome, // Chrome transport param ordering with large GREASE IDs
 		TransportParameterShuffleSeed: shuffleSeed,                        // Consistent transport param shuffle per session
 	}
+	applyQUICInitial(t.quicConfig, preset)
 
-	// Generate GREASE setting ID (must be of form 0x1f * N + 0x21)
-	// Chrome uses random GREASE values
-	greaseSettingID := generateGREASESettingID()
-	// Generate non-zero random 32-bit value (Chrome never sends 0)
-	greaseSettingValue := uint64(1 + rand.Uint32()%(1<<32-1))
-
-	// HTTP/3 QPACK settings - Safari/iOS uses different values than Chrome
-	// Safari/iOS: QPACK_MAX_TABLE_CAPACITY=16383 (0x3fff)
-	// Chrome: QPACK_MAX_TABLE_CAPACITY=65536 (0x10000)
-	qpackMaxTableCapacity := uint64(65536) // Chrome default
-	qpackBlockedStreams := uint64(100)     // Chrome/Safari default
-
-	if t.preset != nil {
-		if t.preset.HTTP2Settings.NoRFC7540Priorities {
-			// Safari/iOS uses smaller QPACK table
-			qpackMaxTableCapacity = 16383
-		}
-		if strings.Contains(t.preset.Name, "firefox") {
-			qpackBlockedStreams = 20
-		}
-	}
-
-	// HTTP/3 settings - browser-specific configuration
-	additionalSettings := map[uint64]uint64{
-		settingQPACKMaxTableCapacity: qpackMaxTableCapacity,
-		settingQPACKBlockedStreams:   qpackBlockedStreams,
-		greaseSettingID:              greaseSettingValue, // GREASE setting
-	}
-
-	// Add Chrome-specific settings (not sent by Safari/iOS)
-	if t.preset == nil || !t.preset.HTTP2Settings.NoRFC7540Priorities {
-		additionalSettings[settingMaxFieldSectionSize] = 262144 // Chrome's MAX_FIELD_SECTION_SIZE
-		additionalSettings[settingH3Datagram] = 1               // Chrome enables H3_DATAGRAM
-	}
-
-	// Firefox-specific settings
-	if t.preset != nil && strings.Contains(t.preset.Name, "firefox") {
-		additionalSettings[0x8] = 1        // SETTINGS_ENABLE_CONNECT_PROTOCOL
-		additionalSettings[0xffd277] = 1   // SETTINGS_H3_DATAGRAM_DRAFT04
-		additionalSettings[0x2b603742] = 0 // SETTINGS_WEBTRANS_DRAFT00
-	}
+	// HTTP/3 SETTINGS - browser-specific, generated once so GREASE stays stable
+	h3Settings := t.preset.H3Settings()
+	_, additionalSettings := h3Settings.SettingsFrameFor(t.config.identityKey())
 
 	// Apply localAddr from config
 	if config != nil && config.LocalAddr != "" {
@@ -380,7 +368,7 @@ func NewHTTP3TransportWithTransportConfig(preset *fingerprint.Preset, dnsCache *
 	} else {
 		localUDPAddr = &net.UDPAddr{IP: net.IPv4zero, Port: 0}
 	}
-	udpConn, err := net.ListenUDP("udp", localUDPAddr)
+	udpConn, err := listenUDP("udp", localUDPAddr)
 	if err != nil {
 		if t.localAddr != "" {
 			// localAddr is set — retrying with the same IP on "udp6" won't help
@@ -402,11 +390,11 @@ func NewHTTP3TransportWithTransportConfig(preset *fingerprint.Preset, dnsCache *
 	t.transport = &http3.Transport{
 		TLSClientConfig:        t.tlsConfig,
 		QUICConfig:             t.quicConfig,
-		Dial:                   t.dialQUIC, // Just for DNS resolution
-		EnableDatagrams:        true,       // Chrome enables H3_DATAGRAM
+		Dial:                   t.trackConns(t.dialQUIC), // Just for DNS resolution
+		EnableDatagrams:        true,                     // Chrome enables QUIC datagrams
 		AdditionalSettings:     additionalSettings,
-		MaxResponseHeaderBytes: 262144, // Chrome's MAX_FIELD_SECTION_SIZE
-		SendGreaseFrames:       true,   // Chrome sends GREASE frames on control stream
+		MaxResponseHeaderBytes: int(h3Settings.MaxFieldSectionSize()),
+		SendGreaseFrames:       h3Settings.GreaseFrames,
 	}
 
 	return t, nil
@@ -436,10 +424,8 @@ func NewHTTP3TransportWithConfig(preset *fingerprint.Preset, dnsCache *dns.Cache
 		}
 	}
 
-	// Generate shuffle seed for session-consistent ordering
-	var seedBytes [8]byte
-	crand.Read(seedBytes[:])
-	shuffleSeed := int64(binary.LittleEndian.Uint64(seedBytes[:]))
+	// Shuffle seed for session-consistent ordering
+	shuffleSeed := newShuffleSeed(config)
 
 	// Create session cache - with optional distributed backend
 	var sessionCache *PersistableSessionCache
@@ -455,13 +441,14 @@ func NewHTTP3TransportWithConfig(preset *fingerprint.Preset, dnsCache *dns.Cache
 	}
 
 	t := &HTTP3Transport{
-		preset:         preset,
-		dnsCache:       dnsCache,
-		sessionCache:   sessionCache,
-		shuffleSeed:    shuffleSeed,
-		proxyConfig:    proxyConfig,
-		config:         config,
-		echConfigCache: make(map[string][]byte),
+		preset:          preset,
+		dnsCache:        dnsCache,
+		sessionCache:    sessionCache,
+		shuffleSeed:     shuffleSeed,
+		proxyConfig:     proxyConfig,
+		config:          config,
+		echConfigCache:  make(map[string][]byte),
+		echConfigExpiry: make(map[string]time.Time),
 	}
 
 	// Apply localAddr from config
@@ -499,6 +486,9 @@ func NewHTTP3TransportWithConfig(preset *fingerprint.Preset, dnsCache *dns.Cache
 		}
 	}
 
+	// Let the caller adjust the cached QUIC specs (advanced, see TransportConfig.ClientHelloSpecHook)
+	t.applyClientHelloSpecHooks()
+
 	// Determine key log writer - config override or global
 	var keyLogWriter io.Writer
 	if config != nil && config.KeyLogWriter != nil {
@@ -535,15 +525,13 @@ func NewHTTP3TransportWithConfig(preset *fingerprint.Preset, dnsCache *dns.Cache
 		MaxIncomingUniStreams:         103,
 		Allow0RTT:                     true,
 		EnableDatagrams:               true,
-		InitialPacketSize:             1250,
 		DisablePathMTUDiscovery:       false,
-		DisableClientHelloScrambling:  true,
-		ChromeStyleInitialPackets:     true,
 		ClientHelloID:                 clientHelloID,
 		CachedClientHelloSpec:         t.cachedClientHelloSpec,
 		TransportParameterOrder:       quic.TransportParameterOrderChrome,
 		TransportParameterShuffleSeed: shuffleSeed,
 	}
+	applyQUICInitial(t.quicConfig, preset)
 
 	// Set up SOCKS5 UDP relay via udpbara if proxy is configured
 	// udpbara creates local UDP socket pairs so quic-go gets real *net.UDPConn with OOB/ECN support
@@ -559,44 +547,12 @@ func NewHTTP3TransportWithConfig(preset *fingerprint.Preset, dnsCache *dns.Cache
 			return nil, fmt.Errorf("SOCKS5 proxy does not support UDP relay (required for HTTP/3): %w", err)
 		}
 		t.udpbaraTunnel = tunnel
+		t.remoteDNS = proxy.IsRemoteDNSURL(proxyConfig.URL)
 		// Note: quicTransport is NOT created here — each dial creates its own per-connection
 	}
 
-	// Generate GREASE settings
-	greaseSettingID := generateGREASESettingID()
-	greaseSettingValue := uint64(1 + rand.Uint32()%(1<<32-1))
-
-	// HTTP/3 QPACK settings - Safari/iOS uses different values than Chrome
-	qpackMaxTableCapacity := uint64(65536) // Chrome default
-	qpackBlockedStreams := uint64(100)     // Chrome/Safari default
-
-	if t.preset != nil {
-		if t.preset.HTTP2Settings.NoRFC7540Priorities {
-			qpackMaxTableCapacity = 16383 // Safari/iOS uses smaller QPACK table
-		}
-		if strings.Contains(t.preset.Name, "firefox") {
-			qpackBlockedStreams = 20
-		}
-	}
-
-	additionalSettings := map[uint64]uint64{
-		settingQPACKMaxTableCapacity: qpackMaxTableCapacity,
-		settingQPACKBlockedStreams:   qpackBlockedStreams,
-		greaseSettingID:              greaseSettingValue,
-	}
-
-	// Add Chrome-specific settings (not sent by Safari/iOS)
-	if t.preset == nil || !t.preset.HTTP2Settings.NoRFC7540Priorities {
-		additionalSettings[settingMaxFieldSectionSize] = 262144 // Chrome's MAX_FIELD_SECTION_SIZE
-		additionalSettings[settingH3Datagram] = 1               // Chrome enables H3_DATAGRAM
-	}
-
-	// Firefox-specific settings
-	if t.preset != nil && strings.Contains(t.preset.Name, "firefox") {
-		additionalSettings[0x8] = 1        // SETTINGS_ENABLE_CONNECT_PROTOCOL
-		additionalSettings[0xffd277] = 1   // SETTINGS_H3_DATAGRAM_DRAFT04
-		additionalSettings[0x2b603742] = 0 // SETTINGS_WEBTRANS_DRAFT00
-	}
+	h3Settings := t.preset.H3Settings()
+	_, additionalSettings := h3Settings.SettingsFrameFor(t.config.identityKey())
 
 	// Create HTTP/3 transport with appropriate dial function
 	var dialFunc func(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (*quic.Conn, error)
@@ -608,11 +564,11 @@ func NewHTTP3TransportWithConfig(preset *fingerprint.Preset, dnsCache *dns.Cache
 	t.transport = &http3.Transport{
 		TLSClientConfig:        t.tlsConfig,
 		QUICConfig:             t.quicConfig,
-		Dial:                   dialFunc,
+		Dial:                   t.trackConns(dialFunc),
 		EnableDatagrams:        true,
 		AdditionalSettings:     additionalSettings,
-		MaxResponseHeaderBytes: 262144,
-		SendGreaseFrames:       true,
+		MaxResponseHeaderBytes: int(h3Settings.MaxFieldSectionSize()),
+		SendGreaseFrames:       h3Settings.GreaseFrames,
 	}
 
 	return t, nil
@@ -622,10 +578,8 @@ func NewHTTP3TransportWithConfig(preset *fingerprint.Preset, dnsCache *dns.Cache
 // MASQUE allows HTTP/3 (QUIC) traffic to be tunneled through an HTTP/3 proxy using
 // the CONNECT-UDP method defined in RFC 9298.
 func NewHTTP3TransportWithMASQUE(preset *fingerprint.Preset, dnsCache *dns.Cache, proxyConfig *ProxyConfig, config *TransportConfig) (*HTTP3Transport, error) {
-	// Generate shuffle seed for session-consistent ordering
-	var seedBytes [8]byte
-	crand.Read(seedBytes[:])
-	shuffleSeed := int64(binary.LittleEndian.Uint64(seedBytes[:]))
+	// Shuffle seed for session-consistent ordering
+	shuffleSeed := newShuffleSeed(config)
 
 	// Create session cache - with optional distributed backend
 	var sessionCache *PersistableSessionCache
@@ -641,13 +595,14 @@ func NewHTTP3TransportWithMASQUE(preset *fingerprint.Preset, dnsCache *dns.Cache
 	}
 
 	t := &HTTP3Transport{
-		preset:         preset,
-		dnsCache:       dnsCache,
-		sessionCache:   sessionCache,
-		shuffleSeed:    shuffleSeed,
-		proxyConfig:    proxyConfig,
-		config:         config,
-		echConfigCache: make(map[string][]byte),
+		preset:          preset,
+		dnsCache:        dnsCache,
+		sessionCache:    sessionCache,
+		shuffleSeed:     shuffleSeed,
+		proxyConfig:     proxyConfig,
+		config:          config,
+		echConfigCache:  make(map[string][]byte),
+		echConfigExpiry: make(map[string]time.Time),
 	}
 
 	// Apply localAddr from config
@@ -700,6 +655,9 @@ func NewHTTP3TransportWithMASQUE(preset *fingerprint.Preset, dnsCache *dns.Cache
 		}
 	}
 
+	// Let the caller adjust the cached QUIC specs (advanced, see TransportConfig.ClientHelloSpecHook)
+	t.applyClientHelloSpecHooks()
+
 	// Determine key log writer - config override or global
 	var keyLogWriter io.Writer
 	if config != nil && config.KeyLogWriter != nil {
@@ -757,51 +715,18 @@ func NewHTTP3TransportWithMASQUE(preset *fingerprint.Preset, dnsCache *dns.Cache
 	}
 	t.masqueConn = masqueConn
 
-	// Generate GREASE settings
-	greaseSettingID := generateGREASESettingID()
-	greaseSettingValue := uint64(1 + rand.Uint32()%(1<<32-1))
-
-	// HTTP/3 QPACK settings - Safari/iOS uses different values than Chrome
-	qpackMaxTableCapacityMASQUE := uint64(65536) // Chrome default
-	qpackBlockedStreams := uint64(100)           // Chrome/Safari default
-
-	if t.preset != nil {
-		if t.preset.HTTP2Settings.NoRFC7540Priorities {
-			qpackMaxTableCapacityMASQUE = 16383 // Safari/iOS uses smaller QPACK table
-		}
-		if strings.Contains(t.preset.Name, "firefox") {
-			qpackBlockedStreams = 20
-		}
-	}
-
-	additionalSettings := map[uint64]uint64{
-		settingQPACKMaxTableCapacity: qpackMaxTableCapacityMASQUE,
-		settingQPACKBlockedStreams:   qpackBlockedStreams,
-		greaseSettingID:              greaseSettingValue,
-	}
-
-	// Add Chrome-specific settings (not sent by Safari/iOS)
-	if t.preset == nil || !t.preset.HTTP2Settings.NoRFC7540Priorities {
-		additionalSettings[settingMaxFieldSectionSize] = 262144 // Chrome's MAX_FIELD_SECTION_SIZE
-		additionalSettings[settingH3Datagram] = 1               // Chrome enables H3_DATAGRAM
-	}
-
-	// Firefox-specific settings
-	if t.preset != nil && strings.Contains(t.preset.Name, "firefox") {
-		additionalSettings[0x8] = 1        // SETTINGS_ENABLE_CONNECT_PROTOCOL
-		additionalSettings[0xffd277] = 1   // SETTINGS_H3_DATAGRAM_DRAFT04
-		additionalSettings[0x2b603742] = 0 // SETTINGS_WEBTRANS_DRAFT00
-	}
+	h3Settings := t.preset.H3Settings()
+	_, additionalSettings := h3Settings.SettingsFrameFor(t.config.identityKey())
 
 	// Create HTTP/3 transport with MASQUE dial function
 	t.transport = &http3.Transport{
 		TLSClientConfig:        t.tlsConfig,
 		QUICConfig:             t.quicConfig,
-		Dial:                   t.dialQUICWithMASQUE,
+		Dial:                   t.trackConns(t.dialQUICWithMASQUE),
 		EnableDatagrams:        true,
 		AdditionalSettings:     additionalSettings,
-		MaxResponseHeaderBytes: 262144,
-		SendGreaseFrames:       true,
+		MaxResponseHeaderBytes: int(h3Settings.MaxFieldSectionSize()),
+		SendGreaseFrames:       h3Settings.GreaseFrames,
 	}
 
 	return t, nil
@@ -850,10 +775,11 @@ func (t *HTTP3Transport) dialQUICWithMASQUE(ctx context.Context, addr string, tl
 	// Set ServerName in TLS config - use request host (SNI), not connection host
 	tlsCfgCopy := tlsCfg.Clone()
 	tlsCfgCopy.ServerName = host
+	t.config.applyHostTLS(tlsCfgCopy, host)
 	// Clone() doesn't preserve ClientSessionCache, restore it for session resumption
 	// Only if we have PSK spec to prevent TOCTOU race
 	if t.cachedClientHelloSpecPSK != nil {
-		tlsCfgCopy.ClientSessionCache = t.sessionCache
+		tlsCfgCopy.ClientSessionCache = t.ticketCache()
 	}
 
 	// Fetch ECH config for inner connection
@@ -908,6 +834,7 @@ func (t *HTTP3Transport) dialQUICWithMASQUE(ctx context.Context, addr string, tl
 		CachedClientHelloSpec:          innerSpec, // Separate spec for consistent JA4, uses PSK for resumed
 		ECHConfigList:                  echConfigList,
 	}
+	t.config.applyQUICConfigHook(host, cfgCopy)
 
 	// Dial QUIC over the MASQUE tunnel using quic.DialEarly for 0-RTT support
 	// This properly supports ECH, unlike quic.Transport.Dial
@@ -953,8 +880,9 @@ func (t *HTTP3Transport) dialQUICWithProxy(ctx context.Context, addr string, tls
 	// Clone TLS config — ServerName is the actual host (not connectHost)
 	tlsCfgCopy := t.tlsConfig.Clone()
 	tlsCfgCopy.ServerName = host
+	t.config.applyHostTLS(tlsCfgCopy, host)
 	if t.cachedClientHelloSpecPSK != nil {
-		tlsCfgCopy.ClientSessionCache = t.sessionCache
+		tlsCfgCopy.ClientSessionCache = t.ticketCache()
 	}
 
 	// Clone QUIC config with fingerprinting
@@ -963,6 +891,7 @@ func (t *HTTP3Transport) dialQUICWithProxy(ctx context.Context, addr string, tls
 	if echConfigList != nil {
 		cfgCopy.ECHConfigList = echConfigList
 	}
+	t.config.applyQUICConfigHook(host, cfgCopy)
 
 	// Dial through the local relay → udpbara wraps in SOCKS5 → proxy forwards
 	conn, err := qt.DialEarly(ctx, udpConn.RelayAddr(), tlsCfgCopy, cfgCopy)
@@ -1014,6 +943,7 @@ func (t *HTTP3Transport) raceQUICDialWithECH(ctx context.Context, host string, i
 		if echConfigList != nil {
 			cfgCopy.ECHConfigList = echConfigList
 		}
+		t.config.applyQUICConfigHook(host, cfgCopy)
 		return cfgCopy
 	}
 
@@ -1061,23 +991,49 @@ func (t *HTTP3Transport) dialFirstSuccessful(ctx context.Context, addrs []*net.U
 			}
 		}
 		addrCtx, addrCancel := context.WithTimeout(ctx, perAddrTimeout)
+		network := "udp4"
+		if addr.IP.To4() == nil {
+			network = "udp6"
+		}
+		trace := ContextClientTrace(ctx)
+		trace.connectStart(network, addr.String())
+		trace.tlsHandshakeStart()
 		conn, err := t.quicTransport.DialEarly(addrCtx, addr, tlsCfg, cfg)
 		addrCancel()
+		trace.connectDone(network, addr.String(), err)
 		if err == nil {
+			go traceQUICHandshake(trace, conn)
 			return conn, nil
 		}
+		trace.tlsHandshakeDone(TLSHandshakeInfo{ServerName: tlsCfg.ServerName}, err)
 		lastErr = err
 	}
 	return nil, lastErr
 }
 
-// generateGREASESettingID generates a valid GREASE setting ID
-// GREASE IDs are of the form 0x1f * N + 0x21 where N is random
-// Chrome uses very large N values, producing setting IDs like 57836956465
-func generateGREASESettingID() uint64 {
-	// Generate large N values similar to Chrome (produces 10-11 digit IDs)
-	n := uint64(1000000000 + rand.Int63n(9000000000))
-	return 0x1f*n + 0x21
+// traceQUICHandshake reports a QUIC handshake to trace once it completes.
+// DialEarly returns as soon as 0-RTT data can be sent, before that.
+func traceQUICHandshake(trace *ClientTrace, conn *quic.Conn) {
+	if trace == nil || (trace.TLSHandshakeDone == nil && trace.Used0RTT == nil) {
+		return
+	}
+	select {
+	case <-conn.HandshakeComplete():
+	case <-conn.Context().Done():
+		trace.tlsHandshakeDone(TLSHandshakeInfo{}, context.Cause(conn.Context()))
+		return
+	}
+	state := conn.ConnectionState()
+	trace.tlsHandshakeDone(TLSHandshakeInfo{
+		Version:     state.TLS.Version,
+		CipherSuite: state.TLS.CipherSuite,
+		ALPN:        state.TLS.NegotiatedProtocol,
+		ServerName:  state.TLS.ServerName,
+		Resumed:     state.TLS.DidResume,
+	}, nil)
+	if state.Used0RTT {
+		trace.used0RTT()
+	}
 }
 
 // dialQUIC provides DNS resolution and ECH config fetching with Happy Eyeballs
@@ -1102,6 +1058,8 @@ func (t *HTTP3Transport) dialQUIC(ctx context.Context, addr string, tlsCfg *tls.
 	var ips []net.IP
 	var dnsErr error
 	var echConfigList []byte
+	trace := ContextClientTrace(ctx)
+	trace.dnsStart(connectHost)
 
 	if t.disableECH {
 		// ECH disabled - just do DNS
@@ -1137,6 +1095,7 @@ func (t *HTTP3Transport) dialQUIC(ctx context.Context, addr string, tlsCfg *tls.
 	}
 
 	// Check DNS result
+	trace.dnsDone(ips, dnsErr)
 	if dnsErr != nil {
 		return nil, fmt.Errorf("DNS resolution failed for %s: %w", connectHost, dnsErr)
 	}
@@ -1186,10 +1145,11 @@ func (t *HTTP3Transport) dialQUIC(ctx context.Context, addr string, tlsCfg *tls.
 	// http3.Transport may not include ClientSessionCache in the config it passes
 	tlsCfgCopy := t.tlsConfig.Clone()
 	tlsCfgCopy.ServerName = host
+	t.config.applyHostTLS(tlsCfgCopy, host)
 	// Clone() doesn't preserve ClientSessionCache, restore it for session resumption
 	// Only if we have PSK spec to prevent TOCTOU race
 	if t.cachedClientHelloSpecPSK != nil {
-		tlsCfgCopy.ClientSessionCache = t.sessionCache
+		tlsCfgCopy.ClientSessionCache = t.ticketCache()
 	}
 
 	// Clone our QUIC config (with proper fingerprinting settings)
@@ -1295,8 +1255,9 @@ func (t *HTTP3Transport) RoundTrip(req *http.Request) (*http.Response, error) {
 	// If dialCount increased, a new connection was created
 	// If dialCount stayed the same, connection was reused
 	_ = reqNum
-	_ = dialsBefore
-	_ = dialsAfter
+	if err == nil && dialsAfter == dialsBefore {
+		ContextClientTrace(req.Context()).connectionReused("h3", req.URL.Host)
+	}
 
 	return resp, err
 }
@@ -1409,7 +1370,7 @@ func (t *HTTP3Transport) Refresh() error {
 		} else {
 			localUDPAddr = &net.UDPAddr{IP: net.IPv4zero, Port: 0}
 		}
-		udpConn, err := net.ListenUDP("udp", localUDPAddr)
+		udpConn, err := listenUDP("udp", localUDPAddr)
 		if err != nil {
 			if t.localAddr != "" {
 				return fmt.Errorf("failed to create UDP socket for %s: %w", t.localAddr, err)
@@ -1430,27 +1391,9 @@ func (t *HTTP3Transport) Refresh() error {
 		t.closeAllProxyConns()
 	}
 
-	// Generate GREASE values matching constructor (Chrome-like 10-11 digit IDs, non-zero values)
-	greaseSettingID := generateGREASESettingID()
-	greaseSettingValue := uint64(1 + rand.Uint32()%(1<<32-1))
-
-	// QPACK capacity: Safari/iOS uses 16383, Chrome uses 65536
-	qpackMaxTableCapacity := uint64(65536)
-	if t.preset != nil && t.preset.HTTP2Settings.NoRFC7540Priorities {
-		qpackMaxTableCapacity = 16383
-	}
-
-	// Build additional settings matching original creation
-	additionalSettings := map[uint64]uint64{
-		settingQPACKMaxTableCapacity: qpackMaxTableCapacity,
-		settingQPACKBlockedStreams:   100,
-		greaseSettingID:              greaseSettingValue,
-	}
-	// Add Chrome-specific settings (not sent by Safari/iOS)
-	if t.preset == nil || !t.preset.HTTP2Settings.NoRFC7540Priorities {
-		additionalSettings[settingMaxFieldSectionSize] = 262144
-		additionalSettings[settingH3Datagram] = 1
-	}
+	// Fresh SETTINGS from the preset, including a new GREASE value
+	h3Settings := t.preset.H3Settings()
+	_, additionalSettings := h3Settings.SettingsFrameFor(t.config.identityKey())
 
 	// Determine which dial function to use and recreate transport
 	var dialFunc func(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (*quic.Conn, error)
@@ -1466,30 +1409,16 @@ func (t *HTTP3Transport) Refresh() error {
 	t.transport = &http3.Transport{
 		TLSClientConfig:        t.tlsConfig,
 		QUICConfig:             t.quicConfig,
-		Dial:                   dialFunc,
+		Dial:                   t.trackConns(dialFunc),
 		EnableDatagrams:        true,
 		AdditionalSettings:     additionalSettings,
-		MaxResponseHeaderBytes: 262144,
-		SendGreaseFrames:       true,
+		MaxResponseHeaderBytes: int(h3Settings.MaxFieldSectionSize()),
+		SendGreaseFrames:       h3Settings.GreaseFrames,
 	}
 
 	return nil
 }
 
-// closeWithTimeout closes a closer with a timeout to prevent blocking indefinitely.
-// QUIC connections may block on Close() waiting for graceful drain.
-func closeWithTimeout(c io.Closer, timeout time.Duration) {
-	done := make(chan struct{})
-	go func() {
-		c.Close()
-		close(done)
-	}()
-	select {
-	case <-done:
-	case <-time.After(timeout):
-	}
-}
-
 // is0RTTRejectedError checks if the error is due to 0-RTT rejection.
 // Only matches actual 0-RTT rejection, not generic "conn unusable" errors
 // (which can also be caused by idle timeout, peer reset, etc.).
@@ -1506,27 +1435,9 @@ func (t *HTTP3Transport) recreateTransport() {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
-	// Generate fresh GREASE values matching constructor (Chrome-like 10-11 digit IDs, non-zero values)
-	greaseSettingID := generateGREASESettingID()
-	greaseSettingValue := uint64(1 + rand.Uint32()%(1<<32-1))
-
-	// QPACK capacity: Safari/iOS uses 16383, Chrome uses 65536
-	qpackMaxTableCapacity := uint64(65536)
-	if t.preset != nil && t.preset.HTTP2Settings.NoRFC7540Priorities {
-		qpackMaxTableCapacity = 16383
-	}
-
-	// Build additional settings
-	additionalSettings := map[uint64]uint64{
-		settingQPACKMaxTableCapacity: qpackMaxTableCapacity,
-		settingQPACKBlockedStreams:   100,
-		greaseSettingID:              greaseSettingValue,
-	}
-	// Add Chrome-specific settings (not sent by Safari/iOS)
-	if t.preset == nil || !t.preset.HTTP2Settings.NoRFC7540Priorities {
-		additionalSettings[settingMaxFieldSectionSize] = 262144
-		additionalSettings[settingH3Datagram] = 1
-	}
+	// Fresh SETTINGS from the preset, including a new GREASE value
+	h3Settings := t.preset.H3Settings()
+	_, additionalSettings := h3Settings.SettingsFrameFor(t.config.identityKey())
 
 	// Determine which dial function to use
 	var dialFunc func(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (*quic.Conn, error)
@@ -1542,11 +1453,11 @@ func (t *HTTP3Transport) recreateTransport() {
 	t.transport = &http3.Transport{
 		TLSClientConfig:        t.tlsConfig,
 		QUICConfig:             t.quicConfig,
-		Dial:                   dialFunc,
+		Dial:                   t.trackConns(dialFunc),
 		EnableDatagrams:        true,
 		AdditionalSettings:     additionalSettings,
-		MaxResponseHeaderBytes: 262144,
-		SendGreaseFrames:       true,
+		MaxResponseHeaderBytes: int(h3Settings.MaxFieldSectionSize()),
+		SendGreaseFrames:       h3Settings.GreaseFrames,
 	}
 }
 
@@ -1560,10 +1471,24 @@ func (t *HTTP3Transport) SetSessionCache(cache tls.ClientSessionCache) {
 	t.sessionCache = cache
 	// Update the tlsConfig as well since it holds a reference
 	if t.tlsConfig != nil {
-		t.tlsConfig.ClientSessionCache = cache
+		t.tlsConfig.ClientSessionCache = t.ticketCache()
+	}
+}
+
+// SetTicketPartition scopes TLS session lookups to an egress partition.
+// An empty partition uses origin-only keys.
+func (t *HTTP3Transport) SetTicketPartition(partition string) {
+	t.ticketPartition = partition
+	if t.tlsConfig != nil && t.tlsConfig.ClientSessionCache != nil {
+		t.tlsConfig.ClientSessionCache = t.ticketCache()
 	}
 }
 
+// ticketCache returns the session cache as seen from the current egress partition
+func (t *HTTP3Transport) ticketCache() tls.ClientSessionCache {
+	return scopeSessionCache(t.sessionCache, t.ticketPartition)
+}
+
 // GetECHConfigCache returns all cached ECH configs
 // This is used for session persistence - ECH configs must be saved alongside
 // TLS session tickets to ensure proper session resumption
@@ -1591,6 +1516,29 @@ func (t *HTTP3Transport) SetECHConfigCache(configs map[string][]byte) {
 	}
 }
 
+// GetECHConfigExpiry returns when each cached ECH config's DNS record expires.
+// Hosts whose config did not come from DNS (custom ECHConfig) have no entry.
+func (t *HTTP3Transport) GetECHConfigExpiry() map[string]time.Time {
+	t.echConfigCacheMu.RLock()
+	defer t.echConfigCacheMu.RUnlock()
+
+	result := make(map[string]time.Time, len(t.echConfigExpiry))
+	for k, v := range t.echConfigExpiry {
+		result[k] = v
+	}
+	return result
+}
+
+// SetECHConfigExpiry restores ECH config expiry times from session persistence
+func (t *HTTP3Transport) SetECHConfigExpiry(expiry map[string]time.Time) {
+	t.echConfigCacheMu.Lock()
+	defer t.echConfigCacheMu.Unlock()
+
+	for k, v := range expiry {
+		t.echConfigExpiry[k] = v
+	}
+}
+
 // Connect establishes a QUIC connection to the host without making a request.
 // This is used for protocol racing - the first protocol to connect wins.
 func (t *HTTP3Transport) Connect(ctx context.Context, host, port string) error {
@@ -1621,6 +1569,7 @@ func (t *HTTP3Transport) Connect(ctx context.Context, host, port string) error {
 		InsecureSkipVerify: t.insecureSkipVerify,
 		KeyLogWriter:       keyLogWriter,
 	}
+	t.config.applyHostTLS(tlsCfg, host)
 
 	// Fetch ECH configs from DNS HTTPS records (use request host for ECH)
 	// This is non-blocking - if it fails, we proceed without ECH
@@ -1645,6 +1594,7 @@ func (t *HTTP3Transport) Connect(ctx context.Context, host, port string) error {
 		TransportParameterOrder:        quic.TransportParameterOrderChrome, // Chrome transport param ordering
 		TransportParameterShuffleSeed:  t.shuffleSeed,                      // Consistent transport param shuffle per session
 	}
+	t.config.applyQUICConfigHook(host, quicCfg)
 
 	// Try to establish QUIC connection
 	conn, err := quic.DialAddr(ctx, resolvedAddr, tlsCfg, quicCfg)
@@ -1750,6 +1700,12 @@ func (t *HTTP3Transport) getECHConfig(ctx context.Context, targetHost string) []
 	}
 	t.echConfigCacheMu.RUnlock()
 
+	// With socks5h the proxy resolves the target; an HTTPS record lookup
+	// for it here would leak the hostname to the local resolver
+	if t.remoteDNS && t.config.echLookupHost(targetHost) == targetHost {
+		return nil
+	}
+
 	// No cached config - fetch from DNS or config
 	var echConfig []byte
 	if t.config == nil {
@@ -1762,6 +1718,9 @@ func (t *HTTP3Transport) getECHConfig(ctx context.Context, targetHost string) []
 	if echConfig != nil {
 		t.echConfigCacheMu.Lock()
 		t.echConfigCache[targetHost] = echConfig
+		if expires, ok := dns.ECHConfigExpiry(t.config.echLookupHost(targetHost)); ok {
+			t.echConfigExpiry[targetHost] = expires
+		}
 		t.echConfigCacheMu.Unlock()
 	}
 
@@ -0,0 +1,149 @@
+//go:build js || wasip1
+
+package transport
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	http "github.com/sardanioss/http"
+	"github.com/sardanioss/httpcloak/dns"
+	"github.com/sardanioss/httpcloak/fingerprint"
+	tls "github.com/sardanioss/utls"
+)
+
+// quicSupported reports whether this platform can send UDP datagrams.
+// WebAssembly hosts only offer stream sockets (wasip1) or none at all (js).
+const quicSupported = false
+
+// ErrHTTP3Unavailable is returned for HTTP/3 requests on platforms without
+// UDP sockets.
+var ErrHTTP3Unavailable = errors.New("HTTP/3 is not available on this platform")
+
+// QUICConfig stands in for quic.Config where quic-go is not built.
+// QUICConfigHook is never called on these platforms.
+type QUICConfig struct{}
+
+// HTTP3Transport is a placeholder on platforms without UDP sockets. It keeps
+// the session-level state (session cache, ECH configs) so persisted sessions
+// round-trip unchanged, but every request fails with ErrHTTP3Unavailable.
+type HTTP3Transport struct {
+	dnsCache        *dns.Cache
+	sessionCache    tls.ClientSessionCache
+	ticketPartition string
+	echConfigCache  map[string][]byte
+	echConfigExpiry map[string]time.Time
+}
+
+// HTTP3Stats contains HTTP/3 transport statistics
+type HTTP3Stats struct {
+	RequestCount int64
+	DialCount    int64 // Number of new connections created
+	Reusing      bool  // True if connections are being reused
+}
+
+func newHTTP3TransportStub(dnsCache *dns.Cache) *HTTP3Transport {
+	return &HTTP3Transport{
+		dnsCache:        dnsCache,
+		echConfigCache:  make(map[string][]byte),
+		echConfigExpiry: make(map[string]time.Time),
+	}
+}
+
+// NewHTTP3Transport creates a placeholder HTTP/3 transport
+func NewHTTP3Transport(preset *fingerprint.Preset, dnsCache *dns.Cache) (*HTTP3Transport, error) {
+	return newHTTP3TransportStub(dnsCache), nil
+}
+
+// NewHTTP3TransportWithTransportConfig creates a placeholder HTTP/3 transport
+func NewHTTP3TransportWithTransportConfig(preset *fingerprint.Preset, dnsCache *dns.Cache, config *TransportConfig) (*HTTP3Transport, error) {
+	return newHTTP3TransportStub(dnsCache), nil
+}
+
+// NewHTTP3TransportWithProxy creates a placeholder HTTP/3 transport
+func NewHTTP3TransportWithProxy(preset *fingerprint.Preset, dnsCache *dns.Cache, proxyConfig *ProxyConfig) (*HTTP3Transport, error) {
+	return nil, ErrHTTP3Unavailable
+}
+
+// NewHTTP3TransportWithConfig creates a placeholder HTTP/3 transport
+func NewHTTP3TransportWithConfig(preset *fingerprint.Preset, dnsCache *dns.Cache, proxyConfig *ProxyConfig, config *TransportConfig) (*HTTP3Transport, error) {
+	return nil, ErrHTTP3Unavailable
+}
+
+// NewHTTP3TransportWithMASQUE creates a placeholder HTTP/3 transport
+func NewHTTP3TransportWithMASQUE(preset *fingerprint.Preset, dnsCache *dns.Cache, proxyConfig *ProxyConfig, config *TransportConfig) (*HTTP3Transport, error) {
+	return nil, ErrHTTP3Unavailable
+}
+
+// RoundTrip always fails with ErrHTTP3Unavailable
+func (t *HTTP3Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return nil, ErrHTTP3Unavailable
+}
+
+// Connect always fails with ErrHTTP3Unavailable
+func (t *HTTP3Transport) Connect(ctx context.Context, host, port string) error {
+	return ErrHTTP3Unavailable
+}
+
+func (t *HTTP3Transport) SetInsecureSkipVerify(skip bool)              {}
+func (t *HTTP3Transport) SetLocalAddr(addr string)                     {}
+func (t *HTTP3Transport) SetDisableECH(disable bool)                   {}
+func (t *HTTP3Transport) SetConnectTo(requestHost, connectHost string) {}
+func (t *HTTP3Transport) SetECHConfig(echConfig []byte)                {}
+func (t *HTTP3Transport) SetECHConfigDomain(domain string)             {}
+func (t *HTTP3Transport) IsConnectionReused(host string) bool          { return false }
+func (t *HTTP3Transport) GetDialCount() int64                          { return 0 }
+func (t *HTTP3Transport) GetRequestCount() int64                       { return 0 }
+func (t *HTTP3Transport) Stats() HTTP3Stats                            { return HTTP3Stats{} }
+func (t *HTTP3Transport) poolStats() []OriginPoolStats                 { return nil }
+func (t *HTTP3Transport) GetDNSCache() *dns.Cache                      { return t.dnsCache }
+func (t *HTTP3Transport) Close() error                                 { return nil }
+func (t *HTTP3Transport) Refresh() error                               { return nil }
+
+// GetSessionCache returns the TLS session cache
+func (t *HTTP3Transport) GetSessionCache() tls.ClientSessionCache {
+	return t.sessionCache
+}
+
+// SetSessionCache sets the TLS session cache
+func (t *HTTP3Transport) SetSessionCache(cache tls.ClientSessionCache) {
+	t.sessionCache = cache
+}
+
+// SetTicketPartition records the egress partition for parity with other platforms
+func (t *HTTP3Transport) SetTicketPartition(partition string) {
+	t.ticketPartition = partition
+}
+
+// GetECHConfigCache returns the ECH configs imported into this transport
+func (t *HTTP3Transport) GetECHConfigCache() map[string][]byte {
+	result := make(map[string][]byte, len(t.echConfigCache))
+	for k, v := range t.echConfigCache {
+		result[k] = v
+	}
+	return result
+}
+
+// SetECHConfigCache keeps imported ECH configs so they survive re-export
+func (t *HTTP3Transport) SetECHConfigCache(configs map[string][]byte) {
+	for k, v := range configs {
+		t.echConfigCache[k] = v
+	}
+}
+
+// GetECHConfigExpiry returns the lifetimes of the cached ECH configs
+func (t *HTTP3Transport) GetECHConfigExpiry() map[string]time.Time {
+	result := make(map[string]time.Time, len(t.echConfigExpiry))
+	for k, v := range t.echConfigExpiry {
+		result[k] = v
+	}
+	return result
+}
+
+// SetECHConfigExpiry restores ECH config lifetimes
+func (t *HTTP3Transport) SetECHConfigExpiry(expiry map[string]time.Time) {
+	for k, v := range expiry {
+		t.echConfigExpiry[k] = v
+	}
+}
@@ -0,0 +1,207 @@
+package transport
+
+import (
+	"time"
+)
+
+// Auto mode compares the time to first byte of HTTP/3 and HTTP/2 per origin.
+// An origin whose HTTP/3 is consistently slower (UDP throttled by the ISP
+// or a proxy) is pinned to HTTP/2 for latencyPinTTL instead of paying for
+// QUIC on every request.
+const (
+	// latencyPinRatio is how much slower HTTP/3 must be to be pinned away
+	latencyPinRatio = 1.5
+
+	// latencyMinSamples is how many requests each protocol needs before
+	// the two are compared
+	latencyMinSamples = 5
+
+	// latencyProbeEvery sends every Nth request to an HTTP/3 origin over
+	// HTTP/2, so there is something to compare with
+	latencyProbeEvery = 10
+
+	// latencyPinTTL is how long a pin lasts before the origin is raced again
+	latencyPinTTL = 30 * time.Minute
+
+	// latencyEWMAWeight is the weight of a new sample in the average
+	latencyEWMAWeight = 0.3
+)
+
+// Reasons for a ProtocolDecision
+const (
+	ProtocolReasonDiscovered = "discovered" // Won the race, or restored
+	ProtocolReasonLatency    = "latency"    // Pinned as the faster protocol
+	ProtocolReasonManual     = "manual"     // Pinned with PinProtocol
+	ProtocolReasonPolicy     = "policy"     // Forced by SetProtocolPolicy
+)
+
+// ProtocolDecision is what auto mode uses for an origin, and why
+type ProtocolDecision struct {
+	// Protocol is "h1", "h2" or "h3", or "" when the next request races
+	Protocol string
+
+	// Reason is one of the ProtocolReason constants
+	Reason string
+
+	// Expires is when the origin is raced again
+	Expires time.Time
+
+	// H3FailedUntil is when HTTP/3, which failed for the origin, is tried
+	// again; zero if it hasn't failed (see SetH3FailureBackoff)
+	H3FailedUntil time.Time
+
+	// H2Latency and H3Latency are the smoothed times to first byte, 0
+	// without samples
+	H2Latency, H3Latency time.Duration
+	H2Samples, H3Samples int
+}
+
+// originLatency is the latency measured for one origin
+type originLatency struct {
+	h2, h3               time.Duration
+	h2Samples, h3Samples int
+	requests             int // Requests sent to the origin while on HTTP/3
+}
+
+func (l *originLatency) add(p Protocol, d time.Duration) {
+	avg, n := &l.h3, &l.h3Samples
+	if p == ProtocolHTTP2 {
+		avg, n = &l.h2, &l.h2Samples
+	}
+	if *n == 0 {
+		*avg = d
+	} else {
+		*avg += time.Duration(latencyEWMAWeight * float64(d-*avg))
+	}
+	*n++
+}
+
+// latencyPinningEnabled reports whether auto mode pins protocols by latency
+func (t *Transport) latencyPinningEnabled() bool {
+	return t.config == nil || !t.config.DisableLatencyPinning
+}
+
+// probeH2 reports whether this request to host, an HTTP/3 origin, should
+// go over HTTP/2 to measure it
+func (t *Transport) probeH2(host string, req *Request) bool {
+	if !t.latencyPinningEnabled() || !req.Replayable() {
+		return false
+	}
+	t.protocolSupportMu.Lock()
+	defer t.protocolSupportMu.Unlock()
+	l := t.originLatency(host)
+	l.requests++
+	return l.requests%latencyProbeEvery == 0
+}
+
+// originLatency returns host's measurements. Called with protocolSupportMu
+// held.
+func (t *Transport) originLatency(host string) *originLatency {
+	if t.protocolLatency == nil {
+		t.protocolLatency = make(map[string]*originLatency)
+	}
+	l, ok := t.protocolLatency[host]
+	if !ok {
+		l = &originLatency{}
+		t.protocolLatency[host] = l
+	}
+	return l
+}
+
+// observeLatency records the time to first byte of resp, and pins host to
+// HTTP/2 once its HTTP/3 is consistently slower
+func (t *Transport) observeLatency(host string, resp *Response) {
+	if !t.latencyPinningEnabled() || resp == nil || resp.Timing == nil || host == "" {
+		return
+	}
+	var p Protocol
+	switch resp.Protocol {
+	case "h2":
+		p = ProtocolHTTP2
+	case "h3":
+		p = ProtocolHTTP3
+	default:
+		return
+	}
+	firstByte := time.Duration(resp.Timing.FirstByte * float64(time.Millisecond))
+
+	t.protocolSupportMu.Lock()
+	defer t.protocolSupportMu.Unlock()
+	if t.protocolPins[host] == ProtocolReasonManual && t.protocolFresh(host) {
+		return
+	}
+	l := t.originLatency(host)
+	l.add(p, firstByte)
+	if l.h2Samples < latencyMinSamples || l.h3Samples < latencyMinSamples || float64(l.h3) <= float64(l.h2)*latencyPinRatio {
+		return
+	}
+	t.protocolSupport[host] = ProtocolHTTP2
+	t.protocolExpiry[host] = time.Now().Add(latencyPinTTL)
+	t.setProtocolPin(host, ProtocolReasonLatency)
+	// Measure afresh once the pin expires
+	delete(t.protocolLatency, host)
+}
+
+// protocolFresh reports whether host's learned protocol hasn't expired.
+// Called with protocolSupportMu held.
+func (t *Transport) protocolFresh(host string) bool {
+	expires, ok := t.protocolExpiry[host]
+	return ok && time.Now().Before(expires)
+}
+
+// setProtocolPin records why host's protocol was chosen. Called with
+// protocolSupportMu held.
+func (t *Transport) setProtocolPin(host, reason string) {
+	if t.protocolPins == nil {
+		t.protocolPins = make(map[string]string)
+	}
+	t.protocolPins[host] = reason
+}
+
+// ProtocolDecision returns the protocol auto mode uses for host, why, and
+// the latency measured for it
+func (t *Transport) ProtocolDecision(host string) ProtocolDecision {
+	t.protocolSupportMu.RLock()
+	defer t.protocolSupportMu.RUnlock()
+
+	var d ProtocolDecision
+	d.H3FailedUntil = t.h3FailedUntil(host)
+	if p, ok := policyProtocol(t.protocolPolicy, host); ok && p != ProtocolAuto {
+		d.Protocol = p.String()
+		d.Reason = ProtocolReasonPolicy
+	} else if p, ok := t.protocolSupport[host]; ok && t.protocolFresh(host) {
+		d.Protocol = p.String()
+		d.Expires = t.protocolExpiry[host]
+		d.Reason = ProtocolReasonDiscovered
+		if reason, ok := t.protocolPins[host]; ok {
+			d.Reason = reason
+		}
+	}
+	if l, ok := t.protocolLatency[host]; ok {
+		d.H2Latency, d.H2Samples = l.h2, l.h2Samples
+		d.H3Latency, d.H3Samples = l.h3, l.h3Samples
+	}
+	return d
+}
+
+// PinProtocol makes auto mode use p for host for ttl, overriding what it
+// learned. Latency measurements don't change a manual pin.
+func (t *Transport) PinProtocol(host string, p Protocol, ttl time.Duration) {
+	t.protocolSupportMu.Lock()
+	defer t.protocolSupportMu.Unlock()
+	t.protocolSupport[host] = p
+	t.protocolExpiry[host] = time.Now().Add(ttl)
+	t.setProtocolPin(host, ProtocolReasonManual)
+}
+
+// UnpinProtocol forgets what auto mode learned about host, pinned or not,
+// and any HTTP/3 failure, so its next request races again
+func (t *Transport) UnpinProtocol(host string) {
+	t.protocolSupportMu.Lock()
+	defer t.protocolSupportMu.Unlock()
+	delete(t.protocolSupport, host)
+	delete(t.protocolExpiry, host)
+	delete(t.protocolPins, host)
+	delete(t.protocolLatency, host)
+	delete(t.h3Failures, host)
+}
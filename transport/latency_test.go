@@ -0,0 +1,52 @@
+package transport
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sardanioss/httpcloak/protocol"
+)
+
+func TestLatencyPinning(t *testing.T) {
+	tr := &Transport{
+		protocolSupport: map[string]Protocol{"example.com": ProtocolHTTP3},
+		protocolExpiry:  map[string]time.Time{"example.com": time.Now().Add(time.Hour)},
+	}
+	sample := func(proto string, ms float64) {
+		tr.observeLatency("example.com", &Response{Protocol: proto, Timing: &protocol.Timing{FirstByte: ms}})
+	}
+
+	for i := 0; i < latencyMinSamples; i++ {
+		sample("h2", 50)
+		sample("h3", 60)
+	}
+	if d := tr.ProtocolDecision("example.com"); d.Protocol != "h3" || d.Reason != ProtocolReasonDiscovered || d.H3Samples != latencyMinSamples {
+		t.Fatalf("close latencies: %+v", d)
+	}
+
+	for i := 0; i < 5; i++ {
+		sample("h3", 200)
+	}
+	d := tr.ProtocolDecision("example.com")
+	if d.Protocol != "h2" || d.Reason != ProtocolReasonLatency {
+		t.Fatalf("slow HTTP/3: %+v", d)
+	}
+	if d.Expires.Before(time.Now().Add(latencyPinTTL - time.Minute)) {
+		t.Errorf("pin expires %v", d.Expires)
+	}
+
+	// A manual pin isn't overridden by measurements
+	tr.PinProtocol("example.com", ProtocolHTTP3, time.Hour)
+	for i := 0; i < 2*latencyMinSamples; i++ {
+		sample("h2", 10)
+		sample("h3", 500)
+	}
+	if d := tr.ProtocolDecision("example.com"); d.Protocol != "h3" || d.Reason != ProtocolReasonManual {
+		t.Fatalf("manual pin: %+v", d)
+	}
+
+	tr.UnpinProtocol("example.com")
+	if d := tr.ProtocolDecision("example.com"); d.Protocol != "" {
+		t.Fatalf("unpinned: %+v", d)
+	}
+}
@@ -0,0 +1,130 @@
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// DefaultMaxLineSize caps a single line read by LineReader when no limit is given
+const DefaultMaxLineSize = 16 << 20 // 16MB
+
+// ErrLineTooLong is returned when a line exceeds the LineReader's limit
+var ErrLineTooLong = errors.New("line exceeds maximum size")
+
+// LineReader reads newline-delimited records (NDJSON, JSON Lines, logs) from
+// a stream. Unlike bufio.Scanner it reports over-long lines as ErrLineTooLong
+// instead of stopping silently, and memory stays bounded by the longest line.
+// Reading is pull-based: nothing is read ahead of the caller.
+type LineReader struct {
+	r       *bufio.Reader
+	maxSize int
+	buf     []byte
+	line    int
+}
+
+// NewLineReader returns a LineReader over r. maxLineSize <= 0 uses
+// DefaultMaxLineSize.
+func NewLineReader(r io.Reader, maxLineSize int) *LineReader {
+	if maxLineSize <= 0 {
+		maxLineSize = DefaultMaxLineSize
+	}
+	return &LineReader{r: bufio.NewReaderSize(r, 64*1024), maxSize: maxLineSize}
+}
+
+// Next returns the next line without its "\n" or "\r\n" terminator. The slice
+// is only valid until the following call. A final line without a terminator
+// is returned as usual; io.EOF follows it.
+func (l *LineReader) Next() ([]byte, error) {
+	l.buf = l.buf[:0]
+	for {
+		chunk, err := l.r.ReadSlice('\n')
+		l.buf = append(l.buf, chunk...)
+
+		switch err {
+		case bufio.ErrBufferFull:
+			// Memory stays within maxSize plus one buffer
+			if len(l.buf) > l.maxSize+1 {
+				return nil, fmt.Errorf("line %d: %w", l.line+1, ErrLineTooLong)
+			}
+			continue
+		case nil:
+		case io.EOF:
+			if len(l.buf) == 0 {
+				return nil, io.EOF
+			}
+		default:
+			return nil, err
+		}
+
+		l.line++
+		line := trimLineEnding(l.buf)
+		if len(line) > l.maxSize {
+			return nil, fmt.Errorf("line %d: %w", l.line, ErrLineTooLong)
+		}
+		return line, nil
+	}
+}
+
+// Line returns the number of the line last returned by Next (1-based)
+func (l *LineReader) Line() int {
+	return l.line
+}
+
+func trimLineEnding(b []byte) []byte {
+	b = bytes.TrimSuffix(b, []byte("\n"))
+	return bytes.TrimSuffix(b, []byte("\r"))
+}
+
+// DecodeNDJSON sends each non-blank line of r to ch as a JSON value. It
+// blocks while ch is full, so a slow consumer slows down reading from the
+// network instead of growing memory. ch is closed on return. maxLineSize <= 0
+// uses DefaultMaxLineSize.
+func DecodeNDJSON(ctx context.Context, r io.Reader, ch chan<- json.RawMessage, maxLineSize int) error {
+	defer close(ch)
+
+	lines := NewLineReader(r, maxLineSize)
+	for {
+		line, err := lines.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		if !json.Valid(line) {
+			return fmt.Errorf("line %d: invalid JSON", lines.Line())
+		}
+
+		record := make(json.RawMessage, len(line))
+		copy(record, line)
+		select {
+		case ch <- record:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// LineReader returns a pull-based reader over the body's lines.
+// maxLineSize <= 0 uses DefaultMaxLineSize.
+func (r *StreamResponse) LineReader(maxLineSize int) *LineReader {
+	return NewLineReader(r.reader, maxLineSize)
+}
+
+// NDJSON streams the body as newline-delimited JSON, sending one record per
+// line to ch and closing ch when done. Blank lines are skipped; a line that
+// is not valid JSON or is longer than maxLineSize (<= 0 for
+// DefaultMaxLineSize) ends the stream with an error. Sending blocks until the
+// consumer is ready or ctx is cancelled. Close the response afterwards.
+func (r *StreamResponse) NDJSON(ctx context.Context, ch chan<- json.RawMessage, maxLineSize int) error {
+	return DecodeNDJSON(ctx, r.reader, ch, maxLineSize)
+}
@@ -0,0 +1,56 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestLineReader(t *testing.T) {
+	lr := NewLineReader(strings.NewReader("one\r\ntwo\n\nthree"), 0)
+	var got []string
+	for {
+		line, err := lr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		got = append(got, string(line))
+	}
+	want := []string{"one", "two", "", "three"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Fatalf("lines = %q, want %q", got, want)
+	}
+
+	lr = NewLineReader(strings.NewReader("short\n"+strings.Repeat("x", 200*1024)+"\nafter\n"), 100*1024)
+	if _, err := lr.Next(); err != nil {
+		t.Fatalf("first line: %v", err)
+	}
+	if _, err := lr.Next(); !errors.Is(err, ErrLineTooLong) {
+		t.Fatalf("expected ErrLineTooLong, got %v", err)
+	}
+}
+
+func TestDecodeNDJSON(t *testing.T) {
+	body := `{"id":1}` + "\n\n" + `{"id":2}` + "\n" + `not json` + "\n"
+	ch := make(chan json.RawMessage) // unbuffered: every send waits for the consumer
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- DecodeNDJSON(context.Background(), strings.NewReader(body), ch, 0) }()
+
+	var records []string
+	for rec := range ch {
+		records = append(records, string(rec))
+	}
+	if len(records) != 2 || records[1] != `{"id":2}` {
+		t.Fatalf("records = %q", records)
+	}
+	if err := <-errCh; err == nil || !strings.Contains(err.Error(), "line 4") {
+		t.Fatalf("expected invalid JSON error on line 4, got %v", err)
+	}
+}
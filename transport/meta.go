@@ -0,0 +1,23 @@
+package transport
+
+import "context"
+
+type requestMetaKey struct{}
+
+// WithRequestMeta returns a context carrying a request's caller metadata
+// (see Request.Meta), so hooks that receive the request's context can
+// correlate what they observe with the caller's job. A nil meta returns
+// ctx unchanged.
+func WithRequestMeta(ctx context.Context, meta map[string]any) context.Context {
+	if meta == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, requestMetaKey{}, meta)
+}
+
+// ContextRequestMeta returns the metadata of the request ctx belongs to, or
+// nil
+func ContextRequestMeta(ctx context.Context) map[string]any {
+	meta, _ := ctx.Value(requestMetaKey{}).(map[string]any)
+	return meta
+}
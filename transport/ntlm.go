@@ -0,0 +1,280 @@
+package transport
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"golang.org/x/crypto/md4"
+)
+
+// Authenticator runs one challenge-response handshake, such as NTLM or
+// Negotiate (SPNEGO/Kerberos). These handshakes authenticate a connection
+// rather than a request, so every round of one is sent on the same
+// connection.
+type Authenticator interface {
+	// Scheme is the auth-scheme of the headers, e.g. "NTLM" or "Negotiate"
+	Scheme() string
+
+	// Next returns the token to send, given the last token of the server:
+	// nil to start the handshake
+	Next(challenge []byte) ([]byte, error)
+}
+
+// AuthenticatorFunc starts a handshake with host, the proxy or origin being
+// authenticated to. A Kerberos authenticator derives its service principal
+// (HTTP/host) from it.
+type AuthenticatorFunc func(host string) (Authenticator, error)
+
+// maxAuthRounds bounds a handshake: NTLM takes two, Kerberos usually one
+const maxAuthRounds = 4
+
+// NTLMCredentials are the credentials of an NTLM account
+type NTLMCredentials struct {
+	// Domain of the account. May also be given as "DOMAIN\user" in Username.
+	Domain string
+
+	Username string
+	Password string
+
+	// Workstation is the client's name, sent for the server's logs
+	Workstation string
+}
+
+// NTLM authenticates with NTLMv2 under the "NTLM" scheme
+func NTLM(creds NTLMCredentials) AuthenticatorFunc {
+	return func(string) (Authenticator, error) {
+		return newNTLMAuth("NTLM", creds), nil
+	}
+}
+
+// NegotiateNTLM authenticates with NTLMv2 wrapped in SPNEGO under the
+// "Negotiate" scheme, as Windows clients do when Kerberos isn't available.
+// There is no built-in Kerberos: implement Authenticator with a GSSAPI or
+// SSPI library and pass it as the AuthenticatorFunc.
+func NegotiateNTLM(creds NTLMCredentials) AuthenticatorFunc {
+	return func(string) (Authenticator, error) {
+		return &spnegoNTLMAuth{ntlm: newNTLMAuth("Negotiate", creds)}, nil
+	}
+}
+
+// authChallenge finds the challenge for scheme among the lines of a
+// WWW-Authenticate or Proxy-Authenticate header. token is nil when the
+// scheme is offered without one.
+func authChallenge(values []string, scheme string) (token []byte, offered bool) {
+	for _, v := range values {
+		for _, c := range strings.Split(v, ",") {
+			c = strings.TrimSpace(c)
+			name, param, _ := strings.Cut(c, " ")
+			if !strings.EqualFold(name, scheme) {
+				continue
+			}
+			param = strings.TrimSpace(param)
+			if param == "" {
+				return nil, true
+			}
+			token, err := base64.StdEncoding.DecodeString(param)
+			if err != nil {
+				return nil, true
+			}
+			return token, true
+		}
+	}
+	return nil, false
+}
+
+// authHeader formats a token for an Authorization or Proxy-Authorization
+// header
+func authHeader(auth Authenticator, token []byte) string {
+	return auth.Scheme() + " " + base64.StdEncoding.EncodeToString(token)
+}
+
+// NTLM negotiate flags
+const (
+	ntlmNegotiateUnicode                 = 0x00000001
+	ntlmNegotiateOEM                     = 0x00000002
+	ntlmRequestTarget                    = 0x00000004
+	ntlmNegotiateNTLM                    = 0x00000200
+	ntlmNegotiateAlwaysSign              = 0x00008000
+	ntlmNegotiateExtendedSessionSecurity = 0x00080000
+	ntlmNegotiateTargetInfo              = 0x00800000
+	ntlmNegotiate128                     = 0x20000000
+	ntlmNegotiate56                      = 0x80000000
+
+	ntlmFlags = ntlmNegotiateUnicode | ntlmNegotiateOEM | ntlmRequestTarget |
+		ntlmNegotiateNTLM | ntlmNegotiateAlwaysSign | ntlmNegotiateExtendedSessionSecurity |
+		ntlmNegotiateTargetInfo | ntlmNegotiate128 | ntlmNegotiate56
+)
+
+// ntlmAvTimestamp is the AV pair ID of the server's time in target info
+const ntlmAvTimestamp = 7
+
+var ntlmSignature = []byte("NTLMSSP\x00")
+
+type ntlmAuth struct {
+	scheme string
+	creds  NTLMCredentials
+	round  int
+}
+
+func newNTLMAuth(scheme string, creds NTLMCredentials) *ntlmAuth {
+	if domain, user, ok := strings.Cut(creds.Username, `\`); ok && creds.Domain == "" {
+		creds.Domain, creds.Username = domain, user
+	}
+	return &ntlmAuth{scheme: scheme, creds: creds}
+}
+
+func (a *ntlmAuth) Scheme() string { return a.scheme }
+
+func (a *ntlmAuth) Next(challenge []byte) ([]byte, error) {
+	a.round++
+	switch a.round {
+	case 1:
+		return ntlmNegotiateMessage(), nil
+	case 2:
+		c, err := parseNTLMChallenge(challenge)
+		if err != nil {
+			return nil, err
+		}
+		var clientChallenge [8]byte
+		if _, err := rand.Read(clientChallenge[:]); err != nil {
+			return nil, err
+		}
+		return ntlmAuthenticateMessage(a.creds, c, clientChallenge[:], ntlmTimestamp(time.Now())), nil
+	default:
+		return nil, errors.New("ntlm: authentication rejected")
+	}
+}
+
+// ntlmNegotiateMessage returns the first message (type 1), without domain
+// or workstation
+func ntlmNegotiateMessage() []byte {
+	msg := make([]byte, 32)
+	copy(msg, ntlmSignature)
+	binary.LittleEndian.PutUint32(msg[8:], 1)
+	binary.LittleEndian.PutUint32(msg[12:], ntlmFlags)
+	return msg
+}
+
+// ntlmChallenge is the server's challenge message (type 2)
+type ntlmChallenge struct {
+	flags      uint32
+	challenge  []byte
+	targetInfo []byte
+}
+
+func parseNTLMChallenge(msg []byte) (*ntlmChallenge, error) {
+	if len(msg) < 32 || !bytes.Equal(msg[:8], ntlmSignature) || binary.LittleEndian.Uint32(msg[8:]) != 2 {
+		return nil, errors.New("ntlm: malformed challenge message")
+	}
+	c := &ntlmChallenge{
+		flags:     binary.LittleEndian.Uint32(msg[20:]),
+		challenge: msg[24:32],
+	}
+	if len(msg) >= 48 {
+		n := int(binary.LittleEndian.Uint16(msg[40:]))
+		off := int(binary.LittleEndian.Uint32(msg[44:]))
+		if off+n > len(msg) {
+			return nil, errors.New("ntlm: malformed target info")
+		}
+		c.targetInfo = msg[off : off+n]
+	}
+	return c, nil
+}
+
+// hasTimestamp reports whether the target info carries the server's time,
+// in which case the LMv2 response is left empty
+func (c *ntlmChallenge) hasTimestamp() bool {
+	for info := c.targetInfo; len(info) >= 4; {
+		id := binary.LittleEndian.Uint16(info)
+		n := int(binary.LittleEndian.Uint16(info[2:]))
+		if id == 0 || 4+n > len(info) {
+			return false
+		}
+		if id == ntlmAvTimestamp {
+			return true
+		}
+		info = info[4+n:]
+	}
+	return false
+}
+
+// ntlmTimestamp converts t to a FILETIME: 100ns ticks since 1601
+func ntlmTimestamp(t time.Time) []byte {
+	ts := make([]byte, 8)
+	binary.LittleEndian.PutUint64(ts, uint64(t.UnixNano()/100+116444736000000000))
+	return ts
+}
+
+// ntowfv2 derives the NTLMv2 response key from the credentials
+func ntowfv2(creds NTLMCredentials) []byte {
+	h := md4.New()
+	h.Write(utf16le(creds.Password))
+	return hmacMD5(h.Sum(nil), utf16le(strings.ToUpper(creds.Username)+creds.Domain))
+}
+
+// ntlmv2Responses computes the NT and LM responses to a challenge
+func ntlmv2Responses(key []byte, c *ntlmChallenge, clientChallenge, timestamp []byte) (nt, lm []byte) {
+	temp := make([]byte, 0, 28+len(c.targetInfo)+4)
+	temp = append(temp, 1, 1, 0, 0, 0, 0, 0, 0)
+	temp = append(temp, timestamp...)
+	temp = append(temp, clientChallenge...)
+	temp = append(temp, 0, 0, 0, 0)
+	temp = append(temp, c.targetInfo...)
+	temp = append(temp, 0, 0, 0, 0)
+
+	proof := hmacMD5(key, append(append([]byte{}, c.challenge...), temp...))
+	nt = append(proof, temp...)
+	if c.hasTimestamp() {
+		lm = make([]byte, 24)
+	} else {
+		lm = append(hmacMD5(key, append(append([]byte{}, c.challenge...), clientChallenge...)), clientChallenge...)
+	}
+	return nt, lm
+}
+
+// ntlmAuthenticateMessage returns the last message (type 3)
+func ntlmAuthenticateMessage(creds NTLMCredentials, c *ntlmChallenge, clientChallenge, timestamp []byte) []byte {
+	nt, lm := ntlmv2Responses(ntowfv2(creds), c, clientChallenge, timestamp)
+	fields := [][]byte{lm, nt, utf16le(creds.Domain), utf16le(creds.Username), utf16le(creds.Workstation), nil}
+
+	msg := make([]byte, 64)
+	copy(msg, ntlmSignature)
+	binary.LittleEndian.PutUint32(msg[8:], 3)
+	for i, f := range fields {
+		at := 12 + 8*i
+		binary.LittleEndian.PutUint16(msg[at:], uint16(len(f)))
+		binary.LittleEndian.PutUint16(msg[at+2:], uint16(len(f)))
+		binary.LittleEndian.PutUint32(msg[at+4:], uint32(len(msg)))
+		msg = append(msg, f...)
+	}
+	binary.LittleEndian.PutUint32(msg[60:], (c.flags&ntlmFlags)|ntlmNegotiateUnicode)
+	return msg
+}
+
+func hmacMD5(key, data []byte) []byte {
+	h := hmac.New(md5.New, key)
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+func utf16le(s string) []byte {
+	units := utf16.Encode([]rune(s))
+	b := make([]byte, 2*len(units))
+	for i, u := range units {
+		binary.LittleEndian.PutUint16(b[2*i:], u)
+	}
+	return b
+}
+
+// errAuthRounds is returned when a handshake doesn't finish in
+// maxAuthRounds
+var errAuthRounds = fmt.Errorf("authentication did not complete in %d rounds", maxAuthRounds)
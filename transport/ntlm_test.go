@@ -0,0 +1,206 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// MS-NLMP 4.2.4, NTLMv2 authentication
+func TestNTLMv2Responses(t *testing.T) {
+	creds := NTLMCredentials{Domain: "Domain", Username: "User", Password: "Password"}
+	key := ntowfv2(creds)
+	if got := hex.EncodeToString(key); got != "0c868a403bfd7a93a3001ef22ef02e3f" {
+		t.Fatalf("NTOWFv2 = %s", got)
+	}
+
+	var targetInfo []byte
+	for _, av := range []struct {
+		id    uint16
+		value string
+	}{{2, "Domain"}, {1, "Server"}} {
+		v := utf16le(av.value)
+		targetInfo = binary.LittleEndian.AppendUint16(targetInfo, av.id)
+		targetInfo = binary.LittleEndian.AppendUint16(targetInfo, uint16(len(v)))
+		targetInfo = append(targetInfo, v...)
+	}
+	targetInfo = append(targetInfo, 0, 0, 0, 0)
+
+	serverChallenge, _ := hex.DecodeString("0123456789abcdef")
+	clientChallenge := bytes.Repeat([]byte{0xaa}, 8)
+	c := &ntlmChallenge{challenge: serverChallenge, targetInfo: targetInfo}
+
+	nt, lm := ntlmv2Responses(key, c, clientChallenge, make([]byte, 8))
+	if got := hex.EncodeToString(nt[:16]); got != "68cd0ab851e51c96aabc927bebef6a1c" {
+		t.Errorf("NTProofStr = %s", got)
+	}
+	if got := hex.EncodeToString(lm); got != "86c35097ac9cec102554764a57cccc19aaaaaaaaaaaaaaaa" {
+		t.Errorf("LMv2 = %s", got)
+	}
+}
+
+func TestNTLMHandshake(t *testing.T) {
+	auth := newNTLMAuth("NTLM", NTLMCredentials{Username: `CORP\alice`, Password: "secret"})
+	if auth.creds.Domain != "CORP" || auth.creds.Username != "alice" {
+		t.Fatalf("credentials = %+v", auth.creds)
+	}
+
+	negotiate, err := auth.Next(nil)
+	if err != nil || !bytes.HasPrefix(negotiate, ntlmSignature) || negotiate[8] != 1 {
+		t.Fatalf("negotiate = %x, %v", negotiate, err)
+	}
+
+	challenge := make([]byte, 48)
+	copy(challenge, ntlmSignature)
+	challenge[8] = 2
+	binary.LittleEndian.PutUint32(challenge[20:], ntlmFlags)
+	authenticate, err := auth.Next(challenge)
+	if err != nil || !bytes.HasPrefix(authenticate, ntlmSignature) || authenticate[8] != 3 {
+		t.Fatalf("authenticate = %x, %v", authenticate, err)
+	}
+	// The user name field points at "alice"
+	n := binary.LittleEndian.Uint16(authenticate[36:])
+	off := binary.LittleEndian.Uint32(authenticate[40:])
+	if got := authenticate[off : off+uint32(n)]; !bytes.Equal(got, utf16le("alice")) {
+		t.Errorf("user = %x", got)
+	}
+
+	if _, err := auth.Next(challenge); err == nil {
+		t.Error("third round succeeded")
+	}
+	if _, err := parseNTLMChallenge([]byte("NTLMSSP\x00")); err == nil {
+		t.Error("short challenge parsed")
+	}
+}
+
+func TestNegotiateNTLMSPNEGO(t *testing.T) {
+	auth, _ := NegotiateNTLM(NTLMCredentials{Username: "alice", Password: "secret"})("")
+	if auth.Scheme() != "Negotiate" {
+		t.Fatalf("scheme = %s", auth.Scheme())
+	}
+
+	// GSS-API InitialContextToken: SPNEGO OID, then a NegTokenInit offering NTLM
+	first, err := auth.Next(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gss asn1.RawValue
+	if _, err := asn1.Unmarshal(first, &gss); err != nil || gss.Class != asn1.ClassApplication || gss.Tag != 0 {
+		t.Fatalf("init token = %x, %v", first, err)
+	}
+	var oid asn1.ObjectIdentifier
+	rest, err := asn1.Unmarshal(gss.Bytes, &oid)
+	if err != nil || !oid.Equal(oidSPNEGO) {
+		t.Fatalf("mechanism = %v, %v", oid, err)
+	}
+	var wrapped asn1.RawValue
+	var init negTokenInit
+	if _, err := asn1.Unmarshal(rest, &wrapped); err != nil || wrapped.Tag != 0 {
+		t.Fatalf("NegTokenInit wrapper: %v", err)
+	}
+	if _, err := asn1.Unmarshal(wrapped.Bytes, &init); err != nil {
+		t.Fatal(err)
+	}
+	if len(init.MechTypes) != 1 || !init.MechTypes[0].Equal(oidNTLMSSP) || !bytes.HasPrefix(init.MechToken, ntlmSignature) || init.MechToken[8] != 1 {
+		t.Fatalf("NegTokenInit = %+v", init)
+	}
+
+	challenge := make([]byte, 48)
+	copy(challenge, ntlmSignature)
+	challenge[8] = 2
+	respToken := func(state asn1.Enumerated, token []byte) []byte {
+		inner, _ := asn1.Marshal(negTokenResp{NegState: state, SupportedMech: oidNTLMSSP, ResponseToken: token})
+		b, _ := asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 1, IsCompound: true, Bytes: inner})
+		return b
+	}
+
+	second, err := auth.Next(respToken(1, challenge))
+	if err != nil {
+		t.Fatal(err)
+	}
+	authenticate, err := parseSPNEGOResp(second)
+	if err != nil || !bytes.HasPrefix(authenticate, ntlmSignature) || authenticate[8] != 3 {
+		t.Fatalf("authenticate = %x, %v", second, err)
+	}
+
+	if _, err := parseSPNEGOResp(respToken(spnegoReject, nil)); err == nil {
+		t.Error("rejection parsed")
+	}
+
+	// Servers answering in bare NTLM get bare NTLM back
+	auth, _ = NegotiateNTLM(NTLMCredentials{Username: "alice", Password: "secret"})("")
+	auth.Next(nil)
+	if raw, err := auth.Next(challenge); err != nil || !bytes.HasPrefix(raw, ntlmSignature) {
+		t.Errorf("bare NTLM answer = %x, %v", raw, err)
+	}
+}
+
+func TestAuthChallenge(t *testing.T) {
+	values := []string{`Basic realm="corp"`, "Negotiate", "NTLM TlRMTVNTUAACAAAA"}
+	if token, ok := authChallenge(values, "ntlm"); !ok || !bytes.HasPrefix(token, ntlmSignature) {
+		t.Errorf("NTLM = %q, %v", token, ok)
+	}
+	if token, ok := authChallenge(values, "Negotiate"); !ok || token != nil {
+		t.Errorf("Negotiate = %q, %v", token, ok)
+	}
+	if _, ok := authChallenge(values, "Digest"); ok {
+		t.Error("Digest offered")
+	}
+}
+
+// spnegoStub stands in for a GSSAPI/SSPI Kerberos provider: one round, with
+// a token bound to the service principal
+type spnegoStub struct{ spn string }
+
+func (a *spnegoStub) Scheme() string { return "Negotiate" }
+
+func (a *spnegoStub) Next(challenge []byte) ([]byte, error) {
+	if challenge != nil {
+		return nil, errors.New("spnego: authentication rejected")
+	}
+	return []byte("ticket:" + a.spn), nil
+}
+
+func TestServerAuthKerberosProvider(t *testing.T) {
+	want := "Negotiate " + base64.StdEncoding.EncodeToString([]byte("ticket:HTTP/127.0.0.1"))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != want {
+			w.Header().Set("WWW-Authenticate", "Negotiate")
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("WWW-Authenticate", "Negotiate "+base64.StdEncoding.EncodeToString([]byte("mutual")))
+	}))
+	defer srv.Close()
+
+	var hosts []string
+	tr := NewTransportWithConfig("chrome-143", nil, &TransportConfig{
+		ServerAuth: func(host string) (Authenticator, error) {
+			hosts = append(hosts, host)
+			return &spnegoStub{spn: "HTTP/" + host}, nil
+		},
+	})
+	defer tr.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	resp, err := tr.Do(ctx, &Request{Method: "GET", URL: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want 200 once the provider's ticket is sent", resp.StatusCode)
+	}
+	if len(hosts) != 1 || hosts[0] != "127.0.0.1" {
+		t.Errorf("provider started for %v, want one handshake with 127.0.0.1", hosts)
+	}
+}
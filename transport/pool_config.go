@@ -0,0 +1,208 @@
+package transport
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// PoolConfig tunes connection pooling. Zero fields keep the defaults.
+type PoolConfig struct {
+	// MaxIdleConnsPerHost is how many idle HTTP/1.1 connections are kept
+	// per host. Default: 6, as browsers do.
+	MaxIdleConnsPerHost int
+
+	// MaxConnsPerHost caps the HTTP/1.1 connections open to a host, idle
+	// and streaming ones included. Requests beyond it wait for one to go
+	// idle or close. Default: no limit.
+	MaxConnsPerHost int
+
+	// IdleConnTimeout closes HTTP/1.1 and HTTP/2 connections idle this
+	// long (HTTP/3 uses QuicIdleTimeout). Default: 90s.
+	IdleConnTimeout time.Duration
+
+	// MaxConnLifetime retires HTTP/1.1 and HTTP/2 connections this old: no
+	// new request is sent on them. Default: 5m for HTTP/2, none for
+	// HTTP/1.1.
+	MaxConnLifetime time.Duration
+}
+
+// pool returns the pool settings, zero for defaults. Safe on a nil config.
+func (c *TransportConfig) pool() PoolConfig {
+	if c == nil {
+		return PoolConfig{}
+	}
+	return c.Pool
+}
+
+// OriginPoolStats describes the connections to one origin over one
+// protocol
+type OriginPoolStats struct {
+	Origin   string // scheme://host:port, or proxy://host:port for requests forwarded by an HTTP proxy
+	Protocol string // "h1", "h2" or "h3"
+	Open     int    // Connections open, idle ones included
+	Idle     int    // Connections carrying no request (not reported for HTTP/3)
+	Resumed  int    // Connections that resumed a TLS session
+}
+
+// PoolStats reports the open connections per origin and protocol, sorted
+// by origin. Connections leaking from unclosed response bodies show up as
+// open but not idle.
+func (t *Transport) PoolStats() []OriginPoolStats {
+	var stats []OriginPoolStats
+	stats = append(stats, t.h1Transport.poolStats()...)
+	stats = append(stats, t.h2Transport.poolStats()...)
+	stats = append(stats, t.h3Transport.poolStats()...)
+	sort.SliceStable(stats, func(i, j int) bool {
+		if stats[i].Origin != stats[j].Origin {
+			return stats[i].Origin < stats[j].Origin
+		}
+		return stats[i].Protocol < stats[j].Protocol
+	})
+	return stats
+}
+
+// poolStats reports the HTTP/1.1 connections per pool key
+func (t *HTTP1Transport) poolStats() []OriginPoolStats {
+	t.idleConnsMu.Lock()
+	defer t.idleConnsMu.Unlock()
+	t.conns.mu.Lock()
+	defer t.conns.mu.Unlock()
+
+	var stats []OriginPoolStats
+	for key, open := range t.conns.open {
+		s := OriginPoolStats{Origin: key, Protocol: "h1", Open: len(open), Idle: len(t.idleConns[key])}
+		for conn := range open {
+			if conn.tlsConn != nil && conn.tlsConn.ConnectionState().DidResume {
+				s.Resumed++
+			}
+		}
+		stats = append(stats, s)
+	}
+	return stats
+}
+
+// poolStats reports the HTTP/2 connection to each host
+func (t *HTTP2Transport) poolStats() []OriginPoolStats {
+	t.connsMu.RLock()
+	defer t.connsMu.RUnlock()
+
+	var stats []OriginPoolStats
+	for key, conn := range t.conns {
+		s := OriginPoolStats{Origin: "https://" + key, Protocol: "h2", Open: 1}
+		conn.mu.Lock()
+		if conn.inFlight == 0 {
+			s.Idle = 1
+		}
+		if conn.sessionResumed {
+			s.Resumed = 1
+		}
+		conn.mu.Unlock()
+		stats = append(stats, s)
+	}
+	return stats
+}
+
+// connTracker keeps the open HTTP/1.1 connections per pool key and holds
+// them to MaxConnsPerHost
+type connTracker struct {
+	mu      sync.Mutex
+	max     int // 0 for no limit
+	open    map[string]map[*http1Conn]struct{}
+	pending map[string]int // Connections being dialed
+	freed   chan struct{}  // Closed, and replaced, when a connection closes or goes idle
+}
+
+func newConnTracker(max int) *connTracker {
+	return &connTracker{
+		max:     max,
+		open:    make(map[string]map[*http1Conn]struct{}),
+		pending: make(map[string]int),
+		freed:   make(chan struct{}),
+	}
+}
+
+// reserve claims a slot for a new connection to key. Without one free it
+// returns a channel closed once a connection to any host closes or goes
+// idle.
+func (c *connTracker) reserve(key string) (bool, <-chan struct{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.max > 0 && len(c.open[key])+c.pending[key] >= c.max {
+		return false, c.freed
+	}
+	c.pending[key]++
+	return true, nil
+}
+
+// add turns a reservation into an open connection, released when conn
+// closes
+func (c *connTracker) add(key string, conn *http1Conn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.pending[key]--; c.pending[key] == 0 {
+		delete(c.pending, key)
+	}
+	if c.open[key] == nil {
+		c.open[key] = make(map[*http1Conn]struct{})
+	}
+	c.open[key][conn] = struct{}{}
+	conn.release = func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		delete(c.open[key], conn)
+		if len(c.open[key]) == 0 {
+			delete(c.open, key)
+		}
+		c.wakeLocked()
+	}
+}
+
+// cancel gives up a reservation whose dial failed
+func (c *connTracker) cancel(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.pending[key]--; c.pending[key] == 0 {
+		delete(c.pending, key)
+	}
+	c.wakeLocked()
+}
+
+// wake tells waiting requests a connection went idle
+func (c *connTracker) wake() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.wakeLocked()
+}
+
+func (c *connTracker) wakeLocked() {
+	close(c.freed)
+	c.freed = make(chan struct{})
+}
+
+// newConn dials a connection to key once MaxConnsPerHost allows it. A
+// connection going idle while it waits is taken instead.
+func (t *HTTP1Transport) newConn(ctx context.Context, key, host, port, scheme string) (*http1Conn, error) {
+	for {
+		ok, wait := t.conns.reserve(key)
+		if ok {
+			break
+		}
+		select {
+		case <-wait:
+			if conn, _ := t.getIdleConn(key); conn != nil {
+				return conn, nil
+			}
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	conn, err := t.createConn(ctx, host, port, scheme)
+	if err != nil {
+		t.conns.cancel(key)
+		return nil, err
+	}
+	t.conns.add(key, conn)
+	return conn, nil
+}
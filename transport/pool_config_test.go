@@ -0,0 +1,38 @@
+package transport
+
+import "testing"
+
+func TestConnTrackerLimit(t *testing.T) {
+	tracker := newConnTracker(2)
+	const key = "https://example.com:443"
+
+	var conns []*http1Conn
+	for range 2 {
+		if ok, _ := tracker.reserve(key); !ok {
+			t.Fatal("reserve under the limit failed")
+		}
+		conn := &http1Conn{}
+		tracker.add(key, conn)
+		conns = append(conns, conn)
+	}
+	ok, wait := tracker.reserve(key)
+	if ok {
+		t.Fatal("reserve over the limit succeeded")
+	}
+	if ok, _ := tracker.reserve("https://other.example:443"); !ok {
+		t.Error("limit applied across hosts")
+	}
+
+	conns[0].close()
+	select {
+	case <-wait:
+	default:
+		t.Fatal("closing a connection didn't wake waiters")
+	}
+	if ok, _ := tracker.reserve(key); !ok {
+		t.Error("reserve after a close failed")
+	}
+	if n := len(tracker.open[key]); n != 1 {
+		t.Errorf("%d open connections tracked, want 1", n)
+	}
+}
@@ -0,0 +1,56 @@
+package transport
+
+import (
+	"context"
+	"net"
+	"net/url"
+)
+
+// Preconnect does the work of reaching rawURL's origin ahead of a request
+// to it: the DNS lookup and, for an https origin this transport would reach
+// over HTTP/2, the TCP and TLS handshakes, leaving the connection in the
+// pool. Origins spoken to over HTTP/1.1 or HTTP/3 only get the lookup. A
+// failed preconnect costs nothing; the request dials again.
+func (t *Transport) Preconnect(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	host, port := u.Hostname(), u.Port()
+	if err := t.hostFilter.Check(host); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+
+	if err := t.checkAddresses(ctx, host); err != nil {
+		return err
+	}
+
+	// Through a proxy the proxy resolves the host
+	if t.proxy == nil && t.dnsCache != nil && net.ParseIP(host) == nil {
+		if _, err := t.dnsCache.Resolve(ctx, host); err != nil {
+			return err
+		}
+	}
+	if u.Scheme != "https" {
+		return nil
+	}
+
+	proto := t.protocolFor(host)
+	if proto == ProtocolAuto {
+		known, ok := t.knownProtocol(host)
+		if !ok {
+			known = ProtocolHTTP2
+		}
+		proto = known
+	}
+	if proto != ProtocolHTTP2 || t.h2Transport == nil {
+		return nil
+	}
+	if port == "" {
+		port = "443"
+	}
+	return t.h2Transport.Preconnect(ctx, host, port)
+}
@@ -0,0 +1,47 @@
+package transport
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPreconnect(t *testing.T) {
+	var conns atomic.Int32
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.EnableHTTP2 = true
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	srv.StartTLS()
+	defer srv.Close()
+
+	tr := NewTransport("chrome-143")
+	defer tr.Close()
+	tr.SetInsecureSkipVerify(true)
+	tr.SetProtocol(ProtocolHTTP2)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := tr.Preconnect(ctx, srv.URL); err != nil {
+		t.Fatalf("Preconnect: %v", err)
+	}
+	if n := conns.Load(); n != 1 {
+		t.Fatalf("%d connections after preconnect, want 1", n)
+	}
+
+	resp, err := tr.Do(ctx, &Request{Method: "GET", URL: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Close()
+	if n := conns.Load(); n != 1 {
+		t.Errorf("request opened another connection (%d in all)", n)
+	}
+}
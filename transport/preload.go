@@ -0,0 +1,100 @@
+package transport
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/sardanioss/httpcloak/fingerprint"
+	utls "github.com/sardanioss/utls"
+)
+
+// spareUDP is the socket Preload binds for the next direct HTTP/3
+// transport, so its first dial skips the bind
+var spareUDP struct {
+	sync.Mutex
+	conn *net.UDPConn
+}
+
+// Preload does the one-time work behind a process's first request up
+// front: it loads the system root CAs, builds each preset's ClientHello
+// specs and a full TCP hello (generating its key shares, post-quantum ones
+// included), reads the resolver configuration and binds a UDP socket for
+// the first HTTP/3 transport. Nothing goes on the network. Calling it again
+// only redoes the cheap parts.
+func Preload(presets ...*fingerprint.Preset) error {
+	var errs []error
+	if _, err := x509.SystemCertPool(); err != nil {
+		errs = append(errs, fmt.Errorf("preload root CAs: %w", err))
+	}
+	for _, preset := range presets {
+		if err := preloadPreset(preset); err != nil {
+			errs = append(errs, fmt.Errorf("preload %s: %w", preset.Name, err))
+		}
+	}
+
+	// Parses /etc/hosts and resolv.conf; "localhost" never leaves them
+	net.DefaultResolver.LookupHost(context.Background(), "localhost")
+
+	if err := preloadUDP(); err != nil {
+		errs = append(errs, fmt.Errorf("preload UDP socket: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// preloadPreset builds preset's TCP and QUIC specs, and a TCP hello over a
+// pipe that is never written to
+func preloadPreset(preset *fingerprint.Preset) error {
+	if preset.QUICClientHelloID.Client != "" || preset.CustomQUICClientHelloSpec != nil {
+		if _, err := presetClientHelloSpec(preset, "h3"); err != nil {
+			return err
+		}
+	}
+	spec, err := presetClientHelloSpec(preset, "h2")
+	if err != nil {
+		return err
+	}
+	fingerprint.ApplySignatureAlgorithms(spec, preset)
+
+	local, remote := net.Pipe()
+	defer remote.Close()
+	defer local.Close()
+	conn := utls.UClient(local, &utls.Config{ServerName: "preload.invalid"}, utls.HelloCustom)
+	if err := conn.ApplyPreset(spec); err != nil {
+		return err
+	}
+	return conn.BuildHandshakeState()
+}
+
+// preloadUDP binds the spare socket, unless one is waiting already
+func preloadUDP() error {
+	spareUDP.Lock()
+	defer spareUDP.Unlock()
+	if spareUDP.conn != nil {
+		return nil
+	}
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4zero, Port: 0})
+	if err != nil {
+		return err
+	}
+	spareUDP.conn = conn
+	return nil
+}
+
+// listenUDP binds a direct HTTP/3 transport's socket, taking the one
+// Preload bound when any local address will do
+func listenUDP(network string, addr *net.UDPAddr) (*net.UDPConn, error) {
+	if network == "udp" && addr.IP.Equal(net.IPv4zero) && addr.Port == 0 {
+		spareUDP.Lock()
+		conn := spareUDP.conn
+		spareUDP.conn = nil
+		spareUDP.Unlock()
+		if conn != nil {
+			return conn, nil
+		}
+	}
+	return net.ListenUDP(network, addr)
+}
@@ -0,0 +1,57 @@
+package transport
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/sardanioss/httpcloak/fingerprint"
+)
+
+func TestPreloadSpareUDP(t *testing.T) {
+	if err := preloadUDP(); err != nil {
+		t.Skipf("no UDP: %v", err)
+	}
+	spare := spareUDP.conn
+
+	first, err := listenUDP("udp", &net.UDPAddr{IP: net.IPv4zero})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	if first != spare {
+		t.Error("first listen didn't take the preloaded socket")
+	}
+	second, err := listenUDP("udp", &net.UDPAddr{IP: net.IPv4zero})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+	if second == spare {
+		t.Error("preloaded socket handed out twice")
+	}
+}
+
+func TestPreloadPresets(t *testing.T) {
+	for _, name := range fingerprint.Available() {
+		if err := preloadPreset(fingerprint.Get(name)); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
+
+// BenchmarkPreload reports the first, cold call as cold-ms; run it on its
+// own (-run '^$' -bench Preload) so nothing else warmed the process first.
+// Later calls, the ns/op, are what a warm process pays.
+func BenchmarkPreload(b *testing.B) {
+	preset := fingerprint.Get("chrome-latest")
+	start := time.Now()
+	if err := Preload(preset); err != nil {
+		b.Fatal(err)
+	}
+	cold := time.Since(start)
+	for b.Loop() {
+		Preload(preset)
+	}
+	b.ReportMetric(float64(cold.Microseconds())/1000, "cold-ms")
+}
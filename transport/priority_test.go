@@ -0,0 +1,41 @@
+package transport
+
+import (
+	"testing"
+
+	http "github.com/sardanioss/http"
+	"github.com/sardanioss/httpcloak/fingerprint"
+)
+
+func TestRequestPriorityOverride(t *testing.T) {
+	tests := []struct {
+		preset   string
+		protocol string
+		override fingerprint.Priority
+		want     string
+	}{
+		{"chrome-143", "h3", fingerprint.Priority{Urgency: 2, Incremental: true}, "u=2, i"},
+		{"chrome-143", "h2", fingerprint.Priority{Urgency: 3}, ""}, // Defaults; no header
+		{"chrome-143", "h1", fingerprint.Priority{Urgency: 0}, ""}, // Chrome sends none on HTTP/1.1
+		{"firefox-147-linux", "h1", fingerprint.Priority{Urgency: 4}, "u=4"},
+		{"safari-18", "h2", fingerprint.Priority{Urgency: 1}, ""},
+	}
+	for _, tt := range tests {
+		preset := fingerprint.Get(tt.preset)
+		headers := map[string][]string{"Sec-Fetch-Dest": {"image"}}
+		httpReq := &http.Request{Header: make(http.Header)}
+		applyPresetHeaders(httpReq, preset, nil, false, tt.protocol)
+		applyRequestPriority(httpReq, preset, headers, &tt.override, false, tt.protocol)
+		if got := httpReq.Header.Get("Priority"); got != tt.want {
+			t.Errorf("%s over %s with %+v: Priority %q, want %q", tt.preset, tt.protocol, tt.override, got, tt.want)
+		}
+	}
+
+	// A Priority header set by the caller wins
+	preset := fingerprint.Get("chrome-143")
+	httpReq := &http.Request{Header: http.Header{"Priority": {"u=5"}}}
+	applyRequestPriority(httpReq, preset, map[string][]string{"Priority": {"u=5"}}, &fingerprint.Priority{Urgency: 0}, false, "h3")
+	if got := httpReq.Header.Get("Priority"); got != "u=5" {
+		t.Errorf("caller's header replaced with %q", got)
+	}
+}
@@ -0,0 +1,107 @@
+package transport
+
+import (
+	"strings"
+	"time"
+)
+
+// defaultH3FailureBackoff is how long auto mode leaves HTTP/3 alone for an
+// origin where it failed. Chrome marks a broken alternative service for 5
+// minutes the first time.
+const defaultH3FailureBackoff = 5 * time.Minute
+
+// SetProtocolPolicy forces the protocol for some hosts. Keys are host
+// patterns matched like HostFilter's ("example.com" includes its
+// subdomains, "*" matches every host); the most specific matching pattern
+// wins. Hosts matching no pattern use the transport's protocol, and a
+// pattern mapped to ProtocolAuto puts its hosts back on auto-negotiation.
+// nil removes the policy.
+func (t *Transport) SetProtocolPolicy(policy map[string]Protocol) {
+	if len(policy) == 0 {
+		t.protocolPolicy = nil
+		return
+	}
+	t.protocolPolicy = make(map[string]Protocol, len(policy))
+	for pattern, p := range policy {
+		t.protocolPolicy[pattern] = p
+	}
+}
+
+// SetH3FailureBackoff sets how long auto mode skips HTTP/3 for an origin
+// after it failed there, going straight to HTTP/2; a learned or pinned
+// HTTP/3 choice for the origin is dropped. 0 restores the default (5
+// minutes); negative turns the memory off.
+func (t *Transport) SetH3FailureBackoff(d time.Duration) {
+	t.h3FailureBackoff = d
+}
+
+// protocolFor returns the protocol for requests to host: the policy's, or
+// the transport's
+func (t *Transport) protocolFor(host string) Protocol {
+	if p, ok := policyProtocol(t.protocolPolicy, host); ok {
+		return p
+	}
+	return t.protocol
+}
+
+// policyProtocol returns the protocol of the most specific pattern in
+// policy matching host
+func policyProtocol(policy map[string]Protocol, host string) (Protocol, bool) {
+	var best string
+	var protocol Protocol
+	found := false
+	for pattern, p := range policy {
+		if !hostMatchesAny(host, []string{pattern}) {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSuffix(strings.TrimPrefix(pattern, "*."), "."))
+		if key == "*" {
+			key = ""
+		}
+		if !found || len(key) > len(best) || (len(key) == len(best) && key < best) {
+			best, protocol, found = key, p, true
+		}
+	}
+	return protocol, found
+}
+
+// markH3Failed remembers that HTTP/3 failed for host, and forgets HTTP/3 if
+// auto mode had settled on it. It returns false when the memory is off.
+func (t *Transport) markH3Failed(host string) bool {
+	backoff := t.h3FailureBackoff
+	if backoff == 0 {
+		backoff = defaultH3FailureBackoff
+	}
+	if backoff < 0 || host == "" {
+		return false
+	}
+	t.protocolSupportMu.Lock()
+	defer t.protocolSupportMu.Unlock()
+	if t.h3Failures == nil {
+		t.h3Failures = make(map[string]time.Time)
+	}
+	t.h3Failures[host] = time.Now().Add(backoff)
+	if t.protocolSupport[host] == ProtocolHTTP3 {
+		delete(t.protocolSupport, host)
+		delete(t.protocolExpiry, host)
+		delete(t.protocolPins, host)
+	}
+	return true
+}
+
+// h3Failed reports whether HTTP/3 failed for host within the backoff
+func (t *Transport) h3Failed(host string) bool {
+	t.protocolSupportMu.RLock()
+	defer t.protocolSupportMu.RUnlock()
+	return t.h3FailedUntil(host).After(time.Now())
+}
+
+// h3FailedUntil returns when HTTP/3 is tried again for host, zero if it
+// hasn't failed. Called with protocolSupportMu held.
+func (t *Transport) h3FailedUntil(host string) time.Time {
+	until, ok := t.h3Failures[host]
+	if !ok || time.Now().After(until) {
+		return time.Time{}
+	}
+	return until
+}
@@ -0,0 +1,86 @@
+package transport
+
+import (
+	"testing"
+	"time"
+)
+
+func TestProtocolPolicy(t *testing.T) {
+	tr := &Transport{protocol: ProtocolAuto}
+	tr.SetProtocolPolicy(map[string]Protocol{
+		"example.com":     ProtocolHTTP2,
+		"api.example.com": ProtocolHTTP1,
+		"*.cdn.net":       ProtocolHTTP3,
+		"auto.cdn.net":    ProtocolAuto,
+	})
+
+	for host, want := range map[string]Protocol{
+		"example.com":        ProtocolHTTP2,
+		"www.example.com":    ProtocolHTTP2,
+		"api.example.com":    ProtocolHTTP1,
+		"v2.api.example.com": ProtocolHTTP1,
+		"img.cdn.net":        ProtocolHTTP3,
+		"auto.cdn.net":       ProtocolAuto,
+		"other.org":          ProtocolAuto,
+	} {
+		if got := tr.protocolFor(host); got != want {
+			t.Errorf("%s: got %s, want %s", host, got, want)
+		}
+	}
+
+	if d := tr.ProtocolDecision("api.example.com"); d.Protocol != "h1" || d.Reason != ProtocolReasonPolicy {
+		t.Errorf("decision: %+v", d)
+	}
+
+	// Hosts outside the policy keep a forced transport protocol
+	tr.SetProtocol(ProtocolHTTP2)
+	if got := tr.protocolFor("other.org"); got != ProtocolHTTP2 {
+		t.Errorf("other.org with forced h2: got %s", got)
+	}
+	if got := tr.protocolFor("auto.cdn.net"); got != ProtocolAuto {
+		t.Errorf("auto.cdn.net with forced h2: got %s", got)
+	}
+
+	tr.SetProtocolPolicy(nil)
+	if got := tr.protocolFor("api.example.com"); got != ProtocolHTTP2 {
+		t.Errorf("policy removed: got %s", got)
+	}
+}
+
+func TestH3FailureMemory(t *testing.T) {
+	tr := &Transport{
+		protocolSupport: map[string]Protocol{"example.com": ProtocolHTTP3},
+		protocolExpiry:  map[string]time.Time{"example.com": time.Now().Add(time.Hour)},
+	}
+
+	if !tr.markH3Failed("example.com") {
+		t.Fatal("failure not remembered")
+	}
+	if !tr.h3Failed("example.com") || tr.h3Failed("other.org") {
+		t.Fatal("h3Failed")
+	}
+	if _, known := tr.knownProtocol("example.com"); known {
+		t.Error("learned HTTP/3 kept after failure")
+	}
+	d := tr.ProtocolDecision("example.com")
+	if d.H3FailedUntil.Before(time.Now().Add(defaultH3FailureBackoff - time.Minute)) {
+		t.Errorf("failed until %v", d.H3FailedUntil)
+	}
+
+	tr.UnpinProtocol("example.com")
+	if tr.h3Failed("example.com") {
+		t.Error("failure kept after UnpinProtocol")
+	}
+
+	tr.SetH3FailureBackoff(time.Millisecond)
+	tr.markH3Failed("example.com")
+	time.Sleep(5 * time.Millisecond)
+	if tr.h3Failed("example.com") {
+		t.Error("failure outlived its backoff")
+	}
+
+	tr.SetH3FailureBackoff(-1)
+	if tr.markH3Failed("example.com") || tr.h3Failed("example.com") {
+		t.Error("failure remembered with the memory off")
+	}
+}
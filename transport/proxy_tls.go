@@ -0,0 +1,45 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/sardanioss/httpcloak/fingerprint"
+	utls "github.com/sardanioss/utls"
+)
+
+// DialProxyTLS runs the TLS handshake with an https:// proxy over conn. The
+// ClientHello is the preset's, so the hop to the proxy carries the same
+// fingerprint as the tunnelled connection, but ALPN offers only http/1.1
+// because CONNECT is sent over HTTP/1.1. conn is closed on failure.
+func DialProxyTLS(ctx context.Context, conn net.Conn, proxyHost string, preset *fingerprint.Preset, insecureSkipVerify bool) (net.Conn, error) {
+	tlsConfig := &utls.Config{
+		ServerName:         proxyHost,
+		NextProtos:         []string{"http/1.1"},
+		InsecureSkipVerify: insecureSkipVerify,
+		MinVersion:         utls.VersionTLS12,
+	}
+
+	var tlsConn *utls.UConn
+	if spec, err := PresetClientHelloSpec(preset, "h1"); err == nil && spec != nil {
+		for _, ext := range spec.Extensions {
+			if alpn, ok := ext.(*utls.ALPNExtension); ok {
+				alpn.AlpnProtocols = []string{"http/1.1"}
+			}
+		}
+		tlsConn = utls.UClient(conn, tlsConfig, utls.HelloCustom)
+		if err := tlsConn.ApplyPreset(spec); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("proxy TLS: failed to apply ClientHello: %w", err)
+		}
+	} else {
+		tlsConn = utls.UClient(conn, tlsConfig, utls.HelloChrome_Auto)
+	}
+
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("proxy TLS handshake with %s failed: %w", proxyHost, err)
+	}
+	return tlsConn, nil
+}
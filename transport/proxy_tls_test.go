@@ -0,0 +1,56 @@
+package transport
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sardanioss/httpcloak/fingerprint"
+)
+
+func TestDialProxyTLS(t *testing.T) {
+	alpn := make(chan string, 1)
+	proxy := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		alpn <- r.TLS.NegotiatedProtocol
+		if r.Method != http.MethodConnect || r.Host != "example.com:443" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	proxy.TLS = &tls.Config{NextProtos: []string{"h2", "http/1.1"}} // CONNECT must still use http/1.1
+	proxy.StartTLS()
+	defer proxy.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	raw, err := net.Dial("tcp", proxy.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := DialProxyTLS(ctx, raw, "127.0.0.1", fingerprint.Chrome143(), true)
+	if err != nil {
+		t.Fatalf("DialProxyTLS: %v", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte("CONNECT example.com:443 HTTP/1.1\r\nHost: example.com:443\r\n\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatalf("reading CONNECT response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("CONNECT status = %d, want 200", resp.StatusCode)
+	}
+	if got := <-alpn; got != "http/1.1" {
+		t.Errorf("negotiated ALPN = %q, want http/1.1", got)
+	}
+}
@@ -0,0 +1,20 @@
+//go:build !js && !wasip1
+
+package transport
+
+import "github.com/sardanioss/quic-go"
+
+// quicSupported reports whether this platform can send UDP datagrams.
+const quicSupported = true
+
+// QUICConfig is the quic-go configuration passed to TransportConfig.QUICConfigHook.
+type QUICConfig = quic.Config
+
+// applyQUICConfigHook runs QUICConfigHook if one is configured.
+// Safe to call on a nil config.
+func (c *TransportConfig) applyQUICConfigHook(host string, cfg *quic.Config) {
+	if c == nil || c.QUICConfigHook == nil || cfg == nil {
+		return
+	}
+	c.QUICConfigHook(host, cfg)
+}
@@ -0,0 +1,61 @@
+//go:build !js && !wasip1
+
+package transport
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/sardanioss/httpcloak/dns"
+	"github.com/sardanioss/httpcloak/fingerprint"
+)
+
+// TestQUICConfigHook dials a silent UDP server and checks that the hook
+// saw the host and that what it changed, the Initial packet size, is what
+// goes on the wire
+func TestQUICConfigHook(t *testing.T) {
+	var hosts []string
+	h3, err := NewHTTP3TransportWithTransportConfig(fingerprint.Get("chrome-143"), dns.NewCache(), &TransportConfig{
+		QUICConfigHook: func(host string, cfg *QUICConfig) {
+			hosts = append(hosts, host)
+			cfg.InitialPacketSize = 1350
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h3.Close()
+	if got := h3.quicConfig.InitialPacketSize; got == 1350 {
+		t.Fatalf("preset already uses %d-byte Initials; pick another size", got)
+	}
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	done := make(chan [][]byte, 1)
+	go func() { done <- echoInitials(conn, time.Now().Add(500*time.Millisecond)) }()
+
+	tlsCfg := h3.tlsConfig.Clone()
+	tlsCfg.ServerName = "example.com"
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	addr := conn.LocalAddr().(*net.UDPAddr)
+	h3.raceQUICDialWithECH(ctx, "example.com", nil, []*net.UDPAddr{addr}, tlsCfg, h3.quicConfig.Clone(), nil) // Times out
+
+	if len(hosts) != 1 || hosts[0] != "example.com" {
+		t.Errorf("hook called for %v, want example.com once", hosts)
+	}
+	datagrams := <-done
+	if len(datagrams) == 0 {
+		t.Fatal("no Initial packets received")
+	}
+	for i, d := range datagrams {
+		if len(d) != 1350 {
+			t.Errorf("datagram %d is %d bytes, want the hook's 1350", i, len(d))
+		}
+	}
+}
@@ -0,0 +1,86 @@
+//go:build !js && !wasip1
+
+package transport
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/sardanioss/httpcloak/fingerprint"
+	"github.com/sardanioss/quic-go"
+	tls "github.com/sardanioss/utls"
+)
+
+// echoInitials collects the datagrams a client sends to conn until the
+// deadline, without ever answering, so the client keeps retransmitting
+func echoInitials(conn net.PacketConn, deadline time.Time) [][]byte {
+	conn.SetReadDeadline(deadline)
+	var datagrams [][]byte
+	buf := make([]byte, 65536)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			return datagrams
+		}
+		datagrams = append(datagrams, append([]byte(nil), buf[:n]...))
+	}
+}
+
+// TestQUICInitialPacketsOnWire dials a silent UDP server with each HTTP/3
+// preset's QUIC config and checks every datagram of the first flight and
+// its retransmissions: a QUIC v1 Initial padded to exactly the preset's
+// packet size
+func TestQUICInitialPacketsOnWire(t *testing.T) {
+	custom := fingerprint.Chrome143()
+	custom.Name = "chrome-1350"
+	custom.QUICInitialSettings = &fingerprint.QUICInitialSettings{PacketSize: 1350, ChromeFrames: true}
+
+	presets := []*fingerprint.Preset{custom}
+	names := fingerprint.Available()
+	sort.Strings(names)
+	for _, name := range names {
+		if p := fingerprint.Get(name); p.SupportHTTP3 && p.QUICClientHelloID.Client != "" {
+			presets = append(presets, p)
+		}
+	}
+
+	for _, preset := range presets {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		done := make(chan [][]byte, 1)
+		go func() { done <- echoInitials(conn, time.Now().Add(500*time.Millisecond)) }()
+
+		cfg := &quic.Config{
+			ClientHelloID:           &preset.QUICClientHelloID,
+			TransportParameterOrder: quic.TransportParameterOrderChrome,
+		}
+		applyQUICInitial(cfg, preset)
+		tlsCfg := &tls.Config{ServerName: "example.com", NextProtos: []string{"h3"}, InsecureSkipVerify: true}
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		quic.DialAddr(ctx, conn.LocalAddr().String(), tlsCfg, cfg) // Times out: the server never answers
+		cancel()
+
+		datagrams := <-done
+		conn.Close()
+		if len(datagrams) == 0 {
+			t.Errorf("%s: no Initial packets received", preset.Name)
+			continue
+		}
+		want := int(preset.QUICInitial().PacketSize)
+		for i, d := range datagrams {
+			if len(d) != want {
+				t.Errorf("%s: datagram %d is %d bytes, want %d", preset.Name, i, len(d), want)
+			}
+			// Long header, fixed bit, packet type 0 (Initial), version 1
+			if len(d) < 5 || d[0]&0xf0 != 0xc0 || binary.BigEndian.Uint32(d[1:5]) != 1 {
+				t.Errorf("%s: datagram %d is not a QUIC v1 Initial", preset.Name, i)
+			}
+		}
+	}
+}
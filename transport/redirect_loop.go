@@ -0,0 +1,106 @@
+package transport
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	http "github.com/sardanioss/http"
+)
+
+// RedirectLoopError is returned when a redirect chain comes back to a URL it
+// already requested with the same method and Cookie header. Nothing changes
+// on the next lap, so following it would only use up the redirect limit. A
+// login page redirecting to itself usually means the server rejected the
+// cookies it set; CookieDeltas shows what each hop tried to set.
+type RedirectLoopError struct {
+	Method    string
+	URL       string          // URL requested again
+	History   []*RedirectInfo // Every redirect followed, in order
+	LoopStart int             // Index in History of the earlier request to URL
+}
+
+func (e *RedirectLoopError) Error() string {
+	msg := fmt.Sprintf("redirect loop: %s %s requested again with the same cookies after %d redirects (first at hop %d)",
+		e.Method, e.URL, len(e.History), e.LoopStart+1)
+	var set []string
+	for _, d := range e.CookieDeltas()[e.LoopStart:] {
+		set = append(set, d.Set...)
+	}
+	if len(set) > 0 {
+		msg += "; cookies set inside the loop: " + strings.Join(set, ", ")
+	}
+	return msg
+}
+
+// CookieDelta lists the cookies one redirect response set or cleared
+type CookieDelta struct {
+	URL     string
+	Set     []string // Names of cookies stored
+	Cleared []string // Names of cookies deleted (empty value, expired or Max-Age<=0)
+}
+
+// CookieDeltas returns the Set-Cookie changes of each hop in History
+func (e *RedirectLoopError) CookieDeltas() []CookieDelta {
+	deltas := make([]CookieDelta, len(e.History))
+	for i, hop := range e.History {
+		deltas[i] = SetCookieDelta(hop.URL, headerValues(hop.Headers, "Set-Cookie"))
+	}
+	return deltas
+}
+
+// FindRedirectLoop reports whether a request for method, url and cookie
+// repeats one already made in history, the redirects followed so far
+func FindRedirectLoop(history []*RedirectInfo, method, url, cookie string) *RedirectLoopError {
+	for i, hop := range history {
+		if hop.URL == url && hop.Method == method && hop.Cookie == cookie {
+			return &RedirectLoopError{Method: method, URL: url, History: history, LoopStart: i}
+		}
+	}
+	return nil
+}
+
+// SetCookieDelta summarizes Set-Cookie header values received from url
+func SetCookieDelta(url string, setCookies []string) CookieDelta {
+	delta := CookieDelta{URL: url}
+	for _, line := range setCookies {
+		parts := strings.Split(line, ";")
+		name, value, ok := strings.Cut(parts[0], "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			continue
+		}
+		cleared := strings.TrimSpace(value) == ""
+		for _, attr := range parts[1:] {
+			key, val, _ := strings.Cut(attr, "=")
+			key, val = strings.TrimSpace(key), strings.TrimSpace(val)
+			switch {
+			case strings.EqualFold(key, "Max-Age"):
+				if val != "" && (val[0] == '-' || strings.Trim(val, "0") == "") {
+					cleared = true
+				}
+			case strings.EqualFold(key, "Expires"):
+				if t, err := http.ParseTime(val); err == nil && t.Before(time.Now()) {
+					cleared = true
+				}
+			}
+		}
+		if cleared {
+			delta.Cleared = append(delta.Cleared, name)
+		} else {
+			delta.Set = append(delta.Set, name)
+		}
+	}
+	return delta
+}
+
+// headerValues returns all values of a header under any casing
+func headerValues(headers map[string][]string, name string) []string {
+	var values []string
+	for k, v := range headers {
+		if strings.EqualFold(k, name) {
+			values = append(values, v...)
+		}
+	}
+	return values
+}
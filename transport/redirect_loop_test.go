@@ -0,0 +1,52 @@
+package transport
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFindRedirectLoop(t *testing.T) {
+	history := []*RedirectInfo{
+		{StatusCode: 302, URL: "https://example.com/account", Method: "GET", Cookie: ""},
+		{
+			StatusCode: 302, URL: "https://example.com/login", Method: "GET", Cookie: "",
+			Headers: map[string][]string{"set-cookie": {
+				"sid=abc; Path=/; Secure; SameSite=None",
+				"old=; Max-Age=0",
+				"gone=x; Expires=Thu, 01 Jan 1970 00:00:00 GMT",
+			}},
+		},
+	}
+
+	// Same URL but the cookie was accepted: not a loop
+	if err := FindRedirectLoop(history, "GET", "https://example.com/account", "sid=abc"); err != nil {
+		t.Errorf("changed cookies reported as loop: %v", err)
+	}
+	// Same URL, different method: not a loop
+	if err := FindRedirectLoop(history, "POST", "https://example.com/account", ""); err != nil {
+		t.Errorf("different method reported as loop: %v", err)
+	}
+
+	loopErr := FindRedirectLoop(history, "GET", "https://example.com/account", "")
+	if loopErr == nil {
+		t.Fatal("expected loop")
+	}
+	var err error = loopErr
+	var target *RedirectLoopError
+	if !errors.As(err, &target) || target.LoopStart != 0 || len(target.History) != 2 {
+		t.Fatalf("RedirectLoopError = %+v", loopErr)
+	}
+	if !strings.Contains(err.Error(), "cookies set inside the loop: sid") {
+		t.Errorf("Error() = %q, want set cookie names", err.Error())
+	}
+
+	deltas := loopErr.CookieDeltas()
+	if len(deltas[0].Set) != 0 || len(deltas[0].Cleared) != 0 {
+		t.Errorf("hop 1 delta = %+v, want empty", deltas[0])
+	}
+	if !reflect.DeepEqual(deltas[1].Set, []string{"sid"}) || !reflect.DeepEqual(deltas[1].Cleared, []string{"old", "gone"}) {
+		t.Errorf("hop 2 delta = %+v", deltas[1])
+	}
+}
@@ -0,0 +1,101 @@
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/sardanioss/httpcloak/fingerprint"
+)
+
+// ErrUseLastResponse, returned by a RedirectFunc, stops following redirects:
+// the redirect response itself is returned, body unread, with no error
+var ErrUseLastResponse = errors.New("use last response")
+
+// RedirectMethods decides the method of the request that follows a redirect.
+// The zero value uses the session's setting, which defaults to browser
+// behavior.
+type RedirectMethods int
+
+const (
+	// RedirectMethodsBrowser does what browsers do: 307 and 308 replay the
+	// request, 303 switches to GET and 301/302 switch only POST to GET
+	RedirectMethodsBrowser RedirectMethods = iota + 1
+
+	// RedirectMethodsPreserve replays the method and body on every
+	// redirect, like curl's --post301/--post302/--post303
+	RedirectMethodsPreserve
+
+	// RedirectMethodsGET follows every redirect with a GET without a body,
+	// 307 and 308 included (HEAD stays HEAD)
+	RedirectMethodsGET
+)
+
+// String returns the policy name used in session config
+func (m RedirectMethods) String() string {
+	switch m {
+	case RedirectMethodsBrowser:
+		return "browser"
+	case RedirectMethodsPreserve:
+		return "preserve"
+	case RedirectMethodsGET:
+		return "get"
+	}
+	return ""
+}
+
+// ParseRedirectMethods parses a policy name; "" is the zero value
+func ParseRedirectMethods(name string) (RedirectMethods, error) {
+	switch strings.ToLower(name) {
+	case "":
+		return 0, nil
+	case "browser":
+		return RedirectMethodsBrowser, nil
+	case "preserve":
+		return RedirectMethodsPreserve, nil
+	case "get":
+		return RedirectMethodsGET, nil
+	}
+	return 0, fmt.Errorf("unknown redirect method policy %q", name)
+}
+
+// Method returns the method to follow a redirect with status with, after a
+// request made with method
+func (m RedirectMethods) Method(status int, method string) string {
+	switch m {
+	case RedirectMethodsPreserve:
+		return method
+	case RedirectMethodsGET:
+		if method == "HEAD" {
+			return method
+		}
+		return "GET"
+	}
+	return fingerprint.RedirectMethod(status, method)
+}
+
+// RedirectHop is the request about to be made to follow a redirect. A
+// RedirectFunc may change Method, URL and Headers; the request body goes
+// along only if Method is still the method of the redirected request.
+// Cookies are added from the jar after the callback, for the final URL.
+type RedirectHop struct {
+	StatusCode int                 // Status of the redirect response
+	Method     string              // Method of the next request
+	URL        string              // Location, resolved against the current URL
+	Headers    map[string][]string // Headers of the next request
+	Via        []*RedirectInfo     // Redirects so far, the one being followed last
+	Meta       map[string]any      // The original request's Meta
+}
+
+// RedirectFunc approves each redirect before it is followed. Returning
+// ErrUseLastResponse stops at the redirect response; any other error is
+// returned from the request.
+type RedirectFunc func(hop *RedirectHop) error
+
+// RedirectPolicy overrides the session's redirect settings for one request
+type RedirectPolicy struct {
+	Follow       *bool           // nil: session setting
+	MaxRedirects int             // 0: session setting
+	Methods      RedirectMethods // 0: session setting
+	OnRedirect   RedirectFunc    // Runs after the session's callback, if any
+}
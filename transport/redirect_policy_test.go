@@ -0,0 +1,34 @@
+package transport
+
+import "testing"
+
+func TestRedirectMethods(t *testing.T) {
+	tests := []struct {
+		methods RedirectMethods
+		status  int
+		method  string
+		want    string
+	}{
+		{0, 302, "POST", "GET"},
+		{RedirectMethodsBrowser, 307, "POST", "POST"},
+		{RedirectMethodsBrowser, 301, "PUT", "PUT"},
+		{RedirectMethodsPreserve, 303, "POST", "POST"},
+		{RedirectMethodsPreserve, 302, "POST", "POST"},
+		{RedirectMethodsGET, 308, "POST", "GET"},
+		{RedirectMethodsGET, 307, "HEAD", "HEAD"},
+	}
+	for _, tt := range tests {
+		if got := tt.methods.Method(tt.status, tt.method); got != tt.want {
+			t.Errorf("%v.Method(%d, %s) = %s, want %s", tt.methods, tt.status, tt.method, got, tt.want)
+		}
+	}
+
+	for _, m := range []RedirectMethods{RedirectMethodsBrowser, RedirectMethodsPreserve, RedirectMethodsGET} {
+		if got, err := ParseRedirectMethods(m.String()); err != nil || got != m {
+			t.Errorf("ParseRedirectMethods(%q) = %v, %v", m.String(), got, err)
+		}
+	}
+	if _, err := ParseRedirectMethods("follow"); err == nil {
+		t.Error("ParseRedirectMethods accepted an unknown policy")
+	}
+}
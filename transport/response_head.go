@@ -0,0 +1,212 @@
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	http "github.com/sardanioss/http"
+)
+
+// errNULInResponseHead mirrors Chrome, which fails a response whose headers
+// contain a NUL byte rather than guess where the header ends
+var errNULInResponseHead = errors.New("malformed HTTP response: NUL byte in headers")
+
+// readResponse reads an HTTP/1.x response from br. net/textproto rejects
+// header blocks that browsers load fine; those are rewritten first (see
+// sanitizeResponseHead). Well-formed responses are read directly.
+func readResponse(br *bufio.Reader, req *http.Request) (*http.Response, error) {
+	head := peekResponseHead(br)
+	if head == nil {
+		return http.ReadResponse(br, req)
+	}
+	clean, changed, err := sanitizeResponseHead(head)
+	if err != nil {
+		return nil, err
+	}
+	if !changed {
+		return http.ReadResponse(br, req)
+	}
+
+	br.Discard(len(head))
+	resp, err := http.ReadResponse(bufio.NewReader(io.MultiReader(bytes.NewReader(clean), br)), req)
+	if resp != nil {
+		// The wrapping reader can buffer past this response, so the
+		// connection can't be handed to the next request
+		resp.Close = true
+	}
+	return resp, err
+}
+
+// peekResponseHead returns the status line and headers, through the blank
+// line, without consuming them. It returns nil if the head doesn't fit in
+// br's buffer or the connection fails first.
+func peekResponseHead(br *bufio.Reader) []byte {
+	if _, err := br.Peek(1); err != nil {
+		return nil
+	}
+	for {
+		buf, _ := br.Peek(br.Buffered())
+		if end := responseHeadEnd(buf); end > 0 {
+			return buf[:end]
+		}
+		if br.Buffered() >= br.Size() {
+			return nil
+		}
+		if _, err := br.Peek(br.Buffered() + 1); err != nil {
+			return nil
+		}
+	}
+}
+
+// responseHeadEnd returns the length of the head in buf up to and including
+// the first empty line (CRLF or bare LF), or 0 if it isn't complete
+func responseHeadEnd(buf []byte) int {
+	pos := 0
+	for {
+		i := bytes.IndexByte(buf[pos:], '\n')
+		if i < 0 {
+			return 0
+		}
+		line := bytes.TrimSuffix(buf[pos:pos+i], []byte("\r"))
+		if len(line) == 0 && pos > 0 {
+			return pos + i + 1
+		}
+		pos += i + 1
+	}
+}
+
+// sanitizeResponseHead rewrites a response head the way Chrome's parser
+// reads it: lines without a colon or with an invalid field name are
+// skipped, whitespace before the colon is dropped, obs-fold continuations
+// are joined with a space, control bytes in values become spaces, and
+// repeated equal Content-Length values ("42, 42") collapse to one. changed
+// reports whether the result differs from what net/textproto accepts as is.
+func sanitizeResponseHead(head []byte) (clean []byte, changed bool, err error) {
+	if bytes.IndexByte(head, 0) >= 0 {
+		return nil, false, errNULInResponseHead
+	}
+
+	lines := strings.Split(strings.TrimRight(string(head), "\r\n"), "\n")
+	for i := range lines {
+		lines[i] = strings.TrimSuffix(lines[i], "\r")
+	}
+
+	type field struct{ name, value string }
+	var fields []field
+	for _, line := range lines[1:] {
+		if line[0] == ' ' || line[0] == '\t' {
+			if len(fields) == 0 {
+				changed = true // textproto rejects a folded first line
+				continue
+			}
+			fields[len(fields)-1].value += " " + strings.Trim(line, " \t")
+			continue
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			changed = true
+			continue
+		}
+		if trimmed := strings.TrimRight(name, " \t"); trimmed != name {
+			name = trimmed
+			changed = true
+		}
+		if !validFieldName(name) {
+			changed = true
+			continue
+		}
+		fields = append(fields, field{name, strings.Trim(value, " \t")})
+	}
+
+	var contentLength string
+	for i := range fields {
+		f := &fields[i]
+		if value := []byte(f.value); bytes.IndexFunc(value, isControl) >= 0 {
+			// Byte-wise, so obs-text (%x80-FF) is left alone
+			for j, c := range value {
+				if isControl(rune(c)) {
+					value[j] = ' '
+				}
+			}
+			f.value = string(value)
+			changed = true
+		}
+		if !strings.EqualFold(f.name, "Content-Length") {
+			continue
+		}
+		for _, v := range strings.Split(f.value, ",") {
+			v = strings.TrimSpace(v)
+			if contentLength == "" {
+				contentLength = v
+			} else if v != contentLength {
+				// Browsers fail conflicting lengths too; leave it to
+				// ReadResponse to report
+				return nil, false, nil
+			}
+		}
+		if f.value != contentLength {
+			changed = true
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(lines[0])
+	b.WriteString("\r\n")
+	wroteLength := false
+	for _, f := range fields {
+		if strings.EqualFold(f.name, "Content-Length") {
+			if wroteLength {
+				continue
+			}
+			wroteLength = true
+			f.value = contentLength
+		}
+		b.WriteString(f.name)
+		b.WriteString(": ")
+		b.WriteString(f.value)
+		b.WriteString("\r\n")
+	}
+	b.WriteString("\r\n")
+	return []byte(b.String()), changed, nil
+}
+
+// isControl reports whether r is a control character other than HTAB, which
+// net/textproto rejects in a header value
+func isControl(r rune) bool {
+	return (r < 0x20 && r != '\t') || r == 0x7f
+}
+
+// validFieldName reports whether name is an RFC 9110 token
+func validFieldName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' {
+			continue
+		}
+		if !strings.ContainsRune("!#$%&'*+-.^_`|~", rune(c)) {
+			return false
+		}
+	}
+	return true
+}
+
+// NormalizeHeaderValue returns a response header value as a valid UTF-8
+// string. Values that already are come back unchanged; anything else is
+// decoded byte by byte as Latin-1, which is what fetch() shows in a browser.
+func NormalizeHeaderValue(v string) string {
+	if utf8.ValidString(v) {
+		return v
+	}
+	runes := make([]rune, len(v))
+	for i := 0; i < len(v); i++ {
+		runes[i] = rune(v[i])
+	}
+	return string(runes)
+}
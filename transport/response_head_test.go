@@ -0,0 +1,66 @@
+package transport
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestReadResponseLenient(t *testing.T) {
+	raw := "HTTP/1.1 200 OK\r\n" +
+		" stray-fold\r\n" + // Folded first line: textproto rejects it
+		"Content-Type: text/plain\r\n" +
+		"X-Folded: part one\r\n" +
+		"\tpart two\r\n" +
+		"Bad Name: dropped\r\n" +
+		"no colon at all\r\n" +
+		"Server : nginx\r\n" +
+		"X-Ctl: a\x01b\r\n" +
+		"X-Latin1: caf\xe9\r\n" +
+		"Content-Length: 5, 5\r\n" +
+		"Content-Length: 5\r\n" +
+		"\r\n" +
+		"hello"
+	resp, err := readResponse(bufio.NewReader(strings.NewReader(raw)), nil)
+	if err != nil {
+		t.Fatalf("readResponse: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "hello" || resp.ContentLength != 5 {
+		t.Errorf("body = %q, ContentLength = %d", body, resp.ContentLength)
+	}
+	want := map[string]string{
+		"X-Folded": "part one part two",
+		"Server":   "nginx",
+		"X-Ctl":    "a b",
+		"Bad Name": "",
+	}
+	for name, value := range want {
+		if got := resp.Header.Get(name); got != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+	if got := NormalizeHeaderValue(resp.Header.Get("X-Latin1")); got != "café" {
+		t.Errorf("X-Latin1 = %q, want café", got)
+	}
+	if !resp.Close {
+		t.Error("connection reused after rewriting the response head")
+	}
+
+	// Well-formed responses are read as is and keep the connection
+	ok := "HTTP/1.1 204 No Content\r\nServer: x\r\n\r\n"
+	resp, err = readResponse(bufio.NewReader(strings.NewReader(ok)), nil)
+	if err != nil || resp.Close {
+		t.Errorf("well-formed response: close=%v err=%v", resp != nil && resp.Close, err)
+	}
+
+	for _, bad := range []string{
+		"HTTP/1.1 200 OK\r\nContent-Length: 5, 6\r\n\r\nhello",
+		"HTTP/1.1 200 OK\r\nX-Nul: a\x00b\r\nContent-Length: 0\r\n\r\n",
+	} {
+		if _, err := readResponse(bufio.NewReader(strings.NewReader(bad)), nil); err == nil {
+			t.Errorf("readResponse(%q) succeeded, want error", bad)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package transport
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/sardanioss/httpcloak/fingerprint"
+	utls "github.com/sardanioss/utls"
+)
+
+// echoClientHello accepts one connection on ln and returns the signature
+// algorithm extensions of the ClientHello it receives, as sent on the wire.
+// certSigAlgs is nil when signature_algorithms_cert is absent.
+func echoClientHello(ln net.Listener) (sigAlgs, certSigAlgs []utls.SignatureScheme, err error) {
+	conn, err := ln.Accept()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return nil, nil, err
+	}
+	if header[0] != 22 { // Handshake record
+		return nil, nil, errors.New("not a handshake record")
+	}
+	record := make([]byte, binary.BigEndian.Uint16(header[3:5]))
+	if _, err := io.ReadFull(conn, record); err != nil {
+		return nil, nil, err
+	}
+
+	// Handshake header, version, random, then the variable-length fields
+	b := record
+	if len(b) < 4+2+32 || b[0] != 1 {
+		return nil, nil, errors.New("not a ClientHello")
+	}
+	b = b[4+2+32:]
+	skip := func(lenBytes int) bool {
+		if len(b) < lenBytes {
+			return false
+		}
+		n := 0
+		for _, c := range b[:lenBytes] {
+			n = n<<8 | int(c)
+		}
+		if len(b) < lenBytes+n {
+			return false
+		}
+		b = b[lenBytes+n:]
+		return true
+	}
+	if !skip(1) || !skip(2) || !skip(1) || len(b) < 2 { // Session ID, cipher suites, compression
+		return nil, nil, errors.New("truncated ClientHello")
+	}
+	b = b[2:]
+	for len(b) >= 4 {
+		typ := binary.BigEndian.Uint16(b[0:2])
+		n := int(binary.BigEndian.Uint16(b[2:4]))
+		if len(b) < 4+n {
+			return nil, nil, errors.New("truncated extension")
+		}
+		data := b[4 : 4+n]
+		b = b[4+n:]
+		if typ != 13 && typ != 50 {
+			continue
+		}
+		schemes := []utls.SignatureScheme{}
+		for i := 2; i+1 < len(data); i += 2 {
+			schemes = append(schemes, utls.SignatureScheme(binary.BigEndian.Uint16(data[i:i+2])))
+		}
+		if typ == 13 {
+			sigAlgs = schemes
+		} else {
+			certSigAlgs = schemes
+		}
+	}
+	return sigAlgs, certSigAlgs, nil
+}
+
+// TestPresetSignatureAlgorithmsOnWire sends each preset's TCP ClientHello to
+// a local server and checks signature_algorithms and
+// signature_algorithms_cert byte for byte against the preset's rules, so a
+// utls update that changes a parrot fails here
+func TestPresetSignatureAlgorithmsOnWire(t *testing.T) {
+	names := fingerprint.Available()
+	sort.Strings(names)
+	for _, name := range names {
+		preset := fingerprint.Get(name)
+		spec, err := PresetClientHelloSpec(preset, "h2")
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		type echoed struct {
+			sigAlgs, certSigAlgs []utls.SignatureScheme
+			err                  error
+		}
+		done := make(chan echoed, 1)
+		go func() {
+			sigAlgs, certSigAlgs, err := echoClientHello(ln)
+			done <- echoed{sigAlgs, certSigAlgs, err}
+		}()
+
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		tlsConn := utls.UClient(conn, &utls.Config{ServerName: "example.com", InsecureSkipVerify: true}, utls.HelloCustom)
+		if err := tlsConn.ApplyPreset(spec); err != nil {
+			t.Errorf("%s: apply spec: %v", name, err)
+			conn.Close()
+			ln.Close()
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		tlsConn.HandshakeContext(ctx) // Fails once the server hangs up
+		cancel()
+		conn.Close()
+		ln.Close()
+
+		got := <-done
+		if got.err != nil {
+			t.Errorf("%s: %v", name, got.err)
+			continue
+		}
+		if err := fingerprint.CheckSignatureAlgorithms(preset, got.sigAlgs, got.certSigAlgs); err != nil {
+			t.Error(err)
+		}
+	}
+}
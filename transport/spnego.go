@@ -0,0 +1,112 @@
+package transport
+
+import (
+	"bytes"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+)
+
+// SPNEGO (RFC 4178) object identifiers
+var (
+	oidSPNEGO  = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 2}
+	oidNTLMSSP = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 2, 10}
+)
+
+// spnegoReject is the negState of a NegTokenResp refusing the client
+const spnegoReject = 2
+
+// negTokenInit is the client's first SPNEGO token (RFC 4178 Section 4.2.1)
+type negTokenInit struct {
+	MechTypes []asn1.ObjectIdentifier `asn1:"explicit,tag:0"`
+	MechToken []byte                  `asn1:"explicit,optional,tag:2"`
+}
+
+// negTokenResp is every later token, both ways (RFC 4178 Section 4.2.2)
+type negTokenResp struct {
+	NegState      asn1.Enumerated       `asn1:"explicit,optional,tag:0"`
+	SupportedMech asn1.ObjectIdentifier `asn1:"explicit,optional,tag:1"`
+	ResponseToken []byte                `asn1:"explicit,optional,tag:2"`
+	MechListMIC   []byte                `asn1:"explicit,optional,tag:3"`
+}
+
+// spnegoNTLMAuth runs NTLM inside SPNEGO under the "Negotiate" scheme, as
+// Windows clients do when Kerberos isn't available. A server that answers
+// with a bare NTLM token gets bare NTLM back.
+type spnegoNTLMAuth struct {
+	ntlm *ntlmAuth
+}
+
+func (a *spnegoNTLMAuth) Scheme() string { return "Negotiate" }
+
+func (a *spnegoNTLMAuth) Next(challenge []byte) ([]byte, error) {
+	if challenge == nil {
+		token, err := a.ntlm.Next(nil)
+		if err != nil {
+			return nil, err
+		}
+		return spnegoInitToken(token)
+	}
+	if bytes.HasPrefix(challenge, ntlmSignature) {
+		return a.ntlm.Next(challenge)
+	}
+	inner, err := parseSPNEGOResp(challenge)
+	if err != nil {
+		return nil, err
+	}
+	token, err := a.ntlm.Next(inner)
+	if err != nil {
+		return nil, err
+	}
+	return spnegoRespToken(token)
+}
+
+// spnegoInitToken wraps mechToken in a GSS-API InitialContextToken
+// carrying a NegTokenInit that offers NTLM
+func spnegoInitToken(mechToken []byte) ([]byte, error) {
+	init, err := asn1.Marshal(negTokenInit{
+		MechTypes: []asn1.ObjectIdentifier{oidNTLMSSP},
+		MechToken: mechToken,
+	})
+	if err != nil {
+		return nil, err
+	}
+	negToken, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: init})
+	if err != nil {
+		return nil, err
+	}
+	oid, err := asn1.Marshal(oidSPNEGO)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(asn1.RawValue{Class: asn1.ClassApplication, Tag: 0, IsCompound: true, Bytes: append(oid, negToken...)})
+}
+
+// spnegoRespToken wraps responseToken in a NegTokenResp
+func spnegoRespToken(responseToken []byte) ([]byte, error) {
+	resp, err := asn1.Marshal(negTokenResp{ResponseToken: responseToken})
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 1, IsCompound: true, Bytes: resp})
+}
+
+// parseSPNEGOResp returns the mechanism token of a server's NegTokenResp
+func parseSPNEGOResp(token []byte) ([]byte, error) {
+	var outer asn1.RawValue
+	if rest, err := asn1.Unmarshal(token, &outer); err != nil || len(rest) > 0 ||
+		outer.Class != asn1.ClassContextSpecific || outer.Tag != 1 {
+		return nil, errors.New("spnego: malformed NegTokenResp")
+	}
+	var resp negTokenResp
+	if _, err := asn1.Unmarshal(outer.Bytes, &resp); err != nil {
+		return nil, fmt.Errorf("spnego: malformed NegTokenResp: %w", err)
+	}
+	if resp.NegState == spnegoReject {
+		return nil, errors.New("spnego: authentication rejected")
+	}
+	if len(resp.SupportedMech) > 0 && !resp.SupportedMech.Equal(oidNTLMSSP) {
+		return nil, fmt.Errorf("spnego: server chose mechanism %v, not NTLM", resp.SupportedMech)
+	}
+	return resp.ResponseToken, nil
+}
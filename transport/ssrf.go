@@ -0,0 +1,122 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+)
+
+// ErrForbiddenAddress is matched (errors.Is) by the ForbiddenAddressError
+// of a request refused by SSRF protection
+var ErrForbiddenAddress = errors.New("forbidden address")
+
+// ForbiddenAddressError is returned when SSRF protection is on and a host
+// resolves to an internal address. Nothing is sent to it.
+type ForbiddenAddressError struct {
+	Host string
+	IP   net.IP
+}
+
+func (e *ForbiddenAddressError) Error() string {
+	if e.Host == e.IP.String() {
+		return fmt.Sprintf("forbidden address %s", e.IP)
+	}
+	return fmt.Sprintf("forbidden address: %s resolves to %s", e.Host, e.IP)
+}
+
+// Is makes errors.Is(err, ErrForbiddenAddress) match
+func (e *ForbiddenAddressError) Is(target error) bool {
+	return target == ErrForbiddenAddress
+}
+
+// forbiddenPrefixes are the ranges a request from SSRF protected transport
+// never reaches: loopback, private, link-local (cloud metadata at
+// 169.254.169.254 included), shared CGNAT (Alibaba's metadata at
+// 100.100.100.200), unique local IPv6 (fd00:ec2::254), multicast and the
+// reserved ranges
+var forbiddenPrefixes = func() []netip.Prefix {
+	var prefixes []netip.Prefix
+	for _, s := range []string{
+		"0.0.0.0/8",
+		"10.0.0.0/8",
+		"100.64.0.0/10",
+		"127.0.0.0/8",
+		"169.254.0.0/16",
+		"172.16.0.0/12",
+		"192.0.0.0/24",
+		"192.0.2.0/24",
+		"192.168.0.0/16",
+		"198.18.0.0/15",
+		"198.51.100.0/24",
+		"203.0.113.0/24",
+		"224.0.0.0/4",
+		"240.0.0.0/4",
+		"::/128",
+		"::1/128",
+		"100::/64",
+		"2001:db8::/32",
+		"fc00::/7",
+		"fe80::/10",
+		"fec0::/10",
+		"ff00::/8",
+	} {
+		prefixes = append(prefixes, netip.MustParsePrefix(s))
+	}
+	return prefixes
+}()
+
+// IsForbiddenAddress reports whether SSRF protection refuses ip. IPv4
+// addresses embedded in IPv6 (mapped, NAT64, 6to4) are judged as IPv4.
+func IsForbiddenAddress(ip net.IP) bool {
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return true
+	}
+	addr = addr.Unmap()
+	if addr.Is6() {
+		b := addr.As16()
+		switch {
+		case netip.MustParsePrefix("64:ff9b::/96").Contains(addr):
+			addr = netip.AddrFrom4([4]byte(b[12:16]))
+		case netip.MustParsePrefix("2002::/16").Contains(addr):
+			addr = netip.AddrFrom4([4]byte(b[2:6]))
+		}
+	}
+	for _, p := range forbiddenPrefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// forbidInternalAddresses is the DNS cache filter of SSRF protection
+func forbidInternalAddresses(host string, ip net.IP) error {
+	if IsForbiddenAddress(ip) {
+		return &ForbiddenAddressError{Host: host, IP: ip}
+	}
+	return nil
+}
+
+// ssrfProtection reports whether requests to internal addresses are refused
+func (c *TransportConfig) ssrfProtection() bool {
+	return c != nil && c.SSRFProtection
+}
+
+// checkAddresses resolves host, failing if SSRF protection refuses any of
+// its addresses. Direct dials are vetted by the DNS cache anyway; this
+// covers requests a proxy resolves.
+func (t *Transport) checkAddresses(ctx context.Context, host string) error {
+	if !t.config.ssrfProtection() {
+		return nil
+	}
+	if _, err := t.dnsCache.Resolve(ctx, host); err != nil {
+		if errors.Is(err, ErrForbiddenAddress) {
+			return err
+		}
+		return NewDNSError(host, err)
+	}
+	return nil
+}
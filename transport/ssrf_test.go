@@ -0,0 +1,50 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/sardanioss/httpcloak/dns"
+)
+
+func TestIsForbiddenAddress(t *testing.T) {
+	for addr, forbidden := range map[string]bool{
+		"8.8.8.8":            false,
+		"2606:4700::1111":    false,
+		"127.0.0.1":          true,
+		"10.1.2.3":           true,
+		"172.31.0.1":         true,
+		"192.168.1.1":        true,
+		"169.254.169.254":    true,
+		"100.100.100.200":    true,
+		"0.0.0.0":            true,
+		"::1":                true,
+		"fd00:ec2::254":      true,
+		"fe80::1":            true,
+		"::ffff:127.0.0.1":   true,
+		"64:ff9b::a9fe:a9fe": true,
+		"2002:c0a8:0101::1":  true,
+		"64:ff9b::808:808":   false,
+		"2002:0808:0808::1":  false,
+	} {
+		if got := IsForbiddenAddress(net.ParseIP(addr)); got != forbidden {
+			t.Errorf("IsForbiddenAddress(%s) = %v", addr, got)
+		}
+	}
+}
+
+func TestSSRFAddressFilter(t *testing.T) {
+	cache := dns.NewCache()
+	cache.SetAddressFilter(forbidInternalAddresses)
+
+	_, err := cache.Resolve(context.Background(), "169.254.169.254")
+	var forbidden *ForbiddenAddressError
+	if !errors.As(err, &forbidden) || !errors.Is(NewDNSError("metadata", err), ErrForbiddenAddress) {
+		t.Fatalf("metadata address: %v", err)
+	}
+	if _, err := cache.Resolve(context.Background(), "1.1.1.1"); err != nil {
+		t.Fatalf("public address: %v", err)
+	}
+}
@@ -2,7 +2,6 @@ package transport
 
 import (
 	"bufio"
-	"bytes"
 	"compress/flate"
 	"compress/gzip"
 	"context"
@@ -29,6 +28,14 @@ type StreamResponse struct {
 	// ContentLength is the expected total size (-1 if unknown/chunked)
 	ContentLength int64
 
+	Meta map[string]any // The request's Meta
+
+	// Decompressed is set when the body is decoded from its Content-Encoding
+	Decompressed bool
+
+	// Trailers sent after the body, filled in once it is read to EOF
+	trailer http.Header
+
 	// The underlying response body reader
 	reader       io.ReadCloser
 	decompressor io.Closer
@@ -36,6 +43,9 @@ type StreamResponse struct {
 
 	// Context cancel function - called when response is closed
 	cancel context.CancelFunc
+
+	// Unread bytes Close drains rather than resetting an h2/h3 stream
+	drainLimit int64
 }
 
 // Read reads data from the response body
@@ -43,8 +53,20 @@ func (r *StreamResponse) Read(p []byte) (n int, err error) {
 	return r.reader.Read(p)
 }
 
-// Close closes the response body and cancels the context
+// Close closes the response body and cancels the context. An HTTP/2 or
+// HTTP/3 body with little left is drained in the background first, so the
+// stream ends normally instead of being reset.
 func (r *StreamResponse) Close() error {
+	if r.Protocol != "h1" && r.rawReader != nil && r.drainLimit > 0 {
+		return DrainAndClose(r.rawReader, r.ContentLength, r.drainLimit, func() {
+			if r.cancel != nil {
+				r.cancel()
+			}
+			if r.decompressor != nil {
+				r.decompressor.Close()
+			}
+		})
+	}
 	if r.cancel != nil {
 		r.cancel()
 	}
@@ -57,6 +79,12 @@ func (r *StreamResponse) Close() error {
 	return nil
 }
 
+// Trailers returns the trailers the server sent after the body. They are
+// complete once the body has been read to EOF.
+func (r *StreamResponse) Trailers() map[string][]string {
+	return r.trailer
+}
+
 // ReadAll reads the entire response body into memory
 // This defeats the purpose of streaming but is useful for small responses
 func (r *StreamResponse) ReadAll() ([]byte, error) {
@@ -106,11 +134,23 @@ func (t *Transport) DoStream(ctx context.Context, req *Request) (*StreamResponse
 	if err != nil {
 		return nil, NewRequestError("parse_url", "", "", "", err)
 	}
+	if err := t.hostFilter.Check(parsedURL.Hostname()); err != nil {
+		return nil, err
+	}
+	if err := t.checkAddresses(ctx, parsedURL.Hostname()); err != nil {
+		return nil, err
+	}
 
 	// For HTTP (non-TLS), only HTTP/1.1 is supported
 	if parsedURL.Scheme == "http" {
 		return t.doStreamHTTP1(ctx, req)
 	}
+	if t.strict != nil {
+		if t.protocol == ProtocolHTTP1 {
+			return t.doStreamHTTP1(ctx, req)
+		}
+		return t.doStreamHTTP2(ctx, req)
+	}
 
 	// When proxy is configured, select protocol based on proxy capabilities
 	if t.proxy != nil && (t.proxy.URL != "" || t.proxy.TCPProxy != "" || t.proxy.UDPProxy != "") {
@@ -134,7 +174,8 @@ func (t *Transport) DoStream(ctx context.Context, req *Request) (*StreamResponse
 	}
 
 	// Default HTTPS: Try HTTP/3 first, fallback to HTTP/2
-	switch t.protocol {
+	host := parsedURL.Hostname()
+	switch t.protocolFor(host) {
 	case ProtocolHTTP1:
 		return t.doStreamHTTP1(ctx, req)
 	case ProtocolHTTP2:
@@ -143,11 +184,14 @@ func (t *Transport) DoStream(ctx context.Context, req *Request) (*StreamResponse
 		return t.doStreamHTTP3(ctx, req)
 	default:
 		// Auto mode: try H3 -> H2 with fallback
-		if t.h3Transport != nil {
+		if t.h3Transport != nil && !t.h3Failed(host) {
 			resp, err := t.doStreamHTTP3(ctx, req)
 			if err == nil {
 				return resp, nil
 			}
+			if ctx.Err() == nil {
+				t.markH3Failed(host)
+			}
 		}
 		return t.doStreamHTTP2(ctx, req)
 	}
@@ -184,14 +228,7 @@ func (t *Transport) doStreamHTTP1(ctx context.Context, req *Request) (*StreamRes
 		method = "GET"
 	}
 
-	var bodyReader io.Reader
-	if req.BodyReader != nil {
-		bodyReader = req.BodyReader
-	} else if len(req.Body) > 0 {
-		bodyReader = bytes.NewReader(req.Body)
-	}
-
-	httpReq, err := http.NewRequestWithContext(ctx, method, req.URL, bodyReader)
+	httpReq, err := newHTTPRequest(ctx, method, req)
 	if err != nil {
 		cancel()
 		return nil, NewRequestError("create_request", host, port, "h1", err)
@@ -218,6 +255,9 @@ func (t *Transport) doStreamHTTP1(ctx context.Context, req *Request) (*StreamRes
 		}
 	}
 
+	applyRequestPriority(httpReq, t.preset, req.Headers, req.Priority, effectiveTLSOnly, "h1")
+	t.applyHeaderRules(httpReq)
+
 	// Record timing before request
 	reqStart := time.Now()
 
@@ -228,6 +268,7 @@ func (t *Transport) doStreamHTTP1(ctx context.Context, req *Request) (*StreamRes
 		return nil, WrapError("stream_roundtrip", host, port, "h1", err)
 	}
 
+	ContextClientTrace(ctx).gotFirstResponseByte()
 	timing.FirstByte = float64(time.Since(reqStart).Milliseconds())
 	timing.Total = float64(time.Since(startTime).Milliseconds())
 
@@ -235,7 +276,11 @@ func (t *Transport) doStreamHTTP1(ctx context.Context, req *Request) (*StreamRes
 	headers := buildHeadersMap(resp.Header)
 
 	// Setup decompression reader
-	reader, decompressor := setupStreamDecompressor(resp.Body, resp.Header.Get("Content-Encoding"))
+	contentEncoding := resp.Header.Get("Content-Encoding")
+	if t.rawBody {
+		contentEncoding = ""
+	}
+	reader, decompressor := setupStreamDecompressor(resp.Body, contentEncoding)
 
 	return &StreamResponse{
 		StatusCode:    resp.StatusCode,
@@ -244,9 +289,11 @@ func (t *Transport) doStreamHTTP1(ctx context.Context, req *Request) (*StreamRes
 		Timing:        timing,
 		Protocol:      "h1",
 		ContentLength: resp.ContentLength,
+		Decompressed:  reader != resp.Body,
 		reader:        reader,
 		decompressor:  decompressor,
 		rawReader:     resp.Body,
+		trailer:       resp.Trailer,
 		cancel:        cancel,
 	}, nil
 }
@@ -281,14 +328,7 @@ func (t *Transport) doStreamHTTP2(ctx context.Context, req *Request) (*StreamRes
 		method = "GET"
 	}
 
-	var bodyReader io.Reader
-	if req.BodyReader != nil {
-		bodyReader = req.BodyReader
-	} else if len(req.Body) > 0 {
-		bodyReader = bytes.NewReader(req.Body)
-	}
-
-	httpReq, err := http.NewRequestWithContext(ctx, method, req.URL, bodyReader)
+	httpReq, err := newHTTPRequest(ctx, method, req)
 	if err != nil {
 		cancel()
 		return nil, NewRequestError("create_request", host, port, "h2", err)
@@ -315,6 +355,9 @@ func (t *Transport) doStreamHTTP2(ctx context.Context, req *Request) (*StreamRes
 		}
 	}
 
+	applyRequestPriority(httpReq, t.preset, req.Headers, req.Priority, effectiveTLSOnly, "h2")
+	t.applyHeaderRules(httpReq)
+
 	// Record timing before request
 	reqStart := time.Now()
 
@@ -325,6 +368,7 @@ func (t *Transport) doStreamHTTP2(ctx context.Context, req *Request) (*StreamRes
 		return nil, WrapError("roundtrip", host, port, "h2", err)
 	}
 
+	ContextClientTrace(ctx).gotFirstResponseByte()
 	timing.FirstByte = float64(time.Since(reqStart).Milliseconds())
 	timing.Total = float64(time.Since(startTime).Milliseconds())
 
@@ -332,7 +376,11 @@ func (t *Transport) doStreamHTTP2(ctx context.Context, req *Request) (*StreamRes
 	headers := buildHeadersMap(resp.Header)
 
 	// Setup decompression reader
-	reader, decompressor := setupStreamDecompressor(resp.Body, resp.Header.Get("Content-Encoding"))
+	contentEncoding := resp.Header.Get("Content-Encoding")
+	if t.rawBody {
+		contentEncoding = ""
+	}
+	reader, decompressor := setupStreamDecompressor(resp.Body, contentEncoding)
 
 	return &StreamResponse{
 		StatusCode:    resp.StatusCode,
@@ -341,10 +389,13 @@ func (t *Transport) doStreamHTTP2(ctx context.Context, req *Request) (*StreamRes
 		Timing:        timing,
 		Protocol:      "h2",
 		ContentLength: resp.ContentLength,
+		Decompressed:  reader != resp.Body,
 		reader:        reader,
 		decompressor:  decompressor,
 		rawReader:     resp.Body,
+		trailer:       resp.Trailer,
 		cancel:        cancel,
+		drainLimit:    t.drainLimit,
 	}, nil
 }
 
@@ -378,14 +429,7 @@ func (t *Transport) doStreamHTTP3(ctx context.Context, req *Request) (*StreamRes
 		method = "GET"
 	}
 
-	var bodyReader io.Reader
-	if req.BodyReader != nil {
-		bodyReader = req.BodyReader
-	} else if len(req.Body) > 0 {
-		bodyReader = bytes.NewReader(req.Body)
-	}
-
-	httpReq, err := http.NewRequestWithContext(ctx, method, req.URL, bodyReader)
+	httpReq, err := newHTTPRequest(ctx, method, req)
 	if err != nil {
 		cancel()
 		return nil, NewRequestError("create_request", host, port, "h3", err)
@@ -412,6 +456,9 @@ func (t *Transport) doStreamHTTP3(ctx context.Context, req *Request) (*StreamRes
 		}
 	}
 
+	applyRequestPriority(httpReq, t.preset, req.Headers, req.Priority, effectiveTLSOnly, "h3")
+	t.applyHeaderRules(httpReq)
+
 	// Record timing before request
 	reqStart := time.Now()
 
@@ -422,6 +469,7 @@ func (t *Transport) doStreamHTTP3(ctx context.Context, req *Request) (*StreamRes
 		return nil, WrapError("roundtrip", host, port, "h3", err)
 	}
 
+	ContextClientTrace(ctx).gotFirstResponseByte()
 	timing.FirstByte = float64(time.Since(reqStart).Milliseconds())
 	timing.Total = float64(time.Since(startTime).Milliseconds())
 
@@ -429,7 +477,11 @@ func (t *Transport) doStreamHTTP3(ctx context.Context, req *Request) (*StreamRes
 	headers := buildHeadersMap(resp.Header)
 
 	// Setup decompression reader
-	reader, decompressor := setupStreamDecompressor(resp.Body, resp.Header.Get("Content-Encoding"))
+	contentEncoding := resp.Header.Get("Content-Encoding")
+	if t.rawBody {
+		contentEncoding = ""
+	}
+	reader, decompressor := setupStreamDecompressor(resp.Body, contentEncoding)
 
 	return &StreamResponse{
 		StatusCode:    resp.StatusCode,
@@ -438,10 +490,13 @@ func (t *Transport) doStreamHTTP3(ctx context.Context, req *Request) (*StreamRes
 		Timing:        timing,
 		Protocol:      "h3",
 		ContentLength: resp.ContentLength,
+		Decompressed:  reader != resp.Body,
 		reader:        reader,
 		decompressor:  decompressor,
 		rawReader:     resp.Body,
+		trailer:       resp.Trailer,
 		cancel:        cancel,
+		drainLimit:    t.drainLimit,
 	}, nil
 }
 
@@ -0,0 +1,83 @@
+package transport
+
+import (
+	"context"
+
+	"github.com/sardanioss/httpcloak/fingerprint"
+	utls "github.com/sardanioss/utls"
+)
+
+// strictState is what strict mode set aside, restored when it ends
+type strictState struct {
+	preset  *fingerprint.Preset
+	h1Cache utls.ClientSessionCache
+	h2Cache utls.ClientSessionCache
+}
+
+// SetStrictMode turns impersonation off or back on. In strict mode requests
+// go out as a plain client would send them (see fingerprint.Strict), over
+// HTTP/2 or HTTP/1.1 whatever the protocol setting, through the same proxy,
+// local address and config. The HTTP/1.1 and HTTP/2 connections are
+// replaced, and TLS sessions resumed in one mode are never offered in the
+// other.
+func (t *Transport) SetStrictMode(strict bool) {
+	if strict == (t.strict != nil) {
+		return
+	}
+	h1Cache := t.h1Transport.GetSessionCache()
+	h2Cache := t.h2Transport.GetSessionCache()
+	if strict {
+		t.strict = &strictState{preset: t.preset, h1Cache: h1Cache, h2Cache: h2Cache}
+		t.preset = fingerprint.Strict()
+		t.rebuildTCPTransports(nil, nil)
+	} else {
+		state := t.strict
+		t.strict = nil
+		t.preset = state.preset
+		t.rebuildTCPTransports(state.h1Cache, state.h2Cache)
+	}
+}
+
+// StrictMode reports whether impersonation is off (see SetStrictMode)
+func (t *Transport) StrictMode() bool {
+	return t.strict != nil
+}
+
+// rebuildTCPTransports replaces the HTTP/1.1 and HTTP/2 transports with ones
+// for the current preset, using the given session caches (nil for new ones)
+func (t *Transport) rebuildTCPTransports(h1Cache, h2Cache utls.ClientSessionCache) {
+	t.h1Transport.Close()
+	t.h2Transport.Close()
+
+	var tcpProxy *ProxyConfig
+	if t.proxy != nil {
+		if url := t.proxy.TCPProxy; url != "" {
+			tcpProxy = &ProxyConfig{URL: url}
+		} else if t.proxy.URL != "" {
+			tcpProxy = &ProxyConfig{URL: t.proxy.URL}
+		}
+	}
+	t.h1Transport = NewHTTP1TransportWithConfig(t.preset, t.dnsCache, tcpProxy, t.config)
+	t.h1Transport.SetDrainLimit(t.drainLimit)
+	t.h2Transport = NewHTTP2TransportWithConfig(t.preset, t.dnsCache, tcpProxy, t.config)
+	if t.insecureSkipVerify {
+		t.h1Transport.SetInsecureSkipVerify(true)
+		t.h2Transport.SetInsecureSkipVerify(true)
+	}
+	if h1Cache != nil {
+		t.h1Transport.SetSessionCache(h1Cache)
+	}
+	if h2Cache != nil {
+		t.h2Transport.SetSessionCache(h2Cache)
+	}
+	t.applyTicketPartitions()
+}
+
+// doStrict sends req in strict mode: over HTTP/1.1 if asked for, otherwise
+// over HTTP/2, or HTTP/1.1 when the server doesn't speak it
+func (t *Transport) doStrict(ctx context.Context, req *Request) (*Response, error) {
+	if t.protocolFor(extractHost(req.URL)) == ProtocolHTTP1 {
+		return t.doProtocol(ctx, req, ProtocolHTTP1)
+	}
+	return t.doProtocol(ctx, req, ProtocolHTTP2)
+}
@@ -0,0 +1,144 @@
+package transport
+
+import (
+	"io"
+	"sync"
+)
+
+// splitBufferSize is how much of the body SplitBody reads at a time
+const splitBufferSize = 32 << 10
+
+// TeeBody returns body with everything read from it also written to w. A
+// failed write fails the read. Closing it closes body.
+func TeeBody(body io.ReadCloser, w io.Writer) io.ReadCloser {
+	return &teeBody{Reader: io.TeeReader(body, w), body: body}
+}
+
+type teeBody struct {
+	io.Reader
+	body io.ReadCloser
+}
+
+func (t *teeBody) Close() error {
+	return t.body.Close()
+}
+
+// SplitBody fans body out to n readers that each see all of it. Each chunk
+// is read once and handed straight into the readers' buffers, so nothing is
+// buffered: the readers move in lockstep and must be read concurrently (one
+// goroutine each). A reader closed early drops out; body is closed at its
+// end or once every reader is closed, and a read error reaches every reader.
+func SplitBody(body io.ReadCloser, n int) []io.ReadCloser {
+	if n <= 0 {
+		return nil
+	}
+	s := &bodySplit{body: body, open: n}
+	readers := make([]io.ReadCloser, n)
+	writers := make([]*io.PipeWriter, n)
+	for i := range readers {
+		pr, pw := io.Pipe()
+		readers[i] = &splitReader{PipeReader: pr, split: s}
+		writers[i] = pw
+	}
+	go s.pump(writers)
+	return readers
+}
+
+type bodySplit struct {
+	body      io.ReadCloser
+	closeOnce sync.Once
+
+	mu   sync.Mutex
+	open int // Readers not yet closed
+}
+
+func (s *bodySplit) closeBody() {
+	s.closeOnce.Do(func() { s.body.Close() })
+}
+
+// pump copies the body to every writer whose reader is still open
+func (s *bodySplit) pump(writers []*io.PipeWriter) {
+	defer s.closeBody()
+	buf := make([]byte, splitBufferSize)
+	for {
+		n, err := s.body.Read(buf)
+		if n > 0 {
+			live := 0
+			for i, w := range writers {
+				if w == nil {
+					continue
+				}
+				if _, werr := w.Write(buf[:n]); werr != nil {
+					writers[i] = nil
+					continue
+				}
+				live++
+			}
+			if live == 0 {
+				return
+			}
+		}
+		if err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			for _, w := range writers {
+				if w != nil {
+					w.CloseWithError(err)
+				}
+			}
+			return
+		}
+	}
+}
+
+type splitReader struct {
+	*io.PipeReader
+	split *bodySplit
+	once  sync.Once
+}
+
+// Close drops the reader out of the split, closing the body if it was the
+// last one open
+func (r *splitReader) Close() error {
+	r.once.Do(func() {
+		r.PipeReader.Close()
+		r.split.mu.Lock()
+		r.split.open--
+		last := r.split.open == 0
+		r.split.mu.Unlock()
+		if last {
+			r.split.closeBody()
+		}
+	})
+	return nil
+}
+
+// Tee writes the rest of the body to w as it is read, by Read, ReadAll,
+// Lines or anything else reading the response
+func (r *StreamResponse) Tee(w io.Writer) {
+	r.reader = TeeBody(r.reader, w)
+}
+
+// Split hands the rest of the body to n readers that each see all of it,
+// to be read concurrently (see SplitBody). Don't read the response itself
+// afterwards; closing it, or every reader, ends the stream.
+func (r *StreamResponse) Split(n int) []io.ReadCloser {
+	readers := SplitBody(&streamBody{Reader: r.reader, stream: r}, n)
+	r.reader = io.NopCloser(eofReader{})
+	return readers
+}
+
+// streamBody is a stream's body whose Close closes the stream
+type streamBody struct {
+	io.Reader
+	stream *StreamResponse
+}
+
+func (b *streamBody) Close() error {
+	return b.stream.Close()
+}
+
+type eofReader struct{}
+
+func (eofReader) Read([]byte) (int, error) { return 0, io.EOF }
@@ -0,0 +1,86 @@
+package transport
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type closeCounter struct {
+	io.Reader
+	closed int
+}
+
+func (c *closeCounter) Close() error {
+	c.closed++
+	return nil
+}
+
+func TestTeeBody(t *testing.T) {
+	body := &closeCounter{Reader: strings.NewReader("hello world")}
+	var copied bytes.Buffer
+	tee := TeeBody(body, &copied)
+	data, err := io.ReadAll(tee)
+	if err != nil || string(data) != "hello world" || copied.String() != "hello world" {
+		t.Fatalf("read %q, copied %q, %v", data, copied.String(), err)
+	}
+	tee.Close()
+	if body.closed != 1 {
+		t.Errorf("body closed %d times", body.closed)
+	}
+}
+
+func TestSplitBody(t *testing.T) {
+	payload := bytes.Repeat([]byte("0123456789"), 10000) // Several chunks
+	want := sha256.Sum256(payload)
+	body := &closeCounter{Reader: bytes.NewReader(payload)}
+	readers := SplitBody(body, 3)
+
+	var wg sync.WaitGroup
+	got := make([][]byte, len(readers))
+	for i, r := range readers[:2] {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer r.Close()
+			got[i], _ = io.ReadAll(r)
+		}()
+	}
+	// A reader dropping out doesn't stall the others
+	readers[2].Close()
+	wg.Wait()
+
+	for i := range 2 {
+		if sha256.Sum256(got[i]) != want {
+			t.Errorf("reader %d got %d bytes", i, len(got[i]))
+		}
+	}
+	if body.closed != 1 {
+		t.Errorf("body closed %d times", body.closed)
+	}
+
+	// A read error reaches every reader
+	failing := &closeCounter{Reader: io.MultiReader(strings.NewReader("partial"), errReader{})}
+	errs := make([]error, 2)
+	for i, r := range SplitBody(failing, 2) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = io.ReadAll(r)
+		}()
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err == nil || err.Error() != "connection reset" {
+			t.Errorf("reader %d: %v", i, err)
+		}
+	}
+}
+
+type errReader struct{}
+
+func (errReader) Read([]byte) (int, error) { return 0, errors.New("connection reset") }
@@ -0,0 +1,112 @@
+package transport
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	tls "github.com/sardanioss/utls"
+)
+
+// TicketIsolation controls whether TLS session tickets may be reused across
+// different egress paths (proxies / local addresses) for the same origin.
+//
+// A server that sees the same ticket presented from two IPs can link both
+// connections to one client, so rotating proxies while resuming sessions
+// defeats the rotation. Isolation is therefore on by default.
+type TicketIsolation int
+
+const (
+	// TicketIsolationEgress partitions tickets by egress: the proxy URL
+	// (credentials included, since rotating proxies often encode the exit
+	// in the username) and the local bind address. Default.
+	TicketIsolationEgress TicketIsolation = iota
+
+	// TicketIsolationShared keys tickets by origin only, reusing them
+	// regardless of which proxy the connection goes through.
+	TicketIsolationShared
+)
+
+// ticketPartitionSep separates the egress partition from the origin in
+// session cache keys. Not valid in hostnames, so keys can be split unambiguously.
+const ticketPartitionSep = "|"
+
+// String returns the policy name as used in protocol.SessionConfig.
+func (p TicketIsolation) String() string {
+	switch p {
+	case TicketIsolationShared:
+		return "shared"
+	default:
+		return "egress"
+	}
+}
+
+// ParseTicketIsolation parses a policy name ("egress" or "shared").
+// The empty string selects the default (egress).
+func ParseTicketIsolation(s string) (TicketIsolation, error) {
+	switch strings.ToLower(s) {
+	case "", "egress":
+		return TicketIsolationEgress, nil
+	case "shared":
+		return TicketIsolationShared, nil
+	default:
+		return TicketIsolationEgress, fmt.Errorf("unknown TLS ticket isolation policy %q (want \"egress\" or \"shared\")", s)
+	}
+}
+
+// egressPartition derives an opaque partition ID for an egress path.
+// Direct connections without a bound local address get the empty partition,
+// which keeps their cache keys identical to the unpartitioned format.
+// The proxy URL is hashed so credentials never appear in cache keys.
+func egressPartition(policy TicketIsolation, proxyURL, localAddr string) string {
+	if policy == TicketIsolationShared || (proxyURL == "" && localAddr == "") {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(proxyURL + "\x00" + localAddr))
+	return "egress-" + hex.EncodeToString(sum[:6])
+}
+
+// SplitTicketPartition splits a session cache key into its egress partition
+// and origin part. Keys without a partition return an empty partition.
+func SplitTicketPartition(key string) (partition, origin string) {
+	if i := strings.Index(key, ticketPartitionSep); i >= 0 {
+		return key[:i], key[i+len(ticketPartitionSep):]
+	}
+	return "", key
+}
+
+// partitionedSessionCache scopes a (possibly shared) ClientSessionCache to one
+// egress partition by prefixing every key. The underlying cache keeps entries
+// for all partitions, so switching back to a previous proxy resumes its
+// sessions, and forked sessions on different proxies can share one cache.
+type partitionedSessionCache struct {
+	inner     tls.ClientSessionCache
+	partition string
+}
+
+func (c *partitionedSessionCache) Get(sessionKey string) (*tls.ClientSessionState, bool) {
+	return c.inner.Get(c.partition + ticketPartitionSep + sessionKey)
+}
+
+func (c *partitionedSessionCache) Put(sessionKey string, cs *tls.ClientSessionState) {
+	c.inner.Put(c.partition+ticketPartitionSep+sessionKey, cs)
+}
+
+// scopeSessionCache returns cache restricted to partition, or cache itself
+// when no partitioning applies.
+func scopeSessionCache(cache tls.ClientSessionCache, partition string) tls.ClientSessionCache {
+	if cache == nil || partition == "" {
+		return cache
+	}
+	return &partitionedSessionCache{inner: cache, partition: partition}
+}
+
+// scopedTicketKey returns the key under which sessionKey is stored in the
+// underlying cache for the given partition.
+func scopedTicketKey(partition, sessionKey string) string {
+	if partition == "" {
+		return sessionKey
+	}
+	return partition + ticketPartitionSep + sessionKey
+}
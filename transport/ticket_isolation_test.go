@@ -0,0 +1,61 @@
+package transport
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEgressPartition(t *testing.T) {
+	direct := egressPartition(TicketIsolationEgress, "", "")
+	if direct != "" {
+		t.Fatalf("direct connection should use the unpartitioned keyspace, got %q", direct)
+	}
+
+	a := egressPartition(TicketIsolationEgress, "http://user-a:pw@proxy:8080", "")
+	b := egressPartition(TicketIsolationEgress, "http://user-b:pw@proxy:8080", "")
+	if a == "" || b == "" || a == b {
+		t.Fatalf("different proxy credentials must give distinct partitions: %q vs %q", a, b)
+	}
+	if strings.Contains(a, "user-a") || strings.Contains(a, "pw") {
+		t.Fatalf("partition leaks proxy credentials: %q", a)
+	}
+	if again := egressPartition(TicketIsolationEgress, "http://user-a:pw@proxy:8080", ""); again != a {
+		t.Fatalf("partition must be stable across calls: %q vs %q", a, again)
+	}
+	if local := egressPartition(TicketIsolationEgress, "", "2001:db8::1"); local == "" {
+		t.Fatal("bound local address should get its own partition")
+	}
+
+	if shared := egressPartition(TicketIsolationShared, "http://proxy:8080", "10.0.0.1"); shared != "" {
+		t.Fatalf("shared policy must not partition, got %q", shared)
+	}
+}
+
+func TestSplitTicketPartition(t *testing.T) {
+	key := scopedTicketKey("egress-abc", "example.com:443")
+	partition, origin := SplitTicketPartition(key)
+	if partition != "egress-abc" || origin != "example.com:443" {
+		t.Fatalf("SplitTicketPartition(%q) = %q, %q", key, partition, origin)
+	}
+
+	partition, origin = SplitTicketPartition("example.com:443")
+	if partition != "" || origin != "example.com:443" {
+		t.Fatalf("unpartitioned key split wrong: %q, %q", partition, origin)
+	}
+}
+
+func TestParseTicketIsolation(t *testing.T) {
+	for in, want := range map[string]TicketIsolation{
+		"":       TicketIsolationEgress,
+		"egress": TicketIsolationEgress,
+		"Shared": TicketIsolationShared,
+	} {
+		got, err := ParseTicketIsolation(in)
+		if err != nil || got != want {
+			t.Errorf("ParseTicketIsolation(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+	if _, err := ParseTicketIsolation("per-origin"); err == nil {
+		t.Error("expected error for unknown policy")
+	}
+}
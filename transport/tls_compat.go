@@ -0,0 +1,169 @@
+package transport
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/sardanioss/httpcloak/fingerprint"
+	tls "github.com/sardanioss/utls"
+)
+
+// PresetClientHelloSpec returns the ClientHelloSpec a preset uses for the given
+// protocol ("h1", "h2" or "h3"). It is used to check persisted resumption state
+// against what the preset will actually offer on the wire.
+func PresetClientHelloSpec(preset *fingerprint.Preset, protocol string) (*tls.ClientHelloSpec, error) {
+	if preset == nil {
+		return nil, fmt.Errorf("preset is nil")
+	}
+	spec, err := presetClientHelloSpec(preset, protocol)
+	if err != nil {
+		return nil, err
+	}
+	fingerprint.ApplySignatureAlgorithms(spec, preset)
+	return spec, nil
+}
+
+func presetClientHelloSpec(preset *fingerprint.Preset, protocol string) (*tls.ClientHelloSpec, error) {
+	if protocol == "h3" {
+		if preset.CustomQUICClientHelloSpec != nil {
+			return preset.CustomQUICClientHelloSpec(), nil
+		}
+		id := preset.QUICClientHelloID
+		if id.Client == "" {
+			id = preset.ClientHelloID
+		}
+		spec, err := tls.UTLSIdToSpec(id)
+		if err != nil {
+			return nil, err
+		}
+		return &spec, nil
+	}
+
+	if preset.CustomClientHelloSpec != nil {
+		return preset.CustomClientHelloSpec(), nil
+	}
+	spec, err := tls.UTLSIdToSpec(preset.ClientHelloID)
+	if err != nil {
+		return nil, err
+	}
+	return &spec, nil
+}
+
+// CheckCompatibility verifies that a stored TLS session could be resumed by a
+// ClientHello built from spec: the negotiated protocol version must still be
+// offered, the negotiated cipher suite must still be in the cipher list and
+// alpn, the application protocol the session was used for ("" if unknown),
+// must still be in the ALPN extension.
+//
+// A mismatch means the ticket was issued to a different fingerprint (e.g. the
+// preset changed between library versions). Resuming it anyway would pair a
+// new ClientHello with an old session - something no browser does.
+func (s *TLSSessionState) CheckCompatibility(spec *tls.ClientHelloSpec, alpn string) error {
+	stateBytes, err := base64.StdEncoding.DecodeString(s.State)
+	if err != nil {
+		return fmt.Errorf("decode state: %w", err)
+	}
+	if _, err := tls.ParseSessionState(stateBytes); err != nil {
+		return fmt.Errorf("parse session state: %w", err)
+	}
+	if spec == nil {
+		return nil
+	}
+
+	// SessionState wire format starts with:
+	//   uint16 version; uint8 type; uint16 cipher_suite; ...
+	// (already validated by ParseSessionState above)
+	vers := binary.BigEndian.Uint16(stateBytes[0:2])
+	suite := binary.BigEndian.Uint16(stateBytes[3:5])
+
+	if !specOffersVersion(spec, vers) {
+		return fmt.Errorf("TLS version 0x%04x not offered by current preset", vers)
+	}
+	if !specOffersCipher(spec, suite) {
+		return fmt.Errorf("cipher suite 0x%04x not offered by current preset", suite)
+	}
+	if alpn != "" && !specOffersALPN(spec, alpn) {
+		return fmt.Errorf("ALPN protocol %q not offered by current preset", alpn)
+	}
+	return nil
+}
+
+// specOffersVersion reports whether the ClientHello built from spec offers vers.
+func specOffersVersion(spec *tls.ClientHelloSpec, vers uint16) bool {
+	for _, ext := range spec.Extensions {
+		if sv, ok := ext.(*tls.SupportedVersionsExtension); ok {
+			for _, v := range sv.Versions {
+				if v == vers {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	// No supported_versions extension: fall back to the spec's version range
+	if spec.TLSVersMax == 0 {
+		return true
+	}
+	return vers >= spec.TLSVersMin && vers <= spec.TLSVersMax
+}
+
+// specOffersCipher reports whether spec's cipher list contains suite.
+func specOffersCipher(spec *tls.ClientHelloSpec, suite uint16) bool {
+	for _, c := range spec.CipherSuites {
+		if c == suite {
+			return true
+		}
+	}
+	return false
+}
+
+// specOffersALPN reports whether spec's ALPN extension lists proto.
+func specOffersALPN(spec *tls.ClientHelloSpec, proto string) bool {
+	for _, ext := range spec.Extensions {
+		if alpn, ok := ext.(*tls.ALPNExtension); ok {
+			for _, p := range alpn.AlpnProtocols {
+				if p == proto {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	return false
+}
+
+// ValidateECHConfigList performs a structural check of an ECHConfigList
+// (draft-ietf-tls-esni): correct length prefixes and at least one config of a
+// version we can use. It does not validate the HPKE key material itself.
+func ValidateECHConfigList(list []byte) error {
+	if len(list) < 2 {
+		return fmt.Errorf("ECH config list too short")
+	}
+	total := int(binary.BigEndian.Uint16(list[0:2]))
+	if total != len(list)-2 {
+		return fmt.Errorf("ECH config list length mismatch: header %d, actual %d", total, len(list)-2)
+	}
+
+	const echVersion = 0xfe0d
+	usable := false
+	rest := list[2:]
+	for len(rest) > 0 {
+		if len(rest) < 4 {
+			return fmt.Errorf("truncated ECH config")
+		}
+		version := binary.BigEndian.Uint16(rest[0:2])
+		length := int(binary.BigEndian.Uint16(rest[2:4]))
+		if len(rest) < 4+length {
+			return fmt.Errorf("truncated ECH config")
+		}
+		if version == echVersion {
+			usable = true
+		}
+		rest = rest[4+length:]
+	}
+	if !usable {
+		return fmt.Errorf("no supported ECH config version")
+	}
+	return nil
+}
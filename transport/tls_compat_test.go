@@ -0,0 +1,170 @@
+package transport
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	stdtls "crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	tls "github.com/sardanioss/utls"
+)
+
+// testSessionState completes a TLS 1.3 handshake with a local server and
+// returns the session the client stored, and its cipher suite
+func testSessionState(t *testing.T) (TLSSessionState, uint16) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		DNSNames:     []string{"example.test"},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ln, err := stdtls.Listen("tcp", "127.0.0.1:0", &stdtls.Config{
+		Certificates: []stdtls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+		NextProtos:   []string{"h2"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte("x")) // The ticket goes out before it
+	}()
+
+	clientConn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cache := NewPersistableSessionCache()
+	client := tls.UClient(clientConn, &tls.Config{
+		ServerName:         "example.test",
+		InsecureSkipVerify: true,
+		NextProtos:         []string{"h2"},
+		ClientSessionCache: cache,
+	}, tls.HelloGolang)
+	defer client.Close()
+	if _, err := client.Read(make([]byte, 1)); err != nil {
+		t.Fatal(err)
+	}
+
+	sessions, err := cache.Export()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, state := range sessions {
+		raw, _ := base64.StdEncoding.DecodeString(state.State)
+		return state, binary.BigEndian.Uint16(raw[3:5])
+	}
+	t.Fatal("no session stored")
+	return TLSSessionState{}, 0
+}
+
+func TestCheckCompatibility(t *testing.T) {
+	state, suite := testSessionState(t)
+	spec := func(versions []uint16, suites []uint16, alpn []string) *tls.ClientHelloSpec {
+		return &tls.ClientHelloSpec{
+			CipherSuites: suites,
+			Extensions: []tls.TLSExtension{
+				&tls.SupportedVersionsExtension{Versions: versions},
+				&tls.ALPNExtension{AlpnProtocols: alpn},
+			},
+		}
+	}
+	tls13 := []uint16{tls.VersionTLS13, tls.VersionTLS12}
+	other := uint16(tls.TLS_CHACHA20_POLY1305_SHA256)
+	if suite == other {
+		other = tls.TLS_AES_128_GCM_SHA256
+	}
+
+	tests := []struct {
+		name string
+		spec *tls.ClientHelloSpec
+		alpn string
+		want string // Substring of the error, "" for none
+	}{
+		{"structural only", nil, "h2", ""},
+		{"compatible", spec(tls13, []uint16{other, suite}, []string{"h2", "http/1.1"}), "h2", ""},
+		{"ALPN unknown", spec(tls13, []uint16{suite}, nil), "", ""},
+		{"version dropped", spec([]uint16{tls.VersionTLS12}, []uint16{suite}, []string{"h2"}), "h2", "TLS version"},
+		{"cipher dropped", spec(tls13, []uint16{other}, []string{"h2"}), "h2", "cipher suite"},
+		{"ALPN dropped", spec(tls13, []uint16{suite}, []string{"http/1.1"}), "h2", "ALPN"},
+		{"no ALPN extension", &tls.ClientHelloSpec{CipherSuites: []uint16{suite}}, "h2", "ALPN"},
+	}
+	for _, tt := range tests {
+		err := state.CheckCompatibility(tt.spec, tt.alpn)
+		if tt.want == "" && err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		if tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+
+	corrupt := state
+	corrupt.State = base64.StdEncoding.EncodeToString([]byte{0x03, 0x04, 0x02})
+	if err := corrupt.CheckCompatibility(nil, ""); err == nil {
+		t.Error("corrupt state passed")
+	}
+}
+
+func TestValidateECHConfigList(t *testing.T) {
+	config := func(version uint16, body []byte) []byte {
+		b := binary.BigEndian.AppendUint16(nil, version)
+		b = binary.BigEndian.AppendUint16(b, uint16(len(body)))
+		return append(b, body...)
+	}
+	list := func(configs ...[]byte) []byte {
+		var body []byte
+		for _, c := range configs {
+			body = append(body, c...)
+		}
+		return append(binary.BigEndian.AppendUint16(nil, uint16(len(body))), body...)
+	}
+
+	valid := list(config(0xfe0d, []byte{1, 2, 3}))
+	tests := []struct {
+		name string
+		list []byte
+		want string
+	}{
+		{"valid", valid, ""},
+		{"unknown version next to a usable one", list(config(0xfe0a, []byte{9}), config(0xfe0d, nil)), ""},
+		{"too short", []byte{0}, "too short"},
+		{"length mismatch", append(valid, 0), "length mismatch"},
+		{"truncated header", list([]byte{0xfe, 0x0d, 0}), "truncated"},
+		{"truncated body", list(config(0xfe0d, []byte{1, 2})[:5]), "truncated"},
+		{"no usable version", list(config(0xfe0a, []byte{1})), "no supported"},
+	}
+	for _, tt := range tests {
+		err := ValidateECHConfigList(tt.list)
+		if tt.want == "" && err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		if tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
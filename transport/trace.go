@@ -0,0 +1,140 @@
+package transport
+
+import (
+	"context"
+	"net"
+	"net/url"
+
+	utls "github.com/sardanioss/utls"
+)
+
+// ClientTrace is a set of hooks run at each stage of a request's connection,
+// in the spirit of net/http/httptrace. Attach it to the request's context
+// with WithClientTrace; any field may be nil. Hooks run synchronously on the
+// request's goroutine except TLSHandshakeDone and Used0RTT for HTTP/3,
+// which fire when the QUIC handshake completes, possibly after the request
+// was sent. Hedged and raced requests report every attempt, so hooks may run
+// concurrently.
+type ClientTrace struct {
+	// DNSStart and DNSDone surround resolving host. They don't run when the
+	// request goes through a proxy, which resolves the target itself.
+	DNSStart func(host string)
+	DNSDone  func(addrs []net.IP, err error)
+
+	// ConnectStart and ConnectDone surround each dial: TCP (network "tcp4"
+	// or "tcp6", or "tcp" to a proxy) or QUIC ("udp4"/"udp6"). With several
+	// addresses there may be several pairs.
+	ConnectStart func(network, addr string)
+	ConnectDone  func(network, addr string, err error)
+
+	// TLSHandshakeStart and TLSHandshakeDone surround the TLS handshake
+	TLSHandshakeStart func()
+	TLSHandshakeDone  func(info TLSHandshakeInfo, err error)
+
+	// ConnectionReused is called instead of the hooks above when the
+	// request goes out on an already open connection
+	ConnectionReused func(protocol, addr string)
+
+	// GotFirstResponseByte is called when the response headers arrive
+	GotFirstResponseByte func()
+
+	// Used0RTT is called when a resumed HTTP/3 connection's early data was
+	// accepted, so the request left before the handshake completed
+	Used0RTT func()
+}
+
+// TLSHandshakeInfo describes a completed TLS handshake
+type TLSHandshakeInfo struct {
+	Version     uint16
+	CipherSuite uint16
+	ALPN        string // Negotiated protocol
+	ServerName  string
+	Resumed     bool // Resumed from a session ticket
+}
+
+// tlsInfo summarizes a handshake for TLSHandshakeDone
+func tlsInfo(state utls.ConnectionState) TLSHandshakeInfo {
+	return TLSHandshakeInfo{
+		Version:     state.Version,
+		CipherSuite: state.CipherSuite,
+		ALPN:        state.NegotiatedProtocol,
+		ServerName:  state.ServerName,
+		Resumed:     state.DidResume,
+	}
+}
+
+// proxyHostPort returns the host:port of a proxy URL for ConnectStart
+func proxyHostPort(proxyURL string) string {
+	if u, err := url.Parse(proxyURL); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return proxyURL
+}
+
+// clientTraceKey is the context key for a *ClientTrace
+type clientTraceKey struct{}
+
+// WithClientTrace returns a context whose requests report to trace
+func WithClientTrace(ctx context.Context, trace *ClientTrace) context.Context {
+	return context.WithValue(ctx, clientTraceKey{}, trace)
+}
+
+// ContextClientTrace returns the trace attached to ctx, or nil
+func ContextClientTrace(ctx context.Context) *ClientTrace {
+	trace, _ := ctx.Value(clientTraceKey{}).(*ClientTrace)
+	return trace
+}
+
+func (t *ClientTrace) dnsStart(host string) {
+	if t != nil && t.DNSStart != nil {
+		t.DNSStart(host)
+	}
+}
+
+func (t *ClientTrace) dnsDone(addrs []net.IP, err error) {
+	if t != nil && t.DNSDone != nil {
+		t.DNSDone(addrs, err)
+	}
+}
+
+func (t *ClientTrace) connectStart(network, addr string) {
+	if t != nil && t.ConnectStart != nil {
+		t.ConnectStart(network, addr)
+	}
+}
+
+func (t *ClientTrace) connectDone(network, addr string, err error) {
+	if t != nil && t.ConnectDone != nil {
+		t.ConnectDone(network, addr, err)
+	}
+}
+
+func (t *ClientTrace) tlsHandshakeStart() {
+	if t != nil && t.TLSHandshakeStart != nil {
+		t.TLSHandshakeStart()
+	}
+}
+
+func (t *ClientTrace) tlsHandshakeDone(info TLSHandshakeInfo, err error) {
+	if t != nil && t.TLSHandshakeDone != nil {
+		t.TLSHandshakeDone(info, err)
+	}
+}
+
+func (t *ClientTrace) connectionReused(protocol, addr string) {
+	if t != nil && t.ConnectionReused != nil {
+		t.ConnectionReused(protocol, addr)
+	}
+}
+
+func (t *ClientTrace) gotFirstResponseByte() {
+	if t != nil && t.GotFirstResponseByte != nil {
+		t.GotFirstResponseByte()
+	}
+}
+
+func (t *ClientTrace) used0RTT() {
+	if t != nil && t.Used0RTT != nil {
+		t.Used0RTT()
+	}
+}
@@ -4,7 +4,10 @@ import (
 	"bytes"
 	"compress/flate"
 	"compress/gzip"
+	"compress/zlib"
 	"context"
+	crand "crypto/rand"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
@@ -19,6 +22,7 @@ import (
 	"github.com/sardanioss/httpcloak/dns"
 	"github.com/sardanioss/httpcloak/fingerprint"
 	"github.com/sardanioss/httpcloak/protocol"
+	utls "github.com/sardanioss/utls"
 )
 
 // Protocol represents the HTTP protocol version
@@ -130,6 +134,9 @@ type TransportConfig struct {
 	// QuicIdleTimeout is the idle timeout for QUIC connections (default: 30s)
 	QuicIdleTimeout time.Duration
 
+	// Pool tunes HTTP/1.1 and HTTP/2 connection pooling
+	Pool PoolConfig
+
 	// LocalAddr is the local IP address to bind outgoing connections to.
 	// Used for IPv6 rotation with IP_FREEBIND on Linux.
 	LocalAddr string
@@ -153,23 +160,138 @@ type TransportConfig struct {
 	// When false (default), CONNECT request and TLS ClientHello are sent together,
 	// saving one round-trip. Set to true if you experience issues with certain proxies.
 	DisableSpeculativeTLS bool
+
+	// DisableLatencyPinning stops auto mode from pinning an origin to
+	// HTTP/2 when its HTTP/3 is consistently slower (see ProtocolDecision)
+	DisableLatencyPinning bool
+
+	// SSRFProtection refuses requests to hosts resolving to loopback,
+	// private, link-local (cloud metadata), CGNAT, multicast or reserved
+	// addresses, for services fetching user-supplied URLs. Every DNS
+	// answer is checked, on every redirect hop and every dial, so a name
+	// can't be rebound to an internal address between the check and the
+	// connection. Through a proxy the host is resolved locally to be
+	// checked. Unavailable on js/wasm, where every request then fails.
+	SSRFProtection bool
+
+	// ClientHelloSpecHook is an advanced escape hatch that receives every
+	// ClientHelloSpec built from the preset before it is applied. For H1/H2
+	// it runs on a fresh per-connection spec; for H3 it runs once per
+	// transport on the cached QUIC specs (PSK and MASQUE inner specs included).
+	//
+	// WARNING: the presets are validated against real browser captures.
+	// Any change made here can produce a fingerprint no browser sends.
+	// Use it for experiments, not production traffic.
+	ClientHelloSpecHook func(spec *utls.ClientHelloSpec)
+
+	// QUICConfigHook is an advanced escape hatch called with the final
+	// quic.Config right before each QUIC dial, after PSK spec and ECH
+	// selection. The config is a per-dial copy and may be modified freely,
+	// but CachedClientHelloSpec is shared: replace it rather than mutating it.
+	//
+	// WARNING: same caveat as ClientHelloSpecHook - unvalidated territory.
+	QUICConfigHook func(host string, cfg *QUICConfig)
+
+	// TicketIsolation controls whether TLS session tickets are reused across
+	// proxies / local addresses for the same origin. Default (zero value) is
+	// TicketIsolationEgress: tickets never cross egress paths.
+	TicketIsolation TicketIsolation
+
+	// IdentityKey, when set, derives the per-session random choices (TLS
+	// extension and QUIC transport parameter order, the HTTP/3 GREASE
+	// setting) from the key instead of drawing them fresh, so every
+	// transport built for the same key sends the same ClientHello.
+	IdentityKey string
+
+	// ClientCertificates are offered to servers requesting mutual TLS, the
+	// first matching the host being used (see ClientCertificate.Hosts)
+	ClientCertificates []*ClientCertificate
+
+	// CertificatePolicies change certificate verification for some hosts,
+	// the first covering the host being used (see CertificatePolicy)
+	CertificatePolicies []*CertificatePolicy
+
+	// ConnectionCallbacks are handed each new TLS connection to their hosts
+	// with its exported keying material (see ConnectionCallback)
+	ConnectionCallbacks []*ConnectionCallback
+
+	// ProxyAuth answers an HTTP proxy's connection-bound challenge (NTLM,
+	// Negotiate) to CONNECT. The tunnel is then opened without speculative
+	// TLS.
+	ProxyAuth AuthenticatorFunc
+
+	// ServerAuth answers an origin's connection-bound challenge. The
+	// handshake runs over HTTP/1.1 on one connection; a 401 offering its
+	// scheme over HTTP/2 or HTTP/3 is retried over HTTP/1.1. Returning a nil
+	// Authenticator leaves a host's 401 alone.
+	ServerAuth AuthenticatorFunc
+}
+
+// identityKey returns the configured identity key. Safe on a nil config.
+func (c *TransportConfig) identityKey() string {
+	if c == nil {
+		return ""
+	}
+	return c.IdentityKey
+}
+
+// newShuffleSeed returns the extension shuffle seed for a new transport:
+// derived from the identity key if one is configured, random otherwise
+func newShuffleSeed(config *TransportConfig) int64 {
+	if key := config.identityKey(); key != "" {
+		return fingerprint.IdentitySeed(key, "tls-shuffle")
+	}
+	var seedBytes [8]byte
+	crand.Read(seedBytes[:])
+	return int64(binary.LittleEndian.Uint64(seedBytes[:]))
+}
+
+// applyClientHelloSpecHook pins the preset's signature algorithms in spec,
+// then runs ClientHelloSpecHook if one is configured, so the hook has the
+// last word. Safe to call on a nil config.
+func (c *TransportConfig) applyClientHelloSpecHook(preset *fingerprint.Preset, spec *utls.ClientHelloSpec) {
+	fingerprint.ApplySignatureAlgorithms(spec, preset)
+	if c == nil || c.ClientHelloSpecHook == nil || spec == nil {
+		return
+	}
+	c.ClientHelloSpecHook(spec)
 }
 
 // Request represents an HTTP request
 type Request struct {
 	Method     string
 	URL        string
+	Host       string              // Overrides the Host header (:authority on HTTP/2 and HTTP/3); the connection still goes to URL's host
 	Headers    map[string][]string // Multi-value headers (matches http.Header)
 	Body       []byte
 	BodyReader io.Reader // For streaming uploads - used instead of Body if set
 	Timeout    time.Duration
 
+	// BodySource is a replayable body, used instead of Body and BodyReader.
+	// Retries and 307/308 redirects need it when the body is streamed: a
+	// BodyReader can only be sent once (see ErrBodyNotRewindable).
+	BodySource RewindableBody
+
 	// TLSOnly is a per-request override for TLS-only mode.
 	// When set to true, preset HTTP headers are NOT applied - only TLS fingerprinting is used.
 	// When nil, the transport's TLSOnly setting is used.
 	// This is useful for LocalProxy where each request can have different TLS-only settings
 	// via the X-HTTPCloak-TlsOnly header.
 	TLSOnly *bool
+
+	// Redirect overrides the session's redirect settings (nil = use them)
+	Redirect *RedirectPolicy
+
+	// Priority overrides the Priority header the preset's browser would send
+	// for the request's Sec-Fetch-Dest (nil = the browser's). On HTTP/2 it
+	// also sets the stream weight, as Chrome's HEADERS carry the urgency. A
+	// browser that sends no Priority header on the protocol still sends none.
+	Priority *fingerprint.Priority
+
+	// Meta is caller metadata, e.g. a job ID. It is never sent; it follows
+	// the request through redirects, retries and hooks (see
+	// ContextRequestMeta) and comes back on the Response.
+	Meta map[string]any
 }
 
 // RedirectInfo contains information about a redirect response
@@ -177,6 +299,8 @@ type RedirectInfo struct {
 	StatusCode int
 	URL        string
 	Headers    map[string][]string // Multi-value headers
+	Method     string              // Method of the request that got the redirect
+	Cookie     string              // Cookie header sent with that request
 }
 
 // Response represents an HTTP response
@@ -186,8 +310,22 @@ type Response struct {
 	Body       io.ReadCloser       // Streaming body - call Close() when done
 	FinalURL   string
 	Timing     *protocol.Timing
-	Protocol   string // "h1", "h2", or "h3"
+	Protocol   string // "h1", "h2", "h3", or "fetch" (js/wasm)
 	History    []*RedirectInfo
+	Hedged     bool // Response came from the duplicate leg of a hedged request
+
+	// Revalidated is set when the server answered 304 to the session's
+	// revalidation and the body and headers are the cached 200's
+	Revalidated bool
+
+	Meta map[string]any // The request's Meta, handed back
+
+	// CookieTrace is what the session's cookie jar did for the request,
+	// when the session traces cookies
+	CookieTrace *CookieTrace
+
+	// HeaderPolicy is how GetHeader reads a header sent more than once
+	HeaderPolicy DuplicateHeaders
 
 	// bodyBytes caches the body after reading for multiple access
 	bodyBytes []byte
@@ -203,13 +341,11 @@ func (r *Response) Close() error {
 	return nil
 }
 
-// GetHeader returns the first value for the given header key (case-insensitive).
-// Use GetHeaders() for multi-value headers like Set-Cookie.
+// GetHeader returns the value for the given header key (case-insensitive):
+// the first, unless HeaderPolicy says otherwise. Use GetHeaders() for
+// multi-value headers like Set-Cookie.
 func (r *Response) GetHeader(key string) string {
-	if values := r.Headers[strings.ToLower(key)]; len(values) > 0 {
-		return values[0]
-	}
-	return ""
+	return r.HeaderPolicy.HeaderValue(key, r.Headers[strings.ToLower(key)])
 }
 
 // GetHeaders returns all values for the given header key (case-insensitive).
@@ -217,6 +353,11 @@ func (r *Response) GetHeaders(key string) []string {
 	return r.Headers[strings.ToLower(key)]
 }
 
+// MergedHeaders returns the headers with one value each, as MergeHeaders
+func (r *Response) MergedHeaders() map[string]string {
+	return MergeHeaders(r.Headers)
+}
+
 // Bytes returns the response body as a byte slice.
 // If the body has already been read, returns the cached bytes.
 // Otherwise reads the body and caches it.
@@ -260,9 +401,19 @@ type Transport struct {
 	config      *TransportConfig
 
 	// Track protocol support per host
-	protocolSupport   map[string]Protocol // Best known protocol per host
+	protocolSupport   map[string]Protocol  // Best known protocol per host
+	protocolExpiry    map[string]time.Time // When each protocolSupport entry goes stale
+	protocolPins      map[string]string    // Why a protocol was pinned (see ProtocolDecision)
+	protocolLatency   map[string]*originLatency
+	h3Failures        map[string]time.Time // Until when auto mode skips HTTP/3 per host
 	protocolSupportMu sync.RWMutex
 
+	// Protocols forced for some hosts (see SetProtocolPolicy)
+	protocolPolicy map[string]Protocol
+
+	// How long HTTP/3 is skipped after failing (see SetH3FailureBackoff)
+	h3FailureBackoff time.Duration
+
 	// Configuration
 	insecureSkipVerify bool
 
@@ -276,6 +427,19 @@ type Transport struct {
 
 	// TLS-only mode: skip preset HTTP headers, use TLS fingerprint only
 	tlsOnly bool
+
+	// Strict mode: no impersonation (see SetStrictMode); nil when off
+	strict *strictState
+
+	// Return response bodies as received, without decoding Content-Encoding
+	rawBody bool
+
+	// Unread body bytes a closed response drains to keep its connection
+	drainLimit int64
+
+	// Headers removed from requests to matching hosts
+	headerRules []protocol.HeaderRule
+	hostFilter  *HostFilter
 }
 
 // NewTransport creates a new unified transport
@@ -299,15 +463,21 @@ func NewTransportWithConfig(presetName string, proxy *ProxyConfig, config *Trans
 		tlsOnly = config.TLSOnly
 	}
 
+	if config.ssrfProtection() {
+		dnsCache.SetAddressFilter(forbidInternalAddresses)
+	}
+
 	t := &Transport{
 		dnsCache:        dnsCache,
 		preset:          preset,
 		timeout:         30 * time.Second,
 		protocol:        ProtocolAuto,
 		protocolSupport: make(map[string]Protocol),
+		protocolExpiry:  make(map[string]time.Time),
 		proxy:           proxy,
 		config:          config,
 		tlsOnly:         tlsOnly,
+		drainLimit:      DefaultDrainLimit,
 	}
 
 	// Determine effective TCP and UDP proxy URLs
@@ -371,9 +541,46 @@ func NewTransportWithConfig(presetName string, proxy *ProxyConfig, config *Trans
 		t.h3Transport, _ = NewHTTP3TransportWithTransportConfig(preset, dnsCache, config)
 	}
 
+	t.applyTicketPartitions()
+
 	return t
 }
 
+// applyTicketPartitions scopes each protocol's TLS session cache to the
+// egress it dials through, according to TransportConfig.TicketIsolation.
+// H1/H2 use the TCP proxy, H3 the UDP proxy.
+func (t *Transport) applyTicketPartitions() {
+	policy := TicketIsolationEgress
+	localAddr := ""
+	if t.config != nil {
+		policy = t.config.TicketIsolation
+		localAddr = t.config.LocalAddr
+	}
+
+	var tcpProxyURL, udpProxyURL string
+	if t.proxy != nil {
+		tcpProxyURL = t.proxy.TCPProxy
+		if tcpProxyURL == "" {
+			tcpProxyURL = t.proxy.URL
+		}
+		udpProxyURL = t.proxy.UDPProxy
+		if udpProxyURL == "" {
+			udpProxyURL = t.proxy.URL
+		}
+	}
+
+	tcpPartition := egressPartition(policy, tcpProxyURL, localAddr)
+	if t.h1Transport != nil {
+		t.h1Transport.SetTicketPartition(tcpPartition)
+	}
+	if t.h2Transport != nil {
+		t.h2Transport.SetTicketPartition(tcpPartition)
+	}
+	if t.h3Transport != nil {
+		t.h3Transport.SetTicketPartition(egressPartition(policy, udpProxyURL, localAddr))
+	}
+}
+
 // SetProtocol sets the preferred protocol
 func (t *Transport) SetProtocol(p Protocol) {
 	t.protocol = p
@@ -391,6 +598,21 @@ func (t *Transport) SetInsecureSkipVerify(skip bool) {
 	}
 }
 
+// SetRawBody turns off response decompression. Accept-Encoding is still
+// sent as the preset has it; bodies come back in their Content-Encoding.
+func (t *Transport) SetRawBody(raw bool) {
+	t.rawBody = raw
+}
+
+// SetDrainLimit sets how much of an unread response body closing it reads
+// and discards so the connection (HTTP/1.1) or stream (HTTP/2, HTTP/3) ends
+// cleanly; longer bodies close the connection or reset the stream. Default:
+// DefaultDrainLimit. 0 or less never drains.
+func (t *Transport) SetDrainLimit(limit int64) {
+	t.drainLimit = limit
+	t.h1Transport.SetDrainLimit(limit)
+}
+
 // SetDisableECH disables ECH lookup for faster first request
 func (t *Transport) SetDisableECH(disable bool) {
 	if t.h3Transport != nil {
@@ -404,14 +626,22 @@ func (t *Transport) SetProxy(proxy *ProxyConfig) {
 	t.proxy = proxy
 	t.h3ProxyError = nil // Clear stale error from previous proxy config
 
+	// Keep TLS session caches across the rebuild. Tickets stay partitioned
+	// per egress (unless TicketIsolationShared), so the new proxy starts
+	// without resumption while switching back to an old one resumes again.
+	h1Cache := t.h1Transport.GetSessionCache()
+	h2Cache := t.h2Transport.GetSessionCache()
+	h3Cache := t.h3Transport.GetSessionCache()
+
 	// Close existing transports
 	t.h1Transport.Close()
 	t.h2Transport.Close()
 	t.h3Transport.Close()
 
 	// Recreate HTTP/1.1 and HTTP/2 with new proxy config
-	t.h1Transport = NewHTTP1TransportWithProxy(t.preset, t.dnsCache, proxy)
-	t.h2Transport = NewHTTP2TransportWithProxy(t.preset, t.dnsCache, proxy)
+	t.h1Transport = NewHTTP1TransportWithConfig(t.preset, t.dnsCache, proxy, t.config)
+	t.h1Transport.SetDrainLimit(t.drainLimit)
+	t.h2Transport = NewHTTP2TransportWithConfig(t.preset, t.dnsCache, proxy, t.config)
 
 	// Recreate HTTP/3 - with proxy support if applicable
 	// Check both URL (unified proxy) and UDPProxy (split proxy config)
@@ -427,34 +657,46 @@ func (t *Transport) SetProxy(proxy *ProxyConfig) {
 	if udpProxyURL != "" {
 		if isSOCKS5Proxy(udpProxyURL) {
 			h3Proxy := &ProxyConfig{URL: udpProxyURL}
-			h3Transport, err := NewHTTP3TransportWithProxy(t.preset, t.dnsCache, h3Proxy)
+			h3Transport, err := NewHTTP3TransportWithConfig(t.preset, t.dnsCache, h3Proxy, t.config)
 			if err != nil {
 				t.h3ProxyError = fmt.Errorf("SOCKS5 UDP proxy initialization failed: %w", err)
-				t.h3Transport, _ = NewHTTP3Transport(t.preset, t.dnsCache)
+				t.h3Transport, _ = NewHTTP3TransportWithTransportConfig(t.preset, t.dnsCache, t.config)
 			} else {
 				t.h3Transport = h3Transport
 			}
 		} else if isMASQUEProxy(udpProxyURL) {
 			h3Proxy := &ProxyConfig{URL: udpProxyURL}
-			h3Transport, err := NewHTTP3TransportWithMASQUE(t.preset, t.dnsCache, h3Proxy, nil)
+			h3Transport, err := NewHTTP3TransportWithMASQUE(t.preset, t.dnsCache, h3Proxy, t.config)
 			if err != nil {
 				t.h3ProxyError = fmt.Errorf("MASQUE proxy initialization failed: %w", err)
-				t.h3Transport, _ = NewHTTP3Transport(t.preset, t.dnsCache)
+				t.h3Transport, _ = NewHTTP3TransportWithTransportConfig(t.preset, t.dnsCache, t.config)
 			} else {
 				t.h3Transport = h3Transport
 			}
 		} else {
 			// HTTP proxy does not support HTTP/3 (QUIC requires UDP)
 			t.h3ProxyError = fmt.Errorf("HTTP proxy does not support HTTP/3 (QUIC requires UDP)")
-			t.h3Transport, _ = NewHTTP3Transport(t.preset, t.dnsCache)
+			t.h3Transport, _ = NewHTTP3TransportWithTransportConfig(t.preset, t.dnsCache, t.config)
 		}
 	} else {
-		t.h3Transport, _ = NewHTTP3Transport(t.preset, t.dnsCache)
+		t.h3Transport, _ = NewHTTP3TransportWithTransportConfig(t.preset, t.dnsCache, t.config)
+	}
+
+	t.h1Transport.SetSessionCache(h1Cache)
+	t.h2Transport.SetSessionCache(h2Cache)
+	if t.h3Transport != nil {
+		t.h3Transport.SetSessionCache(h3Cache)
 	}
+	t.applyTicketPartitions()
 }
 
 // SetPreset changes the fingerprint preset
 func (t *Transport) SetPreset(presetName string) {
+	if t.strict != nil {
+		// The preset strict mode goes back to is the one replaced
+		t.SetStrictMode(false)
+		defer t.SetStrictMode(true)
+	}
 	t.preset = fingerprint.Get(presetName)
 
 	// Close all transports
@@ -463,31 +705,34 @@ func (t *Transport) SetPreset(presetName string) {
 	t.h3Transport.Close()
 
 	// Recreate HTTP/1.1 and HTTP/2 with new preset
-	t.h1Transport = NewHTTP1TransportWithProxy(t.preset, t.dnsCache, t.proxy)
-	t.h2Transport = NewHTTP2TransportWithProxy(t.preset, t.dnsCache, t.proxy)
+	t.h1Transport = NewHTTP1TransportWithConfig(t.preset, t.dnsCache, t.proxy, t.config)
+	t.h1Transport.SetDrainLimit(t.drainLimit)
+	t.h2Transport = NewHTTP2TransportWithConfig(t.preset, t.dnsCache, t.proxy, t.config)
 
 	// Recreate HTTP/3 - with proxy support if applicable
 	if t.proxy != nil && t.proxy.URL != "" {
 		if isSOCKS5Proxy(t.proxy.URL) {
-			h3Transport, err := NewHTTP3TransportWithProxy(t.preset, t.dnsCache, t.proxy)
+			h3Transport, err := NewHTTP3TransportWithConfig(t.preset, t.dnsCache, t.proxy, t.config)
 			if err != nil {
-				t.h3Transport, _ = NewHTTP3Transport(t.preset, t.dnsCache)
+				t.h3Transport, _ = NewHTTP3TransportWithTransportConfig(t.preset, t.dnsCache, t.config)
 			} else {
 				t.h3Transport = h3Transport
 			}
 		} else if isMASQUEProxy(t.proxy.URL) {
-			h3Transport, err := NewHTTP3TransportWithMASQUE(t.preset, t.dnsCache, t.proxy, nil)
+			h3Transport, err := NewHTTP3TransportWithMASQUE(t.preset, t.dnsCache, t.proxy, t.config)
 			if err != nil {
-				t.h3Transport, _ = NewHTTP3Transport(t.preset, t.dnsCache)
+				t.h3Transport, _ = NewHTTP3TransportWithTransportConfig(t.preset, t.dnsCache, t.config)
 			} else {
 				t.h3Transport = h3Transport
 			}
 		} else {
-			t.h3Transport, _ = NewHTTP3Transport(t.preset, t.dnsCache)
+			t.h3Transport, _ = NewHTTP3TransportWithTransportConfig(t.preset, t.dnsCache, t.config)
 		}
 	} else {
-		t.h3Transport, _ = NewHTTP3Transport(t.preset, t.dnsCache)
+		t.h3Transport, _ = NewHTTP3TransportWithTransportConfig(t.preset, t.dnsCache, t.config)
 	}
+
+	t.applyTicketPartitions()
 }
 
 // isSOCKS5Proxy checks if the proxy URL is a SOCKS5 proxy
@@ -691,18 +936,59 @@ func (c *TransportConfig) GetECHConfig(ctx context.Context, targetHost string) [
 	return echConfig
 }
 
+// echLookupHost returns the host whose DNS HTTPS record GetECHConfig consults
+// for targetHost, or "" when the config is supplied directly.
+func (c *TransportConfig) echLookupHost(targetHost string) string {
+	if c == nil {
+		return targetHost
+	}
+	if len(c.ECHConfig) > 0 {
+		return ""
+	}
+	if c.ECHConfigDomain != "" {
+		return c.ECHConfigDomain
+	}
+	return targetHost
+}
+
 // Do executes an HTTP request
 func (t *Transport) Do(ctx context.Context, req *Request) (*Response, error) {
+	resp, err := t.do(ctx, req)
+	if err == nil && t.needsHTTP1Auth(req, resp) {
+		// Connection-bound handshakes run over HTTP/1.1
+		resp.Close()
+		return t.doHTTP1(ctx, req)
+	}
+	return resp, err
+}
+
+func (t *Transport) do(ctx context.Context, req *Request) (*Response, error) {
 	// Parse URL to determine scheme
 	parsedURL, err := url.Parse(req.URL)
 	if err != nil {
 		return nil, NewRequestError("parse_url", "", "", "", err)
 	}
+	if err := t.hostFilter.Check(parsedURL.Hostname()); err != nil {
+		return nil, err
+	}
+	if err := t.checkAddresses(ctx, parsedURL.Hostname()); err != nil {
+		return nil, err
+	}
+
+	// Platforms without raw sockets (js/wasm) hand the request to the host
+	if resp, ok, err := t.doPlatform(ctx, req); ok {
+		return resp, err
+	}
 
 	// For HTTP (non-TLS), only HTTP/1.1 is supported
 	if parsedURL.Scheme == "http" {
 		return t.doHTTP1(ctx, req)
 	}
+	if t.strict != nil {
+		return t.doStrict(ctx, req)
+	}
+	host := parsedURL.Hostname()
+	proto := t.protocolFor(host)
 
 	// When proxy is configured, respect user's protocol choice
 	// Check for any proxy (URL, TCPProxy, or UDPProxy)
@@ -717,7 +1003,7 @@ func (t *Transport) Do(ctx context.Context, req *Request) (*Response, error) {
 		}
 
 		// Respect user's explicit protocol choice
-		switch t.protocol {
+		switch proto {
 		case ProtocolHTTP1:
 			return t.doHTTP1(ctx, req)
 
@@ -745,12 +1031,15 @@ func (t *Transport) Do(ctx context.Context, req *Request) (*Response, error) {
 				return t.doHTTP1(ctx, req)
 			}
 
-			if SupportsQUIC(effectiveProxyURL) {
+			if SupportsQUIC(effectiveProxyURL) && !t.h3Failed(host) {
 				// SOCKS5 or MASQUE proxy - prefer HTTP/3 for best fingerprinting
 				resp, err := t.doHTTP3(ctx, req)
 				if err == nil {
 					return resp, nil
 				}
+				if ctx.Err() == nil {
+					t.markH3Failed(host)
+				}
 				// Fallback to HTTP/2 if HTTP/3 fails
 				resp, err = t.doHTTP2(ctx, req)
 				if err == nil {
@@ -770,7 +1059,7 @@ func (t *Transport) Do(ctx context.Context, req *Request) (*Response, error) {
 		}
 	}
 
-	switch t.protocol {
+	switch proto {
 	case ProtocolHTTP1:
 		return t.doHTTP1(ctx, req)
 	case ProtocolHTTP2:
@@ -778,7 +1067,12 @@ func (t *Transport) Do(ctx context.Context, req *Request) (*Response, error) {
 	case ProtocolHTTP3:
 		return t.doHTTP3(ctx, req)
 	case ProtocolAuto:
-		return t.doAuto(ctx, req)
+		resp, err := t.doAuto(ctx, req)
+		if err == nil {
+			t.observeAltSvc(host, resp)
+			t.observeLatency(host, resp)
+		}
+		return resp, err
 	default:
 		return t.doHTTP2(ctx, req)
 	}
@@ -791,14 +1085,26 @@ func (t *Transport) doAuto(ctx context.Context, req *Request) (*Response, error)
 	host := extractHost(req.URL)
 
 	// Check if we already know the best protocol for this host
-	t.protocolSupportMu.RLock()
-	knownProtocol, known := t.protocolSupport[host]
-	t.protocolSupportMu.RUnlock()
+	knownProtocol, known := t.knownProtocol(host)
 
 	if known {
 		switch knownProtocol {
 		case ProtocolHTTP3:
-			return t.doHTTP3(ctx, req)
+			// Now and then measure HTTP/2 to compare (see observeLatency)
+			if t.probeH2(host, req) {
+				if resp, err := t.doHTTP2(ctx, req); err == nil {
+					return resp, nil
+				}
+			}
+			resp, err := t.doHTTP3(ctx, req)
+			if err == nil || ctx.Err() != nil {
+				return resp, err
+			}
+			// Stop using HTTP/3 for a while; the retry goes over TCP
+			if !t.markH3Failed(host) || !req.Replayable() {
+				return nil, err
+			}
+			return t.doAuto(ctx, req)
 		case ProtocolHTTP2:
 			resp, err := t.doHTTP2(ctx, req)
 			if err == nil {
@@ -816,13 +1122,13 @@ func (t *Transport) doAuto(ctx context.Context, req *Request) (*Response, error)
 		}
 	}
 
-	// Race HTTP/3 and HTTP/2 in parallel if H3 is supported
-	if t.preset.SupportHTTP3 {
+	// Race HTTP/3 and HTTP/2 in parallel if H3 is supported, unless it
+	// failed for the host recently or the host's HTTPS records (looked up by
+	// an earlier HTTP/3 dial for its ECH config) leave h3 out
+	if t.preset.SupportHTTP3 && quicSupported && !t.h3Failed(host) && httpsRecordsAllowH3(host) {
 		resp, protocol, err := t.raceH3H2(ctx, req)
 		if err == nil {
-			t.protocolSupportMu.Lock()
-			t.protocolSupport[host] = protocol
-			t.protocolSupportMu.Unlock()
+			t.learnProtocol(host, protocol, defaultDiscoveryTTL)
 			return resp, nil
 		}
 		// Check if ALPN mismatch from H2 - reuse connection
@@ -830,9 +1136,7 @@ func (t *Transport) doAuto(ctx context.Context, req *Request) (*Response, error)
 		if errors.As(err, &alpnErr) {
 			resp, err := t.doHTTP1WithTLSConn(ctx, req, alpnErr)
 			if err == nil {
-				t.protocolSupportMu.Lock()
-				t.protocolSupport[host] = ProtocolHTTP1
-				t.protocolSupportMu.Unlock()
+				t.learnProtocol(host, ProtocolHTTP1, defaultDiscoveryTTL)
 			}
 			return resp, err
 		}
@@ -841,9 +1145,7 @@ func (t *Transport) doAuto(ctx context.Context, req *Request) (*Response, error)
 		// No H3 support, just try H2
 		resp, err := t.doHTTP2(ctx, req)
 		if err == nil {
-			t.protocolSupportMu.Lock()
-			t.protocolSupport[host] = ProtocolHTTP2
-			t.protocolSupportMu.Unlock()
+			t.learnProtocol(host, ProtocolHTTP2, defaultDiscoveryTTL)
 			return resp, nil
 		}
 		// Check if ALPN mismatch - reuse connection for H1
@@ -851,9 +1153,7 @@ func (t *Transport) doAuto(ctx context.Context, req *Request) (*Response, error)
 		if errors.As(err, &alpnErr) {
 			resp, err := t.doHTTP1WithTLSConn(ctx, req, alpnErr)
 			if err == nil {
-				t.protocolSupportMu.Lock()
-				t.protocolSupport[host] = ProtocolHTTP1
-				t.protocolSupportMu.Unlock()
+				t.learnProtocol(host, ProtocolHTTP1, defaultDiscoveryTTL)
 			}
 			return resp, err
 		}
@@ -862,15 +1162,28 @@ func (t *Transport) doAuto(ctx context.Context, req *Request) (*Response, error)
 	// Fallback to HTTP/1.1 with new connection
 	resp, err := t.doHTTP1(ctx, req)
 	if err == nil {
-		t.protocolSupportMu.Lock()
-		t.protocolSupport[host] = ProtocolHTTP1
-		t.protocolSupportMu.Unlock()
+		t.learnProtocol(host, ProtocolHTTP1, defaultDiscoveryTTL)
 		return resp, nil
 	}
 
 	return nil, err
 }
 
+// httpsRecordsAllowH3 reports whether host's cached HTTPS records offer
+// HTTP/3. Without cached records it returns true so auto mode races.
+func httpsRecordsAllowH3(host string) bool {
+	records, ok := dns.CachedHTTPS(host)
+	if !ok || len(records) == 0 {
+		return true
+	}
+	for _, r := range records {
+		if r.SupportsHTTP3() {
+			return true
+		}
+	}
+	return false
+}
+
 // connectResult holds the result of a connection race
 type connectResult struct {
 	protocol Protocol
@@ -911,6 +1224,9 @@ func (t *Transport) raceH3H2(ctx context.Context, req *Request) (*Response, Prot
 			case winnerCh <- ProtocolHTTP3:
 			default:
 			}
+		} else if raceCtx.Err() == nil {
+			// Failed on its own rather than losing the race
+			t.markH3Failed(host)
 		}
 	}()
 
@@ -999,6 +1315,9 @@ func (t *Transport) raceH3H2(ctx context.Context, req *Request) (*Response, Prot
 	switch winningProtocol {
 	case ProtocolHTTP3:
 		resp, err := t.doHTTP3(ctx, req)
+		if err != nil && ctx.Err() == nil {
+			t.markH3Failed(host)
+		}
 		return resp, ProtocolHTTP3, err
 	case ProtocolHTTP2:
 		resp, err := t.doHTTP2(ctx, req)
@@ -1066,14 +1385,7 @@ func (t *Transport) doHTTP1(ctx context.Context, req *Request) (*Response, error
 		method = "GET"
 	}
 
-	var bodyReader io.Reader
-	if req.BodyReader != nil {
-		bodyReader = req.BodyReader
-	} else if len(req.Body) > 0 {
-		bodyReader = bytes.NewReader(req.Body)
-	}
-
-	httpReq, err := http.NewRequestWithContext(ctx, method, req.URL, bodyReader)
+	httpReq, err := newHTTPRequest(ctx, method, req)
 	if err != nil {
 		return nil, NewRequestError("create_request", host, port, "h1", err)
 	}
@@ -1100,6 +1412,9 @@ func (t *Transport) doHTTP1(ctx context.Context, req *Request) (*Response, error
 		}
 	}
 
+	applyRequestPriority(httpReq, t.preset, req.Headers, req.Priority, effectiveTLSOnly, "h1")
+	t.applyHeaderRules(httpReq)
+
 	// Record timing before request
 	reqStart := time.Now()
 
@@ -1110,6 +1425,7 @@ func (t *Transport) doHTTP1(ctx context.Context, req *Request) (*Response, error
 	}
 	defer resp.Body.Close()
 
+	ContextClientTrace(ctx).gotFirstResponseByte()
 	timing.FirstByte = float64(time.Since(reqStart).Milliseconds())
 
 	// Read response body with pre-allocation for known content length
@@ -1120,8 +1436,8 @@ func (t *Transport) doHTTP1(ctx context.Context, req *Request) (*Response, error
 
 	// Decompress if needed
 	contentEncoding := resp.Header.Get("Content-Encoding")
-	if contentEncoding != "" {
-		decompressed, err := decompress(body, contentEncoding)
+	if contentEncoding != "" && !t.rawBody {
+		decompressed, err := Decompress(body, contentEncoding)
 		if err != nil {
 			releaseBody() // Release pooled buffer on error
 			return nil, NewRequestError("decompress", host, port, "h1", err)
@@ -1178,14 +1494,7 @@ func (t *Transport) doHTTP1WithTLSConn(ctx context.Context, req *Request, alpnEr
 		method = "GET"
 	}
 
-	var bodyReader io.Reader
-	if req.BodyReader != nil {
-		bodyReader = req.BodyReader
-	} else if len(req.Body) > 0 {
-		bodyReader = bytes.NewReader(req.Body)
-	}
-
-	httpReq, err := http.NewRequestWithContext(ctx, method, req.URL, bodyReader)
+	httpReq, err := newHTTPRequest(ctx, method, req)
 	if err != nil {
 		alpnErr.TLSConn.Close()
 		return nil, NewRequestError("create_request", host, port, "h1", err)
@@ -1212,6 +1521,9 @@ func (t *Transport) doHTTP1WithTLSConn(ctx context.Context, req *Request, alpnEr
 		}
 	}
 
+	applyRequestPriority(httpReq, t.preset, req.Headers, req.Priority, effectiveTLSOnly, "h1")
+	t.applyHeaderRules(httpReq)
+
 	// Record timing before request
 	reqStart := time.Now()
 
@@ -1222,6 +1534,7 @@ func (t *Transport) doHTTP1WithTLSConn(ctx context.Context, req *Request, alpnEr
 	}
 	defer resp.Body.Close()
 
+	ContextClientTrace(ctx).gotFirstResponseByte()
 	timing.FirstByte = float64(time.Since(reqStart).Milliseconds())
 
 	// Read response body with pre-allocation for known content length
@@ -1232,8 +1545,8 @@ func (t *Transport) doHTTP1WithTLSConn(ctx context.Context, req *Request, alpnEr
 
 	// Decompress if needed
 	contentEncoding := resp.Header.Get("Content-Encoding")
-	if contentEncoding != "" {
-		decompressed, err := decompress(body, contentEncoding)
+	if contentEncoding != "" && !t.rawBody {
+		decompressed, err := Decompress(body, contentEncoding)
 		if err != nil {
 			releaseBody()
 			return nil, NewRequestError("decompress", host, port, "h1", err)
@@ -1298,14 +1611,7 @@ func (t *Transport) doHTTP2(ctx context.Context, req *Request) (*Response, error
 		method = "GET"
 	}
 
-	var bodyReader io.Reader
-	if req.BodyReader != nil {
-		bodyReader = req.BodyReader
-	} else if len(req.Body) > 0 {
-		bodyReader = bytes.NewReader(req.Body)
-	}
-
-	httpReq, err := http.NewRequestWithContext(ctx, method, req.URL, bodyReader)
+	httpReq, err := newHTTPRequest(ctx, method, req)
 	if err != nil {
 		return nil, NewRequestError("create_request", host, port, "h2", err)
 	}
@@ -1331,6 +1637,9 @@ func (t *Transport) doHTTP2(ctx context.Context, req *Request) (*Response, error
 		}
 	}
 
+	applyRequestPriority(httpReq, t.preset, req.Headers, req.Priority, effectiveTLSOnly, "h2")
+	t.applyHeaderRules(httpReq)
+
 	// Record timing before request
 	reqStart := time.Now()
 
@@ -1341,6 +1650,7 @@ func (t *Transport) doHTTP2(ctx context.Context, req *Request) (*Response, error
 	}
 	defer resp.Body.Close()
 
+	ContextClientTrace(ctx).gotFirstResponseByte()
 	timing.FirstByte = float64(time.Since(reqStart).Milliseconds())
 
 	// Read response body with pre-allocation for known content length
@@ -1351,8 +1661,8 @@ func (t *Transport) doHTTP2(ctx context.Context, req *Request) (*Response, error
 
 	// Decompress if needed
 	contentEncoding := resp.Header.Get("Content-Encoding")
-	if contentEncoding != "" {
-		decompressed, err := decompress(body, contentEncoding)
+	if contentEncoding != "" && !t.rawBody {
+		decompressed, err := Decompress(body, contentEncoding)
 		if err != nil {
 			releaseBody()
 			return nil, NewRequestError("decompress", host, port, "h2", err)
@@ -1432,14 +1742,7 @@ func (t *Transport) doHTTP3(ctx context.Context, req *Request) (*Response, error
 		method = "GET"
 	}
 
-	var bodyReader io.Reader
-	if req.BodyReader != nil {
-		bodyReader = req.BodyReader
-	} else if len(req.Body) > 0 {
-		bodyReader = bytes.NewReader(req.Body)
-	}
-
-	httpReq, err := http.NewRequestWithContext(ctx, method, req.URL, bodyReader)
+	httpReq, err := newHTTPRequest(ctx, method, req)
 	if err != nil {
 		return nil, NewRequestError("create_request", host, port, "h3", err)
 	}
@@ -1465,6 +1768,9 @@ func (t *Transport) doHTTP3(ctx context.Context, req *Request) (*Response, error
 		}
 	}
 
+	applyRequestPriority(httpReq, t.preset, req.Headers, req.Priority, effectiveTLSOnly, "h3")
+	t.applyHeaderRules(httpReq)
+
 	// Record timing before request
 	reqStart := time.Now()
 
@@ -1475,6 +1781,7 @@ func (t *Transport) doHTTP3(ctx context.Context, req *Request) (*Response, error
 	}
 	defer resp.Body.Close()
 
+	ContextClientTrace(ctx).gotFirstResponseByte()
 	timing.FirstByte = float64(time.Since(reqStart).Milliseconds())
 
 	// Read response body with pre-allocation for known content length
@@ -1485,8 +1792,8 @@ func (t *Transport) doHTTP3(ctx context.Context, req *Request) (*Response, error
 
 	// Decompress if needed
 	contentEncoding := resp.Header.Get("Content-Encoding")
-	if contentEncoding != "" {
-		decompressed, err := decompress(body, contentEncoding)
+	if contentEncoding != "" && !t.rawBody {
+		decompressed, err := Decompress(body, contentEncoding)
 		if err != nil {
 			releaseBody()
 			return nil, NewRequestError("decompress", host, port, "h3", err)
@@ -1566,6 +1873,11 @@ func (t *Transport) Stats() map[string]interface{} {
 	}
 }
 
+// GetPreset returns the preset requests are sent with
+func (t *Transport) GetPreset() *fingerprint.Preset {
+	return t.preset
+}
+
 // GetDNSCache returns the DNS cache
 func (t *Transport) GetDNSCache() *dns.Cache {
 	return t.dnsCache
@@ -1575,6 +1887,10 @@ func (t *Transport) GetDNSCache() *dns.Cache {
 func (t *Transport) ClearProtocolCache() {
 	t.protocolSupportMu.Lock()
 	t.protocolSupport = make(map[string]Protocol)
+	t.protocolExpiry = make(map[string]time.Time)
+	t.protocolPins = nil
+	t.protocolLatency = nil
+	t.h3Failures = nil
 	t.protocolSupportMu.Unlock()
 }
 
@@ -1644,13 +1960,10 @@ func applyPresetHeaders(httpReq *http.Request, preset *fingerprint.Preset, custo
 		}
 		httpReq.Header.Set("User-Agent", preset.UserAgent)
 
-		// Chrome does NOT send Priority header on HTTP/1.1, only on HTTP/2 and HTTP/3.
-		// Some anti-bots (Cloudflare, Datadome, Akamai) check for this and flag requests
-		// that send Priority on H1 as bots.
-		if protocol == "h1" && isChromePreset(preset.Name) {
-			httpReq.Header.Del("Priority")
-			httpReq.Header.Del("priority")
-		}
+		// Priority as the preset's browser sends it for a navigation over this
+		// protocol. Chrome does NOT send it on HTTP/1.1, and some anti-bots
+		// (Cloudflare, Datadome, Akamai) flag requests that do as bots.
+		setPriority(httpReq.Header, preset, fingerprint.FetchDestDocument, protocol)
 	} else {
 		// TLS-only mode: set empty User-Agent to prevent Go's default "Go-http-client/2.0"
 		// This marks didUA=true in httpcommon.EncodeHeaders but skips writing the value
@@ -1681,17 +1994,73 @@ func applyPresetHeaders(httpReq *http.Request, preset *fingerprint.Preset, custo
 	}
 
 	// Set pseudo-header order based on browser type
-	// Safari/iOS uses m,s,p,a; Chrome uses m,a,s,p
-	if preset.HTTP2Settings.NoRFC7540Priorities {
-		httpReq.Header[http.PHeaderOrderKey] = []string{":method", ":scheme", ":path", ":authority"}
+	// Safari/iOS uses m,s,p,a; Chrome uses m,a,s,p; Firefox uses m,p,a,s
+	httpReq.Header[http.PHeaderOrderKey] = append([]string(nil), preset.HTTP2Settings.PseudoHeaders()...)
+}
+
+// PresetHeaders returns the header map a request would be sent with over
+// protocol ("h1", "h2" or "h3"): the preset's headers, then headers on top,
+// with the ordering keys the HTTP stack serializes by. It is what the
+// transports apply before writing a request and is exposed for fingerprint
+// testing (see package fptest).
+func PresetHeaders(preset *fingerprint.Preset, headers map[string][]string, headerOrder []string, tlsOnly bool, protocol string) http.Header {
+	httpReq := &http.Request{Header: make(http.Header)}
+	applyPresetHeaders(httpReq, preset, headerOrder, tlsOnly, protocol)
+	for key, values := range headers {
+		for i, value := range values {
+			if i == 0 {
+				httpReq.Header.Set(key, value)
+			} else {
+				httpReq.Header.Add(key, value)
+			}
+		}
+	}
+	applyRequestPriority(httpReq, preset, headers, nil, tlsOnly, protocol)
+	return httpReq.Header
+}
+
+// setPriority sets the Priority header the preset's browser sends for a
+// request to dest over protocol, removing it if the browser sends none
+func setPriority(header http.Header, preset *fingerprint.Preset, dest fingerprint.FetchDest, protocol string) {
+	if v := preset.PriorityHeader(dest, protocol); v != "" {
+		header.Set("Priority", v)
 	} else {
-		httpReq.Header[http.PHeaderOrderKey] = []string{":method", ":authority", ":scheme", ":path"}
+		header.Del("Priority")
 	}
 }
 
-// isChromePreset returns true if the preset name indicates a Chrome fingerprint.
-func isChromePreset(name string) bool {
-	return strings.HasPrefix(name, "chrome-") || strings.HasPrefix(name, "Chrome")
+// applyRequestPriority matches the Priority header to the request's
+// Sec-Fetch-Dest when the caller set the destination (a script or image
+// fetch, say) but not Priority itself, or to override when it isn't nil. A
+// caller's Sec-Fetch-Mode other than navigate also drops the
+// navigation-only headers the preset added.
+func applyRequestPriority(httpReq *http.Request, preset *fingerprint.Preset, headers map[string][]string, override *fingerprint.Priority, tlsOnly bool, protocol string) {
+	if tlsOnly {
+		return
+	}
+	if mode := headerValues(headers, "Sec-Fetch-Mode"); len(mode) > 0 && mode[0] != "" && mode[0] != string(fingerprint.FetchModeNavigate) {
+		for _, name := range []string{"Sec-Fetch-User", "Upgrade-Insecure-Requests"} {
+			if len(headerValues(headers, name)) == 0 {
+				httpReq.Header.Del(name)
+			}
+		}
+	}
+	if len(headerValues(headers, "Priority")) > 0 {
+		return
+	}
+	if override != nil {
+		if v := override.String(); v != "" && preset.Priorities().Sends(protocol) {
+			httpReq.Header.Set("Priority", v)
+		} else {
+			httpReq.Header.Del("Priority")
+		}
+		return
+	}
+	dest := headerValues(headers, "Sec-Fetch-Dest")
+	if len(dest) == 0 || dest[0] == "" {
+		return
+	}
+	setPriority(httpReq.Header, preset, fingerprint.FetchDest(dest[0]), protocol)
 }
 
 func extractHost(urlStr string) string {
@@ -1710,7 +2079,9 @@ func buildHeadersMap(h http.Header) map[string][]string {
 		lowerKey := strings.ToLower(key)
 		// Copy values to avoid sharing underlying array
 		headerValues := make([]string, len(values))
-		copy(headerValues, values)
+		for i, v := range values {
+			headerValues[i] = NormalizeHeaderValue(v)
+		}
 		headers[lowerKey] = headerValues
 	}
 	return headers
@@ -1772,9 +2143,24 @@ func readBodyOptimized(body io.Reader, contentLength int64) ([]byte, func(), err
 	return result, func() {}, nil
 }
 
-func decompress(data []byte, encoding string) ([]byte, error) {
+// Decompress decodes data per a Content-Encoding header value. Stacked
+// codings ("gzip, br") are undone last-applied first. deflate accepts both
+// the zlib stream RFC 9110 specifies and the raw DEFLATE some servers send,
+// as browsers do. Unknown codings leave the data as it is.
+func Decompress(data []byte, encoding string) ([]byte, error) {
+	codings := strings.Split(encoding, ",")
+	for i := len(codings) - 1; i >= 0; i-- {
+		var err error
+		if data, err = decodeContent(data, strings.TrimSpace(codings[i])); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+func decodeContent(data []byte, encoding string) ([]byte, error) {
 	switch strings.ToLower(encoding) {
-	case "gzip":
+	case "gzip", "x-gzip":
 		reader, err := gzip.NewReader(bytes.NewReader(data))
 		if err != nil {
 			return nil, err
@@ -1795,6 +2181,10 @@ func decompress(data []byte, encoding string) ([]byte, error) {
 		return io.ReadAll(decoder)
 
 	case "deflate":
+		if reader, err := zlib.NewReader(bytes.NewReader(data)); err == nil {
+			defer reader.Close()
+			return io.ReadAll(reader)
+		}
 		reader := flate.NewReader(bytes.NewReader(data))
 		defer reader.Close()
 		return io.ReadAll(reader)
@@ -1806,3 +2196,17 @@ func decompress(data []byte, encoding string) ([]byte, error) {
 		return data, nil
 	}
 }
+
+// closeWithTimeout closes a closer with a timeout to prevent blocking indefinitely.
+// QUIC connections may block on Close() waiting for graceful drain.
+func closeWithTimeout(c io.Closer, timeout time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		c.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+	}
+}
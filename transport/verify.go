@@ -0,0 +1,127 @@
+package transport
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	utls "github.com/sardanioss/utls"
+)
+
+// ErrPinMismatch is returned when no certificate of a server's verified
+// chain has one of the pinned keys
+var ErrPinMismatch = errors.New("certificate pin mismatch")
+
+// CertificatePolicy changes how the certificates of some hosts are
+// verified. It applies to HTTP/1.1, HTTP/2 and HTTP/3 alike, and to resumed
+// connections too.
+type CertificatePolicy struct {
+	// Hosts the policy covers. "example.com" includes its subdomains; "*"
+	// or no hosts at all matches every host.
+	Hosts []string
+
+	// Pins are SPKI pins ("sha256/<base64>", see SPKIPin). A connection
+	// passes if a certificate of one of its verified chains has one of
+	// them; with InsecureSkipVerify only the leaf certificate counts.
+	Pins []string
+
+	// RootCAs replaces the system roots
+	RootCAs *x509.CertPool
+
+	// InsecureSkipVerify accepts any certificate chain. Pins and
+	// VerifyPeerCertificate still apply.
+	InsecureSkipVerify bool
+
+	// VerifyPeerCertificate is called after the other checks with the
+	// server's certificates and, unless InsecureSkipVerify, its verified
+	// chains. An error fails the handshake.
+	VerifyPeerCertificate func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error
+}
+
+// SPKIPin returns the pin of a certificate's public key, as used by
+// CertificatePolicy.Pins and HPKP
+func SPKIPin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return "sha256/" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// matches reports whether the policy covers host
+func (p *CertificatePolicy) matches(host string) bool {
+	return len(p.Hosts) == 0 || hostMatchesAny(host, p.Hosts)
+}
+
+// verify checks a connection against the pins and callback
+func (p *CertificatePolicy) verify(host string, cs utls.ConnectionState) error {
+	if len(p.Pins) > 0 {
+		if !p.pinned(cs) {
+			return fmt.Errorf("%w for %s", ErrPinMismatch, host)
+		}
+	}
+	if p.VerifyPeerCertificate != nil {
+		rawCerts := make([][]byte, len(cs.PeerCertificates))
+		for i, cert := range cs.PeerCertificates {
+			rawCerts[i] = cert.Raw
+		}
+		return p.VerifyPeerCertificate(rawCerts, cs.VerifiedChains)
+	}
+	return nil
+}
+
+// pinned reports whether a certificate the connection vouches for has one
+// of the pins. The server picks what it sends, so only verified chains
+// count, or the leaf alone when verification is skipped.
+func (p *CertificatePolicy) pinned(cs utls.ConnectionState) bool {
+	var certs []*x509.Certificate
+	for _, chain := range cs.VerifiedChains {
+		certs = append(certs, chain...)
+	}
+	if len(cs.VerifiedChains) == 0 && len(cs.PeerCertificates) > 0 {
+		certs = cs.PeerCertificates[:1]
+	}
+	for _, cert := range certs {
+		pin := SPKIPin(cert)
+		for _, want := range p.Pins {
+			if pin == "sha256/"+strings.TrimPrefix(want, "sha256/") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// applyCertificatePolicy makes cfg verify host's certificates by the first
+// policy covering it. Safe on a nil config.
+func (c *TransportConfig) applyCertificatePolicy(cfg *utls.Config, host string) {
+	if c == nil {
+		return
+	}
+	for _, p := range c.CertificatePolicies {
+		if !p.matches(host) {
+			continue
+		}
+		if p.RootCAs != nil {
+			cfg.RootCAs = p.RootCAs
+		}
+		if p.InsecureSkipVerify {
+			cfg.InsecureSkipVerify = true
+		}
+		if len(p.Pins) > 0 || p.VerifyPeerCertificate != nil {
+			// VerifyConnection, unlike VerifyPeerCertificate, also runs on
+			// resumed connections
+			cfg.VerifyConnection = func(cs utls.ConnectionState) error {
+				return p.verify(host, cs)
+			}
+		}
+		return
+	}
+}
+
+// applyHostTLS sets up cfg, a per-connection TLS config, for host: its
+// client certificate and certificate policy
+func (c *TransportConfig) applyHostTLS(cfg *utls.Config, host string) {
+	c.applyClientCertificate(cfg, host)
+	c.applyCertificatePolicy(cfg, host)
+}
@@ -0,0 +1,163 @@
+package transport
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	utls "github.com/sardanioss/utls"
+)
+
+func TestCertificatePolicy(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "pinned.example"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs := utls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+
+	var called [][]byte
+	config := &TransportConfig{CertificatePolicies: []*CertificatePolicy{
+		{Hosts: []string{"pinned.example"}, Pins: []string{SPKIPin(cert)}},
+		{Hosts: []string{"wrong.example"}, Pins: []string{"sha256/AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="}},
+		{Hosts: []string{"lab.example"}, InsecureSkipVerify: true, VerifyPeerCertificate: func(raw [][]byte, _ [][]*x509.Certificate) error {
+			called = raw
+			return nil
+		}},
+	}}
+
+	for host, want := range map[string]error{"api.pinned.example": nil, "wrong.example": ErrPinMismatch, "lab.example": nil} {
+		cfg := &utls.Config{}
+		config.applyCertificatePolicy(cfg, host)
+		if cfg.VerifyConnection == nil {
+			t.Fatalf("%s: no verification installed", host)
+		}
+		if err := cfg.VerifyConnection(cs); !errors.Is(err, want) {
+			t.Errorf("%s: verify = %v, want %v", host, err, want)
+		}
+		if cfg.InsecureSkipVerify != (host == "lab.example") {
+			t.Errorf("%s: InsecureSkipVerify = %v", host, cfg.InsecureSkipVerify)
+		}
+	}
+	if len(called) != 1 || string(called[0]) != string(der) {
+		t.Errorf("callback got %d certificates", len(called))
+	}
+
+	cfg := &utls.Config{}
+	config.applyCertificatePolicy(cfg, "other.example")
+	if cfg.VerifyConnection != nil || cfg.InsecureSkipVerify {
+		t.Error("policy applied to a host it doesn't cover")
+	}
+}
+
+// newTestCert makes a certificate for name signed by parent's key, or
+// self-signed when parent is nil
+func newTestCert(t *testing.T, name string, isCA bool, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		DNSNames:              []string{name},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func TestCertificatePolicyIgnoresUnverifiedCertificates(t *testing.T) {
+	ca, caKey := newTestCert(t, "Test CA", true, nil, nil)
+	leaf, _ := newTestCert(t, "api.example", false, ca, caKey)
+	// Anyone can append the pinned site's public certificate to a chain
+	// they own
+	pinnedSite, _ := newTestCert(t, "pinned.example", false, nil, nil)
+
+	cs := utls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{leaf, ca, pinnedSite},
+		VerifiedChains:   [][]*x509.Certificate{{leaf, ca}},
+	}
+
+	p := &CertificatePolicy{Pins: []string{SPKIPin(pinnedSite)}}
+	if err := p.verify("api.example", cs); !errors.Is(err, ErrPinMismatch) {
+		t.Errorf("appended pinned certificate: verify = %v, want ErrPinMismatch", err)
+	}
+	p = &CertificatePolicy{Pins: []string{SPKIPin(ca)}}
+	if err := p.verify("api.example", cs); err != nil {
+		t.Errorf("pinned CA of the verified chain: verify = %v", err)
+	}
+
+	// Without verified chains only the leaf counts
+	cs.VerifiedChains = nil
+	if err := p.verify("api.example", cs); !errors.Is(err, ErrPinMismatch) {
+		t.Errorf("unverified CA: verify = %v, want ErrPinMismatch", err)
+	}
+	p = &CertificatePolicy{Pins: []string{SPKIPin(leaf)}}
+	if err := p.verify("api.example", cs); err != nil {
+		t.Errorf("pinned leaf: verify = %v", err)
+	}
+}
+
+func TestCertificatePolicySurvivesRebuild(t *testing.T) {
+	config := &TransportConfig{CertificatePolicies: []*CertificatePolicy{
+		{Hosts: []string{"pinned.example"}, Pins: []string{"sha256/AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="}},
+	}}
+	tr := NewTransportWithConfig("chrome-143", nil, config)
+	defer tr.Close()
+
+	check := func(step string) {
+		t.Helper()
+		configs := map[string]*TransportConfig{"h1": tr.h1Transport.config, "h2": tr.h2Transport.config}
+		if c := h3TransportConfig(tr.h3Transport); c != nil {
+			configs["h3"] = c
+		}
+		for proto, c := range configs {
+			cfg := &utls.Config{}
+			c.applyHostTLS(cfg, "pinned.example")
+			if cfg.VerifyConnection == nil {
+				t.Errorf("after %s: %s transport dropped the pins", step, proto)
+			}
+		}
+	}
+	check("construction")
+	tr.SetProxy(&ProxyConfig{URL: "http://127.0.0.1:3128"})
+	check("SetProxy")
+	tr.SetPreset("firefox-133")
+	check("SetPreset")
+}
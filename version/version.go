@@ -0,0 +1,133 @@
+// Package version reports build provenance for httpcloak: the library release,
+// the preset database revision, the utls/quic-go forks it was linked against
+// and the VCS revision of the build.
+//
+// The information is embedded in saved sessions so that "old sessions behave
+// differently" reports can be correlated with the fingerprint code that
+// produced them.
+package version
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+
+	"github.com/sardanioss/httpcloak/fingerprint"
+)
+
+// Version is the httpcloak release. It can be overridden at link time:
+//
+//	go build -ldflags "-X github.com/sardanioss/httpcloak/version.Version=1.6.0"
+var Version = "1.6.0-beta.13"
+
+// BuildHash identifies the exact source the binary was built from.
+// When empty it is filled from the VCS revision recorded by the Go toolchain.
+// It can be overridden at link time like Version.
+var BuildHash = ""
+
+const (
+	utlsPath = "github.com/sardanioss/utls"
+	quicPath = "github.com/sardanioss/quic-go"
+)
+
+// Info describes the build that is currently running.
+type Info struct {
+	Version        string `json:"version"`
+	PresetDatabase string `json:"preset_database"`
+	UTLS           string `json:"utls,omitempty"`
+	QUICGo         string `json:"quic_go,omitempty"`
+	BuildHash      string `json:"build_hash,omitempty"`
+	GoVersion      string `json:"go_version"`
+}
+
+// String returns a compact single-line representation.
+func (i Info) String() string {
+	parts := []string{
+		"httpcloak/" + i.Version,
+		"presets/" + i.PresetDatabase,
+	}
+	if i.UTLS != "" {
+		parts = append(parts, "utls/"+i.UTLS)
+	}
+	if i.QUICGo != "" {
+		parts = append(parts, "quic-go/"+i.QUICGo)
+	}
+	if i.BuildHash != "" {
+		parts = append(parts, "build/"+i.BuildHash)
+	}
+	parts = append(parts, i.GoVersion)
+	return strings.Join(parts, " ")
+}
+
+var (
+	infoOnce sync.Once
+	info     Info
+)
+
+// Get returns the build information. The result is computed once.
+func Get() Info {
+	infoOnce.Do(func() {
+		info = Info{
+			Version:        Version,
+			PresetDatabase: fingerprint.PresetDatabaseVersion,
+			BuildHash:      BuildHash,
+			GoVersion:      runtime.Version(),
+		}
+
+		bi, ok := debug.ReadBuildInfo()
+		if !ok {
+			return
+		}
+		for _, dep := range bi.Deps {
+			switch dep.Path {
+			case utlsPath:
+				info.UTLS = moduleVersion(dep)
+			case quicPath:
+				info.QUICGo = moduleVersion(dep)
+			}
+		}
+		if info.BuildHash == "" {
+			info.BuildHash = vcsRevision(bi)
+		}
+	})
+	return info
+}
+
+// moduleVersion formats a module's version, including replace directives
+// (forks are usually pinned via replace during development).
+func moduleVersion(m *debug.Module) string {
+	if m.Replace == nil {
+		return m.Version
+	}
+	if m.Replace.Version != "" {
+		return m.Replace.Version
+	}
+	return fmt.Sprintf("%s (replaced by %s)", m.Version, m.Replace.Path)
+}
+
+// vcsRevision extracts a short VCS revision from build settings, suffixed
+// with "-dirty" when the tree had local modifications.
+func vcsRevision(bi *debug.BuildInfo) string {
+	var revision string
+	var modified bool
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			revision = s.Value
+		case "vcs.modified":
+			modified = s.Value == "true"
+		}
+	}
+	if revision == "" {
+		return ""
+	}
+	if len(revision) > 12 {
+		revision = revision[:12]
+	}
+	if modified {
+		revision += "-dirty"
+	}
+	return revision
+}